@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/drama-generator/backend/application/services"
@@ -29,6 +30,10 @@ func (h *AdminAIConfigHandler) CreateConfig(c *gin.Context) {
 	}
 
 	cfg, err := h.aiService.CreateConfig(&req /* platform scope */)
+	if errors.Is(err, services.ErrAPIKeyRequired) {
+		response.BadRequest(c, err.Error())
+		return
+	}
 	if err != nil {
 		h.log.Errorw("failed to create platform ai config", "error", err)
 		response.InternalError(c, "创建失败")
@@ -95,7 +100,7 @@ func (h *AdminAIConfigHandler) TestConnection(c *gin.Context) {
 		response.BadRequest(c, err.Error())
 		return
 	}
-	if err := h.aiService.TestConnection(&req); err != nil {
+	if err := h.aiService.TestConnection(c.Request.Context(), &req); err != nil {
 		response.BadRequest(c, "连接测试失败: "+err.Error())
 		return
 	}
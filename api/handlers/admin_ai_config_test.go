@@ -54,7 +54,7 @@ func newAdminAIConfigTestEnv(t *testing.T) (*gin.Engine, *gorm.DB, string) {
 	log := logger.NewLogger(true)
 	repo := persistence.NewGormUserRepository(db)
 	authSvc := services.NewAuthService(repo, cfg, log)
-	aiService := services.NewAIService(db, log)
+	aiService := services.NewAIService(db, &config.Config{}, log)
 	adminToken, err := authSvc.GenerateAdminToken(models.User{ID: 1, Email: "admin@example.com", Role: models.RolePlatformAdmin})
 	if err != nil {
 		t.Fatalf("failed to generate admin token: %v", err)
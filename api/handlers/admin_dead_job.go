@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminDeadJobHandler 死信任务的查看与重放
+type AdminDeadJobHandler struct {
+	store services.DeadLetterStore
+	audit *services.AdminAuditService
+	log   *logger.Logger
+}
+
+func NewAdminDeadJobHandler(store services.DeadLetterStore, audit *services.AdminAuditService, log *logger.Logger) *AdminDeadJobHandler {
+	return &AdminDeadJobHandler{
+		store: store,
+		audit: audit,
+		log:   log,
+	}
+}
+
+func (h *AdminDeadJobHandler) available(c *gin.Context) bool {
+	if h.store == nil {
+		response.Error(c, http.StatusServiceUnavailable, "DEAD_LETTER_UNAVAILABLE", "任务队列未启用")
+		return false
+	}
+	return true
+}
+
+func (h *AdminDeadJobHandler) ListDeadJobs(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	jobs, err := h.store.ListDeadJobs(limit)
+	if err != nil {
+		h.log.Errorw("failed to list dead jobs", "error", err)
+		response.InternalError(c, "查询死信任务失败")
+		return
+	}
+	response.Success(c, gin.H{"items": jobs, "count": len(jobs)})
+}
+
+func (h *AdminDeadJobHandler) GetDeadJob(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	job, err := h.store.GetDeadJob(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrDeadJobNotFound) {
+			response.NotFound(c, "死信任务不存在")
+			return
+		}
+		h.log.Errorw("failed to get dead job", "error", err, "id", c.Param("id"))
+		response.InternalError(c, "查询死信任务失败")
+		return
+	}
+	response.Success(c, job)
+}
+
+func (h *AdminDeadJobHandler) ReplayDeadJob(c *gin.Context) {
+	adminID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "invalid admin context")
+		return
+	}
+	if !h.available(c) {
+		return
+	}
+
+	id := c.Param("id")
+	job, err := h.store.ReplayDeadJob(id)
+	if err != nil {
+		if errors.Is(err, services.ErrDeadJobNotFound) {
+			response.NotFound(c, "死信任务不存在")
+			return
+		}
+		h.log.Errorw("failed to replay dead job", "error", err, "id", id)
+		response.InternalError(c, "重放死信任务失败")
+		return
+	}
+
+	if h.audit != nil {
+		after := map[string]interface{}{"type": job.Type, "attempts": job.Attempts, "error": job.Error}
+		if err := h.audit.WriteWithTx(nil, adminID, "job.replay", "dead_job", id, nil, after,
+			services.AdminActorMeta{IP: c.ClientIP(), UserAgent: c.GetHeader("User-Agent")}); err != nil {
+			h.log.Warnw("failed to write dead job replay audit log", "error", err, "id", id)
+		}
+	}
+
+	response.Success(c, job)
+}
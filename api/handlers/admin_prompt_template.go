@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+// NewAdminPromptTemplateHandler 管理员版本：可管理平台默认模板及任意用户的模板，变更写入审计日志
+func NewAdminPromptTemplateHandler(service *services.PromptTemplateService, audit *services.AdminAuditService, log *logger.Logger) *PromptTemplateHandler {
+	return &PromptTemplateHandler{
+		service: service,
+		audit:   audit,
+		admin:   true,
+		log:     log,
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/drama-generator/backend/application/services"
@@ -36,6 +37,10 @@ func (h *AIConfigHandler) CreateConfig(c *gin.Context) {
 	}
 
 	config, err := h.aiService.CreateConfig(&req, userID)
+	if errors.Is(err, services.ErrAPIKeyRequired) {
+		response.BadRequest(c, err.Error())
+		return
+	}
 	if err != nil {
 		response.InternalError(c, "创建失败")
 		return
@@ -152,7 +157,7 @@ func (h *AIConfigHandler) TestConnection(c *gin.Context) {
 		return
 	}
 
-	if err := h.aiService.TestConnection(&req); err != nil {
+	if err := h.aiService.TestConnection(c.Request.Context(), &req); err != nil {
 		response.BadRequest(c, "连接测试失败: "+err.Error())
 		return
 	}
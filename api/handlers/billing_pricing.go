@@ -40,7 +40,7 @@ func (h *BillingPricingHandler) GetPricing(c *gin.Context) {
 		return
 	}
 
-	serviceTypes := []string{"text", "image", "video"}
+	serviceTypes := []string{"text", "image", "video", "audio", "music"}
 	defaults := make([]ServicePricing, 0, len(serviceTypes))
 	for _, st := range serviceTypes {
 		cfg, model, err := h.aiService.GetBillingConfig(st, "", userID)
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 
 	"github.com/drama-generator/backend/application/services"
 	"github.com/drama-generator/backend/domain/models"
@@ -43,6 +44,10 @@ func (h *DramaHandler) CreateDrama(c *gin.Context) {
 
 	drama, err := h.dramaService.CreateDrama(userID, &req)
 	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedPromptLanguage) {
+			response.BadRequest(c, "不支持的语言")
+			return
+		}
 		response.InternalError(c, "创建失败")
 		return
 	}
@@ -122,6 +127,10 @@ func (h *DramaHandler) UpdateDrama(c *gin.Context) {
 			response.NotFound(c, "剧本不存在")
 			return
 		}
+		if errors.Is(err, services.ErrUnsupportedPromptLanguage) {
+			response.BadRequest(c, "不支持的语言")
+			return
+		}
 		response.InternalError(c, "更新失败")
 		return
 	}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"errors"
+	"io"
+	"net/http"
 	"strconv"
 
 	"github.com/drama-generator/backend/application/services"
 	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/image"
 	"github.com/drama-generator/backend/pkg/logger"
 	"github.com/drama-generator/backend/pkg/response"
 	"github.com/drama-generator/backend/pkg/tenant"
@@ -51,6 +54,10 @@ func (h *ImageGenerationHandler) GenerateImage(c *gin.Context) {
 			response.Forbidden(c, "积分不足")
 			return
 		}
+		if errors.Is(err, services.ErrInvalidPanelComposite) {
+			response.BadRequest(c, err.Error())
+			return
+		}
 		h.log.Errorw("Failed to generate image", "error", err)
 		response.InternalError(c, err.Error())
 		return
@@ -193,6 +200,93 @@ func (h *ImageGenerationHandler) GetImageGeneration(c *gin.Context) {
 	response.Success(c, imageGen)
 }
 
+// CancelImageGeneration 取消排队或生成中的图片
+func (h *ImageGenerationHandler) CancelImageGeneration(c *gin.Context) {
+	userID, authErr := tenant.GetUserID(c)
+	if authErr != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	imageGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	imageGen, err := h.imageService.CancelImageGeneration(userID, uint(imageGenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "图片生成记录不存在")
+			return
+		}
+		if errors.Is(err, services.ErrTaskNotCancellable) {
+			response.Error(c, http.StatusConflict, "TASK_NOT_CANCELLABLE", "任务已结束，无法取消")
+			return
+		}
+		h.log.Errorw("Failed to cancel image generation", "error", err, "id", imageGenID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, imageGen)
+}
+
+// EditImage 按蒙版局部重绘已生成的图片
+func (h *ImageGenerationHandler) EditImage(c *gin.Context) {
+	h.editImage(c, image.EditInpaint)
+}
+
+// OutpaintImage 扩图到新的画面比例，默认 9:16
+func (h *ImageGenerationHandler) OutpaintImage(c *gin.Context) {
+	h.editImage(c, image.EditOutpaint)
+}
+
+// CreateVariations 生成 n 张相似变体
+func (h *ImageGenerationHandler) CreateVariations(c *gin.Context) {
+	h.editImage(c, image.EditVariation)
+}
+
+func (h *ImageGenerationHandler) editImage(c *gin.Context, op image.EditOperation) {
+	userID, authErr := tenant.GetUserID(c)
+	if authErr != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	imageGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req services.EditImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	children, err := h.imageService.EditImage(userID, uint(imageGenID), op, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.NotFound(c, "图片生成记录不存在")
+		case errors.Is(err, services.ErrInvalidImageEdit):
+			response.BadRequest(c, err.Error())
+		case errors.Is(err, services.ErrImageNotReady):
+			response.Error(c, http.StatusConflict, "IMAGE_NOT_READY", "源图片尚未生成完成")
+		case errors.Is(err, services.ErrInsufficientCredits):
+			response.Forbidden(c, "积分不足")
+		default:
+			h.log.Errorw("Failed to edit image", "error", err, "id", imageGenID, "operation", op)
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	response.Success(c, children)
+}
+
 func (h *ImageGenerationHandler) ListImageGenerations(c *gin.Context) {
 	userID, err := tenant.GetUserID(c)
 	if err != nil {
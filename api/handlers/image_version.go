@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+type ImageVersionHandler struct {
+	versionService *services.ImageVersionService
+	log            *logger.Logger
+}
+
+func NewImageVersionHandler(versionService *services.ImageVersionService, log *logger.Logger) *ImageVersionHandler {
+	return &ImageVersionHandler{
+		versionService: versionService,
+		log:            log,
+	}
+}
+
+// ListVersions 角色、场景、道具或分镜的图片历史版本
+func (h *ImageVersionHandler) ListVersions(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	entityID, ok := parseIDParam(c, "entity_id")
+	if !ok {
+		return
+	}
+
+	history, err := h.versionService.ListVersions(userID, c.Param("entity_type"), entityID)
+	if err != nil {
+		h.writeError(c, err, "获取图片历史失败")
+		return
+	}
+
+	response.Success(c, history)
+}
+
+// RevertVersion 把实体的图片切换回指定的历史版本
+func (h *ImageVersionHandler) RevertVersion(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	entityID, ok := parseIDParam(c, "entity_id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ImageGenerationID uint `json:"image_generation_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	history, err := h.versionService.Revert(userID, c.Param("entity_type"), entityID, req.ImageGenerationID)
+	if err != nil {
+		h.writeError(c, err, "回退图片版本失败")
+		return
+	}
+
+	response.Success(c, history)
+}
+
+// CompareVersions 对比历史版本，ids 为逗号分隔的图片生成记录ID，不传时对比当前版本和上一个版本
+func (h *ImageVersionHandler) CompareVersions(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	entityID, ok := parseIDParam(c, "entity_id")
+	if !ok {
+		return
+	}
+
+	var ids []uint
+	for _, raw := range strings.Split(c.Query("ids"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			response.BadRequest(c, "无效的ID")
+			return
+		}
+		ids = append(ids, uint(id))
+	}
+
+	comparison, err := h.versionService.Compare(userID, c.Param("entity_type"), entityID, ids)
+	if err != nil {
+		h.writeError(c, err, "对比图片版本失败")
+		return
+	}
+
+	response.Success(c, comparison)
+}
+
+func (h *ImageVersionHandler) writeError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrUnknownImageEntity):
+		response.BadRequest(c, "不支持的类型，可选 character、scene、prop、storyboard")
+	case errors.Is(err, services.ErrImageEntityNotFound):
+		response.NotFound(c, "对象不存在")
+	case errors.Is(err, services.ErrImageVersionNotFound):
+		response.NotFound(c, "图片版本不存在")
+	default:
+		h.log.Errorw(message, "error", err, "entity_type", c.Param("entity_type"), "entity_id", c.Param("entity_id"))
+		response.InternalError(c, message)
+	}
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+// PromptTemplateHandler 提示词模板的版本管理。用户接口只能管理本人及本人剧的模板，
+// 管理员接口可管理平台默认模板和任意用户的模板
+type PromptTemplateHandler struct {
+	service *services.PromptTemplateService
+	audit   *services.AdminAuditService
+	admin   bool
+	log     *logger.Logger
+}
+
+func NewPromptTemplateHandler(service *services.PromptTemplateService, log *logger.Logger) *PromptTemplateHandler {
+	return &PromptTemplateHandler{
+		service: service,
+		log:     log,
+	}
+}
+
+// currentUser 返回 (owner, 当前用户ID)，管理员的 owner 为 0 表示不限定归属
+func (h *PromptTemplateHandler) currentUser(c *gin.Context) (uint, uint, bool) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return 0, 0, false
+	}
+	if h.admin {
+		return 0, userID, true
+	}
+	return userID, userID, true
+}
+
+// ListKeys 列出可调整的提示词、可用变量及内置正文
+func (h *PromptTemplateHandler) ListKeys(c *gin.Context) {
+	if _, _, ok := h.currentUser(c); !ok {
+		return
+	}
+
+	keys, err := h.service.ListKeys(c.Query("language"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	response.Success(c, keys)
+}
+
+func (h *PromptTemplateHandler) ListTemplates(c *gin.Context) {
+	owner, _, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	filter := services.PromptTemplateFilter{
+		Key:      c.Query("key"),
+		Language: c.Query("language"),
+	}
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			response.BadRequest(c, "invalid user_id")
+			return
+		}
+		userID := uint(id)
+		filter.UserID = &userID
+	}
+	if raw := c.Query("drama_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			response.BadRequest(c, "invalid drama_id")
+			return
+		}
+		dramaID := uint(id)
+		filter.DramaID = &dramaID
+	}
+
+	templates, err := h.service.ListTemplates(owner, filter)
+	if err != nil {
+		h.log.Errorw("Failed to list prompt templates", "error", err)
+		h.writeError(c, err)
+		return
+	}
+	response.Success(c, templates)
+}
+
+func (h *PromptTemplateHandler) GetTemplate(c *gin.Context) {
+	owner, _, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	templateID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	template, err := h.service.GetTemplate(owner, templateID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	response.Success(c, template)
+}
+
+// CreateTemplate 保存新版本，默认立即生效
+func (h *PromptTemplateHandler) CreateTemplate(c *gin.Context) {
+	owner, userID, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req services.CreatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	template, err := h.service.CreateVersion(owner, userID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.writeAudit(c, userID, "prompt_template.create", template)
+	response.Created(c, template)
+}
+
+// ActivateTemplate 启用指定版本，用于回滚
+func (h *PromptTemplateHandler) ActivateTemplate(c *gin.Context) {
+	owner, userID, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	templateID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	template, err := h.service.ActivateVersion(owner, templateID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.writeAudit(c, userID, "prompt_template.activate", template)
+	response.Success(c, template)
+}
+
+// DeactivateTemplate 停用版本，回退到上一级模板或内置提示词
+func (h *PromptTemplateHandler) DeactivateTemplate(c *gin.Context) {
+	owner, userID, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	templateID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	template, err := h.service.DeactivateVersion(owner, templateID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.writeAudit(c, userID, "prompt_template.deactivate", template)
+	response.Success(c, template)
+}
+
+func (h *PromptTemplateHandler) DeleteTemplate(c *gin.Context) {
+	owner, userID, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	templateID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	template, err := h.service.GetTemplate(owner, templateID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if err := h.service.DeleteVersion(owner, templateID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.writeAudit(c, userID, "prompt_template.delete", template)
+	response.Success(c, nil)
+}
+
+// PreviewTemplate 用示例变量渲染模板，便于保存前检查效果
+func (h *PromptTemplateHandler) PreviewTemplate(c *gin.Context) {
+	owner, _, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req services.PromptTemplatePreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	preview, err := h.service.Preview(owner, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	response.Success(c, preview)
+}
+
+func (h *PromptTemplateHandler) writeAudit(c *gin.Context, adminID uint, action string, template *models.PromptTemplate) {
+	if !h.admin || h.audit == nil {
+		return
+	}
+	after := map[string]interface{}{
+		"key":       template.TemplateKey,
+		"language":  template.Language,
+		"user_id":   template.UserID,
+		"drama_id":  template.DramaID,
+		"version":   template.Version,
+		"is_active": template.IsActive,
+	}
+	targetID := strconv.FormatUint(uint64(template.ID), 10)
+	if err := h.audit.WriteWithTx(nil, adminID, action, "prompt_template", targetID, nil, after,
+		services.AdminActorMeta{IP: c.ClientIP(), UserAgent: c.GetHeader("User-Agent")}); err != nil {
+		h.log.Warnw("failed to write prompt template audit log", "error", err, "id", template.ID)
+	}
+}
+
+func (h *PromptTemplateHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPromptTemplateNotFound),
+		errors.Is(err, services.ErrPromptTemplateDramaNotFound):
+		response.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrUnknownPromptTemplateKey),
+		errors.Is(err, services.ErrUnsupportedPromptLanguage),
+		errors.Is(err, services.ErrUnknownPromptVariable):
+		response.BadRequest(c, err.Error())
+	default:
+		response.InternalError(c, err.Error())
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+type ScoreHandler struct {
+	scoreService *services.ScoreService
+	log          *logger.Logger
+}
+
+func NewScoreHandler(scoreService *services.ScoreService, log *logger.Logger) *ScoreHandler {
+	return &ScoreHandler{
+		scoreService: scoreService,
+		log:          log,
+	}
+}
+
+// GenerateEpisodeScore 根据分镜配乐提示词和音效生成剧集配乐（异步任务）
+func (h *ScoreHandler) GenerateEpisodeScore(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	episodeID, err := strconv.ParseUint(c.Param("episode_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req services.GenerateScoreRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	taskID, err := h.scoreService.GenerateEpisodeScore(userID, uint(episodeID), &req)
+	if err != nil {
+		if errors.Is(err, services.ErrEpisodeNotFound) {
+			response.NotFound(c, "剧集不存在")
+			return
+		}
+		h.log.Errorw("Failed to start score generation", "error", err, "episode_id", episodeID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{
+		"task_id": taskID,
+		"status":  "pending",
+		"message": "配乐生成任务已创建，正在后台处理...",
+	})
+}
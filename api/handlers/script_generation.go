@@ -76,23 +76,27 @@ func (h *ScriptGenerationHandler) PolishEpisodeScript(c *gin.Context) {
 	}
 
 	var req struct {
-		Content   string `json:"content"`
-		Model     string `json:"model"`
-		SkillName string `json:"skill_name"`
+		Content    string            `json:"content"`
+		Model      string            `json:"model"`
+		SkillName  string            `json:"skill_name"`
+		Parameters map[string]string `json:"parameters"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		// 允许空body，默认使用数据库中的章节内容
 		req.Content = ""
 		req.Model = ""
 		req.SkillName = ""
+		req.Parameters = nil
 	}
 
 	polished, usedSkill, err := h.scriptService.PolishEpisodeScript(
+		c.Request.Context(),
 		userID,
 		uint(episodeIDUint),
 		req.Content,
 		req.Model,
 		req.SkillName,
+		req.Parameters,
 	)
 	if err != nil {
 		if errors.Is(err, services.ErrInsufficientCredits) {
@@ -111,6 +115,10 @@ func (h *ScriptGenerationHandler) PolishEpisodeScript(c *gin.Context) {
 			response.BadRequest(c, "章节内容为空，无法润色")
 			return
 		}
+		if isScriptPolishSkillError(err) {
+			response.BadRequest(c, err.Error())
+			return
+		}
 		h.log.Errorw("Failed to polish episode script",
 			"error", err,
 			"episode_id", episodeIDUint,
@@ -125,6 +133,11 @@ func (h *ScriptGenerationHandler) PolishEpisodeScript(c *gin.Context) {
 	})
 }
 
+// ListPolishSkills 列出可用的润色技能及其参数
+func (h *ScriptGenerationHandler) ListPolishSkills(c *gin.Context) {
+	response.Success(c, h.scriptService.ListPolishSkills())
+}
+
 func (h *ScriptGenerationHandler) PolishScriptText(c *gin.Context) {
 	userID, err := tenant.GetUserID(c)
 	if err != nil {
@@ -133,9 +146,10 @@ func (h *ScriptGenerationHandler) PolishScriptText(c *gin.Context) {
 	}
 
 	var req struct {
-		Content   string `json:"content" binding:"required"`
-		Model     string `json:"model"`
-		SkillName string `json:"skill_name"`
+		Content    string            `json:"content" binding:"required"`
+		Model      string            `json:"model"`
+		SkillName  string            `json:"skill_name"`
+		Parameters map[string]string `json:"parameters"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.BadRequest(c, err.Error())
@@ -143,10 +157,12 @@ func (h *ScriptGenerationHandler) PolishScriptText(c *gin.Context) {
 	}
 
 	polished, usedSkill, err := h.scriptService.PolishScriptText(
+		c.Request.Context(),
 		userID,
 		req.Content,
 		req.Model,
 		req.SkillName,
+		req.Parameters,
 	)
 	if err != nil {
 		if errors.Is(err, services.ErrInsufficientCredits) {
@@ -161,6 +177,10 @@ func (h *ScriptGenerationHandler) PolishScriptText(c *gin.Context) {
 			response.BadRequest(c, "章节内容为空，无法润色")
 			return
 		}
+		if isScriptPolishSkillError(err) {
+			response.BadRequest(c, err.Error())
+			return
+		}
 		h.log.Errorw("Failed to polish script text", "error", err, "user_id", userID)
 		response.InternalError(c, "润色失败")
 		return
@@ -180,9 +200,10 @@ func (h *ScriptGenerationHandler) PolishScriptTextStream(c *gin.Context) {
 	}
 
 	var req struct {
-		Content   string `json:"content" binding:"required"`
-		Model     string `json:"model"`
-		SkillName string `json:"skill_name"`
+		Content    string            `json:"content" binding:"required"`
+		Model      string            `json:"model"`
+		SkillName  string            `json:"skill_name"`
+		Parameters map[string]string `json:"parameters"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.BadRequest(c, err.Error())
@@ -214,10 +235,12 @@ func (h *ScriptGenerationHandler) PolishScriptTextStream(c *gin.Context) {
 	}
 
 	polished, usedSkill, err := h.scriptService.PolishScriptTextStream(
+		c.Request.Context(),
 		userID,
 		req.Content,
 		req.Model,
 		req.SkillName,
+		req.Parameters,
 		chunkCallback,
 	)
 	if err != nil {
@@ -237,6 +260,10 @@ func (h *ScriptGenerationHandler) PolishScriptTextStream(c *gin.Context) {
 			statusCode = http.StatusBadRequest
 			message = "章节内容为空，无法润色"
 			code = "BAD_REQUEST"
+		case isScriptPolishSkillError(err):
+			statusCode = http.StatusBadRequest
+			message = err.Error()
+			code = "BAD_REQUEST"
 		}
 		h.log.Errorw("Failed to polish script text stream", "error", err, "user_id", userID)
 		_ = writeSSE(c, flusher, "error", gin.H{
@@ -278,3 +305,8 @@ func isUpstreamAITimeout(err error) bool {
 		strings.Contains(msg, "i/o timeout") ||
 		strings.Contains(msg, "context deadline exceeded")
 }
+
+func isScriptPolishSkillError(err error) bool {
+	return errors.Is(err, services.ErrUnknownScriptPolishSkill) ||
+		errors.Is(err, services.ErrInvalidScriptPolishParams)
+}
@@ -1,67 +1,96 @@
 package handlers
 
 import (
-	"github.com/drama-generator/backend/pkg/config"
+	"errors"
+
+	"github.com/drama-generator/backend/application/services"
 	"github.com/drama-generator/backend/pkg/logger"
 	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
 )
 
 type SettingsHandler struct {
-	config *config.Config
-	log    *logger.Logger
+	languageService *services.LanguageService
+	log             *logger.Logger
 }
 
-func NewSettingsHandler(cfg *config.Config, log *logger.Logger) *SettingsHandler {
+func NewSettingsHandler(languageService *services.LanguageService, log *logger.Logger) *SettingsHandler {
 	return &SettingsHandler{
-		config: cfg,
-		log:    log,
+		languageService: languageService,
+		log:             log,
 	}
 }
 
-// GetLanguage 获取当前系统语言
+// GetLanguage 获取当前用户的语言设置及可选语言
 func (h *SettingsHandler) GetLanguage(c *gin.Context) {
-	language := h.config.App.Language
-	if language == "" {
-		language = "zh" // 默认中文
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
 	}
 
-	response.Success(c, gin.H{
-		"language": language,
-	})
+	language, err := h.languageService.GetUserLanguage(userID)
+	if err != nil {
+		h.log.Errorw("Failed to get user language", "error", err, "user_id", userID)
+		response.InternalError(c, "获取语言设置失败")
+		return
+	}
+
+	response.Success(c, language)
 }
 
-// UpdateLanguage 更新系统语言
+// UpdateLanguage 更新当前用户的语言，空字符串表示跟随系统默认；剧单独设置的语言优先
 func (h *SettingsHandler) UpdateLanguage(c *gin.Context) {
-	var req struct {
-		Language string `json:"language" binding:"required,oneof=zh en"`
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
 	}
 
+	var req struct {
+		Language string `json:"language"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		response.BadRequest(c, "语言参数错误，只支持 zh 或 en")
+		response.BadRequest(c, err.Error())
 		return
 	}
 
-	// 更新内存中的配置
-	h.config.App.Language = req.Language
-
-	// 更新配置文件
-	viper.Set("app.language", req.Language)
-	if err := viper.WriteConfig(); err != nil {
-		h.log.Warnw("Failed to write config file", "error", err)
-		// 即使写入文件失败，内存配置也已更新，仍然可用
+	language, err := h.languageService.UpdateUserLanguage(userID, req.Language)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedPromptLanguage) {
+			response.BadRequest(c, "不支持的语言")
+			return
+		}
+		h.log.Errorw("Failed to update user language", "error", err, "user_id", userID)
+		response.InternalError(c, "更新语言设置失败")
+		return
 	}
 
-	h.log.Infow("System language updated", "language", req.Language)
+	response.Success(c, language)
+}
+
+// UpdateDefaultLanguage 管理员修改系统默认语言，只影响未设置语言的用户和剧
+func (h *SettingsHandler) UpdateDefaultLanguage(c *gin.Context) {
+	var req struct {
+		Language string `json:"language" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
 
-	message := "语言已切换为中文"
-	if req.Language == "en" {
-		message = "Language switched to English"
+	if err := h.languageService.UpdateDefaultLanguage(req.Language); err != nil {
+		if errors.Is(err, services.ErrUnsupportedPromptLanguage) {
+			response.BadRequest(c, "不支持的语言")
+			return
+		}
+		response.InternalError(c, "更新默认语言失败")
+		return
 	}
 
 	response.Success(c, gin.H{
-		"message":  message,
-		"language": req.Language,
+		"language":  req.Language,
+		"available": h.languageService.SupportedLanguages(),
 	})
 }
@@ -14,13 +14,15 @@ import (
 type StoryboardHandler struct {
 	storyboardService *services.StoryboardService
 	taskService       *services.TaskService
+	references        *services.StoryboardReferenceResolver
 	log               *logger.Logger
 }
 
-func NewStoryboardHandler(storyboardService *services.StoryboardService, taskService *services.TaskService, log *logger.Logger) *StoryboardHandler {
+func NewStoryboardHandler(storyboardService *services.StoryboardService, taskService *services.TaskService, references *services.StoryboardReferenceResolver, log *logger.Logger) *StoryboardHandler {
 	return &StoryboardHandler{
 		storyboardService: storyboardService,
 		taskService:       taskService,
+		references:        references,
 		log:               log,
 	}
 }
@@ -101,7 +103,7 @@ func (h *StoryboardHandler) OptimizeVideoPrompt(c *gin.Context) {
 	}
 	_ = c.ShouldBindJSON(&req)
 
-	optimized, err := h.storyboardService.OptimizeVideoPrompt(userID, storyboardID, req.Prompt, req.Model)
+	optimized, err := h.storyboardService.OptimizeVideoPrompt(c.Request.Context(), userID, storyboardID, req.Prompt, req.Model)
 	if err != nil {
 		if errors.Is(err, services.ErrInsufficientCredits) {
 			response.Forbidden(c, "积分不足")
@@ -121,6 +123,37 @@ func (h *StoryboardHandler) OptimizeVideoPrompt(c *gin.Context) {
 	})
 }
 
+// GetReferences 预览生成分镜图片和视频时会自动附带的参考图
+func (h *StoryboardHandler) GetReferences(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	storyboardID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	set, err := h.references.Resolve(userID, storyboardID, 0)
+	if err != nil {
+		if errors.Is(err, services.ErrStoryboardNotFound) {
+			response.NotFound(c, "镜头不存在")
+			return
+		}
+		h.log.Errorw("Failed to resolve storyboard references", "error", err, "storyboard_id", storyboardID)
+		response.InternalError(c, "获取参考图失败")
+		return
+	}
+
+	response.Success(c, gin.H{
+		"enabled":    h.references.Enabled(),
+		"references": set.References,
+		"seed":       set.Seed,
+	})
+}
+
 // CreateStoryboard 创建分镜
 func (h *StoryboardHandler) CreateStoryboard(c *gin.Context) {
 	var req services.CreateStoryboardRequest
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+type SubtitleHandler struct {
+	subtitleService *services.SubtitleService
+	log             *logger.Logger
+}
+
+func NewSubtitleHandler(subtitleService *services.SubtitleService, log *logger.Logger) *SubtitleHandler {
+	return &SubtitleHandler{
+		subtitleService: subtitleService,
+		log:             log,
+	}
+}
+
+// DownloadEpisodeSubtitles 下载剧集字幕（format=srt|vtt）
+func (h *SubtitleHandler) DownloadEpisodeSubtitles(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	episodeID, err := strconv.ParseUint(c.Param("episode_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	file, err := h.subtitleService.ExportEpisodeSubtitles(userID, uint(episodeID), c.DefaultQuery("format", services.SubtitleFormatSRT))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEpisodeNotFound):
+			response.NotFound(c, "剧集不存在")
+		case errors.Is(err, services.ErrUnsupportedSubtitleFormat):
+			response.BadRequest(c, "仅支持 srt 或 vtt 格式")
+		default:
+			h.log.Errorw("Failed to export subtitles", "error", err, "episode_id", episodeID)
+			response.InternalError(c, err.Error())
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.FileName))
+	c.Data(200, file.ContentType, []byte(file.Content))
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
+	"time"
+
 	"github.com/drama-generator/backend/application/services"
 	"github.com/drama-generator/backend/pkg/logger"
 	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -22,9 +27,14 @@ func NewTaskHandler(taskService *services.TaskService, log *logger.Logger) *Task
 
 // GetTaskStatus 获取任务状态
 func (h *TaskHandler) GetTaskStatus(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
 	taskID := c.Param("task_id")
 
-	task, err := h.taskService.GetTask(taskID)
+	task, err := h.taskService.GetUserTask(userID, taskID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			response.NotFound(c, "任务不存在")
@@ -38,15 +48,47 @@ func (h *TaskHandler) GetTaskStatus(c *gin.Context) {
 	response.Success(c, task)
 }
 
+// CancelTask 取消进行中的任务
+func (h *TaskHandler) CancelTask(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	taskID := c.Param("task_id")
+
+	task, err := h.taskService.CancelTask(userID, taskID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "任务不存在")
+			return
+		}
+		if errors.Is(err, services.ErrTaskNotCancellable) {
+			response.Error(c, http.StatusConflict, "TASK_NOT_CANCELLABLE", "任务已结束，无法取消")
+			return
+		}
+		h.log.Errorw("Failed to cancel task", "error", err, "task_id", taskID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, task)
+}
+
 // GetResourceTasks 获取资源相关的所有任务
 func (h *TaskHandler) GetResourceTasks(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
 	resourceID := c.Query("resource_id")
 	if resourceID == "" {
 		response.BadRequest(c, "缺少resource_id参数")
 		return
 	}
 
-	tasks, err := h.taskService.GetTasksByResource(resourceID)
+	tasks, err := h.taskService.GetTasksByResource(userID, resourceID)
 	if err != nil {
 		h.log.Errorw("Failed to get resource tasks", "error", err, "resource_id", resourceID)
 		response.InternalError(c, err.Error())
@@ -55,3 +97,69 @@ func (h *TaskHandler) GetResourceTasks(c *gin.Context) {
 
 	response.Success(c, tasks)
 }
+
+// taskStreamHeartbeat SSE 心跳间隔，避免代理断开空闲连接
+const taskStreamHeartbeat = 15 * time.Second
+
+// StreamTasks 以 SSE 推送资源相关任务的状态、进度与阶段性结果
+// 连接建立后先推送当前任务快照，之后每次任务变更推送一条 task 事件，只推送当前用户的任务
+func (h *TaskHandler) StreamTasks(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	resourceID := c.Query("resource_id")
+	if resourceID == "" {
+		response.BadRequest(c, "缺少resource_id参数")
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		response.InternalError(c, "当前环境不支持流式返回")
+		return
+	}
+
+	// 先订阅再读取快照，避免两者之间的变更丢失
+	events, unsubscribe := h.taskService.SubscribeTaskEvents(userID, resourceID)
+	defer unsubscribe()
+
+	tasks, err := h.taskService.GetTasksByResource(userID, resourceID)
+	if err != nil {
+		h.log.Errorw("Failed to get resource tasks", "error", err, "resource_id", resourceID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for i := len(tasks) - 1; i >= 0; i-- {
+		if err := writeSSE(c, flusher, "task", services.NewTaskEvent(tasks[i])); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(taskStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-events:
+			if err := writeSSE(c, flusher, "task", event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
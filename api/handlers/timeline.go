@@ -0,0 +1,525 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+type TimelineHandler struct {
+	timelineService *services.TimelineService
+	renderService   *services.TimelineRenderService
+	log             *logger.Logger
+}
+
+func NewTimelineHandler(timelineService *services.TimelineService, renderService *services.TimelineRenderService, log *logger.Logger) *TimelineHandler {
+	return &TimelineHandler{
+		timelineService: timelineService,
+		renderService:   renderService,
+		log:             log,
+	}
+}
+
+// CreateTimeline 创建空时间线
+func (h *TimelineHandler) CreateTimeline(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	var req services.CreateTimelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	timeline, err := h.timelineService.CreateTimeline(userID, &req)
+	if err != nil {
+		h.log.Errorw("Failed to create timeline", "error", err)
+		h.writeError(c, err)
+		return
+	}
+
+	response.Created(c, timeline)
+}
+
+// CreateTimelineFromEpisode 根据剧集分镜生成时间线
+func (h *TimelineHandler) CreateTimelineFromEpisode(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	episodeID, err := strconv.ParseUint(c.Param("episode_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	// 请求体可选
+	_ = c.ShouldBindJSON(&req)
+
+	timeline, err := h.timelineService.CreateTimelineFromEpisode(userID, uint(episodeID), req.Name)
+	if err != nil {
+		h.log.Errorw("Failed to create timeline from episode", "error", err, "episode_id", episodeID)
+		h.writeError(c, err)
+		return
+	}
+
+	response.Created(c, timeline)
+}
+
+// ListTimelines 获取时间线列表
+func (h *TimelineHandler) ListTimelines(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	var dramaID, episodeID *uint
+	if s := c.Query("drama_id"); s != "" {
+		if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+			uid := uint(id)
+			dramaID = &uid
+		}
+	}
+	if s := c.Query("episode_id"); s != "" {
+		if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+			uid := uint(id)
+			episodeID = &uid
+		}
+	}
+
+	timelines, err := h.timelineService.ListTimelines(userID, dramaID, episodeID)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, timelines)
+}
+
+// GetTimeline 获取时间线详情
+func (h *TimelineHandler) GetTimeline(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	timeline, err := h.timelineService.GetTimeline(userID, id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, timeline)
+}
+
+// UpdateTimeline 更新时间线基础信息
+func (h *TimelineHandler) UpdateTimeline(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req services.UpdateTimelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	timeline, err := h.timelineService.UpdateTimeline(userID, id, &req)
+	if err != nil {
+		h.log.Errorw("Failed to update timeline", "error", err)
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, timeline)
+}
+
+// DeleteTimeline 删除时间线
+func (h *TimelineHandler) DeleteTimeline(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.timelineService.DeleteTimeline(userID, id); err != nil {
+		h.log.Errorw("Failed to delete timeline", "error", err)
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// RenderTimeline 异步渲染时间线为MP4
+func (h *TimelineHandler) RenderTimeline(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	taskID, err := h.renderService.RenderTimeline(userID, id)
+	if err != nil {
+		h.log.Errorw("Failed to start timeline render", "error", err, "timeline_id", id)
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{
+		"task_id": taskID,
+		"status":  "pending",
+		"message": "时间线渲染任务已创建，正在后台处理",
+	})
+}
+
+// AddTrack 添加轨道
+func (h *TimelineHandler) AddTrack(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req services.CreateTrackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	track, err := h.timelineService.AddTrack(userID, id, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Created(c, track)
+}
+
+// UpdateTrack 更新轨道（锁定、静音、音量等）
+func (h *TimelineHandler) UpdateTrack(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	trackID, ok := parseIDParam(c, "track_id")
+	if !ok {
+		return
+	}
+
+	var req services.UpdateTrackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	track, err := h.timelineService.UpdateTrack(userID, trackID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, track)
+}
+
+// DeleteTrack 删除轨道
+func (h *TimelineHandler) DeleteTrack(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	trackID, ok := parseIDParam(c, "track_id")
+	if !ok {
+		return
+	}
+
+	if err := h.timelineService.DeleteTrack(userID, trackID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// AddClip 向轨道添加片段
+func (h *TimelineHandler) AddClip(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	trackID, ok := parseIDParam(c, "track_id")
+	if !ok {
+		return
+	}
+
+	var req services.CreateClipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	clip, err := h.timelineService.AddClip(userID, trackID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Created(c, clip)
+}
+
+// ReorderClips 重新排列轨道上的片段
+func (h *TimelineHandler) ReorderClips(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	trackID, ok := parseIDParam(c, "track_id")
+	if !ok {
+		return
+	}
+
+	var req services.ReorderClipsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	clips, err := h.timelineService.ReorderClips(userID, trackID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, clips)
+}
+
+// UpdateClip 更新片段（裁剪、变速、音量、淡入淡出）
+func (h *TimelineHandler) UpdateClip(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	clipID, ok := parseIDParam(c, "clip_id")
+	if !ok {
+		return
+	}
+
+	var req services.UpdateClipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	clip, err := h.timelineService.UpdateClip(userID, clipID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, clip)
+}
+
+// MoveClip 移动片段
+func (h *TimelineHandler) MoveClip(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	clipID, ok := parseIDParam(c, "clip_id")
+	if !ok {
+		return
+	}
+
+	var req services.MoveClipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	clip, err := h.timelineService.MoveClip(userID, clipID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, clip)
+}
+
+// DeleteClip 删除片段
+func (h *TimelineHandler) DeleteClip(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	clipID, ok := parseIDParam(c, "clip_id")
+	if !ok {
+		return
+	}
+
+	if err := h.timelineService.DeleteClip(userID, clipID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+// SetClipTransition 设置片段转场
+func (h *TimelineHandler) SetClipTransition(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	clipID, ok := parseIDParam(c, "clip_id")
+	if !ok {
+		return
+	}
+
+	var req services.SetClipTransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	transition, err := h.timelineService.SetClipTransition(userID, clipID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, transition)
+}
+
+// AddClipEffect 添加片段特效
+func (h *TimelineHandler) AddClipEffect(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	clipID, ok := parseIDParam(c, "clip_id")
+	if !ok {
+		return
+	}
+
+	var req services.ClipEffectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	effect, err := h.timelineService.AddClipEffect(userID, clipID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Created(c, effect)
+}
+
+// DeleteClipEffect 删除片段特效
+func (h *TimelineHandler) DeleteClipEffect(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	clipID, ok := parseIDParam(c, "clip_id")
+	if !ok {
+		return
+	}
+	effectID, ok := parseIDParam(c, "effect_id")
+	if !ok {
+		return
+	}
+
+	if err := h.timelineService.DeleteClipEffect(userID, clipID, effectID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"message": "删除成功"})
+}
+
+func (h *TimelineHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTimelineNotFound),
+		errors.Is(err, services.ErrTrackNotFound),
+		errors.Is(err, services.ErrClipNotFound),
+		errors.Is(err, services.ErrEpisodeNotFound):
+		response.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrTrackLocked):
+		response.Forbidden(c, "轨道已锁定")
+	default:
+		response.BadRequest(c, err.Error())
+	}
+}
+
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return 0, false
+	}
+	return uint(id), true
+}
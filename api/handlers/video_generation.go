@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"errors"
+	"net/http"
 	"strconv"
 
 	"github.com/drama-generator/backend/application/services"
@@ -9,6 +10,7 @@ import (
 	"github.com/drama-generator/backend/pkg/response"
 	"github.com/drama-generator/backend/pkg/tenant"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type VideoGenerationHandler struct {
@@ -122,6 +124,38 @@ func (h *VideoGenerationHandler) GetVideoGeneration(c *gin.Context) {
 	response.Success(c, videoGen)
 }
 
+// CancelVideoGeneration 取消排队或生成中的视频
+func (h *VideoGenerationHandler) CancelVideoGeneration(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	videoGenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "无效的ID")
+		return
+	}
+
+	videoGen, err := h.videoService.CancelVideoGeneration(userID, uint(videoGenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "视频生成记录不存在")
+			return
+		}
+		if errors.Is(err, services.ErrTaskNotCancellable) {
+			response.Error(c, http.StatusConflict, "TASK_NOT_CANCELLABLE", "任务已结束，无法取消")
+			return
+		}
+		h.log.Errorw("Failed to cancel video generation", "error", err, "id", videoGenID)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, videoGen)
+}
+
 func (h *VideoGenerationHandler) ListVideoGenerations(c *gin.Context) {
 	userID, err := tenant.GetUserID(c)
 	if err != nil {
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
 	"strconv"
 
 	services2 "github.com/drama-generator/backend/application/services"
 	"github.com/drama-generator/backend/pkg/logger"
 	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type VideoMergeHandler struct {
@@ -59,6 +63,36 @@ func (h *VideoMergeHandler) GetMerge(c *gin.Context) {
 	response.Success(c, gin.H{"merge": merge})
 }
 
+func (h *VideoMergeHandler) CancelMerge(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	mergeID, err := strconv.ParseUint(c.Param("merge_id"), 10, 32)
+	if err != nil {
+		response.BadRequest(c, "Invalid merge ID")
+		return
+	}
+
+	merge, err := h.mergeService.CancelMerge(userID, uint(mergeID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.NotFound(c, "Merge not found")
+			return
+		}
+		if errors.Is(err, services2.ErrTaskNotCancellable) {
+			response.Error(c, http.StatusConflict, "TASK_NOT_CANCELLABLE", "Merge already finished")
+			return
+		}
+		h.log.Errorw("Failed to cancel merge", "error", err)
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{"merge": merge})
+}
+
 func (h *VideoMergeHandler) ListMerges(c *gin.Context) {
 	episodeID := c.Query("episode_id")
 	status := c.Query("status")
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/drama-generator/backend/application/services"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/response"
+	"github.com/drama-generator/backend/pkg/tenant"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+	log            *logger.Logger
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService, log *logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		log:            log,
+	}
+}
+
+// CreateWebhook 注册 webhook，响应中的 secret 只返回这一次
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	var req services.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	webhook, secret, err := h.webhookService.CreateWebhook(userID, &req)
+	if err != nil {
+		h.log.Errorw("Failed to create webhook", "error", err, "user_id", userID)
+		h.writeError(c, err)
+		return
+	}
+
+	response.Created(c, gin.H{"webhook": webhook, "secret": secret})
+}
+
+// ListWebhooks 获取当前用户的 webhook 列表
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+
+	webhooks, err := h.webhookService.ListWebhooks(userID)
+	if err != nil {
+		response.InternalError(c, err.Error())
+		return
+	}
+
+	response.Success(c, webhooks)
+}
+
+// GetWebhook 获取 webhook 详情
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	webhookID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	webhook, err := h.webhookService.GetWebhook(userID, webhookID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, webhook)
+}
+
+// UpdateWebhook 更新地址、订阅事件或启用状态
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	webhookID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req services.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(userID, webhookID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, webhook)
+}
+
+// DeleteWebhook 删除 webhook
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	webhookID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(userID, webhookID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// RotateSecret 重新生成签名密钥
+func (h *WebhookHandler) RotateSecret(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	webhookID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	secret, err := h.webhookService.RotateSecret(userID, webhookID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"secret": secret})
+}
+
+// ListDeliveries 获取 webhook 的投递记录
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	webhookID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	deliveries, total, err := h.webhookService.ListDeliveries(userID, webhookID, page, pageSize)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.SuccessWithPagination(c, deliveries, total, page, pageSize)
+}
+
+// GetDelivery 获取单条投递记录
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	deliveryID, ok := parseIDParam(c, "delivery_id")
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.GetDelivery(userID, deliveryID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, delivery)
+}
+
+// ReplayDelivery 重新投递
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	userID, err := tenant.GetUserID(c)
+	if err != nil {
+		response.Unauthorized(c, "用户未登录")
+		return
+	}
+	deliveryID, ok := parseIDParam(c, "delivery_id")
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.ReplayDelivery(userID, deliveryID)
+	if err != nil {
+		h.log.Errorw("Failed to replay webhook delivery", "error", err, "delivery_id", deliveryID)
+		h.writeError(c, err)
+		return
+	}
+
+	response.Success(c, delivery)
+}
+
+func (h *WebhookHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound),
+		errors.Is(err, services.ErrWebhookDeliveryNotFound):
+		response.NotFound(c, err.Error())
+	case errors.Is(err, services.ErrInvalidWebhookURL),
+		errors.Is(err, services.ErrInvalidWebhookEvent):
+		response.BadRequest(c, err.Error())
+	default:
+		response.InternalError(c, err.Error())
+	}
+}
@@ -33,6 +33,12 @@ type appDependencies struct {
 	assetService               *services.AssetService
 	audioExtractionService     *services.AudioExtractionService
 	propService                *services.PropService
+	timelineService            *services.TimelineService
+	timelineRenderService      *services.TimelineRenderService
+	subtitleService            *services.SubtitleService
+	voiceOverService           *services.VoiceOverService
+	scoreService               *services.ScoreService
+	webhookService             *services.WebhookService
 	authHandler                *handlers.AuthHandler
 	adminAuthHandler           *handlers.AdminAuthHandler
 	adminUserHandler           *handlers.AdminUserHandler
@@ -40,9 +46,11 @@ type appDependencies struct {
 	billingPricingHandler      *handlers.BillingPricingHandler
 	billingTransactionsHandler *handlers.BillingTransactionsHandler
 	adminAIConfigHandler       *handlers.AdminAIConfigHandler
+	adminDeadJobHandler        *handlers.AdminDeadJobHandler
 	dramaHandler               *handlers.DramaHandler
 	scriptGenHandler           *handlers.ScriptGenerationHandler
 	imageGenHandler            *handlers.ImageGenerationHandler
+	imageVersionHandler        *handlers.ImageVersionHandler
 	videoGenHandler            *handlers.VideoGenerationHandler
 	videoMergeHandler          *handlers.VideoMergeHandler
 	assetHandler               *handlers.AssetHandler
@@ -55,6 +63,13 @@ type appDependencies struct {
 	audioExtractionHandler     *handlers.AudioExtractionHandler
 	settingsHandler            *handlers.SettingsHandler
 	propHandler                *handlers.PropHandler
+	timelineHandler            *handlers.TimelineHandler
+	subtitleHandler            *handlers.SubtitleHandler
+	voiceOverHandler           *handlers.VoiceOverHandler
+	scoreHandler               *handlers.ScoreHandler
+	webhookHandler             *handlers.WebhookHandler
+	promptTemplateHandler      *handlers.PromptTemplateHandler
+	adminPromptTemplateHandler *handlers.PromptTemplateHandler
 	shutdownHooks              []func(context.Context) error
 }
 
@@ -65,39 +80,63 @@ func buildAppDependencies(cfg *config.Config, db *gorm.DB, log *logger.Logger, l
 	}
 
 	var shutdownHooks []func(context.Context) error
-	var taskBus services.JobDispatcher
-	var rabbitBus *services.RabbitMQTaskBus
+	taskEvents := services.NewTaskEventHub()
+	var taskBus services.JobQueue
+	var deadLetters services.DeadLetterStore
+	consumerEnabled := true
+	retryPolicies := services.NewJobRetryPolicies(cfg.JobRetry)
 	if cfg.MQ.Enabled {
-		rabbitBus, err = services.NewRabbitMQTaskBus(cfg.MQ, log)
+		rabbitBus, err := services.NewRabbitMQTaskBus(cfg.MQ, retryPolicies, log)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create rabbitmq task bus: %w", err)
 		}
+		if err := rabbitBus.EnableTaskEventFanout(taskEvents); err != nil {
+			return nil, fmt.Errorf("failed to enable task event fanout: %w", err)
+		}
 		taskBus = rabbitBus
-		shutdownHooks = append(shutdownHooks, rabbitBus.Stop)
+		deadLetters = rabbitBus
+		consumerEnabled = cfg.MQ.ConsumerEnabled
+	} else {
+		// 未启用消息队列时任务持久化到数据库，重启后可继续执行
+		dbQueue := services.NewDBJobQueue(db, cfg.JobQueue, retryPolicies, log)
+		taskBus = dbQueue
+		deadLetters = dbQueue
 	}
+	shutdownHooks = append(shutdownHooks, taskBus.Stop)
 
-	aiService := services.NewAIService(db, log)
+	aiService := services.NewAIService(db, cfg, log)
 	transferService := services.NewResourceTransferService(db, log)
-	promptI18n := services.NewPromptI18n(cfg)
+	languageService, err := services.NewLanguageService(db, cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create language service: %w", err)
+	}
+	promptTemplateService := services.NewPromptTemplateService(db, log, languageService)
+	promptI18n := services.NewPromptI18n(cfg, promptTemplateService, languageService)
 	userRepo := persistence.NewGormUserRepository(db)
 	authService := services.NewAuthService(userRepo, cfg, log)
-	taskService := services.NewTaskService(db, log)
+	webhookService := services.NewWebhookService(db, taskBus, log)
+	taskService := services.NewTaskService(db, log, taskEvents, webhookService)
 	adminAuditService := services.NewAdminAuditService(db)
 	adminUserService := services.NewAdminUserService(db, log, adminAuditService)
 	adminBillingService := services.NewAdminBillingService(db, log, adminAuditService)
-	billingService := services.NewBillingService(db, cfg, log)
-	dramaService := services.NewDramaService(db, cfg, log)
-	characterLibraryService := services.NewCharacterLibraryService(db, log, cfg, taskBus)
-	imageGenService := services.NewImageGenerationService(db, cfg, transferService, localStoragePtr, taskBus, log)
+	billingService := services.NewBillingService(db, cfg, webhookService, log)
+	dramaService := services.NewDramaService(db, cfg, log, languageService)
+	characterLibraryService := services.NewCharacterLibraryService(db, log, cfg, aiService, taskService, taskBus, promptI18n)
+	imageGenService := services.NewImageGenerationService(db, cfg, transferService, localStoragePtr, aiService, taskService, taskBus, log, promptI18n)
 	sceneService := services.NewStoryboardCompositionService(db, log, imageGenService)
-	framePromptService := services.NewFramePromptService(db, cfg, log)
-	scriptGenerationService := services.NewScriptGenerationService(db, cfg, log)
-	storyboardService := services.NewStoryboardService(db, cfg, taskBus, log)
-	videoGenerationService := services.NewVideoGenerationService(db, cfg, transferService, localStoragePtr, aiService, taskBus, log, promptI18n)
-	videoMergeService := services.NewVideoMergeService(db, nil, cfg.Storage.LocalPath, cfg.Storage.BaseURL, log)
+	framePromptService := services.NewFramePromptService(db, cfg, aiService, taskService, log, promptI18n)
+	scriptGenerationService := services.NewScriptGenerationService(db, cfg, aiService, taskService, log, promptI18n)
+	storyboardService := services.NewStoryboardService(db, cfg, aiService, taskService, taskBus, log, promptI18n)
+	videoGenerationService := services.NewVideoGenerationService(db, cfg, transferService, localStoragePtr, aiService, taskService, taskBus, log, promptI18n)
+	videoMergeService := services.NewVideoMergeService(db, nil, aiService, taskService, cfg.Storage.LocalPath, cfg.Storage.BaseURL, log)
 	assetService := services.NewAssetService(db, log)
 	audioExtractionService := services.NewAudioExtractionService(log)
-	propService := services.NewPropService(db, aiService, taskService, imageGenService, log, cfg, taskBus)
+	propService := services.NewPropService(db, aiService, taskService, imageGenService, log, cfg, taskBus, promptI18n)
+	timelineService := services.NewTimelineService(db, log)
+	timelineRenderService := services.NewTimelineRenderService(db, cfg, taskService, taskBus, log)
+	subtitleService := services.NewSubtitleService(db, log)
+	voiceOverService := services.NewVoiceOverService(db, cfg, aiService, taskService, taskBus, log)
+	scoreService := services.NewScoreService(db, cfg, aiService, taskService, taskBus, log)
 	uploadService, err := services.NewUploadService(cfg, log)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create upload service: %w", err)
@@ -105,67 +144,96 @@ func buildAppDependencies(cfg *config.Config, db *gorm.DB, log *logger.Logger, l
 
 	uploadHandler := handlers.NewUploadHandler(uploadService, characterLibraryService, log)
 
-	if rabbitBus != nil {
-		rabbitBus.Register(services.JobTypeImageGeneration, func(ctx context.Context, job services.AsyncJob) error {
-			var payload services.ImageGenerationJobPayload
-			if err := json.Unmarshal(job.Payload, &payload); err != nil {
-				return fmt.Errorf("decode image generation payload: %w", err)
-			}
-			imageGenService.ProcessImageGeneration(payload.ImageGenerationID)
-			return nil
-		})
-		rabbitBus.Register(services.JobTypeVideoGeneration, func(ctx context.Context, job services.AsyncJob) error {
-			var payload services.VideoGenerationJobPayload
-			if err := json.Unmarshal(job.Payload, &payload); err != nil {
-				return fmt.Errorf("decode video generation payload: %w", err)
-			}
-			videoGenerationService.ProcessVideoGeneration(payload.VideoGenerationID)
-			return nil
-		})
-		rabbitBus.Register(services.JobTypeVideoPollStatus, func(ctx context.Context, job services.AsyncJob) error {
-			var payload services.VideoPollStatusJobPayload
-			if err := json.Unmarshal(job.Payload, &payload); err != nil {
-				return fmt.Errorf("decode video poll payload: %w", err)
-			}
-			videoGenerationService.ProcessVideoPollStatus(payload)
-			return nil
-		})
-		rabbitBus.Register(services.JobTypeStoryboard, func(ctx context.Context, job services.AsyncJob) error {
-			var payload services.StoryboardGenerationJobPayload
-			if err := json.Unmarshal(job.Payload, &payload); err != nil {
-				return fmt.Errorf("decode storyboard payload: %w", err)
-			}
-			storyboardService.ProcessStoryboardGeneration(payload.UserID, payload.TaskID, payload.EpisodeID, payload.Model, payload.ScriptContent, payload.CharacterList, payload.SceneList)
-			return nil
-		})
-		rabbitBus.Register(services.JobTypeCharacterExtraction, func(ctx context.Context, job services.AsyncJob) error {
-			var payload services.CharacterExtractionJobPayload
-			if err := json.Unmarshal(job.Payload, &payload); err != nil {
-				return fmt.Errorf("decode character extraction payload: %w", err)
-			}
-			var episode models.Episode
-			if err := db.Where("id = ? AND user_id = ?", payload.EpisodeID, payload.UserID).First(&episode).Error; err != nil {
-				return fmt.Errorf("load episode for character extraction: %w", err)
-			}
-			characterLibraryService.ProcessCharacterExtraction(payload.UserID, payload.TaskID, episode)
-			return nil
-		})
-		rabbitBus.Register(services.JobTypePropExtraction, func(ctx context.Context, job services.AsyncJob) error {
-			var payload services.PropExtractionJobPayload
-			if err := json.Unmarshal(job.Payload, &payload); err != nil {
-				return fmt.Errorf("decode prop extraction payload: %w", err)
-			}
-			var episode models.Episode
-			if err := db.Where("id = ? AND user_id = ?", payload.EpisodeID, payload.UserID).First(&episode).Error; err != nil {
-				return fmt.Errorf("load episode for prop extraction: %w", err)
-			}
-			propService.ProcessPropExtraction(payload.UserID, payload.TaskID, episode)
-			return nil
-		})
-		if cfg.MQ.ConsumerEnabled {
-			if err := rabbitBus.Start(); err != nil {
-				return nil, fmt.Errorf("failed to start rabbitmq consumer: %w", err)
-			}
+	taskBus.Register(services.JobTypeImageGeneration, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.ImageGenerationJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode image generation payload: %w", err)
+		}
+		return imageGenService.ProcessImageGeneration(ctx, payload.ImageGenerationID)
+	})
+	taskBus.Register(services.JobTypeImagePollStatus, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.ImagePollStatusJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode image poll payload: %w", err)
+		}
+		imageGenService.ProcessImagePollStatus(ctx, payload)
+		return nil
+	})
+	taskBus.Register(services.JobTypeVideoGeneration, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.VideoGenerationJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode video generation payload: %w", err)
+		}
+		return videoGenerationService.ProcessVideoGeneration(ctx, payload.VideoGenerationID)
+	})
+	taskBus.Register(services.JobTypeVideoPollStatus, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.VideoPollStatusJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode video poll payload: %w", err)
+		}
+		videoGenerationService.ProcessVideoPollStatus(ctx, payload)
+		return nil
+	})
+	taskBus.Register(services.JobTypeStoryboard, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.StoryboardGenerationJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode storyboard payload: %w", err)
+		}
+		return storyboardService.ProcessStoryboardGeneration(ctx, payload.UserID, payload.TaskID, payload.EpisodeID, payload.Model, payload.ScriptContent, payload.CharacterList, payload.SceneList)
+	})
+	taskBus.Register(services.JobTypeCharacterExtraction, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.CharacterExtractionJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode character extraction payload: %w", err)
+		}
+		var episode models.Episode
+		if err := db.Where("id = ? AND user_id = ?", payload.EpisodeID, payload.UserID).First(&episode).Error; err != nil {
+			return fmt.Errorf("load episode for character extraction: %w", err)
+		}
+		return characterLibraryService.ProcessCharacterExtraction(ctx, payload.UserID, payload.TaskID, episode)
+	})
+	taskBus.Register(services.JobTypePropExtraction, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.PropExtractionJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode prop extraction payload: %w", err)
+		}
+		var episode models.Episode
+		if err := db.Where("id = ? AND user_id = ?", payload.EpisodeID, payload.UserID).First(&episode).Error; err != nil {
+			return fmt.Errorf("load episode for prop extraction: %w", err)
+		}
+		return propService.ProcessPropExtraction(ctx, payload.UserID, payload.TaskID, episode)
+	})
+	taskBus.Register(services.JobTypeTimelineRender, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.TimelineRenderJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode timeline render payload: %w", err)
+		}
+		return timelineRenderService.ProcessTimelineRender(ctx, payload)
+	})
+	taskBus.Register(services.JobTypeVoiceOver, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.VoiceOverJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode voice-over payload: %w", err)
+		}
+		return voiceOverService.ProcessVoiceOver(ctx, payload)
+	})
+	taskBus.Register(services.JobTypeEpisodeScore, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.EpisodeScoreJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode episode score payload: %w", err)
+		}
+		return scoreService.ProcessEpisodeScore(ctx, payload)
+	})
+	taskBus.Register(services.JobTypeWebhookDelivery, func(ctx context.Context, job services.AsyncJob) error {
+		var payload services.WebhookDeliveryJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("decode webhook delivery payload: %w", err)
+		}
+		return webhookService.ProcessDelivery(ctx, payload.DeliveryID)
+	})
+	if consumerEnabled {
+		if err := taskBus.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start task consumer: %w", err)
 		}
 	}
 
@@ -187,6 +255,12 @@ func buildAppDependencies(cfg *config.Config, db *gorm.DB, log *logger.Logger, l
 		assetService:               assetService,
 		audioExtractionService:     audioExtractionService,
 		propService:                propService,
+		timelineService:            timelineService,
+		timelineRenderService:      timelineRenderService,
+		subtitleService:            subtitleService,
+		voiceOverService:           voiceOverService,
+		scoreService:               scoreService,
+		webhookService:             webhookService,
 		authHandler:                handlers.NewAuthHandler(authService, log),
 		adminAuthHandler:           handlers.NewAdminAuthHandler(authService, log),
 		adminUserHandler:           handlers.NewAdminUserHandler(adminUserService, log),
@@ -194,21 +268,30 @@ func buildAppDependencies(cfg *config.Config, db *gorm.DB, log *logger.Logger, l
 		billingPricingHandler:      handlers.NewBillingPricingHandler(aiService, log),
 		billingTransactionsHandler: handlers.NewBillingTransactionsHandler(billingService, log),
 		adminAIConfigHandler:       handlers.NewAdminAIConfigHandler(aiService, log),
+		adminDeadJobHandler:        handlers.NewAdminDeadJobHandler(deadLetters, adminAuditService, log),
 		dramaHandler:               handlers.NewDramaHandler(db, dramaService, videoMergeService, log),
 		scriptGenHandler:           handlers.NewScriptGenerationHandler(scriptGenerationService, taskService, log),
 		imageGenHandler:            handlers.NewImageGenerationHandler(db, cfg, log, imageGenService, taskService),
+		imageVersionHandler:        handlers.NewImageVersionHandler(services.NewImageVersionService(db, log), log),
 		videoGenHandler:            handlers.NewVideoGenerationHandler(videoGenerationService, log),
 		videoMergeHandler:          handlers.NewVideoMergeHandler(videoMergeService, log),
 		assetHandler:               handlers.NewAssetHandler(assetService, log),
 		characterLibraryHandler:    handlers.NewCharacterLibraryHandler(characterLibraryService, imageGenService, log),
 		uploadHandler:              uploadHandler,
-		storyboardHandler:          handlers.NewStoryboardHandler(storyboardService, taskService, log),
+		storyboardHandler:          handlers.NewStoryboardHandler(storyboardService, taskService, services.NewStoryboardReferenceResolver(db, cfg, log), log),
 		sceneHandler:               handlers.NewSceneHandler(sceneService, log),
 		taskHandler:                handlers.NewTaskHandler(taskService, log),
 		framePromptHandler:         handlers.NewFramePromptHandler(framePromptService, log),
 		audioExtractionHandler:     handlers.NewAudioExtractionHandler(audioExtractionService, log, cfg.Storage.LocalPath),
-		settingsHandler:            handlers.NewSettingsHandler(cfg, log),
+		settingsHandler:            handlers.NewSettingsHandler(languageService, log),
 		propHandler:                handlers.NewPropHandler(propService, log),
+		timelineHandler:            handlers.NewTimelineHandler(timelineService, timelineRenderService, log),
+		subtitleHandler:            handlers.NewSubtitleHandler(subtitleService, log),
+		voiceOverHandler:           handlers.NewVoiceOverHandler(voiceOverService, log),
+		scoreHandler:               handlers.NewScoreHandler(scoreService, log),
+		webhookHandler:             handlers.NewWebhookHandler(webhookService, log),
+		promptTemplateHandler:      handlers.NewPromptTemplateHandler(promptTemplateService, log),
+		adminPromptTemplateHandler: handlers.NewAdminPromptTemplateHandler(promptTemplateService, adminAuditService, log),
 		shutdownHooks:              shutdownHooks,
 	}, nil
 }
@@ -91,6 +91,27 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 				adminAI.DELETE("/:id", deps.adminAIConfigHandler.DeleteConfig)
 				adminAI.POST("/test", deps.adminAIConfigHandler.TestConnection)
 			}
+
+			adminJobs := adminSecured.Group("/dead-jobs")
+			{
+				adminJobs.GET("", deps.adminDeadJobHandler.ListDeadJobs)
+				adminJobs.GET("/:id", deps.adminDeadJobHandler.GetDeadJob)
+				adminJobs.POST("/:id/replay", deps.adminDeadJobHandler.ReplayDeadJob)
+			}
+
+			adminSecured.PUT("/settings/language", deps.settingsHandler.UpdateDefaultLanguage)
+
+			adminPrompts := adminSecured.Group("/prompt-templates")
+			{
+				adminPrompts.GET("", deps.adminPromptTemplateHandler.ListTemplates)
+				adminPrompts.POST("", deps.adminPromptTemplateHandler.CreateTemplate)
+				adminPrompts.GET("/keys", deps.adminPromptTemplateHandler.ListKeys)
+				adminPrompts.POST("/preview", deps.adminPromptTemplateHandler.PreviewTemplate)
+				adminPrompts.GET("/:id", deps.adminPromptTemplateHandler.GetTemplate)
+				adminPrompts.POST("/:id/activate", deps.adminPromptTemplateHandler.ActivateTemplate)
+				adminPrompts.POST("/:id/deactivate", deps.adminPromptTemplateHandler.DeactivateTemplate)
+				adminPrompts.DELETE("/:id", deps.adminPromptTemplateHandler.DeleteTemplate)
+			}
 		}
 
 		dramas := secured.Group("/dramas")
@@ -113,6 +134,7 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 		generation := secured.Group("/generation")
 		{
 			generation.POST("/characters", deps.scriptGenHandler.GenerateCharacters)
+			generation.GET("/script/skills", deps.scriptGenHandler.ListPolishSkills)
 			generation.POST("/script/polish", deps.scriptGenHandler.PolishScriptText)
 			generation.POST("/script/polish/stream", deps.scriptGenHandler.PolishScriptTextStream)
 		}
@@ -164,12 +186,42 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			episodes.GET("/:episode_id/storyboards", deps.sceneHandler.GetStoryboardsForEpisode)
 			episodes.POST("/:episode_id/finalize", deps.dramaHandler.FinalizeEpisode)
 			episodes.GET("/:episode_id/download", deps.dramaHandler.DownloadEpisodeVideo)
+			episodes.GET("/:episode_id/subtitles", deps.subtitleHandler.DownloadEpisodeSubtitles)
+			episodes.POST("/:episode_id/voiceover", deps.voiceOverHandler.GenerateEpisodeVoiceOver)
+			episodes.POST("/:episode_id/score", deps.scoreHandler.GenerateEpisodeScore)
+			episodes.POST("/:episode_id/timeline", deps.timelineHandler.CreateTimelineFromEpisode)
+		}
+
+		// 时间线编辑路由
+		timelines := secured.Group("/timelines")
+		{
+			timelines.GET("", deps.timelineHandler.ListTimelines)
+			timelines.POST("", deps.timelineHandler.CreateTimeline)
+			timelines.GET("/:id", deps.timelineHandler.GetTimeline)
+			timelines.PUT("/:id", deps.timelineHandler.UpdateTimeline)
+			timelines.DELETE("/:id", deps.timelineHandler.DeleteTimeline)
+			timelines.POST("/:id/tracks", deps.timelineHandler.AddTrack)
+			timelines.POST("/:id/render", deps.timelineHandler.RenderTimeline)
+
+			timelines.PUT("/tracks/:track_id", deps.timelineHandler.UpdateTrack)
+			timelines.DELETE("/tracks/:track_id", deps.timelineHandler.DeleteTrack)
+			timelines.POST("/tracks/:track_id/clips", deps.timelineHandler.AddClip)
+			timelines.PUT("/tracks/:track_id/clips/order", deps.timelineHandler.ReorderClips)
+
+			timelines.PUT("/clips/:clip_id", deps.timelineHandler.UpdateClip)
+			timelines.PUT("/clips/:clip_id/move", deps.timelineHandler.MoveClip)
+			timelines.DELETE("/clips/:clip_id", deps.timelineHandler.DeleteClip)
+			timelines.PUT("/clips/:clip_id/transition", deps.timelineHandler.SetClipTransition)
+			timelines.POST("/clips/:clip_id/effects", deps.timelineHandler.AddClipEffect)
+			timelines.DELETE("/clips/:clip_id/effects/:effect_id", deps.timelineHandler.DeleteClipEffect)
 		}
 
 		// 任务路由
 		tasks := secured.Group("/tasks")
 		{
+			tasks.GET("/stream", deps.taskHandler.StreamTasks)
 			tasks.GET("/:task_id", deps.taskHandler.GetTaskStatus)
+			tasks.POST("/:task_id/cancel", deps.taskHandler.CancelTask)
 			tasks.GET("", deps.taskHandler.GetResourceTasks)
 		}
 
@@ -190,6 +242,13 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			images.POST("", deps.imageGenHandler.GenerateImage)
 			images.GET("/:id", deps.imageGenHandler.GetImageGeneration)
 			images.DELETE("/:id", deps.imageGenHandler.DeleteImageGeneration)
+			images.POST("/:id/cancel", deps.imageGenHandler.CancelImageGeneration)
+			images.POST("/:id/edit", deps.imageGenHandler.EditImage)
+			images.POST("/:id/outpaint", deps.imageGenHandler.OutpaintImage)
+			images.POST("/:id/variations", deps.imageGenHandler.CreateVariations)
+			images.GET("/history/:entity_type/:entity_id", deps.imageVersionHandler.ListVersions)
+			images.POST("/history/:entity_type/:entity_id/revert", deps.imageVersionHandler.RevertVersion)
+			images.GET("/history/:entity_type/:entity_id/compare", deps.imageVersionHandler.CompareVersions)
 			images.POST("/scene/:scene_id", deps.imageGenHandler.GenerateImagesForScene)
 			images.POST("/upload", deps.imageGenHandler.UploadImage)
 			images.GET("/episode/:episode_id/backgrounds", deps.imageGenHandler.GetBackgroundsForEpisode)
@@ -203,6 +262,7 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			videos.POST("", deps.videoGenHandler.GenerateVideo)
 			videos.GET("/:id", deps.videoGenHandler.GetVideoGeneration)
 			videos.DELETE("/:id", deps.videoGenHandler.DeleteVideoGeneration)
+			videos.POST("/:id/cancel", deps.videoGenHandler.CancelVideoGeneration)
 			videos.POST("/image/:image_gen_id", deps.videoGenHandler.GenerateVideoFromImage)
 			videos.POST("/episode/:episode_id/batch", deps.videoGenHandler.BatchGenerateForEpisode)
 		}
@@ -213,6 +273,7 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			videoMerges.POST("", deps.videoMergeHandler.MergeVideos)
 			videoMerges.GET("/:merge_id", deps.videoMergeHandler.GetMerge)
 			videoMerges.DELETE("/:merge_id", deps.videoMergeHandler.DeleteMerge)
+			videoMerges.POST("/:merge_id/cancel", deps.videoMergeHandler.CancelMerge)
 		}
 
 		assets := secured.Group("/assets")
@@ -236,6 +297,7 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			storyboards.POST("/:id/frame-prompt", deps.framePromptHandler.GenerateFramePrompt)
 			storyboards.GET("/:id/frame-prompts", handlers.GetStoryboardFramePrompts(db, log))
 			storyboards.POST("/:id/optimize-video-prompt", deps.storyboardHandler.OptimizeVideoPrompt)
+			storyboards.GET("/:id/references", deps.storyboardHandler.GetReferences)
 		}
 
 		audio := secured.Group("/audio")
@@ -249,6 +311,33 @@ func SetupRouter(cfg *config.Config, db *gorm.DB, log *logger.Logger, localStora
 			settings.GET("/language", deps.settingsHandler.GetLanguage)
 			settings.PUT("/language", deps.settingsHandler.UpdateLanguage)
 		}
+
+		// webhook 路由
+		webhooks := secured.Group("/webhooks")
+		{
+			webhooks.GET("", deps.webhookHandler.ListWebhooks)
+			webhooks.POST("", deps.webhookHandler.CreateWebhook)
+			webhooks.GET("/:id", deps.webhookHandler.GetWebhook)
+			webhooks.PUT("/:id", deps.webhookHandler.UpdateWebhook)
+			webhooks.DELETE("/:id", deps.webhookHandler.DeleteWebhook)
+			webhooks.POST("/:id/rotate-secret", deps.webhookHandler.RotateSecret)
+			webhooks.GET("/:id/deliveries", deps.webhookHandler.ListDeliveries)
+			webhooks.GET("/deliveries/:delivery_id", deps.webhookHandler.GetDelivery)
+			webhooks.POST("/deliveries/:delivery_id/replay", deps.webhookHandler.ReplayDelivery)
+		}
+
+		// 提示词模板：用户级与剧级覆盖
+		promptTemplates := secured.Group("/prompt-templates")
+		{
+			promptTemplates.GET("", deps.promptTemplateHandler.ListTemplates)
+			promptTemplates.POST("", deps.promptTemplateHandler.CreateTemplate)
+			promptTemplates.GET("/keys", deps.promptTemplateHandler.ListKeys)
+			promptTemplates.POST("/preview", deps.promptTemplateHandler.PreviewTemplate)
+			promptTemplates.GET("/:id", deps.promptTemplateHandler.GetTemplate)
+			promptTemplates.POST("/:id/activate", deps.promptTemplateHandler.ActivateTemplate)
+			promptTemplates.POST("/:id/deactivate", deps.promptTemplateHandler.DeactivateTemplate)
+			promptTemplates.DELETE("/:id", deps.promptTemplateHandler.DeleteTemplate)
+		}
 	}
 
 	// 前端静态文件服务（放在API路由之后，避免冲突）
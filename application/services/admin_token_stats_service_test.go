@@ -70,7 +70,7 @@ func TestAdminTokenStatsService_AggregatesByModel(t *testing.T) {
 
 func TestBillingService_RecordAIUsageUpdatesMatchingReferenceOnly(t *testing.T) {
 	db := newAdminServiceTestDB(t)
-	billing := NewBillingService(db, &config.Config{}, logger.NewLogger(true))
+	billing := NewBillingService(db, &config.Config{}, nil, logger.NewLogger(true))
 
 	serviceType := "text"
 	model := "doubao-1.8"
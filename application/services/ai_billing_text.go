@@ -31,11 +31,45 @@ func reserveTextClient(aiService *AIService, billing *BillingService, userID uin
 	return client, actualModel, refID, nil
 }
 
-func recordTextUsage(billing *BillingService, refID string, client ai.AIClient) {
-	if billing == nil || refID == "" || client == nil {
+// recordTextUsage used 是这一次调用自己的用量（通过 usage.Meter 或 StructuredRequest.OnResponse 获得），
+// 不能用 client.GetLastUsage()，同一客户端被并发调用时后者会被其它调用覆盖。只累计用量，结算见 settleTextBilling
+func recordTextUsage(billing *BillingService, refID string, used usage.TokenUsage) {
+	if billing == nil || refID == "" {
 		return
 	}
-	_ = billing.RecordAIUsage(refID, client.GetLastUsage())
+	_ = billing.RecordAIUsage(refID, used)
+}
+
+// settleTextBilling 预扣下的全部调用结束后结算一次，clients 为共用该预扣的各个客户端（如分镜的各个分段）。
+// 每个客户端按实际提供服务的配置分摊价格，命中缓存的不计费，全部命中缓存时按缓存命中结算
+func settleTextBilling(billing *BillingService, refID string, clients ...ai.AIClient) {
+	if billing == nil || refID == "" || len(clients) == 0 {
+		return
+	}
+	parts := make([]AIServedPart, 0, len(clients))
+	for _, client := range clients {
+		parts = append(parts, servedPart(client))
+	}
+	if err := billing.SettleAIParts(refID, parts); err != nil && billing.log != nil {
+		billing.log.Warnw("Failed to settle AI text billing", "error", err, "billing_ref_id", refID)
+	}
+}
+
+// servedPart 客户端全部命中缓存或最近一次实际提供服务的配置，无法得知时按预扣价格计
+func servedPart(client ai.AIClient) AIServedPart {
+	if ai.ServedFromCache(client) {
+		return AIServedPart{Cached: true}
+	}
+	var inner interface{} = client
+	if cached, ok := client.(*ai.CachedClient); ok {
+		inner = cached.Unwrap()
+	}
+	if reporter, ok := inner.(servedConfigReporter); ok {
+		if served := reporter.ServedConfig(); served != nil {
+			return AIServedPart{ConfigID: served.ID, Cost: served.CreditCost}
+		}
+	}
+	return AIServedPart{}
 }
 
 func hasTokenUsage(tokenUsage usage.TokenUsage) bool {
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultAIResponseCacheTTL = 72 * time.Hour
+
+// aiResponseCacheTTL 文本响应缓存有效期，0 表示未开启
+func aiResponseCacheTTL(cfg config.AICacheConfig) time.Duration {
+	if !cfg.Enabled {
+		return 0
+	}
+	ttl := time.Duration(cfg.TTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = defaultAIResponseCacheTTL
+	}
+	return ttl
+}
+
+// aiResponseCacheScope 缓存只在同一用户、同一首选配置的调用间复用，避免跨租户或跨配置返回他人的输出
+func aiResponseCacheScope(userID uint, configID uint) string {
+	return fmt.Sprintf("user:%d/config:%d", userID, configID)
+}
+
+// dbResponseCache 基于数据库的 ai.ResponseCache，过期记录在读取时删除
+type dbResponseCache struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func newDBResponseCache(db *gorm.DB) *dbResponseCache {
+	return &dbResponseCache{db: db, now: time.Now}
+}
+
+func (c *dbResponseCache) Get(ctx context.Context, key string) (string, bool, error) {
+	var entry models.AIResponseCache
+	if err := c.db.WithContext(ctx).Where("cache_key = ?", key).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if !entry.ExpiresAt.After(c.now()) {
+		return "", false, c.Delete(ctx, key)
+	}
+	return entry.Response, true, nil
+}
+
+func (c *dbResponseCache) Set(ctx context.Context, key string, text string, ttl time.Duration) error {
+	entry := models.AIResponseCache{
+		CacheKey:  key,
+		Response:  text,
+		ExpiresAt: c.now().Add(ttl),
+	}
+	return c.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"response", "expires_at"}),
+	}).Create(&entry).Error
+}
+
+func (c *dbResponseCache) Delete(ctx context.Context, key string) error {
+	return c.db.WithContext(ctx).Where("cache_key = ?", key).Delete(&models.AIResponseCache{}).Error
+}
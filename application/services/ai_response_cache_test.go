@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func TestAIService_CachesOptInTextCalls(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.AIResponseCache{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	svc := NewAIService(db, &config.Config{AI: config.AIConfig{Cache: config.AICacheConfig{Enabled: true}}}, logger.NewLogger(true))
+
+	var hits int32
+	server := newChatServer(t, http.StatusOK, `{"name":"林清"}`, &hits)
+	seedRoutingConfig(t, db, "primary", server.URL, 1, 0)
+
+	generate := func(userID uint, options ...func(*ai.ChatCompletionRequest)) ai.AIClient {
+		client, err := svc.GetAIClientForModelWithUser("text", "gpt-routing", userID)
+		if err != nil {
+			t.Fatalf("failed to get client: %v", err)
+		}
+		if _, err := client.GenerateTextContext(context.Background(), "extract", "system", options...); err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+		return client
+	}
+
+	generate(1, ai.WithResponseCache())
+	client := generate(1, ai.WithResponseCache())
+	if hits != 1 {
+		t.Fatalf("expected second call to be served from cache, got %d upstream calls", hits)
+	}
+	if !ai.ServedFromCache(client) || client.GetLastUsage().TotalTokens != 0 {
+		t.Fatalf("expected cached call without token usage")
+	}
+
+	generate(1)
+	if hits != 2 {
+		t.Fatalf("expected calls without opt-in to bypass the cache, got %d upstream calls", hits)
+	}
+
+	generate(2, ai.WithResponseCache())
+	if hits != 3 {
+		t.Fatalf("expected another user's call not to reuse the cached response, got %d upstream calls", hits)
+	}
+}
+
+func TestSettleTextBilling_CacheHitOnlyWhenEveryClientCached(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.AIResponseCache{}, &models.User{}, &models.CreditTransaction{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	log := logger.NewLogger(true)
+	cfg := &config.Config{AI: config.AIConfig{Cache: config.AICacheConfig{Enabled: true}}}
+	svc := NewAIService(db, cfg, log)
+	billing := NewBillingService(db, cfg, nil, log)
+
+	var hits int32
+	server := newChatServer(t, http.StatusOK, `{"name":"林清"}`, &hits)
+	seedRoutingConfig(t, db, "primary", server.URL, 1, 10)
+	user := models.User{Email: "segments@example.com", PasswordHash: "x", Credits: 30}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	generate := func(prompt string) ai.AIClient {
+		client, err := svc.GetAIClientForModelWithUser("text", "gpt-routing", user.ID)
+		if err != nil {
+			t.Fatalf("failed to get client: %v", err)
+		}
+		if _, err := client.GenerateTextContext(context.Background(), prompt, "system", ai.WithResponseCache()); err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+		return client
+	}
+	credits := func() int {
+		var reloaded models.User
+		db.First(&reloaded, user.ID)
+		return reloaded.Credits
+	}
+
+	// 两个分段共用一笔预扣：一段命中缓存、一段实际调用模型，只退回命中缓存那一段的份额
+	refID, err := billing.ReserveAI(user.ID, "text", "gpt-routing", 10, "storyboard_generation:1")
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	generate("segment 1")
+	cachedSegment := generate("segment 1")
+	freshSegment := generate("segment 2")
+	settleTextBilling(billing, refID, cachedSegment, freshSegment)
+	if got := credits(); got != 25 {
+		t.Fatalf("expected partly cached storyboard to pay the uncached share, got %d credits", got)
+	}
+
+	cachedRef, err := billing.ReserveAI(user.ID, "text", "gpt-routing", 10, "storyboard_generation:2")
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	settleTextBilling(billing, cachedRef, generate("segment 2"))
+	var txn models.CreditTransaction
+	db.Where("reference_id = ?", cachedRef).First(&txn)
+	if got := credits(); got != 25 || txn.Amount != 0 || !txn.CacheHit {
+		t.Fatalf("expected fully cached call to be free, got %d credits and %+v", got, txn)
+	}
+}
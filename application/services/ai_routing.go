@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+const (
+	defaultAIRoutingFailureThreshold = 3
+	defaultAIRoutingCooldown         = 30 * time.Second
+)
+
+// aiRouteRegistry 记录各 AI 配置的熔断与加权轮询状态，由 AIService 持有，按配置 ID 在其创建的所有路由客户端间共享
+type aiRouteRegistry struct {
+	mu               sync.Mutex
+	loadBalance      bool
+	failureThreshold int
+	cooldown         time.Duration
+	circuits         map[uint]*aiConfigCircuit
+	currentWeights   map[uint]int
+	timeouts         map[string]time.Duration // 创建后只读
+	now              func() time.Time
+}
+
+// aiConfigCircuit 连续失败达到阈值后熔断，熔断到期后放行一次探测请求，探测失败则重新熔断
+type aiConfigCircuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+func newAIRouteRegistry(cfg config.AIRoutingConfig, timeouts config.AITimeoutConfig) *aiRouteRegistry {
+	r := &aiRouteRegistry{
+		circuits:       make(map[uint]*aiConfigCircuit),
+		currentWeights: make(map[uint]int),
+		timeouts: map[string]time.Duration{
+			"text":  time.Duration(timeouts.TextSeconds) * time.Second,
+			"image": time.Duration(timeouts.ImageSeconds) * time.Second,
+			"video": time.Duration(timeouts.VideoSeconds) * time.Second,
+		},
+		now: time.Now,
+	}
+	r.configure(cfg)
+	return r
+}
+
+// callTimeout 服务类型的单次调用超时，未配置时返回 0
+func (r *aiRouteRegistry) callTimeout(serviceType string) time.Duration {
+	return r.timeouts[serviceType]
+}
+
+func (r *aiRouteRegistry) configure(cfg config.AIRoutingConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.loadBalance = cfg.LoadBalance
+	r.failureThreshold = cfg.FailureThreshold
+	if r.failureThreshold <= 0 {
+		r.failureThreshold = defaultAIRoutingFailureThreshold
+	}
+	r.cooldown = time.Duration(cfg.CooldownSeconds) * time.Second
+	if r.cooldown <= 0 {
+		r.cooldown = defaultAIRoutingCooldown
+	}
+}
+
+// order 返回本次调用尝试配置的顺序：按 configs 原有的优先级分层，开启负载均衡时同层内按权重轮询选出首选配置
+func (r *aiRouteRegistry) order(configs []models.AIServiceConfig) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order := make([]int, 0, len(configs))
+	for start := 0; start < len(configs); {
+		end := start + 1
+		for end < len(configs) && sameRouteTier(configs[start], configs[end]) {
+			end++
+		}
+
+		tier := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			tier = append(tier, i)
+		}
+		if r.loadBalance && len(tier) > 1 {
+			picked := r.pickWeighted(configs, tier)
+			tier = append([]int{tier[picked]}, append(tier[:picked:picked], tier[picked+1:]...)...)
+		}
+		order = append(order, tier...)
+		start = end
+	}
+	return order
+}
+
+// pickWeighted 平滑加权轮询，返回被选中配置在 tier 中的下标
+func (r *aiRouteRegistry) pickWeighted(configs []models.AIServiceConfig, tier []int) int {
+	total := 0
+	best := 0
+	for i, idx := range tier {
+		id := configs[idx].ID
+		weight := aiRouteWeight(configs[idx])
+		total += weight
+		r.currentWeights[id] += weight
+		if r.currentWeights[id] > r.currentWeights[configs[tier[best]].ID] {
+			best = i
+		}
+	}
+	r.currentWeights[configs[tier[best]].ID] -= total
+	return best
+}
+
+// acquire 配置是否可以接收请求，熔断到期时占用探测名额，其他请求在探测结束前继续跳过该配置
+func (r *aiRouteRegistry) acquire(configID uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	circuit := r.circuits[configID]
+	if circuit == nil || circuit.failures < r.failureThreshold {
+		return true
+	}
+	now := r.now()
+	if now.Before(circuit.openUntil) {
+		return false
+	}
+	circuit.openUntil = now.Add(r.cooldown)
+	return true
+}
+
+func (r *aiRouteRegistry) recordSuccess(configID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.circuits, configID)
+}
+
+// recordFailure 记录一次失败，返回是否因此进入熔断
+func (r *aiRouteRegistry) recordFailure(configID uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	circuit := r.circuits[configID]
+	if circuit == nil {
+		circuit = &aiConfigCircuit{}
+		r.circuits[configID] = circuit
+	}
+	circuit.failures++
+	if circuit.failures < r.failureThreshold {
+		return false
+	}
+	circuit.openUntil = r.now().Add(r.cooldown)
+	return true
+}
+
+func sameRouteTier(a, b models.AIServiceConfig) bool {
+	return a.UserID == b.UserID && a.Priority == b.Priority
+}
+
+// aiRouteWeight 读取配置 settings 中的 weight，缺省为 1
+func aiRouteWeight(cfg models.AIServiceConfig) int {
+	if cfg.Settings == "" {
+		return 1
+	}
+	var settings struct {
+		Weight int `json:"weight"`
+	}
+	if err := json.Unmarshal([]byte(cfg.Settings), &settings); err != nil || settings.Weight <= 0 {
+		return 1
+	}
+	return settings.Weight
+}
+
+// noFailoverError 包装不应再切换配置的错误，例如流式输出已经有内容返回给调用方
+type noFailoverError struct {
+	err error
+}
+
+func (e *noFailoverError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noFailoverError) Unwrap() error {
+	return e.err
+}
+
+// shouldFailover 超时、限流、连接错误与服务商 5xx 时切换到下一个配置，请求本身有误时切换无意义
+func shouldFailover(err error) bool {
+	var stop *noFailoverError
+	if errors.As(err, &stop) {
+		return false
+	}
+	return IsRetryableJobError(err)
+}
+
+// aiRoute 一个候选配置及其客户端
+type aiRoute[C any] struct {
+	Config models.AIServiceConfig
+	Client C
+}
+
+// aiRouter 在候选配置间故障转移，并记录最近一次实际提供服务的配置
+type aiRouter[C any] struct {
+	serviceType string
+	routes      []aiRoute[C]
+	registry    *aiRouteRegistry
+	log         *logger.Logger
+
+	mu     sync.Mutex
+	served int
+}
+
+func newAIRouter[C any](serviceType string, routes []aiRoute[C], registry *aiRouteRegistry, log *logger.Logger) *aiRouter[C] {
+	return &aiRouter[C]{serviceType: serviceType, routes: routes, registry: registry, log: log, served: -1}
+}
+
+// call 依次在候选配置上执行 fn，直到成功或遇到不可切换的错误
+// 所有配置都处于熔断中时仍尝试优先级最高的一个，避免熔断期间请求全部直接失败
+// ctx 被取消后不再切换配置，也不计入熔断
+func (r *aiRouter[C]) call(ctx context.Context, fn func(context.Context, C) error) error {
+	if len(r.routes) == 0 {
+		return errors.New("no AI config available")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var lastErr error
+	attempted := false
+	for _, idx := range r.registry.order(r.configs()) {
+		route := r.routes[idx]
+		if !r.registry.acquire(route.Config.ID) {
+			continue
+		}
+		attempted = true
+		done, err := r.attempt(ctx, idx, fn)
+		if done {
+			return err
+		}
+		lastErr = err
+	}
+	if !attempted {
+		_, err := r.attempt(ctx, 0, fn)
+		return err
+	}
+	return lastErr
+}
+
+// attempt 在单个配置上执行 fn，done 为 false 表示应切换到下一个配置
+func (r *aiRouter[C]) attempt(ctx context.Context, idx int, fn func(context.Context, C) error) (bool, error) {
+	route := r.routes[idx]
+	callCtx := ctx
+	timeout := r.registry.callTimeout(r.serviceType)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := fn(callCtx, route.Client)
+	if err != nil && ctx.Err() != nil {
+		// 调用方已取消，与服务商健康状况无关
+		return true, err
+	}
+	if err != nil && callCtx.Err() == context.DeadlineExceeded && !errors.Is(err, context.DeadlineExceeded) {
+		// 部分客户端不会保留 ctx 错误，补上以便按超时切换配置
+		err = fmt.Errorf("AI call exceeded %s timeout: %w: %w", timeout, context.DeadlineExceeded, err)
+	}
+	if err == nil || !shouldFailover(err) {
+		// 服务商正常响应（包括请求本身有误）即视为健康
+		r.registry.recordSuccess(route.Config.ID)
+		r.setServed(idx)
+		var stop *noFailoverError
+		if errors.As(err, &stop) {
+			err = stop.err
+		}
+		return true, err
+	}
+
+	opened := r.registry.recordFailure(route.Config.ID)
+	if r.log != nil {
+		r.log.Warnw("AI config call failed, trying next config",
+			"config_id", route.Config.ID,
+			"provider", route.Config.Provider,
+			"circuit_open", opened,
+			"error", err)
+	}
+	return false, err
+}
+
+func (r *aiRouter[C]) configs() []models.AIServiceConfig {
+	configs := make([]models.AIServiceConfig, len(r.routes))
+	for i, route := range r.routes {
+		configs[i] = route.Config
+	}
+	return configs
+}
+
+func (r *aiRouter[C]) setServed(idx int) {
+	r.mu.Lock()
+	r.served = idx
+	r.mu.Unlock()
+}
+
+// ServedConfig 最近一次实际提供服务的配置，CreditCost 为该配置对应的计费积分；尚未成功调用时返回 nil
+func (r *aiRouter[C]) ServedConfig() *models.AIServiceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.served < 0 {
+		return nil
+	}
+	config := r.routes[r.served].Config
+	return &config
+}
+
+// servedClient 最近一次提供服务的客户端，尚未调用时返回优先级最高的客户端
+func (r *aiRouter[C]) servedClient() C {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.served < 0 {
+		return r.routes[0].Client
+	}
+	return r.routes[r.served].Client
+}
+
+// servedConfigReporter 由路由客户端实现，用于将计费结算到实际提供服务的配置
+type servedConfigReporter interface {
+	ServedConfig() *models.AIServiceConfig
+}
+
+// settleServedConfig 将预扣记录关联到实际提供服务的配置，故障转移到不同定价的配置时按实际配置结算
+func settleServedConfig(billing *BillingService, refID string, client interface{}) {
+	if billing == nil || refID == "" {
+		return
+	}
+	if cached, ok := client.(*ai.CachedClient); ok {
+		client = cached.Unwrap()
+	}
+	reporter, ok := client.(servedConfigReporter)
+	if !ok {
+		return
+	}
+	served := reporter.ServedConfig()
+	if served == nil {
+		return
+	}
+	if err := billing.SettleAIConfig(refID, served.ID, served.CreditCost); err != nil && billing.log != nil {
+		billing.log.Warnw("Failed to settle AI billing to served config", "error", err, "billing_ref_id", refID, "config_id", served.ID)
+	}
+}
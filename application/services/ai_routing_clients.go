@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/usage"
+	"github.com/drama-generator/backend/pkg/video"
+)
+
+// RoutingAIClient 在同一模型的多个文本配置间按优先级故障转移
+type RoutingAIClient struct {
+	*aiRouter[ai.AIClient]
+}
+
+func newRoutingAIClient(serviceType string, routes []aiRoute[ai.AIClient], registry *aiRouteRegistry, log *logger.Logger) *RoutingAIClient {
+	return &RoutingAIClient{aiRouter: newAIRouter(serviceType, routes, registry, log)}
+}
+
+func (c *RoutingAIClient) GenerateText(prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextContext(context.Background(), prompt, systemPrompt, options...)
+}
+
+func (c *RoutingAIClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	var text string
+	err := c.call(ctx, func(ctx context.Context, client ai.AIClient) error {
+		var err error
+		text, err = client.GenerateTextContext(ctx, prompt, systemPrompt, options...)
+		return err
+	})
+	return text, err
+}
+
+func (c *RoutingAIClient) GenerateTextStream(prompt string, systemPrompt string, callback ai.StreamCallback, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextStreamContext(context.Background(), prompt, systemPrompt, callback, options...)
+}
+
+// GenerateTextStreamContext 已经向 callback 输出内容后不再切换配置，避免调用方收到重复内容
+func (c *RoutingAIClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback ai.StreamCallback, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	var text string
+	err := c.call(ctx, func(ctx context.Context, client ai.AIClient) error {
+		streamed := false
+		wrapped := func(chunk string, totalChars int, estimatedProgress float64) {
+			streamed = true
+			if callback != nil {
+				callback(chunk, totalChars, estimatedProgress)
+			}
+		}
+		var err error
+		text, err = client.GenerateTextStreamContext(ctx, prompt, systemPrompt, wrapped, options...)
+		if err != nil && streamed {
+			return &noFailoverError{err: err}
+		}
+		return err
+	})
+	return text, err
+}
+
+func (c *RoutingAIClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return c.GenerateImageContext(context.Background(), prompt, size, n)
+}
+
+func (c *RoutingAIClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	var urls []string
+	err := c.call(ctx, func(ctx context.Context, client ai.AIClient) error {
+		var err error
+		urls, err = client.GenerateImageContext(ctx, prompt, size, n)
+		return err
+	})
+	return urls, err
+}
+
+func (c *RoutingAIClient) TestConnection() error {
+	return c.TestConnectionContext(context.Background())
+}
+
+func (c *RoutingAIClient) TestConnectionContext(ctx context.Context) error {
+	return c.call(ctx, func(ctx context.Context, client ai.AIClient) error {
+		return client.TestConnectionContext(ctx)
+	})
+}
+
+func (c *RoutingAIClient) GetLastUsage() usage.TokenUsage {
+	return c.servedClient().GetLastUsage()
+}
+
+// RoutingImageClient 图片生成的多配置路由，异步任务的状态查询固定使用提交任务的配置
+type RoutingImageClient struct {
+	*aiRouter[image.ImageClient]
+}
+
+func newRoutingImageClient(routes []aiRoute[image.ImageClient], registry *aiRouteRegistry, log *logger.Logger) *RoutingImageClient {
+	return &RoutingImageClient{aiRouter: newAIRouter("image", routes, registry, log)}
+}
+
+func (c *RoutingImageClient) GenerateImage(prompt string, opts ...image.ImageOption) (*image.ImageResult, error) {
+	return c.GenerateImageContext(context.Background(), prompt, opts...)
+}
+
+func (c *RoutingImageClient) GenerateImageContext(ctx context.Context, prompt string, opts ...image.ImageOption) (*image.ImageResult, error) {
+	var result *image.ImageResult
+	err := c.call(ctx, func(ctx context.Context, client image.ImageClient) error {
+		var err error
+		result, err = client.GenerateImageContext(ctx, prompt, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (c *RoutingImageClient) GetTaskStatus(taskID string) (*image.ImageResult, error) {
+	return c.servedClient().GetTaskStatus(taskID)
+}
+
+func (c *RoutingImageClient) GetTaskStatusContext(ctx context.Context, taskID string) (*image.ImageResult, error) {
+	return c.servedClient().GetTaskStatusContext(ctx, taskID)
+}
+
+func (c *RoutingImageClient) GetLastUsage() usage.TokenUsage {
+	return c.servedClient().GetLastUsage()
+}
+
+// EditImageContext 不支持编辑的配置返回 image.ErrEditNotSupported，不会切换到下一个配置
+func (c *RoutingImageClient) EditImageContext(ctx context.Context, req *image.EditRequest, opts ...image.ImageOption) (*image.ImageResult, error) {
+	var result *image.ImageResult
+	err := c.call(ctx, func(ctx context.Context, client image.ImageClient) error {
+		editor, ok := client.(image.ImageEditor)
+		if !ok {
+			return image.ErrEditNotSupported
+		}
+		var err error
+		result, err = editor.EditImageContext(ctx, req, opts...)
+		return err
+	})
+	return result, err
+}
+
+// ReferenceCapabilities 以首选配置的客户端为准，故障转移到不支持参考图的配置时参考图会被忽略
+func (c *RoutingImageClient) ReferenceCapabilities() image.ReferenceCapabilities {
+	if capable, ok := c.servedClient().(image.ReferenceCapable); ok {
+		return capable.ReferenceCapabilities()
+	}
+	return image.ReferenceCapabilities{}
+}
+
+// RoutingVideoClient 视频生成的多配置路由，异步任务的状态查询固定使用提交任务的配置
+type RoutingVideoClient struct {
+	*aiRouter[video.VideoClient]
+}
+
+func newRoutingVideoClient(routes []aiRoute[video.VideoClient], registry *aiRouteRegistry, log *logger.Logger) *RoutingVideoClient {
+	return &RoutingVideoClient{aiRouter: newAIRouter("video", routes, registry, log)}
+}
+
+func (c *RoutingVideoClient) GenerateVideo(imageURL, prompt string, opts ...video.VideoOption) (*video.VideoResult, error) {
+	return c.GenerateVideoContext(context.Background(), imageURL, prompt, opts...)
+}
+
+func (c *RoutingVideoClient) GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...video.VideoOption) (*video.VideoResult, error) {
+	var result *video.VideoResult
+	err := c.call(ctx, func(ctx context.Context, client video.VideoClient) error {
+		var err error
+		result, err = client.GenerateVideoContext(ctx, imageURL, prompt, opts...)
+		return err
+	})
+	return result, err
+}
+
+func (c *RoutingVideoClient) GetTaskStatus(taskID string) (*video.VideoResult, error) {
+	return c.servedClient().GetTaskStatus(taskID)
+}
+
+func (c *RoutingVideoClient) GetTaskStatusContext(ctx context.Context, taskID string) (*video.VideoResult, error) {
+	return c.servedClient().GetTaskStatusContext(ctx, taskID)
+}
+
+func (c *RoutingVideoClient) GetLastUsage() usage.TokenUsage {
+	return c.servedClient().GetLastUsage()
+}
+
+// ReferenceCapabilities 以首选配置的客户端为准
+func (c *RoutingVideoClient) ReferenceCapabilities() video.ReferenceCapabilities {
+	if capable, ok := c.servedClient().(video.ReferenceCapable); ok {
+		return capable.ReferenceCapabilities()
+	}
+	return video.ReferenceCapabilities{}
+}
+
+// ServedClient 最近一次提交任务的客户端，用于判断服务商是否支持取消任务
+func (c *RoutingVideoClient) ServedClient() video.VideoClient {
+	return c.servedClient()
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newAIRoutingTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite", DSN: dsn}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AIServiceConfig{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+func newChatServer(t *testing.T, status int, content string, hits *int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte("upstream unavailable"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`, content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func seedRoutingConfig(t *testing.T, db *gorm.DB, name, baseURL string, priority, creditCost int) models.AIServiceConfig {
+	t.Helper()
+
+	cfg := models.AIServiceConfig{
+		ServiceType: "text",
+		Provider:    "openai",
+		Name:        name,
+		BaseURL:     baseURL,
+		APIKey:      "secret",
+		Model:       models.ModelField{"gpt-routing"},
+		CreditCost:  creditCost,
+		Priority:    priority,
+		IsActive:    true,
+	}
+	if err := db.Create(&cfg).Error; err != nil {
+		t.Fatalf("failed to seed config: %v", err)
+	}
+	return cfg
+}
+
+func TestRoutingAIClient_FailsOverToNextConfigOnServerError(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	svc := NewAIService(db, &config.Config{}, logger.NewLogger(true))
+
+	var primaryHits, backupHits int32
+	primary := newChatServer(t, http.StatusBadGateway, "", &primaryHits)
+	backup := newChatServer(t, http.StatusOK, "from backup", &backupHits)
+	seedRoutingConfig(t, db, "primary", primary.URL, 10, 4)
+	backupCfg := seedRoutingConfig(t, db, "backup", backup.URL, 1, 6)
+
+	client, err := svc.GetAIClientForModelWithUser("text", "gpt-routing", 1)
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	text, err := client.GenerateText("hello", "")
+	if err != nil {
+		t.Fatalf("expected failover to succeed, got %v", err)
+	}
+	if text != "from backup" {
+		t.Fatalf("expected backup response, got %q", text)
+	}
+	if primaryHits != 1 || backupHits != 1 {
+		t.Fatalf("expected one call per config, got primary=%d backup=%d", primaryHits, backupHits)
+	}
+
+	served := client.(servedConfigReporter).ServedConfig()
+	if served == nil || served.ID != backupCfg.ID || served.CreditCost != 6 {
+		t.Fatalf("expected backup config to be reported as served, got %+v", served)
+	}
+	if client.GetLastUsage().TotalTokens != 8 {
+		t.Fatalf("expected usage of the served config, got %+v", client.GetLastUsage())
+	}
+}
+
+func TestRoutingAIClient_DoesNotFailOverOnClientError(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	svc := NewAIService(db, &config.Config{}, logger.NewLogger(true))
+
+	var primaryHits, backupHits int32
+	primary := newChatServer(t, http.StatusBadRequest, "", &primaryHits)
+	backup := newChatServer(t, http.StatusOK, "from backup", &backupHits)
+	seedRoutingConfig(t, db, "primary", primary.URL, 10, 0)
+	seedRoutingConfig(t, db, "backup", backup.URL, 1, 0)
+
+	client, err := svc.GetAIClientForModelWithUser("text", "gpt-routing", 1)
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	if _, err := client.GenerateText("hello", ""); err == nil {
+		t.Fatal("expected client error to be returned")
+	}
+	if backupHits != 0 {
+		t.Fatalf("expected no failover on 400, backup was called %d times", backupHits)
+	}
+}
+
+func TestRoutingAIClient_SkipsConfigWithOpenCircuit(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	svc := NewAIService(db, &config.Config{AI: config.AIConfig{Routing: config.AIRoutingConfig{FailureThreshold: 2, CooldownSeconds: 60}}}, logger.NewLogger(true))
+	registry := svc.routes
+
+	var primaryHits, backupHits int32
+	primary := newChatServer(t, http.StatusServiceUnavailable, "", &primaryHits)
+	backup := newChatServer(t, http.StatusOK, "from backup", &backupHits)
+	seedRoutingConfig(t, db, "primary", primary.URL, 10, 0)
+	seedRoutingConfig(t, db, "backup", backup.URL, 1, 0)
+
+	for i := 0; i < 3; i++ {
+		client, err := svc.GetAIClientForModelWithUser("text", "gpt-routing", 1)
+		if err != nil {
+			t.Fatalf("failed to get client: %v", err)
+		}
+		if _, err := client.GenerateText("hello", ""); err != nil {
+			t.Fatalf("call %d: expected success, got %v", i, err)
+		}
+	}
+	if primaryHits != 2 {
+		t.Fatalf("expected primary to be skipped once its circuit opened, got %d calls", primaryHits)
+	}
+
+	// 熔断到期后放行一次探测请求
+	registry.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	client, _ := svc.GetAIClientForModelWithUser("text", "gpt-routing", 1)
+	if _, err := client.GenerateText("hello", ""); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if primaryHits != 3 {
+		t.Fatalf("expected a probe request after cooldown, got %d calls", primaryHits)
+	}
+}
+
+func TestAIRouteRegistry_WeightedRoundRobinWithinTier(t *testing.T) {
+	registry := newAIRouteRegistry(config.AIRoutingConfig{LoadBalance: true}, config.AITimeoutConfig{})
+	configs := []models.AIServiceConfig{
+		{ID: 1, Priority: 10, Settings: `{"weight": 2}`},
+		{ID: 2, Priority: 10},
+		{ID: 3, Priority: 1},
+	}
+
+	var firsts []uint
+	for i := 0; i < 3; i++ {
+		order := registry.order(configs)
+		if len(order) != 3 || order[2] != 2 {
+			t.Fatalf("expected lower priority config to stay last, got %v", order)
+		}
+		firsts = append(firsts, configs[order[0]].ID)
+	}
+	if fmt.Sprint(firsts) != "[1 2 1]" {
+		t.Fatalf("expected weighted rotation [1 2 1], got %v", firsts)
+	}
+}
+
+func TestRoutingAIClient_DoesNotFailOverWhenCallerCancels(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	svc := NewAIService(db, &config.Config{AI: config.AIConfig{Routing: config.AIRoutingConfig{FailureThreshold: 1}}}, logger.NewLogger(true))
+	registry := svc.routes
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var backupHits int32
+	release := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(primary.Close)
+	t.Cleanup(func() { close(release) })
+	backup := newChatServer(t, http.StatusOK, "from backup", &backupHits)
+	primaryCfg := seedRoutingConfig(t, db, "primary", primary.URL, 10, 0)
+	seedRoutingConfig(t, db, "backup", backup.URL, 1, 0)
+
+	client, err := svc.GetAIClientForModelWithUser("text", "gpt-routing", 1)
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	if _, err := client.GenerateTextContext(ctx, "hello", ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if backupHits != 0 {
+		t.Fatalf("expected no failover after cancellation, backup was called %d times", backupHits)
+	}
+	if !registry.acquire(primaryCfg.ID) || registry.circuits[primaryCfg.ID] != nil {
+		t.Fatalf("expected cancellation not to count as a config failure")
+	}
+}
+
+func TestRoutingAIClient_FailsOverWhenCallTimesOut(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	svc := NewAIService(db, &config.Config{AI: config.AIConfig{Timeouts: config.AITimeoutConfig{TextSeconds: 1}}}, logger.NewLogger(true))
+
+	release := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(primary.Close)
+	t.Cleanup(func() { close(release) })
+	var backupHits int32
+	backup := newChatServer(t, http.StatusOK, "from backup", &backupHits)
+	seedRoutingConfig(t, db, "primary", primary.URL, 10, 0)
+	seedRoutingConfig(t, db, "backup", backup.URL, 1, 0)
+
+	client, err := svc.GetAIClientForModelWithUser("text", "gpt-routing", 1)
+	if err != nil {
+		t.Fatalf("failed to get client: %v", err)
+	}
+	text, err := client.GenerateTextContext(context.Background(), "hello", "")
+	if err != nil || text != "from backup" {
+		t.Fatalf("expected timed-out config to fail over, got %q, %v", text, err)
+	}
+}
@@ -1,33 +1,42 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
 	"gorm.io/gorm"
 )
 
 type AIService struct {
-	db  *gorm.DB
-	log *logger.Logger
+	db     *gorm.DB
+	log    *logger.Logger
+	routes *aiRouteRegistry
+	// cacheTTL 文本响应缓存有效期，0 表示未开启
+	cacheTTL time.Duration
 }
 
-func NewAIService(db *gorm.DB, log *logger.Logger) *AIService {
+func NewAIService(db *gorm.DB, cfg *config.Config, log *logger.Logger) *AIService {
 	return &AIService{
-		db:  db,
-		log: log,
+		db:       db,
+		log:      log,
+		routes:   newAIRouteRegistry(cfg.AI.Routing, cfg.AI.Timeouts),
+		cacheTTL: aiResponseCacheTTL(cfg.AI.Cache),
 	}
 }
 
 type CreateAIConfigRequest struct {
-	ServiceType   string            `json:"service_type" binding:"required,oneof=text image video"`
+	ServiceType   string            `json:"service_type" binding:"required,oneof=text image video audio music"`
 	Name          string            `json:"name" binding:"required,min=1,max=100"`
 	Provider      string            `json:"provider" binding:"required"`
 	BaseURL       string            `json:"base_url" binding:"required,url"`
-	APIKey        string            `json:"api_key" binding:"required"`
+	APIKey        string            `json:"api_key"` // 除 ollama 外必填，见 validateAPIKey
 	Model         models.ModelField `json:"model" binding:"required"`
 	CreditCost    int               `json:"credit_cost"`
 	Endpoint      string            `json:"endpoint"`
@@ -54,12 +63,23 @@ type UpdateAIConfigRequest struct {
 
 type TestConnectionRequest struct {
 	BaseURL  string            `json:"base_url" binding:"required,url"`
-	APIKey   string            `json:"api_key" binding:"required"`
+	APIKey   string            `json:"api_key"` // 除 ollama 外必填，见 validateAPIKey
 	Model    models.ModelField `json:"model" binding:"required"`
 	Provider string            `json:"provider"`
 	Endpoint string            `json:"endpoint"`
 }
 
+// ErrAPIKeyRequired 非本地服务商的配置缺少 API Key
+var ErrAPIKeyRequired = errors.New("api_key is required")
+
+// validateAPIKey 本地 Ollama 不需要鉴权，其余服务商必须提供 API Key
+func validateAPIKey(provider, apiKey string) error {
+	if provider != "ollama" && strings.TrimSpace(apiKey) == "" {
+		return ErrAPIKeyRequired
+	}
+	return nil
+}
+
 func (s *AIService) CreateConfig(req *CreateAIConfigRequest, userIDs ...uint) (*models.AIServiceConfig, error) {
 	userID := uint(0)
 	if len(userIDs) > 0 {
@@ -71,6 +91,9 @@ func (s *AIService) CreateConfig(req *CreateAIConfigRequest, userIDs ...uint) (*
 	if req.CreditCost < 0 {
 		return nil, errors.New("credit_cost must be >= 0")
 	}
+	if err := validateAPIKey(req.Provider, req.APIKey); err != nil {
+		return nil, err
+	}
 	// 根据 provider 和 service_type 自动设置 endpoint
 	endpoint := req.Endpoint
 	queryEndpoint := req.QueryEndpoint
@@ -93,6 +116,16 @@ func (s *AIService) CreateConfig(req *CreateAIConfigRequest, userIDs ...uint) (*
 				if queryEndpoint == "" {
 					queryEndpoint = "/videos/{taskId}"
 				}
+			} else if req.ServiceType == "audio" {
+				endpoint = "/audio/speech"
+			}
+		case "anthropic":
+			if req.ServiceType == "text" {
+				endpoint = "/v1/messages"
+			}
+		case "ollama":
+			if req.ServiceType == "text" {
+				endpoint = "/api/chat"
 			}
 		case "chatfire":
 			if req.ServiceType == "text" {
@@ -116,26 +149,39 @@ func (s *AIService) CreateConfig(req *CreateAIConfigRequest, userIDs ...uint) (*
 					queryEndpoint = "/generations/tasks/{taskId}"
 				}
 			}
+		case "elevenlabs":
+			if req.ServiceType == "music" {
+				endpoint = "/v1/music"
+			}
 		default:
-			// 默认使用 OpenAI 格式
+			// 默认使用 OpenAI 格式，配乐目前只接入 ElevenLabs
 			if req.ServiceType == "text" {
 				endpoint = "/chat/completions"
 			} else if req.ServiceType == "image" {
 				endpoint = "/images/generations"
+			} else if req.ServiceType == "audio" {
+				endpoint = "/audio/speech"
+			} else if req.ServiceType == "music" {
+				endpoint = "/v1/music"
 			}
 		}
 	}
 
 	config := &models.AIServiceConfig{
-		UserID:        userID,
-		ServiceType:   req.ServiceType,
-		Name:          req.Name,
-		Provider:      req.Provider,
-		BaseURL:       req.BaseURL,
-		APIKey:        req.APIKey,
-		Model:         req.Model,
+		UserID:      userID,
+		ServiceType: req.ServiceType,
+		Name:        req.Name,
+		Provider:    req.Provider,
+		BaseURL:     req.BaseURL,
+		APIKey:      req.APIKey,
+		Model:       req.Model,
 		// Pricing is platform-defined. User configs can change provider/key/model, but not per-call pricing.
-		CreditCost:    func() int { if userID == 0 { return req.CreditCost }; return 0 }(),
+		CreditCost: func() int {
+			if userID == 0 {
+				return req.CreditCost
+			}
+			return 0
+		}(),
 		Endpoint:      endpoint,
 		QueryEndpoint: queryEndpoint,
 		Priority:      req.Priority,
@@ -283,6 +329,16 @@ func (s *AIService) UpdatePlatformConfig(configID uint, req *UpdateAIConfigReque
 			} else if serviceType == "video" {
 				updates["endpoint"] = "/videos"
 				updates["query_endpoint"] = "/videos/{taskId}"
+			} else if serviceType == "audio" {
+				updates["endpoint"] = "/audio/speech"
+			}
+		case "anthropic":
+			if serviceType == "text" {
+				updates["endpoint"] = "/v1/messages"
+			}
+		case "ollama":
+			if serviceType == "text" {
+				updates["endpoint"] = "/api/chat"
 			}
 		case "chatfire":
 			if serviceType == "text" {
@@ -302,6 +358,10 @@ func (s *AIService) UpdatePlatformConfig(configID uint, req *UpdateAIConfigReque
 				updates["endpoint"] = "/contents/generations/tasks"
 				updates["query_endpoint"] = "/generations/tasks/{taskId}"
 			}
+		case "elevenlabs":
+			if serviceType == "music" {
+				updates["endpoint"] = "/v1/music"
+			}
 		}
 	} else if req.Endpoint != "" {
 		updates["endpoint"] = req.Endpoint
@@ -417,6 +477,16 @@ func (s *AIService) UpdateConfig(configID uint, req *UpdateAIConfigRequest, user
 			} else if serviceType == "video" {
 				updates["endpoint"] = "/videos"
 				updates["query_endpoint"] = "/videos/{taskId}"
+			} else if serviceType == "audio" {
+				updates["endpoint"] = "/audio/speech"
+			}
+		case "anthropic":
+			if serviceType == "text" {
+				updates["endpoint"] = "/v1/messages"
+			}
+		case "ollama":
+			if serviceType == "text" {
+				updates["endpoint"] = "/api/chat"
 			}
 		case "chatfire":
 			if serviceType == "text" {
@@ -436,6 +506,10 @@ func (s *AIService) UpdateConfig(configID uint, req *UpdateAIConfigRequest, user
 				updates["endpoint"] = "/contents/generations/tasks"
 				updates["query_endpoint"] = "/generations/tasks/{taskId}"
 			}
+		case "elevenlabs":
+			if serviceType == "music" {
+				updates["endpoint"] = "/v1/music"
+			}
 		}
 	} else if req.Endpoint != "" {
 		updates["endpoint"] = req.Endpoint
@@ -496,8 +570,11 @@ func (s *AIService) DeleteConfig(configID uint, userIDs ...uint) error {
 	return nil
 }
 
-func (s *AIService) TestConnection(req *TestConnectionRequest) error {
+func (s *AIService) TestConnection(ctx context.Context, req *TestConnectionRequest) error {
 	s.log.Infow("TestConnection called", "baseURL", req.BaseURL, "provider", req.Provider, "endpoint", req.Endpoint, "modelCount", len(req.Model))
+	if err := validateAPIKey(req.Provider, req.APIKey); err != nil {
+		return err
+	}
 
 	// 使用第一个模型进行测试
 	model := ""
@@ -516,6 +593,21 @@ func (s *AIService) TestConnection(req *TestConnectionRequest) error {
 		s.log.Infow("Using Gemini client", "baseURL", req.BaseURL)
 		endpoint = "/v1beta/models/{model}:generateContent"
 		client = ai.NewGeminiClient(req.BaseURL, req.APIKey, model, endpoint)
+	case "anthropic":
+		s.log.Infow("Using Anthropic client", "baseURL", req.BaseURL)
+		endpoint = req.Endpoint
+		if endpoint == "" {
+			endpoint = "/v1/messages"
+		}
+		client = ai.NewAnthropicClient(req.BaseURL, req.APIKey, model, endpoint)
+	case "ollama":
+		// 本地模型只检查服务可达且模型已拉取
+		s.log.Infow("Using Ollama client", "baseURL", req.BaseURL)
+		endpoint = req.Endpoint
+		if endpoint == "" {
+			endpoint = "/api/chat"
+		}
+		client = ai.NewOllamaClient(req.BaseURL, req.APIKey, model, endpoint)
 	case "openai", "chatfire", "volcengine", "volces", "doubao":
 		// OpenAI 格式（包括 chatfire、火山引擎等）
 		s.log.Infow("Using OpenAI-compatible client", "baseURL", req.BaseURL, "provider", req.Provider)
@@ -535,7 +627,7 @@ func (s *AIService) TestConnection(req *TestConnectionRequest) error {
 	}
 
 	s.log.Infow("Calling TestConnection on client", "endpoint", endpoint)
-	err := client.TestConnection()
+	err := client.TestConnectionContext(ctx)
 	if err != nil {
 		s.log.Errorw("TestConnection failed", "error", err)
 	} else {
@@ -577,6 +669,15 @@ func (s *AIService) GetDefaultConfig(serviceType string, userIDs ...uint) (*mode
 
 // GetConfigForModel 根据服务类型和模型名称获取优先级最高的激活配置
 func (s *AIService) GetConfigForModel(serviceType string, modelName string, userIDs ...uint) (*models.AIServiceConfig, error) {
+	configs, err := s.GetConfigsForModel(serviceType, modelName, userIDs...)
+	if err != nil {
+		return nil, err
+	}
+	return &configs[0], nil
+}
+
+// GetConfigsForModel 获取包含指定模型的全部激活配置，用户配置在前，其余按优先级降序
+func (s *AIService) GetConfigsForModel(serviceType string, modelName string, userIDs ...uint) ([]models.AIServiceConfig, error) {
 	var configs []models.AIServiceConfig
 	userID := uint(0)
 	if len(userIDs) > 0 {
@@ -595,66 +696,30 @@ func (s *AIService) GetConfigForModel(serviceType string, modelName string, user
 	}
 
 	// 查找包含指定模型的配置
+	var matched []models.AIServiceConfig
 	for _, config := range configs {
 		for _, model := range config.Model {
 			if model == modelName {
-				return &config, nil
+				matched = append(matched, config)
+				break
 			}
 		}
 	}
+	if len(matched) == 0 {
+		return nil, errors.New("no active config found for model: " + modelName)
+	}
 
-	return nil, errors.New("no active config found for model: " + modelName)
+	return matched, nil
 }
 
 // GetBillingConfig resolves which AIServiceConfig will be used for a request, and returns the effective model name.
 // If modelName is empty, the default config's first model is used.
 func (s *AIService) GetBillingConfig(serviceType string, modelName string, userID uint) (*models.AIServiceConfig, string, error) {
-	getPositivePlatformPricing := func() (*models.AIServiceConfig, error) {
-		var cfg models.AIServiceConfig
-		if err := s.db.
-			Where("service_type = ? AND user_id = ? AND is_active = ? AND credit_cost > 0", serviceType, 0, true).
-			Order("priority DESC, created_at DESC").
-			First(&cfg).Error; err != nil {
-			return nil, err
-		}
-		return &cfg, nil
-	}
-
-	// Pricing is always platform-defined. User-owned configs can define auth/base_url/etc, but not prices.
-	applyPlatformPricing := func(userCfg *models.AIServiceConfig, model string) (*models.AIServiceConfig, error) {
-		// Prefer exact per-model platform pricing when available.
-		if model != "" {
-			if pcfg, perr := s.GetConfigForModel(serviceType, model); perr == nil {
-				c := *userCfg
-				if pcfg.CreditCost > 0 {
-					c.CreditCost = pcfg.CreditCost
-					return &c, nil
-				}
-			}
-		}
-
-		// Fallback to any active positive platform pricing for this service type.
-		if ppos, perr := getPositivePlatformPricing(); perr == nil {
-			c := *userCfg
-			c.CreditCost = ppos.CreditCost
-			return &c, nil
-		}
-
-		// Fallback to platform default pricing for the service type.
-		pdef, derr := s.GetDefaultConfig(serviceType /* platform */)
-		if derr != nil {
-			return nil, derr
-		}
-		c := *userCfg
-		c.CreditCost = pdef.CreditCost
-		return &c, nil
-	}
-
 	if modelName != "" {
 		cfg, err := s.GetConfigForModel(serviceType, modelName, userID)
 		if err == nil {
 			if cfg.UserID != 0 {
-				pcfg, perr := applyPlatformPricing(cfg, modelName)
+				pcfg, perr := s.applyPlatformPricing(serviceType, cfg, modelName)
 				if perr != nil {
 					return nil, "", perr
 				}
@@ -673,7 +738,7 @@ func (s *AIService) GetBillingConfig(serviceType string, modelName string, userI
 		actual = cfg.Model[0]
 	}
 	if cfg.UserID != 0 {
-		pcfg, perr := applyPlatformPricing(cfg, actual)
+		pcfg, perr := s.applyPlatformPricing(serviceType, cfg, actual)
 		if perr != nil {
 			return nil, "", perr
 		}
@@ -684,7 +749,7 @@ func (s *AIService) GetBillingConfig(serviceType string, modelName string, userI
 	}
 
 	if cfg.CreditCost <= 0 {
-		if ppos, perr := getPositivePlatformPricing(); perr == nil {
+		if ppos, perr := s.getPositivePlatformPricing(serviceType); perr == nil {
 			c := *cfg
 			c.CreditCost = ppos.CreditCost
 			cfg = &c
@@ -696,52 +761,99 @@ func (s *AIService) GetBillingConfig(serviceType string, modelName string, userI
 	return cfg, actual, nil
 }
 
-func (s *AIService) GetAIClient(serviceType string) (ai.AIClient, error) {
-	config, err := s.GetDefaultConfig(serviceType)
-	if err != nil {
+func (s *AIService) getPositivePlatformPricing(serviceType string) (*models.AIServiceConfig, error) {
+	var cfg models.AIServiceConfig
+	if err := s.db.
+		Where("service_type = ? AND user_id = ? AND is_active = ? AND credit_cost > 0", serviceType, 0, true).
+		Order("priority DESC, created_at DESC").
+		First(&cfg).Error; err != nil {
 		return nil, err
 	}
+	return &cfg, nil
+}
 
-	// 使用第一个模型
-	model := ""
-	if len(config.Model) > 0 {
-		model = config.Model[0]
+// applyPlatformPricing Pricing is always platform-defined. User-owned configs can define auth/base_url/etc, but not prices.
+func (s *AIService) applyPlatformPricing(serviceType string, userCfg *models.AIServiceConfig, model string) (*models.AIServiceConfig, error) {
+	// Prefer exact per-model platform pricing when available.
+	if model != "" {
+		if pcfg, perr := s.GetConfigForModel(serviceType, model); perr == nil {
+			c := *userCfg
+			if pcfg.CreditCost > 0 {
+				c.CreditCost = pcfg.CreditCost
+				return &c, nil
+			}
+		}
 	}
 
-	// 使用数据库配置中的 endpoint，如果为空则根据 provider 设置默认值
-	endpoint := config.Endpoint
-	if endpoint == "" {
-		switch config.Provider {
-		case "gemini", "google":
-			endpoint = "/v1beta/models/{model}:generateContent"
-		default:
-			endpoint = "/chat/completions"
-		}
+	// Fallback to any active positive platform pricing for this service type.
+	if ppos, perr := s.getPositivePlatformPricing(serviceType); perr == nil {
+		c := *userCfg
+		c.CreditCost = ppos.CreditCost
+		return &c, nil
 	}
 
-	// 根据 provider 创建对应的客户端
-	switch config.Provider {
-	case "gemini", "google":
-		return ai.NewGeminiClient(config.BaseURL, config.APIKey, model, endpoint), nil
-	default:
-		// openai, chatfire 等其他厂商都使用 OpenAI 格式
-		return ai.NewOpenAIClient(config.BaseURL, config.APIKey, model, endpoint), nil
+	// Fallback to platform default pricing for the service type.
+	pdef, derr := s.GetDefaultConfig(serviceType /* platform */)
+	if derr != nil {
+		return nil, derr
 	}
+	c := *userCfg
+	c.CreditCost = pdef.CreditCost
+	return &c, nil
 }
 
-// GetAIClientForModel 根据服务类型和模型名称获取对应的AI客户端
-func (s *AIService) GetAIClientForModel(serviceType string, modelName string) (ai.AIClient, error) {
-	config, err := s.GetConfigForModel(serviceType, modelName)
-	if err != nil {
-		return nil, err
+// creditCostForConfig returns the credits charged when cfg serves the call.
+// Non-positive results mean the config has no price of its own; billing then keeps the reserved amount.
+func (s *AIService) creditCostForConfig(serviceType string, cfg models.AIServiceConfig, model string) int {
+	if cfg.UserID != 0 {
+		pcfg, err := s.applyPlatformPricing(serviceType, &cfg, model)
+		if err != nil {
+			return 0
+		}
+		return pcfg.CreditCost
+	}
+	return cfg.CreditCost
+}
+
+// routingConfigs 返回可以服务该模型的候选配置，CreditCost 已换算为该配置实际提供服务时的计费积分
+// 模型为空或没有配置包含该模型时使用默认配置
+func (s *AIService) routingConfigs(serviceType string, modelName string, userID uint) ([]models.AIServiceConfig, string, error) {
+	var configs []models.AIServiceConfig
+	if modelName != "" {
+		configs, _ = s.GetConfigsForModel(serviceType, modelName, userID)
+	}
+	if len(configs) == 0 {
+		config, err := s.GetDefaultConfig(serviceType, userID)
+		if err != nil {
+			return nil, "", err
+		}
+		if modelName == "" && len(config.Model) > 0 {
+			modelName = config.Model[0]
+			configs, _ = s.GetConfigsForModel(serviceType, modelName, userID)
+		}
+		if len(configs) == 0 {
+			configs = []models.AIServiceConfig{*config}
+		}
+	}
+
+	for i := range configs {
+		configs[i].CreditCost = s.creditCostForConfig(serviceType, configs[i], modelName)
 	}
+	return configs, modelName, nil
+}
 
+// newTextClientForConfig 根据配置的 provider 创建文本客户端
+func newTextClientForConfig(config *models.AIServiceConfig, model string) ai.AIClient {
 	// 使用数据库配置中的 endpoint，如果为空则根据 provider 设置默认值
 	endpoint := config.Endpoint
 	if endpoint == "" {
 		switch config.Provider {
 		case "gemini", "google":
 			endpoint = "/v1beta/models/{model}:generateContent"
+		case "anthropic":
+			endpoint = "/v1/messages"
+		case "ollama":
+			endpoint = "/api/chat"
 		default:
 			endpoint = "/chat/completions"
 		}
@@ -750,36 +862,57 @@ func (s *AIService) GetAIClientForModel(serviceType string, modelName string) (a
 	// 根据 provider 创建对应的客户端
 	switch config.Provider {
 	case "gemini", "google":
-		return ai.NewGeminiClient(config.BaseURL, config.APIKey, modelName, endpoint), nil
+		return ai.NewGeminiClient(config.BaseURL, config.APIKey, model, endpoint)
+	case "anthropic":
+		return ai.NewAnthropicClient(config.BaseURL, config.APIKey, model, endpoint)
+	case "ollama":
+		return ai.NewOllamaClient(config.BaseURL, config.APIKey, model, endpoint)
 	default:
 		// openai, chatfire 等其他厂商都使用 OpenAI 格式
-		return ai.NewOpenAIClient(config.BaseURL, config.APIKey, modelName, endpoint), nil
+		return ai.NewOpenAIClient(config.BaseURL, config.APIKey, model, endpoint)
 	}
 }
 
-// GetAIClientForModelWithUser selects user config first (fallback to platform) and returns an AI client for the model.
-func (s *AIService) GetAIClientForModelWithUser(serviceType string, modelName string, userID uint) (ai.AIClient, error) {
-	config, err := s.GetConfigForModel(serviceType, modelName, userID)
+// newRoutingTextClient 为候选配置创建路由客户端，按优先级故障转移
+func (s *AIService) newRoutingTextClient(serviceType string, modelName string, userID uint) (ai.AIClient, error) {
+	configs, model, err := s.routingConfigs(serviceType, modelName, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	endpoint := config.Endpoint
-	if endpoint == "" {
-		switch config.Provider {
-		case "gemini", "google":
-			endpoint = "/v1beta/models/{model}:generateContent"
-		default:
-			endpoint = "/chat/completions"
-		}
+	routes := make([]aiRoute[ai.AIClient], 0, len(configs))
+	for i := range configs {
+		routes = append(routes, aiRoute[ai.AIClient]{Config: configs[i], Client: newTextClientForConfig(&configs[i], model)})
 	}
+	client := newRoutingAIClient(serviceType, routes, s.routes, s.log)
 
-	switch config.Provider {
-	case "gemini", "google":
-		return ai.NewGeminiClient(config.BaseURL, config.APIKey, modelName, endpoint), nil
-	default:
-		return ai.NewOpenAIClient(config.BaseURL, config.APIKey, modelName, endpoint), nil
+	// 缓存键包含用户与首选配置，使用其服务商，调用方通过 ai.WithResponseCache 逐次开启
+	if s.cacheTTL > 0 && serviceType == "text" {
+		scope := aiResponseCacheScope(userID, configs[0].ID)
+		return ai.NewCachedClient(client, newDBResponseCache(s.db), scope, configs[0].Provider, model, s.cacheTTL), nil
+	}
+	return client, nil
+}
+
+func (s *AIService) GetAIClient(serviceType string) (ai.AIClient, error) {
+	return s.newRoutingTextClient(serviceType, "", 0)
+}
+
+// GetAIClientForModel 根据服务类型和模型名称获取对应的AI客户端
+func (s *AIService) GetAIClientForModel(serviceType string, modelName string) (ai.AIClient, error) {
+	if _, err := s.GetConfigsForModel(serviceType, modelName); err != nil {
+		return nil, err
+	}
+	return s.newRoutingTextClient(serviceType, modelName, 0)
+}
+
+// GetAIClientForModelWithUser selects user config first (fallback to platform) and returns an AI client for the model.
+// The client fails over across every active config serving the model; see RoutingAIClient.
+func (s *AIService) GetAIClientForModelWithUser(serviceType string, modelName string, userID uint) (ai.AIClient, error) {
+	if _, err := s.GetConfigsForModel(serviceType, modelName, userID); err != nil {
+		return nil, err
 	}
+	return s.newRoutingTextClient(serviceType, modelName, userID)
 }
 
 func (s *AIService) GenerateText(prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
@@ -1,9 +1,11 @@
 package services
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -49,7 +51,7 @@ func seedAIConfig(t *testing.T, db *gorm.DB, userID uint, serviceType, provider,
 
 func TestPlatformAIConfig_GetDefaultConfig_IgnoresUserOwnedConfigs(t *testing.T) {
 	db := newAITestDB(t)
-	svc := NewAIService(db, logger.NewLogger(true))
+	svc := NewAIService(db, &config.Config{}, logger.NewLogger(true))
 
 	// User-owned config has higher priority but must be ignored.
 	_ = seedAIConfig(t, db, 123, "text", "openai", "user-high", "gpt-user", 100, 0)
@@ -69,7 +71,7 @@ func TestPlatformAIConfig_GetDefaultConfig_IgnoresUserOwnedConfigs(t *testing.T)
 
 func TestPlatformAIConfig_GetConfigForModel_IgnoresUserOwnedConfigs(t *testing.T) {
 	db := newAITestDB(t)
-	svc := NewAIService(db, logger.NewLogger(true))
+	svc := NewAIService(db, &config.Config{}, logger.NewLogger(true))
 
 	// Same model exists in both, but user-owned must be ignored.
 	_ = seedAIConfig(t, db, 456, "text", "openai", "user-high", "gpt-1", 999, 0)
@@ -89,7 +91,7 @@ func TestPlatformAIConfig_GetConfigForModel_IgnoresUserOwnedConfigs(t *testing.T
 
 func TestGetBillingConfig_FallbacksToPositivePlatformPrice(t *testing.T) {
 	db := newAITestDB(t)
-	svc := NewAIService(db, logger.NewLogger(true))
+	svc := NewAIService(db, &config.Config{}, logger.NewLogger(true))
 
 	// User config selected at runtime, but pricing is platform-defined.
 	// Its model has no explicit priced platform config.
@@ -111,3 +113,33 @@ func TestGetBillingConfig_FallbacksToPositivePlatformPrice(t *testing.T) {
 		t.Fatalf("expected fallback positive credit cost=7, got %d", cfg.CreditCost)
 	}
 }
+
+func TestCreateConfig_AllowsEmptyAPIKeyOnlyForOllama(t *testing.T) {
+	db := newAITestDB(t)
+	svc := NewAIService(db, &config.Config{}, logger.NewLogger(true))
+
+	created, err := svc.CreateConfig(&CreateAIConfigRequest{
+		ServiceType: "text",
+		Name:        "local-ollama",
+		Provider:    "ollama",
+		BaseURL:     "http://localhost:11434",
+		Model:       models.ModelField{"llama3"},
+	})
+	if err != nil {
+		t.Fatalf("expected ollama config without api key to be created, got %v", err)
+	}
+	if created.APIKey != "" {
+		t.Fatalf("expected empty api key, got %q", created.APIKey)
+	}
+
+	_, err = svc.CreateConfig(&CreateAIConfigRequest{
+		ServiceType: "text",
+		Name:        "openai-no-key",
+		Provider:    "openai",
+		BaseURL:     "https://api.openai.com/v1",
+		Model:       models.ModelField{"gpt-4o"},
+	})
+	if !errors.Is(err, ErrAPIKeyRequired) {
+		t.Fatalf("expected ErrAPIKeyRequired, got %v", err)
+	}
+}
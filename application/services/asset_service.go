@@ -238,15 +238,17 @@ func (s *AssetService) ImportFromImageGen(userID uint, imageGenID uint) (*models
 
 	category := "图片素材"
 	asset := &models.Asset{
-		UserID:     userID,
-		Name:       fmt.Sprintf("Image_%d", imageGen.ID),
-		Type:       models.AssetTypeImage,
-		URL:        *imageGen.ImageURL,
-		DramaID:    imageGen.DramaID,
-		Category:   &category,
-		ImageGenID: &imageGenID,
-		Width:      imageGen.Width,
-		Height:     imageGen.Height,
+		UserID:       userID,
+		Name:         fmt.Sprintf("Image_%d", imageGen.ID),
+		Type:         models.AssetTypeImage,
+		URL:          *imageGen.ImageURL,
+		LocalPath:    imageGen.LocalPath,
+		ThumbnailURL: imageGen.ThumbnailURL,
+		DramaID:      imageGen.DramaID,
+		Category:     &category,
+		ImageGenID:   &imageGenID,
+		Width:        imageGen.Width,
+		Height:       imageGen.Height,
 	}
 
 	if err := s.db.Create(asset).Error; err != nil {
@@ -303,7 +305,10 @@ func (s *AssetService) ImportFromVideoGen(userID uint, videoGenID uint) (*models
 		Height:        videoGen.Height,
 	}
 
-	if videoGen.FirstFrameURL != nil {
+	// 优先使用本地生成的首帧缩略图
+	if videoGen.ThumbnailURL != nil {
+		asset.ThumbnailURL = videoGen.ThumbnailURL
+	} else if videoGen.FirstFrameURL != nil {
 		asset.ThumbnailURL = videoGen.FirstFrameURL
 	}
 
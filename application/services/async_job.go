@@ -8,22 +8,34 @@ import (
 
 const (
 	JobTypeImageGeneration     = "image_generation.process"
+	JobTypeImagePollStatus     = "image_generation.poll_status"
 	JobTypeVideoGeneration     = "video_generation.process"
 	JobTypeVideoPollStatus     = "video_generation.poll_status"
 	JobTypeStoryboard          = "storyboard_generation.process"
 	JobTypeCharacterExtraction = "character_extraction.process"
 	JobTypePropExtraction      = "prop_extraction.process"
+	JobTypeTimelineRender      = "timeline_render.process"
+	JobTypeVoiceOver           = "voiceover_generation.process"
+	JobTypeEpisodeScore        = "episode_score.process"
+	JobTypeWebhookDelivery     = "webhook.deliver"
 )
 
 type AsyncJob struct {
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
+	Attempt int             `json:"attempt,omitempty"` // 已失败的执行次数，重试时递增
 }
 
 type ImageGenerationJobPayload struct {
 	ImageGenerationID uint `json:"image_generation_id"`
 }
 
+type ImagePollStatusJobPayload struct {
+	ImageGenerationID uint   `json:"image_generation_id"`
+	TaskID            string `json:"task_id"`
+	Attempt           int    `json:"attempt"`
+}
+
 type VideoGenerationJobPayload struct {
 	VideoGenerationID uint `json:"video_generation_id"`
 }
@@ -56,3 +68,30 @@ type VideoPollStatusJobPayload struct {
 	RecordedUsage     usage.TokenUsage `json:"recorded_usage"`
 	Attempt           int              `json:"attempt"`
 }
+
+type TimelineRenderJobPayload struct {
+	UserID     uint   `json:"user_id"`
+	TaskID     string `json:"task_id"`
+	TimelineID uint   `json:"timeline_id"`
+}
+
+type VoiceOverJobPayload struct {
+	UserID        uint   `json:"user_id"`
+	TaskID        string `json:"task_id"`
+	EpisodeID     uint   `json:"episode_id"`
+	Model         string `json:"model"`
+	StoryboardIDs []uint `json:"storyboard_ids,omitempty"`
+}
+
+type EpisodeScoreJobPayload struct {
+	UserID      uint   `json:"user_id"`
+	TaskID      string `json:"task_id"`
+	EpisodeID   uint   `json:"episode_id"`
+	Model       string `json:"model"`
+	SkipEffects bool   `json:"skip_effects"`
+	Regenerate  bool   `json:"regenerate"`
+}
+
+type WebhookDeliveryJobPayload struct {
+	DeliveryID uint `json:"delivery_id"`
+}
@@ -22,9 +22,11 @@ type BillingService struct {
 	log                 *logger.Logger
 	framePromptCredits  int
 	imageGenerateCredits int
+	lowCreditThreshold  int
+	webhooks            WebhookEmitter
 }
 
-func NewBillingService(db *gorm.DB, cfg *config.Config, log *logger.Logger) *BillingService {
+func NewBillingService(db *gorm.DB, cfg *config.Config, webhooks WebhookEmitter, log *logger.Logger) *BillingService {
 	frameCost := cfg.Billing.FramePromptCredits
 	if frameCost <= 0 {
 		frameCost = 10
@@ -33,12 +35,18 @@ func NewBillingService(db *gorm.DB, cfg *config.Config, log *logger.Logger) *Bil
 	if imageCost <= 0 {
 		imageCost = 5
 	}
+	lowCredits := cfg.Billing.LowCreditThreshold
+	if lowCredits <= 0 {
+		lowCredits = 20
+	}
 
 	return &BillingService{
 		db:                   db,
 		log:                  log,
 		framePromptCredits:   frameCost,
 		imageGenerateCredits: imageCost,
+		lowCreditThreshold:   lowCredits,
+		webhooks:             webhooks,
 	}
 }
 
@@ -55,7 +63,8 @@ func (s *BillingService) consume(userID uint, cost int, txnType models.CreditTra
 		return nil
 	}
 
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	var before, after int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		var user models.User
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
 			return err
@@ -66,6 +75,7 @@ func (s *BillingService) consume(userID uint, cost int, txnType models.CreditTra
 		}
 
 		newCredits := user.Credits - cost
+		before, after = user.Credits, newCredits
 		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("credits", newCredits).Error; err != nil {
 			return err
 		}
@@ -85,6 +95,22 @@ func (s *BillingService) consume(userID uint, cost int, txnType models.CreditTra
 		s.log.Infow("credits consumed", "user_id", userID, "cost", cost, "type", txnType)
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	s.notifyLowCredits(userID, before, after)
+	return nil
+}
+
+// notifyLowCredits 余额首次跌破阈值时触发 credits.low 事件，已低于阈值的后续扣费不再重复触发
+func (s *BillingService) notifyLowCredits(userID uint, before, after int) {
+	if before >= s.lowCreditThreshold && after < s.lowCreditThreshold {
+		emitWebhook(s.webhooks, userID, WebhookEventCreditsLow, map[string]interface{}{
+			"user_id":   userID,
+			"credits":   after,
+			"threshold": s.lowCreditThreshold,
+		})
+	}
 }
 
 func creditTxnTypeForServiceType(serviceType string) (reserve models.CreditTransactionType, refund models.CreditTransactionType, err error) {
@@ -95,6 +121,10 @@ func creditTxnTypeForServiceType(serviceType string) (reserve models.CreditTrans
 		return models.CreditTxnAIImage, models.CreditTxnAIImageRefund, nil
 	case "video":
 		return models.CreditTxnAIVideo, models.CreditTxnAIVideoRefund, nil
+	case "audio":
+		return models.CreditTxnAIAudio, models.CreditTxnAIAudioRefund, nil
+	case "music":
+		return models.CreditTxnAIMusic, models.CreditTxnAIMusicRefund, nil
 	default:
 		return "", "", fmt.Errorf("unknown service_type: %s", serviceType)
 	}
@@ -112,7 +142,8 @@ func (s *BillingService) ReserveAI(userID uint, serviceType, model string, cost
 	}
 	refID := uuid.New().String()
 
-	return refID, s.db.Transaction(func(tx *gorm.DB) error {
+	var before, after int
+	err = s.db.Transaction(func(tx *gorm.DB) error {
 		var user models.User
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
 			return err
@@ -122,6 +153,7 @@ func (s *BillingService) ReserveAI(userID uint, serviceType, model string, cost
 		}
 
 		newCredits := user.Credits - cost
+		before, after = user.Credits, newCredits
 		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("credits", newCredits).Error; err != nil {
 			return err
 		}
@@ -143,6 +175,11 @@ func (s *BillingService) ReserveAI(userID uint, serviceType, model string, cost
 		}
 		return nil
 	})
+	if err != nil {
+		return refID, err
+	}
+	s.notifyLowCredits(userID, before, after)
+	return refID, nil
 }
 
 // RefundAI refunds a previous reservation. This is idempotent: if already refunded, it returns nil.
@@ -222,7 +259,7 @@ func (s *BillingService) RecordAIUsage(referenceID string, tokenUsage usage.Toke
 	}
 
 	return s.db.Model(&models.CreditTransaction{}).
-		Where("reference_id = ? AND amount < 0", referenceID).
+		Where("reference_id = ? AND amount <= 0", referenceID).
 		Updates(map[string]interface{}{
 			"prompt_tokens":     gorm.Expr("COALESCE(prompt_tokens, 0) + ?", tokenUsage.PromptTokens),
 			"completion_tokens": gorm.Expr("COALESCE(completion_tokens, 0) + ?", tokenUsage.CompletionTokens),
@@ -230,6 +267,134 @@ func (s *BillingService) RecordAIUsage(referenceID string, tokenUsage usage.Toke
 		}).Error
 }
 
+// SettleAIConfig ties a reservation to the AI config that actually served the call.
+// When failover moved the call to a config with a different price, the difference is charged or refunded;
+// an extra charge the user cannot afford is waived. Refunded reservations only get the config recorded.
+func (s *BillingService) SettleAIConfig(referenceID string, configID uint, cost int) error {
+	if configID == 0 {
+		return nil
+	}
+	return s.SettleAIParts(referenceID, []AIServedPart{{ConfigID: configID, Cost: cost}})
+}
+
+// SettleAICacheHit turns a reservation served entirely from the response cache into a zero-cost transaction:
+// the reserved credits go back to the user and the transaction keeps amount 0 with cache_hit set.
+// Refunded reservations are left untouched.
+func (s *BillingService) SettleAICacheHit(referenceID string) error {
+	return s.SettleAIParts(referenceID, []AIServedPart{{Cached: true}})
+}
+
+// AIServedPart is one part of an action sharing a reservation (e.g. one storyboard segment) and the config that served it.
+type AIServedPart struct {
+	ConfigID uint // 0 when unknown; the part is then priced at the reserved cost
+	Cost     int
+	Cached   bool // every call of the part was served from the response cache
+}
+
+// SettleAIParts settles a reservation once all parts sharing it have finished. Each part bears an equal share
+// of the price at the cost of the config that served it and cached parts cost nothing, so the reservation is
+// re-priced once to the total of those shares. When every part was cached it becomes a cache hit.
+// An extra charge the user cannot afford is waived. Refunded reservations only get the config recorded.
+func (s *BillingService) SettleAIParts(referenceID string, parts []AIServedPart) error {
+	if referenceID == "" || len(parts) == 0 {
+		return nil
+	}
+	var configID uint
+	allCached := true
+	for _, part := range parts {
+		if part.Cached {
+			continue
+		}
+		allCached = false
+		if configID == 0 {
+			configID = part.ConfigID
+		}
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var reserved models.CreditTransaction
+		if err := tx.Where("reference_id = ? AND amount <= 0", referenceID).
+			Order("id DESC").
+			First(&reserved).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		updates := map[string]interface{}{}
+		if configID != 0 {
+			updates["ai_config_id"] = configID
+		}
+
+		var refunded int64
+		if err := tx.Model(&models.CreditTransaction{}).
+			Where("reference_id = ? AND amount > 0", referenceID).
+			Count(&refunded).Error; err != nil {
+			return err
+		}
+		if refunded == 0 {
+			reservedCost := -reserved.Amount
+			total := 0
+			for _, part := range parts {
+				switch {
+				case part.Cached:
+				case part.ConfigID != 0 && part.Cost > 0:
+					total += part.Cost
+				default:
+					total += reservedCost
+				}
+			}
+			cost := (total + len(parts) - 1) / len(parts)
+			diff := cost - reservedCost
+			if diff != 0 {
+				var user models.User
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, reserved.UserID).Error; err != nil {
+					return err
+				}
+				if user.Credits >= diff {
+					if err := tx.Model(&models.User{}).Where("id = ?", reserved.UserID).Update("credits", user.Credits-diff).Error; err != nil {
+						return err
+					}
+					updates["amount"] = -cost
+					updates["cache_hit"] = allCached
+				}
+			} else if allCached {
+				updates["cache_hit"] = true
+			}
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&models.CreditTransaction{}).Where("id = ?", reserved.ID).Updates(updates).Error
+	})
+}
+
+// ReserveAIAgain re-reserves credits for a reservation that was already refunded
+// (e.g. replaying a dead-lettered job). It returns the reference ID that now holds
+// the credits: a new one after re-reserving, or the original if it was never refunded.
+func (s *BillingService) ReserveAIAgain(referenceID string) (string, error) {
+	if referenceID == "" {
+		return "", nil
+	}
+
+	var refunded int64
+	if err := s.db.Model(&models.CreditTransaction{}).
+		Where("reference_id = ? AND amount > 0", referenceID).
+		Count(&refunded).Error; err != nil {
+		return "", err
+	}
+	if refunded == 0 {
+		return referenceID, nil
+	}
+
+	var reserved models.CreditTransaction
+	if err := s.db.Where("reference_id = ? AND amount < 0", referenceID).
+		Order("id DESC").
+		First(&reserved).Error; err != nil {
+		return "", err
+	}
+	return s.ReserveAI(reserved.UserID, safeStr(reserved.ServiceType), safeStr(reserved.Model), -reserved.Amount, safeStr(reserved.Description))
+}
+
 func safeStr(s *string) string {
 	if s == nil {
 		return ""
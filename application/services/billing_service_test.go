@@ -12,7 +12,7 @@ import (
 func TestBillingService_ListTransactionsFiltersCurrentUser(t *testing.T) {
 	db := newAdminServiceTestDB(t)
 	log := logger.NewLogger(true)
-	svc := NewBillingService(db, &config.Config{}, log)
+	svc := NewBillingService(db, &config.Config{}, nil, log)
 
 	userA := seedAdminServiceUser(t, db, "billing-a@example.com", models.RoleUser, models.UserStatusActive, 100)
 	userB := seedAdminServiceUser(t, db, "billing-b@example.com", models.RoleUser, models.UserStatusActive, 100)
@@ -74,3 +74,147 @@ func TestBillingService_ListTransactionsFiltersCurrentUser(t *testing.T) {
 		t.Fatalf("expected latest transaction first, got %s", items[0].Type)
 	}
 }
+
+func TestBillingService_ReserveAIAgainChargesOnlyAfterRefund(t *testing.T) {
+	db := newAdminServiceTestDB(t)
+	log := logger.NewLogger(true)
+	svc := NewBillingService(db, &config.Config{}, nil, log)
+
+	user := seedAdminServiceUser(t, db, "billing-replay@example.com", models.RoleUser, models.UserStatusActive, 100)
+
+	refID, err := svc.ReserveAI(user.ID, "image", "model-x", 10, "image generate")
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+
+	same, err := svc.ReserveAIAgain(refID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if same != refID {
+		t.Fatalf("expected active reservation to be reused, got %s", same)
+	}
+
+	if err := svc.RefundAI(refID); err != nil {
+		t.Fatalf("failed to refund: %v", err)
+	}
+	again, err := svc.ReserveAIAgain(refID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if again == "" || again == refID {
+		t.Fatalf("expected a new reservation, got %q", again)
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 90 {
+		t.Fatalf("expected balance 90 after re-reserving, got %d", reloaded.Credits)
+	}
+}
+
+func TestBillingService_SettleAIConfigChargesServedConfigPrice(t *testing.T) {
+	db := newAdminServiceTestDB(t)
+	log := logger.NewLogger(true)
+	svc := NewBillingService(db, &config.Config{}, nil, log)
+
+	user := seedAdminServiceUser(t, db, "billing-settle@example.com", models.RoleUser, models.UserStatusActive, 100)
+
+	refID, err := svc.ReserveAI(user.ID, "text", "model-x", 10, "storyboard")
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if err := svc.SettleAIConfig(refID, 7, 4); err != nil {
+		t.Fatalf("failed to settle: %v", err)
+	}
+
+	var reserved models.CreditTransaction
+	if err := db.Where("reference_id = ? AND amount < 0", refID).First(&reserved).Error; err != nil {
+		t.Fatalf("failed to load reservation: %v", err)
+	}
+	if reserved.Amount != -4 || reserved.AIConfigID == nil || *reserved.AIConfigID != 7 {
+		t.Fatalf("expected reservation settled to config 7 at 4 credits, got amount=%d config=%v", reserved.Amount, reserved.AIConfigID)
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 96 {
+		t.Fatalf("expected balance 96 after settlement, got %d", reloaded.Credits)
+	}
+
+	if err := svc.RefundAI(refID); err != nil {
+		t.Fatalf("failed to refund: %v", err)
+	}
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 100 {
+		t.Fatalf("expected refund of the settled amount, got balance %d", reloaded.Credits)
+	}
+}
+
+func TestBillingService_SettleAIPartsChargesSharesOnce(t *testing.T) {
+	db := newAdminServiceTestDB(t)
+	log := logger.NewLogger(true)
+	svc := NewBillingService(db, &config.Config{}, nil, log)
+
+	user := seedAdminServiceUser(t, db, "billing-parts@example.com", models.RoleUser, models.UserStatusActive, 100)
+
+	refID, err := svc.ReserveAI(user.ID, "text", "model-x", 10, "storyboard_generation:1")
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	// 三个分段：一段由原配置提供服务、一段命中缓存、一段故障转移到更便宜的配置
+	parts := []AIServedPart{{ConfigID: 7, Cost: 10}, {Cached: true}, {ConfigID: 8, Cost: 4}}
+	if err := svc.SettleAIParts(refID, parts); err != nil {
+		t.Fatalf("failed to settle: %v", err)
+	}
+
+	var reserved models.CreditTransaction
+	if err := db.Where("reference_id = ?", refID).First(&reserved).Error; err != nil {
+		t.Fatalf("failed to load reservation: %v", err)
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reserved.Amount != -5 || reserved.CacheHit || reserved.AIConfigID == nil || *reserved.AIConfigID != 7 || reloaded.Credits != 95 {
+		t.Fatalf("expected shares (10+0+4)/3 rounded up, got amount=%d cache_hit=%v config=%v balance=%d",
+			reserved.Amount, reserved.CacheHit, reserved.AIConfigID, reloaded.Credits)
+	}
+}
+
+func TestBillingService_SettleAICacheHitRecordsZeroCost(t *testing.T) {
+	db := newAdminServiceTestDB(t)
+	log := logger.NewLogger(true)
+	svc := NewBillingService(db, &config.Config{}, nil, log)
+
+	user := seedAdminServiceUser(t, db, "billing-cache@example.com", models.RoleUser, models.UserStatusActive, 100)
+
+	refID, err := svc.ReserveAI(user.ID, "text", "model-x", 10, "frame_prompt")
+	if err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if err := svc.SettleAICacheHit(refID); err != nil {
+		t.Fatalf("failed to settle cache hit: %v", err)
+	}
+
+	var txn models.CreditTransaction
+	if err := db.Where("reference_id = ?", refID).First(&txn).Error; err != nil {
+		t.Fatalf("failed to load transaction: %v", err)
+	}
+	if txn.Amount != 0 || !txn.CacheHit {
+		t.Fatalf("expected zero-cost cache hit transaction, got amount=%d cache_hit=%v", txn.Amount, txn.CacheHit)
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 100 {
+		t.Fatalf("expected reservation returned on cache hit, got balance %d", reloaded.Credits)
+	}
+
+	// 同一次预扣后续又实际请求了模型，按实际配置重新扣费
+	if err := svc.SettleAIConfig(refID, 7, 10); err != nil {
+		t.Fatalf("failed to settle: %v", err)
+	}
+	db.First(&txn, txn.ID)
+	db.First(&reloaded, user.ID)
+	if txn.Amount != -10 || txn.CacheHit || reloaded.Credits != 90 {
+		t.Fatalf("expected charge after a real call, got amount=%d cache_hit=%v balance=%d", txn.Amount, txn.CacheHit, reloaded.Credits)
+	}
+}
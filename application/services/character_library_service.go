@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,7 @@ import (
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
-	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/drama-generator/backend/pkg/usage"
 	"gorm.io/gorm"
 )
 
@@ -27,15 +28,15 @@ type CharacterLibraryService struct {
 	dispatcher  JobDispatcher
 }
 
-func NewCharacterLibraryService(db *gorm.DB, log *logger.Logger, cfg *config.Config, dispatcher JobDispatcher) *CharacterLibraryService {
+func NewCharacterLibraryService(db *gorm.DB, log *logger.Logger, cfg *config.Config, aiService *AIService, taskService *TaskService, dispatcher JobDispatcher, promptI18n *PromptI18n) *CharacterLibraryService {
 	return &CharacterLibraryService{
 		db:          db,
 		log:         log,
 		config:      cfg,
-		aiService:   NewAIService(db, log),
-		billing:     NewBillingService(db, cfg, log),
-		taskService: NewTaskService(db, log),
-		promptI18n:  NewPromptI18n(cfg),
+		aiService:   aiService,
+		billing:     NewBillingService(db, cfg, taskService.webhooks, log),
+		taskService: taskService,
+		promptI18n:  promptI18n,
 		runner:      NewTaskRunner(log, 4),
 		dispatcher:  dispatcher,
 	}
@@ -504,7 +505,7 @@ func (s *CharacterLibraryService) ExtractCharactersFromScript(userID uint, episo
 		return "", fmt.Errorf("剧本内容为空")
 	}
 
-	task, created, err := s.taskService.CreateOrGetActiveTask("character_extraction", fmt.Sprintf("%d", episode.DramaID))
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, "character_extraction", fmt.Sprintf("%d", episode.DramaID))
 	if err != nil {
 		return "", fmt.Errorf("创建任务失败: %w", err)
 	}
@@ -521,7 +522,7 @@ func (s *CharacterLibraryService) ExtractCharactersFromScript(userID uint, episo
 	if err := s.dispatchCharacterExtraction(payload); err != nil {
 		s.log.Warnw("Failed to dispatch character extraction through task bus, fallback to local runner", "error", err, "task_id", task.ID, "episode_id", episode.ID)
 		s.runner.Submit("character.extract_from_script", func() {
-			s.ProcessCharacterExtraction(userID, task.ID, episode)
+			s.ProcessCharacterExtraction(context.Background(), userID, task.ID, episode)
 		})
 	}
 
@@ -544,7 +545,16 @@ func (s *CharacterLibraryService) dispatchCharacterExtraction(payload CharacterE
 	})
 }
 
-func (s *CharacterLibraryService) ProcessCharacterExtraction(userID uint, taskID string, episode models.Episode) {
+// ProcessCharacterExtraction 从剧本提取角色，临时性错误返回给任务总线重试
+func (s *CharacterLibraryService) ProcessCharacterExtraction(ctx context.Context, userID uint, taskID string, episode models.Episode) error {
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	defer s.taskService.RefundCancelled(ctx, taskID, s.billing)
+	if ctx.Err() != nil {
+		s.log.Infow("Character extraction cancelled before start", "task_id", taskID)
+		return nil
+	}
+
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在分析剧本...")
 
 	script := ""
@@ -558,25 +568,14 @@ func (s *CharacterLibraryService) ProcessCharacterExtraction(userID uint, taskID
 		s.log.Warnw("Failed to load drama", "error", err, "drama_id", episode.DramaID)
 	}
 
-	prompt := s.promptI18n.GetCharacterExtractionPrompt(drama.Style)
+	prompt := s.promptI18n.ForDrama(userID, episode.DramaID).GetCharacterExtractionPrompt(drama.Style)
 	userPrompt := fmt.Sprintf("【剧本内容】\n%s", script)
 
 	client, _, billingRefID, err := reserveTextClient(s.aiService, s.billing, userID, "", "character_extraction:"+fmt.Sprintf("%d", episode.ID))
 	if err != nil {
-		s.taskService.UpdateTaskError(taskID, err)
-		return
-	}
-	response, err := client.GenerateText(userPrompt, prompt, ai.WithMaxTokens(3000))
-	if err != nil {
-		if billingRefID != "" {
-			_ = s.billing.RefundAI(billingRefID)
-		}
-		s.taskService.UpdateTaskError(taskID, err)
-		return
+		return s.taskService.failOrRetry(ctx, taskID, err)
 	}
-	recordTextUsage(s.billing, billingRefID, client)
-
-	s.taskService.UpdateTaskStatus(taskID, "processing", 50, "正在整理角色数据...")
+	noteTaskBilling(ctx, billingRefID)
 
 	var extractedCharacters []struct {
 		Name        string `json:"name"`
@@ -586,14 +585,39 @@ func (s *CharacterLibraryService) ProcessCharacterExtraction(userID uint, taskID
 		Description string `json:"description"`
 	}
 
-	if err := utils.SafeParseAIJSON(response, &extractedCharacters); err != nil {
-		s.log.Errorw("Failed to parse AI response for characters", "error", err, "response", response)
+	response, err := ai.GenerateStructuredContext(ctx, client, ai.StructuredRequest{
+		Prompt:       userPrompt,
+		SystemPrompt: prompt,
+		SchemaName:   "characters",
+		Cache:        true,
+		Options:      []func(*ai.ChatCompletionRequest){ai.WithMaxTokens(3000)},
+		Validate: func() error {
+			for i, c := range extractedCharacters {
+				if strings.TrimSpace(c.Name) == "" {
+					return fmt.Errorf("第 %d 个角色缺少 name", i+1)
+				}
+			}
+			return nil
+		},
+		OnResponse: func(_ int, _ string, used usage.TokenUsage) { recordTextUsage(s.billing, billingRefID, used) },
+	}, &extractedCharacters)
+	if err != nil {
 		if billingRefID != "" {
 			_ = s.billing.RefundAI(billingRefID)
 		}
-		s.taskService.UpdateTaskError(taskID, fmt.Errorf("解析AI响应失败"))
-		return
+		if ctx.Err() != nil {
+			s.log.Infow("Character extraction cancelled", "task_id", taskID)
+			return nil
+		}
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			s.log.Errorw("Failed to parse AI response for characters", "error", err, "response", response)
+			err = fmt.Errorf("解析AI响应失败")
+		}
+		return s.taskService.failOrRetry(ctx, taskID, err)
 	}
+	settleTextBilling(s.billing, billingRefID, client)
+
+	s.taskService.UpdateTaskStatus(taskID, "processing", 50, "正在整理角色数据...")
 
 	// Deduplicate AI output by name to avoid duplicate association rows (episode_characters).
 	seenName := make(map[string]struct{}, len(extractedCharacters))
@@ -676,4 +700,5 @@ func (s *CharacterLibraryService) ProcessCharacterExtraction(userID uint, taskID
 		"characters": savedCharacters,
 		"count":      len(savedCharacters),
 	})
+	return nil
 }
@@ -0,0 +1,504 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultJobQueueConcurrency  = 4
+	defaultJobQueuePollInterval = time.Second
+	defaultJobQueueLease        = 5 * time.Minute
+	// jobAbortWait 关闭宽限期结束后中止执行中的任务，再等待其放回队列的时长
+	jobAbortWait = 5 * time.Second
+)
+
+// DBJobQueue 基于数据库的任务队列，未启用 RabbitMQ 时使用
+// 任务领取后持有租约并定期续约，进程退出后租约到期的任务会被重新领取
+type DBJobQueue struct {
+	db           *gorm.DB
+	log          *logger.Logger
+	workerID     string
+	concurrency  int
+	pollInterval time.Duration
+	lease        time.Duration
+	retry        *JobRetryPolicies
+
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+
+	// jobsCtx 传给任务处理函数，关闭宽限期结束时取消以中止进行中的 AI 调用
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+
+	slots    chan struct{}
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	started  bool
+	wg       sync.WaitGroup
+}
+
+func NewDBJobQueue(db *gorm.DB, cfg config.JobQueueConfig, retry *JobRetryPolicies, log *logger.Logger) *DBJobQueue {
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultJobQueueConcurrency
+	}
+	pollInterval := time.Duration(cfg.PollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = defaultJobQueuePollInterval
+	}
+	lease := time.Duration(cfg.LeaseSeconds) * time.Second
+	if lease <= 0 {
+		lease = defaultJobQueueLease
+	}
+
+	hostname, _ := os.Hostname()
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	return &DBJobQueue{
+		db:           db,
+		log:          log,
+		workerID:     fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		concurrency:  concurrency,
+		pollInterval: pollInterval,
+		lease:        lease,
+		retry:        retry,
+		handlers:     make(map[string]JobHandler),
+		jobsCtx:      jobsCtx,
+		cancelJobs:   cancelJobs,
+		slots:        make(chan struct{}, concurrency),
+		wakeCh:       make(chan struct{}, 1),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func (q *DBJobQueue) Register(jobType string, handler JobHandler) {
+	if handler == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+func (q *DBJobQueue) Dispatch(job AsyncJob) error {
+	return q.DispatchDelayed(job, 0)
+}
+
+func (q *DBJobQueue) DispatchDelayed(job AsyncJob, delay time.Duration) error {
+	if q == nil {
+		return errors.New("db job queue is nil")
+	}
+
+	record := models.Job{
+		Type:    job.Type,
+		Payload: string(job.Payload),
+		Status:  models.JobStatusPending,
+		Attempt: job.Attempt,
+		RunAt:   time.Now().Add(max(delay, 0)),
+	}
+	if err := q.db.Create(&record).Error; err != nil {
+		return fmt.Errorf("enqueue job: %w", err)
+	}
+	if delay <= 0 {
+		q.wake()
+	}
+	return nil
+}
+
+func (q *DBJobQueue) wake() {
+	select {
+	case q.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (q *DBJobQueue) Start() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	if q.started {
+		q.mu.Unlock()
+		return nil
+	}
+	q.started = true
+	q.mu.Unlock()
+
+	q.wg.Add(1)
+	go q.loop()
+
+	if q.log != nil {
+		q.log.Infow("Database job queue started",
+			"worker_id", q.workerID,
+			"concurrency", q.concurrency,
+			"poll_interval", q.pollInterval.String(),
+			"lease", q.lease.String())
+	}
+	return nil
+}
+
+// Stop 停止领取新任务并等待执行中的任务结束
+// ctx 结束时仍未完成的任务会被中止并放回队列，未能及时放回的任务在租约到期后由下次启动重新领取
+func (q *DBJobQueue) Stop(ctx context.Context) error {
+	if q == nil {
+		return nil
+	}
+	q.stopOnce.Do(func() {
+		close(q.stopCh)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.wg.Wait()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.cancelJobs()
+	select {
+	case <-done:
+	case <-time.After(jobAbortWait):
+	}
+	return ctx.Err()
+}
+
+func (q *DBJobQueue) loop() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.poll()
+
+		select {
+		case <-q.stopCh:
+			return
+		case <-ticker.C:
+		case <-q.wakeCh:
+		}
+	}
+}
+
+// poll 按空闲槽位领取到期任务
+func (q *DBJobQueue) poll() {
+	free := q.concurrency - len(q.slots)
+	if free <= 0 {
+		return
+	}
+
+	jobs, err := q.claim(free)
+	if err != nil {
+		if q.log != nil {
+			q.log.Errorw("Failed to claim jobs", "error", err)
+		}
+		return
+	}
+
+	for _, job := range jobs {
+		q.slots <- struct{}{}
+		q.wg.Add(1)
+		go func(job models.Job) {
+			defer func() {
+				<-q.slots
+				q.wg.Done()
+			}()
+			q.execute(job)
+		}(job)
+	}
+}
+
+// claim 领取最多 limit 个到期或租约已过期的任务
+// 通过带条件的更新抢占，多个实例共享同一数据库时也不会重复领取
+func (q *DBJobQueue) claim(limit int) ([]models.Job, error) {
+	now := time.Now()
+	claimable := "(status = ? AND run_at <= ?) OR (status = ? AND lease_until < ?)"
+
+	var candidates []models.Job
+	if err := q.db.Where(claimable, models.JobStatusPending, now, models.JobStatusRunning, now).
+		Order("run_at ASC").
+		Limit(limit).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(q.lease)
+	claimed := make([]models.Job, 0, len(candidates))
+	for _, job := range candidates {
+		result := q.db.Model(&models.Job{}).
+			Where("id = ?", job.ID).
+			Where(claimable, models.JobStatusPending, now, models.JobStatusRunning, now).
+			Updates(map[string]interface{}{
+				"status":      models.JobStatusRunning,
+				"lease_until": leaseUntil,
+				"locked_by":   q.workerID,
+			})
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if job.Status == models.JobStatusRunning && q.log != nil {
+			q.log.Warnw("Reclaiming job with expired lease", "job_id", job.ID, "job_type", job.Type, "locked_by", job.LockedBy)
+		}
+		job.Status = models.JobStatusRunning
+		job.LeaseUntil = &leaseUntil
+		job.LockedBy = q.workerID
+		claimed = append(claimed, job)
+	}
+	return claimed, nil
+}
+
+func (q *DBJobQueue) execute(job models.Job) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if !ok {
+		if q.log != nil {
+			q.log.Errorw("Dead-lettering database job without handler", "job_id", job.ID, "job_type", job.Type)
+		}
+		q.markDead(job, job.Attempt+1, fmt.Errorf("no handler registered for job type %s", job.Type))
+		return
+	}
+
+	stopHeartbeat := q.keepLease(job.ID)
+	attempt := job.Attempt + 1
+	policy := q.retry.ForJob(job.Type)
+	err := func() (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("job panicked: %v", recovered)
+			}
+		}()
+		return handler(withJobAttempt(q.jobsCtx, attempt, policy), AsyncJob{
+			Type:    job.Type,
+			Payload: json.RawMessage(job.Payload),
+			Attempt: job.Attempt,
+		})
+	}()
+	stopHeartbeat()
+
+	if q.jobsCtx.Err() != nil {
+		// 关闭时被中止，处理函数可能已吞掉取消错误，统一放回队列重新执行
+		q.release(job)
+		return
+	}
+	if err == nil {
+		if result := q.owned(job.ID).Delete(&models.Job{}); result.Error != nil && q.log != nil {
+			q.log.Errorw("Failed to remove finished job", "job_id", job.ID, "error", result.Error)
+		}
+		return
+	}
+
+	if policy.ShouldRetry(attempt, err) {
+		delay := policy.Backoff(attempt)
+		msg := err.Error()
+		result := q.owned(job.ID).Updates(map[string]interface{}{
+			"status":      models.JobStatusPending,
+			"attempt":     attempt,
+			"run_at":      time.Now().Add(delay),
+			"lease_until": nil,
+			"locked_by":   "",
+			"last_error":  &msg,
+		})
+		if result.Error == nil {
+			if q.log != nil {
+				q.log.Warnw("Database job failed, retry scheduled",
+					"job_id", job.ID,
+					"job_type", job.Type,
+					"attempt", attempt,
+					"max_attempts", policy.MaxAttempts,
+					"delay", delay.String(),
+					"error", err)
+			}
+			return
+		}
+		if q.log != nil {
+			q.log.Errorw("Failed to schedule database job retry", "job_id", job.ID, "error", result.Error)
+		}
+	}
+
+	if q.log != nil {
+		q.log.Errorw("Database job failed, moving to dead letter", "job_id", job.ID, "job_type", job.Type, "attempt", attempt, "error", err)
+	}
+	q.markDead(job, attempt, err)
+}
+
+// release 将因关闭而中止的任务放回队列，不计入执行次数
+func (q *DBJobQueue) release(job models.Job) {
+	result := q.owned(job.ID).Updates(map[string]interface{}{
+		"status":      models.JobStatusPending,
+		"run_at":      time.Now(),
+		"lease_until": nil,
+		"locked_by":   "",
+	})
+	if result.Error != nil {
+		if q.log != nil {
+			q.log.Errorw("Failed to release aborted job", "job_id", job.ID, "error", result.Error)
+		}
+		return
+	}
+	if q.log != nil {
+		q.log.Infow("Job aborted by shutdown, released back to queue", "job_id", job.ID, "job_type", job.Type)
+	}
+}
+
+// owned 限定为本实例仍持有租约的任务，租约被其他实例抢占后不再修改
+func (q *DBJobQueue) owned(id uint) *gorm.DB {
+	return q.db.Model(&models.Job{}).Where("id = ? AND locked_by = ?", id, q.workerID)
+}
+
+func (q *DBJobQueue) markDead(job models.Job, attempts int, cause error) {
+	now := time.Now()
+	msg := cause.Error()
+	if err := q.owned(job.ID).Updates(map[string]interface{}{
+		"status":      models.JobStatusDead,
+		"attempt":     attempts,
+		"lease_until": nil,
+		"locked_by":   "",
+		"last_error":  &msg,
+		"dead_at":     &now,
+	}).Error; err != nil && q.log != nil {
+		q.log.Errorw("Failed to mark job as dead", "job_id", job.ID, "error", err)
+	}
+}
+
+// keepLease 任务执行期间定期续约，返回停止续约的函数
+func (q *DBJobQueue) keepLease(id uint) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				result := q.owned(id).Update("lease_until", time.Now().Add(q.lease))
+				if result.Error != nil && q.log != nil {
+					q.log.Warnw("Failed to renew job lease", "job_id", id, "error", result.Error)
+				}
+				if result.Error == nil && result.RowsAffected == 0 && q.log != nil {
+					q.log.Warnw("Job lease lost to another worker", "job_id", id)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ListDeadJobs 查看重试耗尽或无法处理的任务
+func (q *DBJobQueue) ListDeadJobs(limit int) ([]DeadJob, error) {
+	if limit <= 0 || limit > deadLetterScanLimit {
+		limit = 50
+	}
+
+	var records []models.Job
+	if err := q.db.Where("status = ?", models.JobStatusDead).
+		Order("dead_at DESC").
+		Limit(limit).
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	jobs := make([]DeadJob, 0, len(records))
+	for _, record := range records {
+		jobs = append(jobs, deadJobFromRecord(record))
+	}
+	return jobs, nil
+}
+
+// GetDeadJob 查看单条死信任务
+func (q *DBJobQueue) GetDeadJob(id string) (*DeadJob, error) {
+	record, err := q.findDeadJob(id)
+	if err != nil {
+		return nil, err
+	}
+	job := deadJobFromRecord(*record)
+	return &job, nil
+}
+
+// ReplayDeadJob 将死信任务重新放回队列，执行次数从头计算
+func (q *DBJobQueue) ReplayDeadJob(id string) (*DeadJob, error) {
+	record, err := q.findDeadJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := q.db.Model(&models.Job{}).
+		Where("id = ? AND status = ?", record.ID, models.JobStatusDead).
+		Updates(map[string]interface{}{
+			"status":  models.JobStatusPending,
+			"attempt": 0,
+			"run_at":  time.Now(),
+			"dead_at": nil,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("replay dead job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDeadJobNotFound
+	}
+	q.wake()
+
+	if q.log != nil {
+		q.log.Infow("Dead job replayed", "id", id, "job_type", record.Type)
+	}
+	job := deadJobFromRecord(*record)
+	return &job, nil
+}
+
+func (q *DBJobQueue) findDeadJob(id string) (*models.Job, error) {
+	jobID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrDeadJobNotFound
+	}
+
+	var record models.Job
+	if err := q.db.Where("id = ? AND status = ?", jobID, models.JobStatusDead).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeadJobNotFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+func deadJobFromRecord(record models.Job) DeadJob {
+	job := DeadJob{
+		ID:       strconv.FormatUint(uint64(record.ID), 10),
+		Type:     record.Type,
+		Attempts: record.Attempt,
+	}
+	if record.LastError != nil {
+		job.Error = *record.LastError
+	}
+	if record.DeadAt != nil {
+		job.DeadAt = *record.DeadAt
+	}
+	if json.Valid([]byte(record.Payload)) {
+		job.Payload = json.RawMessage(record.Payload)
+	} else {
+		job.Raw = record.Payload
+	}
+	return job
+}
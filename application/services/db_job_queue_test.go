@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func newDBJobQueueForTest(t *testing.T) *DBJobQueue {
+	t.Helper()
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	return NewDBJobQueue(db, config.JobQueueConfig{Concurrency: 2, PollIntervalMs: 20, LeaseSeconds: 60}, NewJobRetryPolicies(config.JobRetryConfig{}), logger.NewLogger(true))
+}
+
+func TestDBJobQueue_RunsDispatchedJobAndRemovesIt(t *testing.T) {
+	queue := newDBJobQueueForTest(t)
+
+	received := make(chan VoiceOverJobPayload, 1)
+	queue.Register(JobTypeVoiceOver, func(ctx context.Context, job AsyncJob) error {
+		var payload VoiceOverJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		received <- payload
+		return nil
+	})
+	if err := queue.Start(); err != nil {
+		t.Fatalf("failed to start queue: %v", err)
+	}
+	defer queue.Stop(context.Background())
+
+	payload, _ := json.Marshal(VoiceOverJobPayload{TaskID: "task-1", EpisodeID: 7})
+	if err := queue.Dispatch(AsyncJob{Type: JobTypeVoiceOver, Payload: payload}); err != nil {
+		t.Fatalf("failed to dispatch: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got.TaskID != "task-1" || got.EpisodeID != 7 {
+			t.Fatalf("unexpected payload: %+v", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("expected job to be executed")
+	}
+
+	if err := queue.Stop(context.Background()); err != nil {
+		t.Fatalf("failed to stop queue: %v", err)
+	}
+	var count int64
+	queue.db.Model(&models.Job{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected finished job to be removed, got %d rows", count)
+	}
+}
+
+func TestDBJobQueue_DelayedJobIsNotClaimedEarly(t *testing.T) {
+	queue := newDBJobQueueForTest(t)
+
+	if err := queue.DispatchDelayed(AsyncJob{Type: JobTypeVideoPollStatus, Payload: json.RawMessage(`{}`)}, time.Minute); err != nil {
+		t.Fatalf("failed to dispatch: %v", err)
+	}
+	jobs, err := queue.claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("expected delayed job not to be claimed, got %d", len(jobs))
+	}
+}
+
+func TestDBJobQueue_ReclaimsExpiredLease(t *testing.T) {
+	queue := newDBJobQueueForTest(t)
+
+	expired := time.Now().Add(-time.Minute)
+	stale := models.Job{Type: JobTypeVoiceOver, Payload: `{}`, Status: models.JobStatusRunning, RunAt: expired, LeaseUntil: &expired, LockedBy: "crashed-worker"}
+	active := time.Now().Add(time.Minute)
+	running := models.Job{Type: JobTypeVoiceOver, Payload: `{}`, Status: models.JobStatusRunning, RunAt: expired, LeaseUntil: &active, LockedBy: "live-worker"}
+	queue.db.Create(&stale)
+	queue.db.Create(&running)
+
+	jobs, err := queue.claim(10)
+	if err != nil {
+		t.Fatalf("failed to claim: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != stale.ID {
+		t.Fatalf("expected only the expired job to be reclaimed, got %+v", jobs)
+	}
+
+	var reloaded models.Job
+	queue.db.First(&reloaded, stale.ID)
+	if reloaded.LockedBy != queue.workerID || reloaded.LeaseUntil == nil || !reloaded.LeaseUntil.After(time.Now()) {
+		t.Fatalf("expected lease to be taken over, got %+v", reloaded)
+	}
+}
+
+func TestDBJobQueue_RetriesThenDeadLettersAndReplays(t *testing.T) {
+	queue := newDBJobQueueForTest(t)
+
+	calls := 0
+	queue.Register(JobTypeImageGeneration, func(ctx context.Context, job AsyncJob) error {
+		calls++
+		return errors.New("API error (status 503): upstream unavailable")
+	})
+
+	if err := queue.Dispatch(AsyncJob{Type: JobTypeImageGeneration, Payload: json.RawMessage(`{"image_generation_id":3}`)}); err != nil {
+		t.Fatalf("failed to dispatch: %v", err)
+	}
+
+	policy := NewJobRetryPolicies(config.JobRetryConfig{}).ForJob(JobTypeImageGeneration)
+	for i := 1; i <= policy.MaxAttempts; i++ {
+		// 跳过退避等待，直接将任务设为到期
+		queue.db.Model(&models.Job{}).Where("status = ?", models.JobStatusPending).Update("run_at", time.Now().Add(-time.Second))
+		jobs, err := queue.claim(1)
+		if err != nil || len(jobs) != 1 {
+			t.Fatalf("attempt %d: expected one job to be claimed, got %d (%v)", i, len(jobs), err)
+		}
+		queue.execute(jobs[0])
+
+		var record models.Job
+		queue.db.First(&record, jobs[0].ID)
+		if record.Attempt != i {
+			t.Fatalf("attempt %d: expected attempt counter %d, got %d", i, i, record.Attempt)
+		}
+		if i < policy.MaxAttempts && (record.Status != models.JobStatusPending || !record.RunAt.After(time.Now())) {
+			t.Fatalf("attempt %d: expected retry to be scheduled with backoff, got %+v", i, record)
+		}
+	}
+	if calls != policy.MaxAttempts {
+		t.Fatalf("expected %d calls, got %d", policy.MaxAttempts, calls)
+	}
+
+	dead, err := queue.ListDeadJobs(10)
+	if err != nil {
+		t.Fatalf("failed to list dead jobs: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Attempts != policy.MaxAttempts || dead[0].Error == "" || string(dead[0].Payload) != `{"image_generation_id":3}` {
+		t.Fatalf("unexpected dead jobs: %+v", dead)
+	}
+
+	if _, err := queue.ReplayDeadJob(dead[0].ID); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if _, err := queue.GetDeadJob(dead[0].ID); !errors.Is(err, ErrDeadJobNotFound) {
+		t.Fatalf("expected replayed job to leave the dead letter list, got %v", err)
+	}
+	jobs, err := queue.claim(1)
+	if err != nil || len(jobs) != 1 || jobs[0].Attempt != 0 {
+		t.Fatalf("expected replayed job to be claimable with fresh attempts, got %+v (%v)", jobs, err)
+	}
+}
+
+func TestDBJobQueue_StopAbortsRunningJobAndReleasesIt(t *testing.T) {
+	queue := newDBJobQueueForTest(t)
+
+	started := make(chan struct{})
+	queue.Register(JobTypeVoiceOver, func(ctx context.Context, job AsyncJob) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+	if err := queue.Start(); err != nil {
+		t.Fatalf("failed to start queue: %v", err)
+	}
+	if err := queue.Dispatch(AsyncJob{Type: JobTypeVoiceOver, Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("failed to dispatch: %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("expected job to be executed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := queue.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected grace period to expire, got %v", err)
+	}
+
+	var job models.Job
+	if err := queue.db.First(&job).Error; err != nil {
+		t.Fatalf("expected aborted job to be kept: %v", err)
+	}
+	if job.Status != models.JobStatusPending || job.Attempt != 0 || job.LockedBy != "" {
+		t.Fatalf("expected job released without consuming an attempt, got %+v", job)
+	}
+}
@@ -17,13 +17,16 @@ type DramaService struct {
 	db      *gorm.DB
 	log     *logger.Logger
 	baseURL string
+	// languages 校验剧的提示词语言
+	languages *LanguageService
 }
 
-func NewDramaService(db *gorm.DB, cfg *config.Config, log *logger.Logger) *DramaService {
+func NewDramaService(db *gorm.DB, cfg *config.Config, log *logger.Logger, languages *LanguageService) *DramaService {
 	return &DramaService{
-		db:      db,
-		log:     log,
-		baseURL: cfg.Storage.BaseURL,
+		db:        db,
+		log:       log,
+		baseURL:   cfg.Storage.BaseURL,
+		languages: languages,
 	}
 }
 
@@ -33,16 +36,18 @@ type CreateDramaRequest struct {
 	Genre       string `json:"genre"`
 	Style       string `json:"style"`
 	Tags        string `json:"tags"`
+	Language    string `json:"language"` // 提示词语言，为空表示跟随用户设置
 }
 
 type UpdateDramaRequest struct {
-	Title       string `json:"title" binding:"omitempty,min=1,max=100"`
-	Description string `json:"description"`
-	Genre       string `json:"genre"`
-	Style       string `json:"style"`
-	Tags        string `json:"tags"`
-	Thumbnail   string `json:"thumbnail" binding:"omitempty,max=500"`
-	Status      string `json:"status" binding:"omitempty,oneof=draft planning production completed archived"`
+	Title       string  `json:"title" binding:"omitempty,min=1,max=100"`
+	Description string  `json:"description"`
+	Genre       string  `json:"genre"`
+	Style       string  `json:"style"`
+	Tags        string  `json:"tags"`
+	Thumbnail   string  `json:"thumbnail" binding:"omitempty,max=500"`
+	Status      string  `json:"status" binding:"omitempty,oneof=draft planning production completed archived"`
+	Language    *string `json:"language"` // 传空字符串表示改回跟随用户设置
 }
 
 type DramaListQuery struct {
@@ -54,6 +59,9 @@ type DramaListQuery struct {
 }
 
 func (s *DramaService) CreateDrama(userID uint, req *CreateDramaRequest) (*models.Drama, error) {
+	if req.Language != "" && !s.languages.IsSupported(req.Language) {
+		return nil, ErrUnsupportedPromptLanguage
+	}
 	drama := &models.Drama{
 		UserID: userID,
 		Title:  req.Title,
@@ -70,6 +78,7 @@ func (s *DramaService) CreateDrama(userID uint, req *CreateDramaRequest) (*model
 	if req.Style != "" {
 		drama.Style = req.Style
 	}
+	drama.Language = req.Language
 
 	if err := s.db.Create(drama).Error; err != nil {
 		s.log.Errorw("Failed to create drama", "error", err)
@@ -304,6 +313,12 @@ func (s *DramaService) UpdateDrama(userID uint, dramaID string, req *UpdateDrama
 	if req.Status != "" {
 		updates["status"] = req.Status
 	}
+	if req.Language != nil {
+		if *req.Language != "" && !s.languages.IsSupported(*req.Language) {
+			return nil, ErrUnsupportedPromptLanguage
+		}
+		updates["language"] = *req.Language
+	}
 
 	updates["updated_at"] = time.Now()
 
@@ -1,13 +1,16 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/usage"
 	"gorm.io/gorm"
 )
 
@@ -26,15 +29,15 @@ type FramePromptService struct {
 }
 
 // NewFramePromptService 创建帧提示词服务
-func NewFramePromptService(db *gorm.DB, cfg *config.Config, log *logger.Logger) *FramePromptService {
+func NewFramePromptService(db *gorm.DB, cfg *config.Config, aiService *AIService, taskService *TaskService, log *logger.Logger, promptI18n *PromptI18n) *FramePromptService {
 	return &FramePromptService{
 		db:          db,
-		aiService:   NewAIService(db, log),
-		billing:     NewBillingService(db, cfg, log),
+		aiService:   aiService,
+		billing:     NewBillingService(db, cfg, taskService.webhooks, log),
 		log:         log,
 		config:      cfg,
-		promptI18n:  NewPromptI18n(cfg),
-		taskService: NewTaskService(db, log),
+		promptI18n:  promptI18n,
+		taskService: taskService,
 		runner:      NewTaskRunner(log, 4),
 	}
 }
@@ -106,7 +109,7 @@ func (s *FramePromptService) GenerateFramePrompt(userID uint, req GenerateFrameP
 	}
 
 	// 创建任务（若存在同资源进行中的任务则复用，避免重复扣分）
-	task, created, err := s.taskService.CreateOrGetActiveTask("frame_prompt_generation", req.StoryboardID)
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, "frame_prompt_generation", req.StoryboardID)
 	if err != nil {
 		s.log.Errorw("Failed to create frame prompt generation task", "error", err, "storyboard_id", req.StoryboardID)
 		return "", fmt.Errorf("创建任务失败: %w", err)
@@ -118,7 +121,7 @@ func (s *FramePromptService) GenerateFramePrompt(userID uint, req GenerateFrameP
 
 	// 异步处理帧提示词生成
 	s.runner.Submit("frame_prompt.generate", func() {
-		s.processFramePromptGeneration(userID, task.ID, req, model)
+		s.processFramePromptGeneration(context.Background(), userID, task.ID, req, model)
 	})
 
 	s.log.Infow("Frame prompt generation task created", "task_id", task.ID, "storyboard_id", req.StoryboardID, "frame_type", req.FrameType)
@@ -157,7 +160,15 @@ func (s *FramePromptService) findStoryboardForUser(userID uint, storyboardID str
 }
 
 // processFramePromptGeneration 异步处理帧提示词生成
-func (s *FramePromptService) processFramePromptGeneration(userID uint, taskID string, req GenerateFramePromptRequest, model string) {
+func (s *FramePromptService) processFramePromptGeneration(ctx context.Context, userID uint, taskID string, req GenerateFramePromptRequest, model string) {
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	defer s.taskService.RefundCancelled(ctx, taskID, s.billing)
+	if ctx.Err() != nil {
+		s.log.Infow("Frame prompt generation cancelled before start", "task_id", taskID)
+		return
+	}
+
 	// 更新任务状态为处理中
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在生成帧提示词...")
 
@@ -185,6 +196,7 @@ func (s *FramePromptService) processFramePromptGeneration(userID uint, taskID st
 		s.log.Warnw("Failed to load episode and drama", "error", err, "episode_id", storyboard.EpisodeID)
 	}
 	dramaStyle := episode.Drama.Style
+	prompts := s.promptI18n.ForDrama(userID, episode.DramaID)
 
 	response := &FramePromptResponse{
 		FrameType: req.FrameType,
@@ -193,24 +205,24 @@ func (s *FramePromptService) processFramePromptGeneration(userID uint, taskID st
 	// 生成提示词
 	switch req.FrameType {
 	case FrameTypeFirst:
-		response.SingleFrame = s.generateFirstFrame(userID, *storyboard, scene, dramaStyle, model)
+		response.SingleFrame = s.generateFirstFrame(ctx, prompts, userID, *storyboard, scene, dramaStyle, model)
 		if response.SingleFrame == nil {
-			s.taskService.UpdateTaskStatus(taskID, "failed", 0, "积分不足")
+			s.failFramePromptGeneration(ctx, taskID)
 			return
 		}
 		// 保存单帧提示词
 		s.saveFramePrompt(userID, req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
 	case FrameTypeKey:
-		response.SingleFrame = s.generateKeyFrame(userID, *storyboard, scene, dramaStyle, model)
+		response.SingleFrame = s.generateKeyFrame(ctx, prompts, userID, *storyboard, scene, dramaStyle, model)
 		if response.SingleFrame == nil {
-			s.taskService.UpdateTaskStatus(taskID, "failed", 0, "积分不足")
+			s.failFramePromptGeneration(ctx, taskID)
 			return
 		}
 		s.saveFramePrompt(userID, req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
 	case FrameTypeLast:
-		response.SingleFrame = s.generateLastFrame(userID, *storyboard, scene, dramaStyle, model)
+		response.SingleFrame = s.generateLastFrame(ctx, prompts, userID, *storyboard, scene, dramaStyle, model)
 		if response.SingleFrame == nil {
-			s.taskService.UpdateTaskStatus(taskID, "failed", 0, "积分不足")
+			s.failFramePromptGeneration(ctx, taskID)
 			return
 		}
 		s.saveFramePrompt(userID, req.StoryboardID, string(req.FrameType), response.SingleFrame.Prompt, response.SingleFrame.Description, "")
@@ -219,9 +231,9 @@ func (s *FramePromptService) processFramePromptGeneration(userID uint, taskID st
 		if count == 0 {
 			count = 3
 		}
-		response.MultiFrame = s.generatePanelFrames(userID, *storyboard, scene, count, dramaStyle, model)
+		response.MultiFrame = s.generatePanelFrames(ctx, prompts, userID, *storyboard, scene, count, dramaStyle, model)
 		if response.MultiFrame == nil {
-			s.taskService.UpdateTaskStatus(taskID, "failed", 0, "积分不足")
+			s.failFramePromptGeneration(ctx, taskID)
 			return
 		}
 		// 保存多帧提示词（合并为一条记录）
@@ -232,9 +244,9 @@ func (s *FramePromptService) processFramePromptGeneration(userID uint, taskID st
 		combinedPrompt := strings.Join(prompts, "\n---\n")
 		s.saveFramePrompt(userID, req.StoryboardID, string(req.FrameType), combinedPrompt, "分镜板组合提示词", response.MultiFrame.Layout)
 	case FrameTypeAction:
-		response.MultiFrame = s.generateActionSequence(userID, *storyboard, scene, dramaStyle, model)
+		response.MultiFrame = s.generateActionSequence(ctx, prompts, userID, *storyboard, scene, dramaStyle, model)
 		if response.MultiFrame == nil {
-			s.taskService.UpdateTaskStatus(taskID, "failed", 0, "积分不足")
+			s.failFramePromptGeneration(ctx, taskID)
 			return
 		}
 		var prompts []string
@@ -284,6 +296,15 @@ func (s *FramePromptService) saveFramePrompt(userID uint, storyboardID, frameTyp
 	}
 }
 
+// failFramePromptGeneration 未生成提示词时更新任务状态，任务已取消时保留取消状态
+func (s *FramePromptService) failFramePromptGeneration(ctx context.Context, taskID string) {
+	if ctx.Err() != nil {
+		s.log.Infow("Frame prompt generation cancelled", "task_id", taskID)
+		return
+	}
+	s.taskService.UpdateTaskStatus(taskID, "failed", 0, "积分不足")
+}
+
 // mustParseUint 辅助函数
 func mustParseUint(s string) uint64 {
 	var result uint64
@@ -291,59 +312,73 @@ func mustParseUint(s string) uint64 {
 	return result
 }
 
-func (s *FramePromptService) generateTextBilled(userID uint, model string, userPrompt string, systemPrompt string, detail string) (string, error) {
+// generateFramePromptBilled 预扣积分后请求单帧提示词的结构化输出
+// 输出多次校验失败时保留扣费（模型已完成调用），由调用方使用降级提示词
+func (s *FramePromptService) generateFramePromptBilled(ctx context.Context, userID uint, model string, userPrompt string, systemPrompt string, detail string) (*SingleFramePrompt, string, error) {
 	cfg, actualModel, err := s.aiService.GetBillingConfig("text", model, userID)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 	refID, err := s.billing.ReserveAI(userID, "text", actualModel, cfg.CreditCost, detail)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
+	noteTaskBilling(ctx, refID)
 
 	client, err := s.aiService.GetAIClientForModelWithUser("text", actualModel, userID)
 	if err != nil {
 		_ = s.billing.RefundAI(refID)
-		return "", err
+		return nil, "", err
+	}
+
+	var result SingleFramePrompt
+	out, err := ai.GenerateStructuredContext(ctx, client, ai.StructuredRequest{
+		Prompt:       userPrompt,
+		SystemPrompt: systemPrompt,
+		SchemaName:   "frame_prompt",
+		MaxAttempts:  2,
+		Cache:        true,
+		Validate: func() error {
+			if strings.TrimSpace(result.Prompt) == "" {
+				return fmt.Errorf("prompt 字段为空")
+			}
+			return nil
+		},
+		OnResponse: func(_ int, _ string, used usage.TokenUsage) { recordTextUsage(s.billing, refID, used) },
+	}, &result)
+	if err != nil && !errors.Is(err, ai.ErrStructuredOutputInvalid) {
+		_ = s.billing.RefundAI(refID)
+		return nil, out, err
 	}
-
-	out, err := client.GenerateText(userPrompt, systemPrompt)
+	// 输出无法解析时使用降级方案，模型调用仍然计费
+	settleTextBilling(s.billing, refID, client)
 	if err != nil {
-		_ = s.billing.RefundAI(refID)
-		return "", err
+		return nil, out, err
 	}
-	recordTextUsage(s.billing, refID, client)
-	return out, nil
+	return &result, out, nil
 }
 
 // generateFirstFrame 生成首帧提示词
-func (s *FramePromptService) generateFirstFrame(userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *SingleFramePrompt {
+func (s *FramePromptService) generateFirstFrame(ctx context.Context, prompts *PromptI18n, userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *SingleFramePrompt {
 	// 构建上下文信息
-	contextInfo := s.buildStoryboardContext(sb, scene)
+	contextInfo := s.buildStoryboardContext(prompts, sb, scene)
 
 	// 使用国际化提示词
-	systemPrompt := s.promptI18n.GetFirstFramePrompt(dramaStyle)
-	userPrompt := s.promptI18n.FormatUserPrompt("frame_info", contextInfo)
+	systemPrompt := prompts.GetFirstFramePrompt(dramaStyle)
+	userPrompt := prompts.FormatUserPrompt("frame_info", contextInfo)
 
-	aiResponse, err := s.generateTextBilled(userID, model, userPrompt, systemPrompt, "frame_prompt:first:"+fmt.Sprintf("%d", sb.ID))
+	result, aiResponse, err := s.generateFramePromptBilled(ctx, userID, model, userPrompt, systemPrompt, "frame_prompt:first:"+fmt.Sprintf("%d", sb.ID))
 	if err != nil {
-		if errors.Is(err, ErrInsufficientCredits) {
+		if errors.Is(err, ErrInsufficientCredits) || ctx.Err() != nil {
 			return nil
 		}
-		s.log.Warnw("AI generation failed, using fallback", "error", err)
-		// 降级方案：使用简单拼接
-		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "first frame, static shot")
-		return &SingleFramePrompt{
-			Prompt:      fallbackPrompt,
-			Description: "镜头开始的静态画面，展示初始状态",
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			// JSON解析失败，使用降级方案
+			s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "error", err, "response", aiResponse)
+		} else {
+			s.log.Warnw("AI generation failed, using fallback", "error", err)
 		}
-	}
-
-	// 解析AI返回的JSON
-	result := s.parseFramePromptJSON(aiResponse)
-	if result == nil {
-		// JSON解析失败，使用降级方案
-		s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "response", aiResponse)
+		// 降级方案：使用简单拼接
 		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "first frame, static shot")
 		return &SingleFramePrompt{
 			Prompt:      fallbackPrompt,
@@ -355,32 +390,26 @@ func (s *FramePromptService) generateFirstFrame(userID uint, sb models.Storyboar
 }
 
 // generateKeyFrame 生成关键帧提示词
-func (s *FramePromptService) generateKeyFrame(userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *SingleFramePrompt {
+func (s *FramePromptService) generateKeyFrame(ctx context.Context, prompts *PromptI18n, userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *SingleFramePrompt {
 	// 构建上下文信息
-	contextInfo := s.buildStoryboardContext(sb, scene)
+	contextInfo := s.buildStoryboardContext(prompts, sb, scene)
 
 	// 使用国际化提示词
-	systemPrompt := s.promptI18n.GetKeyFramePrompt(dramaStyle)
-	userPrompt := s.promptI18n.FormatUserPrompt("key_frame_info", contextInfo)
+	systemPrompt := prompts.GetKeyFramePrompt(dramaStyle)
+	userPrompt := prompts.FormatUserPrompt("key_frame_info", contextInfo)
 
-	aiResponse, err := s.generateTextBilled(userID, model, userPrompt, systemPrompt, "frame_prompt:key:"+fmt.Sprintf("%d", sb.ID))
+	result, aiResponse, err := s.generateFramePromptBilled(ctx, userID, model, userPrompt, systemPrompt, "frame_prompt:key:"+fmt.Sprintf("%d", sb.ID))
 	if err != nil {
-		if errors.Is(err, ErrInsufficientCredits) {
+		if errors.Is(err, ErrInsufficientCredits) || ctx.Err() != nil {
 			return nil
 		}
-		s.log.Warnw("AI generation failed, using fallback", "error", err)
-		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "key frame, dynamic action")
-		return &SingleFramePrompt{
-			Prompt:      fallbackPrompt,
-			Description: "动作高潮瞬间，展示关键动作",
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			// JSON解析失败，使用降级方案
+			s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "error", err, "response", aiResponse)
+		} else {
+			s.log.Warnw("AI generation failed, using fallback", "error", err)
 		}
-	}
-
-	// 解析AI返回的JSON
-	result := s.parseFramePromptJSON(aiResponse)
-	if result == nil {
-		// JSON解析失败，使用降级方案
-		s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "response", aiResponse)
+		// 降级方案：使用简单拼接
 		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "key frame, dynamic action")
 		return &SingleFramePrompt{
 			Prompt:      fallbackPrompt,
@@ -392,32 +421,26 @@ func (s *FramePromptService) generateKeyFrame(userID uint, sb models.Storyboard,
 }
 
 // generateLastFrame 生成尾帧提示词
-func (s *FramePromptService) generateLastFrame(userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *SingleFramePrompt {
+func (s *FramePromptService) generateLastFrame(ctx context.Context, prompts *PromptI18n, userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *SingleFramePrompt {
 	// 构建上下文信息
-	contextInfo := s.buildStoryboardContext(sb, scene)
+	contextInfo := s.buildStoryboardContext(prompts, sb, scene)
 
 	// 使用国际化提示词
-	systemPrompt := s.promptI18n.GetLastFramePrompt(dramaStyle)
-	userPrompt := s.promptI18n.FormatUserPrompt("last_frame_info", contextInfo)
+	systemPrompt := prompts.GetLastFramePrompt(dramaStyle)
+	userPrompt := prompts.FormatUserPrompt("last_frame_info", contextInfo)
 
-	aiResponse, err := s.generateTextBilled(userID, model, userPrompt, systemPrompt, "frame_prompt:last:"+fmt.Sprintf("%d", sb.ID))
+	result, aiResponse, err := s.generateFramePromptBilled(ctx, userID, model, userPrompt, systemPrompt, "frame_prompt:last:"+fmt.Sprintf("%d", sb.ID))
 	if err != nil {
-		if errors.Is(err, ErrInsufficientCredits) {
+		if errors.Is(err, ErrInsufficientCredits) || ctx.Err() != nil {
 			return nil
 		}
-		s.log.Warnw("AI generation failed, using fallback", "error", err)
-		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "last frame, final state")
-		return &SingleFramePrompt{
-			Prompt:      fallbackPrompt,
-			Description: "镜头结束画面，展示最终状态和结果",
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			// JSON解析失败，使用降级方案
+			s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "error", err, "response", aiResponse)
+		} else {
+			s.log.Warnw("AI generation failed, using fallback", "error", err)
 		}
-	}
-
-	// 解析AI返回的JSON
-	result := s.parseFramePromptJSON(aiResponse)
-	if result == nil {
-		// JSON解析失败，使用降级方案
-		s.log.Warnw("Failed to parse AI JSON response, using fallback", "storyboard_id", sb.ID, "response", aiResponse)
+		// 降级方案：使用简单拼接
 		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "last frame, final state")
 		return &SingleFramePrompt{
 			Prompt:      fallbackPrompt,
@@ -429,28 +452,28 @@ func (s *FramePromptService) generateLastFrame(userID uint, sb models.Storyboard
 }
 
 // generatePanelFrames 生成分镜板提示词（多格组合）
-func (s *FramePromptService) generatePanelFrames(userID uint, sb models.Storyboard, scene *models.Scene, count int, dramaStyle string, model string) *MultiFramePrompt {
+func (s *FramePromptService) generatePanelFrames(ctx context.Context, prompts *PromptI18n, userID uint, sb models.Storyboard, scene *models.Scene, count int, dramaStyle string, model string) *MultiFramePrompt {
 	layout := fmt.Sprintf("horizontal_%d", count)
 
 	frames := make([]SingleFramePrompt, count)
 
 	// 固定生成：首帧 -> 关键帧 -> 尾帧
 	if count == 3 {
-		first := s.generateFirstFrame(userID, sb, scene, dramaStyle, model)
+		first := s.generateFirstFrame(ctx, prompts, userID, sb, scene, dramaStyle, model)
 		if first == nil {
 			return nil
 		}
 		frames[0] = *first
 		frames[0].Description = "第1格：初始状态"
 
-		key := s.generateKeyFrame(userID, sb, scene, dramaStyle, model)
+		key := s.generateKeyFrame(ctx, prompts, userID, sb, scene, dramaStyle, model)
 		if key == nil {
 			return nil
 		}
 		frames[1] = *key
 		frames[1].Description = "第2格：动作高潮"
 
-		last := s.generateLastFrame(userID, sb, scene, dramaStyle, model)
+		last := s.generateLastFrame(ctx, prompts, userID, sb, scene, dramaStyle, model)
 		if last == nil {
 			return nil
 		}
@@ -458,19 +481,19 @@ func (s *FramePromptService) generatePanelFrames(userID uint, sb models.Storyboa
 		frames[2].Description = "第3格：最终状态"
 	} else if count == 4 {
 		// 4格：首帧 -> 中间帧1 -> 中间帧2 -> 尾帧
-		first := s.generateFirstFrame(userID, sb, scene, dramaStyle, model)
+		first := s.generateFirstFrame(ctx, prompts, userID, sb, scene, dramaStyle, model)
 		if first == nil {
 			return nil
 		}
-		key1 := s.generateKeyFrame(userID, sb, scene, dramaStyle, model)
+		key1 := s.generateKeyFrame(ctx, prompts, userID, sb, scene, dramaStyle, model)
 		if key1 == nil {
 			return nil
 		}
-		key2 := s.generateKeyFrame(userID, sb, scene, dramaStyle, model)
+		key2 := s.generateKeyFrame(ctx, prompts, userID, sb, scene, dramaStyle, model)
 		if key2 == nil {
 			return nil
 		}
-		last := s.generateLastFrame(userID, sb, scene, dramaStyle, model)
+		last := s.generateLastFrame(ctx, prompts, userID, sb, scene, dramaStyle, model)
 		if last == nil {
 			return nil
 		}
@@ -487,39 +510,26 @@ func (s *FramePromptService) generatePanelFrames(userID uint, sb models.Storyboa
 }
 
 // generateActionSequence 生成动作序列提示词（3x3宫格）
-func (s *FramePromptService) generateActionSequence(userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *MultiFramePrompt {
+func (s *FramePromptService) generateActionSequence(ctx context.Context, prompts *PromptI18n, userID uint, sb models.Storyboard, scene *models.Scene, dramaStyle string, model string) *MultiFramePrompt {
 	// 构建上下文信息
-	contextInfo := s.buildStoryboardContext(sb, scene)
+	contextInfo := s.buildStoryboardContext(prompts, sb, scene)
 
 	// 使用国际化提示词 - 专门为动作序列设计的提示词
-	systemPrompt := s.promptI18n.GetActionSequenceFramePrompt(dramaStyle)
-	userPrompt := s.promptI18n.FormatUserPrompt("frame_info", contextInfo)
-
-	aiResponse, err := s.generateTextBilled(userID, model, userPrompt, systemPrompt, "frame_prompt:action:"+fmt.Sprintf("%d", sb.ID))
+	systemPrompt := prompts.GetActionSequenceFramePrompt(dramaStyle)
+	userPrompt := prompts.FormatUserPrompt("frame_info", contextInfo)
 
+	result, aiResponse, err := s.generateFramePromptBilled(ctx, userID, model, userPrompt, systemPrompt, "frame_prompt:action:"+fmt.Sprintf("%d", sb.ID))
 	if err != nil {
-		if errors.Is(err, ErrInsufficientCredits) {
+		if errors.Is(err, ErrInsufficientCredits) || ctx.Err() != nil {
 			return nil
 		}
-		s.log.Warnw("AI generation failed for action sequence, using fallback", "error", err)
-		// 降级方案：使用简单拼接
-		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "3x3 storyboard grid action sequence, character consistency, continuous movement progression")
-		return &MultiFramePrompt{
-			Layout: "grid_3x3",
-			Frames: []SingleFramePrompt{
-				{
-					Prompt:      fallbackPrompt,
-					Description: "3x3宫格动作序列，展示连贯的动作演进",
-				},
-			},
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			// JSON解析失败，使用降级方案
+			s.log.Warnw("Failed to parse AI JSON response for action sequence, using fallback", "storyboard_id", sb.ID, "error", err, "response", aiResponse)
+		} else {
+			s.log.Warnw("AI generation failed for action sequence, using fallback", "error", err)
 		}
-	}
-
-	// 解析AI返回的JSON
-	result := s.parseFramePromptJSON(aiResponse)
-	if result == nil {
-		// JSON解析失败，使用降级方案
-		s.log.Warnw("Failed to parse AI JSON response for action sequence, using fallback", "storyboard_id", sb.ID, "response", aiResponse)
+		// 降级方案：使用简单拼接
 		fallbackPrompt := s.buildFallbackPrompt(sb, scene, "3x3 storyboard grid action sequence, character consistency, continuous movement progression")
 		return &MultiFramePrompt{
 			Layout: "grid_3x3",
@@ -540,19 +550,19 @@ func (s *FramePromptService) generateActionSequence(userID uint, sb models.Story
 }
 
 // buildStoryboardContext 构建镜头上下文信息
-func (s *FramePromptService) buildStoryboardContext(sb models.Storyboard, scene *models.Scene) string {
+func (s *FramePromptService) buildStoryboardContext(prompts *PromptI18n, sb models.Storyboard, scene *models.Scene) string {
 	var parts []string
 
 	// 镜头描述（最重要）
 	if sb.Description != nil && *sb.Description != "" {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("shot_description_label", *sb.Description))
+		parts = append(parts, prompts.FormatUserPrompt("shot_description_label", *sb.Description))
 	}
 
 	// 场景信息
 	if scene != nil {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("scene_label", scene.Location, scene.Time))
+		parts = append(parts, prompts.FormatUserPrompt("scene_label", scene.Location, scene.Time))
 	} else if sb.Location != nil && sb.Time != nil {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("scene_label", *sb.Location, *sb.Time))
+		parts = append(parts, prompts.FormatUserPrompt("scene_label", *sb.Location, *sb.Time))
 	}
 
 	// 角色
@@ -561,38 +571,38 @@ func (s *FramePromptService) buildStoryboardContext(sb models.Storyboard, scene
 		for _, char := range sb.Characters {
 			charNames = append(charNames, char.Name)
 		}
-		parts = append(parts, s.promptI18n.FormatUserPrompt("characters_label", strings.Join(charNames, ", ")))
+		parts = append(parts, prompts.FormatUserPrompt("characters_label", strings.Join(charNames, ", ")))
 	}
 
 	// 动作
 	if sb.Action != nil && *sb.Action != "" {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("action_label", *sb.Action))
+		parts = append(parts, prompts.FormatUserPrompt("action_label", *sb.Action))
 	}
 
 	// 结果
 	if sb.Result != nil && *sb.Result != "" {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("result_label", *sb.Result))
+		parts = append(parts, prompts.FormatUserPrompt("result_label", *sb.Result))
 	}
 
 	// 对白
 	if sb.Dialogue != nil && *sb.Dialogue != "" {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("dialogue_label", *sb.Dialogue))
+		parts = append(parts, prompts.FormatUserPrompt("dialogue_label", *sb.Dialogue))
 	}
 
 	// 氛围
 	if sb.Atmosphere != nil && *sb.Atmosphere != "" {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("atmosphere_label", *sb.Atmosphere))
+		parts = append(parts, prompts.FormatUserPrompt("atmosphere_label", *sb.Atmosphere))
 	}
 
 	// 镜头参数
 	if sb.ShotType != nil {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("shot_type_label", *sb.ShotType))
+		parts = append(parts, prompts.FormatUserPrompt("shot_type_label", *sb.ShotType))
 	}
 	if sb.Angle != nil {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("angle_label", *sb.Angle))
+		parts = append(parts, prompts.FormatUserPrompt("angle_label", *sb.Angle))
 	}
 	if sb.Movement != nil {
-		parts = append(parts, s.promptI18n.FormatUserPrompt("movement_label", *sb.Movement))
+		parts = append(parts, prompts.FormatUserPrompt("movement_label", *sb.Movement))
 	}
 
 	return strings.Join(parts, "\n")
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/httpclient"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/usage"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidImageEdit = errors.New("invalid image edit request")
+	ErrImageNotReady    = errors.New("source image is not completed")
+)
+
+const (
+	defaultOutpaintAspectRatio = "9:16"
+	maxImageVariations         = 4
+	// maxRemoteImageBytes 下载远程图片的大小上限
+	maxRemoteImageBytes = 32 << 20
+)
+
+type EditImageRequest struct {
+	Prompt      string `json:"prompt"`
+	Mask        string `json:"mask"`         // 局部重绘蒙版，base64 PNG 或 data URI，透明区域为重绘区域
+	AspectRatio string `json:"aspect_ratio"` // 扩图目标比例，默认 9:16
+	N           int    `json:"n"`            // 变体数量，默认 1
+	Model       string `json:"model"`
+}
+
+// EditImage 基于已完成的图片创建局部重绘、扩图或变体任务，结果记录为 parent_id 指向源图片的子记录，每张单独计费
+func (s *ImageGenerationService) EditImage(userID uint, parentID uint, op image.EditOperation, req *EditImageRequest) ([]*models.ImageGeneration, error) {
+	parent, err := s.GetImageGeneration(userID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Status != models.ImageStatusCompleted || (parent.LocalPath == nil && parent.ImageURL == nil) {
+		return nil, ErrImageNotReady
+	}
+
+	count := 1
+	var mask []byte
+	var maskPath, aspectRatio *string
+	switch op {
+	case image.EditInpaint:
+		if strings.TrimSpace(req.Prompt) == "" || req.Mask == "" {
+			return nil, fmt.Errorf("%w: inpaint requires prompt and mask", ErrInvalidImageEdit)
+		}
+		mask, err = decodeBase64Image(req.Mask)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImageEdit, err)
+		}
+	case image.EditOutpaint:
+		ratio := strings.TrimSpace(req.AspectRatio)
+		if ratio == "" {
+			ratio = defaultOutpaintAspectRatio
+		}
+		if _, _, err := image.ParseAspectRatio(ratio); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImageEdit, err)
+		}
+		aspectRatio = &ratio
+	case image.EditVariation:
+		if req.N != 0 {
+			count = req.N
+		}
+		if count < 1 || count > maxImageVariations {
+			return nil, fmt.Errorf("%w: n must be between 1 and %d", ErrInvalidImageEdit, maxImageVariations)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported operation %q", ErrInvalidImageEdit, op)
+	}
+
+	model := req.Model
+	if model == "" {
+		model = parent.Model
+	}
+	cfg, actualModel, err := s.aiService.GetBillingConfig("image", model, userID)
+	if err != nil {
+		return nil, err
+	}
+	billingDetail := fmt.Sprintf("image_%s:%d", op, parent.ID)
+	billingRefIDs := make([]string, 0, count)
+	refundAll := func() {
+		for _, refID := range billingRefIDs {
+			if refID != "" {
+				_ = s.billingService.RefundAI(refID)
+			}
+		}
+	}
+	for i := 0; i < count; i++ {
+		refID, err := s.billingService.ReserveAI(userID, "image", actualModel, cfg.CreditCost, billingDetail)
+		if err != nil {
+			refundAll()
+			return nil, err
+		}
+		billingRefIDs = append(billingRefIDs, refID)
+	}
+
+	// 蒙版在预扣成功后才落盘，之后没有创建任何子记录时删除
+	if mask != nil {
+		path, err := s.saveEditMask(mask)
+		if err != nil {
+			refundAll()
+			return nil, err
+		}
+		maskPath = &path
+	}
+
+	prompt := strings.TrimSpace(req.Prompt)
+	if prompt == "" {
+		prompt = parent.Prompt
+	}
+	operation := string(op)
+	children := make([]*models.ImageGeneration, 0, count)
+	for i, refID := range billingRefIDs {
+		child := &models.ImageGeneration{
+			UserID:       userID,
+			StoryboardID: parent.StoryboardID,
+			DramaID:      parent.DramaID,
+			SceneID:      parent.SceneID,
+			CharacterID:  parent.CharacterID,
+			PropID:       parent.PropID,
+			ImageType:    parent.ImageType,
+			FrameType:    parent.FrameType,
+			Provider:     cfg.Provider,
+			Prompt:       prompt,
+			NegPrompt:    parent.NegPrompt,
+			Model:        actualModel,
+			Size:         parent.Size,
+			Quality:      parent.Quality,
+			Style:        parent.Style,
+			ParentID:     &parent.ID,
+			Operation:    &operation,
+			MaskPath:     maskPath,
+			AspectRatio:  aspectRatio,
+			Status:       models.ImageStatusPending,
+		}
+		if refID != "" {
+			child.BillingRefID = &billingRefIDs[i]
+		}
+		if err := s.db.Create(child).Error; err != nil {
+			for _, unused := range billingRefIDs[i:] {
+				if unused != "" {
+					_ = s.billingService.RefundAI(unused)
+				}
+			}
+			if len(children) == 0 {
+				if maskPath != nil {
+					_ = os.Remove(s.privateStoragePath(*maskPath))
+				}
+				return nil, fmt.Errorf("failed to create record: %w", err)
+			}
+			s.log.Warnw("Failed to create image edit record", "error", err, "parent_id", parent.ID)
+			break
+		}
+		children = append(children, child)
+	}
+
+	for _, child := range children {
+		childID := child.ID
+		if err := s.dispatchImageGeneration(childID); err != nil {
+			s.log.Warnw("Failed to dispatch image edit through task bus, fallback to local runner", "error", err, "id", childID)
+			s.runner.Submit("image.process_generation", func() {
+				s.ProcessImageGeneration(context.Background(), childID)
+			})
+		}
+	}
+
+	s.log.Infow("Image edit created", "parent_id", parent.ID, "operation", op, "count", len(children))
+	return children, nil
+}
+
+// processImageEdit 加载源图片和蒙版后调用服务商的编辑接口
+func (s *ImageGenerationService) processImageEdit(ctx context.Context, imageGen *models.ImageGeneration, client image.ImageClient) error {
+	req, err := s.buildEditRequest(ctx, imageGen)
+	if err != nil {
+		s.log.Errorw("Failed to prepare image edit", "error", err, "id", imageGen.ID)
+		s.updateImageGenError(imageGen.ID, err.Error())
+		return nil
+	}
+
+	var opts []image.ImageOption
+	if imageGen.Model != "" {
+		opts = append(opts, image.WithModel(imageGen.Model))
+	}
+
+	s.log.Infow("Starting image edit", "id", imageGen.ID, "parent_id", imageGen.ParentID, "operation", req.Operation, "provider", imageGen.Provider)
+	callCtx, meter := usage.WithMeter(ctx)
+	var result *image.ImageResult
+	if editor, ok := client.(image.ImageEditor); ok {
+		result, err = editor.EditImageContext(callCtx, req, opts...)
+	} else {
+		err = image.ErrEditNotSupported
+	}
+	return s.handleImageResult(ctx, imageGen, client, meter, result, err)
+}
+
+func (s *ImageGenerationService) buildEditRequest(ctx context.Context, imageGen *models.ImageGeneration) (*image.EditRequest, error) {
+	if imageGen.ParentID == nil {
+		return nil, fmt.Errorf("image edit has no source image")
+	}
+	var parent models.ImageGeneration
+	if err := s.db.Where("id = ? AND user_id = ?", *imageGen.ParentID, imageGen.UserID).First(&parent).Error; err != nil {
+		return nil, fmt.Errorf("load source image: %w", err)
+	}
+	data, err := s.loadImageBytes(ctx, &parent)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &image.EditRequest{
+		Operation: image.EditOperation(*imageGen.Operation),
+		Image:     data,
+		Prompt:    imageGen.Prompt,
+	}
+	if imageGen.AspectRatio != nil {
+		req.AspectRatio = *imageGen.AspectRatio
+	}
+	if imageGen.MaskPath != nil {
+		if req.Mask, err = os.ReadFile(s.privateStoragePath(*imageGen.MaskPath)); err != nil {
+			return nil, fmt.Errorf("read mask: %w", err)
+		}
+	}
+	return req, nil
+}
+
+// loadImageBytes 优先读取本地文件，其次解析 data URI 或下载图片 URL
+func (s *ImageGenerationService) loadImageBytes(ctx context.Context, imageGen *models.ImageGeneration) ([]byte, error) {
+	if imageGen.LocalPath != nil && *imageGen.LocalPath != "" {
+		data, err := os.ReadFile(s.storageAbsolutePath(*imageGen.LocalPath))
+		if err == nil {
+			return data, nil
+		}
+		s.log.Warnw("Failed to read local image, falling back to image url", "error", err, "id", imageGen.ID)
+	}
+	if imageGen.ImageURL == nil || *imageGen.ImageURL == "" {
+		return nil, fmt.Errorf("source image has no data")
+	}
+
+	imageURL := *imageGen.ImageURL
+	if strings.HasPrefix(imageURL, "data:") {
+		return decodeBase64Image(imageURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create download request: %w", err)
+	}
+	resp, err := httpclient.Default().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download source image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download source image failed with status: %d", resp.StatusCode)
+	}
+	return readImageBody(resp.Body)
+}
+
+// readImageBody 读取下载的图片，超过 maxRemoteImageBytes 时返回错误
+func readImageBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxRemoteImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read image: %w", err)
+	}
+	if len(data) > maxRemoteImageBytes {
+		return nil, fmt.Errorf("image exceeds %d bytes", maxRemoteImageBytes)
+	}
+	return data, nil
+}
+
+// saveEditMask 蒙版保存到不对外提供访问的目录，任务重试时仍可读取
+func (s *ImageGenerationService) saveEditMask(mask []byte) (string, error) {
+	relativePath := filepath.Join("masks", fmt.Sprintf("%s_%s.png", time.Now().Format("20060102_150405"), uuid.New().String()[:8]))
+	fullPath := s.privateStoragePath(relativePath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create mask directory: %w", err)
+	}
+	if err := os.WriteFile(fullPath, mask, 0644); err != nil {
+		return "", fmt.Errorf("failed to save mask: %w", err)
+	}
+	return relativePath, nil
+}
+
+// privateStoragePath 私有目录下的绝对路径，该目录不在 /static 的访问范围内
+func (s *ImageGenerationService) privateStoragePath(relativePath string) string {
+	if filepath.IsAbs(relativePath) {
+		return relativePath
+	}
+	return filepath.Join(privateStorageDir(s.config.Storage), relativePath)
+}
+
+// privateStorageDir 不对外提供访问的文件目录，未配置时使用 local_path 同级的 private 目录，两者都为空时返回空
+func privateStorageDir(cfg config.StorageConfig) string {
+	if cfg.PrivatePath != "" {
+		return cfg.PrivatePath
+	}
+	if cfg.LocalPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(cfg.LocalPath)), "private")
+}
+
+// decodeBase64Image 支持纯 base64 和 data URI
+func decodeBase64Image(value string) ([]byte, error) {
+	if strings.HasPrefix(value, "data:") {
+		idx := strings.Index(value, ",")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid data uri")
+		}
+		value = value[idx+1:]
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("decode base64 image: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	return data, nil
+}
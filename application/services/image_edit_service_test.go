@@ -0,0 +1,253 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	stdimage "image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/storage"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func TestImageEdit_CreatesChildrenAndCallsEditEndpoint(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.ImageGeneration{}, &models.Character{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("expected multipart request: %v", err)
+		}
+		requests = append(requests, r)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"b64_json":"ZWRpdGVk"}],"usage":{"input_tokens":5,"output_tokens":7,"total_tokens":12}}`))
+	}))
+	defer server.Close()
+	cfg := seedAIConfig(t, db, 0, "image", "openai", "edit", "gpt-image-1", 1, 10)
+	db.Model(&cfg).Update("base_url", server.URL+"/v1")
+
+	log := logger.NewLogger(true)
+	localStorage, err := storage.NewLocalStorage(t.TempDir(), "http://localhost/static")
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	svc := &ImageGenerationService{
+		db:             db,
+		aiService:      NewAIService(db, &config.Config{}, log),
+		billingService: NewBillingService(db, &config.Config{}, nil, log),
+		taskService:    NewTaskService(db, log, NewTaskEventHub(), nil),
+		localStorage:   localStorage,
+		dispatcher:     &capturingDispatcher{},
+		config:         &config.Config{},
+		log:            log,
+	}
+
+	var source bytes.Buffer
+	if err := png.Encode(&source, stdimage.NewNRGBA(stdimage.Rect(0, 0, 160, 90))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	if err := os.MkdirAll(localStorage.GetAbsolutePath("images"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(localStorage.GetAbsolutePath(filepath.Join("images", "source.png")), source.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	user := models.User{Email: "edit@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 50}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	character := models.Character{UserID: user.ID, DramaID: 1, Name: "林"}
+	if err := db.Create(&character).Error; err != nil {
+		t.Fatalf("failed to create character: %v", err)
+	}
+	parent := models.ImageGeneration{UserID: user.ID, CharacterID: &character.ID, ImageType: string(models.ImageTypeCharacter),
+		Provider: "openai", Prompt: "少女站在窗前", Model: "gpt-image-1", Status: models.ImageStatusCompleted, LocalPath: strPtr("images/source.png")}
+	if err := db.Create(&parent).Error; err != nil {
+		t.Fatalf("failed to create parent: %v", err)
+	}
+
+	if _, err := svc.EditImage(user.ID, parent.ID, image.EditInpaint, &EditImageRequest{Prompt: "换成红色外套"}); !errors.Is(err, ErrInvalidImageEdit) {
+		t.Fatalf("expected inpaint without mask to be rejected, got %v", err)
+	}
+	if _, err := svc.EditImage(user.ID, parent.ID, image.EditVariation, &EditImageRequest{N: 5}); !errors.Is(err, ErrInvalidImageEdit) {
+		t.Fatalf("expected too many variations to be rejected, got %v", err)
+	}
+
+	outpaint, err := svc.EditImage(user.ID, parent.ID, image.EditOutpaint, &EditImageRequest{})
+	if err != nil {
+		t.Fatalf("failed to create outpaint: %v", err)
+	}
+	variations, err := svc.EditImage(user.ID, parent.ID, image.EditVariation, &EditImageRequest{N: 2})
+	if err != nil {
+		t.Fatalf("failed to create variations: %v", err)
+	}
+	if len(outpaint) != 1 || len(variations) != 2 || *variations[1].ParentID != parent.ID || *outpaint[0].AspectRatio != "9:16" {
+		t.Fatalf("unexpected children: %+v %+v", outpaint, variations)
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 20 {
+		t.Fatalf("expected each child to reserve credits, got %d left", reloaded.Credits)
+	}
+
+	if err := svc.ProcessImageGeneration(context.Background(), outpaint[0].ID); err != nil {
+		t.Fatalf("failed to process outpaint: %v", err)
+	}
+	if err := svc.ProcessImageGeneration(context.Background(), variations[0].ID); err != nil {
+		t.Fatalf("failed to process variation: %v", err)
+	}
+
+	if len(requests) != 2 || requests[0].URL.Path != "/v1/images/edits" {
+		t.Fatalf("expected two edit calls, got %d", len(requests))
+	}
+	if requests[0].FormValue("size") != "1024x1536" || requests[0].MultipartForm.File["mask"] == nil {
+		t.Fatalf("expected outpaint to send a portrait canvas with mask, got size %q", requests[0].FormValue("size"))
+	}
+	if requests[1].MultipartForm.File["mask"] != nil {
+		t.Fatalf("expected variation without mask")
+	}
+
+	var done models.ImageGeneration
+	db.First(&done, outpaint[0].ID)
+	if done.Status != models.ImageStatusCompleted || done.ImageURL == nil || *done.ImageURL != "data:image/png;base64,ZWRpdGVk" {
+		t.Fatalf("expected outpaint to complete, got %+v", done)
+	}
+	db.First(&character, character.ID)
+	if character.ImageURL == nil || *character.ImageURL != *done.ImageURL {
+		t.Fatalf("expected outpaint to update the character image")
+	}
+	db.Model(&models.Character{}).Where("id = ?", character.ID).Update("image_url", "kept")
+	if err := svc.ProcessImageGeneration(context.Background(), variations[1].ID); err != nil {
+		t.Fatalf("failed to process variation: %v", err)
+	}
+	db.First(&character, character.ID)
+	if *character.ImageURL != "kept" {
+		t.Fatalf("variations must not replace the character image")
+	}
+}
+
+func TestImageEdit_SavesMaskOutsidePublicStorage(t *testing.T) {
+	log := logger.NewLogger(true)
+	localStorage, err := storage.NewLocalStorage(t.TempDir(), "http://localhost/static")
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	privateDir := t.TempDir()
+	svc := &ImageGenerationService{
+		localStorage: localStorage,
+		config:       &config.Config{Storage: config.StorageConfig{PrivatePath: privateDir}},
+		log:          log,
+	}
+
+	maskPath, err := svc.saveEditMask([]byte("mask"))
+	if err != nil {
+		t.Fatalf("failed to save mask: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(privateDir, maskPath)); err != nil {
+		t.Fatalf("expected mask in private dir: %v", err)
+	}
+	if _, err := os.Stat(localStorage.GetAbsolutePath(maskPath)); !os.IsNotExist(err) {
+		t.Fatalf("expected mask not to be written to public storage, got %v", err)
+	}
+}
+
+func TestImageEdit_LeavesNoMaskWhenReservationFails(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.ImageGeneration{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	seedAIConfig(t, db, 0, "image", "openai", "edit", "gpt-image-1", 1, 10)
+
+	log := logger.NewLogger(true)
+	privateDir := t.TempDir()
+	svc := &ImageGenerationService{
+		db:             db,
+		aiService:      NewAIService(db, &config.Config{}, log),
+		billingService: NewBillingService(db, &config.Config{}, nil, log),
+		config:         &config.Config{Storage: config.StorageConfig{PrivatePath: privateDir}},
+		log:            log,
+	}
+
+	user := models.User{Email: "broke@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 0}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	parent := models.ImageGeneration{UserID: user.ID, Provider: "openai", Prompt: "p", Model: "gpt-image-1",
+		Status: models.ImageStatusCompleted, ImageURL: strPtr("https://example.com/source.png")}
+	if err := db.Create(&parent).Error; err != nil {
+		t.Fatalf("failed to create parent: %v", err)
+	}
+
+	mask := base64.StdEncoding.EncodeToString([]byte("mask"))
+	if _, err := svc.EditImage(user.ID, parent.ID, image.EditInpaint, &EditImageRequest{Prompt: "换成红色外套", Mask: mask}); err == nil {
+		t.Fatal("expected inpaint to fail without credits")
+	}
+	if entries, err := os.ReadDir(filepath.Join(privateDir, "masks")); err == nil && len(entries) > 0 {
+		t.Fatalf("expected no mask to be left behind, found %d", len(entries))
+	}
+}
+
+func TestImageEdit_ChildUsesProviderOfRequestedModel(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.ImageGeneration{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	seedAIConfig(t, db, 0, "image", "gemini", "gemini", "gemini-image", 2, 10)
+	seedAIConfig(t, db, 0, "image", "openai", "edit", "gpt-image-1", 1, 10)
+
+	log := logger.NewLogger(true)
+	svc := &ImageGenerationService{
+		db:             db,
+		aiService:      NewAIService(db, &config.Config{}, log),
+		billingService: NewBillingService(db, &config.Config{}, nil, log),
+		taskService:    NewTaskService(db, log, NewTaskEventHub(), nil),
+		dispatcher:     &capturingDispatcher{},
+		config:         &config.Config{},
+		log:            log,
+	}
+
+	user := models.User{Email: "switch@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 50}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	parent := models.ImageGeneration{UserID: user.ID, Provider: "gemini", Prompt: "p", Model: "gemini-image",
+		Status: models.ImageStatusCompleted, ImageURL: strPtr("https://example.com/source.png")}
+	if err := db.Create(&parent).Error; err != nil {
+		t.Fatalf("failed to create parent: %v", err)
+	}
+
+	children, err := svc.EditImage(user.ID, parent.ID, image.EditVariation, &EditImageRequest{Model: "gpt-image-1"})
+	if err != nil {
+		t.Fatalf("failed to create variation: %v", err)
+	}
+	if len(children) != 1 || children[0].Provider != "openai" || children[0].Model != "gpt-image-1" {
+		t.Fatalf("expected child to use the requested model's provider, got %+v", children)
+	}
+}
+
+func TestImageEdit_RejectsOversizedRemoteImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, maxRemoteImageBytes+1))
+	}))
+	defer server.Close()
+
+	svc := &ImageGenerationService{config: &config.Config{}, log: logger.NewLogger(true)}
+	imageURL := server.URL + "/large.png"
+	if _, err := svc.loadImageBytes(context.Background(), &models.ImageGeneration{ImageURL: &imageURL}); err == nil {
+		t.Fatalf("expected oversized image to be rejected")
+	}
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"os"
@@ -12,15 +14,21 @@ import (
 	"time"
 
 	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/external/ffmpeg"
 	"github.com/drama-generator/backend/infrastructure/storage"
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/image"
 	"github.com/drama-generator/backend/pkg/logger"
-	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/drama-generator/backend/pkg/usage"
 	"gorm.io/gorm"
 )
 
+const (
+	imagePollMaxAttempts = 60
+	imagePollInterval    = 5 * time.Second
+)
+
 type ImageGenerationService struct {
 	db              *gorm.DB
 	aiService       *AIService
@@ -33,6 +41,9 @@ type ImageGenerationService struct {
 	taskService     *TaskService
 	runner          *TaskRunner
 	dispatcher      JobDispatcher
+	references      *StoryboardReferenceResolver
+	postProcessor   *ImagePostProcessor
+	ffmpeg          *ffmpeg.FFmpeg
 }
 
 // truncateImageURL 截断图片 URL，避免 base64 格式的 URL 占满日志
@@ -53,19 +64,22 @@ func truncateImageURL(url string) string {
 	return url
 }
 
-func NewImageGenerationService(db *gorm.DB, cfg *config.Config, transferService *ResourceTransferService, localStorage *storage.LocalStorage, dispatcher JobDispatcher, log *logger.Logger) *ImageGenerationService {
+func NewImageGenerationService(db *gorm.DB, cfg *config.Config, transferService *ResourceTransferService, localStorage *storage.LocalStorage, aiService *AIService, taskService *TaskService, dispatcher JobDispatcher, log *logger.Logger, promptI18n *PromptI18n) *ImageGenerationService {
 	return &ImageGenerationService{
 		db:              db,
-		aiService:       NewAIService(db, log),
-		billingService:  NewBillingService(db, cfg, log),
+		aiService:       aiService,
+		billingService:  NewBillingService(db, cfg, taskService.webhooks, log),
 		transferService: transferService,
 		localStorage:    localStorage,
 		config:          cfg,
-		promptI18n:      NewPromptI18n(cfg),
+		promptI18n:      promptI18n,
 		log:             log,
-		taskService:     NewTaskService(db, log),
+		taskService:     taskService,
 		runner:          NewTaskRunner(log, 6),
 		dispatcher:      dispatcher,
+		references:      NewStoryboardReferenceResolver(db, cfg, log),
+		postProcessor:   NewImagePostProcessor(db, cfg, localStorage, log),
+		ffmpeg:          ffmpeg.NewFFmpeg(log),
 	}
 }
 
@@ -96,6 +110,8 @@ type GenerateImageRequest struct {
 	Height          *int     `json:"height"`
 	ImageLocalPath  *string  `json:"image_local_path"` // 本地图片路径，用于图生图
 	ReferenceImages []string `json:"reference_images"` // 参考图片URL列表
+
+	PanelComposite *PanelCompositeOptions `json:"panel_composite"` // 多格提示词逐格生成后在服务端拼图
 }
 
 func (s *ImageGenerationService) GenerateImage(userID uint, request *GenerateImageRequest) (*models.ImageGeneration, error) {
@@ -121,11 +137,38 @@ func (s *ImageGenerationService) GenerateImage(userID uint, request *GenerateIma
 	if request.DramaID != "" {
 		billingDetail = "image_generation:" + request.DramaID
 	}
+	if request.PanelComposite != nil {
+		return s.generatePanelComposite(userID, request, newImageGeneration(userID, request, dramaIDParsed, actualModel), cfg.CreditCost, billingDetail)
+	}
 	billingRefID, err := s.billingService.ReserveAI(userID, "image", actualModel, cfg.CreditCost, billingDetail)
 	if err != nil {
 		return nil, err
 	}
 
+	imageGen := newImageGeneration(userID, request, dramaIDParsed, actualModel)
+	if billingRefID != "" {
+		imageGen.BillingRefID = &billingRefID
+	}
+
+	if err := s.db.Create(imageGen).Error; err != nil {
+		if billingRefID != "" {
+			_ = s.billingService.RefundAI(billingRefID)
+		}
+		return nil, fmt.Errorf("failed to create record: %w", err)
+	}
+
+	if err := s.dispatchImageGeneration(imageGen.ID); err != nil {
+		s.log.Warnw("Failed to dispatch image generation through task bus, fallback to local runner", "error", err, "id", imageGen.ID)
+		s.runner.Submit("image.process_generation", func() {
+			s.ProcessImageGeneration(context.Background(), imageGen.ID)
+		})
+	}
+
+	return imageGen, nil
+}
+
+// newImageGeneration 按请求构建待生成的图片记录
+func newImageGeneration(userID uint, request *GenerateImageRequest, dramaID *uint, model string) *models.ImageGeneration {
 	provider := request.Provider
 	if provider == "" {
 		provider = "openai"
@@ -143,10 +186,10 @@ func (s *ImageGenerationService) GenerateImage(userID uint, request *GenerateIma
 		imageType = string(models.ImageTypeStoryboard)
 	}
 
-	imageGen := &models.ImageGeneration{
+	return &models.ImageGeneration{
 		UserID:          userID,
 		StoryboardID:    request.StoryboardID,
-		DramaID:         dramaIDParsed,
+		DramaID:         dramaID,
 		SceneID:         request.SceneID,
 		CharacterID:     request.CharacterID,
 		PropID:          request.PropID,
@@ -155,7 +198,7 @@ func (s *ImageGenerationService) GenerateImage(userID uint, request *GenerateIma
 		Provider:        provider,
 		Prompt:          request.Prompt,
 		NegPrompt:       request.NegativePrompt,
-		Model:           actualModel,
+		Model:           model,
 		Size:            request.Size,
 		ReferenceImages: referenceImagesJSON,
 		Quality:         request.Quality,
@@ -168,25 +211,6 @@ func (s *ImageGenerationService) GenerateImage(userID uint, request *GenerateIma
 		LocalPath:       request.ImageLocalPath,
 		Status:          models.ImageStatusPending,
 	}
-	if billingRefID != "" {
-		imageGen.BillingRefID = &billingRefID
-	}
-
-	if err := s.db.Create(imageGen).Error; err != nil {
-		if billingRefID != "" {
-			_ = s.billingService.RefundAI(billingRefID)
-		}
-		return nil, fmt.Errorf("failed to create record: %w", err)
-	}
-
-	if err := s.dispatchImageGeneration(imageGen.ID); err != nil {
-		s.log.Warnw("Failed to dispatch image generation through task bus, fallback to local runner", "error", err, "id", imageGen.ID)
-		s.runner.Submit("image.process_generation", func() {
-			s.ProcessImageGeneration(imageGen.ID)
-		})
-	}
-
-	return imageGen, nil
 }
 
 func (s *ImageGenerationService) dispatchImageGeneration(imageGenID uint) error {
@@ -285,12 +309,36 @@ func resolveRequestDimensions(request *GenerateImageRequest) (int, int, bool) {
 	return width, height, true
 }
 
-func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
+func (s *ImageGenerationService) ProcessImageGeneration(ctx context.Context, imageGenID uint) error {
+	ctx, release := s.taskService.trackRunning(ctx, imageGenerationTaskKey(imageGenID))
+	defer release()
+
 	var imageGen models.ImageGeneration
 	imageRatio := "16:9"
 	if err := s.db.First(&imageGen, imageGenID).Error; err != nil {
 		s.log.Errorw("Failed to load image generation", "error", err, "id", imageGenID)
-		return
+		return nil
+	}
+	switch imageGen.Status {
+	case models.ImageStatusCompleted, models.ImageStatusCancelled:
+		s.log.Infow("Image generation already finished, skipping", "id", imageGenID, "status", imageGen.Status)
+		return nil
+	case models.ImageStatusFailed:
+		// 死信重放：失败时已退回预扣积分，重新预扣后再执行
+		// 预扣失败时记录原因并返回错误，任务重新进入死信队列
+		if imageGen.BillingRefID != nil {
+			refID, err := s.billingService.ReserveAIAgain(*imageGen.BillingRefID)
+			if err != nil {
+				s.log.Warnw("Failed to re-reserve credits for replayed image generation", "error", err, "id", imageGenID)
+				s.db.Model(&imageGen).Update("error_msg", fmt.Sprintf("重放失败，重新预扣积分失败: %v", err))
+				return fmt.Errorf("re-reserve credits for replayed image generation: %w", err)
+			}
+			imageGen.BillingRefID = &refID
+		}
+		s.db.Model(&imageGen).Updates(map[string]interface{}{
+			"billing_ref_id": imageGen.BillingRefID,
+			"error_msg":      nil,
+		})
 	}
 
 	// 获取drama的style信息
@@ -301,7 +349,11 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 		}
 	}
 
-	s.db.Model(&imageGen).Update("status", models.ImageStatusProcessing)
+	// 排队期间已被取消的任务直接跳过
+	if updated := s.db.Model(&imageGen).Where("status <> ?", models.ImageStatusCancelled).Update("status", models.ImageStatusProcessing); updated.Error == nil && updated.RowsAffected == 0 {
+		s.log.Infow("Image generation cancelled before start", "id", imageGenID)
+		return nil
+	}
 
 	// 如果关联了background，同步更新background为generating状态
 	if imageGen.StoryboardID != nil {
@@ -316,7 +368,10 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 	if err != nil {
 		s.log.Errorw("Failed to get image client", "error", err, "provider", imageGen.Provider, "model", imageGen.Model)
 		s.updateImageGenError(imageGenID, err.Error())
-		return
+		return nil
+	}
+	if imageGen.Operation != nil && image.EditOperation(*imageGen.Operation).Valid() {
+		return s.processImageEdit(ctx, &imageGen, client)
 	}
 
 	// 解析参考图片
@@ -335,6 +390,8 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 		referenceImagePaths = append([]string{*imageGen.LocalPath}, referenceImagePaths...)
 	}
 
+	referenceImagePaths = s.applyStoryboardReferences(&imageGen, client, referenceImagePaths)
+
 	// 将所有参考图片路径转换为 base64（如果是本地路径）或保持原样（如果是 URL）
 	var referenceImages []string
 	for _, imgPath := range referenceImagePaths {
@@ -399,7 +456,7 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 
 	// 如果drama有风格设置，添加风格提示词
 	if drama.Style != "" && drama.Style != "realistic" {
-		stylePrompt := s.promptI18n.GetStylePrompt(drama.Style)
+		stylePrompt := s.promptI18n.ForDrama(imageGen.UserID, drama.ID).GetStylePrompt(drama.Style)
 		if stylePrompt != "" {
 			// 将风格提示词作为系统级约束添加到提示词前面
 			prompt = stylePrompt + "\n\n" + prompt
@@ -419,14 +476,35 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 			"id", imageGenID,
 			"reference_count", len(referenceImages))
 	}
-	result, err := client.GenerateImage(prompt, opts...)
+	callCtx, meter := usage.WithMeter(ctx)
+	result, err := client.GenerateImageContext(callCtx, prompt, opts...)
+	return s.handleImageResult(ctx, &imageGen, client, meter, result, err)
+}
+
+// handleImageResult 处理服务商调用结果：取消、重试、计费结算，以及同步完成或提交异步轮询
+func (s *ImageGenerationService) handleImageResult(ctx context.Context, imageGen *models.ImageGeneration, client image.ImageClient, meter *usage.Meter, result *image.ImageResult, err error) error {
+	imageGenID := imageGen.ID
+	if s.isImageGenerationCancelled(ctx, imageGenID) {
+		s.log.Infow("Image generation cancelled, discarding provider result", "id", imageGenID)
+		return nil
+	}
 	if err != nil {
 		s.log.Errorw("Image generation API call failed", "error", err, "id", imageGenID, "prompt", imageGen.Prompt)
+		if willRetryJob(ctx, err) {
+			// 临时性错误交给任务总线退避重试，保留预扣积分
+			s.db.Model(&models.ImageGeneration{}).Where("id = ? AND status = ?", imageGenID, models.ImageStatusProcessing).Update("status", models.ImageStatusPending)
+			return err
+		}
 		s.updateImageGenError(imageGenID, err.Error())
-		return
+		if IsRetryableJobError(err) {
+			// 重试耗尽，返回错误使任务进入死信队列
+			return err
+		}
+		return nil
 	}
 	if imageGen.BillingRefID != nil {
-		if err := s.billingService.RecordAIUsage(*imageGen.BillingRefID, client.GetLastUsage()); err != nil {
+		settleServedConfig(s.billingService, *imageGen.BillingRefID, client)
+		if err := s.billingService.RecordAIUsage(*imageGen.BillingRefID, meter.Total()); err != nil {
 			s.log.Warnw("Failed to record image token usage", "image_generation_id", imageGenID, "error", err)
 		}
 	}
@@ -434,27 +512,79 @@ func (s *ImageGenerationService) ProcessImageGeneration(imageGenID uint) {
 	s.log.Infow("Image generation API call completed", "id", imageGenID, "completed", result.Completed, "has_url", result.ImageURL != "")
 
 	if !result.Completed {
-		s.db.Model(&imageGen).Updates(map[string]interface{}{
+		updates := map[string]interface{}{
 			"status":  models.ImageStatusProcessing,
 			"task_id": result.TaskID,
-		})
-		s.runner.Submit("image.poll_task_status", func() {
-			s.pollTaskStatus(imageGenID, client, result.TaskID)
-		})
-		return
+		}
+		if routed, ok := client.(servedConfigReporter); ok {
+			if served := routed.ServedConfig(); served != nil {
+				updates["ai_config_id"] = served.ID
+			}
+		}
+		s.db.Model(imageGen).Updates(updates)
+		payload := ImagePollStatusJobPayload{ImageGenerationID: imageGenID, TaskID: result.TaskID}
+		if err := s.dispatchImagePollStatus(payload, imagePollInterval); err != nil {
+			s.log.Warnw("Failed to dispatch delayed image poll through task bus, fallback to local runner", "error", err, "id", imageGenID, "task_id", result.TaskID)
+			s.runner.Submit("image.poll_task_status", func() {
+				s.pollTaskStatus(imageGenID, client, result.TaskID, 0)
+			})
+		}
+		return nil
 	}
 
 	s.completeImageGeneration(imageGenID, result)
+	return nil
 }
 
-func (s *ImageGenerationService) pollTaskStatus(imageGenID uint, client image.ImageClient, taskID string) {
-	maxAttempts := 60
-	pollInterval := 5 * time.Second
+// applyStoryboardReferences 分镜图片自动附带出场角色、道具和场景的参考图，服务商支持 seed 且未指定时复用角色的 seed
+func (s *ImageGenerationService) applyStoryboardReferences(imageGen *models.ImageGeneration, client image.ImageClient, referenceImagePaths []string) []string {
+	if imageGen.StoryboardID == nil || imageGen.ImageType != string(models.ImageTypeStoryboard) || !s.references.Enabled() {
+		return referenceImagePaths
+	}
+	capable, ok := client.(image.ReferenceCapable)
+	if !ok {
+		return referenceImagePaths
+	}
+	caps := capable.ReferenceCapabilities()
+	if caps.MaxReferenceImages == 0 && !caps.Seed {
+		return referenceImagePaths
+	}
 
-	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(pollInterval)
+	limit := s.references.Limit(caps.MaxReferenceImages)
+	set, err := s.references.Resolve(imageGen.UserID, *imageGen.StoryboardID, limit)
+	if err != nil {
+		s.log.Warnw("Failed to resolve storyboard references", "error", err, "id", imageGen.ID, "storyboard_id", *imageGen.StoryboardID)
+		return referenceImagePaths
+	}
+	if caps.MaxReferenceImages > 0 {
+		referenceImagePaths = mergeReferenceImages(referenceImagePaths, set.Images(), limit)
+	}
+	if caps.Seed && imageGen.Seed == nil && set.Seed != nil {
+		imageGen.Seed = set.Seed
+		if err := s.db.Model(&models.ImageGeneration{}).Where("id = ?", imageGen.ID).Update("seed", *set.Seed).Error; err != nil {
+			s.log.Warnw("Failed to save character seed", "error", err, "id", imageGen.ID)
+		}
+	}
+	s.log.Infow("Applied storyboard references",
+		"id", imageGen.ID,
+		"storyboard_id", *imageGen.StoryboardID,
+		"auto_references", len(set.References),
+		"reference_count", len(referenceImagePaths),
+		"seed", imageGen.Seed)
+	return referenceImagePaths
+}
+
+func (s *ImageGenerationService) pollTaskStatus(imageGenID uint, client image.ImageClient, taskID string, attempt int) {
+	ctx, release := s.taskService.trackRunning(context.Background(), imageGenerationTaskKey(imageGenID))
+	defer release()
 
-		result, err := client.GetTaskStatus(taskID)
+	for i := attempt; i < imagePollMaxAttempts; i++ {
+		if !sleepContext(ctx, imagePollInterval) || s.isImageGenerationCancelled(ctx, imageGenID) {
+			s.log.Infow("Image generation cancelled, stopping poll", "id", imageGenID, "task_id", taskID)
+			return
+		}
+
+		result, err := client.GetTaskStatusContext(ctx, taskID)
 		if err != nil {
 			s.log.Errorw("Failed to get task status", "error", err, "task_id", taskID)
 			continue
@@ -474,8 +604,111 @@ func (s *ImageGenerationService) pollTaskStatus(imageGenID uint, client image.Im
 	s.updateImageGenError(imageGenID, "timeout: image generation took too long")
 }
 
+func (s *ImageGenerationService) dispatchImagePollStatus(payload ImagePollStatusJobPayload, delay time.Duration) error {
+	if s.dispatcher == nil {
+		return fmt.Errorf("task dispatcher not configured")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal image poll payload: %w", err)
+	}
+
+	return s.dispatcher.DispatchDelayed(AsyncJob{
+		Type:    JobTypeImagePollStatus,
+		Payload: body,
+	}, delay)
+}
+
+// ProcessImagePollStatus 查询一次服务商任务状态，未完成时投递下一次延迟轮询，进程重启后轮询链不会中断
+func (s *ImageGenerationService) ProcessImagePollStatus(ctx context.Context, payload ImagePollStatusJobPayload) {
+	if payload.TaskID == "" {
+		s.log.Errorw("Invalid empty taskID for delayed polling", "image_gen_id", payload.ImageGenerationID)
+		s.updateImageGenError(payload.ImageGenerationID, "invalid task ID for polling")
+		return
+	}
+
+	var imageGen models.ImageGeneration
+	if err := s.db.First(&imageGen, payload.ImageGenerationID).Error; err != nil {
+		s.log.Errorw("Failed to load image generation for delayed polling", "error", err, "id", payload.ImageGenerationID)
+		return
+	}
+
+	// 已取消或已结束的任务不再续投延迟轮询，轮询链在此终止
+	if imageGen.Status != models.ImageStatusProcessing || ctx.Err() != nil {
+		s.log.Infow("Image generation status changed, skipping delayed poll", "id", payload.ImageGenerationID, "status", imageGen.Status)
+		return
+	}
+
+	client, err := s.imageClientForGeneration(&imageGen)
+	if err != nil {
+		s.log.Errorw("Failed to get image client for delayed polling", "error", err, "id", payload.ImageGenerationID)
+		s.updateImageGenError(payload.ImageGenerationID, "failed to get image client")
+		return
+	}
+
+	result, err := client.GetTaskStatusContext(ctx, payload.TaskID)
+	if err != nil {
+		s.log.Errorw("Failed to get task status", "error", err, "task_id", payload.TaskID, "attempt", payload.Attempt+1)
+		s.requeueImagePoll(payload, client)
+		return
+	}
+
+	if result.Completed {
+		s.completeImageGeneration(payload.ImageGenerationID, result)
+		return
+	}
+
+	if result.Error != "" {
+		s.updateImageGenError(payload.ImageGenerationID, result.Error)
+		return
+	}
+
+	s.requeueImagePoll(payload, client)
+}
+
+func (s *ImageGenerationService) requeueImagePoll(payload ImagePollStatusJobPayload, client image.ImageClient) {
+	if payload.Attempt+1 >= imagePollMaxAttempts {
+		s.updateImageGenError(payload.ImageGenerationID, "timeout: image generation took too long")
+		return
+	}
+
+	nextPayload := payload
+	nextPayload.Attempt++
+	if err := s.dispatchImagePollStatus(nextPayload, imagePollInterval); err != nil {
+		s.log.Warnw("Failed to dispatch delayed image poll through task bus, fallback to local runner", "error", err, "id", payload.ImageGenerationID, "task_id", payload.TaskID)
+		s.runner.Submit("image.poll_task_status", func() {
+			s.pollTaskStatus(payload.ImageGenerationID, client, payload.TaskID, nextPayload.Attempt)
+		})
+	}
+}
+
+// imageClientForGeneration 优先使用提交任务时的 AI 配置查询状态，配置已删除时重新路由
+func (s *ImageGenerationService) imageClientForGeneration(imageGen *models.ImageGeneration) (image.ImageClient, error) {
+	if imageGen.AIConfigID != nil {
+		var config models.AIServiceConfig
+		if err := s.db.First(&config, *imageGen.AIConfigID).Error; err == nil {
+			model := imageGen.Model
+			if model == "" && len(config.Model) > 0 {
+				model = config.Model[0]
+			}
+			return newImageClientForConfig(&config, imageGen.Provider, model), nil
+		}
+		s.log.Warnw("AI config of image generation not found, rerouting", "id", imageGen.ID, "config_id", *imageGen.AIConfigID)
+	}
+	return s.getImageClientWithModel(imageGen.UserID, imageGen.Provider, imageGen.Model)
+}
+
 func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result *image.ImageResult) {
-	now := time.Now()
+	var imageGen models.ImageGeneration
+	if err := s.db.Where("id = ?", imageGenID).First(&imageGen).Error; err != nil {
+		s.log.Errorw("Failed to load image generation", "error", err, "id", imageGenID)
+		return
+	}
+	if imageGen.Status == models.ImageStatusCancelled {
+		s.log.Infow("Image generation cancelled, skipping completion", "id", imageGenID)
+		return
+	}
 
 	// 下载图片到本地存储并保存相对路径到数据库
 	var localPath *string
@@ -500,26 +733,49 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 		}
 	}
 
-	// 数据库中保存原始URL和本地路径
+	s.finishImageGeneration(&imageGen, result, localPath)
+}
+
+// finishImageGeneration 图片落盘后的本地处理、状态更新，以及同步到分镜、场景、角色和道具
+func (s *ImageGenerationService) finishImageGeneration(imageGen *models.ImageGeneration, result *image.ImageResult, localPath *string) {
+	now := time.Now()
+	imageGenID := imageGen.ID
+
+	// 生成缩略图，并按配置调整分镜画幅、加水印和转换格式；分镜、场景、角色和道具同步使用处理后的图片
+	processed := s.postProcessor.ProcessImageGeneration(imageGen, result.ImageURL, localPath)
+	localPath = processed.LocalPath
+	// 有水印时对外地址改用加水印的交付图片，避免通过服务商原图地址绕过水印
+	imageURL := result.ImageURL
+	if processed.DeliveryURL != nil {
+		imageURL = *processed.DeliveryURL
+	}
+
+	// 数据库中保存对外地址和本地路径
 	updates := map[string]interface{}{
 		"status":       models.ImageStatusCompleted,
-		"image_url":    result.ImageURL,
+		"image_url":    imageURL,
 		"local_path":   localPath,
 		"completed_at": now,
 	}
-
-	if result.Width > 0 {
-		updates["width"] = result.Width
+	if processed.OriginalPath != nil {
+		updates["original_path"] = processed.OriginalPath
 	}
-	if result.Height > 0 {
-		updates["height"] = result.Height
+	if processed.DeliveryPath != nil {
+		updates["delivery_path"] = processed.DeliveryPath
+	}
+	if processed.ThumbnailURL != nil {
+		updates["thumbnail_url"] = processed.ThumbnailURL
 	}
 
-	// 更新image_generation记录
-	var imageGen models.ImageGeneration
-	if err := s.db.Where("id = ?", imageGenID).First(&imageGen).Error; err != nil {
-		s.log.Errorw("Failed to load image generation", "error", err, "id", imageGenID)
-		return
+	if processed.Width > 0 {
+		updates["width"], updates["height"] = processed.Width, processed.Height
+	} else {
+		if result.Width > 0 {
+			updates["width"] = result.Width
+		}
+		if result.Height > 0 {
+			updates["height"] = result.Height
+		}
 	}
 
 	// 使用 Updates 更新基本字段
@@ -535,22 +791,39 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 
 	s.log.Infow("Image generation completed", "id", imageGenID)
 
+	// 变体由用户挑选后再使用，不覆盖分镜、场景、角色和道具的当前图片
+	if imageGen.Operation != nil && *imageGen.Operation == string(image.EditVariation) {
+		s.emitImageGenerationEvent(imageGenID, WebhookEventImageCompleted)
+		return
+	}
+	// 单格只是拼图的素材，全部完成后由拼图结果同步到分镜
+	if isPanelImage(imageGen) {
+		s.emitImageGenerationEvent(imageGenID, WebhookEventImageCompleted)
+		s.composePanels(*imageGen.ParentID)
+		return
+	}
+
 	// 如果关联了storyboard，同步更新storyboard的composed_image
 	if imageGen.StoryboardID != nil {
-		if err := s.db.Model(&models.Storyboard{}).Where("id = ?", *imageGen.StoryboardID).Update("composed_image", result.ImageURL).Error; err != nil {
+		storyboardUpdates := map[string]interface{}{
+			"composed_image":   imageURL,
+			"current_image_id": imageGenID,
+		}
+		if err := s.db.Model(&models.Storyboard{}).Where("id = ?", *imageGen.StoryboardID).Updates(storyboardUpdates).Error; err != nil {
 			s.log.Errorw("Failed to update storyboard composed_image", "error", err, "storyboard_id", *imageGen.StoryboardID)
 		} else {
 			s.log.Infow("Storyboard updated with composed image",
 				"storyboard_id", *imageGen.StoryboardID,
-				"composed_image", truncateImageURL(result.ImageURL))
+				"composed_image", truncateImageURL(imageURL))
 		}
 	}
 
 	// 如果关联了scene，同步更新scene的image_url、local_path和status（仅当ImageType是scene时）
 	if imageGen.SceneID != nil && imageGen.ImageType == string(models.ImageTypeScene) {
 		sceneUpdates := map[string]interface{}{
-			"status":    "generated",
-			"image_url": result.ImageURL,
+			"status":           "generated",
+			"image_url":        imageURL,
+			"current_image_id": imageGenID,
 		}
 		if localPath != nil {
 			sceneUpdates["local_path"] = localPath
@@ -560,7 +833,7 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 		} else {
 			s.log.Infow("Scene updated with generated image",
 				"scene_id", *imageGen.SceneID,
-				"image_url", truncateImageURL(result.ImageURL),
+				"image_url", truncateImageURL(imageURL),
 				"local_path", localPath)
 		}
 	}
@@ -568,7 +841,8 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 	// 如果关联了角色，同步更新角色的image_url和local_path
 	if imageGen.CharacterID != nil {
 		characterUpdates := map[string]interface{}{
-			"image_url": result.ImageURL,
+			"image_url":        imageURL,
+			"current_image_id": imageGenID,
 		}
 		if localPath != nil {
 			characterUpdates["local_path"] = localPath
@@ -578,7 +852,7 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 		} else {
 			s.log.Infow("Character updated with generated image",
 				"character_id", *imageGen.CharacterID,
-				"image_url", truncateImageURL(result.ImageURL),
+				"image_url", truncateImageURL(imageURL),
 				"local_path", localPath)
 		}
 	}
@@ -586,7 +860,8 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 	// 如果关联了道具，同步更新道具的image_url和local_path
 	if imageGen.PropID != nil {
 		propUpdates := map[string]interface{}{
-			"image_url": result.ImageURL,
+			"image_url":        imageURL,
+			"current_image_id": imageGenID,
 		}
 		if localPath != nil {
 			propUpdates["local_path"] = localPath
@@ -600,6 +875,8 @@ func (s *ImageGenerationService) completeImageGeneration(imageGenID uint, result
 				"local_path", localPath)
 		}
 	}
+
+	s.emitImageGenerationEvent(imageGenID, WebhookEventImageCompleted)
 }
 
 func (s *ImageGenerationService) updateImageGenError(imageGenID uint, errorMsg string) {
@@ -609,6 +886,9 @@ func (s *ImageGenerationService) updateImageGenError(imageGenID uint, errorMsg s
 		s.log.Errorw("Failed to load image generation", "error", err, "id", imageGenID)
 		return
 	}
+	if imageGen.Status == models.ImageStatusCancelled {
+		return
+	}
 
 	// 更新image_generation状态
 	s.db.Model(&models.ImageGeneration{}).Where("id = ?", imageGenID).Updates(map[string]interface{}{
@@ -629,6 +909,74 @@ func (s *ImageGenerationService) updateImageGenError(imageGenID uint, errorMsg s
 		s.db.Model(&models.Scene{}).Where("id = ?", *imageGen.SceneID).Update("status", "failed")
 		s.log.Warnw("Scene marked as failed", "scene_id", *imageGen.SceneID)
 	}
+
+	s.emitImageGenerationEvent(imageGenID, WebhookEventImageFailed)
+
+	// 任一格失败时拼图失败，其余未完成的格子取消并退回积分
+	if isPanelImage(&imageGen) {
+		s.failPanelComposite(*imageGen.ParentID, errorMsg)
+	}
+}
+
+// emitImageGenerationEvent 以最新记录触发 webhook 事件
+func (s *ImageGenerationService) emitImageGenerationEvent(imageGenID uint, event string) {
+	var imageGen models.ImageGeneration
+	if err := s.db.First(&imageGen, imageGenID).Error; err != nil {
+		s.log.Warnw("Failed to load image generation for webhook", "error", err, "id", imageGenID)
+		return
+	}
+	emitWebhook(s.taskService.webhooks, imageGen.UserID, event, imageGen)
+}
+
+// isImageGenerationCancelled 本进程内的 context 已取消，或数据库中已被标记为取消
+func (s *ImageGenerationService) isImageGenerationCancelled(ctx context.Context, imageGenID uint) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	var status models.ImageGenerationStatus
+	if err := s.db.Model(&models.ImageGeneration{}).Where("id = ?", imageGenID).Select("status").Scan(&status).Error; err != nil {
+		return false
+	}
+	return status == models.ImageStatusCancelled
+}
+
+// CancelImageGeneration 取消排队或生成中的图片任务，并退回预扣积分
+func (s *ImageGenerationService) CancelImageGeneration(userID uint, imageGenID uint) (*models.ImageGeneration, error) {
+	imageGen, err := s.GetImageGeneration(userID, imageGenID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.Model(&models.ImageGeneration{}).
+		Where("id = ? AND status IN ?", imageGenID, []models.ImageGenerationStatus{models.ImageStatusPending, models.ImageStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":    models.ImageStatusCancelled,
+			"error_msg": "cancelled by user",
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel image generation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotCancellable
+	}
+
+	s.taskService.cancelRunning(imageGenerationTaskKey(imageGenID))
+
+	if imageGen.BillingRefID != nil && *imageGen.BillingRefID != "" {
+		if err := s.billingService.RefundAI(*imageGen.BillingRefID); err != nil {
+			s.log.Warnw("Failed to refund cancelled image generation", "error", err, "billing_ref_id", *imageGen.BillingRefID, "id", imageGenID)
+		}
+	}
+
+	if imageGen.SceneID != nil {
+		s.db.Model(&models.Scene{}).Where("id = ? AND status = ?", *imageGen.SceneID, "generating").Update("status", "pending")
+	}
+	if imageGen.Operation != nil && *imageGen.Operation == imageOperationComposite {
+		s.cancelPanels(imageGenID)
+	}
+
+	s.log.Infow("Image generation cancelled", "id", imageGenID, "user_id", userID)
+	return s.GetImageGeneration(userID, imageGenID)
 }
 
 func (s *ImageGenerationService) getImageClient(userID uint, provider string) (image.ImageClient, error) {
@@ -673,34 +1021,22 @@ func (s *ImageGenerationService) getImageClient(userID uint, provider string) (i
 	}
 }
 
-// getImageClientWithModel 根据模型名称获取图片客户端
+// getImageClientWithModel 根据模型名称获取图片客户端，同一模型有多个配置时按优先级故障转移
 func (s *ImageGenerationService) getImageClientWithModel(userID uint, provider string, modelName string) (image.ImageClient, error) {
-	var config *models.AIServiceConfig
-	var err error
-
-	// 如果指定了模型，尝试获取对应的配置
-	if modelName != "" {
-		config, err = s.aiService.GetConfigForModel("image", modelName, userID)
-		if err != nil {
-			s.log.Warnw("Failed to get config for model, using default", "model", modelName, "error", err)
-			config, err = s.aiService.GetDefaultConfig("image", userID)
-			if err != nil {
-				return nil, fmt.Errorf("no image AI config found: %w", err)
-			}
-		}
-	} else {
-		config, err = s.aiService.GetDefaultConfig("image", userID)
-		if err != nil {
-			return nil, fmt.Errorf("no image AI config found: %w", err)
-		}
+	configs, model, err := s.aiService.routingConfigs("image", modelName, userID)
+	if err != nil {
+		return nil, fmt.Errorf("no image AI config found: %w", err)
 	}
 
-	// 使用指定的模型或配置中的第一个模型
-	model := modelName
-	if model == "" && len(config.Model) > 0 {
-		model = config.Model[0]
+	routes := make([]aiRoute[image.ImageClient], 0, len(configs))
+	for i := range configs {
+		routes = append(routes, aiRoute[image.ImageClient]{Config: configs[i], Client: newImageClientForConfig(&configs[i], provider, model)})
 	}
+	return newRoutingImageClient(routes, s.aiService.routes, s.log), nil
+}
 
+// newImageClientForConfig 根据配置的 provider 创建图片客户端
+func newImageClientForConfig(config *models.AIServiceConfig, provider string, model string) image.ImageClient {
 	// 使用配置中的 provider，如果没有则使用传入的 provider
 	actualProvider := config.Provider
 	if actualProvider == "" {
@@ -714,20 +1050,20 @@ func (s *ImageGenerationService) getImageClientWithModel(userID uint, provider s
 	switch actualProvider {
 	case "openai", "dalle":
 		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint)
 	case "chatfire":
 		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint)
 	case "volcengine", "volces", "doubao":
 		endpoint = "/images/generations"
 		queryEndpoint = ""
-		return image.NewVolcEngineImageClient(config.BaseURL, config.APIKey, model, endpoint, queryEndpoint), nil
+		return image.NewVolcEngineImageClient(config.BaseURL, config.APIKey, model, endpoint, queryEndpoint)
 	case "gemini", "google":
 		endpoint = "/v1beta/models/{model}:generateContent"
-		return image.NewGeminiImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		return image.NewGeminiImageClient(config.BaseURL, config.APIKey, model, endpoint)
 	default:
 		endpoint = "/images/generations"
-		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint), nil
+		return image.NewOpenAIImageClient(config.BaseURL, config.APIKey, model, endpoint)
 	}
 }
 
@@ -982,7 +1318,7 @@ func (s *ImageGenerationService) ExtractBackgroundsForEpisode(userID uint, episo
 	}
 
 	// 创建任务（若存在同资源进行中的任务则复用，避免重复扣分）
-	task, created, err := s.taskService.CreateOrGetActiveTask("background_extraction", episodeID)
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, "background_extraction", episodeID)
 	if err != nil {
 		s.log.Errorw("Failed to create background extraction task", "error", err, "episode_id", episodeID)
 		return "", fmt.Errorf("创建任务失败: %w", err)
@@ -994,7 +1330,7 @@ func (s *ImageGenerationService) ExtractBackgroundsForEpisode(userID uint, episo
 
 	// 异步处理场景提取
 	s.runner.Submit("image.extract_backgrounds", func() {
-		s.processBackgroundExtraction(userID, task.ID, episodeID, model, style)
+		s.processBackgroundExtraction(context.Background(), userID, task.ID, episodeID, model, style)
 	})
 
 	s.log.Infow("Background extraction task created", "task_id", task.ID, "episode_id", episodeID)
@@ -1002,7 +1338,15 @@ func (s *ImageGenerationService) ExtractBackgroundsForEpisode(userID uint, episo
 }
 
 // processBackgroundExtraction 异步处理场景提取
-func (s *ImageGenerationService) processBackgroundExtraction(userID uint, taskID string, episodeID string, model string, style string) {
+func (s *ImageGenerationService) processBackgroundExtraction(ctx context.Context, userID uint, taskID string, episodeID string, model string, style string) {
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	defer s.taskService.RefundCancelled(ctx, taskID, s.billingService)
+	if ctx.Err() != nil {
+		s.log.Infow("Background extraction cancelled before start", "task_id", taskID)
+		return
+	}
+
 	// 更新任务状态为处理中
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在提取场景信息...")
 
@@ -1023,7 +1367,11 @@ func (s *ImageGenerationService) processBackgroundExtraction(userID uint, taskID
 	dramaID := episode.DramaID
 
 	// 使用AI从剧本内容中提取场景
-	backgroundsInfo, err := s.extractBackgroundsFromScript(userID, *episode.ScriptContent, dramaID, model, style)
+	backgroundsInfo, err := s.extractBackgroundsFromScript(ctx, userID, *episode.ScriptContent, dramaID, model, style)
+	if ctx.Err() != nil {
+		s.log.Infow("Background extraction cancelled", "task_id", taskID)
+		return
+	}
 	if err != nil {
 		s.log.Errorw("Failed to extract backgrounds from script", "error", err, "task_id", taskID)
 		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "AI提取场景失败: "+err.Error())
@@ -1092,7 +1440,7 @@ func (s *ImageGenerationService) processBackgroundExtraction(userID uint, taskID
 }
 
 // extractBackgroundsFromScript 从剧本内容中使用AI提取场景信息
-func (s *ImageGenerationService) extractBackgroundsFromScript(userID uint, scriptContent string, dramaID uint, model string, style string) ([]BackgroundInfo, error) {
+func (s *ImageGenerationService) extractBackgroundsFromScript(ctx context.Context, userID uint, scriptContent string, dramaID uint, model string, style string) ([]BackgroundInfo, error) {
 	if scriptContent == "" {
 		return []BackgroundInfo{}, nil
 	}
@@ -1101,14 +1449,16 @@ func (s *ImageGenerationService) extractBackgroundsFromScript(userID uint, scrip
 	if err != nil {
 		return nil, err
 	}
+	noteTaskBilling(ctx, billingRefID)
 
 	// 使用国际化提示词
-	systemPrompt := s.promptI18n.GetSceneExtractionPrompt(style)
-	contentLabel := s.promptI18n.FormatUserPrompt("script_content_label")
+	prompts := s.promptI18n.ForDrama(userID, dramaID)
+	systemPrompt := prompts.GetSceneExtractionPrompt(style)
+	contentLabel := prompts.FormatUserPrompt("script_content_label")
 
 	// 根据语言构建不同的格式说明
 	var formatInstructions string
-	if s.promptI18n.IsEnglish() {
+	if prompts.IsEnglish() {
 		formatInstructions = `[Output JSON Format]
 {
   "backgrounds": [
@@ -1195,46 +1545,60 @@ Please strictly follow the JSON format and ensure all fields use English.`
 
 	// 打印完整提示词用于调试
 	s.log.Infow("=== AI Prompt for Background Extraction (extractBackgroundsFromScript) ===",
-		"language", s.promptI18n.GetLanguage(),
+		"language", prompts.GetLanguage(),
 		"model", actualModel,
 		"prompt_length", len(prompt),
 		"full_prompt", prompt)
 
-	response, err := client.GenerateText(prompt, "", ai.WithTemperature(0.7))
+	var extracted []struct {
+		Location   string `json:"location"`
+		Time       string `json:"time"`
+		Atmosphere string `json:"atmosphere"`
+		Prompt     string `json:"prompt"`
+	}
+	response, err := ai.GenerateStructuredContext(ctx, client, ai.StructuredRequest{
+		Prompt:     prompt,
+		SchemaName: "backgrounds",
+		Cache:      true,
+		Options:    []func(*ai.ChatCompletionRequest){ai.WithTemperature(0.7)},
+		Validate: func() error {
+			for i, bg := range extracted {
+				if strings.TrimSpace(bg.Location) == "" || strings.TrimSpace(bg.Prompt) == "" {
+					return fmt.Errorf("第 %d 个场景缺少 location 或 prompt", i+1)
+				}
+			}
+			return nil
+		},
+		OnResponse: func(_ int, _ string, used usage.TokenUsage) {
+			recordTextUsage(s.billingService, billingRefID, used)
+		},
+	}, &extracted)
 	if err != nil {
 		if billingRefID != "" {
 			_ = s.billingService.RefundAI(billingRefID)
 		}
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			s.log.Errorw("Failed to parse AI response for backgrounds", "error", err, "response", response[:min(len(response), 500)])
+			return nil, fmt.Errorf("解析AI响应失败: %w", err)
+		}
 		s.log.Errorw("Failed to extract backgrounds with AI", "error", err)
 		return nil, fmt.Errorf("AI提取场景失败: %w", err)
 	}
-	recordTextUsage(s.billingService, billingRefID, client)
+	settleTextBilling(s.billingService, billingRefID, client)
 
 	// 打印AI返回的原始响应
 	s.log.Infow("=== AI Response for Background Extraction (extractBackgroundsFromScript) ===",
 		"response_length", len(response),
 		"raw_response", response)
 
-	// 解析AI返回的JSON
-	var backgrounds []BackgroundInfo
-
-	// 先尝试解析为数组格式
-	if err := utils.SafeParseAIJSON(response, &backgrounds); err == nil {
-		s.log.Infow("Parsed backgrounds as array format", "count", len(backgrounds))
-	} else {
-		// 尝试解析为对象格式
-		var result struct {
-			Backgrounds []BackgroundInfo `json:"backgrounds"`
-		}
-		if err := utils.SafeParseAIJSON(response, &result); err != nil {
-			if billingRefID != "" {
-				_ = s.billingService.RefundAI(billingRefID)
-			}
-			s.log.Errorw("Failed to parse AI response in both formats", "error", err, "response", response[:min(len(response), 500)])
-			return nil, fmt.Errorf("解析AI响应失败: %w", err)
-		}
-		backgrounds = result.Backgrounds
-		s.log.Infow("Parsed backgrounds as object format", "count", len(backgrounds))
+	backgrounds := make([]BackgroundInfo, 0, len(extracted))
+	for _, bg := range extracted {
+		backgrounds = append(backgrounds, BackgroundInfo{
+			Location:   bg.Location,
+			Time:       bg.Time,
+			Atmosphere: bg.Atmosphere,
+			Prompt:     bg.Prompt,
+		})
 	}
 
 	s.log.Infow("Extracted backgrounds from script",
@@ -1245,7 +1609,7 @@ Please strictly follow the JSON format and ensure all fields use English.`
 }
 
 // extractBackgroundsWithAI 使用AI智能分析场景并提取唯一背景
-func (s *ImageGenerationService) extractBackgroundsWithAI(userID uint, storyboards []models.Storyboard, style string) ([]BackgroundInfo, error) {
+func (s *ImageGenerationService) extractBackgroundsWithAI(ctx context.Context, userID uint, storyboards []models.Storyboard, style string) ([]BackgroundInfo, error) {
 	if len(storyboards) == 0 {
 		return []BackgroundInfo{}, nil
 	}
@@ -1275,12 +1639,13 @@ func (s *ImageGenerationService) extractBackgroundsWithAI(userID uint, storyboar
 	}
 
 	// 使用国际化提示词
-	systemPrompt := s.promptI18n.GetSceneExtractionPrompt(style)
-	storyboardLabel := s.promptI18n.FormatUserPrompt("storyboard_list_label")
+	prompts := s.promptI18n.ForDrama(userID, 0)
+	systemPrompt := prompts.GetSceneExtractionPrompt(style)
+	storyboardLabel := prompts.FormatUserPrompt("storyboard_list_label")
 
 	// 根据语言构建不同的提示词
 	var formatInstructions string
-	if s.promptI18n.IsEnglish() {
+	if prompts.IsEnglish() {
 		formatInstructions = `[Output JSON Format]
 {
   "backgrounds": [
@@ -1363,7 +1728,7 @@ Please strictly follow the JSON format and ensure:
 
 	// 打印完整提示词用于调试
 	s.log.Infow("=== AI Prompt for Background Extraction (extractBackgroundsWithAI) ===",
-		"language", s.promptI18n.GetLanguage(),
+		"language", prompts.GetLanguage(),
 		"prompt_length", len(prompt),
 		"full_prompt", prompt)
 
@@ -1371,23 +1736,8 @@ Please strictly follow the JSON format and ensure:
 	if err != nil {
 		return nil, err
 	}
+	noteTaskBilling(ctx, billingRefID)
 
-	// 调用AI服务
-	text, err := client.GenerateText(prompt, "")
-	if err != nil {
-		if billingRefID != "" {
-			_ = s.billingService.RefundAI(billingRefID)
-		}
-		return nil, fmt.Errorf("AI analysis failed: %w", err)
-	}
-	recordTextUsage(s.billingService, billingRefID, client)
-
-	// 打印AI返回的原始响应
-	s.log.Infow("=== AI Response for Background Extraction ===",
-		"response_length", len(text),
-		"raw_response", text)
-
-	// 解析AI返回的JSON
 	var result struct {
 		Scenes []struct {
 			Location         string `json:"location"`
@@ -1397,12 +1747,38 @@ Please strictly follow the JSON format and ensure:
 		} `json:"backgrounds"`
 	}
 
-	if err := utils.SafeParseAIJSON(text, &result); err != nil {
+	// 调用AI服务
+	text, err := ai.GenerateStructuredContext(ctx, client, ai.StructuredRequest{
+		Prompt:     prompt,
+		SchemaName: "backgrounds",
+		Cache:      true,
+		Validate: func() error {
+			for i, bg := range result.Scenes {
+				if strings.TrimSpace(bg.Location) == "" || strings.TrimSpace(bg.Prompt) == "" {
+					return fmt.Errorf("第 %d 个场景缺少 location 或 prompt", i+1)
+				}
+			}
+			return nil
+		},
+		OnResponse: func(_ int, _ string, used usage.TokenUsage) {
+			recordTextUsage(s.billingService, billingRefID, used)
+		},
+	}, &result)
+	if err != nil {
 		if billingRefID != "" {
 			_ = s.billingService.RefundAI(billingRefID)
 		}
-		return nil, fmt.Errorf("failed to parse AI response: %w", err)
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			return nil, fmt.Errorf("failed to parse AI response: %w", err)
+		}
+		return nil, fmt.Errorf("AI analysis failed: %w", err)
 	}
+	settleTextBilling(s.billingService, billingRefID, client)
+
+	// 打印AI返回的原始响应
+	s.log.Infow("=== AI Response for Background Extraction ===",
+		"response_length", len(text),
+		"raw_response", text)
 
 	// 构建场景编号到场景ID的映射
 	storyboardNumberToID := make(map[int]uint)
@@ -1479,20 +1855,20 @@ func (s *ImageGenerationService) extractUniqueBackgrounds(scenes []models.Storyb
 	return backgrounds
 }
 
-// loadImageAsBase64 读取本地图片文件并转换为 base64 格式的 data URI
-func (s *ImageGenerationService) loadImageAsBase64(localPath string) (string, error) {
-	// 构建完整的文件路径
-	var fullPath string
+// storageAbsolutePath 相对路径拼接存储根目录
+func (s *ImageGenerationService) storageAbsolutePath(localPath string) string {
 	if filepath.IsAbs(localPath) {
-		fullPath = localPath
-	} else {
-		// 如果是相对路径，拼接存储根目录
-		if s.localStorage != nil {
-			fullPath = s.localStorage.GetAbsolutePath(localPath)
-		} else {
-			fullPath = filepath.Join(s.config.Storage.LocalPath, localPath)
-		}
+		return localPath
+	}
+	if s.localStorage != nil {
+		return s.localStorage.GetAbsolutePath(localPath)
 	}
+	return filepath.Join(s.config.Storage.LocalPath, localPath)
+}
+
+// loadImageAsBase64 读取本地图片文件并转换为 base64 格式的 data URI
+func (s *ImageGenerationService) loadImageAsBase64(localPath string) (string, error) {
+	fullPath := s.storageAbsolutePath(localPath)
 
 	// 读取文件
 	fileData, err := os.ReadFile(fullPath)
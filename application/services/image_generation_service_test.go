@@ -1,12 +1,15 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/infrastructure/database"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/logger"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	_ "modernc.org/sqlite"
@@ -225,6 +228,50 @@ func TestDispatchImageGeneration_PublishesMQJob(t *testing.T) {
 	}
 }
 
+func TestHandleImageResult_DispatchesDelayedPollAndStopsWhenCancelled(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.ImageGeneration{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+
+	imageGen := models.ImageGeneration{UserID: 1, Provider: "doubao", Prompt: "p", Status: models.ImageStatusProcessing}
+	if err := db.Create(&imageGen).Error; err != nil {
+		t.Fatalf("failed to seed image generation: %v", err)
+	}
+
+	dispatcher := &capturingDispatcher{}
+	svc := &ImageGenerationService{db: db, taskService: NewTaskService(db, log, NewTaskEventHub(), nil), log: log, runner: NewTaskRunner(log, 1), dispatcher: dispatcher}
+
+	if err := svc.handleImageResult(context.Background(), &imageGen, nil, nil, &image.ImageResult{TaskID: "img-task-1"}, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dispatcher.delayedJob.Type != JobTypeImagePollStatus || dispatcher.delay != imagePollInterval {
+		t.Fatalf("expected delayed image poll job, got %+v after %s", dispatcher.delayedJob, dispatcher.delay)
+	}
+	var payload ImagePollStatusJobPayload
+	if err := json.Unmarshal(dispatcher.delayedJob.Payload, &payload); err != nil {
+		t.Fatalf("unmarshal payload error: %v", err)
+	}
+	if payload.ImageGenerationID != imageGen.ID || payload.TaskID != "img-task-1" || payload.Attempt != 0 {
+		t.Fatalf("unexpected payload: %#v", payload)
+	}
+
+	var reloaded models.ImageGeneration
+	db.First(&reloaded, imageGen.ID)
+	if reloaded.TaskID == nil || *reloaded.TaskID != "img-task-1" {
+		t.Fatalf("expected provider task id to be saved, got %+v", reloaded.TaskID)
+	}
+
+	// 已取消的任务到期后不再续投轮询
+	db.Model(&models.ImageGeneration{}).Where("id = ?", imageGen.ID).Update("status", models.ImageStatusCancelled)
+	dispatcher.delayedJob = AsyncJob{}
+	svc.ProcessImagePollStatus(context.Background(), payload)
+	if dispatcher.delayedJob.Type != "" {
+		t.Fatalf("expected poll chain to stop, got job %+v", dispatcher.delayedJob)
+	}
+}
+
 func imageIntPtr(v int) *int {
 	return &v
 }
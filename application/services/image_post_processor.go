@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/storage"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/httpclient"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/imaging"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+const defaultThumbnailSize = 320
+
+// ProcessedImage 本地处理结果，处理失败的步骤保持原值
+type ProcessedImage struct {
+	LocalPath    *string // 无水印的工作图片，供参考图和视频首帧使用
+	OriginalPath *string // 图片被放大、裁切或转换格式时为处理前的原图，相对于私有目录
+	DeliveryPath *string // 加水印后的交付图片，没有水印时为 nil
+	DeliveryURL  *string
+	ThumbnailURL *string
+	Width        int // 处理后的尺寸，图片无法解码时为 0
+	Height       int
+}
+
+// ImagePostProcessor 图片和视频首帧落盘后的本地处理：放大、按视频画幅裁切或补边、水印、格式转换和缩略图
+type ImagePostProcessor struct {
+	db           *gorm.DB
+	localStorage *storage.LocalStorage
+	config       config.ImagingConfig
+	privateDir   string // 处理前原图的保存目录，不通过 /static 提供访问
+	log          *logger.Logger
+
+	mu         sync.Mutex
+	watermarks map[string]stdimage.Image // 按文件路径缓存解码后的水印图
+}
+
+func NewImagePostProcessor(db *gorm.DB, cfg *config.Config, localStorage *storage.LocalStorage, log *logger.Logger) *ImagePostProcessor {
+	var imagingConfig config.ImagingConfig
+	var privateDir string
+	if cfg != nil {
+		imagingConfig = cfg.Imaging
+		privateDir = privateStorageDir(cfg.Storage)
+	}
+	return &ImagePostProcessor{
+		db:           db,
+		localStorage: localStorage,
+		config:       imagingConfig,
+		privateDir:   privateDir,
+		log:          log,
+		watermarks:   make(map[string]stdimage.Image),
+	}
+}
+
+// Enabled 是否启用本地处理
+func (p *ImagePostProcessor) Enabled() bool {
+	return p != nil && !p.config.Disabled && p.localStorage != nil
+}
+
+// ProcessImageGeneration 处理刚生成的图片。未落盘的 data URI 先写入本地存储，放大、裁切或转换格式后的图片另存为新的本地文件，
+// 原图移到私有目录；水印只加在另存的交付图片上，本地文件保持无水印
+func (p *ImagePostProcessor) ProcessImageGeneration(imageGen *models.ImageGeneration, imageURL string, localPath *string) *ProcessedImage {
+	result := &ProcessedImage{LocalPath: localPath}
+	if !p.Enabled() {
+		return result
+	}
+
+	source := imageURL
+	if localPath != nil {
+		source = *localPath
+	} else if !strings.HasPrefix(imageURL, "data:") {
+		// 远程图片下载失败时不再重复下载
+		return result
+	}
+	data, err := p.loadSource(source)
+	if err != nil {
+		p.log.Warnw("Failed to read image for post-processing", "error", err, "id", imageGen.ID)
+		return result
+	}
+	if localPath == nil {
+		saved, err := p.localStorage.SaveWithPath(bytes.NewReader(data), "images", imageExt(data))
+		if err != nil {
+			p.log.Warnw("Failed to save image to local storage", "error", err, "id", imageGen.ID)
+			return result
+		}
+		result.LocalPath = &saved.RelativePath
+	}
+
+	img, format, err := imaging.Decode(data)
+	if err != nil {
+		p.log.Warnw("Skipping image post-processing for undecodable image", "error", err, "id", imageGen.ID)
+		return result
+	}
+
+	processed, changed := p.transform(imageGen, img)
+	if p.config.OutputFormat != "" {
+		if output, err := imaging.ParseFormat(p.config.OutputFormat); err != nil {
+			p.log.Warnw("Ignoring invalid imaging output format", "format", p.config.OutputFormat)
+		} else if output != format {
+			format, changed = output, true
+		}
+	}
+	if changed {
+		if saved, err := p.saveImage(processed, "images", format); err != nil {
+			p.log.Warnw("Failed to save processed image", "error", err, "id", imageGen.ID)
+			processed = img
+		} else {
+			result.OriginalPath = p.keepOriginal(imageGen, *result.LocalPath, data)
+			result.LocalPath = &saved.RelativePath
+		}
+	}
+
+	result.Width, result.Height = processed.Bounds().Dx(), processed.Bounds().Dy()
+	// 单格拼图后统一加水印
+	if wm, ok := p.watermark(imageGen.UserID); ok && !isPanelImage(imageGen) {
+		delivered := imaging.ApplyWatermark(processed, wm)
+		if saved, err := p.saveImage(delivered, "images", format); err != nil {
+			p.log.Warnw("Failed to save watermarked image", "error", err, "id", imageGen.ID)
+		} else {
+			result.DeliveryPath, result.DeliveryURL = &saved.RelativePath, &saved.URL
+			processed = delivered
+		}
+	}
+	if thumbnailURL, err := p.thumbnail(processed); err != nil {
+		p.log.Warnw("Failed to create image thumbnail", "error", err, "id", imageGen.ID)
+	} else {
+		result.ThumbnailURL = &thumbnailURL
+	}
+	return result
+}
+
+// Thumbnail 为本地路径、data URI 或远程地址的图片生成缩略图，返回缩略图URL
+func (p *ImagePostProcessor) Thumbnail(source string) (string, error) {
+	if !p.Enabled() {
+		return "", fmt.Errorf("image processing disabled")
+	}
+	data, err := p.loadSource(source)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return "", err
+	}
+	return p.thumbnail(img)
+}
+
+// transform 依次放大和调整分镜画幅，返回是否有改动
+func (p *ImagePostProcessor) transform(imageGen *models.ImageGeneration, img stdimage.Image) (stdimage.Image, bool) {
+	changed := false
+	if p.config.MinSide > 0 {
+		if upscaled := imaging.Upscale(img, p.config.MinSide); upscaled != img {
+			img, changed = upscaled, true
+		}
+	}
+
+	if ratio := p.targetAspect(imageGen); ratio != "" {
+		ratioW, ratioH, _ := imaging.ParseAspectRatio(ratio)
+		before := img.Bounds().Size()
+		if p.config.AspectMode == "pad" {
+			img = imaging.PadToAspect(img, ratioW, ratioH, color.Black)
+		} else {
+			img = imaging.CropToAspect(img, ratioW, ratioH)
+		}
+		changed = changed || img.Bounds().Size() != before
+	}
+	return img, changed
+}
+
+// keepOriginal 处理前的原图移到私有目录，公开存储中只留处理后的图片，未配置私有目录时不保留
+func (p *ImagePostProcessor) keepOriginal(imageGen *models.ImageGeneration, publicPath string, data []byte) *string {
+	if err := os.Remove(p.localStorage.GetAbsolutePath(publicPath)); err != nil && !os.IsNotExist(err) {
+		p.log.Warnw("Failed to remove public original image", "error", err, "id", imageGen.ID)
+	}
+	if p.privateDir == "" {
+		return nil
+	}
+	relativePath := filepath.Join("originals", filepath.Base(publicPath))
+	fullPath := filepath.Join(p.privateDir, relativePath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		p.log.Warnw("Failed to create original image directory", "error", err, "id", imageGen.ID)
+		return nil
+	}
+	if err := os.WriteFile(fullPath, data, 0644); err != nil {
+		p.log.Warnw("Failed to keep original image", "error", err, "id", imageGen.ID)
+		return nil
+	}
+	return &relativePath
+}
+
+// targetAspect 分镜图的目标画幅：该分镜最近一次视频生成的画幅，没有时使用配置。多格分镜板、拼图和扩图不处理
+func (p *ImagePostProcessor) targetAspect(imageGen *models.ImageGeneration) string {
+	if imageGen.StoryboardID == nil || imageGen.ImageType != string(models.ImageTypeStoryboard) {
+		return ""
+	}
+	if imageGen.FrameType != nil && (*imageGen.FrameType == models.FrameTypePanel || *imageGen.FrameType == models.FrameTypeAction) {
+		return ""
+	}
+	if imageGen.Operation != nil && (*imageGen.Operation == string(image.EditOutpaint) || *imageGen.Operation == imageOperationComposite) {
+		return ""
+	}
+
+	var videoGen models.VideoGeneration
+	err := p.db.Where("storyboard_id = ? AND aspect_ratio IS NOT NULL AND aspect_ratio <> ''", *imageGen.StoryboardID).
+		Order("id DESC").First(&videoGen).Error
+	if err == nil {
+		if _, _, err := imaging.ParseAspectRatio(*videoGen.AspectRatio); err == nil {
+			return *videoGen.AspectRatio
+		}
+	}
+	if _, _, err := imaging.ParseAspectRatio(p.config.AspectRatio); err == nil {
+		return p.config.AspectRatio
+	}
+	return ""
+}
+
+// watermark 用户的租户水印优先，其次是默认水印
+func (p *ImagePostProcessor) watermark(userID uint) (imaging.Watermark, bool) {
+	cfg := p.config.Watermark
+	if tenantCfg, ok := p.config.TenantWatermarks[strconv.FormatUint(uint64(userID), 10)]; ok {
+		cfg = tenantCfg
+	}
+	if cfg.Disabled || cfg.ImagePath == "" {
+		return imaging.Watermark{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mark, ok := p.watermarks[cfg.ImagePath]
+	if !ok {
+		data, err := os.ReadFile(cfg.ImagePath)
+		if err == nil {
+			mark, _, err = imaging.Decode(data)
+		}
+		if err != nil {
+			p.log.Warnw("Failed to load watermark image", "error", err, "path", cfg.ImagePath)
+			return imaging.Watermark{}, false
+		}
+		p.watermarks[cfg.ImagePath] = mark
+	}
+	return imaging.Watermark{
+		Mark:     mark,
+		Position: imaging.Position(cfg.Position),
+		Opacity:  cfg.Opacity,
+		Scale:    cfg.Scale,
+	}, true
+}
+
+func (p *ImagePostProcessor) thumbnail(img stdimage.Image) (string, error) {
+	size := p.config.ThumbnailSize
+	if size <= 0 {
+		size = defaultThumbnailSize
+	}
+	format := imaging.FormatJPEG
+	if p.config.ThumbnailFormat != "" {
+		if parsed, err := imaging.ParseFormat(p.config.ThumbnailFormat); err == nil {
+			format = parsed
+		}
+	}
+	saved, err := p.saveImage(imaging.Thumbnail(img, size), "thumbnails", format)
+	if err != nil {
+		return "", err
+	}
+	return saved.URL, nil
+}
+
+func (p *ImagePostProcessor) saveImage(img stdimage.Image, category string, format imaging.Format) (*storage.DownloadResult, error) {
+	data, err := imaging.EncodeBytes(img, format)
+	if err != nil {
+		return nil, err
+	}
+	return p.localStorage.SaveWithPath(bytes.NewReader(data), category, format.Ext())
+}
+
+// loadSource 读取 data URI、远程地址或本地存储中的图片
+func (p *ImagePostProcessor) loadSource(source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, "data:"):
+		return decodeBase64Image(source)
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		resp, err := httpclient.Default().Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("download image: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("download image failed with status: %d", resp.StatusCode)
+		}
+		return readImageBody(resp.Body)
+	}
+	if !filepath.IsAbs(source) {
+		source = p.localStorage.GetAbsolutePath(source)
+	}
+	return os.ReadFile(source)
+}
+
+// imageExt 按文件内容推断扩展名
+func imageExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".png"
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/storage"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func encodeTestPNG(t *testing.T, width, height int, c color.NRGBA) []byte {
+	t.Helper()
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImagePostProcessor_CropsWatermarksAndThumbnails(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.VideoGeneration{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	dir := t.TempDir()
+	localStorage, err := storage.NewLocalStorage(filepath.Join(dir, "storage"), "http://localhost/static")
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	watermarkPath := filepath.Join(dir, "logo.png")
+	if err := os.WriteFile(watermarkPath, encodeTestPNG(t, 10, 10, color.NRGBA{R: 255, A: 255}), 0644); err != nil {
+		t.Fatalf("failed to write watermark: %v", err)
+	}
+
+	privateDir := filepath.Join(dir, "private")
+	cfg := &config.Config{
+		Storage: config.StorageConfig{LocalPath: filepath.Join(dir, "storage"), PrivatePath: privateDir},
+		Imaging: config.ImagingConfig{
+			ThumbnailSize:    64,
+			ThumbnailFormat:  "webp",
+			Watermark:        config.WatermarkConfig{ImagePath: watermarkPath, Opacity: 1},
+			TenantWatermarks: map[string]config.WatermarkConfig{"2": {Disabled: true}},
+		},
+	}
+	processor := NewImagePostProcessor(db, cfg, localStorage, logger.NewLogger(true))
+
+	storyboardID := uint(7)
+	aspect := "9:16"
+	if err := db.Create(&models.VideoGeneration{UserID: 1, StoryboardID: &storyboardID, DramaID: 1, Provider: "doubao", Prompt: "镜头", AspectRatio: &aspect}).Error; err != nil {
+		t.Fatalf("failed to create video generation: %v", err)
+	}
+
+	source := "data:image/png;base64," + base64.StdEncoding.EncodeToString(encodeTestPNG(t, 320, 180, color.NRGBA{B: 255, A: 255}))
+	storyboardImage := &models.ImageGeneration{ID: 1, UserID: 1, StoryboardID: &storyboardID, ImageType: string(models.ImageTypeStoryboard)}
+	processed := processor.ProcessImageGeneration(storyboardImage, source, nil)
+	if processed.OriginalPath == nil || processed.LocalPath == nil || processed.DeliveryPath == nil || processed.DeliveryURL == nil {
+		t.Fatalf("expected processed copy, private original and watermarked delivery, got %+v", processed)
+	}
+	if processed.Width != 101 || processed.Height != 180 {
+		t.Fatalf("expected crop to the storyboard video aspect, got %dx%d", processed.Width, processed.Height)
+	}
+	if _, err := os.Stat(filepath.Join(privateDir, *processed.OriginalPath)); err != nil {
+		t.Fatalf("expected original kept in private storage: %v", err)
+	}
+	if _, err := os.Stat(localStorage.GetAbsolutePath(*processed.OriginalPath)); !os.IsNotExist(err) {
+		t.Fatalf("expected original removed from public storage, got %v", err)
+	}
+
+	// 本地工作图片不带水印，交付图片右下角有水印
+	working := decodeTestPNGFile(t, localStorage.GetAbsolutePath(*processed.LocalPath))
+	if r, _, b, _ := working.At(90, 170).RGBA(); r != 0 || b>>8 != 255 {
+		t.Fatalf("expected local image without watermark")
+	}
+	delivered := decodeTestPNGFile(t, localStorage.GetAbsolutePath(*processed.DeliveryPath))
+	if r, _, b, _ := delivered.At(90, 170).RGBA(); r>>8 != 255 || b != 0 {
+		t.Fatalf("expected watermark in the bottom right corner of the delivery image")
+	}
+	if !strings.HasPrefix(*processed.DeliveryURL, "http://localhost/static/images/") {
+		t.Fatalf("unexpected delivery url: %s", *processed.DeliveryURL)
+	}
+	if processed.ThumbnailURL == nil || !strings.HasPrefix(*processed.ThumbnailURL, "http://localhost/static/thumbnails/") || !strings.HasSuffix(*processed.ThumbnailURL, ".webp") {
+		t.Fatalf("unexpected thumbnail url: %v", processed.ThumbnailURL)
+	}
+
+	// 关闭水印的租户、非分镜图片只生成缩略图
+	saved, err := localStorage.SaveWithPath(bytes.NewReader(encodeTestPNG(t, 320, 180, color.NRGBA{B: 255, A: 255})), "images", ".png")
+	if err != nil {
+		t.Fatalf("failed to save source image: %v", err)
+	}
+	localPath := saved.RelativePath
+	characterImage := &models.ImageGeneration{ID: 2, UserID: 2, ImageType: string(models.ImageTypeCharacter)}
+	processed = processor.ProcessImageGeneration(characterImage, "https://cdn/a.png", &localPath)
+	if processed.OriginalPath != nil || processed.DeliveryPath != nil || *processed.LocalPath != localPath || processed.Width != 320 || processed.ThumbnailURL == nil {
+		t.Fatalf("expected only a thumbnail, got %+v", processed)
+	}
+
+	if _, err := processor.Thumbnail(localPath); err != nil {
+		t.Fatalf("failed to create thumbnail from local path: %v", err)
+	}
+	if NewImagePostProcessor(db, &config.Config{Imaging: config.ImagingConfig{Disabled: true}}, localStorage, logger.NewLogger(true)).Enabled() {
+		t.Fatalf("expected disabled processor")
+	}
+}
+
+func decodeTestPNGFile(t *testing.T, path string) stdimage.Image {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected png image: %v", err)
+	}
+	return img
+}
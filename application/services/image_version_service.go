@@ -0,0 +1,306 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownImageEntity   = errors.New("unknown image entity type")
+	ErrImageEntityNotFound  = errors.New("image entity not found")
+	ErrImageVersionNotFound = errors.New("image version not found")
+)
+
+// ImageVersion 实体的一个历史图片版本
+type ImageVersion struct {
+	Version           int        `json:"version"` // 从 1 开始，按生成顺序递增
+	ImageGenerationID uint       `json:"image_generation_id"`
+	ParentID          *uint      `json:"parent_id,omitempty"`
+	Operation         *string    `json:"operation,omitempty"`
+	FrameType         *string    `json:"frame_type,omitempty"`
+	Prompt            string     `json:"prompt"`
+	NegativePrompt    *string    `json:"negative_prompt,omitempty"`
+	Seed              *int64     `json:"seed,omitempty"`
+	Provider          string     `json:"provider"`
+	Model             string     `json:"model"`
+	Size              string     `json:"size"`
+	Width             *int       `json:"width,omitempty"`
+	Height            *int       `json:"height,omitempty"`
+	ImageURL          *string    `json:"image_url,omitempty"`
+	LocalPath         *string    `json:"local_path,omitempty"`
+	IsCurrent         bool       `json:"is_current"`
+	CreatedAt         time.Time  `json:"created_at"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+}
+
+// ImageVersionHistory 实体的全部已完成图片，新版本在前
+type ImageVersionHistory struct {
+	EntityType     string         `json:"entity_type"`
+	EntityID       uint           `json:"entity_id"`
+	CurrentImageID *uint          `json:"current_image_id,omitempty"`
+	Versions       []ImageVersion `json:"versions"`
+}
+
+// ImageVersionComparison 对比视图数据，ChangedFields 为各版本取值不同的生成参数
+type ImageVersionComparison struct {
+	EntityType    string         `json:"entity_type"`
+	EntityID      uint           `json:"entity_id"`
+	Versions      []ImageVersion `json:"versions"`
+	ChangedFields []string       `json:"changed_fields"`
+}
+
+// imageEntity 角色、场景、道具或分镜当前使用的图片
+type imageEntity struct {
+	entityType string
+	id         uint
+	model      interface{}
+	current    *uint
+	imageURL   *string
+	localPath  *string
+}
+
+// ImageVersionService 角色、场景、道具和分镜的图片版本历史与回退
+type ImageVersionService struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+func NewImageVersionService(db *gorm.DB, log *logger.Logger) *ImageVersionService {
+	return &ImageVersionService{db: db, log: log}
+}
+
+// ListVersions 列出实体的全部历史图片及其提示词、seed
+func (s *ImageVersionService) ListVersions(userID uint, entityType string, entityID uint) (*ImageVersionHistory, error) {
+	entity, err := s.loadEntity(userID, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.versions(userID, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &ImageVersionHistory{EntityType: entityType, EntityID: entityID, Versions: make([]ImageVersion, 0, len(versions))}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].IsCurrent {
+			id := versions[i].ImageGenerationID
+			history.CurrentImageID = &id
+		}
+		history.Versions = append(history.Versions, versions[i])
+	}
+	return history, nil
+}
+
+// Revert 把实体的图片切换回指定的历史版本
+func (s *ImageVersionService) Revert(userID uint, entityType string, entityID uint, imageGenID uint) (*ImageVersionHistory, error) {
+	entity, err := s.loadEntity(userID, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	var imageGen models.ImageGeneration
+	err = s.versionQuery(userID, entity).Where("id = ?", imageGenID).First(&imageGen).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImageVersionNotFound
+		}
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"current_image_id": imageGen.ID}
+	switch entityType {
+	case string(models.ImageTypeStoryboard):
+		updates["composed_image"] = imageGen.ImageURL
+	case string(models.ImageTypeScene):
+		updates["status"] = "generated"
+		fallthrough
+	default:
+		// 本地文件优先作为参考图，必须随版本一起切换
+		updates["image_url"] = imageGen.ImageURL
+		updates["local_path"] = imageGen.LocalPath
+	}
+	if err := s.db.Model(entity.model).Where("id = ?", entity.id).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to revert image: %w", err)
+	}
+
+	s.log.Infow("Image version reverted", "entity_type", entityType, "entity_id", entityID, "image_generation_id", imageGen.ID)
+	return s.ListVersions(userID, entityType, entityID)
+}
+
+// Compare 对比指定的历史版本，未指定时对比当前版本和它的上一个版本
+func (s *ImageVersionService) Compare(userID uint, entityType string, entityID uint, imageGenIDs []uint) (*ImageVersionComparison, error) {
+	entity, err := s.loadEntity(userID, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.versions(userID, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &ImageVersionComparison{EntityType: entityType, EntityID: entityID, Versions: []ImageVersion{}, ChangedFields: []string{}}
+	if len(imageGenIDs) == 0 {
+		current := len(versions) - 1
+		for i, version := range versions {
+			if version.IsCurrent {
+				current = i
+			}
+		}
+		for i := current - 1; i <= current; i++ {
+			if i >= 0 {
+				comparison.Versions = append(comparison.Versions, versions[i])
+			}
+		}
+	} else {
+		byID := make(map[uint]ImageVersion, len(versions))
+		for _, version := range versions {
+			byID[version.ImageGenerationID] = version
+		}
+		for _, id := range imageGenIDs {
+			version, ok := byID[id]
+			if !ok {
+				return nil, ErrImageVersionNotFound
+			}
+			comparison.Versions = append(comparison.Versions, version)
+		}
+	}
+
+	fields := []struct {
+		name  string
+		value func(ImageVersion) string
+	}{
+		{"prompt", func(v ImageVersion) string { return v.Prompt }},
+		{"negative_prompt", func(v ImageVersion) string { return derefString(v.NegativePrompt) }},
+		{"seed", func(v ImageVersion) string {
+			if v.Seed == nil {
+				return ""
+			}
+			return fmt.Sprint(*v.Seed)
+		}},
+		{"provider", func(v ImageVersion) string { return v.Provider }},
+		{"model", func(v ImageVersion) string { return v.Model }},
+		{"size", func(v ImageVersion) string { return v.Size }},
+		{"operation", func(v ImageVersion) string { return derefString(v.Operation) }},
+		{"frame_type", func(v ImageVersion) string { return derefString(v.FrameType) }},
+	}
+	for _, field := range fields {
+		for i := 1; i < len(comparison.Versions); i++ {
+			if field.value(comparison.Versions[i]) != field.value(comparison.Versions[0]) {
+				comparison.ChangedFields = append(comparison.ChangedFields, field.name)
+				break
+			}
+		}
+	}
+	return comparison, nil
+}
+
+func (s *ImageVersionService) loadEntity(userID uint, entityType string, entityID uint) (*imageEntity, error) {
+	entity := &imageEntity{entityType: entityType, id: entityID}
+	var err error
+	switch entityType {
+	case string(models.ImageTypeCharacter):
+		var character models.Character
+		err = s.db.Where("id = ? AND user_id = ?", entityID, userID).First(&character).Error
+		entity.model, entity.current, entity.imageURL, entity.localPath = &models.Character{}, character.CurrentImageID, character.ImageURL, character.LocalPath
+	case string(models.ImageTypeScene):
+		var scene models.Scene
+		err = s.db.Where("id = ? AND user_id = ?", entityID, userID).First(&scene).Error
+		entity.model, entity.current, entity.imageURL, entity.localPath = &models.Scene{}, scene.CurrentImageID, scene.ImageURL, scene.LocalPath
+	case string(models.ImageTypeProp):
+		var prop models.Prop
+		err = s.db.Where("id = ? AND user_id = ?", entityID, userID).First(&prop).Error
+		entity.model, entity.current, entity.imageURL, entity.localPath = &models.Prop{}, prop.CurrentImageID, prop.ImageURL, prop.LocalPath
+	case string(models.ImageTypeStoryboard):
+		var storyboard models.Storyboard
+		err = s.db.Where("id = ? AND user_id = ?", entityID, userID).First(&storyboard).Error
+		entity.model, entity.current, entity.imageURL = &models.Storyboard{}, storyboard.CurrentImageID, storyboard.ComposedImage
+	default:
+		return nil, ErrUnknownImageEntity
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImageEntityNotFound
+		}
+		return nil, err
+	}
+	return entity, nil
+}
+
+// versionQuery 与 completeImageGeneration 同步实体图片的条件一致
+func (s *ImageVersionService) versionQuery(userID uint, entity *imageEntity) *gorm.DB {
+	// 拼图的单格不作为独立版本
+	query := s.db.Model(&models.ImageGeneration{}).
+		Where("user_id = ? AND status = ? AND image_url IS NOT NULL AND image_url <> ''", userID, models.ImageStatusCompleted).
+		Where("operation IS NULL OR operation <> ?", imageOperationPanel)
+	switch entity.entityType {
+	case string(models.ImageTypeCharacter):
+		query = query.Where("character_id = ?", entity.id)
+	case string(models.ImageTypeScene):
+		query = query.Where("scene_id = ? AND image_type = ?", entity.id, models.ImageTypeScene)
+	case string(models.ImageTypeProp):
+		query = query.Where("prop_id = ?", entity.id)
+	case string(models.ImageTypeStoryboard):
+		query = query.Where("storyboard_id = ?", entity.id)
+	}
+	return query
+}
+
+// versions 按生成顺序返回历史版本并标记当前版本
+func (s *ImageVersionService) versions(userID uint, entity *imageEntity) ([]ImageVersion, error) {
+	var generations []models.ImageGeneration
+	if err := s.versionQuery(userID, entity).Order("id ASC").Find(&generations).Error; err != nil {
+		return nil, err
+	}
+
+	versions := make([]ImageVersion, 0, len(generations))
+	pointed, matched := -1, -1
+	for i, gen := range generations {
+		versions = append(versions, ImageVersion{
+			Version:           i + 1,
+			ImageGenerationID: gen.ID,
+			ParentID:          gen.ParentID,
+			Operation:         gen.Operation,
+			FrameType:         gen.FrameType,
+			Prompt:            gen.Prompt,
+			NegativePrompt:    gen.NegPrompt,
+			Seed:              gen.Seed,
+			Provider:          gen.Provider,
+			Model:             gen.Model,
+			Size:              gen.Size,
+			Width:             gen.Width,
+			Height:            gen.Height,
+			ImageURL:          gen.ImageURL,
+			LocalPath:         gen.LocalPath,
+			CreatedAt:         gen.CreatedAt,
+			CompletedAt:       gen.CompletedAt,
+		})
+		if !entity.usesImage(&gen) {
+			continue
+		}
+		if entity.current != nil && *entity.current == gen.ID {
+			pointed = i
+		}
+		matched = i
+	}
+	// 指针所指的版本优先；指针为空（旧数据）时按图片地址匹配最新的版本，图片在别处被替换后没有当前版本
+	current := matched
+	if pointed >= 0 {
+		current = pointed
+	}
+	if current >= 0 {
+		versions[current].IsCurrent = true
+	}
+	return versions, nil
+}
+
+// usesImage 实体当前的图片是否来自该次生成
+func (e *imageEntity) usesImage(gen *models.ImageGeneration) bool {
+	if e.localPath != nil && *e.localPath != "" && gen.LocalPath != nil && *gen.LocalPath == *e.localPath {
+		return true
+	}
+	return e.imageURL != nil && gen.ImageURL != nil && *gen.ImageURL == *e.imageURL
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func TestImageVersionService_ListsRevertsAndCompares(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.Character{}, &models.ImageGeneration{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	svc := NewImageVersionService(db, logger.NewLogger(true))
+
+	character := models.Character{UserID: 1, DramaID: 1, Name: "林"}
+	if err := db.Create(&character).Error; err != nil {
+		t.Fatalf("failed to create character: %v", err)
+	}
+	var generations []models.ImageGeneration
+	for i, prompt := range []string{"初版", "换发型", "换发型"} {
+		seed := int64(100 + i)
+		gen := models.ImageGeneration{UserID: 1, CharacterID: &character.ID, ImageType: string(models.ImageTypeCharacter), Provider: "openai",
+			Prompt: prompt, Model: "gpt-image-1", Seed: &seed, Status: models.ImageStatusCompleted,
+			ImageURL: strPtr(fmt.Sprintf("https://cdn/v%d.png", i+1)), LocalPath: strPtr(fmt.Sprintf("images/v%d.png", i+1))}
+		if err := db.Create(&gen).Error; err != nil {
+			t.Fatalf("failed to create generation: %v", err)
+		}
+		generations = append(generations, gen)
+	}
+	failed := models.ImageGeneration{UserID: 1, CharacterID: &character.ID, Provider: "openai", Prompt: "失败", Status: models.ImageStatusFailed}
+	db.Create(&failed)
+	// 旧数据没有指针，按图片地址识别当前版本
+	db.Model(&character).Updates(map[string]interface{}{"image_url": "https://cdn/v3.png", "local_path": "images/v3.png"})
+
+	history, err := svc.ListVersions(1, "character", character.ID)
+	if err != nil {
+		t.Fatalf("failed to list versions: %v", err)
+	}
+	if len(history.Versions) != 3 || history.Versions[0].Version != 3 || !history.Versions[0].IsCurrent ||
+		history.CurrentImageID == nil || *history.CurrentImageID != generations[2].ID {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	history, err = svc.Revert(1, "character", character.ID, generations[0].ID)
+	if err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+	db.First(&character, character.ID)
+	if *character.CurrentImageID != generations[0].ID || *character.ImageURL != "https://cdn/v1.png" || *character.LocalPath != "images/v1.png" {
+		t.Fatalf("expected character to use the first version, got %+v", character)
+	}
+	if !history.Versions[2].IsCurrent || history.Versions[0].IsCurrent {
+		t.Fatalf("expected reverted version to be current, got %+v", history.Versions)
+	}
+	if _, err := svc.Revert(1, "character", character.ID, failed.ID); !errors.Is(err, ErrImageVersionNotFound) {
+		t.Fatalf("expected failed generation to be rejected, got %v", err)
+	}
+	if _, err := svc.ListVersions(2, "character", character.ID); !errors.Is(err, ErrImageEntityNotFound) {
+		t.Fatalf("expected other users' characters to be hidden, got %v", err)
+	}
+	if _, err := svc.ListVersions(1, "episode", character.ID); !errors.Is(err, ErrUnknownImageEntity) {
+		t.Fatalf("expected unknown entity type, got %v", err)
+	}
+
+	comparison, err := svc.Compare(1, "character", character.ID, []uint{generations[1].ID, generations[2].ID})
+	if err != nil {
+		t.Fatalf("failed to compare: %v", err)
+	}
+	if got := strings.Join(comparison.ChangedFields, ","); got != "seed" {
+		t.Fatalf("expected only the seed to differ, got %s", got)
+	}
+	comparison, err = svc.Compare(1, "character", character.ID, nil)
+	if err != nil {
+		t.Fatalf("failed to compare: %v", err)
+	}
+	if len(comparison.Versions) != 1 || comparison.Versions[0].ImageGenerationID != generations[0].ID {
+		t.Fatalf("expected the first version to have nothing before it, got %+v", comparison.Versions)
+	}
+}
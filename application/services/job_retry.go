@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/config"
+)
+
+// JobRetryPolicy 任务失败后的重试策略，重试通过延迟队列按指数退避投递
+type JobRetryPolicy struct {
+	MaxAttempts    int // 含首次执行在内的最大执行次数，<=1 表示不重试
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Retryable 判断错误是否可重试，为空时使用 IsRetryableJobError
+	Retryable func(error) bool
+}
+
+// defaultJobRetryPolicy 没有单独策略的任务类型，临时性错误同样重试
+var defaultJobRetryPolicy = JobRetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Second, MaxBackoff: 2 * time.Minute, Multiplier: 2}
+
+// builtinJobRetryPolicies 各任务类型的内置重试策略，可被配置 job_retry.job_types 覆盖
+func builtinJobRetryPolicies() map[string]JobRetryPolicy {
+	textPolicy := JobRetryPolicy{MaxAttempts: 3, InitialBackoff: 20 * time.Second, MaxBackoff: 2 * time.Minute, Multiplier: 2}
+	audioPolicy := JobRetryPolicy{MaxAttempts: 3, InitialBackoff: 15 * time.Second, MaxBackoff: 2 * time.Minute, Multiplier: 2}
+	return map[string]JobRetryPolicy{
+		JobTypeImageGeneration:     {MaxAttempts: 4, InitialBackoff: 10 * time.Second, MaxBackoff: 2 * time.Minute, Multiplier: 2},
+		JobTypeVideoGeneration:     {MaxAttempts: 4, InitialBackoff: 15 * time.Second, MaxBackoff: 5 * time.Minute, Multiplier: 2},
+		JobTypeStoryboard:          textPolicy,
+		JobTypeCharacterExtraction: textPolicy,
+		JobTypePropExtraction:      textPolicy,
+		JobTypeVoiceOver:           audioPolicy,
+		JobTypeEpisodeScore:        audioPolicy,
+		JobTypeTimelineRender:      {MaxAttempts: 2, InitialBackoff: 30 * time.Second, MaxBackoff: 2 * time.Minute, Multiplier: 2},
+		JobTypeWebhookDelivery:     {MaxAttempts: 6, InitialBackoff: 30 * time.Second, MaxBackoff: 30 * time.Minute, Multiplier: 3},
+	}
+}
+
+// JobRetryPolicies 按任务类型的重试策略，由内置默认和配置合并而成
+type JobRetryPolicies struct {
+	defaultPolicy JobRetryPolicy
+	byType        map[string]JobRetryPolicy
+}
+
+// NewJobRetryPolicies 以内置策略为基础应用配置，配置中为 0 的字段沿用内置值
+func NewJobRetryPolicies(cfg config.JobRetryConfig) *JobRetryPolicies {
+	policies := &JobRetryPolicies{
+		defaultPolicy: applyJobRetryConfig(defaultJobRetryPolicy, cfg.Default),
+		byType:        builtinJobRetryPolicies(),
+	}
+	for _, override := range cfg.JobTypes {
+		if override.JobType == "" {
+			continue
+		}
+		base, ok := policies.byType[override.JobType]
+		if !ok {
+			base = policies.defaultPolicy
+		}
+		policies.byType[override.JobType] = applyJobRetryConfig(base, override)
+	}
+	return policies
+}
+
+func applyJobRetryConfig(policy JobRetryPolicy, cfg config.JobRetryPolicyConfig) JobRetryPolicy {
+	if cfg.MaxAttempts > 0 {
+		policy.MaxAttempts = cfg.MaxAttempts
+	}
+	if cfg.InitialBackoffSeconds > 0 {
+		policy.InitialBackoff = time.Duration(cfg.InitialBackoffSeconds) * time.Second
+	}
+	if cfg.MaxBackoffSeconds > 0 {
+		policy.MaxBackoff = time.Duration(cfg.MaxBackoffSeconds) * time.Second
+	}
+	if cfg.Multiplier > 0 {
+		policy.Multiplier = cfg.Multiplier
+	}
+	return policy
+}
+
+// ForJob 返回任务类型对应的重试策略，未单独配置的任务类型使用默认策略
+func (p *JobRetryPolicies) ForJob(jobType string) JobRetryPolicy {
+	if p == nil {
+		p = NewJobRetryPolicies(config.JobRetryConfig{})
+	}
+	if policy, ok := p.byType[jobType]; ok {
+		return policy
+	}
+	return p.defaultPolicy
+}
+
+// ShouldRetry 第 attempt 次执行（从 1 开始）失败后是否还应重试
+func (p JobRetryPolicy) ShouldRetry(attempt int, err error) bool {
+	if err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableJobError(err)
+}
+
+// Backoff 第 attempt 次执行失败后到下一次执行的等待时间
+func (p JobRetryPolicy) Backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = 5 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	backoff := time.Duration(float64(initial) * math.Pow(multiplier, float64(attempt-1)))
+	if p.MaxBackoff > 0 && (backoff > p.MaxBackoff || backoff <= 0) {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// RetryableError 显式标记为可重试的错误
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// MarkRetryable 将错误标记为可重试
+func MarkRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+var httpStatusPattern = regexp.MustCompile(`status:? (\d{3})`)
+
+// IsRetryableJobError 判断错误是否为临时性错误：网络超时、连接中断、限流与服务商 5xx
+func IsRetryableJobError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrTaskCancelled) {
+		return false
+	}
+
+	var retryable *RetryableError
+	if errors.As(err, &retryable) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	if match := httpStatusPattern.FindStringSubmatch(msg); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		return code == 408 || code == 429 || code >= 500
+	}
+	for _, keyword := range []string{"timeout", "connection reset", "connection refused", "broken pipe", "unexpected eof", "too many requests"} {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+type jobAttemptKey struct{}
+
+type jobAttempt struct {
+	Attempt int
+	Policy  JobRetryPolicy
+}
+
+// withJobAttempt 将当前执行次数与重试策略写入 context，供任务处理函数判断失败后是否还会重试
+func withJobAttempt(ctx context.Context, attempt int, policy JobRetryPolicy) context.Context {
+	return context.WithValue(ctx, jobAttemptKey{}, jobAttempt{Attempt: attempt, Policy: policy})
+}
+
+// willRetryJob 当前任务失败后是否会被任务总线重试
+// 本地 runner 执行的任务没有重试信息，始终视为最后一次执行
+func willRetryJob(ctx context.Context, err error) bool {
+	state, ok := ctx.Value(jobAttemptKey{}).(jobAttempt)
+	if !ok {
+		return false
+	}
+	return state.Policy.ShouldRetry(state.Attempt, err)
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/config"
+)
+
+func TestJobRetryPolicy_BackoffIsExponentialAndCapped(t *testing.T) {
+	policy := JobRetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Second, MaxBackoff: 30 * time.Second, Multiplier: 2}
+
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second}
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Fatalf("attempt %d: expected backoff %s, got %s", i+1, want, got)
+		}
+	}
+}
+
+func TestJobRetryPolicy_ShouldRetry(t *testing.T) {
+	policy := NewJobRetryPolicies(config.JobRetryConfig{}).ForJob(JobTypeImageGeneration)
+	transient := errors.New("API returned status 503: upstream unavailable")
+
+	if !policy.ShouldRetry(1, transient) {
+		t.Fatalf("expected transient error to be retried on first attempt")
+	}
+	if policy.ShouldRetry(policy.MaxAttempts, transient) {
+		t.Fatalf("expected no retry after max attempts")
+	}
+	if policy.ShouldRetry(1, errors.New("API returned status 400: invalid prompt")) {
+		t.Fatalf("expected client error not to be retried")
+	}
+}
+
+func TestJobRetryPolicies_RetriesEveryAIJobAndAppliesConfig(t *testing.T) {
+	transient := errors.New("API error (status 502): bad gateway")
+	defaults := NewJobRetryPolicies(config.JobRetryConfig{})
+	for _, jobType := range []string{JobTypeImageGeneration, JobTypeVideoGeneration, JobTypeStoryboard, JobTypeCharacterExtraction,
+		JobTypePropExtraction, JobTypeVoiceOver, JobTypeEpisodeScore, JobTypeTimelineRender, "unknown_job"} {
+		if !defaults.ForJob(jobType).ShouldRetry(1, transient) {
+			t.Fatalf("expected %s to retry a transient provider error", jobType)
+		}
+	}
+
+	policies := NewJobRetryPolicies(config.JobRetryConfig{
+		Default: config.JobRetryPolicyConfig{MaxAttempts: 5},
+		JobTypes: []config.JobRetryPolicyConfig{
+			{JobType: JobTypeStoryboard, MaxAttempts: 1},
+			{JobType: JobTypeVoiceOver, InitialBackoffSeconds: 3},
+			{JobType: "custom_job.process", MaxBackoffSeconds: 60},
+		},
+	})
+	if policies.ForJob(JobTypeStoryboard).ShouldRetry(1, transient) {
+		t.Fatalf("expected configured max_attempts 1 to disable retries")
+	}
+	voiceOver := policies.ForJob(JobTypeVoiceOver)
+	if voiceOver.InitialBackoff != 3*time.Second || voiceOver.MaxAttempts != defaults.ForJob(JobTypeVoiceOver).MaxAttempts {
+		t.Fatalf("expected override to keep unset fields from the builtin policy, got %+v", voiceOver)
+	}
+	if custom := policies.ForJob("custom_job.process"); custom.MaxAttempts != 5 || custom.MaxBackoff != time.Minute {
+		t.Fatalf("expected new job type to start from the configured default, got %+v", custom)
+	}
+	if policies.ForJob("unknown_job").MaxAttempts != 5 {
+		t.Fatalf("expected configured default for unlisted job types")
+	}
+}
+
+func TestIsRetryableJobError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("API error (status 429): rate limited"), true},
+		{errors.New("request failed: dial tcp: i/o timeout"), true},
+		{fmt.Errorf("call provider: %w", context.DeadlineExceeded), true},
+		{MarkRetryable(errors.New("provider busy")), true},
+		{errors.New("API error (status 401): unauthorized"), false},
+		{errors.New("content violates policy"), false},
+		{fmt.Errorf("stop: %w", ErrTaskCancelled), false},
+		{context.Canceled, false},
+	}
+	for _, tc := range cases {
+		if got := IsRetryableJobError(tc.err); got != tc.want {
+			t.Fatalf("%v: expected %v, got %v", tc.err, tc.want, got)
+		}
+	}
+}
+
+func TestWillRetryJob_UsesAttemptFromContext(t *testing.T) {
+	err := errors.New("connection reset by peer")
+	policy := NewJobRetryPolicies(config.JobRetryConfig{}).ForJob(JobTypeVideoGeneration)
+
+	if willRetryJob(context.Background(), err) {
+		t.Fatalf("expected local runner jobs not to be retried")
+	}
+	if !willRetryJob(withJobAttempt(context.Background(), 1, policy), err) {
+		t.Fatalf("expected first attempt to be retried")
+	}
+	if willRetryJob(withJobAttempt(context.Background(), policy.MaxAttempts, policy), err) {
+		t.Fatalf("expected last attempt not to be retried")
+	}
+}
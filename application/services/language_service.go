@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// LanguageService 提示词语言设置。生效顺序为 剧 > 用户 > 系统默认
+type LanguageService struct {
+	db    *gorm.DB
+	log   *logger.Logger
+	packs *promptPackRegistry
+
+	// defaultLanguage 系统默认语言，启动时取自 App.Language，之后由 UpdateDefaultLanguage 修改
+	mu              sync.RWMutex
+	defaultLanguage string
+}
+
+// NewLanguageService 加载内置语言包和 App.PromptPacksDir 下的语言包，加载失败时返回错误
+func NewLanguageService(db *gorm.DB, cfg *config.Config, log *logger.Logger) (*LanguageService, error) {
+	packs, err := newPromptPackRegistry(cfg.App.PromptPacksDir)
+	if err != nil {
+		return nil, err
+	}
+	return &LanguageService{
+		db:              db,
+		log:             log,
+		packs:           packs,
+		defaultLanguage: cfg.App.Language,
+	}, nil
+}
+
+// RegisterPromptPack 注册或替换语言包
+func (s *LanguageService) RegisterPromptPack(pack PromptPack) error {
+	return s.packs.register(pack)
+}
+
+// IsSupported 内置的 zh、en 或已注册语言包的语言
+func (s *LanguageService) IsSupported(language string) bool {
+	return s.packs.supported(language)
+}
+
+// SupportedLanguages 按 zh、en、语言包的顺序列出可选语言
+func (s *LanguageService) SupportedLanguages() []PromptLanguage {
+	return s.packs.languages()
+}
+
+// UserLanguage 用户的语言设置与实际生效的语言
+type UserLanguage struct {
+	Language        string           `json:"language"`      // 实际生效的语言
+	UserLanguage    string           `json:"user_language"` // 为空表示跟随系统默认
+	DefaultLanguage string           `json:"default_language"`
+	Available       []PromptLanguage `json:"available"`
+}
+
+// DefaultLanguage 系统默认语言
+func (s *LanguageService) DefaultLanguage() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.defaultLanguage == "" {
+		return promptLanguageZH
+	}
+	return s.defaultLanguage
+}
+
+// ResolveLanguage 返回剧或用户设置的语言，都未设置或语言已不可用时返回空
+func (s *LanguageService) ResolveLanguage(userID, dramaID uint) string {
+	if dramaID != 0 {
+		var drama models.Drama
+		err := s.db.Select("id", "language").Where("id = ? AND user_id = ?", dramaID, userID).First(&drama).Error
+		if err == nil && drama.Language != "" && s.IsSupported(drama.Language) {
+			return drama.Language
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.log.Warnw("Failed to load drama language", "error", err, "drama_id", dramaID)
+		}
+	}
+	if userID == 0 {
+		return ""
+	}
+
+	var user models.User
+	if err := s.db.Select("id", "language").Where("id = ?", userID).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.log.Warnw("Failed to load user language", "error", err, "user_id", userID)
+		}
+		return ""
+	}
+	if user.Language != "" && s.IsSupported(user.Language) {
+		return user.Language
+	}
+	return ""
+}
+
+func (s *LanguageService) GetUserLanguage(userID uint) (*UserLanguage, error) {
+	var user models.User
+	if err := s.db.Select("id", "language").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	result := &UserLanguage{
+		Language:        s.DefaultLanguage(),
+		UserLanguage:    user.Language,
+		DefaultLanguage: s.DefaultLanguage(),
+		Available:       s.SupportedLanguages(),
+	}
+	if user.Language != "" && s.IsSupported(user.Language) {
+		result.Language = user.Language
+	}
+	return result, nil
+}
+
+// UpdateUserLanguage 设置用户语言，空字符串表示跟随系统默认
+func (s *LanguageService) UpdateUserLanguage(userID uint, language string) (*UserLanguage, error) {
+	if language != "" && !s.IsSupported(language) {
+		return nil, ErrUnsupportedPromptLanguage
+	}
+	if err := s.db.Model(&models.User{}).Where("id = ?", userID).Update("language", language).Error; err != nil {
+		return nil, err
+	}
+	s.log.Infow("User language updated", "user_id", userID, "language", language)
+	return s.GetUserLanguage(userID)
+}
+
+// UpdateDefaultLanguage 修改系统默认语言并写回配置文件，只影响未设置语言的用户和剧
+func (s *LanguageService) UpdateDefaultLanguage(language string) error {
+	if !s.IsSupported(language) {
+		return ErrUnsupportedPromptLanguage
+	}
+	s.mu.Lock()
+	s.defaultLanguage = language
+	s.mu.Unlock()
+
+	viper.Set("app.language", language)
+	if err := viper.WriteConfig(); err != nil {
+		s.log.Warnw("Failed to write config file", "error", err)
+		// 即使写入文件失败，内存配置也已更新，仍然可用
+	}
+	s.log.Infow("Default language updated", "language", language)
+	return nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func TestLanguageService_ResolvesDramaThenUserThenDefault(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.Drama{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	cfg := &config.Config{App: config.AppConfig{Language: "zh"}}
+	svc, err := NewLanguageService(db, cfg, logger.NewLogger(true))
+	if err != nil {
+		t.Fatalf("failed to create language service: %v", err)
+	}
+
+	user := models.User{Email: "lang@example.com", PasswordHash: "x", Language: "en"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	drama := models.Drama{UserID: user.ID, Title: "ドラマ", Language: "ja"}
+	plain := models.Drama{UserID: user.ID, Title: "未设置"}
+	if err := db.Create(&drama).Error; err != nil {
+		t.Fatalf("failed to create drama: %v", err)
+	}
+	if err := db.Create(&plain).Error; err != nil {
+		t.Fatalf("failed to create drama: %v", err)
+	}
+
+	prompts := NewPromptI18n(cfg, nil, svc)
+	cases := []struct {
+		userID, dramaID uint
+		want            string
+	}{
+		{user.ID, drama.ID, "ja"},
+		{user.ID, plain.ID, "en"},
+		{user.ID, 0, "en"},
+		{user.ID + 1, drama.ID, "zh"}, // 不是自己的剧
+		{0, 0, "zh"},
+	}
+	for _, tc := range cases {
+		if got := prompts.ForDrama(tc.userID, tc.dramaID).GetLanguage(); got != tc.want {
+			t.Fatalf("user %d drama %d: expected %s, got %s", tc.userID, tc.dramaID, tc.want, got)
+		}
+	}
+	if prompts.GetLanguage() != "zh" {
+		t.Fatalf("expected unscoped prompts to keep the default language")
+	}
+
+	if _, err := svc.UpdateUserLanguage(user.ID, "xx"); !errors.Is(err, ErrUnsupportedPromptLanguage) {
+		t.Fatalf("expected unsupported language error, got %v", err)
+	}
+	language, err := svc.UpdateUserLanguage(user.ID, "")
+	if err != nil {
+		t.Fatalf("failed to clear user language: %v", err)
+	}
+	if language.Language != "zh" || language.UserLanguage != "" {
+		t.Fatalf("expected user to follow default language, got %+v", language)
+	}
+	if cfg.App.Language != "zh" {
+		t.Fatalf("updating a user's language must not change the default")
+	}
+}
+
+func TestPromptPack_FallsBackToEnglishForMissingEntries(t *testing.T) {
+	cfg := &config.Config{App: config.AppConfig{Language: "ja"}}
+	languages, err := NewLanguageService(nil, cfg, logger.NewLogger(true))
+	if err != nil {
+		t.Fatalf("failed to create language service: %v", err)
+	}
+	prompts := NewPromptI18n(cfg, nil, languages)
+
+	if !strings.Contains(prompts.GetStoryboardSystemPrompt(), "ストーリーボード") {
+		t.Fatalf("expected japanese storyboard prompt from the pack")
+	}
+	if got := prompts.FormatUserPrompt("scene_label", "教室", "夜"); got != "シーン：教室、夜" {
+		t.Fatalf("unexpected japanese label: %q", got)
+	}
+	english := NewPromptI18n(&config.Config{App: config.AppConfig{Language: "en"}}, nil, nil)
+	if prompts.GetFirstFramePrompt("anime") != english.GetFirstFramePrompt("anime") {
+		t.Fatalf("expected missing prompt to fall back to english")
+	}
+	if prompts.FormatUserPrompt("frame_info", "x") != english.FormatUserPrompt("frame_info", "x") {
+		t.Fatalf("expected missing label to fall back to english")
+	}
+}
+
+func TestRegisterPromptPack_ValidatesEntries(t *testing.T) {
+	languages, err := NewLanguageService(nil, &config.Config{}, logger.NewLogger(true))
+	if err != nil {
+		t.Fatalf("failed to create language service: %v", err)
+	}
+	cases := []PromptPack{
+		{Language: "zh"},
+		{Language: "Japanese"},
+		{Language: "fr", Prompts: map[string]string{"missing": "x"}},
+		{Language: "fr", Prompts: map[string]string{PromptKeyFirstFrame: "{{script}}"}},
+		{Language: "fr", Labels: map[string]string{"scene_label": "Scène : %s"}},
+	}
+	for _, pack := range cases {
+		if err := languages.RegisterPromptPack(pack); !errors.Is(err, ErrInvalidPromptPack) {
+			t.Fatalf("expected %+v to be rejected, got %v", pack, err)
+		}
+	}
+	if languages.IsSupported("fr") {
+		t.Fatalf("rejected packs must not be registered")
+	}
+
+	codes := []string{}
+	for _, language := range languages.SupportedLanguages() {
+		codes = append(codes, language.Code)
+	}
+	if got := strings.Join(codes, ","); got != "zh,en,ja,ko" {
+		t.Fatalf("unexpected languages: %s", got)
+	}
+}
+
+func TestNewLanguageService_ReturnsPromptPackLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fr.json"), []byte(`{"language":"fr","prompts":{"missing":"x"}}`), 0o644); err != nil {
+		t.Fatalf("failed to write pack: %v", err)
+	}
+	cfg := &config.Config{App: config.AppConfig{PromptPacksDir: dir}}
+	if _, err := NewLanguageService(nil, cfg, logger.NewLogger(true)); !errors.Is(err, ErrInvalidPromptPack) {
+		t.Fatalf("expected invalid prompt pack error, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "fr.json"), []byte(`{"language":"fr","name":"Français"}`), 0o644); err != nil {
+		t.Fatalf("failed to write pack: %v", err)
+	}
+	languages, err := NewLanguageService(nil, cfg, logger.NewLogger(true))
+	if err != nil {
+		t.Fatalf("failed to load prompt packs: %v", err)
+	}
+	if !languages.IsSupported("fr") || !languages.IsSupported("ja") {
+		t.Fatalf("expected directory and builtin packs to be loaded")
+	}
+}
+
+func TestLanguageService_UpdateDefaultLanguageWhilePromptsRead(t *testing.T) {
+	cfg := &config.Config{App: config.AppConfig{Language: "zh"}}
+	languages, err := NewLanguageService(nil, cfg, logger.NewLogger(true))
+	if err != nil {
+		t.Fatalf("failed to create language service: %v", err)
+	}
+	prompts := NewPromptI18n(cfg, nil, languages)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = prompts.GetLanguage()
+				_ = languages.DefaultLanguage()
+			}
+		}()
+	}
+	for _, language := range []string{"en", "ja", "en"} {
+		if err := languages.UpdateDefaultLanguage(language); err != nil {
+			t.Fatalf("failed to update default language: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if got := prompts.GetLanguage(); got != "en" {
+		t.Fatalf("expected prompts to follow the updated default, got %s", got)
+	}
+	if cfg.App.Language != "zh" {
+		t.Fatalf("expected the shared config to be left untouched, got %s", cfg.App.Language)
+	}
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/external/ffmpeg"
+	"github.com/drama-generator/backend/pkg/image"
+	"github.com/drama-generator/backend/pkg/imaging"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidPanelComposite = errors.New("invalid panel composite request")
+
+const (
+	imageOperationPanel     = "panel"     // 拼图中的单格
+	imageOperationComposite = "composite" // 由各格拼成的整图
+
+	defaultPanelGutter   = 16
+	minPanelCaptionSize  = 32
+	panelPromptSeparator = "\n---\n"
+)
+
+// PanelCompositeOptions 多格拼图设置
+type PanelCompositeOptions struct {
+	Layout   string `json:"layout"`   // horizontal_3、vertical_2、grid_3x3，为空时使用分镜帧提示词的布局
+	Gutter   *int   `json:"gutter"`   // 格间距和外边距，默认 16 像素
+	Captions bool   `json:"captions"` // 每格下方绘制分镜动作描述
+}
+
+// generatePanelComposite 按 "---" 分隔的多格提示词逐格生成图片，全部完成后在服务端拼成一张。
+// 返回的拼图记录在各格完成前保持 pending，每格单独计费
+func (s *ImageGenerationService) generatePanelComposite(userID uint, request *GenerateImageRequest, base *models.ImageGeneration, creditCost int, billingDetail string) (*models.ImageGeneration, error) {
+	if s.localStorage == nil {
+		return nil, fmt.Errorf("panel composite requires local storage")
+	}
+	opts := *request.PanelComposite
+
+	prompts := splitPanelPrompts(request.Prompt)
+	layout := strings.TrimSpace(opts.Layout)
+	if layout == "" {
+		layout = s.framePromptLayout(userID, request)
+	}
+	if layout == "" {
+		layout = fmt.Sprintf("horizontal_%d", len(prompts))
+	}
+	columns, rows, err := imaging.ParseGridLayout(layout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPanelComposite, err)
+	}
+	// 动作序列只有一条整体提示词，按格数拆成连续的单格画面
+	if len(prompts) == 1 && columns*rows > 1 {
+		prompts = sequencePanelPrompts(prompts[0], columns*rows)
+	}
+	if len(prompts) < 2 || len(prompts) > columns*rows {
+		return nil, fmt.Errorf("%w: %d panel prompts do not fit layout %s", ErrInvalidPanelComposite, len(prompts), layout)
+	}
+	gutter := defaultPanelGutter
+	if opts.Gutter != nil {
+		if *opts.Gutter < 0 {
+			return nil, fmt.Errorf("%w: gutter must not be negative", ErrInvalidPanelComposite)
+		}
+		gutter = *opts.Gutter
+	}
+	opts.Layout, opts.Gutter = layout, &gutter
+	compositeJSON, _ := json.Marshal(opts)
+
+	billingRefIDs := make([]string, 0, len(prompts))
+	refundAll := func() {
+		for _, refID := range billingRefIDs {
+			if refID != "" {
+				_ = s.billingService.RefundAI(refID)
+			}
+		}
+	}
+	for range prompts {
+		refID, err := s.billingService.ReserveAI(userID, "image", base.Model, creditCost, billingDetail)
+		if err != nil {
+			refundAll()
+			return nil, err
+		}
+		billingRefIDs = append(billingRefIDs, refID)
+	}
+
+	composite := *base
+	operation := imageOperationComposite
+	composite.Operation = &operation
+	composite.Composite = compositeJSON
+	panels := make([]*models.ImageGeneration, 0, len(prompts))
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&composite).Error; err != nil {
+			return err
+		}
+		panelOperation := imageOperationPanel
+		for i, prompt := range prompts {
+			panel := *base
+			panel.Prompt = prompt
+			panel.ParentID = &composite.ID
+			panel.Operation = &panelOperation
+			if billingRefIDs[i] != "" {
+				panel.BillingRefID = &billingRefIDs[i]
+			}
+			if err := tx.Create(&panel).Error; err != nil {
+				return err
+			}
+			panels = append(panels, &panel)
+		}
+		return nil
+	})
+	if err != nil {
+		refundAll()
+		return nil, fmt.Errorf("failed to create record: %w", err)
+	}
+
+	for _, panel := range panels {
+		panelID := panel.ID
+		if err := s.dispatchImageGeneration(panelID); err != nil {
+			s.log.Warnw("Failed to dispatch panel generation through task bus, fallback to local runner", "error", err, "id", panelID)
+			s.runner.Submit("image.process_generation", func() {
+				s.ProcessImageGeneration(context.Background(), panelID)
+			})
+		}
+	}
+
+	s.log.Infow("Panel composite created", "id", composite.ID, "layout", layout, "panels", len(panels))
+	return &composite, nil
+}
+
+// framePromptLayout 请求未指定布局时，使用该分镜同类型帧提示词生成时的布局
+func (s *ImageGenerationService) framePromptLayout(userID uint, request *GenerateImageRequest) string {
+	if request.StoryboardID == nil || request.FrameType == nil {
+		return ""
+	}
+	var framePrompt models.FramePrompt
+	err := s.db.Where("storyboard_id = ? AND frame_type = ? AND user_id = ?", *request.StoryboardID, *request.FrameType, userID).
+		Order("id DESC").First(&framePrompt).Error
+	if err != nil || framePrompt.Layout == nil {
+		return ""
+	}
+	return *framePrompt.Layout
+}
+
+// composePanels 各格全部完成后拼图，由最后完成的一格触发
+func (s *ImageGenerationService) composePanels(compositeID uint) {
+	var composite models.ImageGeneration
+	if err := s.db.First(&composite, compositeID).Error; err != nil {
+		s.log.Errorw("Failed to load panel composite", "error", err, "id", compositeID)
+		return
+	}
+	if composite.Status != models.ImageStatusPending {
+		return
+	}
+	var panels []models.ImageGeneration
+	if err := s.db.Where("parent_id = ? AND operation = ?", compositeID, imageOperationPanel).Order("id ASC").Find(&panels).Error; err != nil {
+		s.log.Errorw("Failed to load panels", "error", err, "id", compositeID)
+		return
+	}
+	for _, panel := range panels {
+		if panel.Status != models.ImageStatusCompleted {
+			return
+		}
+	}
+
+	// 多格同时完成时只拼一次
+	claimed := s.db.Model(&models.ImageGeneration{}).Where("id = ? AND status = ?", compositeID, models.ImageStatusPending).
+		Update("status", models.ImageStatusProcessing)
+	if claimed.Error != nil || claimed.RowsAffected == 0 {
+		return
+	}
+	composite.Status = models.ImageStatusProcessing
+
+	result, localPath, err := s.renderPanelComposite(&composite, panels)
+	if err != nil {
+		s.log.Errorw("Failed to compose panels", "error", err, "id", compositeID)
+		s.updateImageGenError(compositeID, err.Error())
+		return
+	}
+	s.log.Infow("Panels composed", "id", compositeID, "panels", len(panels), "local_path", *localPath)
+	s.finishImageGeneration(&composite, result, localPath)
+}
+
+// renderPanelComposite 读取各格图片拼成网格并保存为 PNG，需要说明文字时用 ffmpeg 绘制
+func (s *ImageGenerationService) renderPanelComposite(composite *models.ImageGeneration, panels []models.ImageGeneration) (*image.ImageResult, *string, error) {
+	var opts PanelCompositeOptions
+	if err := json.Unmarshal(composite.Composite, &opts); err != nil {
+		return nil, nil, fmt.Errorf("invalid composite options: %w", err)
+	}
+	columns, rows, err := imaging.ParseGridLayout(opts.Layout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	images := make([]stdimage.Image, 0, len(panels))
+	for i := range panels {
+		data, err := s.loadImageBytes(context.Background(), &panels[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("load panel %d: %w", i+1, err)
+		}
+		img, _, err := imaging.Decode(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode panel %d: %w", i+1, err)
+		}
+		images = append(images, img)
+	}
+
+	gridOpts := imaging.GridOptions{Columns: columns, Rows: rows}
+	if opts.Gutter != nil {
+		gridOpts.Gutter = *opts.Gutter
+	}
+	var captions []string
+	if opts.Captions {
+		captions = s.panelCaptions(composite, len(images))
+	}
+	if len(captions) > 0 {
+		gridOpts.CaptionHeight = max(minPanelCaptionSize, images[0].Bounds().Dy()/8)
+	}
+	canvas, cells, err := imaging.ComposeGrid(images, gridOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := imaging.EncodeBytes(canvas, imaging.FormatPNG)
+	if err != nil {
+		return nil, nil, err
+	}
+	saved, err := s.localStorage.SaveWithPath(bytes.NewReader(data), "images", imaging.FormatPNG.Ext())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(captions) > 0 {
+		if err := s.drawPanelCaptions(saved.AbsolutePath, cells, captions); err != nil {
+			// 没有 ffmpeg 或字体时去掉说明文字区域，不影响拼图
+			s.log.Warnw("Failed to draw panel captions, composing without captions", "error", err, "id", composite.ID)
+			gridOpts.CaptionHeight = 0
+			if canvas, _, err = imaging.ComposeGrid(images, gridOpts); err != nil {
+				return nil, nil, err
+			}
+			if data, err = imaging.EncodeBytes(canvas, imaging.FormatPNG); err != nil {
+				return nil, nil, err
+			}
+			if err := os.WriteFile(saved.AbsolutePath, data, 0644); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return &image.ImageResult{
+		ImageURL:  saved.URL,
+		Completed: true,
+		Width:     canvas.Bounds().Dx(),
+		Height:    canvas.Bounds().Dy(),
+	}, &saved.RelativePath, nil
+}
+
+func (s *ImageGenerationService) drawPanelCaptions(path string, cells []imaging.GridCell, captions []string) error {
+	var list []ffmpeg.ImageCaption
+	for i, caption := range captions {
+		if caption == "" || i >= len(cells) {
+			continue
+		}
+		rect := cells[i].Caption
+		list = append(list, ffmpeg.ImageCaption{Text: caption, X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()})
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	output := strings.TrimSuffix(path, filepath.Ext(path)) + "_captioned.png"
+	if err := s.ffmpeg.DrawImageCaptions(path, output, list, s.config.Imaging.CaptionFontFile); err != nil {
+		os.Remove(output)
+		return err
+	}
+	return os.Rename(output, path)
+}
+
+// panelCaptions 分镜动作描述按句分配到各格
+func (s *ImageGenerationService) panelCaptions(composite *models.ImageGeneration, count int) []string {
+	if composite.StoryboardID == nil {
+		return nil
+	}
+	var storyboard models.Storyboard
+	err := s.db.
+		Joins("JOIN episodes ON episodes.id = storyboards.episode_id").
+		Where("storyboards.id = ? AND episodes.user_id = ?", *composite.StoryboardID, composite.UserID).
+		First(&storyboard).Error
+	if err != nil || storyboard.Action == nil {
+		return nil
+	}
+	return splitPanelCaptions(*storyboard.Action, count)
+}
+
+// failPanelComposite 任一格失败时拼图失败，并取消其余未完成的格子
+func (s *ImageGenerationService) failPanelComposite(compositeID uint, errorMsg string) {
+	result := s.db.Model(&models.ImageGeneration{}).
+		Where("id = ? AND status = ?", compositeID, models.ImageStatusPending).
+		Updates(map[string]interface{}{
+			"status":    models.ImageStatusFailed,
+			"error_msg": "panel generation failed: " + errorMsg,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	s.log.Errorw("Panel composite failed", "id", compositeID, "error", errorMsg)
+	s.emitImageGenerationEvent(compositeID, WebhookEventImageFailed)
+	s.cancelPanels(compositeID)
+}
+
+// cancelPanels 取消拼图下排队或生成中的格子并退回积分
+func (s *ImageGenerationService) cancelPanels(compositeID uint) {
+	var panels []models.ImageGeneration
+	if err := s.db.Where("parent_id = ? AND operation = ? AND status IN ?", compositeID, imageOperationPanel,
+		[]models.ImageGenerationStatus{models.ImageStatusPending, models.ImageStatusProcessing}).Find(&panels).Error; err != nil {
+		s.log.Warnw("Failed to load panels to cancel", "error", err, "id", compositeID)
+		return
+	}
+	for _, panel := range panels {
+		if _, err := s.CancelImageGeneration(panel.UserID, panel.ID); err != nil && !errors.Is(err, ErrTaskNotCancellable) {
+			s.log.Warnw("Failed to cancel panel", "error", err, "id", panel.ID, "composite_id", compositeID)
+		}
+	}
+}
+
+func isPanelImage(imageGen *models.ImageGeneration) bool {
+	return imageGen.ParentID != nil && imageGen.Operation != nil && *imageGen.Operation == imageOperationPanel
+}
+
+// splitPanelPrompts 帧提示词服务以 "---" 分隔多格提示词
+func splitPanelPrompts(prompt string) []string {
+	var prompts []string
+	for _, part := range strings.Split(prompt, panelPromptSeparator) {
+		if part = strings.TrimSpace(part); part != "" {
+			prompts = append(prompts, part)
+		}
+	}
+	return prompts
+}
+
+func sequencePanelPrompts(prompt string, count int) []string {
+	prompts := make([]string, count)
+	for i := range prompts {
+		prompts[i] = fmt.Sprintf("%s\n\nPanel %d of %d in a continuous action sequence: draw only this single moment as one full frame, no grid, no panel borders", prompt, i+1, count)
+	}
+	return prompts
+}
+
+// splitPanelCaptions 按句拆分，句子不多于格数时一格一句，否则把连续的句子平均分到各格
+func splitPanelCaptions(action string, count int) []string {
+	var sentences []string
+	var current strings.Builder
+	flush := func() {
+		if sentence := strings.TrimSpace(current.String()); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		current.Reset()
+	}
+	for _, r := range action {
+		if r == '\n' {
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+		if strings.ContainsRune("。！？；.!?;", r) {
+			flush()
+		}
+	}
+	flush()
+	if len(sentences) == 0 || count <= 0 {
+		return nil
+	}
+
+	captions := make([]string, count)
+	if len(sentences) <= count {
+		copy(captions, sentences)
+		return captions
+	}
+	for i := range captions {
+		captions[i] = joinSentences(sentences[i*len(sentences)/count : (i+1)*len(sentences)/count])
+	}
+	return captions
+}
+
+// joinSentences 中文句子直接相连，英文句子之间加空格
+func joinSentences(sentences []string) string {
+	var b strings.Builder
+	for _, sentence := range sentences {
+		if b.Len() > 0 && strings.ContainsAny(b.String()[b.Len()-1:], ".!?;") {
+			b.WriteByte(' ')
+		}
+		b.WriteString(sentence)
+	}
+	return b.String()
+}
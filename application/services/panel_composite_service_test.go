@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/storage"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func TestPanelComposite_GeneratesPanelsAndComposesGrid(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.ImageGeneration{}, &models.Episode{},
+		&models.Storyboard{}, &models.FramePrompt{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	colors := []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	var prompts []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			var index int
+			fmt.Sscanf(r.URL.Path, "/panels/%d.png", &index)
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(encodeTestPNG(t, 100, 60, colors[index]))
+			return
+		}
+		var body struct {
+			Prompt string `json:"prompt"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		prompts = append(prompts, body.Prompt)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"data":[{"url":"%s/panels/%d.png"}]}`, server.URL, (len(prompts)-1)%len(colors))
+	}))
+	defer server.Close()
+	cfg := seedAIConfig(t, db, 0, "image", "openai", "panels", "gpt-image-1", 1, 10)
+	db.Model(&cfg).Update("base_url", server.URL+"/v1")
+
+	log := logger.NewLogger(true)
+	localStorage, err := storage.NewLocalStorage(t.TempDir(), "http://localhost/static")
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	svc := &ImageGenerationService{
+		db:             db,
+		aiService:      NewAIService(db, &config.Config{}, log),
+		billingService: NewBillingService(db, &config.Config{}, nil, log),
+		taskService:    NewTaskService(db, log, NewTaskEventHub(), nil),
+		localStorage:   localStorage,
+		dispatcher:     &capturingDispatcher{},
+		config:         &config.Config{},
+		log:            log,
+	}
+
+	user := models.User{Email: "panel@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 50}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	episode := models.Episode{UserID: user.ID, DramaID: 1, EpisodeNum: 1, Title: "第1集", Status: "draft"}
+	if err := db.Create(&episode).Error; err != nil {
+		t.Fatalf("failed to create episode: %v", err)
+	}
+	storyboard := models.Storyboard{UserID: user.ID, EpisodeID: episode.ID, StoryboardNumber: 1, Action: strPtr("他推开门。雨停了。")}
+	if err := db.Create(&storyboard).Error; err != nil {
+		t.Fatalf("failed to create storyboard: %v", err)
+	}
+	if err := db.Create(&models.FramePrompt{UserID: user.ID, StoryboardID: storyboard.ID, FrameType: models.FrameTypePanel, Prompt: "x", Layout: strPtr("vertical_3")}).Error; err != nil {
+		t.Fatalf("failed to create frame prompt: %v", err)
+	}
+
+	gutter := 4
+	request := &GenerateImageRequest{
+		StoryboardID:   &storyboard.ID,
+		FrameType:      strPtr(models.FrameTypePanel),
+		Prompt:         "推门\n---\n走进房间\n---\n雨停了",
+		Model:          "gpt-image-1",
+		PanelComposite: &PanelCompositeOptions{Layout: "horizontal_2"},
+	}
+	if _, err := svc.GenerateImage(user.ID, request); !errors.Is(err, ErrInvalidPanelComposite) {
+		t.Fatalf("expected three panels not to fit horizontal_2, got %v", err)
+	}
+
+	// 未指定布局时使用帧提示词的布局
+	request.PanelComposite = &PanelCompositeOptions{Gutter: &gutter}
+	composite, err := svc.GenerateImage(user.ID, request)
+	if err != nil {
+		t.Fatalf("failed to create panel composite: %v", err)
+	}
+	if composite.Operation == nil || *composite.Operation != imageOperationComposite || !strings.Contains(string(composite.Composite), `"layout":"vertical_3"`) {
+		t.Fatalf("unexpected composite record: %+v", composite)
+	}
+	var panels []models.ImageGeneration
+	db.Where("parent_id = ?", composite.ID).Order("id ASC").Find(&panels)
+	if len(panels) != 3 || panels[1].Prompt != "走进房间" || panels[1].BillingRefID == nil {
+		t.Fatalf("expected three billed panels, got %+v", panels)
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 20 {
+		t.Fatalf("expected each panel to reserve credits, got %d left", reloaded.Credits)
+	}
+
+	for i, panel := range panels {
+		if err := svc.ProcessImageGeneration(context.Background(), panel.ID); err != nil {
+			t.Fatalf("failed to process panel: %v", err)
+		}
+		db.First(composite, composite.ID)
+		if i < len(panels)-1 && composite.Status != models.ImageStatusPending {
+			t.Fatalf("expected composite to wait for all panels, got %s", composite.Status)
+		}
+	}
+	if len(prompts) != 3 || prompts[2] != "雨停了, imageRatio:16:9" {
+		t.Fatalf("expected one provider call per panel, got %q", prompts)
+	}
+
+	if composite.Status != models.ImageStatusCompleted || composite.LocalPath == nil || *composite.Width != 108 || *composite.Height != 196 {
+		t.Fatalf("expected composed vertical grid, got %+v", composite)
+	}
+	data, err := os.ReadFile(localStorage.GetAbsolutePath(*composite.LocalPath))
+	if err != nil {
+		t.Fatalf("failed to read composite: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode composite: %v", err)
+	}
+	if r, g, _, _ := img.At(50, 4+60+4+30).RGBA(); r != 0 || g>>8 != 255 {
+		t.Fatalf("expected second panel in the middle row")
+	}
+	if r, g, b, _ := img.At(2, 2).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+		t.Fatalf("expected white gutter")
+	}
+
+	db.First(&storyboard, storyboard.ID)
+	if storyboard.CurrentImageID == nil || *storyboard.CurrentImageID != composite.ID || storyboard.ComposedImage == nil || *storyboard.ComposedImage != *composite.ImageURL {
+		t.Fatalf("expected storyboard to use the composite, got %+v", storyboard)
+	}
+	history, err := NewImageVersionService(db, log).ListVersions(user.ID, string(models.ImageTypeStoryboard), storyboard.ID)
+	if err != nil {
+		t.Fatalf("failed to list versions: %v", err)
+	}
+	if len(history.Versions) != 1 || history.Versions[0].ImageGenerationID != composite.ID {
+		t.Fatalf("expected panels excluded from versions, got %+v", history.Versions)
+	}
+}
+
+func TestSplitPanelCaptions(t *testing.T) {
+	if got := splitPanelCaptions("他推开门。\n雨停了", 3); strings.Join(got, "|") != "他推开门。|雨停了|" {
+		t.Fatalf("expected one sentence per panel, got %q", got)
+	}
+	if got := splitPanelCaptions("He runs. He jumps! 他落地。她回头。", 2); strings.Join(got, "|") != "He runs. He jumps!|他落地。她回头。" {
+		t.Fatalf("expected sentences spread across panels, got %q", got)
+	}
+	if got := splitPanelCaptions("  ", 2); got != nil {
+		t.Fatalf("expected no captions, got %q", got)
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/drama-generator/backend/pkg/config"
 )
@@ -9,15 +10,80 @@ import (
 // PromptI18n 提示词国际化工具
 type PromptI18n struct {
 	config *config.Config
+	// templates 查找数据库中生效的模板，为 nil 时只使用内置提示词
+	templates *PromptTemplateService
+	// languages ForDrama 按用户和剧解析语言并提供语言包和系统默认语言，为 nil 时只使用配置中的默认语言和内置中英文提示词
+	languages *LanguageService
+	// userID、dramaID 查找数据库模板时的作用域，见 ForDrama
+	userID  uint
+	dramaID uint
+	// language 剧或用户设置的语言，为空时使用系统默认语言
+	language string
+	// builtinOnly 只返回内置提示词，用于生成模板默认正文
+	builtinOnly bool
 }
 
 // NewPromptI18n 创建提示词国际化工具
-func NewPromptI18n(cfg *config.Config) *PromptI18n {
-	return &PromptI18n{config: cfg}
+func NewPromptI18n(cfg *config.Config, templates *PromptTemplateService, languages *LanguageService) *PromptI18n {
+	return &PromptI18n{config: cfg, templates: templates, languages: languages}
 }
 
-// GetLanguage 获取当前语言设置
+// ForDrama 返回按用户、剧作用域查找提示词模板和语言的副本，dramaID 为 0 时只使用用户级设置
+func (p *PromptI18n) ForDrama(userID, dramaID uint) *PromptI18n {
+	scoped := *p
+	scoped.userID = userID
+	scoped.dramaID = dramaID
+	if p.languages != nil {
+		scoped.language = p.languages.ResolveLanguage(userID, dramaID)
+	}
+	return &scoped
+}
+
+// templateOverride 查找数据库中生效的模板并渲染，没有时返回 false，由调用方使用内置提示词
+func (p *PromptI18n) templateOverride(key string, vars map[string]string) (string, bool) {
+	body, ok := p.activeTemplate(key)
+	if !ok {
+		return "", false
+	}
+	return renderPromptTemplate(body, vars), true
+}
+
+// activeTemplate 当前作用域下生效的模板正文（未渲染），没有数据库模板时使用语言包
+func (p *PromptI18n) activeTemplate(key string) (string, bool) {
+	if !p.builtinOnly {
+		if body, ok := p.storedTemplate(key); ok {
+			return body, true
+		}
+	}
+	return p.packPrompt(key)
+}
+
+func (p *PromptI18n) storedTemplate(key string) (string, bool) {
+	store := p.templates
+	if store == nil {
+		return "", false
+	}
+	template, err := store.Resolve(key, p.GetLanguage(), p.userID, p.dramaID)
+	if err != nil {
+		if store.log != nil {
+			store.log.Warnw("Failed to resolve prompt template, using builtin", "error", err, "key", key)
+		}
+		return "", false
+	}
+	if template == nil {
+		return "", false
+	}
+	return template.Body, true
+}
+
+// GetLanguage 获取当前语言设置，剧或用户未设置时使用系统默认语言
 func (p *PromptI18n) GetLanguage() string {
+	if p.language != "" {
+		return p.language
+	}
+	if p.languages != nil {
+		return p.languages.DefaultLanguage()
+	}
 	lang := p.config.App.Language
 	if lang == "" {
 		return "zh" // 默认中文
@@ -25,13 +91,17 @@ func (p *PromptI18n) GetLanguage() string {
 	return lang
 }
 
-// IsEnglish 判断是否为英文模式（动态读取配置）
+// IsEnglish 是否使用英文内置提示词。语言包语言缺失的条目回退到英文，因此非中文都视为英文
 func (p *PromptI18n) IsEnglish() bool {
-	return p.GetLanguage() == "en"
+	return p.GetLanguage() != promptLanguageZH
 }
 
 // GetStoryboardSystemPrompt 获取分镜生成系统提示词
 func (p *PromptI18n) GetStoryboardSystemPrompt() string {
+	if body, ok := p.templateOverride(PromptKeyStoryboardSystem, nil); ok {
+		return body
+	}
+
 	if p.IsEnglish() {
 		return `[Role] You are a senior film storyboard artist, skilled at breaking down scripts into shot sequences.
 
@@ -57,6 +127,9 @@ func (p *PromptI18n) GetStoryboardSystemPrompt() string {
 func (p *PromptI18n) GetSceneExtractionPrompt(style string) string {
 	// 默认图片比例
 	imageRatio := "16:9"
+	if body, ok := p.templateOverride(PromptKeySceneExtraction, map[string]string{"style": style, "image_ratio": imageRatio}); ok {
+		return body
+	}
 
 	if p.IsEnglish() {
 		return fmt.Sprintf(`[Task] Extract all unique scene backgrounds from the script
@@ -109,6 +182,9 @@ Each element containing:
 // GetFirstFramePrompt 获取首帧提示词
 func (p *PromptI18n) GetFirstFramePrompt(style string) string {
 	imageRatio := "16:9"
+	if body, ok := p.templateOverride(PromptKeyFirstFrame, map[string]string{"style": style, "image_ratio": imageRatio}); ok {
+		return body
+	}
 	if p.IsEnglish() {
 		return fmt.Sprintf(`You are a professional image generation prompt expert. Please generate prompts suitable for AI image generation based on the provided shot information.
 
@@ -149,6 +225,9 @@ Return a JSON object containing:
 // GetKeyFramePrompt 获取关键帧提示词
 func (p *PromptI18n) GetKeyFramePrompt(style string) string {
 	imageRatio := "16:9"
+	if body, ok := p.templateOverride(PromptKeyKeyFrame, map[string]string{"style": style, "image_ratio": imageRatio}); ok {
+		return body
+	}
 	if p.IsEnglish() {
 		return fmt.Sprintf(`You are a professional image generation prompt expert. Please generate prompts suitable for AI image generation based on the provided shot information.
 
@@ -189,6 +268,9 @@ Return a JSON object containing:
 // GetActionSequenceFramePrompt 获取动作序列提示词
 func (p *PromptI18n) GetActionSequenceFramePrompt(style string) string {
 	imageRatio := "16:9"
+	if body, ok := p.templateOverride(PromptKeyActionSequenceFrame, map[string]string{"style": style, "image_ratio": imageRatio}); ok {
+		return body
+	}
 	if p.IsEnglish() {
 		return fmt.Sprintf(`**Role:** You are an expert in visual storytelling and image generation prompting. You need to generate a single prompt that describes a 3x3 grid action sequence.
 
@@ -275,6 +357,9 @@ You must return a **JSON object** with the following structure:
 // GetLastFramePrompt 获取尾帧提示词
 func (p *PromptI18n) GetLastFramePrompt(style string) string {
 	imageRatio := "16:9"
+	if body, ok := p.templateOverride(PromptKeyLastFrame, map[string]string{"style": style, "image_ratio": imageRatio}); ok {
+		return body
+	}
 	if p.IsEnglish() {
 		return fmt.Sprintf(`You are a professional image generation prompt expert. Please generate prompts suitable for AI image generation based on the provided shot information.
 
@@ -314,6 +399,10 @@ Return a JSON object containing:
 
 // GetOutlineGenerationPrompt 获取大纲生成提示词
 func (p *PromptI18n) GetOutlineGenerationPrompt() string {
+	if body, ok := p.templateOverride(PromptKeyOutlineGeneration, nil); ok {
+		return body
+	}
+
 	if p.IsEnglish() {
 		return `You are a professional short drama screenwriter. Based on the theme and number of episodes, create a complete short drama outline and plan the plot direction for each episode.
 
@@ -358,6 +447,9 @@ Return a JSON object containing:
 // GetCharacterExtractionPrompt 获取角色提取提示词
 func (p *PromptI18n) GetCharacterExtractionPrompt(style string) string {
 	imageRatio := "16:9"
+	if body, ok := p.templateOverride(PromptKeyCharacterExtraction, map[string]string{"style": style, "image_ratio": imageRatio}); ok {
+		return body
+	}
 	if p.IsEnglish() {
 		return fmt.Sprintf(`You are a professional character analyst, skilled at extracting and analyzing character information from scripts.
 
@@ -404,6 +496,14 @@ Each element is a character object containing the above fields.`, style, imageRa
 // GetPropExtractionPrompt 获取道具提取提示词
 func (p *PromptI18n) GetPropExtractionPrompt(style string) string {
 	imageRatio := "1:1"
+	// 返回值由调用方再用剧本内容格式化，模板中的 % 需要转义，{{script}} 渲染为 %s
+	if body, ok := p.activeTemplate(PromptKeyPropExtraction); ok {
+		return renderPromptTemplate(strings.ReplaceAll(body, "%", "%%"), map[string]string{
+			"style":       strings.ReplaceAll(style, "%", "%%"),
+			"image_ratio": imageRatio,
+			"script":      "%s",
+		})
+	}
 
 	if p.IsEnglish() {
 		return fmt.Sprintf(`Please extract key props from the following script.
@@ -454,6 +554,10 @@ JSON数组，每个对象包含：
 
 // GetEpisodeScriptPrompt 获取分集剧本生成提示词
 func (p *PromptI18n) GetEpisodeScriptPrompt() string {
+	if body, ok := p.templateOverride(PromptKeyEpisodeScript, nil); ok {
+		return body
+	}
+
 	if p.IsEnglish() {
 		return `You are a professional short drama screenwriter. You excel at creating detailed plot content based on episode plans.
 
@@ -499,80 +603,83 @@ Output Format:
   - script_content: 详细剧本内容（800-1200字）`
 }
 
+// userPromptLabels 用户提示词中的固定文案，语言包可按 key 覆盖
+var userPromptLabels = map[string]map[string]string{
+	"en": {
+
+		"outline_request":        "Please create a short drama outline for the following theme:\n\nTheme: %s",
+		"genre_preference":       "\nGenre preference: %s",
+		"style_requirement":      "\nStyle requirement: %s",
+		"episode_count":          "\nNumber of episodes: %d episodes",
+		"episode_importance":     "\n\n**Important: Must plan complete storylines for all %d episodes in the episodes array, each with clear story content!**",
+		"character_request":      "Script content:\n%s\n\nPlease extract and organize detailed character profiles for up to %d main characters from the script.",
+		"episode_script_request": "Drama outline:\n%s\n%s\nPlease create detailed scripts for %d episodes based on the above outline and characters.\n\n**Important requirements:**\n- Must generate all %d episodes, from episode 1 to episode %d, cannot skip any\n- Each episode is about 3-5 minutes (150-300 seconds)\n- The duration field for each episode should be set reasonably based on script content length, not all the same value\n- The episodes array in the returned JSON must contain %d elements",
+		"frame_info":             "Shot information:\n%s\n\nPlease directly generate the image prompt for the first frame without any explanation:",
+		"key_frame_info":         "Shot information:\n%s\n\nPlease directly generate the image prompt for the key frame without any explanation:",
+		"last_frame_info":        "Shot information:\n%s\n\nPlease directly generate the image prompt for the last frame without any explanation:",
+		"script_content_label":   "【Script Content】",
+		"storyboard_list_label":  "【Storyboard List】",
+		"task_label":             "【Task】",
+		"character_list_label":   "【Available Character List】",
+		"scene_list_label":       "【Extracted Scene Backgrounds】",
+		"task_instruction":       "Break down the novel script into storyboard shots based on **independent action units**.",
+		"character_constraint":   "**Important**: In the characters field, only use character IDs (numbers) from the above character list. Do not create new characters or use other IDs.",
+		"scene_constraint":       "**Important**: In the scene_id field, select the most matching background ID (number) from the above background list. If no suitable background exists, use null.",
+		"shot_description_label": "Shot description: %s",
+		"scene_label":            "Scene: %s, %s",
+		"characters_label":       "Characters: %s",
+		"action_label":           "Action: %s",
+		"result_label":           "Result: %s",
+		"dialogue_label":         "Dialogue: %s",
+		"atmosphere_label":       "Atmosphere: %s",
+		"shot_type_label":        "Shot type: %s",
+		"angle_label":            "Angle: %s",
+		"movement_label":         "Movement: %s",
+		"drama_info_template":    "Title: %s\nSummary: %s\nGenre: %s",
+	},
+	"zh": {
+		"outline_request":        "请为以下主题创作短剧大纲：\n\n主题：%s",
+		"genre_preference":       "\n类型偏好：%s",
+		"style_requirement":      "\n风格要求：%s",
+		"episode_count":          "\n剧集数量：%d集",
+		"episode_importance":     "\n\n**重要：必须在episodes数组中规划完整的%d集剧情，每集都要有明确的故事内容！**",
+		"character_request":      "剧本内容：\n%s\n\n请从剧本中提取并整理最多 %d 个主要角色的详细设定。",
+		"episode_script_request": "剧本大纲：\n%s\n%s\n请基于以上大纲和角色，创作 %d 集的详细剧本。\n\n**重要要求：**\n- 必须生成完整的 %d 集，从第1集到第%d集，不能遗漏\n- 每集约3-5分钟（150-300秒）\n- 每集的duration字段要根据剧本内容长度合理设置，不要都设置为同一个值\n- 返回的JSON中episodes数组必须包含 %d 个元素",
+		"frame_info":             "镜头信息：\n%s\n\n请直接生成首帧的图像提示词，不要任何解释：",
+		"key_frame_info":         "镜头信息：\n%s\n\n请直接生成关键帧的图像提示词，不要任何解释：",
+		"last_frame_info":        "镜头信息：\n%s\n\n请直接生成尾帧的图像提示词，不要任何解释：",
+		"script_content_label":   "【剧本内容】",
+		"storyboard_list_label":  "【分镜头列表】",
+		"task_label":             "【任务】",
+		"character_list_label":   "【本剧可用角色列表】",
+		"scene_list_label":       "【本剧已提取的场景背景列表】",
+		"task_instruction":       "将小说剧本按**独立动作单元**拆解为分镜头方案。",
+		"character_constraint":   "**重要**：在characters字段中，只能使用上述角色列表中的角色ID（数字），不得自创角色或使用其他ID。",
+		"scene_constraint":       "**重要**：在scene_id字段中，必须从上述背景列表中选择最匹配的背景ID（数字）。如果没有合适的背景，则填null。",
+		"shot_description_label": "镜头描述: %s",
+		"scene_label":            "场景: %s, %s",
+		"characters_label":       "角色: %s",
+		"action_label":           "动作: %s",
+		"result_label":           "结果: %s",
+		"dialogue_label":         "对白: %s",
+		"atmosphere_label":       "氛围: %s",
+		"shot_type_label":        "景别: %s",
+		"angle_label":            "角度: %s",
+		"movement_label":         "运镜: %s",
+		"drama_info_template":    "剧名：%s\n简介：%s\n类型：%s",
+	},
+}
+
 // FormatUserPrompt 格式化用户提示词的通用文本
 func (p *PromptI18n) FormatUserPrompt(key string, args ...interface{}) string {
-	templates := map[string]map[string]string{
-		"en": {
-
-			"outline_request":        "Please create a short drama outline for the following theme:\n\nTheme: %s",
-			"genre_preference":       "\nGenre preference: %s",
-			"style_requirement":      "\nStyle requirement: %s",
-			"episode_count":          "\nNumber of episodes: %d episodes",
-			"episode_importance":     "\n\n**Important: Must plan complete storylines for all %d episodes in the episodes array, each with clear story content!**",
-			"character_request":      "Script content:\n%s\n\nPlease extract and organize detailed character profiles for up to %d main characters from the script.",
-			"episode_script_request": "Drama outline:\n%s\n%s\nPlease create detailed scripts for %d episodes based on the above outline and characters.\n\n**Important requirements:**\n- Must generate all %d episodes, from episode 1 to episode %d, cannot skip any\n- Each episode is about 3-5 minutes (150-300 seconds)\n- The duration field for each episode should be set reasonably based on script content length, not all the same value\n- The episodes array in the returned JSON must contain %d elements",
-			"frame_info":             "Shot information:\n%s\n\nPlease directly generate the image prompt for the first frame without any explanation:",
-			"key_frame_info":         "Shot information:\n%s\n\nPlease directly generate the image prompt for the key frame without any explanation:",
-			"last_frame_info":        "Shot information:\n%s\n\nPlease directly generate the image prompt for the last frame without any explanation:",
-			"script_content_label":   "【Script Content】",
-			"storyboard_list_label":  "【Storyboard List】",
-			"task_label":             "【Task】",
-			"character_list_label":   "【Available Character List】",
-			"scene_list_label":       "【Extracted Scene Backgrounds】",
-			"task_instruction":       "Break down the novel script into storyboard shots based on **independent action units**.",
-			"character_constraint":   "**Important**: In the characters field, only use character IDs (numbers) from the above character list. Do not create new characters or use other IDs.",
-			"scene_constraint":       "**Important**: In the scene_id field, select the most matching background ID (number) from the above background list. If no suitable background exists, use null.",
-			"shot_description_label": "Shot description: %s",
-			"scene_label":            "Scene: %s, %s",
-			"characters_label":       "Characters: %s",
-			"action_label":           "Action: %s",
-			"result_label":           "Result: %s",
-			"dialogue_label":         "Dialogue: %s",
-			"atmosphere_label":       "Atmosphere: %s",
-			"shot_type_label":        "Shot type: %s",
-			"angle_label":            "Angle: %s",
-			"movement_label":         "Movement: %s",
-			"drama_info_template":    "Title: %s\nSummary: %s\nGenre: %s",
-		},
-		"zh": {
-			"outline_request":        "请为以下主题创作短剧大纲：\n\n主题：%s",
-			"genre_preference":       "\n类型偏好：%s",
-			"style_requirement":      "\n风格要求：%s",
-			"episode_count":          "\n剧集数量：%d集",
-			"episode_importance":     "\n\n**重要：必须在episodes数组中规划完整的%d集剧情，每集都要有明确的故事内容！**",
-			"character_request":      "剧本内容：\n%s\n\n请从剧本中提取并整理最多 %d 个主要角色的详细设定。",
-			"episode_script_request": "剧本大纲：\n%s\n%s\n请基于以上大纲和角色，创作 %d 集的详细剧本。\n\n**重要要求：**\n- 必须生成完整的 %d 集，从第1集到第%d集，不能遗漏\n- 每集约3-5分钟（150-300秒）\n- 每集的duration字段要根据剧本内容长度合理设置，不要都设置为同一个值\n- 返回的JSON中episodes数组必须包含 %d 个元素",
-			"frame_info":             "镜头信息：\n%s\n\n请直接生成首帧的图像提示词，不要任何解释：",
-			"key_frame_info":         "镜头信息：\n%s\n\n请直接生成关键帧的图像提示词，不要任何解释：",
-			"last_frame_info":        "镜头信息：\n%s\n\n请直接生成尾帧的图像提示词，不要任何解释：",
-			"script_content_label":   "【剧本内容】",
-			"storyboard_list_label":  "【分镜头列表】",
-			"task_label":             "【任务】",
-			"character_list_label":   "【本剧可用角色列表】",
-			"scene_list_label":       "【本剧已提取的场景背景列表】",
-			"task_instruction":       "将小说剧本按**独立动作单元**拆解为分镜头方案。",
-			"character_constraint":   "**重要**：在characters字段中，只能使用上述角色列表中的角色ID（数字），不得自创角色或使用其他ID。",
-			"scene_constraint":       "**重要**：在scene_id字段中，必须从上述背景列表中选择最匹配的背景ID（数字）。如果没有合适的背景，则填null。",
-			"shot_description_label": "镜头描述: %s",
-			"scene_label":            "场景: %s, %s",
-			"characters_label":       "角色: %s",
-			"action_label":           "动作: %s",
-			"result_label":           "结果: %s",
-			"dialogue_label":         "对白: %s",
-			"atmosphere_label":       "氛围: %s",
-			"shot_type_label":        "景别: %s",
-			"angle_label":            "角度: %s",
-			"movement_label":         "运镜: %s",
-			"drama_info_template":    "剧名：%s\n简介：%s\n类型：%s",
-		},
-	}
-
-	lang := "zh"
-	if p.IsEnglish() {
-		lang = "en"
+	template, ok := p.packLabel(key)
+	if !ok {
+		lang := "zh"
+		if p.IsEnglish() {
+			lang = "en"
+		}
+		template, ok = userPromptLabels[lang][key]
 	}
-
-	template, ok := templates[lang][key]
 	if !ok {
 		return ""
 	}
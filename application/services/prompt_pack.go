@@ -0,0 +1,201 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 中英文提示词内置在代码中，其余语言通过语言包提供
+const (
+	promptLanguageZH = "zh"
+	promptLanguageEN = "en"
+)
+
+var ErrInvalidPromptPack = errors.New("invalid prompt pack")
+
+//go:embed prompt_packs/*.json
+var builtinPromptPacks embed.FS
+
+var (
+	promptLanguageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+	promptFormatVerbPattern   = regexp.MustCompile(`%[sdvqf]`)
+)
+
+// PromptPack 提示词语言包。Prompts 以模板 key 为键，正文使用与提示词模板相同的 {{变量}}；
+// Labels 覆盖 FormatUserPrompt 的文案，格式化占位需与英文一致。缺失的条目回退到英文
+type PromptPack struct {
+	Language string            `json:"language"`
+	Name     string            `json:"name"`
+	Prompts  map[string]string `json:"prompts"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// PromptLanguage 可选的提示词语言
+type PromptLanguage struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// promptPackRegistry 已加载的语言包，由 LanguageService 持有
+type promptPackRegistry struct {
+	mu    sync.RWMutex
+	packs map[string]PromptPack
+}
+
+// newPromptPackRegistry 加载内置语言包，dir 不为空时再加载目录下的语言包
+func newPromptPackRegistry(dir string) (*promptPackRegistry, error) {
+	registry := &promptPackRegistry{packs: map[string]PromptPack{}}
+	if _, err := registry.loadFS(builtinPromptPacks, "prompt_packs"); err != nil {
+		return nil, fmt.Errorf("failed to load builtin prompt packs: %w", err)
+	}
+	if dir != "" {
+		if _, err := registry.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, fmt.Errorf("failed to load prompt packs from %s: %w", dir, err)
+		}
+	}
+	return registry, nil
+}
+
+func (pack *PromptPack) validate() error {
+	pack.Language = strings.TrimSpace(pack.Language)
+	if !promptLanguageCodePattern.MatchString(pack.Language) {
+		return fmt.Errorf("%w: invalid language %q", ErrInvalidPromptPack, pack.Language)
+	}
+	if pack.Language == promptLanguageZH || pack.Language == promptLanguageEN {
+		return fmt.Errorf("%w: %s is built in", ErrInvalidPromptPack, pack.Language)
+	}
+	if pack.Name == "" {
+		pack.Name = pack.Language
+	}
+
+	for key, body := range pack.Prompts {
+		spec, ok := promptTemplateSpecs[key]
+		if !ok {
+			return fmt.Errorf("%w: %s: unknown prompt %q", ErrInvalidPromptPack, pack.Language, key)
+		}
+		for _, name := range promptTemplateVariables(body) {
+			if !slices.Contains(spec.Variables, name) {
+				return fmt.Errorf("%w: %s: prompt %q uses unknown variable %q", ErrInvalidPromptPack, pack.Language, key, name)
+			}
+		}
+	}
+	for key, label := range pack.Labels {
+		english, ok := userPromptLabels[promptLanguageEN][key]
+		if !ok {
+			return fmt.Errorf("%w: %s: unknown label %q", ErrInvalidPromptPack, pack.Language, key)
+		}
+		if !slices.Equal(promptFormatVerbPattern.FindAllString(label, -1), promptFormatVerbPattern.FindAllString(english, -1)) {
+			return fmt.Errorf("%w: %s: label %q must keep the placeholders of %q", ErrInvalidPromptPack, pack.Language, key, english)
+		}
+	}
+	return nil
+}
+
+// register 注册或替换语言包
+func (r *promptPackRegistry) register(pack PromptPack) error {
+	if err := pack.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.packs[pack.Language] = pack
+	return nil
+}
+
+// loadFS 加载目录下的 *.json 语言包，与已有语言包同语言时替换之
+func (r *promptPackRegistry) loadFS(fsys fs.FS, dir string) (int, error) {
+	paths, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.json")))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(paths)
+
+	loaded := 0
+	for _, path := range paths {
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return loaded, err
+		}
+		var pack PromptPack
+		if err := json.Unmarshal(data, &pack); err != nil {
+			return loaded, fmt.Errorf("%w: %s: %v", ErrInvalidPromptPack, filepath.Base(path), err)
+		}
+		if err := r.register(pack); err != nil {
+			return loaded, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+func (r *promptPackRegistry) lookup(language string) (PromptPack, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pack, ok := r.packs[language]
+	return pack, ok
+}
+
+// supported 内置的 zh、en 或已注册语言包的语言
+func (r *promptPackRegistry) supported(language string) bool {
+	if language == promptLanguageZH || language == promptLanguageEN {
+		return true
+	}
+	_, ok := r.lookup(language)
+	return ok
+}
+
+// languages 按 zh、en、语言包的顺序列出可选语言
+func (r *promptPackRegistry) languages() []PromptLanguage {
+	languages := []PromptLanguage{
+		{Code: promptLanguageZH, Name: "中文"},
+		{Code: promptLanguageEN, Name: "English"},
+	}
+
+	r.mu.RLock()
+	packs := make([]PromptLanguage, 0, len(r.packs))
+	for _, pack := range r.packs {
+		packs = append(packs, PromptLanguage{Code: pack.Language, Name: pack.Name})
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Code < packs[j].Code })
+	return append(languages, packs...)
+}
+
+// lookupPack 当前语言的语言包，未关联 LanguageService 时只有内置中英文
+func (p *PromptI18n) lookupPack() (PromptPack, bool) {
+	if p.languages == nil {
+		return PromptPack{}, false
+	}
+	return p.languages.packs.lookup(p.GetLanguage())
+}
+
+// packPrompt 当前语言的语言包正文（未渲染）
+func (p *PromptI18n) packPrompt(key string) (string, bool) {
+	pack, ok := p.lookupPack()
+	if !ok {
+		return "", false
+	}
+	body, ok := pack.Prompts[key]
+	return body, ok && body != ""
+}
+
+// packLabel 当前语言的语言包文案
+func (p *PromptI18n) packLabel(key string) (string, bool) {
+	pack, ok := p.lookupPack()
+	if !ok {
+		return "", false
+	}
+	label, ok := pack.Labels[key]
+	return label, ok && label != ""
+}
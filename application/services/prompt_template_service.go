@@ -0,0 +1,443 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// 可在线调整的提示词模板 key，与 PromptI18n 的 getter 一一对应
+const (
+	PromptKeyStoryboardSystem    = "storyboard_system"
+	PromptKeySceneExtraction     = "scene_extraction"
+	PromptKeyFirstFrame          = "first_frame"
+	PromptKeyKeyFrame            = "key_frame"
+	PromptKeyLastFrame           = "last_frame"
+	PromptKeyActionSequenceFrame = "action_sequence_frame"
+	PromptKeyOutlineGeneration   = "outline_generation"
+	PromptKeyCharacterExtraction = "character_extraction"
+	PromptKeyPropExtraction      = "prop_extraction"
+	PromptKeyEpisodeScript       = "episode_script"
+)
+
+const (
+	promptTemplateSourceBuiltin   = "builtin"
+	promptTemplateSourceTemplate  = "template"
+	promptTemplateDefaultLanguage = "zh"
+)
+
+var (
+	ErrPromptTemplateNotFound      = errors.New("prompt template not found")
+	ErrPromptTemplateDramaNotFound = errors.New("drama not found")
+	ErrUnknownPromptTemplateKey    = errors.New("unknown prompt template key")
+	ErrUnsupportedPromptLanguage   = errors.New("unsupported prompt template language")
+	ErrUnknownPromptVariable       = errors.New("unknown prompt template variable")
+)
+
+// promptTemplateSpec 内置提示词的说明、可用变量，以及以 {{变量}} 占位的内置正文
+type promptTemplateSpec struct {
+	Description string
+	Variables   []string
+	builtin     func(p *PromptI18n) string
+}
+
+var promptTemplateSpecs = map[string]promptTemplateSpec{
+	PromptKeyStoryboardSystem: {
+		Description: "分镜拆分系统提示词",
+		builtin:     func(p *PromptI18n) string { return p.GetStoryboardSystemPrompt() },
+	},
+	PromptKeySceneExtraction: {
+		Description: "场景背景提取",
+		Variables:   []string{"style", "image_ratio"},
+		builtin:     func(p *PromptI18n) string { return p.GetSceneExtractionPrompt("{{style}}") },
+	},
+	PromptKeyFirstFrame: {
+		Description: "首帧提示词",
+		Variables:   []string{"style", "image_ratio"},
+		builtin:     func(p *PromptI18n) string { return p.GetFirstFramePrompt("{{style}}") },
+	},
+	PromptKeyKeyFrame: {
+		Description: "关键帧提示词",
+		Variables:   []string{"style", "image_ratio"},
+		builtin:     func(p *PromptI18n) string { return p.GetKeyFramePrompt("{{style}}") },
+	},
+	PromptKeyLastFrame: {
+		Description: "尾帧提示词",
+		Variables:   []string{"style", "image_ratio"},
+		builtin:     func(p *PromptI18n) string { return p.GetLastFramePrompt("{{style}}") },
+	},
+	PromptKeyActionSequenceFrame: {
+		Description: "九宫格动作序列提示词",
+		Variables:   []string{"style", "image_ratio"},
+		builtin:     func(p *PromptI18n) string { return p.GetActionSequenceFramePrompt("{{style}}") },
+	},
+	PromptKeyOutlineGeneration: {
+		Description: "大纲生成",
+		builtin:     func(p *PromptI18n) string { return p.GetOutlineGenerationPrompt() },
+	},
+	PromptKeyCharacterExtraction: {
+		Description: "角色提取",
+		Variables:   []string{"style", "image_ratio"},
+		builtin:     func(p *PromptI18n) string { return p.GetCharacterExtractionPrompt("{{style}}") },
+	},
+	PromptKeyPropExtraction: {
+		Description: "道具提取，{{script}} 为剧本内容",
+		Variables:   []string{"style", "image_ratio", "script"},
+		builtin: func(p *PromptI18n) string {
+			return fmt.Sprintf(p.GetPropExtractionPrompt("{{style}}"), "{{script}}")
+		},
+	},
+	PromptKeyEpisodeScript: {
+		Description: "分集剧本生成",
+		builtin:     func(p *PromptI18n) string { return p.GetEpisodeScriptPrompt() },
+	},
+}
+
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// renderPromptTemplate 替换模板中的 {{变量}}，未提供的变量原样保留
+func renderPromptTemplate(body string, vars map[string]string) string {
+	return promptVariablePattern.ReplaceAllStringFunc(body, func(match string) string {
+		name := promptVariablePattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// promptTemplateVariables 按出现顺序返回模板中使用的变量名
+func promptTemplateVariables(body string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, match := range promptVariablePattern.FindAllStringSubmatch(body, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// builtinTemplate 内置提示词正文（含语言包），变量以 {{变量}} 占位
+func (s *PromptTemplateService) builtinTemplate(key, language string) string {
+	spec, ok := promptTemplateSpecs[key]
+	if !ok {
+		return ""
+	}
+	p := &PromptI18n{config: &config.Config{App: config.AppConfig{Language: language}}, languages: s.languages, builtinOnly: true}
+	return spec.builtin(p)
+}
+
+// PromptTemplateService 管理数据库中的提示词模板版本
+type PromptTemplateService struct {
+	db  *gorm.DB
+	log *logger.Logger
+	// languages 校验模板语言并提供语言包中的默认正文
+	languages *LanguageService
+}
+
+func NewPromptTemplateService(db *gorm.DB, log *logger.Logger, languages *LanguageService) *PromptTemplateService {
+	return &PromptTemplateService{db: db, log: log, languages: languages}
+}
+
+type CreatePromptTemplateRequest struct {
+	Key      string `json:"key" binding:"required"`
+	Language string `json:"language"`
+	Body     string `json:"body" binding:"required"`
+	UserID   uint   `json:"user_id"` // 仅管理员可指定，普通用户固定为本人
+	DramaID  uint   `json:"drama_id"`
+	Note     string `json:"note"`
+	Activate *bool  `json:"activate"` // 默认立即生效
+}
+
+type PromptTemplateFilter struct {
+	Key      string
+	Language string
+	UserID   *uint
+	DramaID  *uint
+}
+
+type PromptTemplatePreviewRequest struct {
+	Key       string            `json:"key" binding:"required"`
+	Language  string            `json:"language"`
+	Body      string            `json:"body"` // 为空时预览当前作用域下生效的模板
+	UserID    uint              `json:"user_id"`
+	DramaID   uint              `json:"drama_id"`
+	Variables map[string]string `json:"variables"`
+}
+
+type PromptTemplatePreview struct {
+	Source     string `json:"source"` // builtin 或 template
+	TemplateID uint   `json:"template_id,omitempty"`
+	Version    int    `json:"version,omitempty"`
+	Body       string `json:"body"`
+	Rendered   string `json:"rendered"`
+}
+
+type PromptTemplateKeyInfo struct {
+	Key         string   `json:"key"`
+	Description string   `json:"description"`
+	Variables   []string `json:"variables"`
+	Default     string   `json:"default"`
+}
+
+// ListKeys 列出可调整的提示词及其内置正文
+func (s *PromptTemplateService) ListKeys(language string) ([]PromptTemplateKeyInfo, error) {
+	language, err := s.normalizeLanguage(language)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(promptTemplateSpecs))
+	for key := range promptTemplateSpecs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	infos := make([]PromptTemplateKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		spec := promptTemplateSpecs[key]
+		variables := spec.Variables
+		if variables == nil {
+			variables = []string{}
+		}
+		infos = append(infos, PromptTemplateKeyInfo{
+			Key:         key,
+			Description: spec.Description,
+			Variables:   variables,
+			Default:     s.builtinTemplate(key, language),
+		})
+	}
+	return infos, nil
+}
+
+// ListTemplates 列出模板版本。owner 非 0 时只返回该用户的模板，0 表示管理员查看全部
+func (s *PromptTemplateService) ListTemplates(owner uint, filter PromptTemplateFilter) ([]models.PromptTemplate, error) {
+	query := s.db.Model(&models.PromptTemplate{})
+	if owner != 0 {
+		query = query.Where("user_id = ?", owner)
+	} else if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.DramaID != nil {
+		query = query.Where("drama_id = ?", *filter.DramaID)
+	}
+	if filter.Key != "" {
+		query = query.Where("template_key = ?", filter.Key)
+	}
+	if filter.Language != "" {
+		query = query.Where("language = ?", filter.Language)
+	}
+
+	var templates []models.PromptTemplate
+	err := query.Order("template_key ASC, language ASC, user_id ASC, drama_id ASC, version DESC").Find(&templates).Error
+	return templates, err
+}
+
+func (s *PromptTemplateService) GetTemplate(owner uint, id uint) (*models.PromptTemplate, error) {
+	query := s.db.Where("id = ?", id)
+	if owner != 0 {
+		query = query.Where("user_id = ?", owner)
+	}
+	var template models.PromptTemplate
+	if err := query.First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+// CreateVersion 在作用域下保存新版本，默认立即生效并停用同作用域的其他版本
+func (s *PromptTemplateService) CreateVersion(owner, createdBy uint, req *CreatePromptTemplateRequest) (*models.PromptTemplate, error) {
+	spec, ok := promptTemplateSpecs[req.Key]
+	if !ok {
+		return nil, ErrUnknownPromptTemplateKey
+	}
+	language, err := s.normalizeLanguage(req.Language)
+	if err != nil {
+		return nil, err
+	}
+	variables := promptTemplateVariables(req.Body)
+	for _, name := range variables {
+		if !slices.Contains(spec.Variables, name) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPromptVariable, name)
+		}
+	}
+	userID, dramaID, err := s.resolveScope(owner, req.UserID, req.DramaID)
+	if err != nil {
+		return nil, err
+	}
+	activate := req.Activate == nil || *req.Activate
+
+	template := &models.PromptTemplate{
+		TemplateKey: req.Key,
+		Language:    language,
+		UserID:      userID,
+		DramaID:     dramaID,
+		Body:        req.Body,
+		Variables:   datatypes.JSONSlice[string](variables),
+		Note:        req.Note,
+		IsActive:    activate,
+		CreatedBy:   createdBy,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		scope := promptTemplateScope(tx, template)
+		var latest int
+		if err := scope.Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		template.Version = latest + 1
+		if activate {
+			if err := promptTemplateScope(tx, template).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(template).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// ActivateVersion 启用指定版本，用于回滚到旧版本
+func (s *PromptTemplateService) ActivateVersion(owner uint, id uint) (*models.PromptTemplate, error) {
+	template, err := s.GetTemplate(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := promptTemplateScope(tx, template).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.PromptTemplate{}).Where("id = ?", template.ID).Update("is_active", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	template.IsActive = true
+	return template, nil
+}
+
+// DeactivateVersion 停用版本，该作用域回退到上一级模板或内置提示词
+func (s *PromptTemplateService) DeactivateVersion(owner uint, id uint) (*models.PromptTemplate, error) {
+	template, err := s.GetTemplate(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.PromptTemplate{}).Where("id = ?", template.ID).Update("is_active", false).Error; err != nil {
+		return nil, err
+	}
+	template.IsActive = false
+	return template, nil
+}
+
+func (s *PromptTemplateService) DeleteVersion(owner uint, id uint) error {
+	template, err := s.GetTemplate(owner, id)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(&models.PromptTemplate{}, template.ID).Error
+}
+
+// Preview 用给定变量渲染模板；未传 body 时渲染该作用域下实际生效的模板
+func (s *PromptTemplateService) Preview(owner uint, req *PromptTemplatePreviewRequest) (*PromptTemplatePreview, error) {
+	if _, ok := promptTemplateSpecs[req.Key]; !ok {
+		return nil, ErrUnknownPromptTemplateKey
+	}
+	language, err := s.normalizeLanguage(req.Language)
+	if err != nil {
+		return nil, err
+	}
+	userID, dramaID, err := s.resolveScope(owner, req.UserID, req.DramaID)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &PromptTemplatePreview{Source: promptTemplateSourceTemplate, Body: req.Body}
+	if preview.Body == "" {
+		template, err := s.Resolve(req.Key, language, userID, dramaID)
+		if err != nil {
+			return nil, err
+		}
+		if template != nil {
+			preview.TemplateID = template.ID
+			preview.Version = template.Version
+			preview.Body = template.Body
+		} else {
+			preview.Source = promptTemplateSourceBuiltin
+			preview.Body = s.builtinTemplate(req.Key, language)
+		}
+	}
+	preview.Rendered = renderPromptTemplate(preview.Body, req.Variables)
+	return preview, nil
+}
+
+// Resolve 按剧 > 用户 > 平台的顺序查找生效的模板，都没有时返回 nil
+func (s *PromptTemplateService) Resolve(key, language string, userID, dramaID uint) (*models.PromptTemplate, error) {
+	query := s.db.Where("template_key = ? AND language = ? AND is_active = ?", key, language, true)
+	if userID == 0 {
+		query = query.Where("user_id = 0 AND drama_id = 0")
+	} else {
+		query = query.Where("(user_id = 0 AND drama_id = 0) OR (user_id = ? AND drama_id IN ?)", userID, []uint{0, dramaID})
+	}
+
+	var template models.PromptTemplate
+	if err := query.Order("drama_id DESC, user_id DESC").First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+// resolveScope 校验模板作用域：普通用户只能作用于本人和本人的剧，剧级模板归属剧的所有者
+func (s *PromptTemplateService) resolveScope(owner, userID, dramaID uint) (uint, uint, error) {
+	if owner != 0 {
+		userID = owner
+	}
+	if dramaID == 0 {
+		return userID, 0, nil
+	}
+
+	var drama models.Drama
+	query := s.db.Select("id", "user_id").Where("id = ?", dramaID)
+	if owner != 0 {
+		query = query.Where("user_id = ?", owner)
+	}
+	if err := query.First(&drama).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, 0, ErrPromptTemplateDramaNotFound
+		}
+		return 0, 0, err
+	}
+	return drama.UserID, drama.ID, nil
+}
+
+func promptTemplateScope(tx *gorm.DB, template *models.PromptTemplate) *gorm.DB {
+	return tx.Model(&models.PromptTemplate{}).Where(
+		"template_key = ? AND language = ? AND user_id = ? AND drama_id = ?",
+		template.TemplateKey, template.Language, template.UserID, template.DramaID,
+	)
+}
+
+func (s *PromptTemplateService) normalizeLanguage(language string) (string, error) {
+	if language == "" {
+		return promptTemplateDefaultLanguage, nil
+	}
+	if !s.languages.IsSupported(language) {
+		return "", ErrUnsupportedPromptLanguage
+	}
+	return language, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+func newPromptTemplateTestService(t *testing.T) (*PromptTemplateService, *gorm.DB) {
+	t.Helper()
+
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.PromptTemplate{}, &models.Drama{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	languages, err := NewLanguageService(db, &config.Config{}, logger.NewLogger(true))
+	if err != nil {
+		t.Fatalf("failed to create language service: %v", err)
+	}
+	svc := NewPromptTemplateService(db, logger.NewLogger(true), languages)
+	return svc, db
+}
+
+func TestPromptTemplateService_VersionsAndRollback(t *testing.T) {
+	svc, _ := newPromptTemplateTestService(t)
+
+	first, err := svc.CreateVersion(0, 1, &CreatePromptTemplateRequest{Key: PromptKeyStoryboardSystem, Body: "v1"})
+	if err != nil {
+		t.Fatalf("failed to create v1: %v", err)
+	}
+	second, err := svc.CreateVersion(0, 1, &CreatePromptTemplateRequest{Key: PromptKeyStoryboardSystem, Body: "v2"})
+	if err != nil {
+		t.Fatalf("failed to create v2: %v", err)
+	}
+	if first.Version != 1 || second.Version != 2 {
+		t.Fatalf("unexpected versions: %d, %d", first.Version, second.Version)
+	}
+
+	prompts := NewPromptI18n(&config.Config{}, svc, nil)
+	if got := prompts.GetStoryboardSystemPrompt(); got != "v2" {
+		t.Fatalf("expected latest version, got %q", got)
+	}
+
+	if _, err := svc.ActivateVersion(0, first.ID); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+	if got := prompts.GetStoryboardSystemPrompt(); got != "v1" {
+		t.Fatalf("expected rolled back version, got %q", got)
+	}
+	reloaded, err := svc.GetTemplate(0, second.ID)
+	if err != nil {
+		t.Fatalf("failed to reload v2: %v", err)
+	}
+	if reloaded.IsActive {
+		t.Fatalf("expected v2 to be deactivated after rollback")
+	}
+
+	if _, err := svc.DeactivateVersion(0, first.ID); err != nil {
+		t.Fatalf("failed to deactivate: %v", err)
+	}
+	if got := prompts.GetStoryboardSystemPrompt(); got != svc.builtinTemplate(PromptKeyStoryboardSystem, "zh") {
+		t.Fatalf("expected builtin prompt after deactivation, got %q", got)
+	}
+}
+
+func TestPromptTemplateService_OverridePriority(t *testing.T) {
+	svc, db := newPromptTemplateTestService(t)
+
+	drama := models.Drama{UserID: 7, Title: "测试剧"}
+	if err := db.Create(&drama).Error; err != nil {
+		t.Fatalf("failed to create drama: %v", err)
+	}
+	create := func(owner uint, req CreatePromptTemplateRequest) {
+		t.Helper()
+		req.Key = PromptKeyFirstFrame
+		if _, err := svc.CreateVersion(owner, owner, &req); err != nil {
+			t.Fatalf("failed to create template: %v", err)
+		}
+	}
+	create(0, CreatePromptTemplateRequest{Body: "platform {{style}}"})
+	create(7, CreatePromptTemplateRequest{Body: "user {{style}} {{image_ratio}}"})
+	create(7, CreatePromptTemplateRequest{Body: "drama {{style}}", DramaID: drama.ID})
+
+	prompts := NewPromptI18n(&config.Config{}, svc, nil)
+	cases := []struct {
+		userID, dramaID uint
+		want            string
+	}{
+		{7, drama.ID, "drama anime"},
+		{7, drama.ID + 1, "user anime 16:9"},
+		{8, drama.ID, "platform anime"},
+		{0, 0, "platform anime"},
+	}
+	for _, tc := range cases {
+		if got := prompts.ForDrama(tc.userID, tc.dramaID).GetFirstFramePrompt("anime"); got != tc.want {
+			t.Fatalf("user %d drama %d: expected %q, got %q", tc.userID, tc.dramaID, tc.want, got)
+		}
+	}
+
+	if _, err := svc.CreateVersion(8, 8, &CreatePromptTemplateRequest{Key: PromptKeyFirstFrame, Body: "x", DramaID: drama.ID}); !errors.Is(err, ErrPromptTemplateDramaNotFound) {
+		t.Fatalf("expected other user's drama to be rejected, got %v", err)
+	}
+	templates, err := svc.ListTemplates(8, PromptTemplateFilter{})
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(templates) != 0 {
+		t.Fatalf("expected no templates visible to user 8, got %d", len(templates))
+	}
+}
+
+func TestPromptTemplateService_RejectsUnknownVariables(t *testing.T) {
+	svc, _ := newPromptTemplateTestService(t)
+
+	_, err := svc.CreateVersion(0, 1, &CreatePromptTemplateRequest{Key: PromptKeyFirstFrame, Body: "{{style}} {{unknown}}"})
+	if !errors.Is(err, ErrUnknownPromptVariable) {
+		t.Fatalf("expected unknown variable error, got %v", err)
+	}
+	if _, err := svc.CreateVersion(0, 1, &CreatePromptTemplateRequest{Key: "missing", Body: "x"}); !errors.Is(err, ErrUnknownPromptTemplateKey) {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+	if _, err := svc.CreateVersion(0, 1, &CreatePromptTemplateRequest{Key: PromptKeyFirstFrame, Language: "fr", Body: "x"}); !errors.Is(err, ErrUnsupportedPromptLanguage) {
+		t.Fatalf("expected unsupported language error, got %v", err)
+	}
+}
+
+func TestPromptI18n_PropExtractionTemplateKeepsScriptPlaceholder(t *testing.T) {
+	svc, _ := newPromptTemplateTestService(t)
+
+	body := "风格 {{style}}，透明度 50%\n{{script}}"
+	if _, err := svc.CreateVersion(0, 1, &CreatePromptTemplateRequest{Key: PromptKeyPropExtraction, Body: body}); err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+
+	template := NewPromptI18n(&config.Config{}, svc, nil).GetPropExtractionPrompt("100%写实")
+	got := fmt.Sprintf(template, "剧本正文")
+	if !strings.Contains(got, "透明度 50%") || !strings.Contains(got, "100%写实") || !strings.HasSuffix(got, "剧本正文") {
+		t.Fatalf("unexpected rendered prompt: %q", got)
+	}
+}
+
+func TestPromptTemplateService_PreviewFallsBackToBuiltin(t *testing.T) {
+	svc, _ := newPromptTemplateTestService(t)
+
+	preview, err := svc.Preview(0, &PromptTemplatePreviewRequest{Key: PromptKeyKeyFrame, Language: "en", Variables: map[string]string{"style": "ink"}})
+	if err != nil {
+		t.Fatalf("failed to preview: %v", err)
+	}
+	if preview.Source != promptTemplateSourceBuiltin {
+		t.Fatalf("expected builtin source, got %q", preview.Source)
+	}
+	if !strings.Contains(preview.Rendered, "ink") || strings.Contains(preview.Rendered, "{{style}}") {
+		t.Fatalf("expected style to be rendered, got %q", preview.Rendered)
+	}
+}
@@ -1,8 +1,11 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	// Added missing import
@@ -10,7 +13,7 @@ import (
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
-	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/drama-generator/backend/pkg/usage"
 	"gorm.io/gorm"
 )
 
@@ -27,16 +30,16 @@ type PropService struct {
 	dispatcher             JobDispatcher
 }
 
-func NewPropService(db *gorm.DB, aiService *AIService, taskService *TaskService, imageGenerationService *ImageGenerationService, log *logger.Logger, cfg *config.Config, dispatcher JobDispatcher) *PropService {
+func NewPropService(db *gorm.DB, aiService *AIService, taskService *TaskService, imageGenerationService *ImageGenerationService, log *logger.Logger, cfg *config.Config, dispatcher JobDispatcher, promptI18n *PromptI18n) *PropService {
 	return &PropService{
 		db:                     db,
 		aiService:              aiService,
-		billing:                NewBillingService(db, cfg, log),
+		billing:                NewBillingService(db, cfg, taskService.webhooks, log),
 		taskService:            taskService,
 		imageGenerationService: imageGenerationService,
 		log:                    log,
 		config:                 cfg,
-		promptI18n:             NewPromptI18n(cfg),
+		promptI18n:             promptI18n,
 		runner:                 NewTaskRunner(log, 4),
 		dispatcher:             dispatcher,
 	}
@@ -73,7 +76,7 @@ func (s *PropService) ExtractPropsFromScript(userID uint, episodeID uint) (strin
 		return "", fmt.Errorf("episode not found: %w", err)
 	}
 
-	task, created, err := s.taskService.CreateOrGetActiveTask("prop_extraction", fmt.Sprintf("%d", episodeID))
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, "prop_extraction", fmt.Sprintf("%d", episodeID))
 	if err != nil {
 		return "", err
 	}
@@ -90,7 +93,7 @@ func (s *PropService) ExtractPropsFromScript(userID uint, episodeID uint) (strin
 	if err := s.dispatchPropExtraction(payload); err != nil {
 		s.log.Warnw("Failed to dispatch prop extraction through task bus, fallback to local runner", "error", err, "task_id", task.ID, "episode_id", episode.ID)
 		s.runner.Submit("prop.extract_from_script", func() {
-			s.ProcessPropExtraction(userID, task.ID, episode)
+			s.ProcessPropExtraction(context.Background(), userID, task.ID, episode)
 		})
 	}
 
@@ -113,7 +116,16 @@ func (s *PropService) dispatchPropExtraction(payload PropExtractionJobPayload) e
 	})
 }
 
-func (s *PropService) ProcessPropExtraction(userID uint, taskID string, episode models.Episode) {
+// ProcessPropExtraction 从剧本提取道具，临时性错误返回给任务总线重试
+func (s *PropService) ProcessPropExtraction(ctx context.Context, userID uint, taskID string, episode models.Episode) error {
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	defer s.taskService.RefundCancelled(ctx, taskID, s.billing)
+	if ctx.Err() != nil {
+		s.log.Infow("Prop extraction cancelled before start", "task_id", taskID)
+		return nil
+	}
+
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在分析剧本...")
 
 	script := ""
@@ -127,15 +139,9 @@ func (s *PropService) ProcessPropExtraction(userID uint, taskID string, episode
 		s.log.Warnw("Failed to load drama", "error", err, "drama_id", episode.DramaID)
 	}
 
-	promptTemplate := s.promptI18n.GetPropExtractionPrompt(drama.Style)
+	promptTemplate := s.promptI18n.ForDrama(userID, episode.DramaID).GetPropExtractionPrompt(drama.Style)
 	prompt := fmt.Sprintf(promptTemplate, script)
 
-	response, err := s.generateTextBilled(userID, "", prompt, "", ai.WithMaxTokens(2000))
-	if err != nil {
-		s.taskService.UpdateTaskError(taskID, err)
-		return
-	}
-
 	var extractedProps []struct {
 		Name        string `json:"name"`
 		Type        string `json:"type"`
@@ -143,9 +149,29 @@ func (s *PropService) ProcessPropExtraction(userID uint, taskID string, episode
 		ImagePrompt string `json:"image_prompt"`
 	}
 
-	if err := utils.SafeParseAIJSON(response, &extractedProps); err != nil {
-		s.taskService.UpdateTaskError(taskID, fmt.Errorf("解析AI结果失败: %w", err))
-		return
+	_, err := s.generateStructuredBilled(ctx, userID, "", ai.StructuredRequest{
+		Prompt:     prompt,
+		SchemaName: "props",
+		Cache:      true,
+		Options:    []func(*ai.ChatCompletionRequest){ai.WithMaxTokens(2000)},
+		Validate: func() error {
+			for i, p := range extractedProps {
+				if strings.TrimSpace(p.Name) == "" {
+					return fmt.Errorf("第 %d 个道具缺少 name", i+1)
+				}
+			}
+			return nil
+		},
+	}, &extractedProps)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.log.Infow("Prop extraction cancelled", "task_id", taskID)
+			return nil
+		}
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			err = fmt.Errorf("解析AI结果失败: %w", err)
+		}
+		return s.taskService.failOrRetry(ctx, taskID, err)
 	}
 
 	s.taskService.UpdateTaskStatus(taskID, "processing", 50, "正在保存道具...")
@@ -170,6 +196,7 @@ func (s *PropService) ProcessPropExtraction(userID uint, taskID string, episode
 	}
 
 	s.taskService.UpdateTaskResult(taskID, createdProps)
+	return nil
 }
 
 // GeneratePropImage 生成道具图片
@@ -194,7 +221,7 @@ func (s *PropService) GeneratePropImage(userID uint, propID uint) (string, error
 	}
 
 	// 2. 创建任务
-	task, created, err := s.taskService.CreateOrGetActiveTask("prop_image_generation", fmt.Sprintf("%d", propID))
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, "prop_image_generation", fmt.Sprintf("%d", propID))
 	if err != nil {
 		return "", err
 	}
@@ -204,12 +231,13 @@ func (s *PropService) GeneratePropImage(userID uint, propID uint) (string, error
 	}
 
 	s.runner.Submit("prop.generate_image", func() {
-		s.processPropImageGeneration(task.ID, prop)
+		s.processPropImageGeneration(context.Background(), task.ID, prop)
 	})
 	return task.ID, nil
 }
 
-func (s *PropService) generateTextBilled(userID uint, model string, userPrompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+// generateStructuredBilled 预扣积分后请求结构化输出，每次模型返回都会记录用量，最终失败时退款
+func (s *PropService) generateStructuredBilled(ctx context.Context, userID uint, model string, req ai.StructuredRequest, v interface{}) (string, error) {
 	cfg, actualModel, err := s.aiService.GetBillingConfig("text", model, userID)
 	if err != nil {
 		return "", err
@@ -219,6 +247,7 @@ func (s *PropService) generateTextBilled(userID uint, model string, userPrompt s
 	if err != nil {
 		return "", err
 	}
+	noteTaskBilling(ctx, refID)
 
 	client, err := s.aiService.GetAIClientForModelWithUser("text", actualModel, userID)
 	if err != nil {
@@ -226,16 +255,21 @@ func (s *PropService) generateTextBilled(userID uint, model string, userPrompt s
 		return "", err
 	}
 
-	out, err := client.GenerateText(userPrompt, systemPrompt, options...)
+	req.OnResponse = func(_ int, _ string, used usage.TokenUsage) { recordTextUsage(s.billing, refID, used) }
+	out, err := ai.GenerateStructuredContext(ctx, client, req, v)
 	if err != nil {
 		_ = s.billing.RefundAI(refID)
-		return "", err
+		return out, err
 	}
-	recordTextUsage(s.billing, refID, client)
+	settleTextBilling(s.billing, refID, client)
 	return out, nil
 }
 
-func (s *PropService) processPropImageGeneration(taskID string, prop models.Prop) {
+// processPropImageGeneration 提交图片生成并轮询结果，任务取消或 ctx 结束时停止轮询
+func (s *PropService) processPropImageGeneration(ctx context.Context, taskID string, prop models.Prop) {
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在生成图片...")
 
 	// 准备生成参数
@@ -265,7 +299,10 @@ func (s *PropService) processPropImageGeneration(taskID string, prop models.Prop
 	pollInterval := 2 * time.Second
 
 	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(pollInterval)
+		if !sleepContext(ctx, pollInterval) {
+			s.log.Infow("Prop image generation cancelled, stopping poll", "prop_id", prop.ID, "task_id", taskID)
+			return
+		}
 
 		// 重新加载 imageGen
 		var currentImageGen models.ImageGeneration
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func TestPropService_ImagePollingStopsWhenContextEnds(t *testing.T) {
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.ImageGeneration{}, &models.Drama{}, &models.Prop{}, &models.AsyncTask{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	seedAIConfig(t, db, 0, "image", "openai", "image", "gpt-image-1", 1, 10)
+
+	log := logger.NewLogger(true)
+	cfg := &config.Config{}
+	taskService := NewTaskService(db, log, NewTaskEventHub(), nil)
+	images := &ImageGenerationService{
+		db:             db,
+		aiService:      NewAIService(db, cfg, log),
+		billingService: NewBillingService(db, cfg, nil, log),
+		taskService:    taskService,
+		dispatcher:     &capturingDispatcher{},
+		config:         cfg,
+		log:            log,
+	}
+	svc := NewPropService(db, images.aiService, taskService, images, log, cfg, &capturingDispatcher{}, nil)
+
+	user := models.User{Email: "prop@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 50}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	drama := models.Drama{UserID: user.ID, Title: "测试短剧"}
+	if err := db.Create(&drama).Error; err != nil {
+		t.Fatalf("failed to create drama: %v", err)
+	}
+	prompt := "一把旧钥匙"
+	prop := models.Prop{UserID: user.ID, DramaID: drama.ID, Name: "钥匙", Prompt: &prompt}
+	if err := db.Create(&prop).Error; err != nil {
+		t.Fatalf("failed to create prop: %v", err)
+	}
+	task, _, err := taskService.CreateOrGetActiveTask(user.ID, "prop_image_generation", "1")
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	// 图片任务只派发不执行，轮询会一直等到 ctx 结束
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		svc.processPropImageGeneration(ctx, task.ID, prop)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected polling to stop when the context ends")
+	}
+
+	var imageGens int64
+	db.Model(&models.ImageGeneration{}).Where("prop_id = ?", prop.ID).Count(&imageGens)
+	if imageGens != 1 {
+		t.Fatalf("expected the image generation to be submitted, got %d", imageGens)
+	}
+	reloaded, _ := taskService.GetTask(task.ID)
+	if reloaded.Status == "failed" {
+		t.Fatalf("expected cancelled polling not to report a timeout, got %s", reloaded.Error)
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	deadLetterErrorHeader    = "x-error"
+	deadLetterAttemptsHeader = "x-attempts"
+	// deadLetterScanLimit 查找单条死信时最多扫描的消息数
+	deadLetterScanLimit = 1000
+)
+
+// ErrDeadJobNotFound 死信队列中不存在该任务
+var ErrDeadJobNotFound = errors.New("dead job not found")
+
+// DeadJob 重试耗尽或无法处理的任务
+type DeadJob struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	DeadAt   time.Time       `json:"dead_at"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Raw      string          `json:"raw,omitempty"` // 无法解析的原始消息
+}
+
+// DeadLetterStore 死信任务的查询与重放
+type DeadLetterStore interface {
+	ListDeadJobs(limit int) ([]DeadJob, error)
+	GetDeadJob(id string) (*DeadJob, error)
+	ReplayDeadJob(id string) (*DeadJob, error)
+}
+
+// settleDeadLetter 将消息转入死信队列后确认原消息，转入失败时丢弃原消息
+func (b *RabbitMQTaskBus) settleDeadLetter(delivery amqp.Delivery, jobType string, body []byte, attempts int, cause error) {
+	if err := b.publishDeadLetter(jobType, body, attempts, cause); err != nil {
+		if b.log != nil {
+			b.log.Errorw("Failed to publish dead letter, discarding job", "job_type", jobType, "error", err)
+		}
+		_ = delivery.Reject(false)
+		return
+	}
+	_ = delivery.Ack(false)
+}
+
+func (b *RabbitMQTaskBus) publishDeadLetter(jobType string, body []byte, attempts int, cause error) error {
+	return b.publishCh.PublishWithContext(
+		context.Background(),
+		"",
+		b.deadQueueName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    uuid.New().String(),
+			Timestamp:    time.Now(),
+			Type:         jobType,
+			Body:         body,
+			Headers: amqp.Table{
+				deadLetterErrorHeader:    cause.Error(),
+				deadLetterAttemptsHeader: int32(attempts),
+			},
+		},
+	)
+}
+
+// ListDeadJobs 查看死信队列中的任务，消息读取后不确认，关闭通道时重新入队
+func (b *RabbitMQTaskBus) ListDeadJobs(limit int) ([]DeadJob, error) {
+	if limit <= 0 || limit > deadLetterScanLimit {
+		limit = 50
+	}
+
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter channel: %w", err)
+	}
+	defer ch.Close()
+
+	jobs := make([]DeadJob, 0)
+	for len(jobs) < limit {
+		delivery, ok, err := ch.Get(b.deadQueueName, false)
+		if err != nil {
+			return nil, fmt.Errorf("read dead letter queue: %w", err)
+		}
+		if !ok {
+			break
+		}
+		jobs = append(jobs, deadJobFromDelivery(delivery))
+	}
+	return jobs, nil
+}
+
+// GetDeadJob 查看单条死信任务
+func (b *RabbitMQTaskBus) GetDeadJob(id string) (*DeadJob, error) {
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter channel: %w", err)
+	}
+	defer ch.Close()
+
+	delivery, err := findDeadLetter(ch, b.deadQueueName, id)
+	if err != nil {
+		return nil, err
+	}
+	job := deadJobFromDelivery(delivery)
+	return &job, nil
+}
+
+// ReplayDeadJob 将死信任务重新投递到任务队列，执行次数从头计算
+func (b *RabbitMQTaskBus) ReplayDeadJob(id string) (*DeadJob, error) {
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter channel: %w", err)
+	}
+	defer ch.Close()
+
+	delivery, err := findDeadLetter(ch, b.deadQueueName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var job AsyncJob
+	if err := json.Unmarshal(delivery.Body, &job); err != nil {
+		return nil, fmt.Errorf("dead job %s has invalid payload: %w", id, err)
+	}
+	job.Attempt = 0
+	if err := b.Dispatch(job); err != nil {
+		return nil, fmt.Errorf("replay dead job: %w", err)
+	}
+	if err := delivery.Ack(false); err != nil {
+		return nil, fmt.Errorf("ack replayed dead job: %w", err)
+	}
+
+	if b.log != nil {
+		b.log.Infow("Dead job replayed", "id", id, "job_type", job.Type)
+	}
+	replayed := deadJobFromDelivery(delivery)
+	return &replayed, nil
+}
+
+func findDeadLetter(ch *amqp.Channel, queueName, id string) (amqp.Delivery, error) {
+	for i := 0; i < deadLetterScanLimit; i++ {
+		delivery, ok, err := ch.Get(queueName, false)
+		if err != nil {
+			return amqp.Delivery{}, fmt.Errorf("read dead letter queue: %w", err)
+		}
+		if !ok {
+			break
+		}
+		if delivery.MessageId == id {
+			return delivery, nil
+		}
+	}
+	return amqp.Delivery{}, ErrDeadJobNotFound
+}
+
+func deadJobFromDelivery(delivery amqp.Delivery) DeadJob {
+	job := DeadJob{
+		ID:     delivery.MessageId,
+		Type:   delivery.Type,
+		DeadAt: delivery.Timestamp,
+	}
+	if msg, ok := delivery.Headers[deadLetterErrorHeader].(string); ok {
+		job.Error = msg
+	}
+	switch attempts := delivery.Headers[deadLetterAttemptsHeader].(type) {
+	case int32:
+		job.Attempts = int(attempts)
+	case int64:
+		job.Attempts = int(attempts)
+	}
+
+	var asyncJob AsyncJob
+	if err := json.Unmarshal(delivery.Body, &asyncJob); err != nil {
+		job.Raw = string(delivery.Body)
+		return job
+	}
+	if job.Type == "" {
+		job.Type = asyncJob.Type
+	}
+	job.Payload = asyncJob.Payload
+	return job
+}
@@ -20,22 +20,39 @@ type JobDispatcher interface {
 	DispatchDelayed(job AsyncJob, delay time.Duration) error
 }
 
+// JobQueue 可注册处理函数并消费任务的队列，由 RabbitMQTaskBus 或 DBJobQueue 实现
+type JobQueue interface {
+	JobDispatcher
+	Register(jobType string, handler JobHandler)
+	Start() error
+	Stop(ctx context.Context) error
+}
+
 type RabbitMQTaskBus struct {
 	cfg            config.MQConfig
+	retry          *JobRetryPolicies
 	log            *logger.Logger
 	queueName      string
 	delayQueueName string
+	deadQueueName  string
 
 	conn      *amqp.Connection
 	publishCh *amqp.Channel
 	consumeCh *amqp.Channel
 	pool      *WorkerPool
 
+	// jobsCtx 传给任务处理函数，关闭宽限期结束时取消以中止进行中的 AI 调用
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+
+	eventCh       *amqp.Channel
+	eventExchange string
+
 	mu       sync.RWMutex
 	handlers map[string]JobHandler
 }
 
-func NewRabbitMQTaskBus(cfg config.MQConfig, log *logger.Logger) (*RabbitMQTaskBus, error) {
+func NewRabbitMQTaskBus(cfg config.MQConfig, retry *JobRetryPolicies, log *logger.Logger) (*RabbitMQTaskBus, error) {
 	if !cfg.Enabled {
 		return nil, nil
 	}
@@ -64,6 +81,7 @@ func NewRabbitMQTaskBus(cfg config.MQConfig, log *logger.Logger) (*RabbitMQTaskB
 
 	queueName := fmt.Sprintf("%s.task.default", normalizeQueuePrefix(cfg.QueuePrefix))
 	delayQueueName := queueName + ".delay"
+	deadQueueName := queueName + ".dead"
 	if _, err := publishCh.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
 		_ = consumeCh.Close()
 		_ = publishCh.Close()
@@ -80,6 +98,12 @@ func NewRabbitMQTaskBus(cfg config.MQConfig, log *logger.Logger) (*RabbitMQTaskB
 		_ = conn.Close()
 		return nil, fmt.Errorf("declare delay queue: %w", err)
 	}
+	if _, err := publishCh.QueueDeclare(deadQueueName, true, false, false, false, nil); err != nil {
+		_ = consumeCh.Close()
+		_ = publishCh.Close()
+		_ = conn.Close()
+		return nil, fmt.Errorf("declare dead letter queue: %w", err)
+	}
 	if _, err := consumeCh.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
 		_ = consumeCh.Close()
 		_ = publishCh.Close()
@@ -87,15 +111,20 @@ func NewRabbitMQTaskBus(cfg config.MQConfig, log *logger.Logger) (*RabbitMQTaskB
 		return nil, fmt.Errorf("declare consumer queue: %w", err)
 	}
 
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
 	return &RabbitMQTaskBus{
 		cfg:            cfg,
+		retry:          retry,
 		log:            log,
 		queueName:      queueName,
 		delayQueueName: delayQueueName,
+		deadQueueName:  deadQueueName,
 		conn:           conn,
 		publishCh:      publishCh,
 		consumeCh:      consumeCh,
 		pool:           NewWorkerPool(log, cfg.ConsumerConcurrency),
+		jobsCtx:        jobsCtx,
+		cancelJobs:     cancelJobs,
 		handlers:       make(map[string]JobHandler),
 	}, nil
 }
@@ -201,8 +230,17 @@ func (b *RabbitMQTaskBus) Stop(ctx context.Context) error {
 	}
 
 	var errs []error
-	if err := b.pool.Stop(ctx); err != nil && !errors.Is(err, context.Canceled) {
-		errs = append(errs, err)
+	if err := b.pool.Stop(ctx); err != nil {
+		// 宽限期内未完成的任务被中止，未确认的消息在通道关闭后由 RabbitMQ 重新投递
+		b.cancelJobs()
+		if !errors.Is(err, context.Canceled) {
+			errs = append(errs, err)
+		}
+	}
+	if b.eventCh != nil {
+		if err := b.eventCh.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 	if b.consumeCh != nil {
 		if err := b.consumeCh.Close(); err != nil {
@@ -229,9 +267,9 @@ func (b *RabbitMQTaskBus) handleDelivery(delivery amqp.Delivery) {
 	var job AsyncJob
 	if err := json.Unmarshal(delivery.Body, &job); err != nil {
 		if b.log != nil {
-			b.log.Errorw("Discarding invalid rabbitmq job payload", "error", err)
+			b.log.Errorw("Dead-lettering invalid rabbitmq job payload", "error", err)
 		}
-		_ = delivery.Reject(false)
+		b.settleDeadLetter(delivery, delivery.Type, delivery.Body, 1, fmt.Errorf("invalid job payload: %w", err))
 		return
 	}
 
@@ -240,21 +278,56 @@ func (b *RabbitMQTaskBus) handleDelivery(delivery amqp.Delivery) {
 	b.mu.RUnlock()
 	if !ok {
 		if b.log != nil {
-			b.log.Errorw("Discarding rabbitmq job without handler", "job_type", job.Type)
+			b.log.Errorw("Dead-lettering rabbitmq job without handler", "job_type", job.Type)
 		}
-		_ = delivery.Reject(false)
+		b.settleDeadLetter(delivery, job.Type, delivery.Body, job.Attempt+1, fmt.Errorf("no handler registered for job type %s", job.Type))
+		return
+	}
+
+	attempt := job.Attempt + 1
+	policy := b.retry.ForJob(job.Type)
+	err := handler(withJobAttempt(b.jobsCtx, attempt, policy), job)
+	if b.jobsCtx.Err() != nil {
+		// 关闭时被中止，放回队列且不计入执行次数
+		_ = delivery.Nack(false, true)
+		return
+	}
+	if err == nil {
+		_ = delivery.Ack(false)
 		return
 	}
 
-	if err := handler(context.Background(), job); err != nil {
+	if policy.ShouldRetry(attempt, err) {
+		retry := job
+		retry.Attempt = attempt
+		delay := policy.Backoff(attempt)
+		dispatchErr := b.DispatchDelayed(retry, delay)
+		if dispatchErr == nil {
+			if b.log != nil {
+				b.log.Warnw("Rabbitmq job failed, retry scheduled",
+					"job_type", job.Type,
+					"attempt", attempt,
+					"max_attempts", policy.MaxAttempts,
+					"delay", delay.String(),
+					"error", err)
+			}
+			_ = delivery.Ack(false)
+			return
+		}
 		if b.log != nil {
-			b.log.Errorw("Rabbitmq job handler failed", "job_type", job.Type, "error", err)
+			b.log.Errorw("Failed to schedule rabbitmq job retry", "job_type", job.Type, "error", dispatchErr)
 		}
-		_ = delivery.Reject(false)
-		return
 	}
 
-	_ = delivery.Ack(false)
+	if b.log != nil {
+		b.log.Errorw("Rabbitmq job handler failed, moving to dead letter queue", "job_type", job.Type, "attempt", attempt, "error", err)
+	}
+	job.Attempt = attempt
+	body, marshalErr := json.Marshal(job)
+	if marshalErr != nil {
+		body = delivery.Body
+	}
+	b.settleDeadLetter(delivery, job.Type, body, attempt, err)
 }
 
 func normalizeQueuePrefix(prefix string) string {
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// EnableTaskEventFanout 通过 fanout 交换机在多实例间广播任务事件
+// 每个实例声明独占的临时队列，收到的事件（包括本实例发出的）投递给本地订阅者
+func (b *RabbitMQTaskBus) EnableTaskEventFanout(hub *TaskEventHub) error {
+	if b == nil || hub == nil {
+		return nil
+	}
+
+	exchange := fmt.Sprintf("%s.task.events", normalizeQueuePrefix(b.cfg.QueuePrefix))
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open task event channel: %w", err)
+	}
+	if err := ch.ExchangeDeclare(exchange, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("declare task event exchange: %w", err)
+	}
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("declare task event queue: %w", err)
+	}
+	if err := ch.QueueBind(queue.Name, "", exchange, false, nil); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("bind task event queue: %w", err)
+	}
+	deliveries, err := ch.Consume(queue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("consume task event queue: %w", err)
+	}
+
+	b.eventCh = ch
+	b.eventExchange = exchange
+	go func() {
+		for delivery := range deliveries {
+			var event TaskEvent
+			if err := json.Unmarshal(delivery.Body, &event); err != nil {
+				if b.log != nil {
+					b.log.Warnw("Dropping invalid task event", "error", err)
+				}
+				continue
+			}
+			hub.Deliver(event)
+		}
+	}()
+
+	hub.SetBroadcaster(b)
+	if b.log != nil {
+		b.log.Infow("Task event fanout enabled", "exchange", exchange, "queue", queue.Name)
+	}
+	return nil
+}
+
+// BroadcastTaskEvent 发布任务事件到 fanout 交换机
+func (b *RabbitMQTaskBus) BroadcastTaskEvent(event TaskEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal task event: %w", err)
+	}
+	return b.publishCh.PublishWithContext(
+		context.Background(),
+		b.eventExchange,
+		"",
+		false,
+		false,
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		},
+	)
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/music"
+	"gorm.io/gorm"
+)
+
+const (
+	episodeScoreTaskType = "episode_score"
+	// scoreMusicCategory / scoreEffectCategory 配乐与音效素材分类，按提示词复用
+	scoreMusicCategory  = "bgm"
+	scoreEffectCategory = "sfx"
+)
+
+// ScoreService 根据分镜的 BgmPrompt 与 SoundEffect 生成剧集配乐和音效
+type ScoreService struct {
+	db             *gorm.DB
+	aiService      *AIService
+	billingService *BillingService
+	taskService    *TaskService
+	storagePath    string
+	baseURL        string
+	log            *logger.Logger
+	runner         *TaskRunner
+	dispatcher     JobDispatcher
+}
+
+func NewScoreService(db *gorm.DB, cfg *config.Config, aiService *AIService, taskService *TaskService, dispatcher JobDispatcher, log *logger.Logger) *ScoreService {
+	return &ScoreService{
+		db:             db,
+		aiService:      aiService,
+		billingService: NewBillingService(db, cfg, taskService.webhooks, log),
+		taskService:    taskService,
+		storagePath:    cfg.Storage.LocalPath,
+		baseURL:        cfg.Storage.BaseURL,
+		log:            log,
+		runner:         NewTaskRunner(log, 2),
+		dispatcher:     dispatcher,
+	}
+}
+
+type GenerateScoreRequest struct {
+	Model       string `json:"model"`
+	SkipEffects bool   `json:"skip_effects"` // 只生成配乐
+	Regenerate  bool   `json:"regenerate"`   // 忽略已有素材，全部重新生成
+}
+
+// ScoreRange 连续使用相同配乐提示词的分镜区间（秒）
+type ScoreRange struct {
+	Prompt        string  `json:"prompt"`
+	StoryboardIDs []uint  `json:"storyboard_ids"`
+	Start         float64 `json:"start"`
+	End           float64 `json:"end"`
+}
+
+// buildScoreRanges 合并相邻且配乐提示词相同的分镜，使同一段音乐跨镜头连续播放
+func buildScoreRanges(windows []sceneWindow, prompts map[uint]string) []ScoreRange {
+	var ranges []ScoreRange
+	for _, w := range windows {
+		prompt := strings.TrimSpace(prompts[w.SceneID])
+		if prompt == "" {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].Prompt == prompt && ranges[n-1].End >= w.Start {
+			ranges[n-1].StoryboardIDs = append(ranges[n-1].StoryboardIDs, w.SceneID)
+			ranges[n-1].End = w.End
+			continue
+		}
+		ranges = append(ranges, ScoreRange{
+			Prompt:        prompt,
+			StoryboardIDs: []uint{w.SceneID},
+			Start:         w.Start,
+			End:           w.End,
+		})
+	}
+	return ranges
+}
+
+// scorePromptHash 配乐/音效提示词的 sha256，作为素材复用的匹配键
+func scorePromptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(prompt)))
+	return hex.EncodeToString(sum[:])
+}
+
+// findScoreAsset 查找同一剧集下相同提示词最近生成的配乐/音效
+func findScoreAsset(db *gorm.DB, episodeID uint, category, prompt string) (*models.Asset, error) {
+	var asset models.Asset
+	err := db.Where("episode_id = ? AND type = ? AND category = ? AND prompt_hash = ?", episodeID, models.AssetTypeAudio, category, scorePromptHash(prompt)).
+		Order("id DESC").First(&asset).Error
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// GenerateEpisodeScore 创建剧集配乐任务，返回任务ID
+func (s *ScoreService) GenerateEpisodeScore(userID, episodeID uint, req *GenerateScoreRequest) (string, error) {
+	var episode models.Episode
+	if err := s.db.Where("id = ? AND user_id = ?", episodeID, userID).First(&episode).Error; err != nil {
+		return "", ErrEpisodeNotFound
+	}
+
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, episodeScoreTaskType, strconv.FormatUint(uint64(episode.ID), 10))
+	if err != nil {
+		return "", fmt.Errorf("创建任务失败: %w", err)
+	}
+	if !created {
+		s.log.Infow("Reusing active score task", "task_id", task.ID, "episode_id", episode.ID)
+		return task.ID, nil
+	}
+
+	payload := EpisodeScoreJobPayload{
+		UserID:      userID,
+		TaskID:      task.ID,
+		EpisodeID:   episode.ID,
+		Model:       req.Model,
+		SkipEffects: req.SkipEffects,
+		Regenerate:  req.Regenerate,
+	}
+	if err := s.dispatchEpisodeScore(payload); err != nil {
+		s.log.Warnw("Failed to dispatch score generation through task bus, fallback to local runner", "error", err, "task_id", task.ID)
+		s.runner.Submit("score.generate", func() {
+			s.ProcessEpisodeScore(context.Background(), payload)
+		})
+	}
+
+	return task.ID, nil
+}
+
+func (s *ScoreService) dispatchEpisodeScore(payload EpisodeScoreJobPayload) error {
+	if s.dispatcher == nil {
+		return fmt.Errorf("task dispatcher not configured")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal score job payload: %w", err)
+	}
+
+	return s.dispatcher.Dispatch(AsyncJob{
+		Type:    JobTypeEpisodeScore,
+		Payload: body,
+	})
+}
+
+// scoreGenerator 延迟解析配乐模型配置，全部复用已有素材时不要求配置
+type scoreGenerator struct {
+	cfg    *models.AIServiceConfig
+	model  string
+	client music.MusicClient
+}
+
+// ProcessEpisodeScore 后台为每段配乐区间和每个音效生成或复用音频，临时性错误返回给任务总线重试，已生成的音频在重试时复用
+func (s *ScoreService) ProcessEpisodeScore(ctx context.Context, payload EpisodeScoreJobPayload) error {
+	taskID := payload.TaskID
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	if ctx.Err() != nil {
+		s.log.Infow("Task cancelled before start", "task_id", taskID)
+		return nil
+	}
+
+	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 0, "开始生成配乐..."); err != nil {
+		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
+		return nil
+	}
+
+	var episode models.Episode
+	if err := s.db.Where("id = ? AND user_id = ?", payload.EpisodeID, payload.UserID).First(&episode).Error; err != nil {
+		return s.failScore(ctx, taskID, ErrEpisodeNotFound)
+	}
+
+	var storyboards []models.Storyboard
+	if err := s.db.Where("episode_id = ?", episode.ID).Order("storyboard_number ASC").Find(&storyboards).Error; err != nil {
+		return s.failScore(ctx, taskID, fmt.Errorf("failed to load storyboards: %w", err))
+	}
+
+	scenes := make([]models.SceneClip, 0, len(storyboards))
+	prompts := make(map[uint]string, len(storyboards))
+	effects := make(map[uint]string, len(storyboards))
+	numbers := make(map[uint]int, len(storyboards))
+	for i, sb := range storyboards {
+		scenes = append(scenes, models.SceneClip{SceneID: sb.ID, Duration: float64(sb.Duration), Order: i})
+		numbers[sb.ID] = sb.StoryboardNumber
+		if sb.BgmPrompt != nil {
+			prompts[sb.ID] = *sb.BgmPrompt
+		}
+		if sb.SoundEffect != nil && !payload.SkipEffects {
+			effects[sb.ID] = strings.TrimSpace(*sb.SoundEffect)
+		}
+	}
+	windows := buildSceneWindows(scenes)
+	ranges := buildScoreRanges(windows, prompts)
+
+	type scoreJob struct {
+		category     string
+		prompt       string
+		duration     float64
+		storyboardID uint
+	}
+	var jobs []scoreJob
+	for _, r := range ranges {
+		jobs = append(jobs, scoreJob{category: scoreMusicCategory, prompt: r.Prompt, duration: r.End - r.Start, storyboardID: r.StoryboardIDs[0]})
+	}
+	for _, w := range windows {
+		if effect := effects[w.SceneID]; effect != "" {
+			jobs = append(jobs, scoreJob{category: scoreEffectCategory, prompt: effect, duration: w.End - w.Start, storyboardID: w.SceneID})
+		}
+	}
+
+	var generator *scoreGenerator
+	var assetIDs []uint
+	musicCount, effectCount, reused := 0, 0, 0
+	for i, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return s.failScore(ctx, taskID, err)
+		}
+
+		asset, err := findScoreAsset(s.db, episode.ID, job.category, job.prompt)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.failScore(ctx, taskID, fmt.Errorf("failed to lookup score asset: %w", err))
+		}
+		if asset != nil && !payload.Regenerate {
+			reused++
+		} else {
+			if generator == nil {
+				cfg, model, err := s.aiService.GetBillingConfig("music", payload.Model, payload.UserID)
+				if err != nil {
+					return s.failScore(ctx, taskID, fmt.Errorf("no music AI config found: %w", err))
+				}
+				generator = &scoreGenerator{cfg: cfg, model: model, client: s.getMusicClient(cfg, model)}
+			}
+			asset, err = s.generateScoreAsset(ctx, payload.UserID, &episode, job.storyboardID, numbers[job.storyboardID], job.category, job.prompt, job.duration, generator)
+			if err != nil {
+				return s.failScore(ctx, taskID, fmt.Errorf("镜头 %d %s生成失败: %w", numbers[job.storyboardID], scoreCategoryLabel(job.category), err))
+			}
+		}
+
+		assetIDs = append(assetIDs, asset.ID)
+		if job.category == scoreMusicCategory {
+			musicCount++
+		} else {
+			effectCount++
+		}
+
+		progress := (i + 1) * 100 / len(jobs)
+		if progress >= 100 {
+			progress = 99
+		}
+		if err := s.taskService.UpdateTaskStatus(taskID, "processing", progress, fmt.Sprintf("已完成 %d/%d 段配乐/音效", i+1, len(jobs))); err != nil {
+			s.log.Warnw("Failed to update score progress", "error", err, "task_id", taskID)
+		}
+	}
+
+	if err := s.taskService.UpdateTaskResult(taskID, map[string]interface{}{
+		"episode_id":   episode.ID,
+		"ranges":       ranges,
+		"asset_ids":    assetIDs,
+		"music_count":  musicCount,
+		"effect_count": effectCount,
+		"reused_count": reused,
+	}); err != nil {
+		s.log.Errorw("Failed to update score task result", "error", err, "task_id", taskID)
+	}
+
+	s.log.Infow("Episode score generated", "episode_id", episode.ID, "music", musicCount, "effects", effectCount, "reused", reused)
+	return nil
+}
+
+func (s *ScoreService) generateScoreAsset(ctx context.Context, userID uint, episode *models.Episode, storyboardID uint, storyboardNum int, category, prompt string, duration float64, generator *scoreGenerator) (*models.Asset, error) {
+	refID, err := s.billingService.ReserveAI(userID, "music", generator.model, generator.cfg.CreditCost, fmt.Sprintf("score:%s:%d", category, storyboardID))
+	if err != nil {
+		return nil, err
+	}
+	// 素材落库前的任一步失败都退还预扣，成功保存后才记录用量
+	refund := func() {
+		if refID == "" {
+			return
+		}
+		if err := s.billingService.RefundAI(refID); err != nil {
+			s.log.Errorw("Failed to refund score reservation", "error", err, "ref_id", refID)
+		}
+	}
+
+	var result *music.MusicResult
+	if category == scoreMusicCategory {
+		result, err = generator.client.GenerateMusicContext(ctx, prompt, music.WithDuration(duration))
+	} else {
+		result, err = generator.client.GenerateSoundEffectContext(ctx, prompt, music.WithDuration(duration))
+	}
+	if err != nil {
+		refund()
+		return nil, err
+	}
+	used := generator.client.GetLastUsage()
+
+	dir := filepath.Join(s.storagePath, "audio", "score")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		refund()
+		return nil, fmt.Errorf("failed to create audio directory: %w", err)
+	}
+	format := result.Format
+	if format == "" {
+		format = "mp3"
+	}
+	fileName := fmt.Sprintf("%s_sb%d_%d.%s", category, storyboardID, time.Now().UnixNano(), format)
+	relPath := filepath.ToSlash(filepath.Join("audio", "score", fileName))
+	absPath := filepath.Join(s.storagePath, relPath)
+	if err := os.WriteFile(absPath, result.Audio, 0644); err != nil {
+		refund()
+		return nil, fmt.Errorf("failed to save audio: %w", err)
+	}
+
+	dramaID := episode.DramaID
+	episodeID := episode.ID
+	sbID := storyboardID
+	sbNum := storyboardNum
+	assetCategory := category
+	description := prompt
+	promptHash := scorePromptHash(prompt)
+	fileSize := int64(len(result.Audio))
+	asset := &models.Asset{
+		UserID:        userID,
+		DramaID:       &dramaID,
+		EpisodeID:     &episodeID,
+		StoryboardID:  &sbID,
+		StoryboardNum: &sbNum,
+		Name:          fmt.Sprintf("%s-镜头%d", scoreCategoryLabel(category), storyboardNum),
+		Description:   &description,
+		PromptHash:    &promptHash,
+		Type:          models.AssetTypeAudio,
+		Category:      &assetCategory,
+		URL:           fmt.Sprintf("%s/%s", s.baseURL, relPath),
+		LocalPath:     &relPath,
+		FileSize:      &fileSize,
+		Format:        &format,
+	}
+	if result.ContentType != "" {
+		asset.MimeType = &result.ContentType
+	}
+	if err := s.db.Create(asset).Error; err != nil {
+		os.Remove(absPath)
+		refund()
+		return nil, fmt.Errorf("failed to create audio asset: %w", err)
+	}
+	if refID != "" {
+		if err := s.billingService.RecordAIUsage(refID, used); err != nil {
+			s.log.Warnw("Failed to record score usage", "error", err, "ref_id", refID)
+		}
+	}
+	return asset, nil
+}
+
+func (s *ScoreService) failScore(ctx context.Context, taskID string, err error) error {
+	s.log.Errorw("Score generation failed", "error", err, "task_id", taskID)
+	return s.taskService.failOrRetry(ctx, taskID, err)
+}
+
+// getMusicClient 目前仅支持 ElevenLabs 配乐/音效接口
+func (s *ScoreService) getMusicClient(config *models.AIServiceConfig, model string) music.MusicClient {
+	client := music.NewElevenLabsMusicClient(config.BaseURL, config.APIKey, model)
+	if config.Endpoint != "" {
+		client.MusicEndpoint = config.Endpoint
+	}
+	return client
+}
+
+func scoreCategoryLabel(category string) string {
+	if category == scoreMusicCategory {
+		return "配乐"
+	}
+	return "音效"
+}
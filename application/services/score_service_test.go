@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+func TestBuildScoreRangesMergesAdjacentPrompts(t *testing.T) {
+	windows := []sceneWindow{
+		{SceneID: 1, Start: 0, End: 3},
+		{SceneID: 2, Start: 3, End: 8},
+		{SceneID: 3, Start: 8, End: 12},
+		{SceneID: 4, Start: 12, End: 15},
+		{SceneID: 5, Start: 15, End: 18},
+	}
+	ranges := buildScoreRanges(windows, map[uint]string{
+		1: "悬疑钢琴",
+		2: " 悬疑钢琴 ",
+		3: "欢快吉他",
+		5: "悬疑钢琴",
+	})
+
+	if len(ranges) != 3 {
+		t.Fatalf("expected 3 ranges, got %+v", ranges)
+	}
+	if ranges[0].Prompt != "悬疑钢琴" || ranges[0].Start != 0 || ranges[0].End != 8 || len(ranges[0].StoryboardIDs) != 2 {
+		t.Fatalf("unexpected first range: %+v", ranges[0])
+	}
+	if ranges[2].Start != 15 || ranges[2].End != 18 {
+		t.Fatalf("expected non-adjacent prompt to start a new range, got %+v", ranges[2])
+	}
+}
+
+func TestScoreService_ProcessGeneratesAndReusesAudio(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.AsyncTask{}, &models.AIServiceConfig{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3"))
+	}))
+	defer server.Close()
+
+	user := models.User{Email: "score@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 100}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	musicConfig, err := NewAIService(db, &config.Config{}, log).CreateConfig(&CreateAIConfigRequest{ServiceType: "music", Provider: "elevenlabs", Name: "music", BaseURL: server.URL, APIKey: "key",
+		Model: models.ModelField{"music_v1"}, CreditCost: 4, IsDefault: true})
+	if err != nil {
+		t.Fatalf("failed to seed ai config: %v", err)
+	}
+	if musicConfig.Endpoint != "/v1/music" {
+		t.Fatalf("expected default music endpoint, got %q", musicConfig.Endpoint)
+	}
+
+	episode := seedTimelineEpisode(t, db, user.ID)
+	var storyboards []models.Storyboard
+	db.Where("episode_id = ?", episode.ID).Order("storyboard_number ASC").Find(&storyboards)
+	db.Model(&storyboards[0]).Updates(map[string]interface{}{"bgm_prompt": "悬疑钢琴", "sound_effect": "雷声"})
+	db.Model(&storyboards[1]).Update("bgm_prompt", "悬疑钢琴")
+	db.Model(&storyboards[2]).Update("bgm_prompt", "温暖弦乐")
+
+	storagePath := t.TempDir()
+	cfg := &config.Config{Storage: config.StorageConfig{LocalPath: storagePath}}
+	taskService := NewTaskService(db, log, NewTaskEventHub(), nil)
+	svc := NewScoreService(db, cfg, NewAIService(db, cfg, log), taskService, &capturingDispatcher{}, log)
+
+	taskID, err := svc.GenerateEpisodeScore(user.ID, episode.ID, &GenerateScoreRequest{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	svc.ProcessEpisodeScore(context.Background(), EpisodeScoreJobPayload{UserID: user.ID, TaskID: taskID, EpisodeID: episode.ID})
+
+	task, _ := taskService.GetTask(taskID)
+	if task.Status != "completed" {
+		t.Fatalf("expected completed task, got %s: %s", task.Status, task.Error)
+	}
+	if calls["/v1/music"] != 2 || calls["/v1/sound-generation"] != 1 {
+		t.Fatalf("unexpected provider calls: %v", calls)
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 88 {
+		t.Fatalf("expected 12 credits consumed, got balance %d", reloaded.Credits)
+	}
+
+	// 第二次生成复用相同提示词的素材，不再调用接口
+	again, _, err := taskService.CreateOrGetActiveTask(1, episodeScoreTaskType, "again")
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	svc.ProcessEpisodeScore(context.Background(), EpisodeScoreJobPayload{UserID: user.ID, TaskID: again.ID, EpisodeID: episode.ID})
+	if calls["/v1/music"] != 2 || calls["/v1/sound-generation"] != 1 {
+		t.Fatalf("expected assets to be reused, got calls %v", calls)
+	}
+	// 其他剧集即使提示词相同也不复用
+	if _, err := findScoreAsset(db, episode.ID+1, scoreMusicCategory, "悬疑钢琴"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected score assets scoped to the episode, got %v", err)
+	}
+
+	merge := NewVideoMergeService(db, nil, NewAIService(db, &config.Config{}, log), NewTaskService(db, log, NewTaskEventHub(), nil), storagePath, "", log)
+	musicTracks, effects, err := merge.buildScoreTracks([]models.SceneClip{
+		{SceneID: storyboards[0].ID, Duration: 3, Order: 0},
+		{SceneID: storyboards[1].ID, Duration: 5, Order: 1},
+		{SceneID: storyboards[2].ID, Duration: 4, Order: 2},
+	}, episode.ID)
+	if err != nil {
+		t.Fatalf("failed to build score tracks: %v", err)
+	}
+	if len(musicTracks) != 2 || musicTracks[0].Duration != 8 || !musicTracks[0].Loop || musicTracks[1].Offset != 8 {
+		t.Fatalf("unexpected music tracks: %+v", musicTracks)
+	}
+	if len(effects) != 1 || effects[0].Offset != 0 || effects[0].Duration != 3 || effects[0].Loop {
+		t.Fatalf("unexpected effect tracks: %+v", effects)
+	}
+	// 其他剧集的合成引用这些分镜时不读取它们的配乐提示词
+	musicTracks, effects, err = merge.buildScoreTracks([]models.SceneClip{{SceneID: storyboards[0].ID, Duration: 3, Order: 0}}, episode.ID+1)
+	if err != nil || len(musicTracks)+len(effects) != 0 {
+		t.Fatalf("expected score tracks scoped to the merge episode, got %+v %+v (%v)", musicTracks, effects, err)
+	}
+}
+
+func TestScoreService_RefundsWhenAudioCannotBeSaved(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.AsyncTask{}, &models.AIServiceConfig{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3"))
+	}))
+	defer server.Close()
+
+	user := models.User{Email: "score-refund@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 100}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	if _, err := NewAIService(db, &config.Config{}, log).CreateConfig(&CreateAIConfigRequest{ServiceType: "music", Provider: "elevenlabs", Name: "music", BaseURL: server.URL, APIKey: "key",
+		Model: models.ModelField{"music_v1"}, CreditCost: 4, IsDefault: true}); err != nil {
+		t.Fatalf("failed to seed ai config: %v", err)
+	}
+	episode := seedTimelineEpisode(t, db, user.ID)
+	db.Model(&models.Storyboard{}).Where("episode_id = ?", episode.ID).Update("bgm_prompt", "悬疑钢琴")
+
+	// 存储目录是一个普通文件，音频无法落盘
+	storagePath := filepath.Join(t.TempDir(), "storage")
+	if err := os.WriteFile(storagePath, nil, 0644); err != nil {
+		t.Fatalf("failed to create blocking file: %v", err)
+	}
+	cfg := &config.Config{Storage: config.StorageConfig{LocalPath: storagePath}}
+	taskService := NewTaskService(db, log, NewTaskEventHub(), nil)
+	svc := NewScoreService(db, cfg, NewAIService(db, cfg, log), taskService, &capturingDispatcher{}, log)
+
+	taskID, err := svc.GenerateEpisodeScore(user.ID, episode.ID, &GenerateScoreRequest{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	svc.ProcessEpisodeScore(context.Background(), EpisodeScoreJobPayload{UserID: user.ID, TaskID: taskID, EpisodeID: episode.ID})
+
+	if task, _ := taskService.GetTask(taskID); task.Status != "failed" {
+		t.Fatalf("expected failed task, got %s", task.Status)
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 100 {
+		t.Fatalf("expected reservation refunded, got balance %d", reloaded.Credits)
+	}
+	var assets int64
+	db.Model(&models.Asset{}).Count(&assets)
+	if assets != 0 {
+		t.Fatalf("expected no asset saved, got %d", assets)
+	}
+}
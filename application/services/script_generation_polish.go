@@ -1,12 +1,14 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/usage"
 	"gorm.io/gorm"
 )
 
@@ -14,7 +16,7 @@ var ErrEpisodeNotFound = errors.New("episode not found")
 
 const defaultPolishTextModel = "doubao-seed-1-8-251228"
 
-func (s *ScriptGenerationService) PolishEpisodeScript(userID uint, episodeID uint, rawContent string, model string, skillName string) (string, string, error) {
+func (s *ScriptGenerationService) PolishEpisodeScript(ctx context.Context, userID uint, episodeID uint, rawContent string, model string, skillName string, params map[string]string) (string, string, error) {
 	var episode models.Episode
 	if err := s.db.Where("id = ? AND user_id = ?", episodeID, userID).First(&episode).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -32,122 +34,69 @@ func (s *ScriptGenerationService) PolishEpisodeScript(userID uint, episodeID uin
 	}
 
 	return s.polishContentWithSkill(
+		ctx,
 		userID,
 		content,
 		model,
 		skillName,
+		params,
+		episode.DramaID,
 		fmt.Sprintf("episode_script_polish:%d", episodeID),
+		nil,
 	)
 }
 
-func (s *ScriptGenerationService) PolishScriptText(userID uint, content string, model string, skillName string) (string, string, error) {
+func (s *ScriptGenerationService) PolishScriptText(ctx context.Context, userID uint, content string, model string, skillName string, params map[string]string) (string, string, error) {
 	content = strings.TrimSpace(content)
 	if content == "" {
 		return "", "", errors.New("empty content")
 	}
 	return s.polishContentWithSkill(
+		ctx,
 		userID,
 		content,
 		model,
 		skillName,
+		params,
+		0,
 		"script_polish",
+		nil,
 	)
 }
 
-func (s *ScriptGenerationService) PolishScriptTextStream(userID uint, content string, model string, skillName string, callback ai.StreamCallback) (string, string, error) {
+func (s *ScriptGenerationService) PolishScriptTextStream(ctx context.Context, userID uint, content string, model string, skillName string, params map[string]string, callback ai.StreamCallback) (string, string, error) {
 	content = strings.TrimSpace(content)
 	if content == "" {
 		return "", "", errors.New("empty content")
 	}
-	return s.polishContentWithSkillStream(
+	if callback == nil {
+		callback = func(string, int, float64) {}
+	}
+	return s.polishContentWithSkill(
+		ctx,
 		userID,
 		content,
 		model,
 		skillName,
+		params,
+		0,
 		"script_polish",
 		callback,
 	)
 }
 
-func (s *ScriptGenerationService) polishContentWithSkill(userID uint, content string, model string, skillName string, detailPrefix string) (string, string, error) {
-	skillID, skill := resolveScriptPolishSkill(skillName)
-	isEN := s.promptI18n != nil && s.promptI18n.IsEnglish()
-
-	systemPrompt := skill.SystemPromptZH
-	userTemplate := skill.UserPromptZH
-	if isEN {
-		systemPrompt = skill.SystemPromptEN
-		userTemplate = skill.UserPromptEN
-	}
-	userPrompt := fmt.Sprintf(userTemplate, content)
-
-	modelHint := s.resolvePolishModelHint(model)
-
-	client, actualModel, billingRefID, err := reserveTextClient(
-		s.aiService,
-		s.billing,
-		userID,
-		modelHint,
-		fmt.Sprintf("%s:%s", detailPrefix, skillID),
-	)
-	if err != nil && strings.TrimSpace(model) == "" && modelHint != "" {
-		// 自动解析到的平台模型不可用时，回退到系统默认选择逻辑，避免因单模型异常导致润色不可用。
-		client, actualModel, billingRefID, err = reserveTextClient(
-			s.aiService,
-			s.billing,
-			userID,
-			"",
-			fmt.Sprintf("%s:%s", detailPrefix, skillID),
-		)
-	}
-	if err != nil {
-		return "", "", err
-	}
-
-	success := false
-	defer func() {
-		if !success && billingRefID != "" {
-			_ = s.billing.RefundAI(billingRefID)
-		}
-	}()
+// ListPolishSkills 列出可用的润色技能及其参数
+func (s *ScriptGenerationService) ListPolishSkills() []ScriptPolishSkillInfo {
+	return s.skills.List()
+}
 
-	polished, err := client.GenerateText(
-		userPrompt,
-		systemPrompt,
-		ai.WithTemperature(0.45),
-		ai.WithMaxTokens(2600),
-	)
+// polishContentWithSkill callback 非空时流式生成；dramaID 为 0 时按用户语言选择提示词
+func (s *ScriptGenerationService) polishContentWithSkill(ctx context.Context, userID uint, content string, model string, skillName string, params map[string]string, dramaID uint, detailPrefix string, callback ai.StreamCallback) (string, string, error) {
+	isEN := s.promptI18n.ForDrama(userID, dramaID).IsEnglish()
+	call, err := s.skills.Prepare(skillName, content, params, isEN)
 	if err != nil {
 		return "", "", err
 	}
-	recordTextUsage(s.billing, billingRefID, client)
-
-	polished = normalizePolishedScript(polished)
-	if polished == "" {
-		return "", "", errors.New("polished content is empty")
-	}
-
-	s.log.Infow("Script polished",
-		"user_id", userID,
-		"skill_name", skillID,
-		"model", actualModel,
-		"length", len([]rune(polished)))
-
-	success = true
-	return polished, skillID, nil
-}
-
-func (s *ScriptGenerationService) polishContentWithSkillStream(userID uint, content string, model string, skillName string, detailPrefix string, callback ai.StreamCallback) (string, string, error) {
-	skillID, skill := resolveScriptPolishSkill(skillName)
-	isEN := s.promptI18n != nil && s.promptI18n.IsEnglish()
-
-	systemPrompt := skill.SystemPromptZH
-	userTemplate := skill.UserPromptZH
-	if isEN {
-		systemPrompt = skill.SystemPromptEN
-		userTemplate = skill.UserPromptEN
-	}
-	userPrompt := fmt.Sprintf(userTemplate, content)
 
 	modelHint := s.resolvePolishModelHint(model)
 
@@ -156,15 +105,16 @@ func (s *ScriptGenerationService) polishContentWithSkillStream(userID uint, cont
 		s.billing,
 		userID,
 		modelHint,
-		fmt.Sprintf("%s:%s", detailPrefix, skillID),
+		fmt.Sprintf("%s:%s", detailPrefix, call.Skill),
 	)
 	if err != nil && strings.TrimSpace(model) == "" && modelHint != "" {
+		// 自动解析到的平台模型不可用时，回退到系统默认选择逻辑，避免因单模型异常导致润色不可用。
 		client, actualModel, billingRefID, err = reserveTextClient(
 			s.aiService,
 			s.billing,
 			userID,
 			"",
-			fmt.Sprintf("%s:%s", detailPrefix, skillID),
+			fmt.Sprintf("%s:%s", detailPrefix, call.Skill),
 		)
 	}
 	if err != nil {
@@ -178,31 +128,23 @@ func (s *ScriptGenerationService) polishContentWithSkillStream(userID uint, cont
 		}
 	}()
 
-	polished, err := client.GenerateTextStream(
-		userPrompt,
-		systemPrompt,
-		callback,
-		ai.WithTemperature(0.45),
-		ai.WithMaxTokens(2600),
-	)
+	callCtx, meter := usage.WithMeter(ctx)
+	polished, err := call.Run(callCtx, client, callback)
 	if err != nil {
 		return "", "", err
 	}
-	recordTextUsage(s.billing, billingRefID, client)
+	recordTextUsage(s.billing, billingRefID, meter.Total())
 
-	polished = normalizePolishedScript(polished)
-	if polished == "" {
-		return "", "", errors.New("polished content is empty")
-	}
-
-	s.log.Infow("Script polished stream",
+	s.log.Infow("Script polished",
 		"user_id", userID,
-		"skill_name", skillID,
+		"skill_name", call.Skill,
 		"model", actualModel,
+		"stream", callback != nil,
 		"length", len([]rune(polished)))
 
+	settleTextBilling(s.billing, billingRefID, client)
 	success = true
-	return polished, skillID, nil
+	return polished, call.Skill, nil
 }
 
 func normalizePolishedScript(raw string) string {
@@ -1,14 +1,17 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
-	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/drama-generator/backend/pkg/usage"
 	"gorm.io/gorm"
 )
 
@@ -21,18 +24,29 @@ type ScriptGenerationService struct {
 	promptI18n  *PromptI18n
 	taskService *TaskService
 	runner      *TaskRunner
+	skills      *ScriptPolishSkillCatalog
 }
 
-func NewScriptGenerationService(db *gorm.DB, cfg *config.Config, log *logger.Logger) *ScriptGenerationService {
+func NewScriptGenerationService(db *gorm.DB, cfg *config.Config, aiService *AIService, taskService *TaskService, log *logger.Logger, promptI18n *PromptI18n) *ScriptGenerationService {
+	skills := NewScriptPolishSkillCatalog(db, log)
+	if dir := cfg.AI.ScriptSkillsDir; dir != "" {
+		if loaded, err := skills.LoadDir(dir); err != nil {
+			log.Warnw("Failed to load script polish skills", "error", err, "dir", dir)
+		} else {
+			log.Infow("Loaded script polish skills", "count", loaded, "dir", dir)
+		}
+	}
+
 	return &ScriptGenerationService{
 		db:          db,
-		aiService:   NewAIService(db, log),
-		billing:     NewBillingService(db, cfg, log),
+		aiService:   aiService,
+		billing:     NewBillingService(db, cfg, taskService.webhooks, log),
 		log:         log,
 		config:      cfg,
-		promptI18n:  NewPromptI18n(cfg),
-		taskService: NewTaskService(db, log),
+		promptI18n:  promptI18n,
+		taskService: taskService,
 		runner:      NewTaskRunner(log, 4),
+		skills:      skills,
 	}
 }
 
@@ -52,7 +66,7 @@ func (s *ScriptGenerationService) GenerateCharacters(userID uint, req *GenerateC
 	}
 
 	// 创建任务（若存在同资源进行中的任务则复用，避免重复扣分）
-	task, created, err := s.taskService.CreateOrGetActiveTask("character_generation", req.DramaID)
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, "character_generation", req.DramaID)
 	if err != nil {
 		s.log.Errorw("Failed to create character generation task", "error", err)
 		return "", fmt.Errorf("创建任务失败: %w", err)
@@ -64,7 +78,7 @@ func (s *ScriptGenerationService) GenerateCharacters(userID uint, req *GenerateC
 
 	// 异步处理角色生成
 	s.runner.Submit("script.generate_characters", func() {
-		s.processCharacterGeneration(userID, task.ID, req)
+		s.processCharacterGeneration(context.Background(), userID, task.ID, req)
 	})
 
 	s.log.Infow("Character generation task created", "task_id", task.ID, "drama_id", req.DramaID)
@@ -72,7 +86,15 @@ func (s *ScriptGenerationService) GenerateCharacters(userID uint, req *GenerateC
 }
 
 // processCharacterGeneration 异步处理角色生成
-func (s *ScriptGenerationService) processCharacterGeneration(userID uint, taskID string, req *GenerateCharactersRequest) {
+func (s *ScriptGenerationService) processCharacterGeneration(ctx context.Context, userID uint, taskID string, req *GenerateCharactersRequest) {
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	defer s.taskService.RefundCancelled(ctx, taskID, s.billing)
+	if ctx.Err() != nil {
+		s.log.Infow("Character generation cancelled before start", "task_id", taskID)
+		return
+	}
+
 	// 更新任务状态为处理中
 	s.taskService.UpdateTaskStatus(taskID, "processing", 0, "正在生成角色...")
 
@@ -89,14 +111,15 @@ func (s *ScriptGenerationService) processCharacterGeneration(userID uint, taskID
 		return
 	}
 
-	systemPrompt := s.promptI18n.GetCharacterExtractionPrompt(drama.Style)
+	prompts := s.promptI18n.ForDrama(userID, drama.ID)
+	systemPrompt := prompts.GetCharacterExtractionPrompt(drama.Style)
 
 	outlineText := req.Outline
 	if outlineText == "" {
-		outlineText = s.promptI18n.FormatUserPrompt("drama_info_template", drama.Title, drama.Description, drama.Genre)
+		outlineText = prompts.FormatUserPrompt("drama_info_template", drama.Title, drama.Description, drama.Genre)
 	}
 
-	userPrompt := s.promptI18n.FormatUserPrompt("character_request", outlineText, count)
+	userPrompt := prompts.FormatUserPrompt("character_request", outlineText, count)
 
 	temperature := req.Temperature
 	if temperature == 0 {
@@ -104,23 +127,10 @@ func (s *ScriptGenerationService) processCharacterGeneration(userID uint, taskID
 	}
 
 	// 如果指定了模型，使用指定的模型；否则使用默认配置
-	var text string
-	var err error
 	if req.Model != "" {
 		s.log.Infow("Using specified model for character generation", "model", req.Model, "task_id", taskID)
-		text, err = s.generateTextBilled(userID, req.Model, userPrompt, systemPrompt, ai.WithTemperature(temperature))
-	} else {
-		text, err = s.generateTextBilled(userID, "", userPrompt, systemPrompt, ai.WithTemperature(temperature))
-	}
-
-	if err != nil {
-		s.log.Errorw("Failed to generate characters", "error", err, "task_id", taskID)
-		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "AI生成失败: "+err.Error())
-		return
 	}
 
-	s.log.Infow("AI response received for character generation", "length", len(text), "preview", text[:minInt(200, len(text))], "task_id", taskID)
-
 	// AI直接返回数组格式
 	var result []struct {
 		Name        string `json:"name"`
@@ -131,12 +141,37 @@ func (s *ScriptGenerationService) processCharacterGeneration(userID uint, taskID
 		VoiceStyle  string `json:"voice_style"`
 	}
 
-	if err := utils.SafeParseAIJSON(text, &result); err != nil {
-		s.log.Errorw("Failed to parse characters JSON", "error", err, "raw_response", text[:minInt(500, len(text))], "task_id", taskID)
-		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "解析AI返回结果失败")
+	text, err := s.generateStructuredBilled(ctx, userID, req.Model, ai.StructuredRequest{
+		Prompt:       userPrompt,
+		SystemPrompt: systemPrompt,
+		SchemaName:   "characters",
+		Options:      []func(*ai.ChatCompletionRequest){ai.WithTemperature(temperature)},
+		Validate: func() error {
+			for i, char := range result {
+				if strings.TrimSpace(char.Name) == "" {
+					return fmt.Errorf("第 %d 个角色缺少 name", i+1)
+				}
+			}
+			return nil
+		},
+	}, &result)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.log.Infow("Character generation cancelled", "task_id", taskID)
+			return
+		}
+		if errors.Is(err, ai.ErrStructuredOutputInvalid) {
+			s.log.Errorw("Failed to parse characters JSON", "error", err, "raw_response", text[:minInt(500, len(text))], "task_id", taskID)
+			s.taskService.UpdateTaskStatus(taskID, "failed", 0, "解析AI返回结果失败")
+			return
+		}
+		s.log.Errorw("Failed to generate characters", "error", err, "task_id", taskID)
+		s.taskService.UpdateTaskStatus(taskID, "failed", 0, "AI生成失败: "+err.Error())
 		return
 	}
 
+	s.log.Infow("AI response received for character generation", "length", len(text), "preview", text[:minInt(200, len(text))], "task_id", taskID)
+
 	var characters []models.Character
 	for _, char := range result {
 		// 检查角色是否已存在
@@ -194,7 +229,8 @@ func (s *ScriptGenerationService) processCharacterGeneration(userID uint, taskID
 	s.log.Infow("Character generation completed", "task_id", taskID, "drama_id", req.DramaID, "character_count", len(characters))
 }
 
-func (s *ScriptGenerationService) generateTextBilled(userID uint, model string, userPrompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+// generateStructuredBilled 预扣积分后请求结构化输出，每次模型返回都会记录用量，最终失败时退款
+func (s *ScriptGenerationService) generateStructuredBilled(ctx context.Context, userID uint, model string, req ai.StructuredRequest, v interface{}) (string, error) {
 	cfg, actualModel, err := s.aiService.GetBillingConfig("text", model, userID)
 	if err != nil {
 		return "", err
@@ -203,6 +239,7 @@ func (s *ScriptGenerationService) generateTextBilled(userID uint, model string,
 	if err != nil {
 		return "", err
 	}
+	noteTaskBilling(ctx, refID)
 
 	client, err := s.aiService.GetAIClientForModelWithUser("text", actualModel, userID)
 	if err != nil {
@@ -210,12 +247,13 @@ func (s *ScriptGenerationService) generateTextBilled(userID uint, model string,
 		return "", err
 	}
 
-	out, err := client.GenerateText(userPrompt, systemPrompt, options...)
+	req.OnResponse = func(_ int, _ string, used usage.TokenUsage) { recordTextUsage(s.billing, refID, used) }
+	out, err := ai.GenerateStructuredContext(ctx, client, req, v)
 	if err != nil {
 		_ = s.billing.RefundAI(refID)
-		return "", err
+		return out, err
 	}
-	recordTextUsage(s.billing, refID, client)
+	settleTextBilling(s.billing, refID, client)
 	return out, nil
 }
 
@@ -1,16 +1,413 @@
 package services
 
-import "strings"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 
-type scriptPolishSkill struct {
-	SystemPromptZH string
-	SystemPromptEN string
-	UserPromptZH   string
-	UserPromptEN   string
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultScriptPolishSkill = "polish_master"
+
+	scriptPolishContentVariable = "content"
+
+	scriptPolishParamString = "string"
+	scriptPolishParamEnum   = "enum"
+
+	scriptPolishSourceBuiltin  = "builtin"
+	scriptPolishSourceFile     = "file"
+	scriptPolishSourceDatabase = "database"
+
+	defaultScriptPolishTemperature = 0.45
+	defaultScriptPolishMaxTokens   = 2600
+	maxScriptPolishParamLength     = 200
+)
+
+var (
+	ErrUnknownScriptPolishSkill  = errors.New("unknown script polish skill")
+	ErrInvalidScriptPolishSkill  = errors.New("invalid script polish skill definition")
+	ErrInvalidScriptPolishParams = errors.New("invalid script polish skill parameters")
+)
+
+var scriptPolishSkillNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// ScriptPolishSkill 剧本润色技能。提示词中 {{content}} 为待处理正文，其余 {{变量}} 对应技能参数
+type ScriptPolishSkill struct {
+	Name           string                              `json:"name"`
+	Title          string                              `json:"title"`
+	Description    string                              `json:"description"`
+	Parameters     []models.ScriptPolishSkillParameter `json:"parameters"`
+	SystemPromptZH string                              `json:"system_prompt_zh"`
+	SystemPromptEN string                              `json:"system_prompt_en"`
+	UserPromptZH   string                              `json:"user_prompt_zh"`
+	UserPromptEN   string                              `json:"user_prompt_en"`
+	Temperature    float64                             `json:"temperature"`
+	MaxTokens      int                                 `json:"max_tokens"`
+	Source         string                              `json:"-"`
+}
+
+// ScriptPolishSkillInfo 技能列表接口返回的信息，不包含提示词
+type ScriptPolishSkillInfo struct {
+	Name        string                              `json:"name"`
+	Title       string                              `json:"title"`
+	Description string                              `json:"description"`
+	Parameters  []models.ScriptPolishSkillParameter `json:"parameters"`
+	Source      string                              `json:"source"`
+	Default     bool                                `json:"default"`
+}
+
+// validate 校验技能定义并补全缺省值：中英文提示词缺一时互相回退
+func (skill *ScriptPolishSkill) validate() error {
+	skill.Name = strings.TrimSpace(strings.ToLower(skill.Name))
+	if !scriptPolishSkillNamePattern.MatchString(skill.Name) {
+		return fmt.Errorf("%w: invalid name %q", ErrInvalidScriptPolishSkill, skill.Name)
+	}
+	if skill.Title == "" {
+		skill.Title = skill.Name
+	}
+	if skill.SystemPromptZH == "" {
+		skill.SystemPromptZH = skill.SystemPromptEN
+	}
+	if skill.SystemPromptEN == "" {
+		skill.SystemPromptEN = skill.SystemPromptZH
+	}
+	if skill.UserPromptZH == "" {
+		skill.UserPromptZH = skill.UserPromptEN
+	}
+	if skill.UserPromptEN == "" {
+		skill.UserPromptEN = skill.UserPromptZH
+	}
+	if skill.SystemPromptZH == "" {
+		return fmt.Errorf("%w: %s has no system prompt", ErrInvalidScriptPolishSkill, skill.Name)
+	}
+
+	declared := []string{scriptPolishContentVariable}
+	for i := range skill.Parameters {
+		param := &skill.Parameters[i]
+		if param.Type == "" {
+			param.Type = scriptPolishParamString
+		}
+		switch {
+		case !scriptPolishSkillNamePattern.MatchString(param.Name) || param.Name == scriptPolishContentVariable:
+			return fmt.Errorf("%w: %s has invalid parameter name %q", ErrInvalidScriptPolishSkill, skill.Name, param.Name)
+		case slices.Contains(declared, param.Name):
+			return fmt.Errorf("%w: %s declares parameter %q twice", ErrInvalidScriptPolishSkill, skill.Name, param.Name)
+		case param.Type != scriptPolishParamString && param.Type != scriptPolishParamEnum:
+			return fmt.Errorf("%w: %s parameter %q has unsupported type %q", ErrInvalidScriptPolishSkill, skill.Name, param.Name, param.Type)
+		case param.Type == scriptPolishParamEnum && len(param.Options) == 0:
+			return fmt.Errorf("%w: %s parameter %q has no options", ErrInvalidScriptPolishSkill, skill.Name, param.Name)
+		case param.Type == scriptPolishParamEnum && param.Default != "" && !slices.Contains(param.Options, param.Default):
+			return fmt.Errorf("%w: %s parameter %q default is not an option", ErrInvalidScriptPolishSkill, skill.Name, param.Name)
+		}
+		if param.Label == "" {
+			param.Label = param.Name
+		}
+		declared = append(declared, param.Name)
+	}
+
+	for _, prompt := range []string{skill.SystemPromptZH, skill.SystemPromptEN, skill.UserPromptZH, skill.UserPromptEN} {
+		for _, name := range promptTemplateVariables(prompt) {
+			if !slices.Contains(declared, name) {
+				return fmt.Errorf("%w: %s uses undeclared variable %q", ErrInvalidScriptPolishSkill, skill.Name, name)
+			}
+		}
+	}
+	for _, prompt := range []string{skill.UserPromptZH, skill.UserPromptEN} {
+		if !slices.Contains(promptTemplateVariables(prompt), scriptPolishContentVariable) {
+			return fmt.Errorf("%w: %s user prompt must contain {{content}}", ErrInvalidScriptPolishSkill, skill.Name)
+		}
+	}
+	return nil
+}
+
+// resolveParams 校验调用参数并补全默认值，未声明的参数直接拒绝
+func (skill *ScriptPolishSkill) resolveParams(params map[string]string) (map[string]string, error) {
+	for name := range params {
+		if !slices.ContainsFunc(skill.Parameters, func(p models.ScriptPolishSkillParameter) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("%w: %s does not accept %q", ErrInvalidScriptPolishParams, skill.Name, name)
+		}
+	}
+
+	values := make(map[string]string, len(skill.Parameters)+1)
+	for _, param := range skill.Parameters {
+		value := strings.TrimSpace(params[param.Name])
+		if value == "" {
+			value = param.Default
+		}
+		switch {
+		case value == "" && param.Required:
+			return nil, fmt.Errorf("%w: %q is required", ErrInvalidScriptPolishParams, param.Name)
+		case value != "" && param.Type == scriptPolishParamEnum && !slices.Contains(param.Options, value):
+			return nil, fmt.Errorf("%w: %q must be one of %s", ErrInvalidScriptPolishParams, param.Name, strings.Join(param.Options, ", "))
+		case len([]rune(value)) > maxScriptPolishParamLength:
+			return nil, fmt.Errorf("%w: %q is too long", ErrInvalidScriptPolishParams, param.Name)
+		}
+		values[param.Name] = value
+	}
+	return values, nil
+}
+
+func (skill *ScriptPolishSkill) info() ScriptPolishSkillInfo {
+	params := skill.Parameters
+	if params == nil {
+		params = []models.ScriptPolishSkillParameter{}
+	}
+	return ScriptPolishSkillInfo{
+		Name:        skill.Name,
+		Title:       skill.Title,
+		Description: skill.Description,
+		Parameters:  params,
+		Source:      skill.Source,
+		Default:     skill.Name == defaultScriptPolishSkill,
+	}
+}
+
+// ScriptPolishCall 一次润色调用渲染好的提示词与采样参数
+type ScriptPolishCall struct {
+	Skill        string
+	SystemPrompt string
+	UserPrompt   string
+	Temperature  float64
+	MaxTokens    int
+}
+
+// Run 调用模型并清理输出；callback 非空时使用流式生成
+func (call *ScriptPolishCall) Run(ctx context.Context, client ai.AIClient, callback ai.StreamCallback) (string, error) {
+	options := []func(*ai.ChatCompletionRequest){
+		ai.WithTemperature(call.Temperature),
+		ai.WithMaxTokens(call.MaxTokens),
+	}
+
+	var (
+		output string
+		err    error
+	)
+	if callback != nil {
+		output, err = client.GenerateTextStreamContext(ctx, call.UserPrompt, call.SystemPrompt, callback, options...)
+	} else {
+		output, err = client.GenerateTextContext(ctx, call.UserPrompt, call.SystemPrompt, options...)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	output = normalizePolishedScript(output)
+	if output == "" {
+		return "", errors.New("polished content is empty")
+	}
+	return output, nil
+}
+
+// ScriptPolishSkillCatalog 润色技能目录：内置技能 < 文件技能 < 数据库技能，同名时后者覆盖前者
+type ScriptPolishSkillCatalog struct {
+	db  *gorm.DB
+	log *logger.Logger
+
+	mu     sync.RWMutex
+	skills map[string]ScriptPolishSkill
+}
+
+// NewScriptPolishSkillCatalog db 为空时只使用内置和文件技能
+func NewScriptPolishSkillCatalog(db *gorm.DB, log *logger.Logger) *ScriptPolishSkillCatalog {
+	catalog := &ScriptPolishSkillCatalog{
+		db:     db,
+		log:    log,
+		skills: make(map[string]ScriptPolishSkill, len(builtinScriptPolishSkills)),
+	}
+	for _, skill := range builtinScriptPolishSkills {
+		skill.Source = scriptPolishSourceBuiltin
+		if err := catalog.Register(skill); err != nil {
+			panic(err)
+		}
+	}
+	return catalog
+}
+
+func (c *ScriptPolishSkillCatalog) Register(skill ScriptPolishSkill) error {
+	if err := skill.validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.skills[skill.Name] = skill
+	return nil
 }
 
-var scriptPolishSkillRegistry = map[string]scriptPolishSkill{
-	"polish_master": {
+// LoadDir 加载目录下的 *.json 技能文件，每个文件可以是单个技能或技能数组
+func (c *ScriptPolishSkillCatalog) LoadDir(dir string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(paths)
+
+	loaded := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return loaded, err
+		}
+		var skills []ScriptPolishSkill
+		if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal(data, &skills)
+		} else {
+			var skill ScriptPolishSkill
+			err = json.Unmarshal(data, &skill)
+			skills = []ScriptPolishSkill{skill}
+		}
+		if err != nil {
+			return loaded, fmt.Errorf("%w: %s: %v", ErrInvalidScriptPolishSkill, filepath.Base(path), err)
+		}
+		for _, skill := range skills {
+			skill.Source = scriptPolishSourceFile
+			if err := c.Register(skill); err != nil {
+				return loaded, fmt.Errorf("%s: %w", filepath.Base(path), err)
+			}
+			loaded++
+		}
+	}
+	return loaded, nil
+}
+
+// List 按名称排序列出可用技能
+func (c *ScriptPolishSkillCatalog) List() []ScriptPolishSkillInfo {
+	skills := c.snapshot()
+	for _, skill := range c.databaseSkills("") {
+		skills[skill.Name] = skill
+	}
+
+	infos := make([]ScriptPolishSkillInfo, 0, len(skills))
+	for _, skill := range skills {
+		infos = append(infos, skill.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Get 查找技能，名称为空时返回默认技能
+func (c *ScriptPolishSkillCatalog) Get(name string) (ScriptPolishSkill, error) {
+	name = strings.TrimSpace(strings.ToLower(name))
+	if name == "" {
+		name = defaultScriptPolishSkill
+	}
+	if skills := c.databaseSkills(name); len(skills) > 0 {
+		return skills[0], nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	skill, ok := c.skills[name]
+	if !ok {
+		return ScriptPolishSkill{}, fmt.Errorf("%w: %s", ErrUnknownScriptPolishSkill, name)
+	}
+	return skill, nil
+}
+
+// Prepare 按技能与参数渲染提示词
+func (c *ScriptPolishSkillCatalog) Prepare(name string, content string, params map[string]string, english bool) (*ScriptPolishCall, error) {
+	skill, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := skill.resolveParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	systemPrompt, userPrompt := skill.SystemPromptZH, skill.UserPromptZH
+	if english {
+		systemPrompt, userPrompt = skill.SystemPromptEN, skill.UserPromptEN
+	}
+	systemPrompt = renderPromptTemplate(systemPrompt, vars)
+	vars[scriptPolishContentVariable] = content
+
+	call := &ScriptPolishCall{
+		Skill:        skill.Name,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   renderPromptTemplate(userPrompt, vars),
+		Temperature:  skill.Temperature,
+		MaxTokens:    skill.MaxTokens,
+	}
+	if call.Temperature <= 0 {
+		call.Temperature = defaultScriptPolishTemperature
+	}
+	if call.MaxTokens <= 0 {
+		call.MaxTokens = defaultScriptPolishMaxTokens
+	}
+	return call, nil
+}
+
+func (c *ScriptPolishSkillCatalog) snapshot() map[string]ScriptPolishSkill {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	skills := make(map[string]ScriptPolishSkill, len(c.skills))
+	for name, skill := range c.skills {
+		skills[name] = skill
+	}
+	return skills
+}
+
+// databaseSkills 读取数据库中启用的技能，name 非空时只查该技能；定义不合法的记录会被跳过
+func (c *ScriptPolishSkillCatalog) databaseSkills(name string) []ScriptPolishSkill {
+	if c.db == nil {
+		return nil
+	}
+	query := c.db.Where("disabled = ?", false)
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+	var records []models.ScriptPolishSkill
+	if err := query.Find(&records).Error; err != nil {
+		if c.log != nil {
+			c.log.Warnw("Failed to load script polish skills from database", "error", err)
+		}
+		return nil
+	}
+
+	skills := make([]ScriptPolishSkill, 0, len(records))
+	for _, record := range records {
+		skill := ScriptPolishSkill{
+			Name:           record.Name,
+			Title:          record.Title,
+			Description:    record.Description,
+			Parameters:     record.Parameters,
+			SystemPromptZH: record.SystemPromptZH,
+			SystemPromptEN: record.SystemPromptEN,
+			UserPromptZH:   record.UserPromptZH,
+			UserPromptEN:   record.UserPromptEN,
+			Temperature:    record.Temperature,
+			MaxTokens:      record.MaxTokens,
+			Source:         scriptPolishSourceDatabase,
+		}
+		if err := skill.validate(); err != nil {
+			if c.log != nil {
+				c.log.Warnw("Skipping invalid script polish skill", "error", err, "name", record.Name)
+			}
+			continue
+		}
+		skills = append(skills, skill)
+	}
+	return skills
+}
+
+var builtinScriptPolishSkills = []ScriptPolishSkill{
+	{
+		Name:        "polish_master",
+		Title:       "润色大师",
+		Description: "润色成段章节；输入只有关键词或标题时扩写成完整剧本故事",
 		SystemPromptZH: `你是“润色大师”，也是“剧本扩写师”。你必须根据输入内容自动选择模式并直接产出可保存正文。
 
 模式A：润色模式（输入已是成段章节）
@@ -48,21 +445,152 @@ Unified output rules:
 		UserPromptZH: `请根据以下章节输入进行“润色或扩写”，并直接输出可保存的完整正文：
 
 【章节原文】
-%s`,
+{{content}}`,
 		UserPromptEN: `Please polish or expand the following input and output only the final save-ready chapter text:
 
 [Original Episode]
-%s`,
+{{content}}`,
+	},
+	{
+		Name:        "tone_rewrite",
+		Title:       "语气改写",
+		Description: "保持剧情不变，按指定语气重写叙述与对白",
+		Parameters: []models.ScriptPolishSkillParameter{
+			{
+				Name:     "tone",
+				Label:    "目标语气",
+				Type:     scriptPolishParamEnum,
+				Required: true,
+				Default:  "humorous",
+				Options:  []string{"humorous", "suspense", "warm", "passionate", "dark", "romantic"},
+			},
+		},
+		SystemPromptZH: `你是资深短剧编剧，负责语气改写。
+1. 将全文改写为“{{tone}}”语气（humorous=轻松幽默，suspense=悬疑紧张，warm=温情治愈，passionate=热血激昂，dark=冷峻黑暗，romantic=浪漫甜蜜）。
+2. 剧情事实、人物关系、场景顺序和关键台词含义保持不变。
+3. 叙述、动作描写与对白都要体现目标语气，人物说话方式符合其身份。
+4. 只输出改写后的正文，不要解释，不要 Markdown 代码块。`,
+		SystemPromptEN: `You are a senior short-drama screenwriter rewriting tone.
+1. Rewrite the whole text in a "{{tone}}" tone.
+2. Keep plot facts, character relationships, scene order and the meaning of key lines unchanged.
+3. Narration, action lines and dialogue should all carry the target tone while staying true to each character.
+4. Output only the rewritten text, with no explanations and no markdown code blocks.`,
+		UserPromptZH: `【章节原文】
+{{content}}`,
+		UserPromptEN: `[Original Episode]
+{{content}}`,
+	},
+	{
+		Name:        "dialogue_tighten",
+		Title:       "对白精炼",
+		Description: "删减冗余台词，让对白更短、更有冲突感",
+		Parameters: []models.ScriptPolishSkillParameter{
+			{
+				Name:    "intensity",
+				Label:   "精炼程度",
+				Type:    scriptPolishParamEnum,
+				Default: "medium",
+				Options: []string{"light", "medium", "strong"},
+			},
+		},
+		SystemPromptZH: `你是短剧对白编辑，负责精炼对白，精炼程度：{{intensity}}（light=只删重复和口头禅，medium=压缩长句、合并重复表达，strong=大幅删减，只保留推动剧情和冲突的台词）。
+1. 不新增剧情，不改变人物立场与关键信息。
+2. 每句台词尽量短、口语化、有潜台词，避免解释性台词。
+3. 非对白部分保持原样，仅做必要衔接。
+4. 只输出修改后的正文，不要解释，不要 Markdown 代码块。`,
+		SystemPromptEN: `You are a short-drama dialogue editor. Tighten the dialogue with intensity "{{intensity}}" (light = remove repetition and filler, medium = compress long lines and merge repeated points, strong = keep only lines that drive plot and conflict).
+1. Do not add plot or change character stances and key information.
+2. Keep each line short, natural and full of subtext; avoid expository dialogue.
+3. Leave non-dialogue text as is apart from necessary transitions.
+4. Output only the revised text, with no explanations and no markdown code blocks.`,
+		UserPromptZH: `【章节原文】
+{{content}}`,
+		UserPromptEN: `[Original Episode]
+{{content}}`,
+	},
+	{
+		Name:        "translate",
+		Title:       "翻译",
+		Description: "将剧本翻译为目标语言，保留格式与人物语气",
+		Parameters: []models.ScriptPolishSkillParameter{
+			{
+				Name:     "target_language",
+				Label:    "目标语言",
+				Type:     scriptPolishParamEnum,
+				Required: true,
+				Options:  []string{"zh", "en", "ja", "ko", "fr", "es", "de"},
+			},
+		},
+		SystemPromptZH: `你是专业的影视剧本译者。将剧本翻译为语言代码“{{target_language}}”对应的语言。
+1. 保留原有段落、场景标记和对白格式。
+2. 人名首次出现时保持一致的译法，全篇统一。
+3. 对白要符合目标语言的口语习惯和人物身份，不要逐字硬译。
+4. 只输出译文，不要解释，不要 Markdown 代码块。`,
+		SystemPromptEN: `You are a professional screenplay translator. Translate the script into the language with code "{{target_language}}".
+1. Keep paragraphs, scene markers and dialogue formatting.
+2. Translate character names consistently throughout.
+3. Dialogue should sound natural in the target language and fit each character; avoid literal translation.
+4. Output only the translation, with no explanations and no markdown code blocks.`,
+		UserPromptZH: `【待翻译剧本】
+{{content}}`,
+		UserPromptEN: `[Script to Translate]
+{{content}}`,
+		MaxTokens: 4000,
+	},
+	{
+		Name:        "genre_convert",
+		Title:       "题材转换",
+		Description: "保留核心人物与冲突，把故事改编为另一种题材",
+		Parameters: []models.ScriptPolishSkillParameter{
+			{
+				Name:        "target_genre",
+				Label:       "目标题材",
+				Description: "如：古装、科幻、都市、悬疑、校园",
+				Type:        scriptPolishParamString,
+				Required:    true,
+			},
+		},
+		SystemPromptZH: `你是擅长改编的短剧编剧。将故事改编为“{{target_genre}}”题材。
+1. 保留核心人物关系、主要冲突和情节走向。
+2. 场景、时代背景、人物身份和道具按目标题材重新设定，细节要自洽。
+3. 对白用词符合目标题材的世界观。
+4. 只输出改编后的正文，不要解释，不要 Markdown 代码块。`,
+		SystemPromptEN: `You are a short-drama screenwriter skilled at adaptation. Adapt the story into the "{{target_genre}}" genre.
+1. Keep the core character relationships, main conflict and plot direction.
+2. Re-imagine settings, era, character roles and props for the target genre, keeping details consistent.
+3. Dialogue should fit the world of the target genre.
+4. Output only the adapted text, with no explanations and no markdown code blocks.`,
+		UserPromptZH: `【章节原文】
+{{content}}`,
+		UserPromptEN: `[Original Episode]
+{{content}}`,
+	},
+	{
+		Name:        "continuity_check",
+		Title:       "连贯性检查",
+		Description: "检查人物、时间线、设定前后矛盾，输出问题清单与修改建议",
+		Parameters: []models.ScriptPolishSkillParameter{
+			{
+				Name:        "focus",
+				Label:       "重点检查",
+				Description: "可选，如：时间线、人物称呼、道具",
+				Type:        scriptPolishParamString,
+			},
+		},
+		SystemPromptZH: `你是剧本审校，负责连贯性检查。额外关注（可为空）：{{focus}}
+1. 找出人物姓名/称呼、人物关系、时间线、地点、道具和设定前后不一致之处，以及因果断裂的情节。
+2. 每个问题一行，格式：序号. 问题描述 —— 原文位置 —— 修改建议。
+3. 没有发现问题时只输出“未发现连贯性问题”。
+4. 不要改写全文，不要 Markdown 代码块。`,
+		SystemPromptEN: `You are a script editor checking continuity. Extra focus (may be empty): {{focus}}
+1. Find inconsistencies in character names/forms of address, relationships, timeline, locations, props and setting, as well as broken cause and effect.
+2. One issue per line in the format: number. issue — where in the text — suggested fix.
+3. If there are no issues, output only "No continuity issues found".
+4. Do not rewrite the text and do not output markdown code blocks.`,
+		UserPromptZH: `【待检查剧本】
+{{content}}`,
+		UserPromptEN: `[Script to Check]
+{{content}}`,
+		Temperature: 0.2,
 	},
-}
-
-func resolveScriptPolishSkill(skillName string) (string, scriptPolishSkill) {
-	key := strings.TrimSpace(strings.ToLower(skillName))
-	if key == "" {
-		key = "polish_master"
-	}
-	if skill, ok := scriptPolishSkillRegistry[key]; ok {
-		return key, skill
-	}
-	return "polish_master", scriptPolishSkillRegistry["polish_master"]
 }
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+// fakePolishClient 记录最近一次请求的提示词并返回固定输出
+type fakePolishClient struct {
+	output       string
+	prompt       string
+	systemPrompt string
+	streamed     bool
+}
+
+func (c *fakePolishClient) GenerateText(prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextContext(context.Background(), prompt, systemPrompt, options...)
+}
+
+func (c *fakePolishClient) GenerateTextStream(prompt string, systemPrompt string, callback ai.StreamCallback, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextStreamContext(context.Background(), prompt, systemPrompt, callback, options...)
+}
+
+func (c *fakePolishClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakePolishClient) TestConnection() error { return nil }
+
+func (c *fakePolishClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	c.prompt, c.systemPrompt = prompt, systemPrompt
+	return c.output, nil
+}
+
+func (c *fakePolishClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback ai.StreamCallback, options ...func(*ai.ChatCompletionRequest)) (string, error) {
+	c.streamed = true
+	callback(c.output, len([]rune(c.output)), 1)
+	return c.GenerateTextContext(ctx, prompt, systemPrompt, options...)
+}
+
+func (c *fakePolishClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakePolishClient) TestConnectionContext(ctx context.Context) error { return nil }
+
+func (c *fakePolishClient) GetLastUsage() usage.TokenUsage { return usage.TokenUsage{} }
+
+func TestScriptPolishSkillCatalog_ListsBuiltinSkills(t *testing.T) {
+	catalog := NewScriptPolishSkillCatalog(nil, nil)
+
+	names := []string{}
+	for _, info := range catalog.List() {
+		names = append(names, info.Name)
+		if info.Default != (info.Name == defaultScriptPolishSkill) {
+			t.Fatalf("unexpected default flag on %s", info.Name)
+		}
+	}
+	want := "continuity_check,dialogue_tighten,genre_convert,polish_master,tone_rewrite,translate"
+	if got := strings.Join(names, ","); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestScriptPolishSkillCatalog_ResolvesSkillsAndParameters(t *testing.T) {
+	catalog := NewScriptPolishSkillCatalog(nil, nil)
+
+	call, err := catalog.Prepare("", "正文", nil, false)
+	if err != nil || call.Skill != defaultScriptPolishSkill {
+		t.Fatalf("expected empty name to use default skill, got %+v, %v", call, err)
+	}
+	if _, err := catalog.Prepare("unknown", "正文", nil, false); !errors.Is(err, ErrUnknownScriptPolishSkill) {
+		t.Fatalf("expected unknown skill error, got %v", err)
+	}
+	if _, err := catalog.Prepare("translate", "正文", nil, false); !errors.Is(err, ErrInvalidScriptPolishParams) {
+		t.Fatalf("expected missing required parameter error, got %v", err)
+	}
+	if _, err := catalog.Prepare("translate", "正文", map[string]string{"target_language": "xx"}, false); !errors.Is(err, ErrInvalidScriptPolishParams) {
+		t.Fatalf("expected invalid option error, got %v", err)
+	}
+	if _, err := catalog.Prepare("tone_rewrite", "正文", map[string]string{"style": "x"}, false); !errors.Is(err, ErrInvalidScriptPolishParams) {
+		t.Fatalf("expected undeclared parameter error, got %v", err)
+	}
+
+	call, err = catalog.Prepare("TONE_REWRITE", "他说：{{tone}}", nil, true)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	if !strings.Contains(call.SystemPrompt, `"humorous" tone`) {
+		t.Fatalf("expected default tone in system prompt, got %q", call.SystemPrompt)
+	}
+	if !strings.Contains(call.UserPrompt, "他说：{{tone}}") {
+		t.Fatalf("expected content placeholders to be left untouched, got %q", call.UserPrompt)
+	}
+}
+
+func TestScriptPolishCall_RunsWithFakeClient(t *testing.T) {
+	catalog := NewScriptPolishSkillCatalog(nil, nil)
+	call, err := catalog.Prepare("translate", "你好", map[string]string{"target_language": "en"}, false)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+
+	client := &fakePolishClient{output: "```text\nHello\n```"}
+	output, err := call.Run(context.Background(), client, nil)
+	if err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+	if output != "Hello" {
+		t.Fatalf("expected normalized output, got %q", output)
+	}
+	if client.streamed || !strings.Contains(client.systemPrompt, "“en”") || !strings.Contains(client.prompt, "你好") {
+		t.Fatalf("unexpected request: streamed=%v system=%q prompt=%q", client.streamed, client.systemPrompt, client.prompt)
+	}
+
+	chunks := 0
+	if _, err := call.Run(context.Background(), client, func(string, int, float64) { chunks++ }); err != nil {
+		t.Fatalf("failed to stream: %v", err)
+	}
+	if !client.streamed || chunks != 1 {
+		t.Fatalf("expected streaming call, streamed=%v chunks=%d", client.streamed, chunks)
+	}
+
+	client.output = "   "
+	if _, err := call.Run(context.Background(), client, nil); err == nil {
+		t.Fatalf("expected empty output to fail")
+	}
+}
+
+func TestScriptPolishSkillCatalog_LoadsFilesAndDatabaseSkills(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.json": `[{"name":"recap","title":"前情提要","system_prompt_zh":"写{{length}}字前情提要","user_prompt_zh":"{{content}}",
+			"parameters":[{"name":"length","type":"enum","options":["50","100"],"default":"50"}]}]`,
+		"b.json": `{"name":"tone_rewrite","title":"文件覆盖","system_prompt_zh":"覆盖","user_prompt_zh":"{{content}}"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write skill file: %v", err)
+		}
+	}
+
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.ScriptPolishSkill{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	catalog := NewScriptPolishSkillCatalog(db, logger.NewLogger(true))
+	loaded, err := catalog.LoadDir(dir)
+	if err != nil || loaded != 2 {
+		t.Fatalf("expected 2 skills loaded, got %d, %v", loaded, err)
+	}
+
+	call, err := catalog.Prepare("recap", "正文", nil, true)
+	if err != nil {
+		t.Fatalf("failed to prepare file skill: %v", err)
+	}
+	if call.SystemPrompt != "写50字前情提要" {
+		t.Fatalf("expected english prompt to fall back to chinese, got %q", call.SystemPrompt)
+	}
+	if skill, _ := catalog.Get("tone_rewrite"); skill.Source != scriptPolishSourceFile {
+		t.Fatalf("expected file skill to override builtin, got %s", skill.Source)
+	}
+
+	records := []models.ScriptPolishSkill{
+		{Name: "tone_rewrite", Title: "数据库覆盖", SystemPromptZH: "数据库", UserPromptZH: "{{content}}"},
+		{Name: "disabled_skill", Title: "停用", SystemPromptZH: "x", UserPromptZH: "{{content}}", Disabled: true},
+		{Name: "broken_skill", Title: "缺少正文", SystemPromptZH: "x", UserPromptZH: "no content"},
+	}
+	if err := db.Create(&records).Error; err != nil {
+		t.Fatalf("failed to seed skills: %v", err)
+	}
+	if skill, _ := catalog.Get("tone_rewrite"); skill.Source != scriptPolishSourceDatabase || skill.SystemPromptZH != "数据库" {
+		t.Fatalf("expected database skill to take precedence, got %+v", skill)
+	}
+	for _, name := range []string{"disabled_skill", "broken_skill"} {
+		if _, err := catalog.Get(name); !errors.Is(err, ErrUnknownScriptPolishSkill) {
+			t.Fatalf("expected %s to be unavailable, got %v", name, err)
+		}
+	}
+	if got := len(catalog.List()); got != 7 {
+		t.Fatalf("expected 7 skills listed, got %d", got)
+	}
+
+	bad := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bad, "bad.json"), []byte(`{"name":"bad","system_prompt_zh":"{{missing}}","user_prompt_zh":"{{content}}"}`), 0o644); err != nil {
+		t.Fatalf("failed to write skill file: %v", err)
+	}
+	if _, err := catalog.LoadDir(bad); !errors.Is(err, ErrInvalidScriptPolishSkill) {
+		t.Fatalf("expected invalid definition error, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+const defaultMaxStoryboardReferences = 4
+
+const (
+	storyboardReferenceCharacter = "character"
+	storyboardReferenceProp      = "prop"
+	storyboardReferenceScene     = "scene"
+)
+
+// StoryboardReference 自动附带给图片/视频模型的一张参考图
+type StoryboardReference struct {
+	Kind     string `json:"kind"` // character, prop, scene
+	EntityID uint   `json:"entity_id"`
+	Name     string `json:"name"`
+	Image    string `json:"image"` // 本地存储相对路径或 URL
+}
+
+// StoryboardReferenceSet 分镜的参考图集合。顺序为 角色主图 > 道具主图 > 场景背景 > 角色、道具的其它参考图，
+// Seed 取第一个设置了 seed 的出场角色
+type StoryboardReferenceSet struct {
+	References []StoryboardReference `json:"references"`
+	Seed       *int64                `json:"seed,omitempty"`
+}
+
+// Images 参考图地址列表
+func (set *StoryboardReferenceSet) Images() []string {
+	images := make([]string, 0, len(set.References))
+	for _, ref := range set.References {
+		images = append(images, ref.Image)
+	}
+	return images
+}
+
+// StoryboardReferenceResolver 把分镜关联的角色、道具和场景解析成有序、限量的参考图
+type StoryboardReferenceResolver struct {
+	db     *gorm.DB
+	config config.AIConsistencyConfig
+	log    *logger.Logger
+}
+
+func NewStoryboardReferenceResolver(db *gorm.DB, cfg *config.Config, log *logger.Logger) *StoryboardReferenceResolver {
+	resolver := &StoryboardReferenceResolver{db: db, log: log}
+	if cfg != nil {
+		resolver.config = cfg.AI.Consistency
+	}
+	return resolver
+}
+
+func (r *StoryboardReferenceResolver) Enabled() bool {
+	return r != nil && !r.config.Disabled
+}
+
+// Limit 自动参考图数量上限，providerMax 为服务商支持的上限，0 表示不限制
+func (r *StoryboardReferenceResolver) Limit(providerMax int) int {
+	limit := r.config.MaxReferenceImages
+	if limit <= 0 {
+		limit = defaultMaxStoryboardReferences
+	}
+	if providerMax > 0 && providerMax < limit {
+		limit = providerMax
+	}
+	return limit
+}
+
+// Resolve 解析分镜的参考图，limit <= 0 时使用配置的上限
+func (r *StoryboardReferenceResolver) Resolve(userID, storyboardID uint, limit int) (*StoryboardReferenceSet, error) {
+	var storyboard models.Storyboard
+	err := r.db.Preload("Characters").Preload("Props").Preload("Background").
+		Where("id = ? AND user_id = ?", storyboardID, userID).
+		First(&storyboard).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStoryboardNotFound
+		}
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = r.Limit(0)
+	}
+	return buildStoryboardReferenceSet(&storyboard, limit), nil
+}
+
+func buildStoryboardReferenceSet(storyboard *models.Storyboard, limit int) *StoryboardReferenceSet {
+	characters := append([]models.Character(nil), storyboard.Characters...)
+	sort.SliceStable(characters, func(i, j int) bool {
+		if characters[i].SortOrder != characters[j].SortOrder {
+			return characters[i].SortOrder < characters[j].SortOrder
+		}
+		return characters[i].ID < characters[j].ID
+	})
+	props := append([]models.Prop(nil), storyboard.Props...)
+	sort.SliceStable(props, func(i, j int) bool { return props[i].ID < props[j].ID })
+
+	set := &StoryboardReferenceSet{}
+	seen := make(map[string]bool)
+	add := func(kind string, id uint, name string, image string) {
+		image = strings.TrimSpace(image)
+		if image == "" || seen[image] || len(set.References) >= limit {
+			return
+		}
+		seen[image] = true
+		set.References = append(set.References, StoryboardReference{Kind: kind, EntityID: id, Name: name, Image: image})
+	}
+
+	for _, character := range characters {
+		add(storyboardReferenceCharacter, character.ID, character.Name, primaryReferenceImage(character.LocalPath, character.ImageURL))
+		if set.Seed == nil && character.SeedValue != nil {
+			if seed, err := strconv.ParseInt(strings.TrimSpace(*character.SeedValue), 10, 64); err == nil {
+				set.Seed = &seed
+			}
+		}
+	}
+	for _, prop := range props {
+		add(storyboardReferenceProp, prop.ID, prop.Name, primaryReferenceImage(prop.LocalPath, prop.ImageURL))
+	}
+	if scene := storyboard.Background; scene != nil {
+		add(storyboardReferenceScene, scene.ID, scene.Location, primaryReferenceImage(scene.LocalPath, scene.ImageURL))
+	}
+	for _, character := range characters {
+		for _, image := range parseReferenceImageList(character.ReferenceImages) {
+			add(storyboardReferenceCharacter, character.ID, character.Name, image)
+		}
+	}
+	for _, prop := range props {
+		for _, image := range parseReferenceImageList(prop.ReferenceImages) {
+			add(storyboardReferenceProp, prop.ID, prop.Name, image)
+		}
+	}
+	return set
+}
+
+// primaryReferenceImage 优先使用本地文件，避免服务商拉取外链失败
+func primaryReferenceImage(localPath, imageURL *string) string {
+	if localPath != nil && *localPath != "" {
+		return *localPath
+	}
+	if imageURL != nil {
+		return *imageURL
+	}
+	return ""
+}
+
+// parseReferenceImageList ReferenceImages 存的是字符串数组，格式不对时忽略
+func parseReferenceImageList(raw []byte) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var images []string
+	if err := json.Unmarshal(raw, &images); err != nil {
+		return nil
+	}
+	return images
+}
+
+// mergeReferenceImages 显式传入的参考图保持在前且不截断，自动参考图去重后补足到 limit
+func mergeReferenceImages(explicit []string, auto []string, limit int) []string {
+	merged := append([]string(nil), explicit...)
+	seen := make(map[string]bool, len(explicit))
+	for _, image := range explicit {
+		seen[image] = true
+	}
+	for _, image := range auto {
+		if len(merged) >= limit {
+			break
+		}
+		if seen[image] {
+			continue
+		}
+		seen[image] = true
+		merged = append(merged, image)
+	}
+	return merged
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/video"
+	"gorm.io/datatypes"
+)
+
+func strPtr(s string) *string { return &s }
+
+func newStoryboardReferencesTestDB(t *testing.T) (*StoryboardReferenceResolver, *models.Storyboard) {
+	t.Helper()
+	db := newAIRoutingTestDB(t)
+	if err := db.AutoMigrate(&models.Episode{}, &models.Character{}, &models.Prop{}, &models.Scene{}, &models.Storyboard{}, &models.VideoGeneration{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	scene := models.Scene{UserID: 1, DramaID: 1, Location: "教室", Time: "夜", Prompt: "x", ImageURL: strPtr("https://cdn/scene.png")}
+	if err := db.Create(&scene).Error; err != nil {
+		t.Fatalf("failed to create scene: %v", err)
+	}
+	extras, _ := json.Marshal([]string{"characters/lin-side.png", "characters/lin.png"})
+	storyboard := models.Storyboard{
+		UserID:    1,
+		EpisodeID: 1,
+		SceneID:   &scene.ID,
+		Characters: []models.Character{
+			{UserID: 1, DramaID: 1, Name: "配角", SortOrder: 2, ImageURL: strPtr("https://cdn/b.png"), SeedValue: strPtr("99")},
+			{UserID: 1, DramaID: 1, Name: "林", SortOrder: 1, LocalPath: strPtr("characters/lin.png"), ImageURL: strPtr("https://cdn/lin.png"),
+				ReferenceImages: datatypes.JSON(extras), SeedValue: strPtr(" 42 ")},
+			{UserID: 1, DramaID: 1, Name: "无图", SortOrder: 0},
+		},
+		Props: []models.Prop{{UserID: 1, DramaID: 1, Name: "钥匙", LocalPath: strPtr("props/key.png")}},
+	}
+	if err := db.Create(&storyboard).Error; err != nil {
+		t.Fatalf("failed to create storyboard: %v", err)
+	}
+	return NewStoryboardReferenceResolver(db, &config.Config{}, logger.NewLogger(true)), &storyboard
+}
+
+func TestStoryboardReferenceResolver_OrdersAndCapsReferences(t *testing.T) {
+	resolver, storyboard := newStoryboardReferencesTestDB(t)
+
+	set, err := resolver.Resolve(1, storyboard.ID, 10)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	want := "characters/lin.png,https://cdn/b.png,props/key.png,https://cdn/scene.png,characters/lin-side.png"
+	if got := strings.Join(set.Images(), ","); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if set.Seed == nil || *set.Seed != 42 {
+		t.Fatalf("expected seed of the first character, got %v", set.Seed)
+	}
+
+	set, err = resolver.Resolve(1, storyboard.ID, 0)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if len(set.References) != defaultMaxStoryboardReferences || set.References[3].Kind != storyboardReferenceScene {
+		t.Fatalf("expected default cap to keep characters, prop and scene, got %+v", set.References)
+	}
+	if _, err := resolver.Resolve(2, storyboard.ID, 0); !errors.Is(err, ErrStoryboardNotFound) {
+		t.Fatalf("expected other users' storyboards to be hidden, got %v", err)
+	}
+
+	merged := mergeReferenceImages([]string{"a", "b", "c"}, []string{"b", "x", "y"}, 4)
+	if got := strings.Join(merged, ","); got != "a,b,c,x" {
+		t.Fatalf("unexpected merge result: %s", got)
+	}
+}
+
+// fakeReferenceVideoClient 只用于声明参考图能力
+type fakeReferenceVideoClient struct {
+	video.VideoClient
+	caps video.ReferenceCapabilities
+}
+
+func (c fakeReferenceVideoClient) ReferenceCapabilities() video.ReferenceCapabilities { return c.caps }
+
+func TestVideoGeneration_AppliesStoryboardReferences(t *testing.T) {
+	resolver, storyboard := newStoryboardReferencesTestDB(t)
+	service := &VideoGenerationService{db: resolver.db, references: resolver, log: resolver.log}
+
+	textOnly := models.VideoGeneration{UserID: 1, DramaID: 1, StoryboardID: &storyboard.ID, Prompt: "镜头", Status: models.VideoStatusPending}
+	firstFrame := models.VideoGeneration{UserID: 1, DramaID: 1, StoryboardID: &storyboard.ID, Prompt: "镜头", Status: models.VideoStatusPending,
+		ReferenceMode: strPtr("single"), ImageURL: strPtr("frames/first.png")}
+	for _, gen := range []*models.VideoGeneration{&textOnly, &firstFrame} {
+		if err := resolver.db.Create(gen).Error; err != nil {
+			t.Fatalf("failed to create video generation: %v", err)
+		}
+		service.applyStoryboardReferences(gen, fakeReferenceVideoClient{caps: video.ReferenceCapabilities{MaxReferenceImages: 2, Seed: true}})
+	}
+
+	var saved models.VideoGeneration
+	if err := resolver.db.First(&saved, textOnly.ID).Error; err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if saved.ReferenceMode == nil || *saved.ReferenceMode != "multiple" || saved.ReferenceImageURLs == nil ||
+		*saved.ReferenceImageURLs != `["characters/lin.png","https://cdn/b.png"]` {
+		t.Fatalf("expected text-only video to switch to capped multiple references, got %+v", saved)
+	}
+	if saved.Seed == nil || *saved.Seed != 42 {
+		t.Fatalf("expected character seed to be saved, got %v", saved.Seed)
+	}
+
+	var single models.VideoGeneration
+	if err := resolver.db.First(&single, firstFrame.ID).Error; err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if *single.ReferenceMode != "single" || single.ReferenceImageURLs != nil || single.Seed == nil {
+		t.Fatalf("expected first-frame video to keep its mode and only reuse the seed, got %+v", single)
+	}
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,7 +13,7 @@ import (
 	"github.com/drama-generator/backend/pkg/ai"
 	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
-	"github.com/drama-generator/backend/pkg/utils"
+	"github.com/drama-generator/backend/pkg/usage"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -28,15 +30,15 @@ type StoryboardService struct {
 	dispatcher  JobDispatcher
 }
 
-func NewStoryboardService(db *gorm.DB, cfg *config.Config, dispatcher JobDispatcher, log *logger.Logger) *StoryboardService {
+func NewStoryboardService(db *gorm.DB, cfg *config.Config, aiService *AIService, taskService *TaskService, dispatcher JobDispatcher, log *logger.Logger, promptI18n *PromptI18n) *StoryboardService {
 	return &StoryboardService{
 		db:          db,
-		aiService:   NewAIService(db, log),
-		taskService: NewTaskService(db, log),
-		billing:     NewBillingService(db, cfg, log),
+		aiService:   aiService,
+		taskService: taskService,
+		billing:     NewBillingService(db, cfg, taskService.webhooks, log),
 		log:         log,
 		config:      cfg,
-		promptI18n:  NewPromptI18n(cfg),
+		promptI18n:  promptI18n,
 		runner:      NewTaskRunner(log, 4),
 		dispatcher:  dispatcher,
 	}
@@ -76,6 +78,7 @@ type storyboardCharacterLink struct {
 type storyboardSegmentResult struct {
 	Index       int
 	Storyboards []Storyboard
+	Client      ai.AIClient // 生成该段的客户端，全部分段完成后用于结算
 	Err         error
 }
 
@@ -406,27 +409,28 @@ func (s *StoryboardService) summarizeStoryboardContext(storyboards []Storyboard)
 	return strings.Join(lines, "\n")
 }
 
-func (s *StoryboardService) buildStoryboardSegmentPrompt(scriptSegment, characterList, sceneList, previousContext string, segmentIndex, totalSegments int) string {
+func (s *StoryboardService) buildStoryboardSegmentPrompt(prompts *PromptI18n, scriptSegment, characterList, sceneList, previousContext string, segmentIndex, totalSegments int) string {
 	scriptBody := scriptSegment
 	if previousContext != "" {
 		scriptBody = fmt.Sprintf("【上一段分镜摘要】\n%s\n\n【当前待拆分片段 %d/%d】\n%s", previousContext, segmentIndex, totalSegments, scriptSegment)
 	}
-	return s.buildStoryboardPrompt(scriptBody, characterList, sceneList)
+	return buildStoryboardPromptWith(prompts, scriptBody, characterList, sceneList)
 }
 
-func parseStoryboardGenerationResult(text string) (GenerateStoryboardResult, error) {
-	var result GenerateStoryboardResult
-	var storyboards []Storyboard
-	if err := utils.SafeParseAIJSON(text, &storyboards); err == nil {
-		result.Storyboards = storyboards
-		result.Total = len(storyboards)
-		return result, nil
+// validateStoryboards 校验模型输出的分镜，错误信息会回传给模型用于重新生成
+func validateStoryboards(storyboards []Storyboard) error {
+	if len(storyboards) == 0 {
+		return fmt.Errorf("分镜列表为空，至少需要一个镜头")
 	}
-	if err := utils.SafeParseAIJSON(text, &result); err != nil {
-		return GenerateStoryboardResult{}, err
+	for i, sb := range storyboards {
+		if strings.TrimSpace(sb.Action) == "" && strings.TrimSpace(sb.Dialogue) == "" && strings.TrimSpace(sb.Result) == "" {
+			return fmt.Errorf("第 %d 个镜头（shot_number=%d）的 action、dialogue、result 均为空", i+1, sb.ShotNumber)
+		}
+		if sb.Duration < 0 {
+			return fmt.Errorf("第 %d 个镜头（shot_number=%d）的 duration 不能为负数", i+1, sb.ShotNumber)
+		}
 	}
-	result.Total = len(result.Storyboards)
-	return result, nil
+	return nil
 }
 
 func (s *StoryboardService) prepareStoryboardGenerationClient(userID uint, model, episodeID string, billingRefID *string) (ai.AIClient, string, error) {
@@ -465,7 +469,7 @@ func (s *StoryboardService) prepareStoryboardGenerationClient(userID uint, model
 	return client, actualModel, nil
 }
 
-func (s *StoryboardService) executeStoryboardSegmentsConcurrently(userID uint, taskID, actualModel, characterList, sceneList string, segments []string, billingRefID string) ([]Storyboard, error) {
+func (s *StoryboardService) executeStoryboardSegmentsConcurrently(ctx context.Context, prompts *PromptI18n, userID uint, taskID, actualModel, characterList, sceneList string, segments []string, billingRefID string) ([]Storyboard, error) {
 	totalSegments := len(segments)
 	if totalSegments == 0 {
 		return nil, fmt.Errorf("no storyboard segments")
@@ -494,6 +498,11 @@ func (s *StoryboardService) executeStoryboardSegmentsConcurrently(userID uint, t
 				}
 			}()
 
+			if ctx.Err() != nil {
+				resultsCh <- storyboardSegmentResult{Index: index, Err: ErrTaskCancelled}
+				return
+			}
+
 			client, err := s.aiService.GetAIClientForModelWithUser("text", actualModel, userID)
 			if err != nil {
 				resultsCh <- storyboardSegmentResult{Index: index, Err: err}
@@ -505,7 +514,7 @@ func (s *StoryboardService) executeStoryboardSegmentsConcurrently(userID uint, t
 				previousContext = buildPreviousScriptContext(segments[index-1])
 			}
 			maxTokens := estimateStoryboardMaxTokens(utf8.RuneCountInString(segmentText))
-			prompt := s.buildStoryboardSegmentPrompt(segmentText, characterList, sceneList, previousContext, index+1, totalSegments)
+			prompt := s.buildStoryboardSegmentPrompt(prompts, segmentText, characterList, sceneList, previousContext, index+1, totalSegments)
 
 			s.log.Infow("Generating storyboard segment concurrently",
 				"task_id", taskID,
@@ -515,16 +524,30 @@ func (s *StoryboardService) executeStoryboardSegmentsConcurrently(userID uint, t
 				"prompt_length", len(prompt),
 				"max_tokens", maxTokens)
 
-			text, err := client.GenerateTextStream(prompt, "", nil, ai.WithMaxTokens(maxTokens))
-			if err != nil {
-				resultsCh <- storyboardSegmentResult{Index: index, Err: err}
+			var storyboards []Storyboard
+			text, err := ai.GenerateStructuredContext(ctx, client, ai.StructuredRequest{
+				Prompt:     prompt,
+				SchemaName: "storyboards",
+				Stream:     true,
+				Cache:      true,
+				Options:    []func(*ai.ChatCompletionRequest){ai.WithMaxTokens(maxTokens)},
+				Validate:   func() error { return validateStoryboards(storyboards) },
+				OnResponse: func(attempt int, _ string, used usage.TokenUsage) {
+					recordTextUsage(s.billing, billingRefID, used)
+					if attempt > 1 {
+						s.log.Warnw("Storyboard segment output failed validation, regenerated",
+							"task_id", taskID,
+							"segment_index", index+1,
+							"attempt", attempt)
+					}
+				},
+			}, &storyboards)
+			if ctx.Err() != nil {
+				resultsCh <- storyboardSegmentResult{Index: index, Err: ErrTaskCancelled}
 				return
 			}
-			recordTextUsage(s.billing, billingRefID, client)
-
-			parsed, err := parseStoryboardGenerationResult(text)
 			if err != nil {
-				s.log.Errorw("Failed to parse concurrent storyboard segment",
+				s.log.Errorw("Failed to generate concurrent storyboard segment",
 					"error", err,
 					"task_id", taskID,
 					"segment_index", index+1,
@@ -535,7 +558,8 @@ func (s *StoryboardService) executeStoryboardSegmentsConcurrently(userID uint, t
 
 			resultsCh <- storyboardSegmentResult{
 				Index:       index,
-				Storyboards: parsed.Storyboards,
+				Storyboards: storyboards,
+				Client:      client,
 			}
 		})
 	}
@@ -546,7 +570,13 @@ func (s *StoryboardService) executeStoryboardSegmentsConcurrently(userID uint, t
 	var firstErr error
 
 	for received := 0; received < totalSegments; received++ {
-		result := <-resultsCh
+		var result storyboardSegmentResult
+		select {
+		case <-ctx.Done():
+			// 结果通道有缓冲，未完成的分段结束后不会阻塞
+			return nil, ErrTaskCancelled
+		case result = <-resultsCh:
+		}
 		if result.Err != nil && firstErr == nil {
 			firstErr = result.Err
 		}
@@ -592,18 +622,38 @@ func (s *StoryboardService) executeStoryboardSegmentsConcurrently(userID uint, t
 		return nil, firstErr
 	}
 
+	// 各分段共用一笔预扣，全部完成后按所有分段的客户端结算一次
+	clients := make([]ai.AIClient, 0, len(results))
+	for _, result := range results {
+		clients = append(clients, result.Client)
+	}
+	settleTextBilling(s.billing, billingRefID, clients...)
+
 	return mergeStoryboardSegmentResults(results)
 }
 
 func (s *StoryboardService) buildStoryboardPrompt(scriptContent, characterList, sceneList string) string {
-	systemPrompt := s.promptI18n.GetStoryboardSystemPrompt()
-	scriptLabel := s.promptI18n.FormatUserPrompt("script_content_label")
-	taskLabel := s.promptI18n.FormatUserPrompt("task_label")
-	taskInstruction := s.promptI18n.FormatUserPrompt("task_instruction")
-	charListLabel := s.promptI18n.FormatUserPrompt("character_list_label")
-	charConstraint := s.promptI18n.FormatUserPrompt("character_constraint")
-	sceneListLabel := s.promptI18n.FormatUserPrompt("scene_list_label")
-	sceneConstraint := s.promptI18n.FormatUserPrompt("scene_constraint")
+	return buildStoryboardPromptWith(s.promptI18n, scriptContent, characterList, sceneList)
+}
+
+// storyboardPrompts 按章节所属剧集解析提示词模板覆盖
+func (s *StoryboardService) storyboardPrompts(userID uint, episodeID string) *PromptI18n {
+	var episode models.Episode
+	if err := s.db.Select("id", "drama_id").Where("id = ?", episodeID).First(&episode).Error; err != nil {
+		return s.promptI18n.ForDrama(userID, 0)
+	}
+	return s.promptI18n.ForDrama(userID, episode.DramaID)
+}
+
+func buildStoryboardPromptWith(prompts *PromptI18n, scriptContent, characterList, sceneList string) string {
+	systemPrompt := prompts.GetStoryboardSystemPrompt()
+	scriptLabel := prompts.FormatUserPrompt("script_content_label")
+	taskLabel := prompts.FormatUserPrompt("task_label")
+	taskInstruction := prompts.FormatUserPrompt("task_instruction")
+	charListLabel := prompts.FormatUserPrompt("character_list_label")
+	charConstraint := prompts.FormatUserPrompt("character_constraint")
+	sceneListLabel := prompts.FormatUserPrompt("scene_list_label")
+	sceneConstraint := prompts.FormatUserPrompt("scene_constraint")
 
 	var builder strings.Builder
 	builder.Grow(len(systemPrompt) + len(scriptContent) + len(characterList) + len(sceneList) + 1024)
@@ -629,7 +679,7 @@ func (s *StoryboardService) buildStoryboardPrompt(scriptContent, characterList,
 	builder.WriteString("\n")
 	builder.WriteString(scriptContent)
 
-	if s.promptI18n.IsEnglish() {
+	if prompts.IsEnglish() {
 		builder.WriteString("\n\n[Output Contract]\n")
 		builder.WriteString(`Return a JSON object: {"storyboards":[...]}. Each storyboard must include shot_number, title, shot_type, angle, time, location, scene_id, movement, action, dialogue, result, atmosphere, emotion, duration, characters.`)
 		builder.WriteString("\n- Keep one independent action per shot; do not merge beats.\n")
@@ -720,7 +770,7 @@ func (s *StoryboardService) GenerateStoryboard(userID uint, episodeID string, mo
 	}
 
 	// 创建异步任务（若存在同资源进行中的任务则复用，避免重复扣分）
-	task, created, err := s.taskService.CreateOrGetActiveTask("storyboard_generation", episodeID)
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, "storyboard_generation", episodeID)
 	if err != nil {
 		s.log.Errorw("Failed to create task", "error", err)
 		return "", fmt.Errorf("创建任务失败: %w", err)
@@ -752,7 +802,7 @@ func (s *StoryboardService) GenerateStoryboard(userID uint, episodeID string, mo
 	}); err != nil {
 		s.log.Warnw("Failed to dispatch storyboard generation through task bus, fallback to local runner", "error", err, "task_id", task.ID)
 		s.runner.Submit("storyboard.generate", func() {
-			s.ProcessStoryboardGeneration(userID, task.ID, episodeID, model, scriptContent, characterList, sceneList)
+			s.ProcessStoryboardGeneration(context.Background(), userID, task.ID, episodeID, model, scriptContent, characterList, sceneList)
 		})
 	}
 
@@ -776,12 +826,23 @@ func (s *StoryboardService) dispatchStoryboardGeneration(payload StoryboardGener
 	})
 }
 
-// ProcessStoryboardGeneration 后台处理故事板生成
-func (s *StoryboardService) ProcessStoryboardGeneration(userID uint, taskID, episodeID, model, scriptContent, characterList, sceneList string) {
+// ProcessStoryboardGeneration 后台处理故事板生成，临时性错误返回给任务总线重试
+func (s *StoryboardService) ProcessStoryboardGeneration(ctx context.Context, userID uint, taskID, episodeID, model, scriptContent, characterList, sceneList string) error {
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	defer s.taskService.RefundCancelled(ctx, taskID, s.billing)
+	cancelled := func() bool {
+		return ctx.Err() != nil || s.taskService.IsTaskCancelled(taskID)
+	}
+	if ctx.Err() != nil {
+		s.log.Infow("Storyboard generation cancelled before start", "task_id", taskID)
+		return nil
+	}
+
 	// 更新任务状态为处理中
 	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 10, "开始生成分镜头..."); err != nil {
 		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
-		return
+		return nil
 	}
 
 	billingRefID := ""
@@ -791,22 +852,19 @@ func (s *StoryboardService) ProcessStoryboardGeneration(userID uint, taskID, epi
 			_ = s.billing.RefundAI(billingRefID)
 		}
 	}()
-	fail := func(e error, userMessage string) {
-		if updateErr := s.taskService.UpdateTaskError(taskID, fmt.Errorf(userMessage+": %w", e)); updateErr != nil {
-			s.log.Errorw("Failed to update task error", "error", updateErr, "task_id", taskID)
-		}
+	fail := func(e error, userMessage string) error {
+		return s.taskService.failOrRetry(ctx, taskID, fmt.Errorf(userMessage+": %w", e))
 	}
 
 	_, actualModel, reserveErr := s.prepareStoryboardGenerationClient(userID, model, episodeID, &billingRefID)
 	if reserveErr != nil {
-		fail(reserveErr, "生成分镜头失败")
-		return
+		return fail(reserveErr, "生成分镜头失败")
 	}
+	noteTaskBilling(ctx, billingRefID)
 
 	segments := s.splitScriptIntoSegments(scriptContent)
 	if len(segments) == 0 {
-		fail(fmt.Errorf("empty script segments"), "生成分镜头失败")
-		return
+		return fail(fmt.Errorf("empty script segments"), "生成分镜头失败")
 	}
 
 	s.log.Infow("Processing storyboard generation with concurrent segments",
@@ -815,11 +873,15 @@ func (s *StoryboardService) ProcessStoryboardGeneration(userID uint, taskID, epi
 		"segment_count", len(segments),
 		"model", actualModel)
 
-	allStoryboards, err := s.executeStoryboardSegmentsConcurrently(userID, taskID, actualModel, characterList, sceneList, segments, billingRefID)
+	allStoryboards, err := s.executeStoryboardSegmentsConcurrently(ctx, s.storyboardPrompts(userID, episodeID), userID, taskID, actualModel, characterList, sceneList, segments, billingRefID)
+	if errors.Is(err, ErrTaskCancelled) || (err == nil && cancelled()) {
+		// 已取消：不落库，预扣积分由 defer 退回
+		s.log.Infow("Storyboard generation cancelled", "task_id", taskID, "episode_id", episodeID)
+		return nil
+	}
 	if err != nil {
 		s.log.Errorw("Failed to generate storyboard segments concurrently", "error", err, "task_id", taskID)
-		fail(err, "生成分镜头失败")
-		return
+		return fail(err, "生成分镜头失败")
 	}
 
 	result := GenerateStoryboardResult{
@@ -842,20 +904,19 @@ func (s *StoryboardService) ProcessStoryboardGeneration(userID uint, taskID, epi
 	// 更新任务进度
 	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 70, fmt.Sprintf("分镜生成完成，共 %d 个镜头，正在保存到项目", result.Total)); err != nil {
 		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
-		return
+		return nil
 	}
 
 	// 保存分镜头到数据库
 	if err := s.saveStoryboards(episodeID, result.Storyboards); err != nil {
 		s.log.Errorw("Failed to save storyboards", "error", err, "task_id", taskID)
-		fail(err, "保存分镜头失败")
-		return
+		return fail(err, "保存分镜头失败")
 	}
 
 	// 更新任务进度
 	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 90, fmt.Sprintf("分镜已保存，正在更新章节时长（总计 %d 秒）", totalDuration)); err != nil {
 		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
-		return
+		return nil
 	}
 
 	// 更新剧集时长（秒转分钟，向上取整）
@@ -878,11 +939,12 @@ func (s *StoryboardService) ProcessStoryboardGeneration(userID uint, taskID, epi
 
 	if err := s.taskService.UpdateTaskResult(taskID, resultData); err != nil {
 		s.log.Errorw("Failed to update task result", "error", err, "task_id", taskID)
-		return
+		return nil
 	}
 
 	success = true
 	s.log.Infow("Storyboard generation completed", "task_id", taskID, "episode_id", episodeID)
+	return nil
 }
 
 // generateImagePrompt 生成专门用于图片生成的提示词（首帧静态画面）
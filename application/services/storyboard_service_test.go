@@ -35,7 +35,7 @@ func newStoryboardServiceForTest(t *testing.T) (*StoryboardService, *gorm.DB) {
 	t.Helper()
 	db := newStoryboardServiceTestDB(t)
 	cfg := &config.Config{}
-	svc := NewStoryboardService(db, cfg, nil, logger.NewLogger(true))
+	svc := NewStoryboardService(db, cfg, NewAIService(db, cfg, logger.NewLogger(true)), NewTaskService(db, logger.NewLogger(true), NewTaskEventHub(), nil), nil, logger.NewLogger(true), NewPromptI18n(cfg, nil, nil))
 	return svc, db
 }
 
@@ -417,3 +417,15 @@ func TestMergeAvailableStoryboardSegmentResults_PublishesCompletedSegmentsWithou
 		}
 	}
 }
+
+func TestValidateStoryboards(t *testing.T) {
+	if err := validateStoryboards(nil); err == nil {
+		t.Fatal("expected empty storyboards to be rejected")
+	}
+	if err := validateStoryboards([]Storyboard{{ShotNumber: 1, Action: "推门"}, {ShotNumber: 2}}); err == nil || !strings.Contains(err.Error(), "shot_number=2") {
+		t.Fatalf("expected empty shot to be reported, got %v", err)
+	}
+	if err := validateStoryboards([]Storyboard{{ShotNumber: 1, Dialogue: "你来了"}}); err != nil {
+		t.Fatalf("expected dialogue-only shot to pass, got %v", err)
+	}
+}
@@ -1,16 +1,18 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/pkg/ai"
+	"github.com/drama-generator/backend/pkg/usage"
 	"gorm.io/gorm"
 )
 
-func (s *StoryboardService) OptimizeVideoPrompt(userID uint, storyboardID string, rawPrompt string, model string) (string, error) {
+func (s *StoryboardService) OptimizeVideoPrompt(ctx context.Context, userID uint, storyboardID string, rawPrompt string, model string) (string, error) {
 	var storyboard models.Storyboard
 	if err := s.db.Where("id = ? AND user_id = ?", storyboardID, userID).First(&storyboard).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -48,10 +50,12 @@ func (s *StoryboardService) OptimizeVideoPrompt(userID uint, storyboardID string
 		}
 	}()
 
-	systemPrompt := s.videoPromptOptimizeSystemPrompt()
+	systemPrompt := s.videoPromptOptimizeSystemPrompt(s.promptI18n.ForDrama(userID, 0))
 	userPrompt := s.videoPromptOptimizeUserPrompt(&storyboard, basePrompt)
 
-	optimized, err := client.GenerateText(
+	callCtx, meter := usage.WithMeter(ctx)
+	optimized, err := client.GenerateTextContext(
+		callCtx,
 		userPrompt,
 		systemPrompt,
 		ai.WithTemperature(0.4),
@@ -60,7 +64,7 @@ func (s *StoryboardService) OptimizeVideoPrompt(userID uint, storyboardID string
 	if err != nil {
 		return "", err
 	}
-	recordTextUsage(s.billing, billingRefID, client)
+	recordTextUsage(s.billing, billingRefID, meter.Total())
 
 	optimized = normalizeOptimizedPrompt(optimized)
 	if optimized == "" {
@@ -84,6 +88,7 @@ func (s *StoryboardService) OptimizeVideoPrompt(userID uint, storyboardID string
 		"user_id", userID,
 		"model", actualModel,
 		"length", len([]rune(optimized)))
+	settleTextBilling(s.billing, billingRefID, client)
 	success = true
 	return optimized, nil
 }
@@ -142,8 +147,8 @@ func normalizeOptimizedPrompt(raw string) string {
 	return strings.TrimSpace(out)
 }
 
-func (s *StoryboardService) videoPromptOptimizeSystemPrompt() string {
-	if s.promptI18n != nil && s.promptI18n.IsEnglish() {
+func (s *StoryboardService) videoPromptOptimizeSystemPrompt(prompts *PromptI18n) string {
+	if prompts.IsEnglish() {
 		return "You are a professional image-to-video prompt engineer. Rewrite the input into one production-ready prompt for video generation with optional reference images. Keep character identity, scene continuity and camera logic consistent. Keep output concise, vivid, and directly usable by a video model. Return plain text only."
 	}
 	return "你是专业的图生视频提示词工程师。请把输入重写为一条可直接用于视频生成模型的高质量提示词。必须保持角色一致性、场景连续性、运镜逻辑和动作节奏。输出精炼但信息完整，直接返回纯文本提示词，不要任何解释。"
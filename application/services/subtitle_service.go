@@ -0,0 +1,197 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/subtitle"
+	"gorm.io/gorm"
+)
+
+const (
+	SubtitleFormatSRT    = "srt"
+	SubtitleFormatWebVTT = "vtt"
+)
+
+var ErrUnsupportedSubtitleFormat = errors.New("unsupported subtitle format")
+
+// SubtitleService 根据分镜台词生成字幕
+type SubtitleService struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+func NewSubtitleService(db *gorm.DB, log *logger.Logger) *SubtitleService {
+	return &SubtitleService{
+		db:  db,
+		log: log,
+	}
+}
+
+// SubtitleFile 导出的字幕文件
+type SubtitleFile struct {
+	FileName    string
+	ContentType string
+	Content     string
+}
+
+// ExportEpisodeSubtitles 导出剧集字幕文件
+func (s *SubtitleService) ExportEpisodeSubtitles(userID, episodeID uint, format string) (*SubtitleFile, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = SubtitleFormatSRT
+	}
+	if format != SubtitleFormatSRT && format != SubtitleFormatWebVTT {
+		return nil, ErrUnsupportedSubtitleFormat
+	}
+
+	var episode models.Episode
+	if err := s.db.Where("id = ? AND user_id = ?", episodeID, userID).First(&episode).Error; err != nil {
+		return nil, ErrEpisodeNotFound
+	}
+
+	cues, err := s.BuildEpisodeCues(&episode)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &SubtitleFile{FileName: fmt.Sprintf("episode_%d.%s", episode.EpisodeNum, format)}
+	if format == SubtitleFormatWebVTT {
+		file.ContentType = "text/vtt; charset=utf-8"
+		file.Content = subtitle.FormatWebVTT(cues)
+	} else {
+		file.ContentType = "application/x-subrip; charset=utf-8"
+		file.Content = subtitle.FormatSRT(cues)
+	}
+	return file, nil
+}
+
+// BuildEpisodeCues 按最近一次合成的片段顺序生成字幕，未合成过时按分镜顺序生成
+func (s *SubtitleService) BuildEpisodeCues(episode *models.Episode) ([]subtitle.Cue, error) {
+	var merge models.VideoMerge
+	err := s.db.Where("episode_id = ? AND status = ?", episode.ID, models.VideoMergeStatusCompleted).
+		Order("created_at DESC").First(&merge).Error
+	if err == nil {
+		var scenes []models.SceneClip
+		if err := json.Unmarshal(merge.Scenes, &scenes); err == nil && len(scenes) > 0 {
+			return s.BuildSceneCues(episode.ID, scenes)
+		}
+		s.log.Warnw("Failed to use merge scenes for subtitles, fallback to storyboard order", "merge_id", merge.ID)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var storyboards []models.Storyboard
+	if err := s.db.Where("episode_id = ?", episode.ID).Order("storyboard_number ASC").Find(&storyboards).Error; err != nil {
+		return nil, fmt.Errorf("failed to load storyboards: %w", err)
+	}
+
+	scenes := make([]models.SceneClip, 0, len(storyboards))
+	for i, sb := range storyboards {
+		scenes = append(scenes, models.SceneClip{
+			SceneID:  sb.ID,
+			Duration: float64(sb.Duration),
+			Order:    i,
+		})
+	}
+	return s.BuildSceneCues(episode.ID, scenes)
+}
+
+// BuildSceneCues 按合成顺序累计时间轴生成字幕。片段 ID 可能来自请求，只读取该剧集分镜的台词
+func (s *SubtitleService) BuildSceneCues(episodeID uint, scenes []models.SceneClip) ([]subtitle.Cue, error) {
+	windows := buildSceneWindows(scenes)
+
+	ids := make([]uint, 0, len(windows))
+	for _, w := range windows {
+		if w.SceneID != 0 {
+			ids = append(ids, w.SceneID)
+		}
+	}
+
+	dialogues := make(map[uint]string, len(ids))
+	if len(ids) > 0 {
+		var storyboards []models.Storyboard
+		if err := s.db.Select("id", "dialogue").Where("id IN ? AND episode_id = ?", ids, episodeID).Find(&storyboards).Error; err != nil {
+			return nil, fmt.Errorf("failed to load storyboard dialogue: %w", err)
+		}
+		for _, sb := range storyboards {
+			if sb.Dialogue != nil {
+				dialogues[sb.ID] = *sb.Dialogue
+			}
+		}
+	}
+
+	var cues []subtitle.Cue
+	for _, w := range windows {
+		if dialogue := dialogues[w.SceneID]; dialogue != "" && w.End > w.Start {
+			cues = append(cues, subtitle.SplitDialogue(dialogue, secondsToDuration(w.Start), secondsToDuration(w.End))...)
+		}
+	}
+
+	return subtitle.Normalize(cues), nil
+}
+
+// sceneWindow 片段在成片中用于字幕、配音的时间区间（秒）
+type sceneWindow struct {
+	SceneID uint
+	Start   float64
+	End     float64
+}
+
+// buildSceneWindows 按合成顺序累计片段时间区间
+// 片段时长与 ffmpeg 合成保持一致：设置了裁剪区间时取 EndTime-StartTime，否则取 Duration。
+// 转场期间画面由上一镜头与本镜头叠化，本镜头区间从转场中点开始。
+func buildSceneWindows(scenes []models.SceneClip) []sceneWindow {
+	ordered := make([]models.SceneClip, len(scenes))
+	copy(ordered, scenes)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Order < ordered[j].Order })
+
+	windows := make([]sceneWindow, 0, len(ordered))
+	cursor := 0.0
+	lead := 0.0 // 上一片段转场进入本片段的时长
+	for _, scene := range ordered {
+		duration := scene.Duration
+		if scene.EndTime > 0 && scene.EndTime > scene.StartTime {
+			duration = scene.EndTime - scene.StartTime
+		}
+		if duration <= 0 {
+			continue
+		}
+
+		windows = append(windows, sceneWindow{
+			SceneID: scene.SceneID,
+			Start:   cursor + lead/2,
+			End:     cursor + duration,
+		})
+
+		cursor += duration
+		lead = sceneTransitionDuration(scene.Transition)
+	}
+	return windows
+}
+
+// sceneTransitionDuration 与 ffmpeg.mergeWithXfade 的转场时长取值规则保持一致（秒）
+func sceneTransitionDuration(transition map[string]interface{}) float64 {
+	if len(transition) == 0 {
+		return 0
+	}
+	// 没有 type 时 ffmpeg 按无转场直接拼接
+	tType, _ := transition["type"].(string)
+	if tType == "" || strings.ToLower(tType) == "none" {
+		return 0
+	}
+	if d, ok := transition["duration"].(float64); ok && d > 0 {
+		return d
+	}
+	return 1.0
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
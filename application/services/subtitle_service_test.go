@@ -0,0 +1,94 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+)
+
+func TestSubtitleService_BuildSceneCuesHonoursTrimAndTransitions(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewSubtitleService(db, logger.NewLogger(true))
+
+	first, second := "第一句", "第二句"
+	sbA := models.Storyboard{UserID: 1, EpisodeID: 1, StoryboardNumber: 1, Duration: 5, Dialogue: &first}
+	sbB := models.Storyboard{UserID: 1, EpisodeID: 1, StoryboardNumber: 2, Duration: 5, Dialogue: &second}
+	db.Create(&sbA)
+	db.Create(&sbB)
+
+	cues, err := svc.BuildSceneCues(1, []models.SceneClip{
+		{SceneID: sbB.ID, Duration: 5, Order: 1},
+		{SceneID: sbA.ID, Duration: 5, StartTime: 1, EndTime: 4, Order: 0, Transition: map[string]interface{}{"type": "fade", "duration": 1.0}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cues) != 2 {
+		t.Fatalf("expected 2 cues, got %+v", cues)
+	}
+	// 第一段裁剪为 1-4 秒，占用时间轴 0-3 秒
+	if cues[0].Text != first || cues[0].Start != 0 || cues[0].End != 3*time.Second {
+		t.Fatalf("unexpected first cue: %+v", cues[0])
+	}
+	// 第二段从 3 秒开始，转场 1 秒，字幕从转场中点 3.5 秒显示
+	if cues[1].Text != second || cues[1].Start != 3500*time.Millisecond || cues[1].End != 8*time.Second {
+		t.Fatalf("unexpected second cue: %+v", cues[1])
+	}
+
+	// 没有 type 的转场按直接拼接处理，字幕不后移
+	cues, err = svc.BuildSceneCues(1, []models.SceneClip{
+		{SceneID: sbA.ID, Duration: 5, Order: 0, Transition: map[string]interface{}{"duration": 1.0}},
+		{SceneID: sbB.ID, Duration: 5, Order: 1},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cues) != 2 || cues[1].Start != 5*time.Second {
+		t.Fatalf("expected untyped transition to be a plain cut, got %+v", cues)
+	}
+
+	// 其他剧集的片段 ID 不读取台词
+	cues, err = svc.BuildSceneCues(2, []models.SceneClip{{SceneID: sbA.ID, Duration: 5, Order: 0}})
+	if err != nil || len(cues) != 0 {
+		t.Fatalf("expected dialogue scoped to the episode, got %+v (%v)", cues, err)
+	}
+}
+
+func TestSubtitleService_ExportUsesLatestMergeOrder(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.VideoMerge{}); err != nil {
+		t.Fatalf("failed to migrate video merges: %v", err)
+	}
+	svc := NewSubtitleService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	var storyboards []models.Storyboard
+	db.Where("episode_id = ?", episode.ID).Order("storyboard_number ASC").Find(&storyboards)
+	line := "只合成了第三镜"
+	db.Model(&storyboards[2]).Update("dialogue", line)
+
+	scenes, _ := json.Marshal([]models.SceneClip{{SceneID: storyboards[2].ID, Duration: 4, Order: 0}})
+	db.Create(&models.VideoMerge{EpisodeID: episode.ID, DramaID: episode.DramaID, Provider: "doubao", Scenes: scenes, Status: models.VideoMergeStatusCompleted})
+
+	file, err := svc.ExportEpisodeSubtitles(1, episode.ID, "vtt")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.HasPrefix(file.Content, "WEBVTT") || !strings.Contains(file.Content, "00:00:00.000 --> 00:00:04.000\n"+line) {
+		t.Fatalf("unexpected vtt content: %q", file.Content)
+	}
+	if file.FileName != "episode_1.vtt" {
+		t.Fatalf("unexpected file name: %s", file.FileName)
+	}
+
+	if _, err := svc.ExportEpisodeSubtitles(2, episode.ID, "srt"); err != ErrEpisodeNotFound {
+		t.Fatalf("expected ErrEpisodeNotFound for other user, got %v", err)
+	}
+	if _, err := svc.ExportEpisodeSubtitles(1, episode.ID, "ass"); err != ErrUnsupportedSubtitleFormat {
+		t.Fatalf("expected ErrUnsupportedSubtitleFormat, got %v", err)
+	}
+}
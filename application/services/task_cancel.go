@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const taskStatusCancelled = "cancelled"
+
+var (
+	// ErrTaskCancelled 任务已被用户取消
+	ErrTaskCancelled = errors.New("task cancelled")
+	// ErrTaskNotCancellable 任务已结束，无法取消
+	ErrTaskNotCancellable = errors.New("task already finished")
+)
+
+// taskCancelRegistry 记录本进程内正在执行的任务，取消时通知其 context
+// 跨进程的任务（如其他实例消费的 MQ 任务）通过数据库中的 cancelled 状态感知取消
+type taskCancelRegistry struct {
+	mu      sync.Mutex
+	cancels map[string]map[*context.CancelFunc]struct{}
+}
+
+func newTaskCancelRegistry() *taskCancelRegistry {
+	return &taskCancelRegistry{cancels: make(map[string]map[*context.CancelFunc]struct{})}
+}
+
+// track 为任务派生可取消的 context，执行结束后需调用返回的 release
+func (r *taskCancelRegistry) track(parent context.Context, key string) (context.Context, func()) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	handle := &cancel
+
+	r.mu.Lock()
+	if r.cancels[key] == nil {
+		r.cancels[key] = make(map[*context.CancelFunc]struct{})
+	}
+	r.cancels[key][handle] = struct{}{}
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels[key], handle)
+		if len(r.cancels[key]) == 0 {
+			delete(r.cancels, key)
+		}
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel 取消该任务在本进程内的所有执行，返回是否有正在执行的任务
+func (r *taskCancelRegistry) cancel(key string) bool {
+	r.mu.Lock()
+	handles := r.cancels[key]
+	delete(r.cancels, key)
+	r.mu.Unlock()
+
+	for handle := range handles {
+		(*handle)()
+	}
+	return len(handles) > 0
+}
+
+// taskBilling 记录任务本次执行中的积分预扣，任务被取消时统一退还
+type taskBilling struct {
+	mu     sync.Mutex
+	refIDs []string
+}
+
+type taskBillingKey struct{}
+
+func withTaskBilling(ctx context.Context) context.Context {
+	return context.WithValue(ctx, taskBillingKey{}, &taskBilling{})
+}
+
+// noteTaskBilling 登记任务执行中的预扣，ctx 不属于被跟踪的任务时忽略
+func noteTaskBilling(ctx context.Context, refID string) {
+	billing, ok := ctx.Value(taskBillingKey{}).(*taskBilling)
+	if !ok || refID == "" {
+		return
+	}
+	billing.mu.Lock()
+	billing.refIDs = append(billing.refIDs, refID)
+	billing.mu.Unlock()
+}
+
+func taskBillingRefs(ctx context.Context) []string {
+	billing, ok := ctx.Value(taskBillingKey{}).(*taskBilling)
+	if !ok {
+		return nil
+	}
+	billing.mu.Lock()
+	defer billing.mu.Unlock()
+	return append([]string(nil), billing.refIDs...)
+}
+
+func imageGenerationTaskKey(id uint) string {
+	return fmt.Sprintf("image_generation:%d", id)
+}
+
+func videoGenerationTaskKey(id uint) string {
+	return fmt.Sprintf("video_generation:%d", id)
+}
+
+func videoMergeTaskKey(id uint) string {
+	return fmt.Sprintf("video_merge:%d", id)
+}
+
+// sleepContext 等待指定时长，context 取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+)
+
+// taskEventBufferSize 每个订阅者的事件缓冲，消费过慢时丢弃新的进度事件，事件均为任务快照，后续事件会覆盖；
+// 结束事件之后不再有新快照，缓冲已满时淘汰最旧的事件腾出位置
+const taskEventBufferSize = 64
+
+// TaskEvent 任务状态变更事件，内容为变更后的任务快照
+type TaskEvent struct {
+	TaskID     string          `json:"task_id"`
+	UserID     uint            `json:"user_id"`
+	Type       string          `json:"type"`
+	ResourceID string          `json:"resource_id"`
+	Status     string          `json:"status"`
+	Progress   int             `json:"progress"`
+	Message    string          `json:"message,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// NewTaskEvent 由任务记录生成事件
+func NewTaskEvent(task *models.AsyncTask) TaskEvent {
+	event := TaskEvent{
+		TaskID:     task.ID,
+		UserID:     task.UserID,
+		Type:       task.Type,
+		ResourceID: task.ResourceID,
+		Status:     task.Status,
+		Progress:   task.Progress,
+		Message:    task.Message,
+		Error:      task.Error,
+		UpdatedAt:  task.UpdatedAt,
+	}
+	if task.Result != "" && json.Valid([]byte(task.Result)) {
+		event.Result = json.RawMessage(task.Result)
+	}
+	return event
+}
+
+// TaskEventBroadcaster 将任务事件广播到所有实例（包括本实例），由各实例投递给本地订阅者
+type TaskEventBroadcaster interface {
+	BroadcastTaskEvent(event TaskEvent) error
+}
+
+type taskEventSubscriber struct {
+	userID     uint
+	resourceID string
+	ch         chan TaskEvent
+}
+
+// TaskEventHub 进程内的任务事件发布订阅
+type TaskEventHub struct {
+	mu          sync.RWMutex
+	subscribers map[*taskEventSubscriber]struct{}
+	broadcaster TaskEventBroadcaster
+}
+
+func NewTaskEventHub() *TaskEventHub {
+	return &TaskEventHub{subscribers: make(map[*taskEventSubscriber]struct{})}
+}
+
+// SetBroadcaster 设置跨实例广播，为空时事件只在本进程内投递
+func (h *TaskEventHub) SetBroadcaster(broadcaster TaskEventBroadcaster) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcaster = broadcaster
+}
+
+// Subscribe 订阅用户在资源上的任务事件，userID 为 0 时不限用户，resourceID 为空时不限资源，不再使用时需调用返回的 unsubscribe
+func (h *TaskEventHub) Subscribe(userID uint, resourceID string) (<-chan TaskEvent, func()) {
+	sub := &taskEventSubscriber{userID: userID, resourceID: resourceID, ch: make(chan TaskEvent, taskEventBufferSize)}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, sub)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// active 是否需要发布事件：本地有订阅者或已启用跨实例广播
+func (h *TaskEventHub) active() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.broadcaster != nil || len(h.subscribers) > 0
+}
+
+// Publish 发布事件，启用广播时经由广播回到各实例，广播失败时仅投递本地
+func (h *TaskEventHub) Publish(event TaskEvent) error {
+	h.mu.RLock()
+	broadcaster := h.broadcaster
+	h.mu.RUnlock()
+
+	if broadcaster == nil {
+		h.Deliver(event)
+		return nil
+	}
+	if err := broadcaster.BroadcastTaskEvent(event); err != nil {
+		h.Deliver(event)
+		return err
+	}
+	return nil
+}
+
+// Deliver 将事件投递给本进程内的订阅者
+func (h *TaskEventHub) Deliver(event TaskEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	terminal := isTerminalTaskStatus(event.Status)
+	for sub := range h.subscribers {
+		if sub.userID != 0 && sub.userID != event.UserID {
+			continue
+		}
+		if sub.resourceID != "" && sub.resourceID != event.ResourceID {
+			continue
+		}
+		sub.offer(event, terminal)
+	}
+}
+
+// offer 非阻塞投递事件，缓冲已满时 evict 为 true 则淘汰最旧的事件后重试，否则丢弃
+func (sub *taskEventSubscriber) offer(event TaskEvent, evict bool) {
+	for {
+		select {
+		case sub.ch <- event:
+			return
+		default:
+		}
+		if !evict {
+			return
+		}
+		select {
+		case <-sub.ch:
+		default:
+		}
+	}
+}
+
+func isTerminalTaskStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == taskStatusCancelled
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,21 +14,29 @@ import (
 )
 
 type TaskService struct {
-	db  *gorm.DB
-	log *logger.Logger
+	db      *gorm.DB
+	log     *logger.Logger
+	running *taskCancelRegistry
+	events  *TaskEventHub
+	// webhooks 共享给持有 TaskService 的业务服务触发生命周期事件
+	webhooks WebhookEmitter
 }
 
-func NewTaskService(db *gorm.DB, log *logger.Logger) *TaskService {
+func NewTaskService(db *gorm.DB, log *logger.Logger, events *TaskEventHub, webhooks WebhookEmitter) *TaskService {
 	return &TaskService{
-		db:  db,
-		log: log,
+		db:       db,
+		log:      log,
+		running:  newTaskCancelRegistry(),
+		events:   events,
+		webhooks: webhooks,
 	}
 }
 
 // CreateTask 创建新任务
-func (s *TaskService) CreateTask(taskType, resourceID string) (*models.AsyncTask, error) {
+func (s *TaskService) CreateTask(userID uint, taskType, resourceID string) (*models.AsyncTask, error) {
 	task := &models.AsyncTask{
 		ID:         uuid.New().String(),
+		UserID:     userID,
 		Type:       taskType,
 		Status:     "pending",
 		Progress:   0,
@@ -43,7 +52,7 @@ func (s *TaskService) CreateTask(taskType, resourceID string) (*models.AsyncTask
 
 // CreateOrGetActiveTask returns an existing active task (pending/processing) for the same type+resource.
 // The returned bool indicates whether a new task row was created.
-func (s *TaskService) CreateOrGetActiveTask(taskType, resourceID string) (*models.AsyncTask, bool, error) {
+func (s *TaskService) CreateOrGetActiveTask(userID uint, taskType, resourceID string) (*models.AsyncTask, bool, error) {
 	var existing models.AsyncTask
 	err := s.db.
 		Where("type = ? AND resource_id = ? AND status IN ?", taskType, resourceID, []string{"pending", "processing"}).
@@ -56,7 +65,7 @@ func (s *TaskService) CreateOrGetActiveTask(taskType, resourceID string) (*model
 		return nil, false, fmt.Errorf("failed to query active task: %w", err)
 	}
 
-	task, createErr := s.CreateTask(taskType, resourceID)
+	task, createErr := s.CreateTask(userID, taskType, resourceID)
 	if createErr != nil {
 		return nil, false, createErr
 	}
@@ -77,23 +86,50 @@ func (s *TaskService) UpdateTaskStatus(taskID, status string, progress int, mess
 		updates["completed_at"] = &now
 	}
 
-	return s.db.Model(&models.AsyncTask{}).
-		Where("id = ?", taskID).
-		Updates(updates).Error
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status <> ?", taskID, taskStatusCancelled).
+		Updates(updates).Error; err != nil {
+		return err
+	}
+	s.publishTaskEvent(taskID, status)
+	return nil
 }
 
 // UpdateTaskError 更新任务错误
 func (s *TaskService) UpdateTaskError(taskID string, err error) error {
 	now := time.Now()
-	return s.db.Model(&models.AsyncTask{}).
-		Where("id = ?", taskID).
+	if dbErr := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status <> ?", taskID, taskStatusCancelled).
 		Updates(map[string]interface{}{
 			"status":       "failed",
 			"error":        err.Error(),
 			"progress":     0,
 			"completed_at": &now,
 			"updated_at":   time.Now(),
-		}).Error
+		}).Error; dbErr != nil {
+		return dbErr
+	}
+	s.publishTaskEvent(taskID, "failed")
+	return nil
+}
+
+// failOrRetry 任务总线还会重试该错误时任务回到排队状态，并返回错误交给总线退避重试；否则记录失败。
+// 重试耗尽的临时性错误同样返回，使任务进入死信队列
+func (s *TaskService) failOrRetry(ctx context.Context, taskID string, err error) error {
+	if willRetryJob(ctx, err) {
+		s.log.Warnw("Task failed with transient error, retry scheduled", "task_id", taskID, "error", err)
+		if updateErr := s.UpdateTaskStatus(taskID, "pending", 0, "服务暂时不可用，稍后自动重试"); updateErr != nil {
+			s.log.Errorw("Failed to update task status", "error", updateErr, "task_id", taskID)
+		}
+		return err
+	}
+	if updateErr := s.UpdateTaskError(taskID, err); updateErr != nil {
+		s.log.Errorw("Failed to update task error", "error", updateErr, "task_id", taskID)
+	}
+	if IsRetryableJobError(err) {
+		return err
+	}
+	return nil
 }
 
 // UpdateTaskResult 更新任务结果
@@ -104,15 +140,19 @@ func (s *TaskService) UpdateTaskResult(taskID string, result interface{}) error
 	}
 
 	now := time.Now()
-	return s.db.Model(&models.AsyncTask{}).
-		Where("id = ?", taskID).
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status <> ?", taskID, taskStatusCancelled).
 		Updates(map[string]interface{}{
 			"status":       "completed",
 			"progress":     100,
 			"result":       string(resultJSON),
 			"completed_at": &now,
 			"updated_at":   time.Now(),
-		}).Error
+		}).Error; err != nil {
+		return err
+	}
+	s.publishTaskEvent(taskID, "completed")
+	return nil
 }
 
 // UpdateTaskProgressResult updates an in-flight task with progress and partial result payload.
@@ -135,9 +175,126 @@ func (s *TaskService) UpdateTaskProgressResult(taskID, status string, progress i
 		updates["completed_at"] = &now
 	}
 
-	return s.db.Model(&models.AsyncTask{}).
-		Where("id = ?", taskID).
-		Updates(updates).Error
+	if err := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND status <> ?", taskID, taskStatusCancelled).
+		Updates(updates).Error; err != nil {
+		return err
+	}
+	s.publishTaskEvent(taskID, status)
+	return nil
+}
+
+// CancelTask 取消用户进行中的任务
+// 数据库状态置为 cancelled 后，后续进度更新不会覆盖该状态；本进程内的执行会收到 context 取消
+// 执行中已预扣的积分由处理方结束时通过 RefundCancelled 退还
+func (s *TaskService) CancelTask(userID uint, taskID string) (*models.AsyncTask, error) {
+	var task models.AsyncTask
+	if err := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		return nil, err
+	}
+	if task.Status != "pending" && task.Status != "processing" {
+		return nil, ErrTaskNotCancellable
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.AsyncTask{}).
+		Where("id = ? AND user_id = ? AND status IN ?", taskID, userID, []string{"pending", "processing"}).
+		Updates(map[string]interface{}{
+			"status":       taskStatusCancelled,
+			"message":      "任务已取消",
+			"completed_at": &now,
+			"updated_at":   now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel task: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotCancellable
+	}
+
+	running := s.running.cancel(taskID)
+	s.log.Infow("Task cancelled", "task_id", taskID, "type", task.Type, "running_in_process", running)
+
+	cancelled, err := s.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(cancelled)
+	return cancelled, nil
+}
+
+// SubscribeTaskEvents 订阅用户在资源上的任务进度事件
+func (s *TaskService) SubscribeTaskEvents(userID uint, resourceID string) (<-chan TaskEvent, func()) {
+	return s.events.Subscribe(userID, resourceID)
+}
+
+// publishTaskEvent 任务变更后发布最新快照，无人订阅时跳过；任务结束时同时触发 webhook
+func (s *TaskService) publishTaskEvent(taskID, status string) {
+	finished := status == "completed" || status == "failed"
+	if !finished && !s.events.active() {
+		return
+	}
+	task, err := s.GetTask(taskID)
+	if err != nil {
+		s.log.Warnw("Failed to load task for event", "task_id", taskID, "error", err)
+		return
+	}
+	s.publish(task)
+
+	switch task.Status {
+	case "completed":
+		emitWebhook(s.webhooks, task.UserID, WebhookEventTaskCompleted, NewTaskEvent(task))
+	case "failed":
+		emitWebhook(s.webhooks, task.UserID, WebhookEventTaskFailed, NewTaskEvent(task))
+	}
+}
+
+func (s *TaskService) publish(task *models.AsyncTask) {
+	if err := s.events.Publish(NewTaskEvent(task)); err != nil {
+		s.log.Warnw("Failed to broadcast task event", "task_id", task.ID, "error", err)
+	}
+}
+
+// IsTaskCancelled 检查任务是否已被取消
+func (s *TaskService) IsTaskCancelled(taskID string) bool {
+	var status string
+	if err := s.db.Model(&models.AsyncTask{}).Where("id = ?", taskID).Select("status").Scan(&status).Error; err != nil {
+		return false
+	}
+	return status == taskStatusCancelled
+}
+
+// TrackTask 登记正在执行的任务，返回的 context 会在任务被取消时结束，执行完毕后需调用 release
+// 排队期间已被取消的任务返回已结束的 context
+func (s *TaskService) TrackTask(ctx context.Context, taskID string) (context.Context, func()) {
+	ctx, release := s.running.track(withTaskBilling(ctx), taskID)
+	if s.IsTaskCancelled(taskID) {
+		s.running.cancel(taskID)
+	}
+	return ctx, release
+}
+
+// RefundCancelled 任务已取消时退还本次执行中登记的全部预扣，返回是否已取消
+// 以数据库状态为准，取消可能发生在其他实例；处理方在 release 之前 defer 调用
+func (s *TaskService) RefundCancelled(ctx context.Context, taskID string, billing *BillingService) bool {
+	if !s.IsTaskCancelled(taskID) {
+		return false
+	}
+	for _, refID := range taskBillingRefs(ctx) {
+		if err := billing.RefundAI(refID); err != nil {
+			s.log.Errorw("Failed to refund cancelled task billing", "error", err, "task_id", taskID, "ref_id", refID)
+		}
+	}
+	return true
+}
+
+// trackRunning 登记以 key 标识的执行（如生成记录的轮询），取消时通过 cancelRunning 结束其 context
+func (s *TaskService) trackRunning(ctx context.Context, key string) (context.Context, func()) {
+	return s.running.track(ctx, key)
+}
+
+func (s *TaskService) cancelRunning(key string) bool {
+	return s.running.cancel(key)
 }
 
 // GetTask 获取任务信息
@@ -149,10 +306,19 @@ func (s *TaskService) GetTask(taskID string) (*models.AsyncTask, error) {
 	return &task, nil
 }
 
-// GetTasksByResource 获取资源相关的所有任务
-func (s *TaskService) GetTasksByResource(resourceID string) ([]*models.AsyncTask, error) {
+// GetUserTask 获取属于用户的任务信息
+func (s *TaskService) GetUserTask(userID uint, taskID string) (*models.AsyncTask, error) {
+	var task models.AsyncTask
+	if err := s.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetTasksByResource 获取用户在资源上的所有任务
+func (s *TaskService) GetTasksByResource(userID uint, resourceID string) ([]*models.AsyncTask, error) {
 	var tasks []*models.AsyncTask
-	if err := s.db.Where("resource_id = ?", resourceID).
+	if err := s.db.Where("user_id = ? AND resource_id = ?", userID, resourceID).
 		Order("created_at DESC").
 		Find(&tasks).Error; err != nil {
 		return nil, err
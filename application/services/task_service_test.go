@@ -1,10 +1,13 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
 	"github.com/drama-generator/backend/pkg/logger"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -30,9 +33,9 @@ func newTaskServiceTestDB(t *testing.T) *gorm.DB {
 
 func TestTaskService_CreateOrGetActiveTask_ReusesPendingTask(t *testing.T) {
 	db := newTaskServiceTestDB(t)
-	svc := NewTaskService(db, logger.NewLogger(true))
+	svc := NewTaskService(db, logger.NewLogger(true), NewTaskEventHub(), nil)
 
-	first, created, err := svc.CreateOrGetActiveTask("storyboard_generation", "101")
+	first, created, err := svc.CreateOrGetActiveTask(1, "storyboard_generation", "101")
 	if err != nil {
 		t.Fatalf("first call error: %v", err)
 	}
@@ -40,7 +43,7 @@ func TestTaskService_CreateOrGetActiveTask_ReusesPendingTask(t *testing.T) {
 		t.Fatalf("expected first call to create task")
 	}
 
-	second, created, err := svc.CreateOrGetActiveTask("storyboard_generation", "101")
+	second, created, err := svc.CreateOrGetActiveTask(1, "storyboard_generation", "101")
 	if err != nil {
 		t.Fatalf("second call error: %v", err)
 	}
@@ -64,9 +67,9 @@ func TestTaskService_CreateOrGetActiveTask_ReusesPendingTask(t *testing.T) {
 
 func TestTaskService_CreateOrGetActiveTask_CreatesNewAfterCompleted(t *testing.T) {
 	db := newTaskServiceTestDB(t)
-	svc := NewTaskService(db, logger.NewLogger(true))
+	svc := NewTaskService(db, logger.NewLogger(true), NewTaskEventHub(), nil)
 
-	first, created, err := svc.CreateOrGetActiveTask("storyboard_generation", "202")
+	first, created, err := svc.CreateOrGetActiveTask(1, "storyboard_generation", "202")
 	if err != nil {
 		t.Fatalf("first call error: %v", err)
 	}
@@ -78,7 +81,7 @@ func TestTaskService_CreateOrGetActiveTask_CreatesNewAfterCompleted(t *testing.T
 		t.Fatalf("failed to complete first task: %v", err)
 	}
 
-	second, created, err := svc.CreateOrGetActiveTask("storyboard_generation", "202")
+	second, created, err := svc.CreateOrGetActiveTask(1, "storyboard_generation", "202")
 	if err != nil {
 		t.Fatalf("second call error: %v", err)
 	}
@@ -102,9 +105,9 @@ func TestTaskService_CreateOrGetActiveTask_CreatesNewAfterCompleted(t *testing.T
 
 func TestTaskService_UpdateTaskProgressResult_PersistsProcessingPayload(t *testing.T) {
 	db := newTaskServiceTestDB(t)
-	svc := NewTaskService(db, logger.NewLogger(true))
+	svc := NewTaskService(db, logger.NewLogger(true), NewTaskEventHub(), nil)
 
-	task, _, err := svc.CreateOrGetActiveTask("storyboard_generation", "303")
+	task, _, err := svc.CreateOrGetActiveTask(1, "storyboard_generation", "303")
 	if err != nil {
 		t.Fatalf("create task error: %v", err)
 	}
@@ -142,3 +145,226 @@ func TestTaskService_UpdateTaskProgressResult_PersistsProcessingPayload(t *testi
 		t.Fatalf("expected is_partial=true, got %#v", parsed["is_partial"])
 	}
 }
+
+func TestTaskService_CancelTask_StopsTrackedWorkAndKeepsStatus(t *testing.T) {
+	db := newTaskServiceTestDB(t)
+	svc := NewTaskService(db, logger.NewLogger(true), NewTaskEventHub(), nil)
+
+	task, _, err := svc.CreateOrGetActiveTask(1, "storyboard_generation", "404")
+	if err != nil {
+		t.Fatalf("create task error: %v", err)
+	}
+	ctx, release := svc.TrackTask(context.Background(), task.ID)
+	defer release()
+
+	if _, err := svc.CancelTask(2, task.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected other users not to cancel the task, got %v", err)
+	}
+	cancelled, err := svc.CancelTask(1, task.ID)
+	if err != nil {
+		t.Fatalf("cancel task error: %v", err)
+	}
+	if cancelled.Status != "cancelled" || cancelled.CompletedAt == nil {
+		t.Fatalf("expected cancelled task with completed_at, got %+v", cancelled)
+	}
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatalf("expected tracked context to be cancelled")
+	}
+
+	// 取消后执行中的任务回写结果不应覆盖取消状态
+	if err := svc.UpdateTaskResult(task.ID, map[string]any{"ok": true}); err != nil {
+		t.Fatalf("update task result error: %v", err)
+	}
+	saved, _ := svc.GetTask(task.ID)
+	if saved.Status != "cancelled" || saved.Result != "" {
+		t.Fatalf("expected cancelled status to be kept, got %s result=%q", saved.Status, saved.Result)
+	}
+
+	if _, err := svc.CancelTask(1, task.ID); !errors.Is(err, ErrTaskNotCancellable) {
+		t.Fatalf("expected ErrTaskNotCancellable on second cancel, got %v", err)
+	}
+
+	// 已取消的任务重新入队执行时直接拿到已结束的 context
+	requeued, requeuedRelease := svc.TrackTask(context.Background(), task.ID)
+	defer requeuedRelease()
+	if requeued.Err() == nil {
+		t.Fatalf("expected context of cancelled task to be done")
+	}
+}
+
+func TestTaskService_GetUserTask_ScopesToOwner(t *testing.T) {
+	db := newTaskServiceTestDB(t)
+	svc := NewTaskService(db, logger.NewLogger(true), NewTaskEventHub(), nil)
+
+	task, err := svc.CreateTask(1, "storyboard_generation", "505")
+	if err != nil {
+		t.Fatalf("create task error: %v", err)
+	}
+	if _, err := svc.GetUserTask(2, task.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected other users not to read the task, got %v", err)
+	}
+	got, err := svc.GetUserTask(1, task.ID)
+	if err != nil || got.ID != task.ID {
+		t.Fatalf("expected owner to read the task, got %+v, %v", got, err)
+	}
+}
+
+func TestTaskService_RefundCancelledReturnsTrackedReservations(t *testing.T) {
+	db := newTaskServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+	svc := NewTaskService(db, log, NewTaskEventHub(), nil)
+	billing := NewBillingService(db, &config.Config{}, nil, log)
+
+	user := models.User{Email: "cancel-refund@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 10}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	task, err := svc.CreateTask(user.ID, "character_extraction", "refund-1")
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	ctx, release := svc.TrackTask(context.Background(), task.ID)
+	defer release()
+	for i := 0; i < 2; i++ {
+		refID, err := billing.ReserveAI(user.ID, "text", "gpt-4o", 3, "text:gpt-4o")
+		if err != nil {
+			t.Fatalf("failed to reserve: %v", err)
+		}
+		noteTaskBilling(ctx, refID)
+	}
+
+	if svc.RefundCancelled(ctx, task.ID, billing) {
+		t.Fatalf("expected running task not to be refunded")
+	}
+	if _, err := svc.CancelTask(user.ID, task.ID); err != nil {
+		t.Fatalf("failed to cancel task: %v", err)
+	}
+	if !svc.RefundCancelled(ctx, task.ID, billing) {
+		t.Fatalf("expected cancelled task to be reported")
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 10 {
+		t.Fatalf("expected every reservation refunded, got balance %d", reloaded.Credits)
+	}
+}
+
+func TestTaskService_PublishesProgressEventsForResource(t *testing.T) {
+	db := newTaskServiceTestDB(t)
+	svc := NewTaskService(db, logger.NewLogger(true), NewTaskEventHub(), nil)
+
+	task, err := svc.CreateTask(1, "storyboard_generation", "events-1")
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	other, err := svc.CreateTask(1, "storyboard_generation", "events-2")
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	foreign, err := svc.CreateTask(2, "storyboard_generation", "events-1")
+	if err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	events, unsubscribe := svc.SubscribeTaskEvents(1, "events-1")
+	defer unsubscribe()
+
+	if err := svc.UpdateTaskProgressResult(other.ID, "processing", 10, "other", nil); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	if err := svc.UpdateTaskProgressResult(foreign.ID, "processing", 20, "foreign", nil); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	if err := svc.UpdateTaskProgressResult(task.ID, "processing", 40, "第 2 段完成", map[string]int{"segments": 2}); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	if err := svc.UpdateTaskResult(task.ID, map[string]int{"total": 5}); err != nil {
+		t.Fatalf("failed to complete task: %v", err)
+	}
+
+	first := <-events
+	if first.TaskID != task.ID || first.Progress != 40 || first.Message != "第 2 段完成" || string(first.Result) != `{"segments":2}` {
+		t.Fatalf("unexpected progress event: %+v", first)
+	}
+	second := <-events
+	if second.Status != "completed" || second.Progress != 100 || string(second.Result) != `{"total":5}` {
+		t.Fatalf("unexpected completion event: %+v", second)
+	}
+	select {
+	case extra := <-events:
+		t.Fatalf("expected no events for other resources or users, got %+v", extra)
+	default:
+	}
+}
+
+type recordingTaskEventBroadcaster struct {
+	hub    *TaskEventHub
+	events []TaskEvent
+}
+
+func (b *recordingTaskEventBroadcaster) BroadcastTaskEvent(event TaskEvent) error {
+	b.events = append(b.events, event)
+	b.hub.Deliver(event)
+	return nil
+}
+
+func TestTaskEventHub_PublishesThroughBroadcaster(t *testing.T) {
+	hub := NewTaskEventHub()
+	broadcaster := &recordingTaskEventBroadcaster{hub: hub}
+	hub.SetBroadcaster(broadcaster)
+
+	events, unsubscribe := hub.Subscribe(0, "")
+	if err := hub.Publish(TaskEvent{TaskID: "t1", ResourceID: "r1", Status: "processing"}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	if len(broadcaster.events) != 1 {
+		t.Fatalf("expected event to be broadcast, got %d", len(broadcaster.events))
+	}
+	if got := <-events; got.TaskID != "t1" {
+		t.Fatalf("expected broadcast event to be delivered once, got %+v", got)
+	}
+	select {
+	case extra := <-events:
+		t.Fatalf("expected no duplicate local delivery, got %+v", extra)
+	default:
+	}
+
+	unsubscribe()
+	hub.Deliver(TaskEvent{TaskID: "t2"})
+	select {
+	case extra := <-events:
+		t.Fatalf("expected no events after unsubscribe, got %+v", extra)
+	default:
+	}
+}
+
+func TestTaskEventHub_DeliversTerminalEventWhenBufferFull(t *testing.T) {
+	hub := NewTaskEventHub()
+	events, unsubscribe := hub.Subscribe(1, "r1")
+	defer unsubscribe()
+
+	for i := 0; i < taskEventBufferSize+5; i++ {
+		hub.Deliver(TaskEvent{TaskID: "t1", UserID: 1, ResourceID: "r1", Status: "processing", Progress: i})
+	}
+	hub.Deliver(TaskEvent{TaskID: "t1", UserID: 1, ResourceID: "r1", Status: "completed", Progress: 100})
+
+	var last TaskEvent
+	for i := 0; i < taskEventBufferSize; i++ {
+		last = <-events
+	}
+	if last.Status != "completed" {
+		t.Fatalf("expected terminal event to evict the oldest buffered event, got %+v", last)
+	}
+	select {
+	case extra := <-events:
+		t.Fatalf("expected buffer to hold %d events, got extra %+v", taskEventBufferSize, extra)
+	default:
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/external/ffmpeg"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+const timelineRenderTaskType = "timeline_render"
+
+// TimelineRenderService 将保存的时间线渲染为成片
+type TimelineRenderService struct {
+	db              *gorm.DB
+	timelineService *TimelineService
+	taskService     *TaskService
+	ffmpeg          *ffmpeg.FFmpeg
+	storagePath     string
+	baseURL         string
+	fontFile        string
+	log             *logger.Logger
+	runner          *TaskRunner
+	dispatcher      JobDispatcher
+}
+
+func NewTimelineRenderService(db *gorm.DB, cfg *config.Config, taskService *TaskService, dispatcher JobDispatcher, log *logger.Logger) *TimelineRenderService {
+	return &TimelineRenderService{
+		db:              db,
+		timelineService: NewTimelineService(db, log),
+		taskService:     taskService,
+		ffmpeg:          ffmpeg.NewFFmpeg(log),
+		storagePath:     cfg.Storage.LocalPath,
+		baseURL:         cfg.Storage.BaseURL,
+		fontFile:        cfg.App.FontFile,
+		log:             log,
+		runner:          NewTaskRunner(log, 2),
+		dispatcher:      dispatcher,
+	}
+}
+
+// RenderTimeline 创建时间线渲染任务，返回任务ID
+func (s *TimelineRenderService) RenderTimeline(userID, timelineID uint) (string, error) {
+	timeline, err := s.timelineService.loadTimeline(s.db, userID, timelineID)
+	if err != nil {
+		return "", err
+	}
+
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, timelineRenderTaskType, strconv.FormatUint(uint64(timeline.ID), 10))
+	if err != nil {
+		return "", fmt.Errorf("创建任务失败: %w", err)
+	}
+	if !created {
+		s.log.Infow("Reusing active timeline render task", "task_id", task.ID, "timeline_id", timeline.ID)
+		return task.ID, nil
+	}
+
+	if err := s.db.Model(timeline).Update("status", models.TimelineStatusExporting).Error; err != nil {
+		// 任务未派发，标记失败以免后续请求复用这个不会执行的任务
+		if updateErr := s.taskService.UpdateTaskError(task.ID, err); updateErr != nil {
+			s.log.Errorw("Failed to update render task error", "error", updateErr, "task_id", task.ID)
+		}
+		return "", fmt.Errorf("更新时间线状态失败: %w", err)
+	}
+
+	payload := TimelineRenderJobPayload{
+		UserID:     userID,
+		TaskID:     task.ID,
+		TimelineID: timeline.ID,
+	}
+	if err := s.dispatchTimelineRender(payload); err != nil {
+		s.log.Warnw("Failed to dispatch timeline render through task bus, fallback to local runner", "error", err, "task_id", task.ID)
+		s.runner.Submit("timeline.render", func() {
+			s.ProcessTimelineRender(context.Background(), payload)
+		})
+	}
+
+	return task.ID, nil
+}
+
+func (s *TimelineRenderService) dispatchTimelineRender(payload TimelineRenderJobPayload) error {
+	if s.dispatcher == nil {
+		return fmt.Errorf("task dispatcher not configured")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal timeline render job payload: %w", err)
+	}
+
+	return s.dispatcher.Dispatch(AsyncJob{
+		Type:    JobTypeTimelineRender,
+		Payload: body,
+	})
+}
+
+// ProcessTimelineRender 后台渲染时间线，临时性错误（如下载素材超时）返回给任务总线重试
+func (s *TimelineRenderService) ProcessTimelineRender(ctx context.Context, payload TimelineRenderJobPayload) error {
+	taskID := payload.TaskID
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	if ctx.Err() != nil {
+		s.log.Infow("Task cancelled before start", "task_id", taskID)
+		return nil
+	}
+
+	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 0, "开始渲染时间线..."); err != nil {
+		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
+		return nil
+	}
+
+	timeline, err := s.timelineService.GetTimeline(payload.UserID, payload.TimelineID)
+	if err != nil {
+		return s.failRender(ctx, taskID, payload.TimelineID, err)
+	}
+
+	fileName := fmt.Sprintf("timeline_%d_%d.mp4", timeline.ID, time.Now().Unix())
+	relPath := filepath.Join("videos", "timelines", fileName)
+
+	_, err = s.ffmpeg.RenderTimeline(ctx, timeline, &ffmpeg.TimelineRenderOptions{
+		OutputPath: filepath.Join(s.storagePath, relPath),
+		FontFile:   s.fontFile,
+		ResolveSource: func(clip *models.TimelineClip) (string, error) {
+			return s.resolveClipSource(payload.UserID, clip), nil
+		},
+		OnProgress: func(progress int, message string) {
+			if progress >= 100 {
+				return
+			}
+			if err := s.taskService.UpdateTaskStatus(taskID, "processing", progress, message); err != nil {
+				s.log.Warnw("Failed to update render progress", "error", err, "task_id", taskID)
+			}
+		},
+	})
+	if err != nil {
+		return s.failRender(ctx, taskID, timeline.ID, err)
+	}
+
+	videoURL := fmt.Sprintf("%s/%s", s.baseURL, filepath.ToSlash(relPath))
+	if err := s.db.Model(&models.Timeline{}).Where("id = ?", timeline.ID).Update("status", models.TimelineStatusCompleted).Error; err != nil {
+		s.log.Errorw("Failed to update timeline status", "error", err, "timeline_id", timeline.ID)
+	}
+	if err := s.taskService.UpdateTaskResult(taskID, map[string]interface{}{
+		"timeline_id": timeline.ID,
+		"video_url":   videoURL,
+		"duration":    timeline.Duration,
+	}); err != nil {
+		s.log.Errorw("Failed to update render task result", "error", err, "task_id", taskID)
+	}
+
+	s.log.Infow("Timeline rendered", "timeline_id", timeline.ID, "video_url", videoURL)
+	return nil
+}
+
+// failRender 记录渲染失败，还会重试时时间线保持导出中
+func (s *TimelineRenderService) failRender(ctx context.Context, taskID string, timelineID uint, err error) error {
+	s.log.Errorw("Timeline render failed", "error", err, "timeline_id", timelineID, "task_id", taskID)
+	if !willRetryJob(ctx, err) {
+		if updateErr := s.db.Model(&models.Timeline{}).Where("id = ?", timelineID).Update("status", models.TimelineStatusEditing).Error; updateErr != nil {
+			s.log.Errorw("Failed to update timeline status", "error", updateErr, "timeline_id", timelineID)
+		}
+	}
+	return s.taskService.failOrRetry(ctx, taskID, err)
+}
+
+// resolveClipSource 解析片段素材地址：优先素材库，其次分镜最新完成的视频
+func (s *TimelineRenderService) resolveClipSource(userID uint, clip *models.TimelineClip) string {
+	if clip.AssetID != nil {
+		var asset models.Asset
+		if err := s.db.Where("id = ? AND user_id = ?", *clip.AssetID, userID).First(&asset).Error; err == nil {
+			if asset.LocalPath != nil && *asset.LocalPath != "" {
+				return s.absoluteStoragePath(*asset.LocalPath)
+			}
+			return asset.URL
+		}
+		s.log.Warnw("Clip asset not found, will try storyboard video", "clip_id", clip.ID, "asset_id", *clip.AssetID)
+	}
+
+	if clip.StoryboardID != nil {
+		var videoGen models.VideoGeneration
+		if err := s.db.Where("storyboard_id = ? AND user_id = ? AND status = ?", *clip.StoryboardID, userID, "completed").
+			Order("created_at DESC").First(&videoGen).Error; err == nil {
+			if videoGen.LocalPath != nil && *videoGen.LocalPath != "" {
+				return s.absoluteStoragePath(*videoGen.LocalPath)
+			}
+			if videoGen.VideoURL != nil && *videoGen.VideoURL != "" {
+				return *videoGen.VideoURL
+			}
+		}
+
+		var storyboard models.Storyboard
+		if err := s.db.Where("id = ? AND user_id = ?", *clip.StoryboardID, userID).First(&storyboard).Error; err == nil {
+			if storyboard.VideoURL != nil && *storyboard.VideoURL != "" {
+				return *storyboard.VideoURL
+			}
+		}
+	}
+
+	return ""
+}
+
+func (s *TimelineRenderService) absoluteStoragePath(path string) string {
+	if filepath.IsAbs(path) || filepath.HasPrefix(path, s.storagePath) {
+		return path
+	}
+	return filepath.Join(s.storagePath, path)
+}
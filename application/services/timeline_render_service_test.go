@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+func TestTimelineRenderService_RenderDispatchesJob(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.AsyncTask{}); err != nil {
+		t.Fatalf("failed to migrate tasks: %v", err)
+	}
+	log := logger.NewLogger(true)
+	dispatcher := &capturingDispatcher{}
+	svc := NewTimelineRenderService(db, &config.Config{Storage: config.StorageConfig{LocalPath: t.TempDir()}}, NewTaskService(db, log, NewTaskEventHub(), nil), dispatcher, log)
+
+	episode := seedTimelineEpisode(t, db, 1)
+	timeline, err := NewTimelineService(db, log).CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+
+	taskID, err := svc.RenderTimeline(1, timeline.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dispatcher.job.Type != JobTypeTimelineRender {
+		t.Fatalf("expected job type %s, got %s", JobTypeTimelineRender, dispatcher.job.Type)
+	}
+
+	var payload TimelineRenderJobPayload
+	if err := json.Unmarshal(dispatcher.job.Payload, &payload); err != nil {
+		t.Fatalf("unmarshal payload error: %v", err)
+	}
+	if payload.TaskID != taskID || payload.TimelineID != timeline.ID || payload.UserID != 1 {
+		t.Fatalf("unexpected payload: %#v", payload)
+	}
+
+	var reloaded models.Timeline
+	db.First(&reloaded, timeline.ID)
+	if reloaded.Status != models.TimelineStatusExporting {
+		t.Fatalf("expected exporting status, got %s", reloaded.Status)
+	}
+
+	again, err := svc.RenderTimeline(1, timeline.ID)
+	if err != nil || again != taskID {
+		t.Fatalf("expected active task %s to be reused, got %s (%v)", taskID, again, err)
+	}
+
+	if _, err := svc.RenderTimeline(2, timeline.ID); err != ErrTimelineNotFound {
+		t.Fatalf("expected ErrTimelineNotFound for other user, got %v", err)
+	}
+}
+
+func TestTimelineRenderService_RenderFailsTaskWhenStatusUpdateFails(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.AsyncTask{}); err != nil {
+		t.Fatalf("failed to migrate tasks: %v", err)
+	}
+	log := logger.NewLogger(true)
+	dispatcher := &capturingDispatcher{}
+	svc := NewTimelineRenderService(db, &config.Config{Storage: config.StorageConfig{LocalPath: t.TempDir()}}, NewTaskService(db, log, NewTaskEventHub(), nil), dispatcher, log)
+
+	episode := seedTimelineEpisode(t, db, 1)
+	timeline, err := NewTimelineService(db, log).CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("fail_timeline_update", func(tx *gorm.DB) {
+		if tx.Statement.Table == "timelines" {
+			tx.AddError(errors.New("database is locked"))
+		}
+	}); err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+
+	if _, err := svc.RenderTimeline(1, timeline.ID); err == nil {
+		t.Fatalf("expected status update error")
+	}
+	if dispatcher.job.Type != "" {
+		t.Fatalf("expected no job dispatched, got %s", dispatcher.job.Type)
+	}
+	var task models.AsyncTask
+	if err := db.Where("resource_id = ?", strconv.FormatUint(uint64(timeline.ID), 10)).First(&task).Error; err != nil {
+		t.Fatalf("failed to load task: %v", err)
+	}
+	if task.Status != "failed" {
+		t.Fatalf("expected task to be failed so it is not reused, got %s", task.Status)
+	}
+}
+
+func TestTimelineRenderService_ResolveClipSourcePrefersAssetLocalPath(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.VideoGeneration{}); err != nil {
+		t.Fatalf("failed to migrate video generations: %v", err)
+	}
+	storagePath := t.TempDir()
+	svc := NewTimelineRenderService(db, &config.Config{Storage: config.StorageConfig{LocalPath: storagePath}}, nil, nil, logger.NewLogger(true))
+
+	localPath := "videos/clip.mp4"
+	asset := models.Asset{UserID: 1, Name: "clip", Type: models.AssetTypeVideo, URL: "https://example.com/clip.mp4", LocalPath: &localPath}
+	if err := db.Create(&asset).Error; err != nil {
+		t.Fatalf("failed to seed asset: %v", err)
+	}
+
+	got := svc.resolveClipSource(1, &models.TimelineClip{AssetID: &asset.ID})
+	if want := filepath.Join(storagePath, localPath); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	otherUserVideo := "https://example.com/other.mp4"
+	storyboardVideo := "https://example.com/sb.mp4"
+	sb := models.Storyboard{UserID: 1, EpisodeID: 1, StoryboardNumber: 1, VideoURL: &storyboardVideo}
+	if err := db.Create(&sb).Error; err != nil {
+		t.Fatalf("failed to seed storyboard: %v", err)
+	}
+	if err := db.Create(&models.VideoGeneration{UserID: 2, StoryboardID: &sb.ID, Provider: "doubao", Prompt: "x", Status: "completed", VideoURL: &otherUserVideo}).Error; err != nil {
+		t.Fatalf("failed to seed video generation: %v", err)
+	}
+	if got := svc.resolveClipSource(1, &models.TimelineClip{StoryboardID: &sb.ID}); got != storyboardVideo {
+		t.Fatalf("expected storyboard video fallback, got %s", got)
+	}
+}
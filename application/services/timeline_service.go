@@ -0,0 +1,974 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/subtitle"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTimelineNotFound = errors.New("timeline not found")
+	ErrTrackNotFound    = errors.New("track not found")
+	ErrClipNotFound     = errors.New("clip not found")
+	ErrTrackLocked      = errors.New("track is locked")
+	ErrClipOverlap      = errors.New("clip overlaps another clip on the track")
+)
+
+// TimelineService 时间线编辑服务，所有时间字段单位均为毫秒
+type TimelineService struct {
+	db  *gorm.DB
+	log *logger.Logger
+}
+
+func NewTimelineService(db *gorm.DB, log *logger.Logger) *TimelineService {
+	return &TimelineService{
+		db:  db,
+		log: log,
+	}
+}
+
+type CreateTimelineRequest struct {
+	DramaID     uint    `json:"drama_id" binding:"required"`
+	EpisodeID   *uint   `json:"episode_id"`
+	Name        string  `json:"name" binding:"required"`
+	Description *string `json:"description"`
+	FPS         int     `json:"fps"`
+	Resolution  *string `json:"resolution"`
+}
+
+type UpdateTimelineRequest struct {
+	Name        *string                `json:"name"`
+	Description *string                `json:"description"`
+	FPS         *int                   `json:"fps"`
+	Resolution  *string                `json:"resolution"`
+	Status      *models.TimelineStatus `json:"status"`
+}
+
+type CreateTrackRequest struct {
+	Name   string           `json:"name" binding:"required"`
+	Type   models.TrackType `json:"type" binding:"required,oneof=video audio text"`
+	Order  *int             `json:"order"`
+	Volume *int             `json:"volume"`
+}
+
+type UpdateTrackRequest struct {
+	Name     *string `json:"name"`
+	Order    *int    `json:"order"`
+	IsLocked *bool   `json:"is_locked"`
+	IsMuted  *bool   `json:"is_muted"`
+	Volume   *int    `json:"volume"`
+}
+
+type CreateClipRequest struct {
+	AssetID      *uint    `json:"asset_id"`
+	StoryboardID *uint    `json:"storyboard_id"`
+	Name         string   `json:"name"`
+	Text         *string  `json:"text"`
+	StartTime    *int     `json:"start_time"` // 为空时追加到轨道末尾
+	Duration     int      `json:"duration" binding:"required,gt=0"`
+	TrimStart    *int     `json:"trim_start"`
+	TrimEnd      *int     `json:"trim_end"`
+	Speed        *float64 `json:"speed"`
+	Volume       *int     `json:"volume"`
+	IsMuted      bool     `json:"is_muted"`
+	FadeIn       *int     `json:"fade_in"`
+	FadeOut      *int     `json:"fade_out"`
+}
+
+type UpdateClipRequest struct {
+	Name      *string  `json:"name"`
+	Text      *string  `json:"text"`
+	Duration  *int     `json:"duration"`
+	TrimStart *int     `json:"trim_start"`
+	TrimEnd   *int     `json:"trim_end"`
+	Speed     *float64 `json:"speed"`
+	Volume    *int     `json:"volume"`
+	IsMuted   *bool    `json:"is_muted"`
+	FadeIn    *int     `json:"fade_in"`
+	FadeOut   *int     `json:"fade_out"`
+}
+
+type MoveClipRequest struct {
+	TrackID   *uint `json:"track_id"` // 目标轨道，为空时保持原轨道
+	StartTime int   `json:"start_time" binding:"min=0"`
+}
+
+type ReorderClipsRequest struct {
+	ClipIDs []uint `json:"clip_ids" binding:"required"`
+}
+
+type SetClipTransitionRequest struct {
+	Position string                 `json:"position" binding:"required,oneof=in out"`
+	Type     models.TransitionType  `json:"type" binding:"required"`
+	Duration int                    `json:"duration"`
+	Easing   *string                `json:"easing"`
+	Config   map[string]interface{} `json:"config"`
+}
+
+type ClipEffectRequest struct {
+	Type      models.EffectType      `json:"type" binding:"required"`
+	Name      string                 `json:"name"`
+	IsEnabled *bool                  `json:"is_enabled"`
+	Order     int                    `json:"order"`
+	Config    map[string]interface{} `json:"config"`
+}
+
+// CreateTimeline 创建空时间线，并初始化视频/音频/字幕三条默认轨道
+func (s *TimelineService) CreateTimeline(userID uint, req *CreateTimelineRequest) (*models.Timeline, error) {
+	var drama models.Drama
+	if err := s.db.Where("id = ? AND user_id = ?", req.DramaID, userID).First(&drama).Error; err != nil {
+		return nil, fmt.Errorf("drama not found")
+	}
+	if req.EpisodeID != nil {
+		var episode models.Episode
+		if err := s.db.Where("id = ? AND drama_id = ? AND user_id = ?", *req.EpisodeID, req.DramaID, userID).First(&episode).Error; err != nil {
+			return nil, ErrEpisodeNotFound
+		}
+	}
+
+	timeline := &models.Timeline{
+		UserID:      userID,
+		DramaID:     req.DramaID,
+		EpisodeID:   req.EpisodeID,
+		Name:        req.Name,
+		Description: req.Description,
+		FPS:         req.FPS,
+		Resolution:  req.Resolution,
+		Status:      models.TimelineStatusDraft,
+	}
+	if timeline.FPS <= 0 {
+		timeline.FPS = 30
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(timeline).Error; err != nil {
+			return fmt.Errorf("failed to create timeline: %w", err)
+		}
+		_, err := createDefaultTracks(tx, timeline.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetTimeline(userID, timeline.ID)
+}
+
+// CreateTimelineFromEpisode 按分镜顺序生成时间线，视频轨道上每个分镜对应一个片段，台词写入字幕轨道
+func (s *TimelineService) CreateTimelineFromEpisode(userID, episodeID uint, name string) (*models.Timeline, error) {
+	var episode models.Episode
+	if err := s.db.Preload("Drama").Where("id = ? AND user_id = ?", episodeID, userID).First(&episode).Error; err != nil {
+		return nil, ErrEpisodeNotFound
+	}
+
+	var storyboards []models.Storyboard
+	if err := s.db.Where("episode_id = ?", episodeID).Order("storyboard_number ASC").Find(&storyboards).Error; err != nil {
+		return nil, fmt.Errorf("failed to load storyboards: %w", err)
+	}
+	if len(storyboards) == 0 {
+		return nil, fmt.Errorf("no storyboards found for this episode")
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("%s - 第%d集", episode.Drama.Title, episode.EpisodeNum)
+	}
+
+	timeline := &models.Timeline{
+		UserID:    userID,
+		DramaID:   episode.DramaID,
+		EpisodeID: &episode.ID,
+		Name:      name,
+		FPS:       30,
+		Status:    models.TimelineStatusDraft,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(timeline).Error; err != nil {
+			return fmt.Errorf("failed to create timeline: %w", err)
+		}
+		tracks, err := createDefaultTracks(tx, timeline.ID)
+		if err != nil {
+			return err
+		}
+
+		videoTrack := tracks[models.TrackTypeVideo]
+		textTrack := tracks[models.TrackTypeText]
+		cursor := 0
+		for _, sb := range storyboards {
+			duration := sb.Duration * 1000
+			if duration <= 0 {
+				duration = 5000
+			}
+
+			clip := &models.TimelineClip{
+				TrackID:      videoTrack.ID,
+				StoryboardID: &sb.ID,
+				Name:         fmt.Sprintf("镜头 %d", sb.StoryboardNumber),
+				StartTime:    cursor,
+				EndTime:      cursor + duration,
+				Duration:     duration,
+			}
+			if sb.Title != nil && *sb.Title != "" {
+				clip.Name = *sb.Title
+			}
+
+			// 优先关联素材库中该分镜最新的视频
+			var asset models.Asset
+			if err := tx.Where("storyboard_id = ? AND type = ? AND user_id = ?", sb.ID, models.AssetTypeVideo, userID).
+				Order("created_at DESC").First(&asset).Error; err == nil {
+				clip.AssetID = &asset.ID
+			}
+
+			if err := tx.Omit(clause.Associations).Create(clip).Error; err != nil {
+				return fmt.Errorf("failed to create clip: %w", err)
+			}
+
+			// 台词按行拆分到字幕轨道
+			if sb.Dialogue != nil {
+				start := time.Duration(cursor) * time.Millisecond
+				end := time.Duration(cursor+duration) * time.Millisecond
+				for _, cue := range subtitle.SplitDialogue(*sb.Dialogue, start, end) {
+					text := cue.Text
+					textClip := &models.TimelineClip{
+						TrackID:      textTrack.ID,
+						StoryboardID: &sb.ID,
+						Text:         &text,
+						StartTime:    int(cue.Start.Milliseconds()),
+						EndTime:      int(cue.End.Milliseconds()),
+						Duration:     int((cue.End - cue.Start).Milliseconds()),
+					}
+					if err := tx.Omit(clause.Associations).Create(textClip).Error; err != nil {
+						return fmt.Errorf("failed to create subtitle clip: %w", err)
+					}
+				}
+			}
+			cursor += duration
+		}
+
+		return tx.Model(timeline).Update("duration", cursor).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Infow("Timeline created from episode", "timeline_id", timeline.ID, "episode_id", episodeID, "clips", len(storyboards))
+	return s.GetTimeline(userID, timeline.ID)
+}
+
+func createDefaultTracks(tx *gorm.DB, timelineID uint) (map[models.TrackType]*models.TimelineTrack, error) {
+	defaults := []struct {
+		name      string
+		trackType models.TrackType
+	}{
+		{"视频", models.TrackTypeVideo},
+		{"音频", models.TrackTypeAudio},
+		{"字幕", models.TrackTypeText},
+	}
+
+	tracks := make(map[models.TrackType]*models.TimelineTrack, len(defaults))
+	for i, d := range defaults {
+		volume := 100
+		track := &models.TimelineTrack{
+			TimelineID: timelineID,
+			Name:       d.name,
+			Type:       d.trackType,
+			Order:      i,
+			Volume:     &volume,
+		}
+		if err := tx.Omit(clause.Associations).Create(track).Error; err != nil {
+			return nil, fmt.Errorf("failed to create track: %w", err)
+		}
+		tracks[d.trackType] = track
+	}
+	return tracks, nil
+}
+
+// GetTimeline 获取时间线及其全部轨道、片段、转场与特效
+func (s *TimelineService) GetTimeline(userID, timelineID uint) (*models.Timeline, error) {
+	var timeline models.Timeline
+	err := s.db.Where("id = ? AND user_id = ?", timelineID, userID).
+		Preload("Tracks", func(db *gorm.DB) *gorm.DB {
+			return db.Order(clause.OrderByColumn{Column: clause.Column{Table: "timeline_tracks", Name: "order"}}).Order("timeline_tracks.id ASC")
+		}).
+		Preload("Tracks.Clips", func(db *gorm.DB) *gorm.DB {
+			return db.Order("start_time ASC, id ASC")
+		}).
+		Preload("Tracks.Clips.InTransition").
+		Preload("Tracks.Clips.OutTransition").
+		Preload("Tracks.Clips.Effects", func(db *gorm.DB) *gorm.DB {
+			return db.Order(clause.OrderByColumn{Column: clause.Column{Table: "clip_effects", Name: "order"}}).Order("clip_effects.id ASC")
+		}).
+		First(&timeline).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTimelineNotFound
+		}
+		return nil, err
+	}
+	return &timeline, nil
+}
+
+// ListTimelines 获取时间线列表（不含轨道详情）
+func (s *TimelineService) ListTimelines(userID uint, dramaID, episodeID *uint) ([]models.Timeline, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if dramaID != nil {
+		query = query.Where("drama_id = ?", *dramaID)
+	}
+	if episodeID != nil {
+		query = query.Where("episode_id = ?", *episodeID)
+	}
+
+	var timelines []models.Timeline
+	if err := query.Order("updated_at DESC").Find(&timelines).Error; err != nil {
+		return nil, err
+	}
+	return timelines, nil
+}
+
+func (s *TimelineService) UpdateTimeline(userID, timelineID uint, req *UpdateTimelineRequest) (*models.Timeline, error) {
+	timeline, err := s.loadTimeline(s.db, userID, timelineID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.FPS != nil && *req.FPS > 0 {
+		updates["fps"] = *req.FPS
+	}
+	if req.Resolution != nil {
+		updates["resolution"] = *req.Resolution
+	}
+	if req.Status != nil {
+		// exporting 由渲染任务维护，客户端只能在草稿、编辑中和已完成之间切换
+		switch *req.Status {
+		case models.TimelineStatusDraft, models.TimelineStatusEditing, models.TimelineStatusCompleted:
+			updates["status"] = *req.Status
+		default:
+			return nil, fmt.Errorf("invalid timeline status: %s", *req.Status)
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(timeline).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update timeline: %w", err)
+		}
+	}
+
+	return s.GetTimeline(userID, timelineID)
+}
+
+// DeleteTimeline 删除时间线及其下的轨道、片段和特效
+func (s *TimelineService) DeleteTimeline(userID, timelineID uint) error {
+	timeline, err := s.loadTimeline(s.db, userID, timelineID)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		trackIDs := tx.Model(&models.TimelineTrack{}).Select("id").Where("timeline_id = ?", timeline.ID)
+		clipIDs := tx.Model(&models.TimelineClip{}).Select("id").Where("track_id IN (?)", trackIDs)
+		if err := tx.Where("clip_id IN (?)", clipIDs).Delete(&models.ClipEffect{}).Error; err != nil {
+			return err
+		}
+		transitionIn := tx.Model(&models.TimelineClip{}).Select("transition_in").Where("track_id IN (?) AND transition_in IS NOT NULL", trackIDs)
+		transitionOut := tx.Model(&models.TimelineClip{}).Select("transition_out").Where("track_id IN (?) AND transition_out IS NOT NULL", trackIDs)
+		if err := tx.Where("id IN (?) OR id IN (?)", transitionIn, transitionOut).Delete(&models.ClipTransition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("track_id IN (?)", trackIDs).Delete(&models.TimelineClip{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("timeline_id = ?", timeline.ID).Delete(&models.TimelineTrack{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(timeline).Error
+	})
+}
+
+// AddTrack 添加轨道
+func (s *TimelineService) AddTrack(userID, timelineID uint, req *CreateTrackRequest) (*models.TimelineTrack, error) {
+	timeline, err := s.loadTimeline(s.db, userID, timelineID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := 0
+	if req.Order != nil {
+		order = *req.Order
+	} else {
+		var maxOrder *int
+		if err := s.db.Model(&models.TimelineTrack{}).Where("timeline_id = ?", timeline.ID).Select("MAX(?)", clause.Column{Name: "order"}).Scan(&maxOrder).Error; err != nil {
+			return nil, fmt.Errorf("failed to query track order: %w", err)
+		}
+		if maxOrder != nil {
+			order = *maxOrder + 1
+		}
+	}
+
+	volume := 100
+	if req.Volume != nil {
+		volume = *req.Volume
+	}
+
+	track := &models.TimelineTrack{
+		TimelineID: timeline.ID,
+		Name:       req.Name,
+		Type:       req.Type,
+		Order:      order,
+		Volume:     &volume,
+	}
+	if err := s.db.Omit(clause.Associations).Create(track).Error; err != nil {
+		return nil, fmt.Errorf("failed to create track: %w", err)
+	}
+	return track, nil
+}
+
+// UpdateTrack 更新轨道（名称、顺序、锁定、静音、音量）
+func (s *TimelineService) UpdateTrack(userID, trackID uint, req *UpdateTrackRequest) (*models.TimelineTrack, error) {
+	track, err := s.loadTrack(s.db, userID, trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Order != nil {
+		updates["order"] = *req.Order
+	}
+	if req.IsLocked != nil {
+		updates["is_locked"] = *req.IsLocked
+	}
+	if req.IsMuted != nil {
+		updates["is_muted"] = *req.IsMuted
+	}
+	if req.Volume != nil {
+		if *req.Volume < 0 {
+			return nil, fmt.Errorf("volume must be non-negative")
+		}
+		updates["volume"] = *req.Volume
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(track).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update track: %w", err)
+		}
+	}
+
+	if err := s.db.First(track, trackID).Error; err != nil {
+		return nil, err
+	}
+	return track, nil
+}
+
+// DeleteTrack 删除轨道及其片段
+func (s *TimelineService) DeleteTrack(userID, trackID uint) error {
+	track, err := s.loadTrack(s.db, userID, trackID)
+	if err != nil {
+		return err
+	}
+	if track.IsLocked {
+		return ErrTrackLocked
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		clipIDs := tx.Model(&models.TimelineClip{}).Select("id").Where("track_id = ?", track.ID)
+		if err := tx.Where("clip_id IN (?)", clipIDs).Delete(&models.ClipEffect{}).Error; err != nil {
+			return err
+		}
+		transitionIn := tx.Model(&models.TimelineClip{}).Select("transition_in").Where("track_id = ? AND transition_in IS NOT NULL", track.ID)
+		transitionOut := tx.Model(&models.TimelineClip{}).Select("transition_out").Where("track_id = ? AND transition_out IS NOT NULL", track.ID)
+		if err := tx.Where("id IN (?) OR id IN (?)", transitionIn, transitionOut).Delete(&models.ClipTransition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("track_id = ?", track.ID).Delete(&models.TimelineClip{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(track).Error; err != nil {
+			return err
+		}
+		return s.refreshDuration(tx, track.TimelineID)
+	})
+}
+
+// AddClip 向轨道添加片段
+func (s *TimelineService) AddClip(userID, trackID uint, req *CreateClipRequest) (*models.TimelineClip, error) {
+	track, err := s.loadTrack(s.db, userID, trackID)
+	if err != nil {
+		return nil, err
+	}
+	if track.IsLocked {
+		return nil, ErrTrackLocked
+	}
+
+	if req.AssetID != nil {
+		var asset models.Asset
+		if err := s.db.Where("id = ? AND user_id = ?", *req.AssetID, userID).First(&asset).Error; err != nil {
+			return nil, fmt.Errorf("asset not found")
+		}
+	}
+	if req.StoryboardID != nil {
+		var sb models.Storyboard
+		if err := s.db.Where("id = ? AND user_id = ?", *req.StoryboardID, userID).First(&sb).Error; err != nil {
+			return nil, ErrStoryboardNotFound
+		}
+	}
+
+	startTime := 0
+	if req.StartTime != nil {
+		startTime = *req.StartTime
+	} else {
+		var maxEnd *int
+		if err := s.db.Model(&models.TimelineClip{}).Where("track_id = ?", track.ID).Select("MAX(end_time)").Scan(&maxEnd).Error; err != nil {
+			return nil, fmt.Errorf("failed to query clip end: %w", err)
+		}
+		if maxEnd != nil {
+			startTime = *maxEnd
+		}
+	}
+
+	clip := &models.TimelineClip{
+		TrackID:      track.ID,
+		AssetID:      req.AssetID,
+		StoryboardID: req.StoryboardID,
+		Name:         req.Name,
+		Text:         req.Text,
+		StartTime:    startTime,
+		EndTime:      startTime + req.Duration,
+		Duration:     req.Duration,
+		TrimStart:    req.TrimStart,
+		TrimEnd:      req.TrimEnd,
+		Speed:        req.Speed,
+		Volume:       req.Volume,
+		IsMuted:      req.IsMuted,
+		FadeIn:       req.FadeIn,
+		FadeOut:      req.FadeOut,
+	}
+	if err := validateClipTiming(clip); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkClipOverlap(tx, clip); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(clip).Error; err != nil {
+			return fmt.Errorf("failed to create clip: %w", err)
+		}
+		return s.refreshDuration(tx, track.TimelineID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clip, nil
+}
+
+// UpdateClip 更新片段属性（裁剪、变速、音量、淡入淡出）
+func (s *TimelineService) UpdateClip(userID, clipID uint, req *UpdateClipRequest) (*models.TimelineClip, error) {
+	clip, track, err := s.loadClip(s.db, userID, clipID)
+	if err != nil {
+		return nil, err
+	}
+	if track.IsLocked {
+		return nil, ErrTrackLocked
+	}
+
+	if req.Name != nil {
+		clip.Name = *req.Name
+	}
+	if req.Text != nil {
+		clip.Text = req.Text
+	}
+	if req.Duration != nil {
+		clip.Duration = *req.Duration
+	}
+	if req.TrimStart != nil {
+		clip.TrimStart = req.TrimStart
+	}
+	if req.TrimEnd != nil {
+		clip.TrimEnd = req.TrimEnd
+	}
+	if req.Speed != nil {
+		clip.Speed = req.Speed
+	}
+	if req.Volume != nil {
+		clip.Volume = req.Volume
+	}
+	if req.IsMuted != nil {
+		clip.IsMuted = *req.IsMuted
+	}
+	if req.FadeIn != nil {
+		clip.FadeIn = req.FadeIn
+	}
+	if req.FadeOut != nil {
+		clip.FadeOut = req.FadeOut
+	}
+	clip.EndTime = clip.StartTime + clip.Duration
+	if err := validateClipTiming(clip); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkClipOverlap(tx, clip); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(clip).Error; err != nil {
+			return fmt.Errorf("failed to update clip: %w", err)
+		}
+		return s.refreshDuration(tx, track.TimelineID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clip, nil
+}
+
+// MoveClip 移动片段到新的起始时间，可跨同类型轨道移动
+func (s *TimelineService) MoveClip(userID, clipID uint, req *MoveClipRequest) (*models.TimelineClip, error) {
+	clip, track, err := s.loadClip(s.db, userID, clipID)
+	if err != nil {
+		return nil, err
+	}
+	if track.IsLocked {
+		return nil, ErrTrackLocked
+	}
+
+	if req.TrackID != nil && *req.TrackID != track.ID {
+		target, err := s.loadTrack(s.db, userID, *req.TrackID)
+		if err != nil {
+			return nil, err
+		}
+		if target.TimelineID != track.TimelineID {
+			return nil, fmt.Errorf("target track belongs to another timeline")
+		}
+		if target.Type != track.Type {
+			return nil, fmt.Errorf("cannot move %s clip to %s track", track.Type, target.Type)
+		}
+		if target.IsLocked {
+			return nil, ErrTrackLocked
+		}
+		clip.TrackID = target.ID
+	}
+
+	clip.StartTime = req.StartTime
+	clip.EndTime = clip.StartTime + clip.Duration
+	if err := validateClipTiming(clip); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkClipOverlap(tx, clip); err != nil {
+			return err
+		}
+		if err := tx.Model(clip).Updates(map[string]interface{}{
+			"track_id":   clip.TrackID,
+			"start_time": clip.StartTime,
+			"end_time":   clip.EndTime,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to move clip: %w", err)
+		}
+		return s.refreshDuration(tx, track.TimelineID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clip, nil
+}
+
+// ReorderClips 按给定顺序首尾相接地重新排列轨道上的片段
+func (s *TimelineService) ReorderClips(userID, trackID uint, req *ReorderClipsRequest) ([]models.TimelineClip, error) {
+	track, err := s.loadTrack(s.db, userID, trackID)
+	if err != nil {
+		return nil, err
+	}
+	if track.IsLocked {
+		return nil, ErrTrackLocked
+	}
+
+	var clips []models.TimelineClip
+	if err := s.db.Where("track_id = ?", track.ID).Find(&clips).Error; err != nil {
+		return nil, err
+	}
+	if len(clips) != len(req.ClipIDs) {
+		return nil, fmt.Errorf("clip_ids must contain every clip on the track")
+	}
+
+	clipMap := make(map[uint]*models.TimelineClip, len(clips))
+	for i := range clips {
+		clipMap[clips[i].ID] = &clips[i]
+	}
+
+	ordered := make([]models.TimelineClip, 0, len(req.ClipIDs))
+	cursor := 0
+	for _, id := range req.ClipIDs {
+		clip, ok := clipMap[id]
+		if !ok {
+			return nil, fmt.Errorf("clip %d does not belong to track", id)
+		}
+		delete(clipMap, id)
+		clip.StartTime = cursor
+		clip.EndTime = cursor + clip.Duration
+		cursor = clip.EndTime
+		ordered = append(ordered, *clip)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, clip := range ordered {
+			if err := tx.Model(&models.TimelineClip{}).Where("id = ?", clip.ID).Updates(map[string]interface{}{
+				"start_time": clip.StartTime,
+				"end_time":   clip.EndTime,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to reorder clips: %w", err)
+			}
+		}
+		return s.refreshDuration(tx, track.TimelineID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+// DeleteClip 删除片段
+func (s *TimelineService) DeleteClip(userID, clipID uint) error {
+	clip, track, err := s.loadClip(s.db, userID, clipID)
+	if err != nil {
+		return err
+	}
+	if track.IsLocked {
+		return ErrTrackLocked
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("clip_id = ?", clip.ID).Delete(&models.ClipEffect{}).Error; err != nil {
+			return err
+		}
+		var transitionIDs []uint
+		for _, id := range []*uint{clip.TransitionIn, clip.TransitionOut} {
+			if id != nil {
+				transitionIDs = append(transitionIDs, *id)
+			}
+		}
+		if len(transitionIDs) > 0 {
+			if err := tx.Delete(&models.ClipTransition{}, transitionIDs).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(clip).Error; err != nil {
+			return err
+		}
+		return s.refreshDuration(tx, track.TimelineID)
+	})
+}
+
+// SetClipTransition 设置片段的入场或出场转场
+func (s *TimelineService) SetClipTransition(userID, clipID uint, req *SetClipTransitionRequest) (*models.ClipTransition, error) {
+	clip, track, err := s.loadClip(s.db, userID, clipID)
+	if err != nil {
+		return nil, err
+	}
+	if track.IsLocked {
+		return nil, ErrTrackLocked
+	}
+
+	duration := req.Duration
+	if duration <= 0 {
+		duration = 500
+	}
+
+	existingID := clip.TransitionIn
+	column := "transition_in"
+	if req.Position == "out" {
+		existingID = clip.TransitionOut
+		column = "transition_out"
+	}
+
+	transition := &models.ClipTransition{}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if existingID != nil {
+			if err := tx.First(transition, *existingID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+		transition.Type = req.Type
+		transition.Duration = duration
+		transition.Easing = req.Easing
+		transition.Config = req.Config
+		if err := tx.Save(transition).Error; err != nil {
+			return fmt.Errorf("failed to save transition: %w", err)
+		}
+		return tx.Model(clip).Update(column, transition.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transition, nil
+}
+
+// AddClipEffect 为片段添加特效
+func (s *TimelineService) AddClipEffect(userID, clipID uint, req *ClipEffectRequest) (*models.ClipEffect, error) {
+	clip, track, err := s.loadClip(s.db, userID, clipID)
+	if err != nil {
+		return nil, err
+	}
+	if track.IsLocked {
+		return nil, ErrTrackLocked
+	}
+
+	effect := &models.ClipEffect{
+		ClipID:    clip.ID,
+		Type:      req.Type,
+		Name:      req.Name,
+		IsEnabled: true,
+		Order:     req.Order,
+		Config:    req.Config,
+	}
+	if req.IsEnabled != nil {
+		effect.IsEnabled = *req.IsEnabled
+	}
+	if err := s.db.Omit(clause.Associations).Create(effect).Error; err != nil {
+		return nil, fmt.Errorf("failed to create effect: %w", err)
+	}
+	// gorm 会跳过零值字段使用默认值，这里显式落库禁用状态
+	if !effect.IsEnabled {
+		if err := s.db.Model(effect).Update("is_enabled", false).Error; err != nil {
+			return nil, fmt.Errorf("failed to disable effect: %w", err)
+		}
+	}
+	return effect, nil
+}
+
+// DeleteClipEffect 删除片段特效
+func (s *TimelineService) DeleteClipEffect(userID, clipID, effectID uint) error {
+	clip, track, err := s.loadClip(s.db, userID, clipID)
+	if err != nil {
+		return err
+	}
+	if track.IsLocked {
+		return ErrTrackLocked
+	}
+
+	result := s.db.Where("id = ? AND clip_id = ?", effectID, clip.ID).Delete(&models.ClipEffect{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("effect not found")
+	}
+	return nil
+}
+
+func (s *TimelineService) loadTimeline(db *gorm.DB, userID, timelineID uint) (*models.Timeline, error) {
+	var timeline models.Timeline
+	if err := db.Where("id = ? AND user_id = ?", timelineID, userID).First(&timeline).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTimelineNotFound
+		}
+		return nil, err
+	}
+	return &timeline, nil
+}
+
+func (s *TimelineService) loadTrack(db *gorm.DB, userID, trackID uint) (*models.TimelineTrack, error) {
+	var track models.TimelineTrack
+	err := db.Joins("JOIN timelines ON timelines.id = timeline_tracks.timeline_id AND timelines.deleted_at IS NULL").
+		Where("timeline_tracks.id = ? AND timelines.user_id = ?", trackID, userID).
+		First(&track).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTrackNotFound
+		}
+		return nil, err
+	}
+	return &track, nil
+}
+
+func (s *TimelineService) loadClip(db *gorm.DB, userID, clipID uint) (*models.TimelineClip, *models.TimelineTrack, error) {
+	var clip models.TimelineClip
+	if err := db.Where("id = ?", clipID).First(&clip).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrClipNotFound
+		}
+		return nil, nil, err
+	}
+	track, err := s.loadTrack(db, userID, clip.TrackID)
+	if err != nil {
+		if errors.Is(err, ErrTrackNotFound) {
+			return nil, nil, ErrClipNotFound
+		}
+		return nil, nil, err
+	}
+	return &clip, track, nil
+}
+
+// refreshDuration 以所有轨道中最晚的片段结束时间作为时间线总时长
+func (s *TimelineService) refreshDuration(tx *gorm.DB, timelineID uint) error {
+	var maxEnd *int
+	err := tx.Model(&models.TimelineClip{}).
+		Joins("JOIN timeline_tracks ON timeline_tracks.id = timeline_clips.track_id AND timeline_tracks.deleted_at IS NULL").
+		Where("timeline_tracks.timeline_id = ?", timelineID).
+		Select("MAX(timeline_clips.end_time)").
+		Scan(&maxEnd).Error
+	if err != nil {
+		return err
+	}
+
+	duration := 0
+	if maxEnd != nil {
+		duration = *maxEnd
+	}
+	return tx.Model(&models.Timeline{}).Where("id = ?", timelineID).Updates(map[string]interface{}{
+		"duration": duration,
+		"status":   gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", models.TimelineStatusDraft, models.TimelineStatusEditing),
+	}).Error
+}
+
+// checkClipOverlap 片段在所在轨道上不能与其它片段重叠
+func checkClipOverlap(tx *gorm.DB, clip *models.TimelineClip) error {
+	var count int64
+	err := tx.Model(&models.TimelineClip{}).
+		Where("track_id = ? AND id <> ? AND start_time < ? AND end_time > ?", clip.TrackID, clip.ID, clip.EndTime, clip.StartTime).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrClipOverlap
+	}
+	return nil
+}
+
+func validateClipTiming(clip *models.TimelineClip) error {
+	if clip.StartTime < 0 {
+		return fmt.Errorf("start_time must be non-negative")
+	}
+	if clip.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if clip.TrimStart != nil && *clip.TrimStart < 0 {
+		return fmt.Errorf("trim_start must be non-negative")
+	}
+	if clip.TrimEnd != nil && *clip.TrimEnd < 0 {
+		return fmt.Errorf("trim_end must be non-negative")
+	}
+	if clip.Speed != nil && *clip.Speed <= 0 {
+		return fmt.Errorf("speed must be positive")
+	}
+	if clip.Volume != nil && *clip.Volume < 0 {
+		return fmt.Errorf("volume must be non-negative")
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	_ "modernc.org/sqlite"
+)
+
+func newTimelineServiceTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Dialector{
+		DriverName: "sqlite",
+		DSN:        fmt.Sprintf("file:timeline_service_%d?mode=memory&cache=shared", time.Now().UnixNano()),
+	}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+
+	if err := db.AutoMigrate(
+		&models.Drama{},
+		&models.Episode{},
+		&models.Storyboard{},
+		&models.Asset{},
+		&models.Timeline{},
+		&models.TimelineTrack{},
+		&models.TimelineClip{},
+		&models.ClipTransition{},
+		&models.ClipEffect{},
+	); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+
+	return db
+}
+
+func seedTimelineEpisode(t *testing.T, db *gorm.DB, userID uint) models.Episode {
+	t.Helper()
+
+	drama := models.Drama{UserID: userID, Title: "测试短剧"}
+	if err := db.Create(&drama).Error; err != nil {
+		t.Fatalf("failed to seed drama: %v", err)
+	}
+	episode := models.Episode{UserID: userID, DramaID: drama.ID, EpisodeNum: 1, Title: "第一集"}
+	if err := db.Create(&episode).Error; err != nil {
+		t.Fatalf("failed to seed episode: %v", err)
+	}
+	for i, duration := range []int{3, 5, 4} {
+		sb := models.Storyboard{UserID: userID, EpisodeID: episode.ID, StoryboardNumber: i + 1, Duration: duration}
+		if err := db.Create(&sb).Error; err != nil {
+			t.Fatalf("failed to seed storyboard: %v", err)
+		}
+	}
+	return episode
+}
+
+func TestTimelineService_CreateFromEpisodeBuildsVideoTrack(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if timeline.Duration != 12000 {
+		t.Fatalf("expected duration 12000ms, got %d", timeline.Duration)
+	}
+	if len(timeline.Tracks) != 3 {
+		t.Fatalf("expected 3 default tracks, got %d", len(timeline.Tracks))
+	}
+
+	video := timeline.Tracks[0]
+	if video.Type != models.TrackTypeVideo || len(video.Clips) != 3 {
+		t.Fatalf("expected video track with 3 clips, got %s with %d", video.Type, len(video.Clips))
+	}
+	if video.Clips[1].StartTime != 3000 || video.Clips[1].EndTime != 8000 {
+		t.Fatalf("expected second clip at 3000-8000, got %d-%d", video.Clips[1].StartTime, video.Clips[1].EndTime)
+	}
+
+	if _, err := svc.CreateTimelineFromEpisode(2, episode.ID, ""); !errors.Is(err, ErrEpisodeNotFound) {
+		t.Fatalf("expected episode not found for other user, got %v", err)
+	}
+}
+
+func TestTimelineService_ReorderAndTrimClips(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "剪辑")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	video := timeline.Tracks[0]
+	first, second, third := video.Clips[0], video.Clips[1], video.Clips[2]
+
+	reordered, err := svc.ReorderClips(1, video.ID, &ReorderClipsRequest{ClipIDs: []uint{third.ID, first.ID, second.ID}})
+	if err != nil {
+		t.Fatalf("failed to reorder clips: %v", err)
+	}
+	if reordered[0].ID != third.ID || reordered[0].StartTime != 0 || reordered[1].StartTime != 4000 {
+		t.Fatalf("unexpected reorder result: %+v", reordered)
+	}
+
+	trimStart := 1000
+	duration := 2000
+	clip, err := svc.UpdateClip(1, second.ID, &UpdateClipRequest{TrimStart: &trimStart, Duration: &duration})
+	if err != nil {
+		t.Fatalf("failed to trim clip: %v", err)
+	}
+	if clip.EndTime != clip.StartTime+2000 || clip.TrimStart == nil || *clip.TrimStart != 1000 {
+		t.Fatalf("unexpected trimmed clip: %+v", clip)
+	}
+
+	reloaded, err := svc.GetTimeline(1, timeline.ID)
+	if err != nil {
+		t.Fatalf("failed to reload timeline: %v", err)
+	}
+	if reloaded.Duration != 9000 {
+		t.Fatalf("expected duration 9000ms after trim, got %d", reloaded.Duration)
+	}
+	if reloaded.Status != models.TimelineStatusEditing {
+		t.Fatalf("expected status editing, got %s", reloaded.Status)
+	}
+}
+
+func TestTimelineService_LockedTrackRejectsEdits(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	video := timeline.Tracks[0]
+
+	locked, muted := true, true
+	track, err := svc.UpdateTrack(1, video.ID, &UpdateTrackRequest{IsLocked: &locked, IsMuted: &muted})
+	if err != nil {
+		t.Fatalf("failed to lock track: %v", err)
+	}
+	if !track.IsLocked || !track.IsMuted {
+		t.Fatalf("expected track locked and muted, got %+v", track)
+	}
+
+	if err := svc.DeleteClip(1, video.Clips[0].ID); !errors.Is(err, ErrTrackLocked) {
+		t.Fatalf("expected ErrTrackLocked, got %v", err)
+	}
+	if _, err := svc.AddClip(1, video.ID, &CreateClipRequest{Duration: 1000}); !errors.Is(err, ErrTrackLocked) {
+		t.Fatalf("expected ErrTrackLocked, got %v", err)
+	}
+	if _, err := svc.UpdateTrack(2, video.ID, &UpdateTrackRequest{IsLocked: &locked}); !errors.Is(err, ErrTrackNotFound) {
+		t.Fatalf("expected ErrTrackNotFound for other user, got %v", err)
+	}
+}
+
+func TestTimelineService_MoveClipRequiresMatchingTrackType(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	video, audio := timeline.Tracks[0], timeline.Tracks[1]
+
+	if _, err := svc.MoveClip(1, video.Clips[0].ID, &MoveClipRequest{TrackID: &audio.ID, StartTime: 0}); err == nil {
+		t.Fatalf("expected error moving video clip to audio track")
+	}
+
+	overlay, err := svc.AddTrack(1, timeline.ID, &CreateTrackRequest{Name: "画中画", Type: models.TrackTypeVideo})
+	if err != nil {
+		t.Fatalf("failed to add track: %v", err)
+	}
+	if overlay.Order != 3 {
+		t.Fatalf("expected new track order 3, got %d", overlay.Order)
+	}
+
+	if _, err := svc.MoveClip(1, video.Clips[0].ID, &MoveClipRequest{StartTime: -1000}); err == nil {
+		t.Fatalf("expected negative start time to be rejected")
+	}
+	if _, err := svc.MoveClip(1, video.Clips[0].ID, &MoveClipRequest{StartTime: 4000}); !errors.Is(err, ErrClipOverlap) {
+		t.Fatalf("expected ErrClipOverlap, got %v", err)
+	}
+
+	moved, err := svc.MoveClip(1, video.Clips[0].ID, &MoveClipRequest{TrackID: &overlay.ID, StartTime: 20000})
+	if err != nil {
+		t.Fatalf("failed to move clip: %v", err)
+	}
+	if moved.TrackID != overlay.ID || moved.EndTime != 23000 {
+		t.Fatalf("unexpected moved clip: %+v", moved)
+	}
+
+	reloaded, err := svc.GetTimeline(1, timeline.ID)
+	if err != nil {
+		t.Fatalf("failed to reload timeline: %v", err)
+	}
+	if reloaded.Duration != 23000 {
+		t.Fatalf("expected duration 23000ms, got %d", reloaded.Duration)
+	}
+}
+
+func TestTimelineService_DeleteTimelineRemovesTransitions(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	clipID := timeline.Tracks[0].Clips[0].ID
+	for _, position := range []string{"in", "out"} {
+		if _, err := svc.SetClipTransition(1, clipID, &SetClipTransitionRequest{Position: position, Type: models.TransitionTypeFade}); err != nil {
+			t.Fatalf("failed to set transition: %v", err)
+		}
+	}
+
+	if err := svc.DeleteTimeline(1, timeline.ID); err != nil {
+		t.Fatalf("failed to delete timeline: %v", err)
+	}
+	var count int64
+	db.Model(&models.ClipTransition{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected transitions deleted, %d left", count)
+	}
+}
+
+func TestTimelineService_DeleteClipAndTrackRemoveTransitions(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	clips := timeline.Tracks[0].Clips
+	for _, clip := range clips[:2] {
+		for _, position := range []string{"in", "out"} {
+			if _, err := svc.SetClipTransition(1, clip.ID, &SetClipTransitionRequest{Position: position, Type: models.TransitionTypeFade}); err != nil {
+				t.Fatalf("failed to set transition: %v", err)
+			}
+		}
+	}
+
+	if err := svc.DeleteClip(1, clips[0].ID); err != nil {
+		t.Fatalf("failed to delete clip: %v", err)
+	}
+	var count int64
+	db.Model(&models.ClipTransition{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected the deleted clip's transitions removed, %d left", count)
+	}
+
+	if err := svc.DeleteTrack(1, timeline.Tracks[0].ID); err != nil {
+		t.Fatalf("failed to delete track: %v", err)
+	}
+	db.Model(&models.ClipTransition{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected the track's transitions removed, %d left", count)
+	}
+}
+
+func TestTimelineService_AddAndUpdateClipRejectOverlap(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	video := timeline.Tracks[0]
+
+	start := 2000
+	if _, err := svc.AddClip(1, video.ID, &CreateClipRequest{StartTime: &start, Duration: 1000}); !errors.Is(err, ErrClipOverlap) {
+		t.Fatalf("expected ErrClipOverlap adding a clip, got %v", err)
+	}
+	appended, err := svc.AddClip(1, video.ID, &CreateClipRequest{Duration: 1000})
+	if err != nil {
+		t.Fatalf("failed to append clip: %v", err)
+	}
+	if appended.StartTime != 12000 {
+		t.Fatalf("expected clip appended after the last one, got %d", appended.StartTime)
+	}
+
+	duration := 4000
+	if _, err := svc.UpdateClip(1, video.Clips[0].ID, &UpdateClipRequest{Duration: &duration}); !errors.Is(err, ErrClipOverlap) {
+		t.Fatalf("expected ErrClipOverlap extending a clip, got %v", err)
+	}
+	duration = 3000
+	if _, err := svc.UpdateClip(1, video.Clips[0].ID, &UpdateClipRequest{Duration: &duration}); err != nil {
+		t.Fatalf("expected updating a clip in place to pass, got %v", err)
+	}
+}
+
+func TestTimelineService_UpdateTimelineRejectsUnknownStatus(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	svc := NewTimelineService(db, logger.NewLogger(true))
+	episode := seedTimelineEpisode(t, db, 1)
+
+	timeline, err := svc.CreateTimelineFromEpisode(1, episode.ID, "")
+	if err != nil {
+		t.Fatalf("failed to create timeline: %v", err)
+	}
+	for _, status := range []models.TimelineStatus{models.TimelineStatusExporting, "published"} {
+		if _, err := svc.UpdateTimeline(1, timeline.ID, &UpdateTimelineRequest{Status: &status}); err == nil {
+			t.Fatalf("expected status %q to be rejected", status)
+		}
+	}
+
+	completed := models.TimelineStatusCompleted
+	updated, err := svc.UpdateTimeline(1, timeline.ID, &UpdateTimelineRequest{Status: &completed})
+	if err != nil || updated.Status != models.TimelineStatusCompleted {
+		t.Fatalf("expected completed status, got %+v (%v)", updated, err)
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -25,29 +26,37 @@ type VideoGenerationService struct {
 	localStorage    *storage.LocalStorage
 	aiService       *AIService
 	billingService  *BillingService
+	taskService     *TaskService
 	ffmpeg          *ffmpeg.FFmpeg
 	promptI18n      *PromptI18n
 	runner          *TaskRunner
 	dispatcher      JobDispatcher
+	references      *StoryboardReferenceResolver
+	postProcessor   *ImagePostProcessor
 }
 
 const (
 	videoPollMaxAttempts = 300
 	videoPollInterval    = 10 * time.Second
+	// videoCancelTimeout 取消服务端任务时任务自身的 context 已结束，单独限定请求时长
+	videoCancelTimeout = 30 * time.Second
 )
 
-func NewVideoGenerationService(db *gorm.DB, cfg *config.Config, transferService *ResourceTransferService, localStorage *storage.LocalStorage, aiService *AIService, dispatcher JobDispatcher, log *logger.Logger, promptI18n *PromptI18n) *VideoGenerationService {
+func NewVideoGenerationService(db *gorm.DB, cfg *config.Config, transferService *ResourceTransferService, localStorage *storage.LocalStorage, aiService *AIService, taskService *TaskService, dispatcher JobDispatcher, log *logger.Logger, promptI18n *PromptI18n) *VideoGenerationService {
 	service := &VideoGenerationService{
 		db:              db,
 		localStorage:    localStorage,
 		transferService: transferService,
 		aiService:       aiService,
-		billingService:  NewBillingService(db, cfg, log),
+		billingService:  NewBillingService(db, cfg, taskService.webhooks, log),
+		taskService:     taskService,
 		log:             log,
 		ffmpeg:          ffmpeg.NewFFmpeg(log),
 		promptI18n:      promptI18n,
 		runner:          NewTaskRunner(log, 6),
 		dispatcher:      dispatcher,
+		references:      NewStoryboardReferenceResolver(db, cfg, log),
+		postProcessor:   NewImagePostProcessor(db, cfg, localStorage, log),
 	}
 
 	service.runner.Submit("video.recover_pending_tasks", func() {
@@ -216,13 +225,74 @@ func (s *VideoGenerationService) GenerateVideo(userID uint, request *GenerateVid
 	if err := s.dispatchVideoGeneration(videoGen.ID); err != nil {
 		s.log.Warnw("Failed to dispatch video generation through task bus, fallback to local runner", "error", err, "id", videoGen.ID)
 		s.runner.Submit("video.process_generation", func() {
-			s.ProcessVideoGeneration(videoGen.ID)
+			s.ProcessVideoGeneration(context.Background(), videoGen.ID)
 		})
 	}
 
 	return videoGen, nil
 }
 
+// applyStoryboardReferences 分镜视频自动附带出场角色、道具和场景的参考图：多图模式补足参考图，
+// 未提供任何图片时切换为多图模式；首帧、首尾帧模式只复用角色 seed
+func (s *VideoGenerationService) applyStoryboardReferences(videoGen *models.VideoGeneration, client video.VideoClient) {
+	if videoGen.StoryboardID == nil || !s.references.Enabled() {
+		return
+	}
+	capable, ok := client.(video.ReferenceCapable)
+	if !ok {
+		return
+	}
+	caps := capable.ReferenceCapabilities()
+	if caps.MaxReferenceImages == 0 && !caps.Seed {
+		return
+	}
+
+	limit := s.references.Limit(caps.MaxReferenceImages)
+	set, err := s.references.Resolve(videoGen.UserID, *videoGen.StoryboardID, limit)
+	if err != nil {
+		s.log.Warnw("Failed to resolve storyboard references", "error", err, "id", videoGen.ID, "storyboard_id", *videoGen.StoryboardID)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	noImages := videoGen.ReferenceMode == nil && videoGen.ImageURL == nil && videoGen.FirstFrameURL == nil && videoGen.LastFrameURL == nil
+	multiple := videoGen.ReferenceMode != nil && *videoGen.ReferenceMode == "multiple"
+	if caps.MaxReferenceImages > 0 && len(set.References) > 0 && (noImages || multiple) {
+		var explicit []string
+		if videoGen.ReferenceImageURLs != nil {
+			_ = json.Unmarshal([]byte(*videoGen.ReferenceImageURLs), &explicit)
+		}
+		merged := mergeReferenceImages(explicit, set.Images(), limit)
+		if len(merged) > len(explicit) {
+			referenceImagesJSON, err := json.Marshal(merged)
+			if err == nil {
+				referenceImagesStr := string(referenceImagesJSON)
+				mode := "multiple"
+				videoGen.ReferenceImageURLs = &referenceImagesStr
+				videoGen.ReferenceMode = &mode
+				updates["reference_image_urls"] = referenceImagesStr
+				updates["reference_mode"] = mode
+			}
+		}
+	}
+	if caps.Seed && videoGen.Seed == nil && set.Seed != nil {
+		videoGen.Seed = set.Seed
+		updates["seed"] = *set.Seed
+	}
+	if len(updates) == 0 {
+		return
+	}
+	if err := s.db.Model(&models.VideoGeneration{}).Where("id = ?", videoGen.ID).Updates(updates).Error; err != nil {
+		s.log.Warnw("Failed to save storyboard references", "error", err, "id", videoGen.ID)
+	}
+	s.log.Infow("Applied storyboard references",
+		"id", videoGen.ID,
+		"storyboard_id", *videoGen.StoryboardID,
+		"auto_references", len(set.References),
+		"reference_mode", videoGen.ReferenceMode,
+		"seed", videoGen.Seed)
+}
+
 func (s *VideoGenerationService) dispatchVideoGeneration(videoGenID uint) error {
 	if s.dispatcher == nil {
 		return fmt.Errorf("task dispatcher not configured")
@@ -255,11 +325,35 @@ func (s *VideoGenerationService) dispatchVideoPollStatus(payload VideoPollStatus
 	}, delay)
 }
 
-func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
+func (s *VideoGenerationService) ProcessVideoGeneration(ctx context.Context, videoGenID uint) error {
+	ctx, release := s.taskService.trackRunning(ctx, videoGenerationTaskKey(videoGenID))
+	defer release()
+
 	var videoGen models.VideoGeneration
 	if err := s.db.First(&videoGen, videoGenID).Error; err != nil {
 		s.log.Errorw("Failed to load video generation", "error", err, "id", videoGenID)
-		return
+		return nil
+	}
+	switch videoGen.Status {
+	case models.VideoStatusCompleted, models.VideoStatusCancelled:
+		s.log.Infow("Video generation already finished, skipping", "id", videoGenID, "status", videoGen.Status)
+		return nil
+	case models.VideoStatusFailed:
+		// 死信重放：失败时已退回预扣积分，重新预扣后再执行
+		// 预扣失败时记录原因并返回错误，任务重新进入死信队列
+		if videoGen.BillingRefID != nil {
+			refID, err := s.billingService.ReserveAIAgain(*videoGen.BillingRefID)
+			if err != nil {
+				s.log.Warnw("Failed to re-reserve credits for replayed video generation", "error", err, "id", videoGenID)
+				s.db.Model(&videoGen).Update("error_msg", fmt.Sprintf("重放失败，重新预扣积分失败: %v", err))
+				return fmt.Errorf("re-reserve credits for replayed video generation: %w", err)
+			}
+			videoGen.BillingRefID = &refID
+		}
+		s.db.Model(&videoGen).Updates(map[string]interface{}{
+			"billing_ref_id": videoGen.BillingRefID,
+			"error_msg":      nil,
+		})
 	}
 
 	// 获取drama的style信息
@@ -268,15 +362,21 @@ func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
 		s.log.Warnw("Failed to load drama for style", "error", err, "drama_id", videoGen.DramaID)
 	}
 
-	s.db.Model(&videoGen).Update("status", models.VideoStatusProcessing)
+	// 排队期间已被取消的任务直接跳过
+	if updated := s.db.Model(&videoGen).Where("status <> ?", models.VideoStatusCancelled).Update("status", models.VideoStatusProcessing); updated.Error == nil && updated.RowsAffected == 0 {
+		s.log.Infow("Video generation cancelled before start", "id", videoGenID)
+		return nil
+	}
 
 	client, err := s.getVideoClient(videoGen.UserID, videoGen.Provider, videoGen.Model)
 	if err != nil {
 		s.log.Errorw("Failed to get video client", "error", err, "provider", videoGen.Provider, "model", videoGen.Model)
 		s.updateVideoGenError(videoGenID, err.Error())
-		return
+		return nil
 	}
 
+	s.applyStoryboardReferences(&videoGen, client)
+
 	s.log.Infow("Starting video generation", "id", videoGenID, "prompt", videoGen.Prompt, "provider", videoGen.Provider)
 
 	var opts []video.VideoOption
@@ -387,7 +487,7 @@ func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
 		}
 	}
 
-	constraintPrompt := s.promptI18n.GetVideoConstraintPrompt(referenceMode)
+	constraintPrompt := s.promptI18n.ForDrama(videoGen.UserID, videoGen.DramaID).GetVideoConstraintPrompt(referenceMode)
 	if constraintPrompt != "" {
 		prompt = constraintPrompt + "\n\n" + prompt
 		s.log.Infow("Added constraint prompt to video generation",
@@ -403,15 +503,32 @@ func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
 		"constraint_prompt", constraintPrompt,
 		"final_prompt", prompt)
 
-	result, err := client.GenerateVideo(imageURL, prompt, opts...)
+	result, err := client.GenerateVideoContext(ctx, imageURL, prompt, opts...)
+	if s.isVideoGenerationCancelled(ctx, videoGenID) {
+		s.log.Infow("Video generation cancelled, discarding provider result", "id", videoGenID)
+		if err == nil && result.TaskID != "" {
+			s.cancelProviderTask(client, videoGenID, result.TaskID)
+		}
+		return nil
+	}
 	if err != nil {
 		s.log.Errorw("Video generation API call failed", "error", err, "id", videoGenID)
+		if willRetryJob(ctx, err) {
+			// 临时性错误交给任务总线退避重试，保留预扣积分
+			s.db.Model(&models.VideoGeneration{}).Where("id = ? AND status = ?", videoGenID, models.VideoStatusProcessing).Update("status", models.VideoStatusPending)
+			return err
+		}
 		s.updateVideoGenError(videoGenID, err.Error())
-		return
+		if IsRetryableJobError(err) {
+			// 重试耗尽，返回错误使任务进入死信队列
+			return err
+		}
+		return nil
 	}
 
 	recordedUsage := usage.TokenUsage{}
 	if videoGen.BillingRefID != nil {
+		settleServedConfig(s.billingService, *videoGen.BillingRefID, client)
 		initialUsage := client.GetLastUsage()
 		if hasTokenUsage(initialUsage) {
 			if err := s.billingService.RecordAIUsage(*videoGen.BillingRefID, initialUsage); err != nil {
@@ -425,10 +542,16 @@ func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
 	// CRITICAL FIX: Validate TaskID before starting polling goroutine
 	// Empty TaskID would cause polling to fail silently or cause issues
 	if result.TaskID != "" {
-		s.db.Model(&videoGen).Updates(map[string]interface{}{
+		updates := map[string]interface{}{
 			"task_id": result.TaskID,
 			"status":  models.VideoStatusProcessing,
-		})
+		}
+		if routed, ok := client.(servedConfigReporter); ok {
+			if served := routed.ServedConfig(); served != nil {
+				updates["ai_config_id"] = served.ID
+			}
+		}
+		s.db.Model(&videoGen).Where("status <> ?", models.VideoStatusCancelled).Updates(updates)
 		payload := VideoPollStatusJobPayload{
 			VideoGenerationID: videoGenID,
 			TaskID:            result.TaskID,
@@ -438,21 +561,22 @@ func (s *VideoGenerationService) ProcessVideoGeneration(videoGenID uint) {
 		if err := s.dispatchVideoPollStatus(payload, videoPollInterval); err != nil {
 			s.log.Warnw("Failed to dispatch delayed video poll through task bus, fallback to local runner", "error", err, "id", videoGenID, "task_id", result.TaskID)
 			s.runner.Submit("video.poll_task_status", func() {
-				s.pollTaskStatus(videoGenID, result.TaskID, videoGen.Provider, videoGen.Model, recordedUsage)
+				s.pollTaskStatus(videoGenID, result.TaskID, recordedUsage)
 			})
 		}
-		return
+		return nil
 	}
 
 	if result.VideoURL != "" {
 		s.completeVideoGeneration(videoGenID, result.VideoURL, &result.Duration, &result.Width, &result.Height, nil)
-		return
+		return nil
 	}
 
 	s.updateVideoGenError(videoGenID, "no task ID or video URL returned")
+	return nil
 }
 
-func (s *VideoGenerationService) pollTaskStatus(videoGenID uint, taskID string, provider string, model string, recordedUsage usage.TokenUsage) {
+func (s *VideoGenerationService) pollTaskStatus(videoGenID uint, taskID string, recordedUsage usage.TokenUsage) {
 	// CRITICAL FIX: Validate taskID parameter to prevent invalid API calls
 	// Empty taskID would cause unnecessary API calls and potential errors
 	if taskID == "" {
@@ -467,17 +591,23 @@ func (s *VideoGenerationService) pollTaskStatus(videoGenID uint, taskID string,
 		return
 	}
 
-	client, err := s.getVideoClient(initial.UserID, provider, model)
+	client, err := s.videoClientForGeneration(&initial)
 	if err != nil {
 		s.log.Errorw("Failed to get video client for polling", "error", err)
 		s.updateVideoGenError(videoGenID, "failed to get video client")
 		return
 	}
 
+	ctx, release := s.taskService.trackRunning(context.Background(), videoGenerationTaskKey(videoGenID))
+	defer release()
+
 	for attempt := 0; attempt < videoPollMaxAttempts; attempt++ {
 		// Sleep before each poll attempt to avoid overwhelming the API
 		// First iteration sleeps before the first check (after 0 attempts)
-		time.Sleep(videoPollInterval)
+		if !sleepContext(ctx, videoPollInterval) {
+			s.log.Infow("Video generation cancelled, stopping poll", "id", videoGenID, "task_id", taskID)
+			return
+		}
 
 		var videoGen models.VideoGeneration
 		if err := s.db.First(&videoGen, videoGenID).Error; err != nil {
@@ -496,7 +626,7 @@ func (s *VideoGenerationService) pollTaskStatus(videoGenID uint, taskID string,
 		// Poll the video generation API for task status
 		// Continue polling on transient errors (network issues, temporary API failures)
 		// Only stop on permanent errors or task completion
-		result, err := client.GetTaskStatus(taskID)
+		result, err := client.GetTaskStatusContext(ctx, taskID)
 		if err != nil {
 			s.log.Errorw("Failed to get task status", "error", err, "task_id", taskID, "attempt", attempt+1)
 			// Continue polling on error - might be transient network issue
@@ -546,7 +676,7 @@ func (s *VideoGenerationService) pollTaskStatus(videoGenID uint, taskID string,
 	s.updateVideoGenError(videoGenID, fmt.Sprintf("polling timeout after %d attempts (%.1f minutes)", videoPollMaxAttempts, float64(videoPollMaxAttempts*int(videoPollInterval))/60.0))
 }
 
-func (s *VideoGenerationService) ProcessVideoPollStatus(payload VideoPollStatusJobPayload) {
+func (s *VideoGenerationService) ProcessVideoPollStatus(ctx context.Context, payload VideoPollStatusJobPayload) {
 	if payload.TaskID == "" {
 		s.log.Errorw("Invalid empty taskID for delayed polling", "video_gen_id", payload.VideoGenerationID)
 		s.updateVideoGenError(payload.VideoGenerationID, "invalid task ID for polling")
@@ -559,7 +689,8 @@ func (s *VideoGenerationService) ProcessVideoPollStatus(payload VideoPollStatusJ
 		return
 	}
 
-	if videoGen.Status != models.VideoStatusProcessing {
+	// 已取消或已结束的任务不再续投延迟轮询，轮询链在此终止
+	if videoGen.Status != models.VideoStatusProcessing || ctx.Err() != nil {
 		s.log.Infow("Video generation status changed, skipping delayed poll", "id", payload.VideoGenerationID, "status", videoGen.Status)
 		return
 	}
@@ -569,14 +700,14 @@ func (s *VideoGenerationService) ProcessVideoPollStatus(payload VideoPollStatusJ
 		return
 	}
 
-	client, err := s.getVideoClient(videoGen.UserID, videoGen.Provider, videoGen.Model)
+	client, err := s.videoClientForGeneration(&videoGen)
 	if err != nil {
 		s.log.Errorw("Failed to get video client for delayed polling", "error", err, "id", payload.VideoGenerationID)
 		s.updateVideoGenError(payload.VideoGenerationID, "failed to get video client")
 		return
 	}
 
-	result, err := client.GetTaskStatus(payload.TaskID)
+	result, err := client.GetTaskStatusContext(ctx, payload.TaskID)
 	if err != nil {
 		s.log.Errorw("Failed to get task status", "error", err, "task_id", payload.TaskID, "attempt", payload.Attempt+1)
 		s.requeueVideoPoll(payload)
@@ -624,12 +755,7 @@ func (s *VideoGenerationService) requeueVideoPoll(payload VideoPollStatusJobPayl
 	if err := s.dispatchVideoPollStatus(nextPayload, videoPollInterval); err != nil {
 		s.log.Warnw("Failed to dispatch delayed video poll through task bus, fallback to local runner", "error", err, "id", payload.VideoGenerationID, "task_id", payload.TaskID)
 		s.runner.Submit("video.poll_task_status", func() {
-			var current models.VideoGeneration
-			if dbErr := s.db.First(&current, payload.VideoGenerationID).Error; dbErr != nil {
-				s.log.Errorw("Failed to load video generation for local poll fallback", "error", dbErr, "id", payload.VideoGenerationID)
-				return
-			}
-			s.pollTaskStatus(payload.VideoGenerationID, payload.TaskID, current.Provider, current.Model, payload.RecordedUsage)
+			s.pollTaskStatus(payload.VideoGenerationID, payload.TaskID, payload.RecordedUsage)
 		})
 	}
 }
@@ -689,16 +815,18 @@ func (s *VideoGenerationService) completeVideoGeneration(videoGenID uint, videoU
 		}
 	}
 
-	// 下载首帧图片到本地存储（仅用于缓存，不更新数据库）
+	// 下载首帧图片到本地存储（不更新首帧地址），用于生成缩略图
+	var firstFramePath *string
 	if firstFrameURL != nil && *firstFrameURL != "" && s.localStorage != nil {
-		_, err := s.localStorage.DownloadFromURL(*firstFrameURL, "video_frames")
+		downloadResult, err := s.localStorage.DownloadFromURLWithPath(*firstFrameURL, "video_frames")
 		if err != nil {
 			s.log.Warnw("Failed to download first frame to local storage",
 				"error", err,
 				"id", videoGenID,
 				"original_url", *firstFrameURL)
 		} else {
-			s.log.Infow("First frame downloaded to local storage for caching",
+			firstFramePath = &downloadResult.RelativePath
+			s.log.Infow("First frame downloaded to local storage",
 				"id", videoGenID,
 				"original_url", *firstFrameURL)
 		}
@@ -724,13 +852,20 @@ func (s *VideoGenerationService) completeVideoGeneration(videoGenID uint, videoU
 		updates["first_frame_url"] = *firstFrameURL
 	}
 
-	if err := s.db.Model(&models.VideoGeneration{}).Where("id = ?", videoGenID).Updates(updates).Error; err != nil {
-		s.log.Errorw("Failed to update video generation", "error", err, "id", videoGenID)
+	updated := s.db.Model(&models.VideoGeneration{}).Where("id = ? AND status <> ?", videoGenID, models.VideoStatusCancelled).Updates(updates)
+	if updated.Error != nil {
+		s.log.Errorw("Failed to update video generation", "error", updated.Error, "id", videoGenID)
+		return
+	}
+	if updated.RowsAffected == 0 {
+		s.log.Infow("Video generation cancelled, skipping completion", "id", videoGenID)
 		return
 	}
 
 	var videoGen models.VideoGeneration
 	if err := s.db.First(&videoGen, videoGenID).Error; err == nil {
+		s.saveVideoThumbnail(&videoGen, firstFramePath)
+		emitWebhook(s.taskService.webhooks, videoGen.UserID, WebhookEventVideoCompleted, videoGen)
 		if videoGen.StoryboardID != nil {
 			// 更新 Storyboard 的 video_url 和 duration
 			storyboardUpdates := map[string]interface{}{
@@ -751,18 +886,48 @@ func (s *VideoGenerationService) completeVideoGeneration(videoGenID uint, videoU
 	s.log.Infow("Video generation completed", "id", videoGenID, "url", videoURL, "duration", duration)
 }
 
+// saveVideoThumbnail 用视频首帧生成缩略图，服务商没有返回首帧时使用生成时输入的首帧或参考图
+func (s *VideoGenerationService) saveVideoThumbnail(videoGen *models.VideoGeneration, firstFramePath *string) {
+	if !s.postProcessor.Enabled() {
+		return
+	}
+	for _, source := range []*string{firstFramePath, videoGen.FirstFrameURL, videoGen.ImageURL} {
+		if source == nil || *source == "" {
+			continue
+		}
+		thumbnailURL, err := s.postProcessor.Thumbnail(*source)
+		if err != nil {
+			s.log.Warnw("Failed to create video thumbnail", "error", err, "id", videoGen.ID)
+			continue
+		}
+		if err := s.db.Model(&models.VideoGeneration{}).Where("id = ?", videoGen.ID).Update("thumbnail_url", thumbnailURL).Error; err != nil {
+			s.log.Warnw("Failed to save video thumbnail", "error", err, "id", videoGen.ID)
+			return
+		}
+		videoGen.ThumbnailURL = &thumbnailURL
+		return
+	}
+}
+
 func (s *VideoGenerationService) updateVideoGenError(videoGenID uint, errorMsg string) {
 	var videoGen models.VideoGeneration
 	if err := s.db.First(&videoGen, videoGenID).Error; err != nil {
 		s.log.Errorw("Failed to load video generation for error update", "error", err, "id", videoGenID)
 		return
 	}
+	if videoGen.Status == models.VideoStatusCancelled {
+		return
+	}
 
 	if err := s.db.Model(&models.VideoGeneration{}).Where("id = ?", videoGenID).Updates(map[string]interface{}{
 		"status":    models.VideoStatusFailed,
 		"error_msg": errorMsg,
 	}).Error; err != nil {
 		s.log.Errorw("Failed to update video generation error", "error", err, "id", videoGenID)
+	} else {
+		videoGen.Status = models.VideoStatusFailed
+		videoGen.ErrorMsg = &errorMsg
+		emitWebhook(s.taskService.webhooks, videoGen.UserID, WebhookEventVideoFailed, videoGen)
 	}
 
 	// Refund reserved credits (idempotent) if this generation was billed.
@@ -773,34 +938,122 @@ func (s *VideoGenerationService) updateVideoGenError(videoGenID uint, errorMsg s
 	}
 }
 
-func (s *VideoGenerationService) getVideoClient(userID uint, provider string, modelName string) (video.VideoClient, error) {
-	// 根据模型名称获取AI配置
-	var config *models.AIServiceConfig
-	var err error
+// isVideoGenerationCancelled 本进程内的 context 已取消，或数据库中已被标记为取消
+func (s *VideoGenerationService) isVideoGenerationCancelled(ctx context.Context, videoGenID uint) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	var status models.VideoStatus
+	if err := s.db.Model(&models.VideoGeneration{}).Where("id = ?", videoGenID).Select("status").Scan(&status).Error; err != nil {
+		return false
+	}
+	return status == models.VideoStatusCancelled
+}
 
-	if modelName != "" {
-		config, err = s.aiService.GetConfigForModel("video", modelName, userID)
-		if err != nil {
-			s.log.Warnw("Failed to get config for model, using default", "model", modelName, "error", err)
-			config, err = s.aiService.GetDefaultConfig("video", userID)
+// cancelProviderTask 尽力取消服务端任务，不支持取消的服务商只停止本地轮询
+func (s *VideoGenerationService) cancelProviderTask(client video.VideoClient, videoGenID uint, taskID string) {
+	if routed, ok := client.(*RoutingVideoClient); ok {
+		client = routed.ServedClient()
+	}
+	canceller, ok := client.(video.TaskCanceller)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), videoCancelTimeout)
+	defer cancel()
+	if err := canceller.CancelTaskContext(ctx, taskID); err != nil {
+		s.log.Warnw("Failed to cancel provider video task", "error", err, "id", videoGenID, "task_id", taskID)
+		return
+	}
+	s.log.Infow("Provider video task cancelled", "id", videoGenID, "task_id", taskID)
+}
+
+// CancelVideoGeneration 取消排队或生成中的视频任务：停止轮询、尝试取消服务端任务并退回预扣积分
+func (s *VideoGenerationService) CancelVideoGeneration(userID uint, videoGenID uint) (*models.VideoGeneration, error) {
+	videoGen, err := s.GetVideoGeneration(userID, videoGenID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.Model(&models.VideoGeneration{}).
+		Where("id = ? AND status IN ?", videoGenID, []models.VideoStatus{models.VideoStatusPending, models.VideoStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":    models.VideoStatusCancelled,
+			"error_msg": "cancelled by user",
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel video generation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotCancellable
+	}
+
+	s.taskService.cancelRunning(videoGenerationTaskKey(videoGenID))
+
+	if videoGen.BillingRefID != nil && *videoGen.BillingRefID != "" {
+		if err := s.billingService.RefundAI(*videoGen.BillingRefID); err != nil {
+			s.log.Warnw("Failed to refund cancelled video generation", "error", err, "billing_ref_id", *videoGen.BillingRefID, "id", videoGenID)
+		}
+	}
+
+	if videoGen.TaskID != nil && *videoGen.TaskID != "" {
+		providerTaskID := *videoGen.TaskID
+		s.runner.Submit("video.cancel_provider_task", func() {
+			client, err := s.videoClientForGeneration(videoGen)
 			if err != nil {
-				return nil, fmt.Errorf("no video AI config found: %w", err)
+				s.log.Warnw("Failed to get video client for cancellation", "error", err, "id", videoGenID)
+				return
 			}
-		}
-	} else {
-		config, err = s.aiService.GetDefaultConfig("video", userID)
+			s.cancelProviderTask(client, videoGenID, providerTaskID)
+		})
+	}
+
+	s.log.Infow("Video generation cancelled", "id", videoGenID, "user_id", userID)
+	return s.GetVideoGeneration(userID, videoGenID)
+}
+
+// getVideoClient 根据模型名称获取视频客户端，同一模型有多个配置时按优先级故障转移
+func (s *VideoGenerationService) getVideoClient(userID uint, provider string, modelName string) (video.VideoClient, error) {
+	configs, model, err := s.aiService.routingConfigs("video", modelName, userID)
+	if err != nil {
+		return nil, fmt.Errorf("no video AI config found: %w", err)
+	}
+
+	routes := make([]aiRoute[video.VideoClient], 0, len(configs))
+	for i := range configs {
+		client, err := newVideoClientForConfig(&configs[i], model)
 		if err != nil {
-			return nil, fmt.Errorf("no video AI config found: %w", err)
+			s.log.Warnw("Skipping video config", "config_id", configs[i].ID, "provider", configs[i].Provider, "error", err)
+			continue
+		}
+		routes = append(routes, aiRoute[video.VideoClient]{Config: configs[i], Client: client})
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("unsupported video provider: %s", configs[0].Provider)
+	}
+	return newRoutingVideoClient(routes, s.aiService.routes, s.log), nil
+}
+
+// videoClientForGeneration 已提交到服务商的任务使用提交时的配置查询状态，其余情况重新路由
+func (s *VideoGenerationService) videoClientForGeneration(videoGen *models.VideoGeneration) (video.VideoClient, error) {
+	if videoGen.AIConfigID != nil {
+		var config models.AIServiceConfig
+		if err := s.db.First(&config, *videoGen.AIConfigID).Error; err == nil {
+			model := videoGen.Model
+			if model == "" && len(config.Model) > 0 {
+				model = config.Model[0]
+			}
+			return newVideoClientForConfig(&config, model)
 		}
+		s.log.Warnw("AI config of video generation not found, rerouting", "id", videoGen.ID, "config_id", *videoGen.AIConfigID)
 	}
+	return s.getVideoClient(videoGen.UserID, videoGen.Provider, videoGen.Model)
+}
 
-	// 使用配置中的信息创建客户端
+// newVideoClientForConfig 根据配置的 provider 创建视频客户端
+func newVideoClientForConfig(config *models.AIServiceConfig, model string) (video.VideoClient, error) {
 	baseURL := config.BaseURL
 	apiKey := config.APIKey
-	model := modelName
-	if model == "" && len(config.Model) > 0 {
-		model = config.Model[0]
-	}
 
 	// 根据配置中的 provider 创建对应的客户端
 	var endpoint string
@@ -825,7 +1078,7 @@ func (s *VideoGenerationService) getVideoClient(userID uint, provider string, mo
 	case "minimax":
 		return video.NewMinimaxClient(baseURL, apiKey, model), nil
 	default:
-		return nil, fmt.Errorf("unsupported video provider: %s", provider)
+		return nil, fmt.Errorf("unsupported video provider: %s", config.Provider)
 	}
 }
 
@@ -859,7 +1112,7 @@ func (s *VideoGenerationService) RecoverPendingTasks() {
 			s.log.Warnw("Failed to dispatch recovered video poll through task bus, fallback to local runner", "error", err, "id", videoGen.ID, "task_id", *videoGen.TaskID)
 			videoGenCopy := videoGen
 			s.runner.Submit("video.recover_poll_task_status", func() {
-				s.pollTaskStatus(videoGenCopy.ID, *videoGenCopy.TaskID, videoGenCopy.Provider, videoGenCopy.Model, usage.TokenUsage{})
+				s.pollTaskStatus(videoGenCopy.ID, *videoGenCopy.TaskID, usage.TokenUsage{})
 			})
 		}
 	}
@@ -1,10 +1,17 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
 	"github.com/drama-generator/backend/pkg/usage"
 )
 
@@ -59,3 +66,119 @@ func TestDispatchVideoPollStatus_PublishesDelayedMQJob(t *testing.T) {
 		t.Fatalf("unexpected payload: %#v", actual)
 	}
 }
+
+func TestCancelVideoGeneration_RefundsAndStopsPollChain(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.VideoGeneration{}, &models.AIServiceConfig{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+
+	// 服务商桩：记录取消请求
+	cancelledPaths := make(chan string, 1)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			cancelledPaths <- r.URL.Path
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer provider.Close()
+	videoConfig := models.AIServiceConfig{ServiceType: "video", Provider: "doubao", Name: "seedance", BaseURL: provider.URL,
+		APIKey: "secret", Model: models.ModelField{"seedance"}, IsActive: true, IsDefault: true}
+	if err := db.Create(&videoConfig).Error; err != nil {
+		t.Fatalf("failed to seed video config: %v", err)
+	}
+
+	user := models.User{Email: "cancel@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 50}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	billing := NewBillingService(db, &config.Config{}, nil, log)
+	refID, err := billing.ReserveAI(user.ID, "video", "seedance", 20, "video_generation:1")
+	if err != nil {
+		t.Fatalf("failed to reserve credits: %v", err)
+	}
+
+	providerTaskID := "cgt-1"
+	videoGen := models.VideoGeneration{UserID: user.ID, DramaID: 1, Provider: "doubao", Prompt: "p",
+		Status: models.VideoStatusProcessing, TaskID: &providerTaskID, BillingRefID: &refID}
+	if err := db.Create(&videoGen).Error; err != nil {
+		t.Fatalf("failed to seed video generation: %v", err)
+	}
+
+	dispatcher := &capturingDispatcher{}
+	svc := &VideoGenerationService{db: db, aiService: NewAIService(db, &config.Config{}, log), billingService: billing,
+		taskService: NewTaskService(db, log, NewTaskEventHub(), nil), log: log, runner: NewTaskRunner(log, 1), dispatcher: dispatcher}
+
+	cancelled, err := svc.CancelVideoGeneration(user.ID, videoGen.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cancelled.Status != models.VideoStatusCancelled {
+		t.Fatalf("expected cancelled status, got %s", cancelled.Status)
+	}
+	select {
+	case path := <-cancelledPaths:
+		if path != "/contents/generations/tasks/"+providerTaskID {
+			t.Fatalf("expected provider task %s to be cancelled, got %s", providerTaskID, path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the provider task to be cancelled")
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 50 {
+		t.Fatalf("expected reservation to be refunded, got balance %d", reloaded.Credits)
+	}
+
+	// 已投递的延迟轮询到期后不再续投
+	svc.ProcessVideoPollStatus(context.Background(), VideoPollStatusJobPayload{VideoGenerationID: videoGen.ID, TaskID: providerTaskID, Attempt: 3})
+	if dispatcher.job.Type != "" {
+		t.Fatalf("expected poll chain to stop, got job %+v", dispatcher.job)
+	}
+
+	if _, err := svc.CancelVideoGeneration(user.ID, videoGen.ID); !errors.Is(err, ErrTaskNotCancellable) {
+		t.Fatalf("expected ErrTaskNotCancellable, got %v", err)
+	}
+}
+
+func TestProcessVideoGeneration_ReplayReportsReReserveFailure(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.VideoGeneration{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+
+	user := models.User{Email: "replay@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 20}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	billing := NewBillingService(db, &config.Config{}, nil, log)
+	refID, err := billing.ReserveAI(user.ID, "video", "seedance", 20, "video_generation:1")
+	if err != nil {
+		t.Fatalf("failed to reserve credits: %v", err)
+	}
+	if err := billing.RefundAI(refID); err != nil {
+		t.Fatalf("failed to refund credits: %v", err)
+	}
+	// 失败退款后余额被花掉，重放时无法重新预扣
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("credits", 0)
+
+	videoGen := models.VideoGeneration{UserID: user.ID, DramaID: 1, Provider: "doubao", Prompt: "p",
+		Status: models.VideoStatusFailed, BillingRefID: &refID}
+	if err := db.Create(&videoGen).Error; err != nil {
+		t.Fatalf("failed to seed video generation: %v", err)
+	}
+
+	svc := &VideoGenerationService{db: db, billingService: billing, taskService: NewTaskService(db, log, NewTaskEventHub(), nil), log: log}
+	if err := svc.ProcessVideoGeneration(context.Background(), videoGen.ID); err == nil {
+		t.Fatal("expected replay to fail when credits cannot be re-reserved")
+	}
+
+	var reloaded models.VideoGeneration
+	db.First(&reloaded, videoGen.ID)
+	if reloaded.Status != models.VideoStatusFailed || reloaded.ErrorMsg == nil || *reloaded.ErrorMsg == "" {
+		t.Fatalf("expected failure reason to be recorded, got %+v", reloaded)
+	}
+}
@@ -1,17 +1,20 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	models "github.com/drama-generator/backend/domain/models"
 	"github.com/drama-generator/backend/infrastructure/external/ffmpeg"
 	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/subtitle"
 	"github.com/drama-generator/backend/pkg/video"
 	"gorm.io/gorm"
 )
@@ -20,6 +23,8 @@ type VideoMergeService struct {
 	db              *gorm.DB
 	aiService       *AIService
 	transferService *ResourceTransferService
+	subtitleService *SubtitleService
+	taskService     *TaskService
 	ffmpeg          *ffmpeg.FFmpeg
 	storagePath     string
 	baseURL         string
@@ -27,11 +32,13 @@ type VideoMergeService struct {
 	runner          *TaskRunner
 }
 
-func NewVideoMergeService(db *gorm.DB, transferService *ResourceTransferService, storagePath, baseURL string, log *logger.Logger) *VideoMergeService {
+func NewVideoMergeService(db *gorm.DB, transferService *ResourceTransferService, aiService *AIService, taskService *TaskService, storagePath, baseURL string, log *logger.Logger) *VideoMergeService {
 	return &VideoMergeService{
 		db:              db,
-		aiService:       NewAIService(db, log),
+		aiService:       aiService,
 		transferService: transferService,
+		subtitleService: NewSubtitleService(db, log),
+		taskService:     taskService,
 		ffmpeg:          ffmpeg.NewFFmpeg(log),
 		storagePath:     storagePath,
 		baseURL:         baseURL,
@@ -47,6 +54,12 @@ type MergeVideoRequest struct {
 	Scenes    []models.SceneClip `json:"scenes" binding:"required,min=1"`
 	Provider  string             `json:"provider"`
 	Model     string             `json:"model"`
+	// BurnSubtitles 是否将分镜台词字幕烧录进成片
+	BurnSubtitles bool `json:"burn_subtitles"`
+	// MixVoiceOver 是否将分镜配音混入成片音轨
+	MixVoiceOver bool `json:"mix_voice_over"`
+	// MixScore 是否混入分镜配乐与音效，有配音时配乐自动压低
+	MixScore bool `json:"mix_score"`
 }
 
 func (s *VideoMergeService) MergeVideos(req *MergeVideoRequest) (*models.VideoMerge, error) {
@@ -82,13 +95,16 @@ func (s *VideoMergeService) MergeVideos(req *MergeVideoRequest) (*models.VideoMe
 	dramaID, _ := strconv.ParseUint(req.DramaID, 10, 32)
 
 	videoMerge := &models.VideoMerge{
-		EpisodeID: uint(epID),
-		DramaID:   uint(dramaID),
-		Title:     req.Title,
-		Provider:  provider,
-		Model:     &req.Model,
-		Scenes:    scenesJSON,
-		Status:    models.VideoMergeStatusPending,
+		EpisodeID:     uint(epID),
+		DramaID:       uint(dramaID),
+		Title:         req.Title,
+		Provider:      provider,
+		Model:         &req.Model,
+		Scenes:        scenesJSON,
+		BurnSubtitles: req.BurnSubtitles,
+		MixVoiceOver:  req.MixVoiceOver,
+		MixScore:      req.MixScore,
+		Status:        models.VideoMergeStatusPending,
 	}
 
 	if err := s.db.Create(videoMerge).Error; err != nil {
@@ -103,13 +119,19 @@ func (s *VideoMergeService) MergeVideos(req *MergeVideoRequest) (*models.VideoMe
 }
 
 func (s *VideoMergeService) processMergeVideo(mergeID uint) {
+	ctx, release := s.taskService.trackRunning(context.Background(), videoMergeTaskKey(mergeID))
+	defer release()
+
 	var videoMerge models.VideoMerge
 	if err := s.db.First(&videoMerge, mergeID).Error; err != nil {
 		s.log.Errorw("Failed to load video merge", "error", err, "id", mergeID)
 		return
 	}
 
-	s.db.Model(&videoMerge).Update("status", models.VideoMergeStatusProcessing)
+	if updated := s.db.Model(&videoMerge).Where("status <> ?", models.VideoMergeStatusCancelled).Update("status", models.VideoMergeStatusProcessing); updated.Error == nil && updated.RowsAffected == 0 {
+		s.log.Infow("Video merge cancelled before start", "id", mergeID)
+		return
+	}
 
 	client, err := s.getVideoClient(videoMerge.Provider)
 	if err != nil {
@@ -125,14 +147,18 @@ func (s *VideoMergeService) processMergeVideo(mergeID uint) {
 	}
 
 	// 调用视频合并API
-	result, err := s.mergeVideoClips(client, scenes)
+	result, err := s.mergeVideoClips(client, scenes, &videoMerge)
+	if ctx.Err() != nil {
+		s.log.Infow("Video merge cancelled, discarding result", "id", mergeID)
+		return
+	}
 	if err != nil {
 		s.updateMergeError(mergeID, err.Error())
 		return
 	}
 
 	if !result.Completed {
-		s.db.Model(&videoMerge).Updates(map[string]interface{}{
+		s.db.Model(&videoMerge).Where("status <> ?", models.VideoMergeStatusCancelled).Updates(map[string]interface{}{
 			"status":  models.VideoMergeStatusProcessing,
 			"task_id": result.TaskID,
 		})
@@ -145,7 +171,7 @@ func (s *VideoMergeService) processMergeVideo(mergeID uint) {
 	s.completeMerge(mergeID, result)
 }
 
-func (s *VideoMergeService) mergeVideoClips(client video.VideoClient, scenes []models.SceneClip) (*video.VideoResult, error) {
+func (s *VideoMergeService) mergeVideoClips(client video.VideoClient, scenes []models.SceneClip, videoMerge *models.VideoMerge) (*video.VideoResult, error) {
 	if len(scenes) == 0 {
 		return nil, fmt.Errorf("no scenes to merge")
 	}
@@ -209,6 +235,18 @@ func (s *VideoMergeService) mergeVideoClips(client video.VideoClient, scenes []m
 
 	s.log.Infow("Video merged successfully", "path", mergedPath)
 
+	if videoMerge.MixVoiceOver || videoMerge.MixScore {
+		if err := s.mixSceneAudio(scenes, mergedPath, videoMerge); err != nil {
+			return nil, fmt.Errorf("mix audio failed: %w", err)
+		}
+	}
+
+	if videoMerge.BurnSubtitles {
+		if err := s.burnSceneSubtitles(scenes, mergedPath, videoMerge.EpisodeID); err != nil {
+			return nil, fmt.Errorf("burn subtitles failed: %w", err)
+		}
+	}
+
 	// 生成相对路径（不包含协议、IP、端口）
 	relPath := filepath.Join("videos", "merged", fileName)
 
@@ -222,14 +260,158 @@ func (s *VideoMergeService) mergeVideoClips(client video.VideoClient, scenes []m
 	return result, nil
 }
 
+// burnSceneSubtitles 根据合成片段生成字幕并烧录进已合成的视频（原地替换）
+func (s *VideoMergeService) burnSceneSubtitles(scenes []models.SceneClip, mergedPath string, episodeID uint) error {
+	cues, err := s.subtitleService.BuildSceneCues(episodeID, scenes)
+	if err != nil {
+		return err
+	}
+	if len(cues) == 0 {
+		s.log.Infow("No dialogue to burn, skipping subtitles", "path", mergedPath)
+		return nil
+	}
+
+	srtPath := strings.TrimSuffix(mergedPath, filepath.Ext(mergedPath)) + ".srt"
+	if err := os.WriteFile(srtPath, []byte(subtitle.FormatSRT(cues)), 0644); err != nil {
+		return fmt.Errorf("failed to write subtitle file: %w", err)
+	}
+	defer os.Remove(srtPath)
+
+	burnedPath := strings.TrimSuffix(mergedPath, filepath.Ext(mergedPath)) + "_sub.mp4"
+	if err := s.ffmpeg.BurnSubtitles(mergedPath, srtPath, burnedPath); err != nil {
+		os.Remove(burnedPath)
+		return err
+	}
+	return os.Rename(burnedPath, mergedPath)
+}
+
+// mixSceneAudio 将各分镜的配音、配乐、音效按合成时间轴混入已合成的视频（原地替换）
+func (s *VideoMergeService) mixSceneAudio(scenes []models.SceneClip, mergedPath string, videoMerge *models.VideoMerge) error {
+	opts := &ffmpeg.VoiceOverOptions{VideoPath: mergedPath}
+	if videoMerge.MixVoiceOver {
+		voices, err := s.buildVoiceTracks(scenes, videoMerge.EpisodeID)
+		if err != nil {
+			return err
+		}
+		opts.Tracks = voices
+	}
+	if videoMerge.MixScore {
+		musicTracks, effects, err := s.buildScoreTracks(scenes, videoMerge.EpisodeID)
+		if err != nil {
+			return err
+		}
+		opts.Music, opts.Effects = musicTracks, effects
+	}
+	if len(opts.Tracks)+len(opts.Music)+len(opts.Effects) == 0 {
+		s.log.Infow("No voice-over or score clips found, skipping mix", "path", mergedPath)
+		return nil
+	}
+
+	mixedPath := strings.TrimSuffix(mergedPath, filepath.Ext(mergedPath)) + "_mix.mp4"
+	opts.OutputPath = mixedPath
+	if err := s.ffmpeg.MixVoiceOver(opts); err != nil {
+		os.Remove(mixedPath)
+		return err
+	}
+	return os.Rename(mixedPath, mergedPath)
+}
+
+// buildVoiceTracks 查找每个分镜最新一组配音，与字幕使用同一套时间区间。片段 ID 来自请求，只使用合成所属剧集的配音
+func (s *VideoMergeService) buildVoiceTracks(scenes []models.SceneClip, episodeID uint) ([]ffmpeg.VoiceTrack, error) {
+	var tracks []ffmpeg.VoiceTrack
+	for _, window := range buildSceneWindows(scenes) {
+		if window.SceneID == 0 {
+			continue
+		}
+
+		var assets []models.Asset
+		if err := s.db.Where("storyboard_id = ? AND episode_id = ? AND type = ? AND category = ?", window.SceneID, episodeID, models.AssetTypeAudio, voiceOverAssetCategory).
+			Order("id ASC").Find(&assets).Error; err != nil {
+			return nil, fmt.Errorf("failed to load voice-over clips: %w", err)
+		}
+
+		track := ffmpeg.VoiceTrack{Offset: window.Start}
+		for _, asset := range assets {
+			if asset.LocalPath != nil && *asset.LocalPath != "" {
+				track.Paths = append(track.Paths, filepath.Join(s.storagePath, *asset.LocalPath))
+			}
+		}
+		if len(track.Paths) > 0 {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks, nil
+}
+
+// buildScoreTracks 按配乐区间循环/裁剪配乐，音效在所属分镜开始时播放。只读取合成所属剧集的分镜和配乐
+func (s *VideoMergeService) buildScoreTracks(scenes []models.SceneClip, episodeID uint) ([]ffmpeg.BackgroundTrack, []ffmpeg.BackgroundTrack, error) {
+	windows := buildSceneWindows(scenes)
+	ids := make([]uint, 0, len(windows))
+	for _, w := range windows {
+		if w.SceneID != 0 {
+			ids = append(ids, w.SceneID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	var storyboards []models.Storyboard
+	if err := s.db.Select("id", "bgm_prompt", "sound_effect").Where("id IN ? AND episode_id = ?", ids, episodeID).Find(&storyboards).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load storyboard score prompts: %w", err)
+	}
+	prompts := make(map[uint]string, len(storyboards))
+	effects := make(map[uint]string, len(storyboards))
+	for _, sb := range storyboards {
+		if sb.BgmPrompt != nil {
+			prompts[sb.ID] = *sb.BgmPrompt
+		}
+		if sb.SoundEffect != nil {
+			effects[sb.ID] = strings.TrimSpace(*sb.SoundEffect)
+		}
+	}
+
+	localPath := func(category, prompt string) string {
+		asset, err := findScoreAsset(s.db, episodeID, category, prompt)
+		if err != nil || asset.LocalPath == nil || *asset.LocalPath == "" {
+			return ""
+		}
+		return filepath.Join(s.storagePath, *asset.LocalPath)
+	}
+
+	var musicTracks []ffmpeg.BackgroundTrack
+	for _, r := range buildScoreRanges(windows, prompts) {
+		if path := localPath(scoreMusicCategory, r.Prompt); path != "" {
+			musicTracks = append(musicTracks, ffmpeg.BackgroundTrack{Path: path, Offset: r.Start, Duration: r.End - r.Start, Loop: true})
+		}
+	}
+
+	var effectTracks []ffmpeg.BackgroundTrack
+	for _, w := range windows {
+		if effect := effects[w.SceneID]; effect != "" {
+			if path := localPath(scoreEffectCategory, effect); path != "" {
+				effectTracks = append(effectTracks, ffmpeg.BackgroundTrack{Path: path, Offset: w.Start, Duration: w.End - w.Start})
+			}
+		}
+	}
+
+	return musicTracks, effectTracks, nil
+}
+
 func (s *VideoMergeService) pollMergeStatus(mergeID uint, client video.VideoClient, taskID string) {
 	maxAttempts := 240
 	pollInterval := 5 * time.Second
 
+	ctx, release := s.taskService.trackRunning(context.Background(), videoMergeTaskKey(mergeID))
+	defer release()
+
 	for i := 0; i < maxAttempts; i++ {
-		time.Sleep(pollInterval)
+		if !sleepContext(ctx, pollInterval) {
+			s.log.Infow("Video merge cancelled, stopping poll", "id", mergeID, "task_id", taskID)
+			return
+		}
 
-		result, err := client.GetTaskStatus(taskID)
+		result, err := client.GetTaskStatusContext(ctx, taskID)
 		if err != nil {
 			s.log.Errorw("Failed to get merge task status", "error", err, "task_id", taskID)
 			continue
@@ -258,6 +440,10 @@ func (s *VideoMergeService) completeMerge(mergeID uint, result *video.VideoResul
 		s.log.Errorw("Failed to load video merge for completion", "error", err, "id", mergeID)
 		return
 	}
+	if videoMerge.Status == models.VideoMergeStatusCancelled {
+		s.log.Infow("Video merge cancelled, skipping completion", "id", mergeID)
+		return
+	}
 
 	finalVideoURL := result.VideoURL
 
@@ -286,14 +472,33 @@ func (s *VideoMergeService) completeMerge(mergeID uint, result *video.VideoResul
 	}
 
 	s.log.Infow("Video merge completed", "id", mergeID, "url", finalVideoURL)
+	s.emitMergeEvent(mergeID, WebhookEventMergeCompleted)
 }
 
 func (s *VideoMergeService) updateMergeError(mergeID uint, errorMsg string) {
-	s.db.Model(&models.VideoMerge{}).Where("id = ?", mergeID).Updates(map[string]interface{}{
+	result := s.db.Model(&models.VideoMerge{}).Where("id = ? AND status <> ?", mergeID, models.VideoMergeStatusCancelled).Updates(map[string]interface{}{
 		"status":    models.VideoMergeStatusFailed,
 		"error_msg": errorMsg,
 	})
 	s.log.Errorw("Video merge failed", "id", mergeID, "error", errorMsg)
+	if result.Error == nil && result.RowsAffected > 0 {
+		s.emitMergeEvent(mergeID, WebhookEventMergeFailed)
+	}
+}
+
+// emitMergeEvent 合成记录不含用户，通过所属剧本找到用户后触发 webhook 事件
+func (s *VideoMergeService) emitMergeEvent(mergeID uint, event string) {
+	var videoMerge models.VideoMerge
+	if err := s.db.First(&videoMerge, mergeID).Error; err != nil {
+		s.log.Warnw("Failed to load video merge for webhook", "error", err, "id", mergeID)
+		return
+	}
+	var userID uint
+	if err := s.db.Model(&models.Drama{}).Where("id = ?", videoMerge.DramaID).Select("user_id").Scan(&userID).Error; err != nil {
+		s.log.Warnw("Failed to resolve video merge owner", "error", err, "id", mergeID)
+		return
+	}
+	emitWebhook(s.taskService.webhooks, userID, event, videoMerge)
 }
 
 func (s *VideoMergeService) getVideoClient(provider string) (video.VideoClient, error) {
@@ -369,6 +574,32 @@ func (s *VideoMergeService) ListMerges(episodeID *string, status string, page, p
 	return merges, total, nil
 }
 
+// CancelMerge 取消用户排队或合成中的视频合并任务，合并记录按所属剧集校验归属
+func (s *VideoMergeService) CancelMerge(userID, mergeID uint) (*models.VideoMerge, error) {
+	userEpisodes := s.db.Model(&models.Episode{}).Select("id").Where("user_id = ?", userID)
+	var merge models.VideoMerge
+	if err := s.db.Where("id = ? AND episode_id IN (?)", mergeID, userEpisodes).First(&merge).Error; err != nil {
+		return nil, err
+	}
+
+	result := s.db.Model(&models.VideoMerge{}).
+		Where("id = ? AND episode_id IN (?) AND status IN ?", mergeID, userEpisodes, []models.VideoMergeStatus{models.VideoMergeStatusPending, models.VideoMergeStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":    models.VideoMergeStatusCancelled,
+			"error_msg": "cancelled by user",
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel video merge: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotCancellable
+	}
+
+	s.taskService.cancelRunning(videoMergeTaskKey(mergeID))
+	s.log.Infow("Video merge cancelled", "id", mergeID)
+	return s.GetMerge(mergeID)
+}
+
 func (s *VideoMergeService) DeleteMerge(mergeID uint) error {
 	result := s.db.Where("id = ? ", mergeID).Delete(&models.VideoMerge{})
 	if result.Error != nil {
@@ -410,8 +641,11 @@ func getAssetIDString(assetID interface{}) string {
 
 // FinalizeEpisodeRequest 完成剧集制作请求
 type FinalizeEpisodeRequest struct {
-	EpisodeID string         `json:"episode_id"`
-	Clips     []TimelineClip `json:"clips"`
+	EpisodeID     string         `json:"episode_id"`
+	Clips         []TimelineClip `json:"clips"`
+	BurnSubtitles bool           `json:"burn_subtitles"` // 是否烧录台词字幕
+	MixVoiceOver  bool           `json:"mix_voice_over"` // 是否混入分镜配音
+	MixScore      bool           `json:"mix_score"`      // 是否混入配乐与音效
 }
 
 // FinalizeEpisode 完成集数制作，根据时间线场景顺序合成最终视频
@@ -627,6 +861,11 @@ func (s *VideoMergeService) FinalizeEpisode(episodeID string, timelineData *Fina
 		Scenes:    sceneClips,
 		Provider:  "doubao", // 默认使用doubao
 	}
+	if timelineData != nil {
+		finalReq.BurnSubtitles = timelineData.BurnSubtitles
+		finalReq.MixVoiceOver = timelineData.MixVoiceOver
+		finalReq.MixScore = timelineData.MixScore
+	}
 
 	// 执行视频合成
 	videoMerge, err := s.MergeVideos(finalReq)
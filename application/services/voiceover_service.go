@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	models "github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/infrastructure/external/ffmpeg"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/tts"
+	"gorm.io/gorm"
+)
+
+const (
+	voiceOverTaskType = "voiceover_generation"
+	// voiceOverAssetCategory 配音素材分类，合成时按此分类查找分镜配音
+	voiceOverAssetCategory = "voiceover"
+	// maxSpeakerRunes 说话人名称的最大长度，超过则视为旁白中的普通冒号
+	maxSpeakerRunes = 16
+)
+
+// VoiceOverService 根据分镜台词和角色音色生成配音
+type VoiceOverService struct {
+	db             *gorm.DB
+	aiService      *AIService
+	billingService *BillingService
+	taskService    *TaskService
+	ffmpeg         *ffmpeg.FFmpeg
+	storagePath    string
+	baseURL        string
+	log            *logger.Logger
+	runner         *TaskRunner
+	dispatcher     JobDispatcher
+}
+
+func NewVoiceOverService(db *gorm.DB, cfg *config.Config, aiService *AIService, taskService *TaskService, dispatcher JobDispatcher, log *logger.Logger) *VoiceOverService {
+	return &VoiceOverService{
+		db:             db,
+		aiService:      aiService,
+		billingService: NewBillingService(db, cfg, taskService.webhooks, log),
+		taskService:    taskService,
+		ffmpeg:         ffmpeg.NewFFmpeg(log),
+		storagePath:    cfg.Storage.LocalPath,
+		baseURL:        cfg.Storage.BaseURL,
+		log:            log,
+		runner:         NewTaskRunner(log, 2),
+		dispatcher:     dispatcher,
+	}
+}
+
+type GenerateVoiceOverRequest struct {
+	Model         string `json:"model"`
+	StoryboardIDs []uint `json:"storyboard_ids"` // 为空时生成整集配音
+}
+
+// DialogueLine 台词中的一句，Speaker 为空表示旁白
+type DialogueLine struct {
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+}
+
+// ParseDialogueLines 解析分镜台词，支持 "角色：台词"、"角色(画外音): 台词" 等格式，无说话人的行视为旁白
+func ParseDialogueLines(dialogue string) []DialogueLine {
+	var lines []DialogueLine
+	for _, raw := range strings.Split(strings.ReplaceAll(dialogue, "\r\n", "\n"), "\n") {
+		raw = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(raw), "-*•"))
+		if raw == "" {
+			continue
+		}
+
+		speaker, text := splitSpeaker(raw)
+		text = strings.TrimSpace(strings.Trim(text, " \"'“”「」『』"))
+		if text == "" {
+			continue
+		}
+		lines = append(lines, DialogueLine{Speaker: speaker, Text: text})
+	}
+	return lines
+}
+
+func splitSpeaker(line string) (string, string) {
+	idx := strings.IndexAny(line, ":：")
+	if idx <= 0 {
+		return "", line
+	}
+
+	speaker := line[:idx]
+	_, sepSize := utf8.DecodeRuneInString(line[idx:])
+	text := line[idx+sepSize:]
+
+	// 去掉 (画外音)、（OS） 等标注
+	if cut := strings.IndexAny(speaker, "(（"); cut > 0 {
+		speaker = speaker[:cut]
+	}
+	speaker = strings.TrimSpace(strings.Trim(strings.TrimSpace(speaker), "【】[]"))
+
+	if speaker == "" || utf8.RuneCountInString(speaker) > maxSpeakerRunes || strings.ContainsAny(speaker, "，。！？,.!?\"“”") {
+		return "", line
+	}
+	return speaker, text
+}
+
+// GenerateEpisodeVoiceOver 创建剧集配音任务，返回任务ID
+func (s *VoiceOverService) GenerateEpisodeVoiceOver(userID, episodeID uint, req *GenerateVoiceOverRequest) (string, error) {
+	var episode models.Episode
+	if err := s.db.Where("id = ? AND user_id = ?", episodeID, userID).First(&episode).Error; err != nil {
+		return "", ErrEpisodeNotFound
+	}
+
+	task, created, err := s.taskService.CreateOrGetActiveTask(userID, voiceOverTaskType, strconv.FormatUint(uint64(episode.ID), 10))
+	if err != nil {
+		return "", fmt.Errorf("创建任务失败: %w", err)
+	}
+	if !created {
+		s.log.Infow("Reusing active voice-over task", "task_id", task.ID, "episode_id", episode.ID)
+		return task.ID, nil
+	}
+
+	payload := VoiceOverJobPayload{
+		UserID:        userID,
+		TaskID:        task.ID,
+		EpisodeID:     episode.ID,
+		Model:         req.Model,
+		StoryboardIDs: req.StoryboardIDs,
+	}
+	if err := s.dispatchVoiceOver(payload); err != nil {
+		s.log.Warnw("Failed to dispatch voice-over through task bus, fallback to local runner", "error", err, "task_id", task.ID)
+		s.runner.Submit("voiceover.generate", func() {
+			s.ProcessVoiceOver(context.Background(), payload)
+		})
+	}
+
+	return task.ID, nil
+}
+
+func (s *VoiceOverService) dispatchVoiceOver(payload VoiceOverJobPayload) error {
+	if s.dispatcher == nil {
+		return fmt.Errorf("task dispatcher not configured")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal voice-over job payload: %w", err)
+	}
+
+	return s.dispatcher.Dispatch(AsyncJob{
+		Type:    JobTypeVoiceOver,
+		Payload: body,
+	})
+}
+
+// ProcessVoiceOver 后台逐个分镜合成配音，临时性错误返回给任务总线重试
+func (s *VoiceOverService) ProcessVoiceOver(ctx context.Context, payload VoiceOverJobPayload) error {
+	taskID := payload.TaskID
+	ctx, release := s.taskService.TrackTask(ctx, taskID)
+	defer release()
+	if ctx.Err() != nil {
+		s.log.Infow("Task cancelled before start", "task_id", taskID)
+		return nil
+	}
+
+	if err := s.taskService.UpdateTaskStatus(taskID, "processing", 0, "开始生成配音..."); err != nil {
+		s.log.Errorw("Failed to update task status", "error", err, "task_id", taskID)
+		return nil
+	}
+
+	var episode models.Episode
+	if err := s.db.Where("id = ? AND user_id = ?", payload.EpisodeID, payload.UserID).First(&episode).Error; err != nil {
+		return s.failVoiceOver(ctx, taskID, ErrEpisodeNotFound)
+	}
+
+	query := s.db.Where("episode_id = ?", episode.ID)
+	if len(payload.StoryboardIDs) > 0 {
+		query = query.Where("id IN ?", payload.StoryboardIDs)
+	}
+	var storyboards []models.Storyboard
+	if err := query.Order("storyboard_number ASC").Find(&storyboards).Error; err != nil {
+		return s.failVoiceOver(ctx, taskID, fmt.Errorf("failed to load storyboards: %w", err))
+	}
+
+	cfg, model, err := s.aiService.GetBillingConfig("audio", payload.Model, payload.UserID)
+	if err != nil {
+		return s.failVoiceOver(ctx, taskID, fmt.Errorf("no audio AI config found: %w", err))
+	}
+	client := s.getTTSClient(cfg, model)
+	voices := s.loadCharacterVoices(episode.DramaID)
+
+	var assetIDs []uint
+	for i := range storyboards {
+		if err := ctx.Err(); err != nil {
+			return s.failVoiceOver(ctx, taskID, err)
+		}
+
+		sb := &storyboards[i]
+		if sb.Dialogue == nil {
+			continue
+		}
+		lines := ParseDialogueLines(*sb.Dialogue)
+		if len(lines) == 0 {
+			continue
+		}
+
+		assets, err := s.synthesizeStoryboard(ctx, payload.UserID, &episode, sb, lines, voices, cfg, model, client)
+		if err != nil {
+			return s.failVoiceOver(ctx, taskID, fmt.Errorf("镜头 %d 配音失败: %w", sb.StoryboardNumber, err))
+		}
+		for _, asset := range assets {
+			assetIDs = append(assetIDs, asset.ID)
+		}
+
+		progress := (i + 1) * 100 / len(storyboards)
+		if progress >= 100 {
+			progress = 99
+		}
+		if err := s.taskService.UpdateTaskStatus(taskID, "processing", progress, fmt.Sprintf("已完成 %d/%d 个镜头配音", i+1, len(storyboards))); err != nil {
+			s.log.Warnw("Failed to update voice-over progress", "error", err, "task_id", taskID)
+		}
+	}
+
+	if err := s.taskService.UpdateTaskResult(taskID, map[string]interface{}{
+		"episode_id": episode.ID,
+		"asset_ids":  assetIDs,
+		"clip_count": len(assetIDs),
+	}); err != nil {
+		s.log.Errorw("Failed to update voice-over task result", "error", err, "task_id", taskID)
+	}
+
+	s.log.Infow("Voice-over generated", "episode_id", episode.ID, "clip_count", len(assetIDs))
+	return nil
+}
+
+// synthesizeStoryboard 合成单个分镜的全部台词，成功后替换该分镜之前的配音
+func (s *VoiceOverService) synthesizeStoryboard(ctx context.Context, userID uint, episode *models.Episode, sb *models.Storyboard, lines []DialogueLine, voices map[string]string, cfg *models.AIServiceConfig, model string, client tts.TTSClient) ([]models.Asset, error) {
+	dir := filepath.Join(s.storagePath, "audio", "voiceover")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audio directory: %w", err)
+	}
+
+	// 任一句失败时删除本镜头已生成的片段，并退还本次调用的全部预扣
+	created := make([]models.Asset, 0, len(lines))
+	refIDs := make([]string, 0, len(lines))
+	rollback := func() {
+		for _, refID := range refIDs {
+			if err := s.billingService.RefundAI(refID); err != nil {
+				s.log.Errorw("Failed to refund voice-over reservation", "error", err, "ref_id", refID)
+			}
+		}
+		for _, asset := range created {
+			if asset.LocalPath != nil {
+				os.Remove(filepath.Join(s.storagePath, *asset.LocalPath))
+			}
+			s.db.Unscoped().Delete(&models.Asset{}, asset.ID)
+		}
+	}
+
+	for i, line := range lines {
+		style := voices[line.Speaker]
+		if line.Speaker == "" && style == "" {
+			style = "旁白"
+		}
+		opts := []tts.TTSOption{tts.WithVoice(tts.ResolveOpenAIVoice(style))}
+		// tts-1 系列不支持 instructions
+		if style != "" && !strings.HasPrefix(model, "tts-1") {
+			opts = append(opts, tts.WithInstructions(style))
+		}
+
+		refID, err := s.billingService.ReserveAI(userID, "audio", model, cfg.CreditCost, fmt.Sprintf("voiceover:%d", sb.ID))
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if refID != "" {
+			refIDs = append(refIDs, refID)
+		}
+
+		result, err := client.SynthesizeContext(ctx, line.Text, opts...)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if refID != "" {
+			if err := s.billingService.RecordAIUsage(refID, client.GetLastUsage()); err != nil {
+				s.log.Warnw("Failed to record voice-over usage", "error", err, "ref_id", refID)
+			}
+		}
+
+		asset, err := s.saveVoiceClip(userID, episode, sb, i, line, result)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		created = append(created, *asset)
+	}
+
+	ids := make([]uint, 0, len(created))
+	for _, asset := range created {
+		ids = append(ids, asset.ID)
+	}
+	var previous []models.Asset
+	if err := s.db.Where("storyboard_id = ? AND type = ? AND category = ? AND id NOT IN ?",
+		sb.ID, models.AssetTypeAudio, voiceOverAssetCategory, ids).Find(&previous).Error; err != nil {
+		s.log.Warnw("Failed to load previous voice-over clips", "error", err, "storyboard_id", sb.ID)
+	} else if len(previous) > 0 {
+		s.removeVoiceClips(previous)
+	}
+
+	return created, nil
+}
+
+// removeVoiceClips 删除被替换的配音记录及其音频文件，仍被其他素材引用的文件保留
+func (s *VoiceOverService) removeVoiceClips(assets []models.Asset) {
+	ids := make([]uint, 0, len(assets))
+	for _, asset := range assets {
+		ids = append(ids, asset.ID)
+	}
+	if err := s.db.Delete(&models.Asset{}, ids).Error; err != nil {
+		s.log.Warnw("Failed to remove previous voice-over clips", "error", err, "asset_ids", ids)
+		return
+	}
+	for _, asset := range assets {
+		if asset.LocalPath == nil || *asset.LocalPath == "" {
+			continue
+		}
+		var refs int64
+		if err := s.db.Model(&models.Asset{}).Where("local_path = ?", *asset.LocalPath).Count(&refs).Error; err != nil || refs > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.storagePath, *asset.LocalPath)); err != nil && !os.IsNotExist(err) {
+			s.log.Warnw("Failed to remove previous voice-over audio", "error", err, "path", *asset.LocalPath)
+		}
+	}
+}
+
+func (s *VoiceOverService) saveVoiceClip(userID uint, episode *models.Episode, sb *models.Storyboard, index int, line DialogueLine, result *tts.TTSResult) (*models.Asset, error) {
+	format := result.Format
+	if format == "" {
+		format = "mp3"
+	}
+	fileName := fmt.Sprintf("sb%d_%02d_%d.%s", sb.ID, index+1, time.Now().UnixNano(), format)
+	relPath := filepath.ToSlash(filepath.Join("audio", "voiceover", fileName))
+	absPath := filepath.Join(s.storagePath, relPath)
+	if err := os.WriteFile(absPath, result.Audio, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save audio: %w", err)
+	}
+
+	speaker := line.Speaker
+	if speaker == "" {
+		speaker = "旁白"
+	}
+	dramaID := episode.DramaID
+	episodeID := episode.ID
+	storyboardID := sb.ID
+	storyboardNum := sb.StoryboardNumber
+	category := voiceOverAssetCategory
+	description := line.Text
+	fileSize := int64(len(result.Audio))
+	asset := &models.Asset{
+		UserID:        userID,
+		DramaID:       &dramaID,
+		EpisodeID:     &episodeID,
+		StoryboardID:  &storyboardID,
+		StoryboardNum: &storyboardNum,
+		Name:          fmt.Sprintf("配音-镜头%d-%02d-%s", sb.StoryboardNumber, index+1, speaker),
+		Description:   &description,
+		Type:          models.AssetTypeAudio,
+		Category:      &category,
+		URL:           fmt.Sprintf("%s/%s", s.baseURL, relPath),
+		LocalPath:     &relPath,
+		FileSize:      &fileSize,
+		Format:        &format,
+	}
+	if result.ContentType != "" {
+		asset.MimeType = &result.ContentType
+	}
+	if duration, err := s.ffmpeg.GetVideoDuration(absPath); err == nil {
+		seconds := int(duration + 0.5)
+		asset.Duration = &seconds
+	}
+
+	if err := s.db.Create(asset).Error; err != nil {
+		os.Remove(absPath)
+		return nil, fmt.Errorf("failed to create audio asset: %w", err)
+	}
+	return asset, nil
+}
+
+func (s *VoiceOverService) failVoiceOver(ctx context.Context, taskID string, err error) error {
+	s.log.Errorw("Voice-over generation failed", "error", err, "task_id", taskID)
+	return s.taskService.failOrRetry(ctx, taskID, err)
+}
+
+// loadCharacterVoices 加载剧中角色名到音色描述的映射
+func (s *VoiceOverService) loadCharacterVoices(dramaID uint) map[string]string {
+	voices := make(map[string]string)
+	var characters []models.Character
+	if err := s.db.Select("name", "voice_style").Where("drama_id = ?", dramaID).Find(&characters).Error; err != nil {
+		s.log.Warnw("Failed to load character voices", "error", err, "drama_id", dramaID)
+		return voices
+	}
+	for _, character := range characters {
+		if character.VoiceStyle != nil {
+			voices[strings.TrimSpace(character.Name)] = strings.TrimSpace(*character.VoiceStyle)
+		}
+	}
+	return voices
+}
+
+// getTTSClient 目前仅支持 OpenAI 兼容的 /audio/speech 接口
+func (s *VoiceOverService) getTTSClient(config *models.AIServiceConfig, model string) tts.TTSClient {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "/audio/speech"
+	}
+	return tts.NewOpenAITTSClient(config.BaseURL, config.APIKey, model, endpoint)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/drama-generator/backend/pkg/tts"
+)
+
+func TestParseDialogueLines(t *testing.T) {
+	lines := ParseDialogueLines("林晚：“你终于来了。”\n陈默（画外音）: 我一直都在\n\n夜色渐深，风声四起：远处传来钟声\n- 林晚：走吧")
+
+	want := []DialogueLine{
+		{Speaker: "林晚", Text: "你终于来了。"},
+		{Speaker: "陈默", Text: "我一直都在"},
+		{Speaker: "", Text: "夜色渐深，风声四起：远处传来钟声"},
+		{Speaker: "林晚", Text: "走吧"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %+v", len(want), lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("line %d: expected %+v, got %+v", i, want[i], lines[i])
+		}
+	}
+}
+
+func TestVoiceOverService_ProcessSynthesizesAndBillsPerLine(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.AsyncTask{}, &models.AIServiceConfig{}, &models.Character{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+
+	var mu sync.Mutex
+	var requests []tts.SpeechRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req tts.SpeechRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3" + req.Input))
+	}))
+	defer server.Close()
+
+	user := models.User{Email: "voice@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 100}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+	if err := db.Create(&models.AIServiceConfig{
+		ServiceType: "audio",
+		Provider:    "openai",
+		Name:        "tts",
+		BaseURL:     server.URL,
+		APIKey:      "key",
+		Model:       models.ModelField{"gpt-4o-mini-tts"},
+		CreditCost:  2,
+		Endpoint:    "/audio/speech",
+		IsDefault:   true,
+		IsActive:    true,
+	}).Error; err != nil {
+		t.Fatalf("failed to seed ai config: %v", err)
+	}
+
+	episode := seedTimelineEpisode(t, db, user.ID)
+	style := "低沉男声"
+	if err := db.Create(&models.Character{UserID: user.ID, DramaID: episode.DramaID, Name: "陈默", VoiceStyle: &style}).Error; err != nil {
+		t.Fatalf("failed to seed character: %v", err)
+	}
+	var storyboards []models.Storyboard
+	db.Where("episode_id = ?", episode.ID).Order("storyboard_number ASC").Find(&storyboards)
+	db.Model(&storyboards[0]).Update("dialogue", "陈默：我回来了\n林晚：欢迎回来")
+	db.Model(&storyboards[2]).Update("dialogue", "城市重新安静下来")
+
+	storagePath := t.TempDir()
+	cfg := &config.Config{Storage: config.StorageConfig{LocalPath: storagePath, BaseURL: "http://localhost/static"}}
+	dispatcher := &capturingDispatcher{}
+	svc := NewVoiceOverService(db, cfg, NewAIService(db, cfg, log), NewTaskService(db, log, NewTaskEventHub(), nil), dispatcher, log)
+
+	taskID, err := svc.GenerateEpisodeVoiceOver(user.ID, episode.ID, &GenerateVoiceOverRequest{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if dispatcher.job.Type != JobTypeVoiceOver {
+		t.Fatalf("expected job type %s, got %s", JobTypeVoiceOver, dispatcher.job.Type)
+	}
+	var payload VoiceOverJobPayload
+	if err := json.Unmarshal(dispatcher.job.Payload, &payload); err != nil {
+		t.Fatalf("unmarshal payload error: %v", err)
+	}
+	svc.ProcessVoiceOver(context.Background(), payload)
+
+	task, err := NewTaskService(db, log, NewTaskEventHub(), nil).GetTask(taskID)
+	if err != nil || task.Status != "completed" {
+		t.Fatalf("expected completed task, got %+v (%v)", task, err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 tts calls, got %d", len(requests))
+	}
+	if requests[0].Voice != "onyx" || requests[0].Instructions != style {
+		t.Fatalf("expected character voice style to drive first line, got %+v", requests[0])
+	}
+	if requests[2].Voice != "fable" {
+		t.Fatalf("expected narrator voice for narration, got %+v", requests[2])
+	}
+
+	var assets []models.Asset
+	db.Where("type = ? AND category = ?", models.AssetTypeAudio, voiceOverAssetCategory).Order("id ASC").Find(&assets)
+	if len(assets) != 3 || *assets[0].StoryboardID != storyboards[0].ID || *assets[2].StoryboardID != storyboards[2].ID {
+		t.Fatalf("unexpected voice-over assets: %+v", assets)
+	}
+	if _, err := os.Stat(filepath.Join(storagePath, *assets[0].LocalPath)); err != nil {
+		t.Fatalf("expected audio file on disk: %v", err)
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 94 {
+		t.Fatalf("expected 6 credits consumed, got balance %d", reloaded.Credits)
+	}
+	var audioTxns int64
+	db.Model(&models.CreditTransaction{}).Where("type = ?", models.CreditTxnAIAudio).Count(&audioTxns)
+	if audioTxns != 3 {
+		t.Fatalf("expected 3 audio transactions, got %d", audioTxns)
+	}
+
+	// 重新生成时替换该分镜的旧配音
+	svc.ProcessVoiceOver(context.Background(), VoiceOverJobPayload{UserID: user.ID, TaskID: taskID, EpisodeID: episode.ID, StoryboardIDs: []uint{storyboards[0].ID}})
+	var count int64
+	db.Model(&models.Asset{}).Where("storyboard_id = ? AND category = ?", storyboards[0].ID, voiceOverAssetCategory).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected previous clips replaced, got %d active clips", count)
+	}
+	for _, replaced := range assets[:2] {
+		if _, err := os.Stat(filepath.Join(storagePath, *replaced.LocalPath)); !os.IsNotExist(err) {
+			t.Fatalf("expected replaced audio removed from disk, got %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(storagePath, *assets[2].LocalPath)); err != nil {
+		t.Fatalf("expected other storyboards' audio kept: %v", err)
+	}
+
+	merge := NewVideoMergeService(db, nil, NewAIService(db, &config.Config{}, log), NewTaskService(db, log, NewTaskEventHub(), nil), storagePath, "", log)
+	scenes := []models.SceneClip{
+		{SceneID: storyboards[0].ID, Duration: 3, Order: 0, Transition: map[string]interface{}{"type": "fade", "duration": 1.0}},
+		{SceneID: storyboards[1].ID, Duration: 5, Order: 1},
+		{SceneID: storyboards[2].ID, Duration: 4, Order: 2},
+	}
+	tracks, err := merge.buildVoiceTracks(scenes, episode.ID)
+	if err != nil {
+		t.Fatalf("failed to build voice tracks: %v", err)
+	}
+	if len(tracks) != 2 || len(tracks[0].Paths) != 2 || tracks[0].Offset != 0 || tracks[1].Offset != 8 {
+		t.Fatalf("unexpected voice tracks: %+v", tracks)
+	}
+	// 其他剧集的合成引用这些分镜时不能混入它们的配音
+	if tracks, err := merge.buildVoiceTracks(scenes, episode.ID+1); err != nil || len(tracks) != 0 {
+		t.Fatalf("expected voice tracks scoped to the merge episode, got %+v (%v)", tracks, err)
+	}
+}
+
+func TestVoiceOverService_RefundsWhenSynthesisFails(t *testing.T) {
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.AsyncTask{}, &models.AIServiceConfig{}, &models.Character{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	log := logger.NewLogger(true)
+
+	// 第一句合成成功，第二句失败
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write([]byte("ID3"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"boom"}`))
+	}))
+	defer server.Close()
+
+	user := models.User{Email: "refund@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 10}
+	db.Create(&user)
+	db.Create(&models.AIServiceConfig{ServiceType: "audio", Provider: "openai", Name: "tts", BaseURL: server.URL, APIKey: "key",
+		Model: models.ModelField{"tts-1"}, CreditCost: 3, IsDefault: true, IsActive: true})
+
+	episode := seedTimelineEpisode(t, db, user.ID)
+	db.Model(&models.Storyboard{}).Where("episode_id = ?", episode.ID).Update("dialogue", "旁白：开始\n旁白：结束")
+
+	cfg := &config.Config{Storage: config.StorageConfig{LocalPath: t.TempDir()}}
+	taskService := NewTaskService(db, log, NewTaskEventHub(), nil)
+	svc := NewVoiceOverService(db, cfg, NewAIService(db, cfg, log), taskService, &capturingDispatcher{}, log)
+	taskID, err := svc.GenerateEpisodeVoiceOver(user.ID, episode.ID, &GenerateVoiceOverRequest{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	payload := VoiceOverJobPayload{UserID: user.ID, TaskID: taskID, EpisodeID: episode.ID}
+
+	// 服务商 5xx 在还有重试次数时交给任务总线重试，任务回到排队状态
+	policy := NewJobRetryPolicies(config.JobRetryConfig{}).ForJob(JobTypeVoiceOver)
+	if err := svc.ProcessVoiceOver(withJobAttempt(context.Background(), 1, policy), payload); err == nil {
+		t.Fatal("expected the transient failure to be returned for retry")
+	}
+	if task, _ := taskService.GetTask(taskID); task.Status != "pending" {
+		t.Fatalf("expected task to wait for retry, got %s", task.Status)
+	}
+
+	if err := svc.ProcessVoiceOver(withJobAttempt(context.Background(), policy.MaxAttempts, policy), payload); err == nil {
+		t.Fatal("expected the exhausted transient failure to be returned for dead-lettering")
+	}
+	task, _ := taskService.GetTask(taskID)
+	if task.Status != "failed" {
+		t.Fatalf("expected failed task, got %s", task.Status)
+	}
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.Credits != 10 {
+		t.Fatalf("expected every reservation refunded, got %d", reloaded.Credits)
+	}
+	var count int64
+	db.Model(&models.Asset{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no assets left behind, got %d", count)
+	}
+}
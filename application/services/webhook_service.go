@@ -0,0 +1,572 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// webhook 事件类型
+const (
+	WebhookEventImageCompleted = "image_generation.completed"
+	WebhookEventImageFailed    = "image_generation.failed"
+	WebhookEventVideoCompleted = "video_generation.completed"
+	WebhookEventVideoFailed    = "video_generation.failed"
+	WebhookEventMergeCompleted = "video_merge.completed"
+	WebhookEventMergeFailed    = "video_merge.failed"
+	WebhookEventTaskCompleted  = "task.completed"
+	WebhookEventTaskFailed     = "task.failed"
+	WebhookEventCreditsLow     = "credits.low"
+)
+
+var webhookEventTypes = map[string]bool{
+	WebhookEventImageCompleted: true,
+	WebhookEventImageFailed:    true,
+	WebhookEventVideoCompleted: true,
+	WebhookEventVideoFailed:    true,
+	WebhookEventMergeCompleted: true,
+	WebhookEventMergeFailed:    true,
+	WebhookEventTaskCompleted:  true,
+	WebhookEventTaskFailed:     true,
+	WebhookEventCreditsLow:     true,
+	"*":                        true,
+}
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+
+	webhookRequestTimeout = 15 * time.Second
+	webhookDialTimeout    = 10 * time.Second
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL       = errors.New("webhook url must be an absolute http(s) url")
+	ErrInvalidWebhookEvent     = errors.New("unsupported webhook event")
+	ErrWebhookAddressBlocked   = errors.New("webhook url resolves to a loopback, private or link-local address")
+	errWebhookRedirect         = errors.New("webhook endpoint redirects are not followed")
+)
+
+// WebhookService 管理用户注册的 webhook，并签名投递生命周期事件
+type WebhookService struct {
+	db         *gorm.DB
+	log        *logger.Logger
+	dispatcher JobDispatcher
+	runner     *TaskRunner
+	client     *http.Client
+}
+
+func NewWebhookService(db *gorm.DB, dispatcher JobDispatcher, log *logger.Logger) *WebhookService {
+	return &WebhookService{
+		db:         db,
+		log:        log,
+		dispatcher: dispatcher,
+		runner:     NewTaskRunner(log, 4),
+		client:     newWebhookHTTPClient(),
+	}
+}
+
+// newWebhookHTTPClient 投递地址由用户填写，连接时逐个校验实际拨号的 IP（包括 DNS 重绑定后的解析结果），
+// 拒绝回环、内网、链路本地等地址，且不跟随重定向、不走环境代理
+func newWebhookHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: webhookDialTimeout, Control: webhookDialControl}
+	return &http.Client{
+		Timeout: webhookRequestTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          20,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return errWebhookRedirect
+		},
+	}
+}
+
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicWebhookIP(ip) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+	}
+	return nil
+}
+
+// webhookBlockedNets 标准库未归类但同样不可从公网访问的地址段：本网络、运营商级 NAT、IETF 协议分配、基准测试、保留地址，
+// 以及可经 NAT64 网关转到任意 IPv4（包括回环）的转换前缀
+var webhookBlockedNets = []net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+	{IP: net.IPv4(192, 0, 0, 0), Mask: net.CIDRMask(24, 32)},
+	{IP: net.IPv4(198, 18, 0, 0), Mask: net.CIDRMask(15, 32)},
+	{IP: net.IPv4(240, 0, 0, 0), Mask: net.CIDRMask(4, 32)},
+	{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)},
+	{IP: net.ParseIP("64:ff9b:1::"), Mask: net.CIDRMask(48, 128)},
+}
+
+// webhook6to4Net 6to4 地址在第 2~5 字节携带 IPv4
+var webhook6to4Net = net.IPNet{IP: net.ParseIP("2002::"), Mask: net.CIDRMask(16, 128)}
+
+func isPublicWebhookIP(ip net.IP) bool {
+	if !isPublicWebhookAddr(ip) {
+		return false
+	}
+	if embedded := embeddedWebhookIPv4(ip); embedded != nil {
+		return isPublicWebhookAddr(embedded)
+	}
+	return true
+}
+
+func isPublicWebhookAddr(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, blocked := range webhookBlockedNets {
+		if blocked.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// embeddedWebhookIPv4 取出 IPv6 地址中内嵌的 IPv4：IPv4 兼容地址（::/96）和 6to4（2002::/16）；
+// IPv4 映射地址由 To4 直接按 IPv4 处理
+func embeddedWebhookIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return nil
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return nil
+	}
+	if webhook6to4Net.Contains(ip16) {
+		return net.IPv4(ip16[2], ip16[3], ip16[4], ip16[5])
+	}
+	for _, b := range ip16[:12] {
+		if b != 0 {
+			return nil
+		}
+	}
+	return net.IPv4(ip16[12], ip16[13], ip16[14], ip16[15])
+}
+
+// WebhookEmitter 业务代码触发生命周期事件的入口，由 WebhookService 实现
+type WebhookEmitter interface {
+	Emit(userID uint, event string, data interface{})
+}
+
+// emitWebhook 未注入 WebhookEmitter 时事件被丢弃
+func emitWebhook(webhooks WebhookEmitter, userID uint, event string, data interface{}) {
+	if webhooks != nil {
+		webhooks.Emit(userID, event, data)
+	}
+}
+
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+type UpdateWebhookRequest struct {
+	URL         *string   `json:"url"`
+	Events      *[]string `json:"events"`
+	Description *string   `json:"description"`
+	IsActive    *bool     `json:"is_active"`
+}
+
+// WebhookEventEnvelope 投递给接收方的事件体
+type WebhookEventEnvelope struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// CreateWebhook 创建 webhook，签名密钥只在创建和轮换时返回
+func (s *WebhookService) CreateWebhook(userID uint, req *CreateWebhookRequest) (*models.Webhook, string, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, "", err
+	}
+	if err := validateWebhookEvents(req.Events); err != nil {
+		return nil, "", err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	webhook := &models.Webhook{
+		UserID:      userID,
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      datatypes.JSONSlice[string](req.Events),
+		Description: req.Description,
+		IsActive:    true,
+	}
+	if err := s.db.Create(webhook).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return webhook, secret, nil
+}
+
+func (s *WebhookService) ListWebhooks(userID uint) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetWebhook(userID, webhookID uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := s.db.Where("id = ? AND user_id = ?", webhookID, userID).First(&webhook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookService) UpdateWebhook(userID, webhookID uint, req *UpdateWebhookRequest) (*models.Webhook, error) {
+	webhook, err := s.GetWebhook(userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return nil, err
+		}
+		updates["url"] = *req.URL
+	}
+	if req.Events != nil {
+		if err := validateWebhookEvents(*req.Events); err != nil {
+			return nil, err
+		}
+		updates["events"] = datatypes.JSONSlice[string](*req.Events)
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+
+	if len(updates) > 0 {
+		if err := s.db.Model(webhook).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update webhook: %w", err)
+		}
+	}
+	return s.GetWebhook(userID, webhookID)
+}
+
+func (s *WebhookService) DeleteWebhook(userID, webhookID uint) error {
+	webhook, err := s.GetWebhook(userID, webhookID)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(webhook).Error
+}
+
+// RotateSecret 重新生成签名密钥，旧密钥立即失效
+func (s *WebhookService) RotateSecret(userID, webhookID uint) (string, error) {
+	webhook, err := s.GetWebhook(userID, webhookID)
+	if err != nil {
+		return "", err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Model(webhook).Update("secret", secret).Error; err != nil {
+		return "", fmt.Errorf("failed to rotate webhook secret: %w", err)
+	}
+	return secret, nil
+}
+
+func (s *WebhookService) ListDeliveries(userID, webhookID uint, page, pageSize int) ([]models.WebhookDelivery, int64, error) {
+	if _, err := s.GetWebhook(userID, webhookID); err != nil {
+		return nil, 0, err
+	}
+	page, pageSize = normalizePagination(page, pageSize)
+
+	query := s.db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+func (s *WebhookService) GetDelivery(userID, deliveryID uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := s.db.Where("id = ? AND user_id = ?", deliveryID, userID).First(&delivery).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ReplayDelivery 重新投递一条记录，事件 ID 与内容保持不变，接收方可据此去重
+func (s *WebhookService) ReplayDelivery(userID, deliveryID uint) (*models.WebhookDelivery, error) {
+	delivery, err := s.GetDelivery(userID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(delivery).Updates(map[string]interface{}{
+		"status":    models.WebhookDeliveryPending,
+		"error_msg": nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to reset webhook delivery: %w", err)
+	}
+	s.enqueueDelivery(delivery.ID)
+	return s.GetDelivery(userID, deliveryID)
+}
+
+// Emit 为订阅了该事件的 webhook 生成投递记录并交给任务队列发送
+func (s *WebhookService) Emit(userID uint, event string, data interface{}) {
+	if userID == 0 {
+		return
+	}
+
+	var webhooks []models.Webhook
+	if err := s.db.Where("user_id = ? AND is_active = ?", userID, true).Find(&webhooks).Error; err != nil {
+		s.log.Errorw("Failed to load webhooks", "error", err, "user_id", userID, "event", event)
+		return
+	}
+
+	var envelope *WebhookEventEnvelope
+	var body []byte
+	for i := range webhooks {
+		if !webhooks[i].Subscribes(event) {
+			continue
+		}
+		if envelope == nil {
+			envelope = &WebhookEventEnvelope{ID: uuid.New().String(), Type: event, CreatedAt: time.Now(), Data: data}
+			var err error
+			if body, err = json.Marshal(envelope); err != nil {
+				s.log.Errorw("Failed to marshal webhook event", "error", err, "event", event)
+				return
+			}
+		}
+
+		delivery := models.WebhookDelivery{
+			WebhookID: webhooks[i].ID,
+			UserID:    userID,
+			EventID:   envelope.ID,
+			Event:     event,
+			Payload:   string(body),
+			Status:    models.WebhookDeliveryPending,
+		}
+		if err := s.db.Create(&delivery).Error; err != nil {
+			s.log.Errorw("Failed to create webhook delivery", "error", err, "webhook_id", webhooks[i].ID, "event", event)
+			continue
+		}
+		s.enqueueDelivery(delivery.ID)
+	}
+}
+
+func (s *WebhookService) enqueueDelivery(deliveryID uint) {
+	if err := s.dispatchDelivery(deliveryID); err != nil {
+		s.log.Warnw("Failed to dispatch webhook delivery through task bus, fallback to local runner", "error", err, "delivery_id", deliveryID)
+		s.runner.Submit("webhook.deliver", func() {
+			_ = s.ProcessDelivery(context.Background(), deliveryID)
+		})
+	}
+}
+
+func (s *WebhookService) dispatchDelivery(deliveryID uint) error {
+	if s.dispatcher == nil {
+		return fmt.Errorf("task dispatcher not configured")
+	}
+
+	body, err := json.Marshal(WebhookDeliveryJobPayload{DeliveryID: deliveryID})
+	if err != nil {
+		return fmt.Errorf("marshal webhook delivery payload: %w", err)
+	}
+
+	return s.dispatcher.Dispatch(AsyncJob{
+		Type:    JobTypeWebhookDelivery,
+		Payload: body,
+	})
+}
+
+// ProcessDelivery 发送一次投递；失败且任务队列还会重试时返回错误，否则记录最终失败并返回 nil
+func (s *WebhookService) ProcessDelivery(ctx context.Context, deliveryID uint) error {
+	var delivery models.WebhookDelivery
+	if err := s.db.First(&delivery, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if delivery.Status == models.WebhookDeliverySucceeded {
+		return nil
+	}
+
+	var webhook models.Webhook
+	if err := s.db.Where("id = ?", delivery.WebhookID).First(&webhook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.finishDelivery(&delivery, nil, errors.New("webhook has been deleted"))
+			return nil
+		}
+		return err
+	}
+	if !webhook.IsActive {
+		s.finishDelivery(&delivery, nil, errors.New("webhook is disabled"))
+		return nil
+	}
+
+	statusCode, sendErr := s.send(ctx, &webhook, &delivery)
+	if sendErr == nil {
+		s.finishDelivery(&delivery, statusCode, nil)
+		return nil
+	}
+
+	if willRetryJob(ctx, sendErr) {
+		msg := sendErr.Error()
+		s.db.Model(&delivery).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"response_status": statusCode,
+			"error_msg":       &msg,
+		})
+		s.log.Warnw("Webhook delivery failed, will retry", "delivery_id", delivery.ID, "webhook_id", webhook.ID, "error", sendErr)
+		return sendErr
+	}
+
+	s.finishDelivery(&delivery, statusCode, sendErr)
+	return nil
+}
+
+func (s *WebhookService) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (*int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookRequestTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build webhook request: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "xinggen-drama-webhook/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.EventID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// 地址被拦截或要求重定向时重试也不会成功，只保留原因，不再按网络错误重试
+		for _, refused := range []error{ErrWebhookAddressBlocked, errWebhookRedirect} {
+			if errors.Is(err, refused) {
+				return nil, fmt.Errorf("send webhook: %w", refused)
+			}
+		}
+		return nil, MarkRetryable(fmt.Errorf("send webhook: %w", err))
+	}
+	// 接收方的响应内容不保存也不返回给用户，只记录状态码
+	resp.Body.Close()
+
+	statusCode := resp.StatusCode
+	if statusCode < 200 || statusCode >= 300 {
+		// 接收方的任何非 2xx 响应都按临时失败处理，由退避重试兜底
+		return &statusCode, MarkRetryable(fmt.Errorf("webhook endpoint returned status %d", statusCode))
+	}
+	return &statusCode, nil
+}
+
+func (s *WebhookService) finishDelivery(delivery *models.WebhookDelivery, statusCode *int, sendErr error) {
+	updates := map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"response_status": statusCode,
+	}
+	if sendErr == nil {
+		now := time.Now()
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["error_msg"] = nil
+		updates["delivered_at"] = &now
+	} else {
+		msg := sendErr.Error()
+		updates["status"] = models.WebhookDeliveryFailed
+		updates["error_msg"] = &msg
+		s.log.Errorw("Webhook delivery failed", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "error", sendErr)
+	}
+	if err := s.db.Model(delivery).Updates(updates).Error; err != nil {
+		s.log.Errorw("Failed to update webhook delivery", "error", err, "delivery_id", delivery.ID)
+	}
+}
+
+// SignWebhookPayload 生成签名头：t=<unix 秒>,v1=<hex(HMAC-SHA256(secret, "<t>.<body>"))>
+// 接收方按相同方式计算并比较 v1，同时校验时间戳防止重放
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []string) error {
+	for _, event := range events {
+		if !webhookEventTypes[event] {
+			return fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, event)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+	"github.com/drama-generator/backend/pkg/config"
+	"github.com/drama-generator/backend/pkg/logger"
+	"gorm.io/gorm"
+)
+
+func newWebhookServiceTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newTimelineServiceTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.CreditTransaction{}, &models.Webhook{}, &models.WebhookDelivery{}); err != nil {
+		t.Fatalf("failed to migrate db: %v", err)
+	}
+	return db
+}
+
+func TestWebhookService_DeliversSignedEventToSubscribedWebhooks(t *testing.T) {
+	db := newWebhookServiceTestDB(t)
+	dispatcher := &capturingDispatcher{}
+	svc := NewWebhookService(db, dispatcher, logger.NewLogger(true))
+
+	var gotBody []byte
+	var gotSignature, gotEvent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSignature = r.Header.Get(WebhookSignatureHeader)
+		gotEvent = r.Header.Get(WebhookEventHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	// 测试服务器监听回环地址，使用其自带客户端绕过地址拦截
+	svc.client = server.Client()
+
+	subscribed, secret, err := svc.CreateWebhook(1, &CreateWebhookRequest{URL: server.URL, Events: []string{WebhookEventVideoCompleted}})
+	if err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	if _, _, err := svc.CreateWebhook(1, &CreateWebhookRequest{URL: server.URL, Events: []string{WebhookEventImageFailed}}); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	if _, _, err := svc.CreateWebhook(1, &CreateWebhookRequest{URL: server.URL, Events: []string{"unknown.event"}}); err == nil {
+		t.Fatalf("expected unknown event to be rejected")
+	}
+
+	svc.Emit(1, WebhookEventVideoCompleted, map[string]interface{}{"id": 9})
+
+	var deliveries []models.WebhookDelivery
+	db.Find(&deliveries)
+	if len(deliveries) != 1 || deliveries[0].WebhookID != subscribed.ID {
+		t.Fatalf("expected one delivery for the subscribed webhook, got %+v", deliveries)
+	}
+	if dispatcher.job.Type != JobTypeWebhookDelivery {
+		t.Fatalf("expected delivery to be dispatched, got %+v", dispatcher.job)
+	}
+
+	if err := svc.ProcessDelivery(context.Background(), deliveries[0].ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if gotEvent != WebhookEventVideoCompleted {
+		t.Fatalf("unexpected event header %q", gotEvent)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(gotSignature, "t="), ",", 2)
+	timestamp, _ := strconv.ParseInt(parts[0], 10, 64)
+	if gotSignature != SignWebhookPayload(secret, timestamp, gotBody) {
+		t.Fatalf("signature mismatch: %q", gotSignature)
+	}
+	var envelope WebhookEventEnvelope
+	if err := json.Unmarshal(gotBody, &envelope); err != nil || envelope.Type != WebhookEventVideoCompleted || envelope.ID != deliveries[0].EventID {
+		t.Fatalf("unexpected body %s (%v)", gotBody, err)
+	}
+
+	var reloaded models.WebhookDelivery
+	db.First(&reloaded, deliveries[0].ID)
+	if reloaded.Status != models.WebhookDeliverySucceeded || reloaded.Attempts != 1 || reloaded.ResponseStatus == nil || *reloaded.ResponseStatus != http.StatusNoContent {
+		t.Fatalf("unexpected delivery after success: %+v", reloaded)
+	}
+}
+
+func TestWebhookService_RetriesFailedDeliveryAndReplays(t *testing.T) {
+	db := newWebhookServiceTestDB(t)
+	svc := NewWebhookService(db, &capturingDispatcher{}, logger.NewLogger(true))
+
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	svc.client = server.Client()
+
+	if _, _, err := svc.CreateWebhook(2, &CreateWebhookRequest{URL: server.URL}); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	svc.Emit(2, WebhookEventTaskFailed, map[string]string{"task_id": "t1"})
+
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+
+	policy := NewJobRetryPolicies(config.JobRetryConfig{}).ForJob(JobTypeWebhookDelivery)
+	if err := svc.ProcessDelivery(withJobAttempt(context.Background(), 1, policy), delivery.ID); err == nil {
+		t.Fatalf("expected error so the job bus retries")
+	}
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != 1 || delivery.ErrorMsg == nil {
+		t.Fatalf("unexpected delivery after retryable failure: %+v", delivery)
+	}
+
+	if err := svc.ProcessDelivery(withJobAttempt(context.Background(), policy.MaxAttempts, policy), delivery.ID); err != nil {
+		t.Fatalf("expected final failure to be recorded without error, got %v", err)
+	}
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != 2 {
+		t.Fatalf("unexpected delivery after final failure: %+v", delivery)
+	}
+
+	if _, err := svc.ReplayDelivery(3, delivery.ID); err != ErrWebhookDeliveryNotFound {
+		t.Fatalf("expected other users not to replay the delivery, got %v", err)
+	}
+	status = http.StatusOK
+	if _, err := svc.ReplayDelivery(2, delivery.ID); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if err := svc.ProcessDelivery(context.Background(), delivery.ID); err != nil {
+		t.Fatalf("expected replay to succeed, got %v", err)
+	}
+	db.First(&delivery, delivery.ID)
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.ErrorMsg != nil {
+		t.Fatalf("unexpected delivery after replay: %+v", delivery)
+	}
+}
+
+func TestWebhookService_RefusesPrivateAddressesAndRedirects(t *testing.T) {
+	db := newWebhookServiceTestDB(t)
+	svc := NewWebhookService(db, &capturingDispatcher{}, logger.NewLogger(true))
+
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer server.Close()
+
+	if _, _, err := svc.CreateWebhook(4, &CreateWebhookRequest{URL: server.URL}); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+	svc.Emit(4, WebhookEventTaskFailed, map[string]string{"task_id": "t1"})
+
+	var delivery models.WebhookDelivery
+	db.First(&delivery)
+	policy := NewJobRetryPolicies(config.JobRetryConfig{}).ForJob(JobTypeWebhookDelivery)
+	if err := svc.ProcessDelivery(withJobAttempt(context.Background(), 1, policy), delivery.ID); err != nil {
+		t.Fatalf("expected blocked address not to be retried, got %v", err)
+	}
+	db.First(&delivery, delivery.ID)
+	if hits != 0 || delivery.Status != models.WebhookDeliveryFailed || delivery.ErrorMsg == nil || !strings.Contains(*delivery.ErrorMsg, ErrWebhookAddressBlocked.Error()) {
+		t.Fatalf("expected loopback delivery to be refused before connecting, got %+v (hits=%d)", delivery, hits)
+	}
+
+	// 接收方返回重定向时不跟随
+	client := newWebhookHTTPClient()
+	client.Transport = server.Client().Transport
+	svc.client = client
+	if _, err := svc.ReplayDelivery(4, delivery.ID); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if err := svc.ProcessDelivery(withJobAttempt(context.Background(), 1, policy), delivery.ID); err != nil {
+		t.Fatalf("expected redirect not to be retried, got %v", err)
+	}
+	db.First(&delivery, delivery.ID)
+	if hits != 1 || delivery.Status != models.WebhookDeliveryFailed || delivery.ErrorMsg == nil || !strings.Contains(*delivery.ErrorMsg, errWebhookRedirect.Error()) {
+		t.Fatalf("expected redirect to be refused, got %+v (hits=%d)", delivery, hits)
+	}
+
+	for _, host := range []string{"10.0.0.8", "192.168.1.1", "172.16.0.1", "169.254.169.254", "0.0.0.0", "::1", "fe80::1", "fd00::1",
+		"100.64.0.1", "100.127.255.254", "192.0.0.170", "198.18.0.1", "198.19.255.254", "240.0.0.1", "255.255.255.255", "::ffff:100.64.0.1"} {
+		if err := webhookDialControl("tcp", net.JoinHostPort(host, "443"), nil); !errors.Is(err, ErrWebhookAddressBlocked) {
+			t.Fatalf("expected %s to be blocked, got %v", host, err)
+		}
+	}
+	for _, host := range []string{"93.184.216.34", "100.128.0.1", "198.20.0.1"} {
+		if err := webhookDialControl("tcp", net.JoinHostPort(host, "443"), nil); err != nil {
+			t.Fatalf("expected public address %s to be allowed, got %v", host, err)
+		}
+	}
+}
+
+func TestIsPublicWebhookIP(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"0.1.2.3", false},
+		{"0.255.255.255", false},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::5db8:d822", false},
+		{"64:ff9b:1::a00:1", false},
+		{"::ffff:0.1.2.3", false},
+		{"::ffff:127.0.0.1", false},
+		{"::127.0.0.1", false},
+		{"::10.0.0.1", false},
+		{"2002:7f00:1::1", false},
+		{"2002:a9fe:a9fe::1", false},
+		{"1.0.0.1", true},
+		{"::ffff:93.184.216.34", true},
+		{"2002:5db8:d822::1", true},
+		{"2606:4700::1111", true},
+	}
+	for _, tt := range tests {
+		if got := isPublicWebhookIP(net.ParseIP(tt.host)); got != tt.want {
+			t.Errorf("isPublicWebhookIP(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestBillingService_EmitsLowCreditsOnceWhenCrossingThreshold(t *testing.T) {
+	db := newWebhookServiceTestDB(t)
+	log := logger.NewLogger(true)
+	webhooks := NewWebhookService(db, &capturingDispatcher{}, log)
+
+	user := models.User{Email: "low@example.com", PasswordHash: "x", Role: models.RoleUser, Status: models.UserStatusActive, Credits: 30}
+	db.Create(&user)
+	if _, _, err := webhooks.CreateWebhook(user.ID, &CreateWebhookRequest{URL: "https://example.com/hook", Events: []string{WebhookEventCreditsLow}}); err != nil {
+		t.Fatalf("failed to create webhook: %v", err)
+	}
+
+	billing := NewBillingService(db, &config.Config{Billing: config.BillingConfig{LowCreditThreshold: 20}}, webhooks, log)
+	for i := 0; i < 3; i++ {
+		if _, err := billing.ReserveAI(user.ID, "image", "m", 6, "image"); err != nil {
+			t.Fatalf("failed to reserve: %v", err)
+		}
+	}
+
+	var deliveries []models.WebhookDelivery
+	db.Where("event = ?", WebhookEventCreditsLow).Find(&deliveries)
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Payload, `"credits":18`) {
+		t.Fatalf("expected a single credits.low event at 18 credits, got %+v", deliveries)
+	}
+}
@@ -10,7 +10,7 @@ import (
 type AIServiceConfig struct {
 	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID        uint       `gorm:"not null;default:0;index" json:"user_id"`
-	ServiceType   string     `gorm:"type:varchar(50);not null" json:"service_type"` // text, image, video
+	ServiceType   string     `gorm:"type:varchar(50);not null" json:"service_type"` // text, image, video, audio, music
 	Provider      string     `gorm:"type:varchar(50)" json:"provider"`              // openai, gemini, volcengine, etc.
 	Name          string     `gorm:"type:varchar(100);not null" json:"name"`
 	BaseURL       string     `gorm:"type:varchar(255);not null" json:"base_url"`
@@ -124,3 +124,15 @@ func (m *ModelField) UnmarshalJSON(data []byte) error {
 
 	return errors.New("model field must be string or array of strings")
 }
+
+// AIResponseCache 确定性文本调用的响应缓存，按请求内容的哈希寻址
+type AIResponseCache struct {
+	CacheKey  string    `gorm:"type:varchar(64);primaryKey" json:"cache_key"`
+	Response  string    `gorm:"type:longtext;not null" json:"response"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"not null;autoCreateTime" json:"created_at"`
+}
+
+func (AIResponseCache) TableName() string {
+	return "ai_response_caches"
+}
@@ -22,6 +22,7 @@ type Asset struct {
 
 	Name         string    `gorm:"type:varchar(200);not null" json:"name"`
 	Description  *string   `gorm:"type:text" json:"description,omitempty"`
+	PromptHash   *string   `gorm:"type:varchar(64);index" json:"-"` // 生成提示词的 sha256，用于复用配乐/音效
 	Type         AssetType `gorm:"type:varchar(20);not null;index" json:"type"`
 	Category     *string   `gorm:"type:varchar(50);index" json:"category,omitempty"`
 	URL          string    `gorm:"type:varchar(1000);not null" json:"url"`
@@ -14,6 +14,7 @@ type Drama struct {
 	Description   *string        `gorm:"type:text" json:"description"`
 	Genre         *string        `gorm:"type:varchar(50)" json:"genre"`
 	Style         string         `gorm:"type:varchar(50);default:'realistic'" json:"style"`
+	Language      string         `gorm:"type:varchar(10);not null;default:''" json:"language"` // 提示词语言，为空表示跟随用户设置
 	TotalEpisodes int            `gorm:"default:1" json:"total_episodes"`
 	TotalDuration int            `gorm:"default:0" json:"total_duration"`
 	Status        string         `gorm:"type:varchar(20);default:'draft';not null" json:"status"`
@@ -46,6 +47,7 @@ type Character struct {
 	VoiceStyle      *string        `gorm:"type:varchar(200)" json:"voice_style"`
 	ImageURL        *string        `gorm:"type:varchar(500)" json:"image_url"`
 	LocalPath       *string        `gorm:"type:text" json:"local_path,omitempty"`
+	CurrentImageID  *uint          `gorm:"index" json:"current_image_id,omitempty"` // 当前使用的图片版本（image_generations.id）
 	ReferenceImages datatypes.JSON `gorm:"type:json" json:"reference_images"`
 	SeedValue       *string        `gorm:"type:varchar(100)" json:"seed_value"`
 	SortOrder       int            `gorm:"default:0" json:"sort_order"`
@@ -115,6 +117,7 @@ type Storyboard struct {
 	Description      *string        `gorm:"type:text" json:"description"`
 	Duration         int            `gorm:"default:5" json:"duration"`
 	ComposedImage    *string        `gorm:"type:text" json:"composed_image"`
+	CurrentImageID   *uint          `gorm:"index" json:"current_image_id,omitempty"` // 当前使用的图片版本（image_generations.id）
 	VideoURL         *string        `gorm:"type:text" json:"video_url"`
 	Status           string         `gorm:"type:varchar(20);default:'pending'" json:"status"`
 	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
@@ -142,6 +145,7 @@ type Scene struct {
 	StoryboardCount int            `gorm:"default:1" json:"storyboard_count"`
 	ImageURL        *string        `gorm:"type:varchar(500)" json:"image_url"`
 	LocalPath       *string        `gorm:"type:text" json:"local_path"`
+	CurrentImageID  *uint          `gorm:"index" json:"current_image_id,omitempty"`          // 当前使用的图片版本（image_generations.id）
 	Status          string         `gorm:"type:varchar(20);default:'pending'" json:"status"` // pending, generated, failed
 	CreatedAt       time.Time      `gorm:"not null;autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time      `gorm:"not null;autoUpdateTime" json:"updated_at"`
@@ -166,6 +170,7 @@ type Prop struct {
 	Prompt          *string        `gorm:"type:text" json:"prompt"` // AI Image prompt
 	ImageURL        *string        `gorm:"type:varchar(500)" json:"image_url"`
 	LocalPath       *string        `gorm:"type:text" json:"local_path,omitempty"`
+	CurrentImageID  *uint          `gorm:"index" json:"current_image_id,omitempty"` // 当前使用的图片版本（image_generations.id）
 	ReferenceImages datatypes.JSON `gorm:"type:json" json:"reference_images"`
 	CreatedAt       time.Time      `gorm:"not null;autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time      `gorm:"not null;autoUpdateTime" json:"updated_at"`
@@ -29,13 +29,22 @@ type ImageGeneration struct {
 	ImageURL        *string               `gorm:"type:text" json:"image_url,omitempty"`
 	MinioURL        *string               `gorm:"type:text" json:"minio_url,omitempty"`
 	LocalPath       *string               `gorm:"type:text" json:"local_path,omitempty"`
+	OriginalPath    *string               `gorm:"type:text" json:"-"`                       // 放大、裁切等处理前的原图，保存在不对外提供访问的目录
+	DeliveryPath    *string               `gorm:"type:text" json:"delivery_path,omitempty"` // 加水印后的交付图片，local_path 保持无水印
+	ThumbnailURL    *string               `gorm:"type:varchar(1000)" json:"thumbnail_url,omitempty"`
 	Status          ImageGenerationStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
 	TaskID          *string               `gorm:"size:200" json:"task_id,omitempty"`
 	ErrorMsg        *string               `gorm:"type:text" json:"error_msg,omitempty"`
 	BillingRefID    *string               `gorm:"type:varchar(64);index" json:"billing_ref_id,omitempty"`
+	AIConfigID      *uint                 `gorm:"index" json:"ai_config_id,omitempty"` // 提交异步任务的 AI 配置，状态查询必须使用同一配置
 	Width           *int                  `json:"width,omitempty"`
 	Height          *int                  `json:"height,omitempty"`
 	ReferenceImages datatypes.JSON        `gorm:"type:json" json:"reference_images,omitempty"`
+	ParentID        *uint                 `gorm:"index" json:"parent_id,omitempty"`     // 编辑、扩图、变体的源图片，或单格所属的拼图
+	Operation       *string               `gorm:"size:20" json:"operation,omitempty"`   // inpaint, outpaint, variation, panel, composite
+	MaskPath        *string               `gorm:"type:text" json:"mask_path,omitempty"` // 局部重绘蒙版的本地路径
+	AspectRatio     *string               `gorm:"size:20" json:"aspect_ratio,omitempty"`
+	Composite       datatypes.JSON        `gorm:"type:json" json:"composite,omitempty"` // 多格拼图的布局、间距和说明文字设置
 	CreatedAt       time.Time             `json:"created_at"`
 	UpdatedAt       time.Time             `json:"updated_at"`
 	CompletedAt     *time.Time            `json:"completed_at,omitempty"`
@@ -58,6 +67,7 @@ const (
 	ImageStatusProcessing ImageGenerationStatus = "processing"
 	ImageStatusCompleted  ImageGenerationStatus = "completed"
 	ImageStatusFailed     ImageGenerationStatus = "failed"
+	ImageStatusCancelled  ImageGenerationStatus = "cancelled"
 )
 
 type ImageProvider string
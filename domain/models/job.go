@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobStatusPending JobStatus = "pending"
+	JobStatusRunning JobStatus = "running"
+	JobStatusDead    JobStatus = "dead"
+)
+
+// Job 数据库任务队列中的任务，未启用消息队列时使用，执行成功后删除
+type Job struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Type       string     `gorm:"type:varchar(100);not null;index" json:"type"`
+	Payload    string     `gorm:"type:text" json:"payload"`
+	Status     JobStatus  `gorm:"type:varchar(20);not null;default:'pending';index:idx_jobs_status_run_at,priority:1" json:"status"`
+	Attempt    int        `gorm:"not null;default:0" json:"attempt"` // 已失败的执行次数
+	RunAt      time.Time  `gorm:"not null;index:idx_jobs_status_run_at,priority:2" json:"run_at"`
+	LeaseUntil *time.Time `gorm:"index" json:"lease_until,omitempty"` // 租约到期仍未完成的任务会被重新领取
+	LockedBy   string     `gorm:"type:varchar(64)" json:"locked_by,omitempty"`
+	LastError  *string    `gorm:"type:text" json:"last_error,omitempty"`
+	DeadAt     *time.Time `json:"dead_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
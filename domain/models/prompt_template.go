@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// PromptTemplate 可在线调整的提示词模板。每次保存生成一个新版本，同一作用域下最多一个版本生效，
+// 回滚即重新启用旧版本。UserID、DramaID 均为 0 表示平台默认；DramaID 非 0 时只对该剧生效。
+type PromptTemplate struct {
+	ID          uint                        `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateKey string                      `gorm:"type:varchar(64);not null;index:idx_prompt_templates_scope" json:"key"`
+	Language    string                      `gorm:"type:varchar(10);not null;index:idx_prompt_templates_scope" json:"language"`
+	UserID      uint                        `gorm:"not null;default:0;index:idx_prompt_templates_scope" json:"user_id"`
+	DramaID     uint                        `gorm:"not null;default:0;index:idx_prompt_templates_scope" json:"drama_id"`
+	Version     int                         `gorm:"not null" json:"version"`
+	Body        string                      `gorm:"type:text;not null" json:"body"`
+	Variables   datatypes.JSONSlice[string] `gorm:"type:json" json:"variables"` // 模板中使用的 {{变量}}
+	Note        string                      `gorm:"type:varchar(255)" json:"note,omitempty"`
+	IsActive    bool                        `gorm:"not null;default:false" json:"is_active"`
+	CreatedBy   uint                        `gorm:"not null;default:0" json:"created_by"`
+	CreatedAt   time.Time                   `gorm:"not null;autoCreateTime" json:"created_at"`
+}
+
+func (PromptTemplate) TableName() string {
+	return "prompt_templates"
+}
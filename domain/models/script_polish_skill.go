@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ScriptPolishSkillParameter 润色技能可接收的参数，在提示词中以 {{name}} 引用
+type ScriptPolishSkillParameter struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"` // string 或 enum
+	Required    bool     `json:"required"`
+	Default     string   `json:"default,omitempty"`
+	Options     []string `json:"options,omitempty"` // enum 的可选值
+}
+
+// ScriptPolishSkill 数据库中定义的剧本润色技能，与内置或文件技能同名时覆盖之
+type ScriptPolishSkill struct {
+	ID             uint                                            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name           string                                          `gorm:"type:varchar(64);not null;uniqueIndex" json:"name"`
+	Title          string                                          `gorm:"type:varchar(100);not null" json:"title"`
+	Description    string                                          `gorm:"type:varchar(500)" json:"description"`
+	Parameters     datatypes.JSONSlice[ScriptPolishSkillParameter] `gorm:"type:json" json:"parameters"`
+	SystemPromptZH string                                          `gorm:"type:text" json:"system_prompt_zh"`
+	SystemPromptEN string                                          `gorm:"type:text" json:"system_prompt_en"`
+	UserPromptZH   string                                          `gorm:"type:text" json:"user_prompt_zh"`
+	UserPromptEN   string                                          `gorm:"type:text" json:"user_prompt_en"`
+	Temperature    float64                                         `gorm:"default:0" json:"temperature"`
+	MaxTokens      int                                             `gorm:"default:0" json:"max_tokens"`
+	Disabled       bool                                            `gorm:"not null;default:false" json:"disabled"`
+	CreatedAt      time.Time                                       `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time                                       `gorm:"not null;autoUpdateTime" json:"updated_at"`
+}
+
+func (ScriptPolishSkill) TableName() string {
+	return "script_polish_skills"
+}
@@ -9,8 +9,9 @@ import (
 // AsyncTask 异步任务模型
 type AsyncTask struct {
 	ID          string         `gorm:"primaryKey;size:36" json:"id"`
+	UserID      uint           `gorm:"not null;default:0;index" json:"user_id"`
 	Type        string         `gorm:"size:50;not null;index" json:"type"`   // 任务类型：storyboard_generation
-	Status      string         `gorm:"size:20;not null;index" json:"status"` // pending, processing, completed, failed
+	Status      string         `gorm:"size:20;not null;index" json:"status"` // pending, processing, completed, failed, cancelled
 	Progress    int            `gorm:"default:0" json:"progress"`            // 0-100
 	Message     string         `gorm:"size:500" json:"message,omitempty"`    // 当前状态消息
 	Error       string         `gorm:"type:text" json:"error,omitempty"`     // 错误信息
@@ -8,6 +8,7 @@ import (
 
 type Timeline struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
+	UserID    uint           `gorm:"not null;default:0;index" json:"user_id"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -89,7 +90,8 @@ type TimelineClip struct {
 	StoryboardID *uint       `gorm:"index" json:"storyboard_id,omitempty"`
 	Storyboard   *Storyboard `gorm:"foreignKey:StoryboardID" json:"storyboard,omitempty"`
 
-	Name string `gorm:"type:varchar(200)" json:"name"`
+	Name string  `gorm:"type:varchar(200)" json:"name"`
+	Text *string `gorm:"type:text" json:"text,omitempty"` // 字幕轨道片段的文本内容
 
 	StartTime int `gorm:"not null" json:"start_time"`
 	EndTime   int `gorm:"not null" json:"end_time"`
@@ -26,6 +26,7 @@ type User struct {
 	Role         UserRole   `gorm:"type:varchar(20);not null;default:'user'" json:"role"`
 	Status       UserStatus `gorm:"type:varchar(20);not null;default:'active'" json:"status"`
 	Credits      int        `gorm:"not null;default:0" json:"credits"`
+	Language     string     `gorm:"type:varchar(10);not null;default:''" json:"language"` // 提示词语言，为空表示跟随系统默认
 	CreatedAt    time.Time  `gorm:"not null;autoCreateTime" json:"created_at"`
 	UpdatedAt    time.Time  `gorm:"not null;autoUpdateTime" json:"updated_at"`
 }
@@ -46,6 +47,10 @@ const (
 	CreditTxnAIImageRefund    CreditTransactionType = "AI_IMAGE_REFUND"
 	CreditTxnAIVideo          CreditTransactionType = "AI_VIDEO"
 	CreditTxnAIVideoRefund    CreditTransactionType = "AI_VIDEO_REFUND"
+	CreditTxnAIAudio          CreditTransactionType = "AI_AUDIO"
+	CreditTxnAIAudioRefund    CreditTransactionType = "AI_AUDIO_REFUND"
+	CreditTxnAIMusic          CreditTransactionType = "AI_MUSIC"
+	CreditTxnAIMusicRefund    CreditTransactionType = "AI_MUSIC_REFUND"
 )
 
 type CreditTransaction struct {
@@ -60,6 +65,8 @@ type CreditTransaction struct {
 	PromptTokens     *int             `gorm:"default:null" json:"prompt_tokens,omitempty"`
 	CompletionTokens *int             `gorm:"default:null" json:"completion_tokens,omitempty"`
 	TotalTokens      *int             `gorm:"default:null;index" json:"total_tokens,omitempty"`
+	AIConfigID       *uint            `gorm:"index" json:"ai_config_id,omitempty"` // 实际提供服务的 AI 配置
+	CacheHit         bool             `gorm:"not null;default:false" json:"cache_hit"` // 命中响应缓存，未实际扣费
 	CreatedAt   time.Time             `gorm:"not null;autoCreateTime" json:"created_at"`
 }
 
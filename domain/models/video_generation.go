@@ -25,6 +25,8 @@ type VideoGeneration struct {
 	Model    string `gorm:"type:varchar(100)" json:"model,omitempty"`
 
 	BillingRefID *string `gorm:"type:varchar(64);index" json:"billing_ref_id,omitempty"`
+	// AIConfigID 提交服务商任务的 AI 配置，任务状态查询必须使用同一配置
+	AIConfigID *uint `gorm:"index" json:"ai_config_id,omitempty"`
 
 	ImageGenID *uint           `gorm:"index" json:"image_gen_id,omitempty"`
 	ImageGen   ImageGeneration `gorm:"foreignKey:ImageGenID" json:"image_gen,omitempty"`
@@ -50,6 +52,8 @@ type VideoGeneration struct {
 	MinioURL  *string `gorm:"type:varchar(1000)" json:"minio_url,omitempty"`
 	LocalPath *string `gorm:"type:varchar(500)" json:"local_path,omitempty"`
 
+	ThumbnailURL *string `gorm:"type:varchar(1000)" json:"thumbnail_url,omitempty"` // 首帧缩略图
+
 	Status VideoStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
 	TaskID *string     `gorm:"type:varchar(200);index" json:"task_id,omitempty"`
 
@@ -67,6 +71,7 @@ const (
 	VideoStatusProcessing VideoStatus = "processing"
 	VideoStatusCompleted  VideoStatus = "completed"
 	VideoStatusFailed     VideoStatus = "failed"
+	VideoStatusCancelled  VideoStatus = "cancelled"
 )
 
 type VideoProvider string
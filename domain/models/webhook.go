@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Webhook 用户注册的事件回调地址
+type Webhook struct {
+	ID          uint                        `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint                        `gorm:"not null;index" json:"user_id"`
+	URL         string                      `gorm:"type:varchar(500);not null" json:"url"`
+	Secret      string                      `gorm:"type:varchar(100);not null" json:"-"` // HMAC-SHA256 签名密钥
+	Events      datatypes.JSONSlice[string] `gorm:"type:json" json:"events"`             // 订阅的事件，为空表示全部
+	Description string                      `gorm:"type:varchar(255)" json:"description,omitempty"`
+	IsActive    bool                        `gorm:"default:true" json:"is_active"`
+	CreatedAt   time.Time                   `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time                   `gorm:"not null;autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt              `gorm:"index" json:"-"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// Subscribes 是否订阅了该事件
+func (w *Webhook) Subscribes(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery webhook 投递记录
+type WebhookDelivery struct {
+	ID             uint                  `gorm:"primaryKey;autoIncrement" json:"id"`
+	WebhookID      uint                  `gorm:"not null;index" json:"webhook_id"`
+	UserID         uint                  `gorm:"not null;index" json:"user_id"`
+	EventID        string                `gorm:"type:varchar(36);not null;index" json:"event_id"`
+	Event          string                `gorm:"type:varchar(100);not null;index" json:"event"`
+	Payload        string                `gorm:"type:text;not null" json:"payload"`
+	Status         WebhookDeliveryStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Attempts       int                   `gorm:"not null;default:0" json:"attempts"`
+	ResponseStatus *int                  `json:"response_status,omitempty"`
+	ErrorMsg       *string               `gorm:"type:text" json:"error_msg,omitempty"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `gorm:"not null;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time             `gorm:"not null;autoUpdateTime" json:"updated_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
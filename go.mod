@@ -14,6 +14,7 @@ require (
 	github.com/stretchr/testify v1.9.0
 	go.uber.org/zap v1.26.0
 	golang.org/x/crypto v0.36.0
+	golang.org/x/image v0.25.0
 	gorm.io/datatypes v1.2.0
 	gorm.io/driver/mysql v1.5.2
 	gorm.io/driver/sqlite v1.6.0
@@ -54,3 +54,41 @@ WHERE e.id IS NULL`).Scan(&report.OrphanRows).Error; err != nil {
 	return report, nil
 }
 
+// asyncTaskOwnerTables 各任务类型的 resource_id 所指向的归属表
+var asyncTaskOwnerTables = []struct {
+	table string
+	types []string
+}{
+	{table: "dramas", types: []string{"character_extraction", "character_generation"}},
+	{table: "episodes", types: []string{"storyboard_generation", "prop_extraction", "background_extraction", "voiceover_generation", "episode_score"}},
+	{table: "storyboards", types: []string{"frame_prompt_generation"}},
+	{table: "props", types: []string{"prop_image_generation"}},
+	{table: "timelines", types: []string{"timeline_render"}},
+}
+
+// BackfillAsyncTaskUserID backfills async_tasks.user_id for rows created before the column existed,
+// taking the owner from the resource each task type points at. It returns the number of rows updated.
+func BackfillAsyncTaskUserID(db *gorm.DB) (int64, error) {
+	var backfilled int64
+	for _, owner := range asyncTaskOwnerTables {
+		result := db.Exec(`
+UPDATE async_tasks
+SET user_id = (
+	SELECT `+owner.table+`.user_id
+	FROM `+owner.table+`
+	WHERE `+owner.table+`.id = async_tasks.resource_id
+)
+WHERE async_tasks.user_id = 0
+  AND async_tasks.type IN ?
+  AND EXISTS (
+	SELECT 1
+	FROM `+owner.table+`
+	WHERE `+owner.table+`.id = async_tasks.resource_id
+)`, owner.types)
+		if result.Error != nil {
+			return backfilled, result.Error
+		}
+		backfilled += result.RowsAffected
+	}
+	return backfilled, nil
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/drama-generator/backend/domain/models"
@@ -81,3 +82,27 @@ func TestBackfillStoryboardUserID_ReportsMismatch(t *testing.T) {
 	require.EqualValues(t, 0, report.BackfilledRows)
 	require.EqualValues(t, 1, report.MismatchRows)
 }
+
+func TestBackfillAsyncTaskUserID_FillsOwnerFromResource(t *testing.T) {
+	db := newDataFixTestDB(t)
+	ep := seedEpisodeForUser(t, db, 42)
+
+	legacy := []models.AsyncTask{
+		{ID: "ep-task", Type: "storyboard_generation", Status: "completed", ResourceID: strconv.FormatUint(uint64(ep.ID), 10)},
+		{ID: "drama-task", Type: "character_generation", Status: "completed", ResourceID: strconv.FormatUint(uint64(ep.DramaID), 10)},
+		{ID: "orphan-task", Type: "storyboard_generation", Status: "completed", ResourceID: "9999"},
+	}
+	require.NoError(t, db.Create(&legacy).Error)
+	owned := models.AsyncTask{ID: "owned-task", UserID: 7, Type: "storyboard_generation", Status: "completed", ResourceID: strconv.FormatUint(uint64(ep.ID), 10)}
+	require.NoError(t, db.Create(&owned).Error)
+
+	backfilled, err := BackfillAsyncTaskUserID(db)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, backfilled)
+
+	for id, want := range map[string]uint{"ep-task": 42, "drama-task": 42, "orphan-task": 0, "owned-task": 7} {
+		var got models.AsyncTask
+		require.NoError(t, db.First(&got, "id = ?", id).Error)
+		require.EqualValues(t, want, got.UserID, id)
+	}
+}
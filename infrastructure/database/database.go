@@ -91,9 +91,19 @@ func AutoMigrate(db *gorm.DB) error {
 		&models.VideoGeneration{},
 		&models.VideoMerge{},
 
+		// 时间线编辑
+		&models.Timeline{},
+		&models.TimelineTrack{},
+		&models.TimelineClip{},
+		&models.ClipTransition{},
+		&models.ClipEffect{},
+
 		// AI配置
 		&models.AIServiceConfig{},
 		&models.AIServiceProvider{},
+		&models.AIResponseCache{},
+		&models.PromptTemplate{},
+		&models.ScriptPolishSkill{},
 
 		// 资源管理
 		&models.Asset{},
@@ -101,6 +111,11 @@ func AutoMigrate(db *gorm.DB) error {
 
 		// 任务管理
 		&models.AsyncTask{},
+		&models.Job{},
+
+		// 事件回调
+		&models.Webhook{},
+		&models.WebhookDelivery{},
 	}
 
 	for _, model := range modelList {
@@ -887,3 +887,38 @@ func (f *FFmpeg) generateSilence(outputPath string, duration float64) (string, e
 	f.log.Infow("Silence audio generated successfully", "output", outputPath)
 	return outputPath, nil
 }
+
+// BurnSubtitles 将字幕文件（SRT/ASS）烧录到视频画面中
+func (f *FFmpeg) BurnSubtitles(inputPath, subtitlePath, outputPath string) error {
+	f.log.Infow("Burning subtitles into video", "input", inputPath, "subtitles", subtitlePath, "output", outputPath)
+
+	outputDir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// subtitles 滤镜依赖 libass，字号按 PlayRes 288 行计算，底部留白适配竖屏
+	filter := fmt.Sprintf("subtitles=filename='%s':force_style='FontSize=16,Outline=1,Shadow=0,MarginV=24'",
+		escapeFilterPath(subtitlePath))
+
+	cmd := exec.CommandContext(context.Background(), "ffmpeg",
+		"-i", inputPath,
+		"-vf", filter,
+		"-c:v", "libx264",
+		"-preset", "fast",
+		"-crf", "23",
+		"-c:a", "copy",
+		"-movflags", "+faststart",
+		"-y",
+		outputPath,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.log.Errorw("FFmpeg subtitle burn-in failed", "error", err, "output", string(output))
+		return fmt.Errorf("ffmpeg subtitle burn-in failed: %w, output: %s", err, string(output))
+	}
+
+	f.log.Infow("Subtitles burned successfully", "output", outputPath)
+	return nil
+}
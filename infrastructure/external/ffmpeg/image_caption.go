@@ -0,0 +1,82 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImageCaption 在图片的一块区域内居中绘制的单行文字
+type ImageCaption struct {
+	Text   string
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// DrawImageCaptions 用 drawtext 在图片上绘制说明文字，渲染中文时需要指定 fontFile
+func (f *FFmpeg) DrawImageCaptions(inputPath, outputPath string, captions []ImageCaption, fontFile string) error {
+	f.log.Infow("Drawing image captions", "input", inputPath, "captions", len(captions), "output", outputPath)
+
+	// 文字写入文件再由 textfile 读取，避免转义引号和冒号
+	textFiles := make([]string, 0, len(captions))
+	defer func() { f.cleanup(textFiles) }()
+	for i, caption := range captions {
+		textFile := filepath.Join(f.tempDir, fmt.Sprintf("caption_%d_%d.txt", time.Now().UnixNano(), i))
+		if err := os.WriteFile(textFile, []byte(fitCaption(caption)), 0644); err != nil {
+			return fmt.Errorf("failed to write caption text: %w", err)
+		}
+		textFiles = append(textFiles, textFile)
+	}
+
+	cmd := exec.CommandContext(context.Background(), "ffmpeg",
+		"-i", inputPath,
+		"-vf", buildCaptionFilter(captions, textFiles, fontFile),
+		"-frames:v", "1",
+		"-y",
+		outputPath,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.log.Errorw("FFmpeg caption drawing failed", "error", err, "output", string(output))
+		return fmt.Errorf("ffmpeg caption drawing failed: %w, output: %s", err, string(output))
+	}
+
+	f.log.Infow("Image captions drawn successfully", "output", outputPath)
+	return nil
+}
+
+// buildCaptionFilter 每条文字一个 drawtext，字号取区域高度的一半，在区域内水平垂直居中
+// 说明文字来自用户输入，expansion=none 关闭 %{...} 展开，按原文绘制
+func buildCaptionFilter(captions []ImageCaption, textFiles []string, fontFile string) string {
+	filters := make([]string, 0, len(captions))
+	for i, caption := range captions {
+		drawtext := fmt.Sprintf("drawtext=textfile='%s':expansion=none:fontsize=%d:fontcolor=black:x=%d+(%d-text_w)/2:y=%d+(%d-text_h)/2",
+			escapeFilterPath(textFiles[i]), captionFontSize(caption), caption.X, caption.Width, caption.Y, caption.Height)
+		if fontFile != "" {
+			drawtext += fmt.Sprintf(":fontfile='%s'", escapeFilterPath(fontFile))
+		}
+		filters = append(filters, drawtext)
+	}
+	return strings.Join(filters, ",")
+}
+
+func captionFontSize(caption ImageCaption) int {
+	return max(caption.Height/2, 10)
+}
+
+// fitCaption 按全角字宽估算，超出区域宽度时截断并加省略号
+func fitCaption(caption ImageCaption) string {
+	text := strings.Join(strings.Fields(caption.Text), " ")
+	limit := caption.Width / captionFontSize(caption)
+	runes := []rune(text)
+	if limit <= 0 || len(runes) <= limit {
+		return text
+	}
+	return string(runes[:max(limit-1, 0)]) + "…"
+}
@@ -0,0 +1,33 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildCaptionFilterCentresTextInEachBand(t *testing.T) {
+	filter := buildCaptionFilter([]ImageCaption{
+		{Text: "他推开门", X: 16, Y: 200, Width: 300, Height: 40},
+		{Text: "雨停了", X: 332, Y: 200, Width: 300, Height: 40},
+	}, []string{"/tmp/a.txt", "/tmp/b.txt"}, "/fonts/cjk.ttf")
+
+	parts := strings.Split(filter, ",")
+	if len(parts) != 2 {
+		t.Fatalf("expected one drawtext per caption, got %s", filter)
+	}
+	if !strings.Contains(parts[1], "textfile='/tmp/b.txt':expansion=none") || !strings.Contains(parts[1], "x=332+(300-text_w)/2:y=200+(40-text_h)/2") {
+		t.Fatalf("unexpected second caption filter: %s", parts[1])
+	}
+	if !strings.Contains(parts[0], "fontsize=20") || !strings.HasSuffix(parts[0], ":fontfile='/fonts/cjk.ttf'") {
+		t.Fatalf("unexpected font settings: %s", parts[0])
+	}
+}
+
+func TestFitCaptionTruncatesToBandWidth(t *testing.T) {
+	if got := fitCaption(ImageCaption{Text: " 雨停了 ", Width: 300, Height: 40}); got != "雨停了" {
+		t.Fatalf("expected short caption kept, got %q", got)
+	}
+	if got := fitCaption(ImageCaption{Text: "他推开门走进漫长的雨夜", Width: 100, Height: 40}); got != "他推开门…" {
+		t.Fatalf("expected caption truncated, got %q", got)
+	}
+}
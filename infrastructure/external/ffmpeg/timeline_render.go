@@ -0,0 +1,567 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/domain/models"
+)
+
+// TimelineRenderOptions 时间线渲染参数
+type TimelineRenderOptions struct {
+	OutputPath string
+	Width      int    // 为0时使用时间线的分辨率，默认1920x1080
+	Height     int    // 为0时使用时间线的分辨率，默认1920x1080
+	FontFile   string // drawtext 使用的字体文件，渲染中文字幕时需要指定
+	// ResolveSource 返回片段对应的素材地址（本地路径或远程URL）
+	ResolveSource func(clip *models.TimelineClip) (string, error)
+	// OnProgress 渲染进度回调，progress 取值 0-100
+	OnProgress func(progress int, message string)
+}
+
+// renderSegment 预处理后的片段，时间单位为秒
+type renderSegment struct {
+	path     string
+	start    float64
+	duration float64
+	hasVideo bool
+	hasAudio bool
+	fadeIn   float64
+	fadeOut  float64
+}
+
+type renderText struct {
+	textFile string
+	start    float64
+	end      float64
+}
+
+// RenderTimeline 将时间线渲染为MP4
+// 视频轨道按顺序叠加到黑色画布上（order 越大越靠上），音频轨道与视频原声混音，字幕轨道以 drawtext 烧录。
+// overlay 合成下转场统一以透明度渐变实现，相邻片段时间重叠时即为交叉溶解。
+func (f *FFmpeg) RenderTimeline(ctx context.Context, timeline *models.Timeline, opts *TimelineRenderOptions) (string, error) {
+	if timeline == nil {
+		return "", fmt.Errorf("timeline is nil")
+	}
+	if opts == nil || opts.OutputPath == "" {
+		return "", fmt.Errorf("output path is required")
+	}
+	if opts.ResolveSource == nil {
+		return "", fmt.Errorf("source resolver is required")
+	}
+
+	width, height := opts.Width, opts.Height
+	if width <= 0 || height <= 0 {
+		width, height = parseResolution(timeline.Resolution)
+	}
+	fps := timeline.FPS
+	if fps <= 0 {
+		fps = 30
+	}
+
+	tracks := make([]models.TimelineTrack, len(timeline.Tracks))
+	copy(tracks, timeline.Tracks)
+	sort.SliceStable(tracks, func(i, j int) bool { return tracks[i].Order < tracks[j].Order })
+
+	totalMs := timeline.Duration
+	totalSteps := 1
+	for _, track := range tracks {
+		for _, clip := range track.Clips {
+			if clip.EndTime > totalMs {
+				totalMs = clip.EndTime
+			}
+			if track.Type != models.TrackTypeText {
+				totalSteps++
+			}
+		}
+	}
+	if totalMs <= 0 {
+		return "", fmt.Errorf("timeline is empty")
+	}
+	total := msToSeconds(totalMs)
+
+	f.log.Infow("Starting timeline render",
+		"timeline_id", timeline.ID,
+		"tracks", len(tracks),
+		"duration", total,
+		"resolution", fmt.Sprintf("%dx%d", width, height))
+
+	prefix := filepath.Join(f.tempDir, fmt.Sprintf("timeline_%d_%d", timeline.ID, time.Now().UnixNano()))
+	var tempFiles []string
+	defer func() { f.cleanup(tempFiles) }()
+
+	reportProgress := func(step int, message string) {
+		if opts.OnProgress != nil {
+			// 预处理占 0-90%，最终合成占剩余部分
+			opts.OnProgress(step*90/totalSteps, message)
+		}
+	}
+
+	var videoSegments, audioSegments []renderSegment
+	var texts []renderText
+	step := 0
+
+	for _, track := range tracks {
+		clips := make([]models.TimelineClip, len(track.Clips))
+		copy(clips, track.Clips)
+		sort.SliceStable(clips, func(i, j int) bool { return clips[i].StartTime < clips[j].StartTime })
+
+		for i := range clips {
+			clip := &clips[i]
+			if clip.Duration <= 0 {
+				continue
+			}
+
+			switch track.Type {
+			case models.TrackTypeText:
+				if track.IsMuted || clip.Text == nil || strings.TrimSpace(*clip.Text) == "" {
+					continue
+				}
+				textFile := fmt.Sprintf("%s_text_%d.txt", prefix, clip.ID)
+				if err := os.WriteFile(textFile, []byte(*clip.Text), 0644); err != nil {
+					return "", fmt.Errorf("failed to write subtitle text: %w", err)
+				}
+				tempFiles = append(tempFiles, textFile)
+				texts = append(texts, renderText{
+					textFile: textFile,
+					start:    msToSeconds(clip.StartTime),
+					end:      msToSeconds(clip.EndTime),
+				})
+
+			case models.TrackTypeVideo, models.TrackTypeAudio:
+				step++
+				src, err := opts.ResolveSource(clip)
+				if err != nil {
+					return "", fmt.Errorf("failed to resolve source for clip %d: %w", clip.ID, err)
+				}
+				if src == "" {
+					f.log.Warnw("Clip has no source, skipping", "clip_id", clip.ID, "track_id", track.ID)
+					reportProgress(step, fmt.Sprintf("跳过无素材片段 %d", clip.ID))
+					continue
+				}
+
+				seg, files, err := f.prepareTimelineClip(ctx, prefix, src, &track, clip, width, height, fps)
+				tempFiles = append(tempFiles, files...)
+				if err != nil {
+					return "", fmt.Errorf("failed to prepare clip %d: %w", clip.ID, err)
+				}
+				if track.Type == models.TrackTypeVideo {
+					videoSegments = append(videoSegments, *seg)
+				} else if seg.hasAudio {
+					audioSegments = append(audioSegments, *seg)
+				}
+				reportProgress(step, fmt.Sprintf("已处理片段 %d/%d", step, totalSteps-1))
+			}
+		}
+	}
+
+	if len(videoSegments) == 0 {
+		return "", fmt.Errorf("timeline has no renderable video clips")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.OutputPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if opts.OnProgress != nil {
+		opts.OnProgress(90, "正在合成时间线...")
+	}
+
+	args := []string{
+		"-f", "lavfi", "-i", fmt.Sprintf("color=c=black:s=%dx%d:r=%d:d=%.3f", width, height, fps, total),
+		"-f", "lavfi", "-i", fmt.Sprintf("anullsrc=channel_layout=stereo:sample_rate=44100:d=%.3f", total),
+	}
+	for _, seg := range videoSegments {
+		args = append(args, "-i", seg.path)
+	}
+	for _, seg := range audioSegments {
+		args = append(args, "-i", seg.path)
+	}
+
+	filterComplex := buildTimelineFilterGraph(videoSegments, audioSegments, texts, height, opts.FontFile)
+
+	args = append(args,
+		"-filter_complex", filterComplex,
+		"-map", "[outv]",
+		"-map", "[outa]",
+		"-t", fmt.Sprintf("%.3f", total),
+		"-r", strconv.Itoa(fps),
+		"-c:v", "libx264",
+		"-preset", "medium",
+		"-crf", "23",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-movflags", "+faststart",
+		"-y",
+		opts.OutputPath,
+	)
+
+	f.log.Infow("Running FFmpeg timeline composition", "filter", filterComplex)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.log.Errorw("FFmpeg timeline render failed", "error", err, "output", string(output))
+		return "", fmt.Errorf("ffmpeg timeline render failed: %w, output: %s", err, string(output))
+	}
+
+	if opts.OnProgress != nil {
+		opts.OnProgress(100, "渲染完成")
+	}
+
+	f.log.Infow("Timeline render completed", "timeline_id", timeline.ID, "output", opts.OutputPath)
+	return opts.OutputPath, nil
+}
+
+// prepareTimelineClip 下载并预处理单个片段：裁剪、变速、特效、缩放、音量与淡入淡出
+func (f *FFmpeg) prepareTimelineClip(ctx context.Context, prefix, src string, track *models.TimelineTrack, clip *models.TimelineClip, width, height, fps int) (*renderSegment, []string, error) {
+	var files []string
+
+	downloadPath := fmt.Sprintf("%s_src_%d%s", prefix, clip.ID, sourceExt(src, track.Type))
+	localPath, err := f.downloadVideo(src, downloadPath)
+	if err != nil {
+		return nil, files, err
+	}
+	files = append(files, localPath)
+
+	speed := 1.0
+	if clip.Speed != nil && *clip.Speed > 0 {
+		speed = *clip.Speed
+	}
+	trimStart := 0.0
+	if clip.TrimStart != nil && *clip.TrimStart > 0 {
+		trimStart = msToSeconds(*clip.TrimStart)
+	}
+	clipDuration := msToSeconds(clip.Duration)
+
+	// 片段在时间线上占用 clipDuration，对应源素材 clipDuration*speed 秒
+	sourceSpan := clipDuration * speed
+	if clip.TrimEnd != nil && *clip.TrimEnd > 0 {
+		if sourceDuration, err := f.GetVideoDuration(localPath); err == nil {
+			if limit := sourceDuration - trimStart - msToSeconds(*clip.TrimEnd); limit > 0 && limit < sourceSpan {
+				sourceSpan = limit
+			}
+		}
+	}
+
+	seg := &renderSegment{
+		start:    msToSeconds(clip.StartTime),
+		duration: clipDuration,
+		hasVideo: track.Type == models.TrackTypeVideo,
+	}
+	if clip.TransitionIn != nil && clip.InTransition.Duration > 0 {
+		seg.fadeIn = msToSeconds(clip.InTransition.Duration)
+	}
+	if clip.TransitionOut != nil && clip.OutTransition.Duration > 0 {
+		seg.fadeOut = msToSeconds(clip.OutTransition.Duration)
+	}
+
+	audioFadeIn, audioFadeOut := seg.fadeIn, seg.fadeOut
+	if clip.FadeIn != nil && msToSeconds(*clip.FadeIn) > audioFadeIn {
+		audioFadeIn = msToSeconds(*clip.FadeIn)
+	}
+	if clip.FadeOut != nil && msToSeconds(*clip.FadeOut) > audioFadeOut {
+		audioFadeOut = msToSeconds(*clip.FadeOut)
+	}
+
+	withAudio := !track.IsMuted && !clip.IsMuted && f.hasAudioStream(localPath)
+	seg.hasAudio = withAudio
+	if !seg.hasVideo && !withAudio {
+		// 静音的音频片段无需处理
+		return seg, files, nil
+	}
+
+	args := []string{
+		"-ss", fmt.Sprintf("%.3f", trimStart),
+		"-t", fmt.Sprintf("%.3f", sourceSpan),
+		"-i", localPath,
+	}
+
+	if seg.hasVideo {
+		videoFilters := []string{fmt.Sprintf("setpts=(PTS-STARTPTS)/%.4f", speed)}
+		videoFilters = append(videoFilters, buildEffectFilters(clip.Effects)...)
+		videoFilters = append(videoFilters,
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", width, height),
+			fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", width, height),
+			"setsar=1",
+			fmt.Sprintf("fps=%d", fps),
+			// 源素材不足时冻结最后一帧补齐片段时长
+			fmt.Sprintf("tpad=stop_mode=clone:stop_duration=%.3f", clipDuration),
+		)
+		args = append(args, "-filter:v", strings.Join(videoFilters, ","))
+	} else {
+		args = append(args, "-vn")
+	}
+
+	if withAudio {
+		audioFilters := []string{"asetpts=PTS-STARTPTS"}
+		audioFilters = append(audioFilters, atempoFilters(speed)...)
+		audioFilters = append(audioFilters, fmt.Sprintf("volume=%.3f", clipVolume(track, clip)))
+		if audioFadeIn > 0 {
+			audioFilters = append(audioFilters, fmt.Sprintf("afade=t=in:st=0:d=%.3f", audioFadeIn))
+		}
+		if audioFadeOut > 0 && audioFadeOut < clipDuration {
+			audioFilters = append(audioFilters, fmt.Sprintf("afade=t=out:st=%.3f:d=%.3f", clipDuration-audioFadeOut, audioFadeOut))
+		}
+		audioFilters = append(audioFilters, "apad")
+		args = append(args,
+			"-filter:a", strings.Join(audioFilters, ","),
+			"-c:a", "aac",
+			"-b:a", "128k",
+			"-ar", "44100",
+			"-ac", "2",
+		)
+	} else {
+		args = append(args, "-an")
+	}
+
+	outputPath := fmt.Sprintf("%s_seg_%d.mp4", prefix, clip.ID)
+	if !seg.hasVideo {
+		outputPath = fmt.Sprintf("%s_seg_%d.m4a", prefix, clip.ID)
+	} else {
+		args = append(args,
+			"-c:v", "libx264",
+			"-preset", "fast",
+			"-crf", "23",
+			"-pix_fmt", "yuv420p",
+		)
+	}
+
+	args = append(args,
+		"-t", fmt.Sprintf("%.3f", clipDuration),
+		"-y",
+		outputPath,
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.log.Errorw("FFmpeg clip preparation failed", "clip_id", clip.ID, "error", err, "output", string(output))
+		return nil, files, fmt.Errorf("ffmpeg clip preparation failed: %w, output: %s", err, string(output))
+	}
+	files = append(files, outputPath)
+	seg.path = outputPath
+
+	f.log.Infow("Timeline clip prepared",
+		"clip_id", clip.ID,
+		"track_type", track.Type,
+		"start", seg.start,
+		"duration", seg.duration,
+		"speed", speed,
+		"trim_start", trimStart,
+		"has_audio", seg.hasAudio)
+	return seg, files, nil
+}
+
+// buildTimelineFilterGraph 构建最终合成的 filter_complex
+// 输入约定：0 为黑色画布，1 为静音底轨，其后依次为视频片段和音频片段
+func buildTimelineFilterGraph(videoSegments, audioSegments []renderSegment, texts []renderText, height int, fontFile string) string {
+	var filters []string
+	current := "[0:v]"
+	inputIndex := 2
+
+	var audioLabels []string
+	for i, seg := range videoSegments {
+		chain := []string{"format=yuva420p"}
+		if seg.fadeIn > 0 {
+			chain = append(chain, fmt.Sprintf("fade=t=in:st=0:d=%.3f:alpha=1", seg.fadeIn))
+		}
+		if seg.fadeOut > 0 && seg.fadeOut < seg.duration {
+			chain = append(chain, fmt.Sprintf("fade=t=out:st=%.3f:d=%.3f:alpha=1", seg.duration-seg.fadeOut, seg.fadeOut))
+		}
+		chain = append(chain, fmt.Sprintf("setpts=PTS-STARTPTS+%.3f/TB", seg.start))
+		filters = append(filters, fmt.Sprintf("[%d:v]%s[v%d]", inputIndex, strings.Join(chain, ","), i))
+
+		next := fmt.Sprintf("[ov%d]", i)
+		filters = append(filters, fmt.Sprintf("%s[v%d]overlay=eof_action=pass:enable='between(t,%.3f,%.3f)'%s",
+			current, i, seg.start, seg.start+seg.duration, next))
+		current = next
+
+		if seg.hasAudio {
+			label := fmt.Sprintf("[va%d]", i)
+			filters = append(filters, fmt.Sprintf("[%d:a]%s%s", inputIndex, adelayFilter(seg.start), label))
+			audioLabels = append(audioLabels, label)
+		}
+		inputIndex++
+	}
+
+	for i, seg := range audioSegments {
+		label := fmt.Sprintf("[aa%d]", i)
+		filters = append(filters, fmt.Sprintf("[%d:a]%s%s", inputIndex, adelayFilter(seg.start), label))
+		audioLabels = append(audioLabels, label)
+		inputIndex++
+	}
+
+	videoChain := []string{"format=yuv420p"}
+	fontSize := height / 18
+	if fontSize < 16 {
+		fontSize = 16
+	}
+	// 文字来自用户输入，expansion=none 关闭 %{...} 展开，按原文绘制
+	for _, text := range texts {
+		drawtext := fmt.Sprintf("drawtext=textfile='%s':expansion=none:fontsize=%d:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=10:x=(w-text_w)/2:y=h-text_h-%d:enable='between(t,%.3f,%.3f)'",
+			escapeFilterPath(text.textFile), fontSize, height/12, text.start, text.end)
+		if fontFile != "" {
+			drawtext += fmt.Sprintf(":fontfile='%s'", escapeFilterPath(fontFile))
+		}
+		videoChain = append(videoChain, drawtext)
+	}
+	filters = append(filters, fmt.Sprintf("%s%s[outv]", current, strings.Join(videoChain, ",")))
+
+	// 静音底轨保证混音结果覆盖整条时间线
+	filters = append(filters, fmt.Sprintf("[1:a]%samix=inputs=%d:duration=first:dropout_transition=0:normalize=0[outa]",
+		strings.Join(audioLabels, ""), len(audioLabels)+1))
+
+	return strings.Join(filters, ";")
+}
+
+// buildEffectFilters 将片段特效转换为 ffmpeg 视频滤镜
+func buildEffectFilters(effects []models.ClipEffect) []string {
+	sorted := make([]models.ClipEffect, 0, len(effects))
+	for _, effect := range effects {
+		if effect.IsEnabled {
+			sorted = append(sorted, effect)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Order < sorted[j].Order })
+
+	var filters []string
+	for _, effect := range sorted {
+		switch effect.Type {
+		case models.EffectTypeBrightness:
+			filters = append(filters, fmt.Sprintf("eq=brightness=%.3f", clampFloat(configFloat(effect.Config, "value", 0.1), -1, 1)))
+		case models.EffectTypeContrast:
+			filters = append(filters, fmt.Sprintf("eq=contrast=%.3f", clampFloat(configFloat(effect.Config, "value", 1.2), -1000, 1000)))
+		case models.EffectTypeSaturation:
+			filters = append(filters, fmt.Sprintf("eq=saturation=%.3f", clampFloat(configFloat(effect.Config, "value", 1.3), 0, 3)))
+		case models.EffectTypeBlur:
+			filters = append(filters, fmt.Sprintf("gblur=sigma=%.3f", clampFloat(configFloat(effect.Config, "value", 5), 0, 100)))
+		case models.EffectTypeColor:
+			filters = append(filters, fmt.Sprintf("hue=h=%.3f:s=%.3f",
+				configFloat(effect.Config, "hue", 0),
+				clampFloat(configFloat(effect.Config, "saturation", 1), -10, 10)))
+		case models.EffectTypeFilter:
+			preset, _ := effect.Config["preset"].(string)
+			switch strings.ToLower(preset) {
+			case "grayscale", "gray":
+				filters = append(filters, "hue=s=0")
+			case "sepia":
+				filters = append(filters, "colorchannelmixer=.393:.769:.189:0:.349:.686:.168:0:.272:.534:.131")
+			case "negate", "invert":
+				filters = append(filters, "negate")
+			case "vignette":
+				filters = append(filters, "vignette")
+			}
+		}
+	}
+	return filters
+}
+
+// atempoFilters atempo 单级仅支持 0.5-2.0 倍速，超出范围时级联
+func atempoFilters(speed float64) []string {
+	if speed == 1 {
+		return nil
+	}
+	var filters []string
+	for speed > 2.0 {
+		filters = append(filters, "atempo=2.0")
+		speed /= 2.0
+	}
+	for speed < 0.5 {
+		filters = append(filters, "atempo=0.5")
+		speed /= 0.5
+	}
+	return append(filters, fmt.Sprintf("atempo=%.4f", speed))
+}
+
+func adelayFilter(start float64) string {
+	delay := int(start * 1000)
+	return fmt.Sprintf("adelay=%d|%d", delay, delay)
+}
+
+func clipVolume(track *models.TimelineTrack, clip *models.TimelineClip) float64 {
+	volume := 1.0
+	if clip.Volume != nil {
+		volume = float64(*clip.Volume) / 100
+	}
+	if track.Volume != nil {
+		volume *= float64(*track.Volume) / 100
+	}
+	return volume
+}
+
+func configFloat(config map[string]interface{}, key string, fallback float64) float64 {
+	raw, ok := config[key]
+	if !ok {
+		return fallback
+	}
+	switch v := raw.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case json.Number:
+		if n, err := v.Float64(); err == nil {
+			return n
+		}
+	case string:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func clampFloat(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func parseResolution(resolution *string) (int, int) {
+	if resolution != nil {
+		var width, height int
+		if _, err := fmt.Sscanf(strings.ToLower(*resolution), "%dx%d", &width, &height); err == nil && width > 0 && height > 0 {
+			// libx264 要求宽高为偶数
+			return width &^ 1, height &^ 1
+		}
+	}
+	return 1920, 1080
+}
+
+func sourceExt(src string, trackType models.TrackType) string {
+	path := src
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		path = path[:idx]
+	}
+	if ext := filepath.Ext(path); ext != "" && len(ext) <= 5 {
+		return ext
+	}
+	if trackType == models.TrackTypeAudio {
+		return ".mp3"
+	}
+	return ".mp4"
+}
+
+// escapeFilterPath 转义 filtergraph 中单引号包裹的路径
+func escapeFilterPath(path string) string {
+	path = filepath.ToSlash(path)
+	return strings.ReplaceAll(path, "'", `'\''`)
+}
+
+func msToSeconds(ms int) float64 {
+	return float64(ms) / 1000
+}
@@ -0,0 +1,79 @@
+package ffmpeg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/domain/models"
+)
+
+func TestBuildEffectFiltersSkipsDisabledAndKeepsOrder(t *testing.T) {
+	filters := buildEffectFilters([]models.ClipEffect{
+		{Type: models.EffectTypeBlur, IsEnabled: true, Order: 2, Config: map[string]interface{}{"value": 3.0}},
+		{Type: models.EffectTypeBrightness, IsEnabled: true, Order: 1, Config: map[string]interface{}{"value": 0.2}},
+		{Type: models.EffectTypeSaturation, IsEnabled: false, Order: 0},
+	})
+
+	if len(filters) != 2 {
+		t.Fatalf("expected 2 filters, got %v", filters)
+	}
+	if filters[0] != "eq=brightness=0.200" || filters[1] != "gblur=sigma=3.000" {
+		t.Fatalf("unexpected filters: %v", filters)
+	}
+}
+
+func TestAtempoFiltersChainsOutOfRangeSpeeds(t *testing.T) {
+	if got := atempoFilters(1); got != nil {
+		t.Fatalf("expected no atempo for normal speed, got %v", got)
+	}
+	if got := strings.Join(atempoFilters(4), ","); got != "atempo=2.0,atempo=2.0000" {
+		t.Fatalf("unexpected 4x chain: %s", got)
+	}
+	if got := strings.Join(atempoFilters(0.25), ","); got != "atempo=0.5,atempo=0.5000" {
+		t.Fatalf("unexpected 0.25x chain: %s", got)
+	}
+}
+
+func TestBuildTimelineFilterGraphMixesAudioAndBurnsText(t *testing.T) {
+	graph := buildTimelineFilterGraph(
+		[]renderSegment{
+			{path: "a.mp4", start: 0, duration: 3, hasVideo: true, hasAudio: true},
+			{path: "b.mp4", start: 2.5, duration: 3, hasVideo: true, fadeIn: 0.5},
+		},
+		[]renderSegment{{path: "bgm.m4a", start: 1, duration: 5, hasAudio: true}},
+		[]renderText{{textFile: "/tmp/line.txt", start: 0, end: 2}},
+		1080, "",
+	)
+
+	for _, want := range []string{
+		"[3:v]format=yuva420p,fade=t=in:st=0:d=0.500:alpha=1",
+		"overlay=eof_action=pass:enable='between(t,2.500,5.500)'",
+		"[2:a]adelay=0|0[va0]",
+		"[4:a]adelay=1000|1000[aa0]",
+		"textfile='/tmp/line.txt':expansion=none",
+		"amix=inputs=3",
+	} {
+		if !strings.Contains(graph, want) {
+			t.Fatalf("expected filter graph to contain %q, got %s", want, graph)
+		}
+	}
+}
+
+func TestBuildTimelineFilterGraphDrawsPercentTextLiterally(t *testing.T) {
+	textFile := filepath.Join(t.TempDir(), "line.txt")
+	if err := os.WriteFile(textFile, []byte("进度 100% %{pts}"), 0644); err != nil {
+		t.Fatalf("failed to write text file: %v", err)
+	}
+	graph := buildTimelineFilterGraph(
+		[]renderSegment{{path: "a.mp4", start: 0, duration: 3, hasVideo: true}},
+		nil,
+		[]renderText{{textFile: textFile, start: 0, end: 2}, {textFile: textFile, start: 2, end: 3}},
+		720, "",
+	)
+
+	if got := strings.Count(graph, "textfile='"+escapeFilterPath(textFile)+"':expansion=none:"); got != 2 {
+		t.Fatalf("expected every drawtext to disable expansion, got %s", graph)
+	}
+}
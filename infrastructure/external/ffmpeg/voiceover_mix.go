@@ -0,0 +1,235 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// defaultVoiceOverBaseVolume 混入配音/配乐时原视频音轨的默认音量
+	defaultVoiceOverBaseVolume = 0.35
+	defaultMusicVolume         = 0.3
+	defaultEffectVolume        = 0.8
+)
+
+// VoiceTrack 一段配音，Paths 中的音频首尾相接，从 Offset（秒）开始播放
+type VoiceTrack struct {
+	Offset float64
+	Paths  []string
+}
+
+// BackgroundTrack 背景音乐或音效，从 Offset 开始播放 Duration 秒；Loop 时循环素材补足时长
+type BackgroundTrack struct {
+	Path     string
+	Offset   float64
+	Duration float64
+	Loop     bool
+	Volume   float64 // <=0 时使用默认音量
+}
+
+type VoiceOverOptions struct {
+	VideoPath  string
+	OutputPath string
+	Tracks     []VoiceTrack
+	Music      []BackgroundTrack // 有配音时按配音压低（ducking）
+	Effects    []BackgroundTrack
+	BaseVolume float64 // 原视频音量，<=0 时使用默认值
+}
+
+// MixVoiceOver 将配音及配乐、音效混入视频音轨，画面直接复制不重新编码
+func (f *FFmpeg) MixVoiceOver(opts *VoiceOverOptions) error {
+	mix := &VoiceOverOptions{
+		VideoPath:  opts.VideoPath,
+		OutputPath: opts.OutputPath,
+		BaseVolume: opts.BaseVolume,
+	}
+	for _, track := range opts.Tracks {
+		if len(track.Paths) > 0 {
+			mix.Tracks = append(mix.Tracks, track)
+		}
+	}
+	for _, track := range opts.Music {
+		if track.Path != "" {
+			mix.Music = append(mix.Music, track)
+		}
+	}
+	for _, track := range opts.Effects {
+		if track.Path != "" {
+			mix.Effects = append(mix.Effects, track)
+		}
+	}
+	if len(mix.Tracks)+len(mix.Music)+len(mix.Effects) == 0 {
+		return fmt.Errorf("no voice tracks to mix")
+	}
+
+	f.log.Infow("Mixing voice-over into video",
+		"input", opts.VideoPath,
+		"tracks", len(mix.Tracks),
+		"music", len(mix.Music),
+		"effects", len(mix.Effects),
+		"output", opts.OutputPath)
+
+	if err := os.MkdirAll(filepath.Dir(opts.OutputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	hasBaseAudio := f.hasAudioStream(opts.VideoPath)
+	inputs, filter := buildVoiceMixFilter(mix, hasBaseAudio)
+
+	args := append([]string{"-i", opts.VideoPath}, inputs...)
+	args = append(args,
+		"-filter_complex", filter,
+		"-map", "0:v",
+		"-map", "[aout]",
+		"-c:v", "copy",
+		"-c:a", "aac",
+		"-b:a", "192k",
+		"-shortest",
+		"-movflags", "+faststart",
+		"-y",
+		opts.OutputPath,
+	)
+
+	cmd := exec.CommandContext(context.Background(), "ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		f.log.Errorw("FFmpeg voice-over mix failed", "error", err, "output", string(output))
+		return fmt.Errorf("ffmpeg voice-over mix failed: %w, output: %s", err, string(output))
+	}
+
+	f.log.Infow("Voice-over mixed successfully", "output", opts.OutputPath)
+	return nil
+}
+
+// buildVoiceMixFilter 构建混音输入参数与滤镜
+// 输入顺序：0 为视频，随后依次为各段配音、配乐、音效文件；原视频无音轨时最后一路为静音源
+func buildVoiceMixFilter(opts *VoiceOverOptions, hasBaseAudio bool) ([]string, string) {
+	baseVolume := opts.BaseVolume
+	if baseVolume <= 0 {
+		baseVolume = defaultVoiceOverBaseVolume
+	}
+
+	var inputs []string
+	var filters []string
+	input := 1
+	normalize := func(idx int) string {
+		return fmt.Sprintf("[%d:a]aresample=44100,aformat=channel_layouts=stereo", idx)
+	}
+
+	var voiceLabels []string
+	for i, track := range opts.Tracks {
+		parts := make([]string, 0, len(track.Paths))
+		for _, path := range track.Paths {
+			inputs = append(inputs, "-i", path)
+			label := fmt.Sprintf("[v%dp%d]", i, len(parts))
+			filters = append(filters, normalize(input)+label)
+			parts = append(parts, label)
+			input++
+		}
+
+		source := parts[0]
+		if len(parts) > 1 {
+			source = fmt.Sprintf("[vc%d]", i)
+			filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=0:a=1%s", strings.Join(parts, ""), len(parts), source))
+		}
+		label := fmt.Sprintf("[vo%d]", i)
+		filters = append(filters, fmt.Sprintf("%s%s%s", source, adelayFilter(track.Offset), label))
+		voiceLabels = append(voiceLabels, label)
+	}
+
+	var musicLabels []string
+	for i, track := range opts.Music {
+		if track.Loop {
+			inputs = append(inputs, "-stream_loop", "-1")
+		}
+		inputs = append(inputs, "-i", track.Path)
+		label := fmt.Sprintf("[mu%d]", i)
+		filters = append(filters, normalize(input)+backgroundFilters(track, defaultMusicVolume, true)+label)
+		musicLabels = append(musicLabels, label)
+		input++
+	}
+
+	var effectLabels []string
+	for i, track := range opts.Effects {
+		if track.Loop {
+			inputs = append(inputs, "-stream_loop", "-1")
+		}
+		inputs = append(inputs, "-i", track.Path)
+		label := fmt.Sprintf("[fx%d]", i)
+		filters = append(filters, normalize(input)+backgroundFilters(track, defaultEffectVolume, false)+label)
+		effectLabels = append(effectLabels, label)
+		input++
+	}
+
+	if hasBaseAudio {
+		filters = append(filters, fmt.Sprintf("[0:a]aresample=44100,aformat=channel_layouts=stereo,volume=%.2f[base]", baseVolume))
+	} else {
+		inputs = append(inputs, "-f", "lavfi", "-i", "anullsrc=channel_layout=stereo:sample_rate=44100")
+		filters = append(filters, fmt.Sprintf("[%d:a]anull[base]", input))
+	}
+
+	labels := []string{"[base]"}
+	voice := mixBus(&filters, voiceLabels, "[voice]")
+	music := mixBus(&filters, musicLabels, "[music]")
+	if voice != "" && music != "" {
+		// 配音作为侧链信号压低配乐，侧链补静音避免提前结束
+		filters = append(filters,
+			fmt.Sprintf("%sasplit=2[voicemix][voicekeyraw]", voice),
+			"[voicekeyraw]apad[voicekey]",
+			fmt.Sprintf("%s[voicekey]sidechaincompress=threshold=0.03:ratio=8:attack=20:release=400[ducked]", music),
+		)
+		voice, music = "[voicemix]", "[ducked]"
+	}
+	if voice != "" {
+		labels = append(labels, voice)
+	}
+	if music != "" {
+		labels = append(labels, music)
+	}
+	labels = append(labels, effectLabels...)
+
+	filters = append(filters, fmt.Sprintf("%samix=inputs=%d:duration=first:dropout_transition=0:normalize=0[aout]",
+		strings.Join(labels, ""), len(labels)))
+
+	return inputs, strings.Join(filters, ";")
+}
+
+// backgroundFilters 裁剪到目标时长，配乐加淡入淡出，再延迟到起始位置
+func backgroundFilters(track BackgroundTrack, defaultVolume float64, fade bool) string {
+	volume := track.Volume
+	if volume <= 0 {
+		volume = defaultVolume
+	}
+
+	var filters []string
+	if track.Duration > 0 {
+		filters = append(filters, fmt.Sprintf("atrim=0:%.3f,asetpts=PTS-STARTPTS", track.Duration))
+		if fade {
+			fadeDuration := math.Min(1, track.Duration/4)
+			filters = append(filters,
+				fmt.Sprintf("afade=t=in:st=0:d=%.3f", fadeDuration),
+				fmt.Sprintf("afade=t=out:st=%.3f:d=%.3f", track.Duration-fadeDuration, fadeDuration),
+			)
+		}
+	}
+	filters = append(filters, fmt.Sprintf("volume=%.2f", volume), adelayFilter(track.Offset))
+	return "," + strings.Join(filters, ",")
+}
+
+// mixBus 将同类音轨合并为一路，单路时直接返回原标签
+func mixBus(filters *[]string, labels []string, out string) string {
+	switch len(labels) {
+	case 0:
+		return ""
+	case 1:
+		return labels[0]
+	}
+	*filters = append(*filters, fmt.Sprintf("%samix=inputs=%d:duration=longest:dropout_transition=0:normalize=0%s",
+		strings.Join(labels, ""), len(labels), out))
+	return out
+}
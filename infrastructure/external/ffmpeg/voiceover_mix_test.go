@@ -0,0 +1,71 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildVoiceMixFilterConcatsLinesPerTrack(t *testing.T) {
+	inputs, graph := buildVoiceMixFilter(&VoiceOverOptions{Tracks: []VoiceTrack{
+		{Offset: 0.5, Paths: []string{"a.mp3", "b.mp3"}},
+		{Offset: 3, Paths: []string{"c.mp3"}},
+	}}, true)
+
+	if strings.Join(inputs, " ") != "-i a.mp3 -i b.mp3 -i c.mp3" {
+		t.Fatalf("unexpected inputs: %v", inputs)
+	}
+	for _, want := range []string{
+		"[1:a]aresample=44100,aformat=channel_layouts=stereo[v0p0]",
+		"[v0p0][v0p1]concat=n=2:v=0:a=1[vc0]",
+		"[vc0]adelay=500|500[vo0]",
+		"[3:a]aresample=44100,aformat=channel_layouts=stereo[v1p0]",
+		"[v1p0]adelay=3000|3000[vo1]",
+		"[0:a]aresample=44100,aformat=channel_layouts=stereo,volume=0.35[base]",
+		"[vo0][vo1]amix=inputs=2:duration=longest",
+		"[base][voice]amix=inputs=2:duration=first",
+	} {
+		if !strings.Contains(graph, want) {
+			t.Fatalf("expected filter graph to contain %q, got %s", want, graph)
+		}
+	}
+}
+
+func TestBuildVoiceMixFilterUsesSilenceWithoutBaseAudio(t *testing.T) {
+	inputs, graph := buildVoiceMixFilter(&VoiceOverOptions{
+		Tracks:     []VoiceTrack{{Offset: 0, Paths: []string{"a.mp3"}}},
+		BaseVolume: 0.8,
+	}, false)
+
+	if !strings.Contains(strings.Join(inputs, " "), "-f lavfi -i anullsrc") {
+		t.Fatalf("expected silence input, got %v", inputs)
+	}
+	if !strings.Contains(graph, "[2:a]anull[base]") {
+		t.Fatalf("expected silence input as base, got %s", graph)
+	}
+	if strings.Contains(graph, "volume=0.80") {
+		t.Fatalf("expected no base volume without base audio, got %s", graph)
+	}
+}
+
+func TestBuildVoiceMixFilterDucksLoopedMusicUnderVoice(t *testing.T) {
+	inputs, graph := buildVoiceMixFilter(&VoiceOverOptions{
+		Tracks:  []VoiceTrack{{Offset: 1, Paths: []string{"line.mp3"}}},
+		Music:   []BackgroundTrack{{Path: "bgm.mp3", Offset: 0, Duration: 8, Loop: true}},
+		Effects: []BackgroundTrack{{Path: "door.mp3", Offset: 3, Duration: 2}},
+	}, true)
+
+	if strings.Join(inputs, " ") != "-i line.mp3 -stream_loop -1 -i bgm.mp3 -i door.mp3" {
+		t.Fatalf("unexpected inputs: %v", inputs)
+	}
+	for _, want := range []string{
+		"[2:a]aresample=44100,aformat=channel_layouts=stereo,atrim=0:8.000,asetpts=PTS-STARTPTS,afade=t=in:st=0:d=1.000,afade=t=out:st=7.000:d=1.000,volume=0.30,adelay=0|0[mu0]",
+		"[3:a]aresample=44100,aformat=channel_layouts=stereo,atrim=0:2.000,asetpts=PTS-STARTPTS,volume=0.80,adelay=3000|3000[fx0]",
+		"[vo0]asplit=2[voicemix][voicekeyraw]",
+		"[mu0][voicekey]sidechaincompress",
+		"[base][voicemix][ducked][fx0]amix=inputs=4:duration=first",
+	} {
+		if !strings.Contains(graph, want) {
+			t.Fatalf("expected filter graph to contain %q, got %s", want, graph)
+		}
+	}
+}
@@ -98,6 +98,11 @@ func (s *LocalStorage) DownloadFromURLWithPath(url, category string) (*DownloadR
 	// 从URL或Content-Type推断文件扩展名
 	ext := getFileExtension(url, resp.Header.Get("Content-Type"))
 
+	return s.SaveWithPath(resp.Body, category, ext)
+}
+
+// SaveWithPath 以唯一文件名保存到分类目录，ext 带点，返回访问URL和相对路径
+func (s *LocalStorage) SaveWithPath(file io.Reader, category, ext string) (*DownloadResult, error) {
 	// 创建目录
 	dir := filepath.Join(s.basePath, category)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -117,14 +122,14 @@ func (s *LocalStorage) DownloadFromURLWithPath(url, category string) (*DownloadR
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, resp.Body); err != nil {
+	if _, err := io.Copy(dst, file); err != nil {
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
 
 	// 返回详细信息
 	relativePath := filepath.Join(category, filename)
 	localURL := fmt.Sprintf("%s/%s/%s", s.baseURL, category, filename)
-	
+
 	return &DownloadResult{
 		URL:          localURL,
 		RelativePath: relativePath,
@@ -59,6 +59,13 @@ func main() {
 		}
 	}
 
+	// 兼容 async_tasks.user_id 字段加入前创建的任务
+	if backfilled, err := database.BackfillAsyncTaskUserID(db); err != nil {
+		logr.Warnw("Async task user ownership backfill failed", "error", err)
+	} else if backfilled > 0 {
+		logr.Infow("Async task user ownership backfilled", "backfilled_rows", backfilled)
+	}
+
 	// 初始化本地存储
 	var localStorage *storage.LocalStorage
 	if cfg.Storage.Type == "local" {
@@ -0,0 +1,354 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+const (
+	anthropicAPIVersion       = "2023-06-01"
+	anthropicDefaultMaxTokens = 8192
+)
+
+// AnthropicClient 原生 Anthropic Messages API 客户端
+type AnthropicClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Endpoint   string
+	HTTPClient *http.Client
+	lastUsage  usage.Last
+}
+
+type AnthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type AnthropicMessagesRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []AnthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+// AnthropicUsage 输入 token 不含缓存部分，缓存写入与命中单独计数
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type AnthropicMessagesResponse struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      AnthropicUsage `json:"usage"`
+}
+
+type AnthropicErrorResponse struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// AnthropicStreamEvent Messages SSE 协议中各类事件共用的结构，按 Type 取对应字段
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	Delta *struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta,omitempty"`
+	Usage *AnthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func NewAnthropicClient(baseURL, apiKey, model, endpoint string) *AnthropicClient {
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	if endpoint == "" {
+		endpoint = "/v1/messages"
+	}
+	return &AnthropicClient{
+		BaseURL:  baseURL,
+		APIKey:   apiKey,
+		Model:    model,
+		Endpoint: endpoint,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+// buildRequest 将通用的 ChatCompletionRequest 选项映射到 Messages API，max_tokens 为必填项
+// Messages API 没有 response_format，ResponseFormat 被忽略，结构化输出依赖 GenerateStructured 的校验重试
+func (c *AnthropicClient) buildRequest(prompt string, systemPrompt string, stream bool, options []func(*ChatCompletionRequest)) *AnthropicMessagesRequest {
+	opts := &ChatCompletionRequest{Model: c.Model}
+	for _, option := range options {
+		option(opts)
+	}
+
+	req := &AnthropicMessagesRequest{
+		Model:     opts.Model,
+		System:    systemPrompt,
+		Messages:  []AnthropicMessage{{Role: "user", Content: prompt}},
+		MaxTokens: anthropicDefaultMaxTokens,
+		Stream:    stream,
+	}
+	if opts.MaxTokens != nil && *opts.MaxTokens > 0 {
+		req.MaxTokens = *opts.MaxTokens
+	} else if opts.MaxCompletionTokens != nil && *opts.MaxCompletionTokens > 0 {
+		req.MaxTokens = *opts.MaxCompletionTokens
+	}
+	if opts.Temperature != 0 {
+		temperature := opts.Temperature
+		req.Temperature = &temperature
+	}
+	if opts.TopP != 0 {
+		topP := opts.TopP
+		req.TopP = &topP
+	}
+	return req
+}
+
+func (c *AnthropicClient) newHTTPRequest(ctx context.Context, req *AnthropicMessagesRequest) (*http.Request, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	url := strings.TrimSuffix(c.BaseURL, "/") + c.Endpoint
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.APIKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	return httpReq, nil
+}
+
+// anthropicAPIError 保留 HTTP 状态码，便于上层判断限流、过载（529）等临时性错误
+func anthropicAPIError(statusCode int, body []byte) error {
+	var errResp AnthropicErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		return fmt.Errorf("API error (status %d): %s: %s", statusCode, errResp.Error.Type, errResp.Error.Message)
+	}
+	return fmt.Errorf("API error (status %d): %s", statusCode, string(body))
+}
+
+func anthropicTokenUsage(u AnthropicUsage) usage.TokenUsage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return usage.TokenUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+}
+
+func (c *AnthropicClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextContext(context.Background(), prompt, systemPrompt, options...)
+}
+
+func (c *AnthropicClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	c.lastUsage.Reset()
+
+	httpReq, err := c.newHTTPRequest(ctx, c.buildRequest(prompt, systemPrompt, false, options))
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Anthropic: Sending request to: %s, Model=%s\n", httpReq.URL.String(), c.Model)
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		fmt.Printf("Anthropic: HTTP request failed: %v\n", err)
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Anthropic: API error (status %d): %s\n", resp.StatusCode, string(body))
+		return "", anthropicAPIError(resp.StatusCode, body)
+	}
+
+	var result AnthropicMessagesResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		errorPreview := string(body)
+		if len(body) > 200 {
+			errorPreview = string(body[:200])
+		}
+		return "", fmt.Errorf("parse response: %w, body preview: %s", err, errorPreview)
+	}
+
+	c.lastUsage.Set(ctx, anthropicTokenUsage(result.Usage))
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("AI返回内容为空 (stop_reason: %s)", result.StopReason)
+	}
+	return text.String(), nil
+}
+
+// GenerateTextStream 通过 Messages SSE 协议流式生成文本
+// 输入 token 在 message_start 事件中返回，输出 token 在 message_delta 事件中累计
+func (c *AnthropicClient) GenerateTextStream(prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextStreamContext(context.Background(), prompt, systemPrompt, callback, options...)
+}
+
+func (c *AnthropicClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	c.lastUsage.Reset()
+
+	req := c.buildRequest(prompt, systemPrompt, true, options)
+	httpReq, err := c.newHTTPRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	// 使用不带超时的客户端（流式响应可能很长）
+	client := &http.Client{Timeout: 0}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", anthropicAPIError(resp.StatusCode, body)
+	}
+
+	var fullContent strings.Builder
+	var streamUsage AnthropicUsage
+	totalChars := 0
+	lastProgressUpdate := 0
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+		var event AnthropicStreamEvent
+		if jsonErr := json.Unmarshal([]byte(data), &event); jsonErr != nil {
+			continue // 忽略解析错误的行
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				streamUsage = event.Message.Usage
+			}
+		case "content_block_delta":
+			if event.Delta == nil || event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				continue
+			}
+			chunk := event.Delta.Text
+			fullContent.WriteString(chunk)
+			totalChars += len(chunk)
+
+			// 估算进度：totalChars / (max_tokens * 2)，与 OpenAI 客户端一致每增加 5% 回调一次
+			estimatedProgress := float64(totalChars) / float64(req.MaxTokens*2)
+			if estimatedProgress > 1.0 {
+				estimatedProgress = 0.95
+			}
+			progressPercent := int(estimatedProgress * 100)
+			if progressPercent >= lastProgressUpdate+5 || totalChars <= 500 {
+				if callback != nil {
+					callback(chunk, totalChars, estimatedProgress)
+				}
+				lastProgressUpdate = progressPercent
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				streamUsage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "error":
+			c.lastUsage.Set(ctx, anthropicTokenUsage(streamUsage))
+			if event.Error != nil {
+				// overloaded_error 等流内错误没有 HTTP 状态码，按过载处理
+				if event.Error.Type == "overloaded_error" {
+					return fullContent.String(), fmt.Errorf("API error (status 529): %s: %s", event.Error.Type, event.Error.Message)
+				}
+				return fullContent.String(), fmt.Errorf("API error: %s: %s", event.Error.Type, event.Error.Message)
+			}
+			return fullContent.String(), fmt.Errorf("API error: unknown stream error")
+		}
+	}
+	c.lastUsage.Set(ctx, anthropicTokenUsage(streamUsage))
+
+	if err := scanner.Err(); err != nil {
+		return fullContent.String(), fmt.Errorf("error reading stream: %w", err)
+	}
+	return fullContent.String(), nil
+}
+
+func (c *AnthropicClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return c.GenerateImageContext(context.Background(), prompt, size, n)
+}
+
+func (c *AnthropicClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	return nil, fmt.Errorf("GenerateImage not implemented for Anthropic client")
+}
+
+func (c *AnthropicClient) TestConnection() error {
+	return c.TestConnectionContext(context.Background())
+}
+
+func (c *AnthropicClient) TestConnectionContext(ctx context.Context) error {
+	fmt.Printf("Anthropic: TestConnection called with BaseURL=%s, Model=%s, Endpoint=%s\n", c.BaseURL, c.Model, c.Endpoint)
+	_, err := c.GenerateTextContext(ctx, "Hello", "", WithMaxTokens(16))
+	if err != nil {
+		fmt.Printf("Anthropic: TestConnection failed: %v\n", err)
+	} else {
+		fmt.Printf("Anthropic: TestConnection succeeded\n")
+	}
+	return err
+}
+
+func (c *AnthropicClient) GetLastUsage() usage.TokenUsage {
+	return c.lastUsage.Get()
+}
@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicClient_GenerateTextSendsSystemPromptAndMapsUsage(t *testing.T) {
+	var got AnthropicMessagesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "secret" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("missing auth headers: %v", r.Header)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"type":"message","content":[{"type":"text","text":"polished"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":4,"cache_read_input_tokens":6}}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(server.URL, "secret", "claude-test", "")
+	text, err := client.GenerateText("rewrite this", "you are an editor", WithMaxTokens(512), WithTemperature(0.3))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if text != "polished" {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if got.System != "you are an editor" || got.MaxTokens != 512 || got.Temperature == nil || *got.Temperature != 0.3 {
+		t.Fatalf("unexpected request %+v", got)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Role != "user" {
+		t.Fatalf("expected a single user message, got %+v", got.Messages)
+	}
+
+	u := client.GetLastUsage()
+	if u.PromptTokens != 16 || u.CompletionTokens != 4 || u.TotalTokens != 20 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+}
+
+func TestAnthropicClient_GenerateTextKeepsStatusInError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(server.URL, "secret", "claude-test", "")
+	_, err := client.GenerateText("hello", "")
+	if err == nil || !strings.Contains(err.Error(), "status 529") {
+		t.Fatalf("expected status to be kept in error, got %v", err)
+	}
+}
+
+func TestAnthropicClient_GenerateTextStreamParsesEventsAndUsage(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"第一幕"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"，雨夜。"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":9}}`,
+		`{"type":"message_stop"}`,
+	}
+	var stream bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AnthropicMessagesRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		stream = req.Stream
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range events {
+			var event struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(data), &event)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient(server.URL, "secret", "claude-test", "")
+	var chunks []string
+	text, err := client.GenerateTextStream("write", "", func(chunk string, totalChars int, progress float64) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !stream {
+		t.Fatal("expected stream to be requested")
+	}
+	if text != "第一幕，雨夜。" || len(chunks) != 2 {
+		t.Fatalf("unexpected stream result %q, chunks %v", text, chunks)
+	}
+
+	u := client.GetLastUsage()
+	if u.PromptTokens != 12 || u.CompletionTokens != 9 || u.TotalTokens != 21 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+}
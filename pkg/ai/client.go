@@ -1,6 +1,10 @@
 package ai
 
-import "github.com/drama-generator/backend/pkg/usage"
+import (
+	"context"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
 
 // StreamCallback 流式输出回调函数类型
 // chunk: 本次收到的文本片段
@@ -9,11 +13,17 @@ import "github.com/drama-generator/backend/pkg/usage"
 type StreamCallback func(chunk string, totalChars int, estimatedProgress float64)
 
 // AIClient 定义文本生成客户端接口
+// 带 Context 后缀的方法在 ctx 取消或超时时中止请求；不带 ctx 的方法等价于传入 context.Background()
 type AIClient interface {
 	GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error)
 	// GenerateTextStream 流式生成文本，通过 callback 实时返回生成内容
 	GenerateTextStream(prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error)
 	GenerateImage(prompt string, size string, n int) ([]string, error)
 	TestConnection() error
+	GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error)
+	GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error)
+	GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error)
+	TestConnectionContext(ctx context.Context) error
+	// GetLastUsage 最近一次调用的用量。同一客户端被并发调用时结果不可靠，计费应通过 usage.WithMeter 获取每次调用自己的用量
 	GetLastUsage() usage.TokenUsage
 }
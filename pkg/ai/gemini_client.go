@@ -2,6 +2,7 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -18,12 +19,18 @@ type GeminiClient struct {
 	Model      string
 	Endpoint   string
 	HTTPClient *http.Client
-	lastUsage  usage.TokenUsage
+	lastUsage  usage.Last
 }
 
 type GeminiTextRequest struct {
-	Contents          []GeminiContent    `json:"contents"`
-	SystemInstruction *GeminiInstruction `json:"systemInstruction,omitempty"`
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiInstruction      `json:"systemInstruction,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiGenerationConfig 目前只用于 JSON 模式：responseSchema 只支持 OpenAPI 子集，这里仅约束输出 MIME 类型，结构由调用方校验
+type GeminiGenerationConfig struct {
+	ResponseMimeType string `json:"responseMimeType,omitempty"`
 }
 
 type GeminiContent struct {
@@ -54,11 +61,27 @@ type GeminiTextResponse struct {
 			Probability string `json:"probability"`
 		} `json:"safetyRatings"`
 	} `json:"candidates"`
-	UsageMetadata struct {
-		PromptTokenCount     int `json:"promptTokenCount"`
-		CandidatesTokenCount int `json:"candidatesTokenCount"`
-		TotalTokenCount      int `json:"totalTokenCount"`
-	} `json:"usageMetadata"`
+	UsageMetadata GeminiUsageMetadata `json:"usageMetadata"`
+}
+
+// GeminiUsageMetadata 思考模型的 thoughtsTokenCount 同样按输出计费
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+func (m GeminiUsageMetadata) tokenUsage() usage.TokenUsage {
+	tokenUsage := usage.TokenUsage{
+		PromptTokens:     m.PromptTokenCount,
+		CompletionTokens: m.CandidatesTokenCount + m.ThoughtsTokenCount,
+		TotalTokens:      m.TotalTokenCount,
+	}
+	if tokenUsage.TotalTokens == 0 {
+		tokenUsage.TotalTokens = tokenUsage.PromptTokens + tokenUsage.CompletionTokens
+	}
+	return tokenUsage
 }
 
 func NewGeminiClient(baseURL, apiKey, model, endpoint string) *GeminiClient {
@@ -83,9 +106,18 @@ func NewGeminiClient(baseURL, apiKey, model, endpoint string) *GeminiClient {
 }
 
 func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
-	c.lastUsage = usage.TokenUsage{}
+	return c.GenerateTextContext(context.Background(), prompt, systemPrompt, options...)
+}
+
+func (c *GeminiClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	c.lastUsage.Reset()
 	model := c.Model
 
+	opts := &ChatCompletionRequest{Model: c.Model}
+	for _, option := range options {
+		option(opts)
+	}
+
 	// 构建请求体
 	reqBody := GeminiTextRequest{
 		Contents: []GeminiContent{
@@ -102,6 +134,9 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 			Parts: []GeminiPart{{Text: systemPrompt}},
 		}
 	}
+	if opts.ResponseFormat != nil {
+		reqBody.GenerationConfig = &GeminiGenerationConfig{ResponseMimeType: "application/json"}
+	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
@@ -123,7 +158,7 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 	}
 	fmt.Printf("Gemini: Request body: %s\n", requestPreview)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		fmt.Printf("Gemini: Failed to create request: %v\n", err)
 		return "", fmt.Errorf("create request: %w", err)
@@ -169,6 +204,8 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 		return "", fmt.Errorf("parse response: %w, body preview: %s", err, errorPreview)
 	}
 
+	// 被拦截或没有候选结果时输入 token 同样计费，先记录用量
+	c.lastUsage.Set(ctx, result.UsageMetadata.tokenUsage())
 	fmt.Printf("Gemini: Successfully parsed response, candidates count: %d\n", len(result.Candidates))
 
 	if len(result.Candidates) == 0 {
@@ -184,18 +221,16 @@ func (c *GeminiClient) GenerateText(prompt string, systemPrompt string, options
 	responseText := result.Candidates[0].Content.Parts[0].Text
 	fmt.Printf("Gemini: Generated text: %s\n", responseText)
 
-	c.lastUsage = usage.TokenUsage{
-		PromptTokens:     result.UsageMetadata.PromptTokenCount,
-		CompletionTokens: result.UsageMetadata.CandidatesTokenCount,
-		TotalTokens:      result.UsageMetadata.TotalTokenCount,
-	}
-
 	return responseText, nil
 }
 
 // GenerateTextStream 流式生成文本（Gemini 也支持流式，但这里先用非流式实现以满足接口要求）
 // 如果需要真正的流式输出，可以使用 streamGenerateContent 端点
 func (c *GeminiClient) GenerateTextStream(prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextStreamContext(context.Background(), prompt, systemPrompt, callback, options...)
+}
+
+func (c *GeminiClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
 	// 对于 Gemini，暂时使用非流式实现
 	// 在开始时发送一个初始进度
 	if callback != nil {
@@ -203,7 +238,7 @@ func (c *GeminiClient) GenerateTextStream(prompt string, systemPrompt string, ca
 	}
 
 	// 调用非流式方法
-	result, err := c.GenerateText(prompt, systemPrompt, options...)
+	result, err := c.GenerateTextContext(ctx, prompt, systemPrompt, options...)
 	if err != nil {
 		return "", err
 	}
@@ -217,12 +252,20 @@ func (c *GeminiClient) GenerateTextStream(prompt string, systemPrompt string, ca
 }
 
 func (c *GeminiClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return c.GenerateImageContext(context.Background(), prompt, size, n)
+}
+
+func (c *GeminiClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
 	return nil, fmt.Errorf("GenerateImage not implemented for Gemini client")
 }
 
 func (c *GeminiClient) TestConnection() error {
+	return c.TestConnectionContext(context.Background())
+}
+
+func (c *GeminiClient) TestConnectionContext(ctx context.Context) error {
 	fmt.Printf("Gemini: TestConnection called with BaseURL=%s, Model=%s, Endpoint=%s\n", c.BaseURL, c.Model, c.Endpoint)
-	_, err := c.GenerateText("Hello", "")
+	_, err := c.GenerateTextContext(ctx, "Hello", "")
 	if err != nil {
 		fmt.Printf("Gemini: TestConnection failed: %v\n", err)
 	} else {
@@ -232,5 +275,5 @@ func (c *GeminiClient) TestConnection() error {
 }
 
 func (c *GeminiClient) GetLastUsage() usage.TokenUsage {
-	return c.lastUsage
+	return c.lastUsage.Get()
 }
@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+func TestGeminiClient_RecordsUsageMetadata(t *testing.T) {
+	blocked := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blocked {
+			fmt.Fprint(w, `{"candidates":[],"usageMetadata":{"promptTokenCount":7}}`)
+			return
+		}
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}],
+			"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":3,"totalTokenCount":18}}`)
+	}))
+	defer server.Close()
+
+	client := NewGeminiClient(server.URL, "secret", "gemini-test", "/models/{model}:generateContent")
+	ctx, meter := usage.WithMeter(context.Background())
+	if _, err := client.GenerateTextStreamContext(ctx, "hi", "", nil); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	if got, want := meter.Total(), (usage.TokenUsage{PromptTokens: 10, CompletionTokens: 8, TotalTokens: 18}); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	blocked = true
+	ctx, meter = usage.WithMeter(context.Background())
+	if _, err := client.GenerateTextContext(ctx, "hi", ""); err == nil {
+		t.Fatalf("expected empty candidates to fail")
+	}
+	if got, want := meter.Total(), (usage.TokenUsage{PromptTokens: 7, TotalTokens: 7}); got != want {
+		t.Fatalf("expected blocked request to still report %+v, got %+v", want, got)
+	}
+}
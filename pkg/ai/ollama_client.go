@@ -0,0 +1,393 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+const (
+	ollamaChatEndpoint     = "/api/chat"
+	ollamaGenerateEndpoint = "/api/generate"
+	ollamaTagsEndpoint     = "/api/tags"
+)
+
+// OllamaClient Ollama 及兼容服务的本地模型客户端，Endpoint 为 /api/chat 或 /api/generate
+type OllamaClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Endpoint   string
+	HTTPClient *http.Client
+	lastUsage  usage.Last
+}
+
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"`
+}
+
+type OllamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []ChatMessage  `json:"messages,omitempty"` // /api/chat
+	Prompt   string         `json:"prompt,omitempty"`   // /api/generate
+	System   string         `json:"system,omitempty"`   // /api/generate
+	Stream   bool           `json:"stream"`
+	Format   interface{}    `json:"format,omitempty"` // "json" 或 JSON Schema 对象
+	Options  *OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaResponse /api/chat 与 /api/generate 的响应（流式时为每行一个对象），token 计数只在 done 为 true 时返回
+type OllamaResponse struct {
+	Model   string `json:"model"`
+	Message *struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message,omitempty"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error,omitempty"`
+}
+
+func NewOllamaClient(baseURL, apiKey, model, endpoint string) *OllamaClient {
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+	if endpoint == "" {
+		endpoint = ollamaChatEndpoint
+	}
+	return &OllamaClient{
+		BaseURL:  baseURL,
+		APIKey:   apiKey,
+		Model:    model,
+		Endpoint: endpoint,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+func (c *OllamaClient) usesGenerate() bool {
+	return strings.HasSuffix(c.Endpoint, ollamaGenerateEndpoint)
+}
+
+func (c *OllamaClient) buildRequest(prompt string, systemPrompt string, stream bool, options []func(*ChatCompletionRequest)) *OllamaRequest {
+	opts := &ChatCompletionRequest{Model: c.Model}
+	for _, option := range options {
+		option(opts)
+	}
+
+	req := &OllamaRequest{Model: opts.Model, Stream: stream}
+	if c.usesGenerate() {
+		req.Prompt = prompt
+		req.System = systemPrompt
+	} else {
+		if systemPrompt != "" {
+			req.Messages = append(req.Messages, ChatMessage{Role: "system", Content: systemPrompt})
+		}
+		req.Messages = append(req.Messages, ChatMessage{Role: "user", Content: prompt})
+	}
+
+	if opts.ResponseFormat != nil {
+		if opts.ResponseFormat.JSONSchema != nil && opts.ResponseFormat.JSONSchema.Schema != nil {
+			req.Format = opts.ResponseFormat.JSONSchema.Schema
+		} else {
+			req.Format = "json"
+		}
+	}
+
+	var ollamaOpts OllamaOptions
+	if opts.Temperature != 0 {
+		temperature := opts.Temperature
+		ollamaOpts.Temperature = &temperature
+	}
+	if opts.TopP != 0 {
+		topP := opts.TopP
+		ollamaOpts.TopP = &topP
+	}
+	if opts.MaxTokens != nil {
+		ollamaOpts.NumPredict = opts.MaxTokens
+	} else if opts.MaxCompletionTokens != nil {
+		ollamaOpts.NumPredict = opts.MaxCompletionTokens
+	}
+	if ollamaOpts != (OllamaOptions{}) {
+		req.Options = &ollamaOpts
+	}
+	return req
+}
+
+func (c *OllamaClient) url(endpoint string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + endpoint
+}
+
+func (c *OllamaClient) newHTTPRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	// 本地 Ollama 不需要鉴权，放在反向代理之后时可通过 API Key 传递 Bearer token
+	if c.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	return httpReq, nil
+}
+
+func ollamaAPIError(statusCode int, body []byte) error {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+		return fmt.Errorf("API error (status %d): %s", statusCode, errResp.Error)
+	}
+	return fmt.Errorf("API error (status %d): %s", statusCode, string(body))
+}
+
+func (r *OllamaResponse) text() string {
+	if r.Message != nil {
+		return r.Message.Content
+	}
+	return r.Response
+}
+
+func (r *OllamaResponse) tokenUsage() usage.TokenUsage {
+	return usage.TokenUsage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+func (c *OllamaClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextContext(context.Background(), prompt, systemPrompt, options...)
+}
+
+func (c *OllamaClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	c.lastUsage.Reset()
+
+	jsonData, err := json.Marshal(c.buildRequest(prompt, systemPrompt, false, options))
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := c.newHTTPRequest(ctx, "POST", c.url(c.Endpoint), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Ollama: Sending request to: %s, Model=%s\n", httpReq.URL.String(), c.Model)
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		fmt.Printf("Ollama: HTTP request failed: %v\n", err)
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Ollama: API error (status %d): %s\n", resp.StatusCode, string(body))
+		return "", ollamaAPIError(resp.StatusCode, body)
+	}
+
+	var result OllamaResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		errorPreview := string(body)
+		if len(body) > 200 {
+			errorPreview = string(body[:200])
+		}
+		return "", fmt.Errorf("parse response: %w, body preview: %s", err, errorPreview)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("API error: %s", result.Error)
+	}
+
+	c.lastUsage.Set(ctx, result.tokenUsage())
+	text := result.text()
+	if text == "" {
+		return "", fmt.Errorf("AI返回内容为空 (done_reason: %s)", result.DoneReason)
+	}
+	return text, nil
+}
+
+// GenerateTextStream 流式生成文本，Ollama 的流式响应为 NDJSON，每行一个 JSON 对象，最后一行 done 为 true 并带有 token 计数
+func (c *OllamaClient) GenerateTextStream(prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextStreamContext(context.Background(), prompt, systemPrompt, callback, options...)
+}
+
+func (c *OllamaClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	c.lastUsage.Reset()
+
+	req := c.buildRequest(prompt, systemPrompt, true, options)
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := c.newHTTPRequest(ctx, "POST", c.url(c.Endpoint), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+
+	// 使用不带超时的客户端（流式响应可能很长）
+	client := &http.Client{Timeout: 0}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", ollamaAPIError(resp.StatusCode, body)
+	}
+
+	// 估算期望的输出 token 数（用于进度计算）
+	estimatedOutputTokens := 8000
+	if req.Options != nil && req.Options.NumPredict != nil && *req.Options.NumPredict > 0 {
+		estimatedOutputTokens = *req.Options.NumPredict
+	}
+
+	var fullContent strings.Builder
+	totalChars := 0
+	lastProgressUpdate := 0
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk OllamaResponse
+		if jsonErr := json.Unmarshal([]byte(line), &chunk); jsonErr != nil {
+			continue // 忽略解析错误的行
+		}
+		if chunk.Error != "" {
+			return fullContent.String(), fmt.Errorf("API error: %s", chunk.Error)
+		}
+		if chunk.Done {
+			c.lastUsage.Set(ctx, chunk.tokenUsage())
+		}
+
+		chunkContent := chunk.text()
+		if chunkContent == "" {
+			continue
+		}
+		fullContent.WriteString(chunkContent)
+		totalChars += len(chunkContent)
+
+		estimatedProgress := float64(totalChars) / float64(estimatedOutputTokens*2)
+		if estimatedProgress > 1.0 {
+			estimatedProgress = 0.95
+		}
+		progressPercent := int(estimatedProgress * 100)
+		if progressPercent >= lastProgressUpdate+5 || totalChars <= 500 {
+			if callback != nil {
+				callback(chunkContent, totalChars, estimatedProgress)
+			}
+			lastProgressUpdate = progressPercent
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fullContent.String(), fmt.Errorf("error reading stream: %w", err)
+	}
+
+	return fullContent.String(), nil
+}
+
+// ListModels 返回服务端已拉取的模型列表
+func (c *OllamaClient) ListModels() ([]string, error) {
+	return c.ListModelsContext(context.Background())
+}
+
+func (c *OllamaClient) ListModelsContext(ctx context.Context) ([]string, error) {
+	httpReq, err := c.newHTTPRequest(ctx, "GET", c.url(ollamaTagsEndpoint), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, ollamaAPIError(resp.StatusCode, body)
+	}
+
+	var result struct {
+		Models []struct {
+			Name  string `json:"name"`
+			Model string `json:"model"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	names := make([]string, 0, len(result.Models))
+	for _, m := range result.Models {
+		name := m.Name
+		if name == "" {
+			name = m.Model
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (c *OllamaClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return c.GenerateImageContext(context.Background(), prompt, size, n)
+}
+
+func (c *OllamaClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	return nil, fmt.Errorf("GenerateImage not implemented for Ollama client")
+}
+
+// TestConnection 列出服务端模型并确认配置的模型已拉取，不产生推理调用
+func (c *OllamaClient) TestConnection() error {
+	return c.TestConnectionContext(context.Background())
+}
+
+func (c *OllamaClient) TestConnectionContext(ctx context.Context) error {
+	fmt.Printf("Ollama: TestConnection called with BaseURL=%s, Model=%s\n", c.BaseURL, c.Model)
+	models, err := c.ListModelsContext(ctx)
+	if err != nil {
+		fmt.Printf("Ollama: TestConnection failed: %v\n", err)
+		return err
+	}
+	fmt.Printf("Ollama: Available models: %v\n", models)
+
+	if c.Model == "" {
+		return nil
+	}
+	for _, name := range models {
+		// 未写 tag 的模型名等同于 :latest
+		if name == c.Model || name == c.Model+":latest" {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %s not found, available models: %s", c.Model, strings.Join(models, ", "))
+}
+
+func (c *OllamaClient) GetLastUsage() usage.TokenUsage {
+	return c.lastUsage.Get()
+}
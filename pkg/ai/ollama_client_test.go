@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOllamaClient_GenerateTextUsesChatAndReportsUsage(t *testing.T) {
+	var got OllamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"model":"qwen2.5","message":{"role":"assistant","content":"分镜一"},"done":true,"prompt_eval_count":21,"eval_count":7}`))
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL, "", "qwen2.5", "")
+	text, err := client.GenerateText("写分镜", "你是导演", WithMaxTokens(256))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if text != "分镜一" {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if got.Stream || len(got.Messages) != 2 || got.Messages[0].Role != "system" {
+		t.Fatalf("unexpected request %+v", got)
+	}
+	if got.Options == nil || got.Options.NumPredict == nil || *got.Options.NumPredict != 256 {
+		t.Fatalf("expected max tokens to map to num_predict, got %+v", got.Options)
+	}
+
+	u := client.GetLastUsage()
+	if u.PromptTokens != 21 || u.CompletionTokens != 7 || u.TotalTokens != 28 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+}
+
+func TestOllamaClient_GenerateTextStreamReadsGenerateNDJSON(t *testing.T) {
+	var got OllamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, piece := range []string{"雨", "夜"} {
+			_, _ = fmt.Fprintf(w, "{\"response\":%q,\"done\":false}\n", piece)
+		}
+		_, _ = fmt.Fprint(w, "{\"response\":\"\",\"done\":true,\"prompt_eval_count\":5,\"eval_count\":2}\n")
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL, "", "llama3", "/api/generate")
+	var chunks []string
+	text, err := client.GenerateTextStream("场景", "系统", func(chunk string, totalChars int, progress float64) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !got.Stream || got.Prompt != "场景" || got.System != "系统" {
+		t.Fatalf("unexpected request %+v", got)
+	}
+	if text != "雨夜" || len(chunks) != 2 {
+		t.Fatalf("unexpected stream result %q, chunks %v", text, chunks)
+	}
+	if client.GetLastUsage().TotalTokens != 7 {
+		t.Fatalf("unexpected usage %+v", client.GetLastUsage())
+	}
+}
+
+func TestOllamaClient_TestConnectionChecksModelIsPulled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"models":[{"name":"qwen2.5:latest"},{"name":"llama3.1:8b"}]}`))
+	}))
+	defer server.Close()
+
+	if err := NewOllamaClient(server.URL, "", "qwen2.5", "").TestConnection(); err != nil {
+		t.Fatalf("expected untagged model to match :latest, got %v", err)
+	}
+	err := NewOllamaClient(server.URL, "", "mistral", "").TestConnection()
+	if err == nil || !strings.Contains(err.Error(), "llama3.1:8b") {
+		t.Fatalf("expected missing model error listing available models, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"encoding/json"
 	"fmt"
@@ -21,7 +22,7 @@ type OpenAIClient struct {
 	Model      string
 	Endpoint   string
 	HTTPClient *http.Client
-	lastUsage  usage.TokenUsage
+	lastUsage  usage.Last
 }
 
 type ChatMessage struct {
@@ -40,6 +41,22 @@ type ChatCompletionRequest struct {
 	StreamOptions       *struct {
 		IncludeUsage bool `json:"include_usage"`
 	} `json:"stream_options,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	// useCache 由 WithResponseCache 设置，不会发送给服务商
+	useCache bool
+}
+
+// ResponseFormat 约束模型输出格式，Type 为 json_object 或 json_schema
+type ResponseFormat struct {
+	Type       string              `json:"type"`
+	JSONSchema *ResponseJSONSchema `json:"json_schema,omitempty"`
+}
+
+type ResponseJSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict,omitempty"`
 }
 
 type ChatCompletionResponse struct {
@@ -102,6 +119,11 @@ func NewOpenAIClient(baseURL, apiKey, model, endpoint string) *OpenAIClient {
 }
 
 func (c *OpenAIClient) ChatCompletion(messages []ChatMessage, options ...func(*ChatCompletionRequest)) (*ChatCompletionResponse, error) {
+	return c.ChatCompletionContext(context.Background(), messages, options...)
+}
+
+// ChatCompletionContext ctx 取消或超时时中止请求，重试等待也会随之结束
+func (c *OpenAIClient) ChatCompletionContext(ctx context.Context, messages []ChatMessage, options ...func(*ChatCompletionRequest)) (*ChatCompletionResponse, error) {
 	req := &ChatCompletionRequest{
 		Model:    c.Model,
 		Messages: messages,
@@ -111,17 +133,20 @@ func (c *OpenAIClient) ChatCompletion(messages []ChatMessage, options ...func(*C
 		option(req)
 	}
 
-	return c.sendChatRequest(req)
+	return c.sendChatRequest(ctx, req)
 }
 
-func (c *OpenAIClient) sendChatRequest(req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+func (c *OpenAIClient) sendChatRequest(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	const maxAttempts = 3
 	var lastErr error
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		resp, err := c.doChatRequest(req)
+		resp, err := c.doChatRequest(ctx, req)
 		if err == nil {
 			return resp, nil
 		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
 		lastErr = err
 		if !isRetryableRequestError(err) || attempt == maxAttempts {
 			break
@@ -130,7 +155,20 @@ func (c *OpenAIClient) sendChatRequest(req *ChatCompletionRequest) (*ChatComplet
 		backoff := time.Duration(attempt) * time.Second
 		fmt.Printf("OpenAI: transient request error, retrying (%d/%d) after %s: %v\n",
 			attempt+1, maxAttempts, backoff, err)
-		time.Sleep(backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+
+	if shouldRetryWithoutResponseFormat(lastErr, req) {
+		retryReq := *req
+		retryReq.ResponseFormat = nil
+		fmt.Printf("OpenAI: response_format not supported, retrying without it\n")
+		return c.sendChatRequest(ctx, &retryReq)
 	}
 
 	if shouldRetryWithMaxCompletionTokens(lastErr, req) {
@@ -139,7 +177,7 @@ func (c *OpenAIClient) sendChatRequest(req *ChatCompletionRequest) (*ChatComplet
 		retryReq.MaxTokens = nil
 		retryReq.MaxCompletionTokens = &tokens
 		fmt.Printf("OpenAI: retrying with max_completion_tokens=%d\n", tokens)
-		return c.doChatRequest(&retryReq)
+		return c.doChatRequest(ctx, &retryReq)
 	}
 
 	return nil, lastErr
@@ -183,8 +221,8 @@ func isRetryableRequestError(err error) bool {
 	return false
 }
 
-func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
-	c.lastUsage = usage.TokenUsage{}
+func (c *OpenAIClient) doChatRequest(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	c.lastUsage.Reset()
 	jsonData, err := json.Marshal(req)
 	if err != nil {
 		fmt.Printf("OpenAI: Failed to marshal request: %v\n", err)
@@ -202,7 +240,7 @@ func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletio
 	}
 	fmt.Printf("OpenAI: Request body: %s\n", requestPreview)
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		fmt.Printf("OpenAI: Failed to create request: %v\n", err)
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -253,6 +291,12 @@ func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletio
 		return nil, fmt.Errorf("failed to unmarshal response: %w, body preview: %s", err, errorPreview)
 	}
 
+	// 内容被过滤或为空时同样计费，先记录用量
+	c.lastUsage.Set(ctx, usage.TokenUsage{
+		PromptTokens:     chatResp.Usage.PromptTokens,
+		CompletionTokens: chatResp.Usage.CompletionTokens,
+		TotalTokens:      chatResp.Usage.TotalTokens,
+	})
 	fmt.Printf("OpenAI: Successfully parsed response, choices count: %d\n", len(chatResp.Choices))
 
 	if len(chatResp.Choices) == 0 {
@@ -277,17 +321,11 @@ func (c *OpenAIClient) doChatRequest(req *ChatCompletionRequest) (*ChatCompletio
 		}
 	}
 
-	c.lastUsage = usage.TokenUsage{
-		PromptTokens:     chatResp.Usage.PromptTokens,
-		CompletionTokens: chatResp.Usage.CompletionTokens,
-		TotalTokens:      chatResp.Usage.TotalTokens,
-	}
-
 	return &chatResp, nil
 }
 
 func (c *OpenAIClient) GetLastUsage() usage.TokenUsage {
-	return c.lastUsage
+	return c.lastUsage.Get()
 }
 
 func WithTemperature(temp float64) func(*ChatCompletionRequest) {
@@ -308,7 +346,34 @@ func WithTopP(topP float64) func(*ChatCompletionRequest) {
 	}
 }
 
+// WithJSONObject 要求模型输出合法的 JSON 对象
+func WithJSONObject() func(*ChatCompletionRequest) {
+	return func(req *ChatCompletionRequest) {
+		req.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	}
+}
+
+// WithJSONSchema 要求模型按给定 JSON Schema 输出，不支持的客户端会忽略该选项
+func WithJSONSchema(name string, schema map[string]interface{}) func(*ChatCompletionRequest) {
+	return func(req *ChatCompletionRequest) {
+		req.ResponseFormat = &ResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &ResponseJSONSchema{Name: name, Schema: schema},
+		}
+	}
+}
+
+func withoutResponseFormat() func(*ChatCompletionRequest) {
+	return func(req *ChatCompletionRequest) {
+		req.ResponseFormat = nil
+	}
+}
+
 func (c *OpenAIClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextContext(context.Background(), prompt, systemPrompt, options...)
+}
+
+func (c *OpenAIClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
 	messages := []ChatMessage{}
 
 	if systemPrompt != "" {
@@ -323,7 +388,7 @@ func (c *OpenAIClient) GenerateText(prompt string, systemPrompt string, options
 		Content: prompt,
 	})
 
-	resp, err := c.ChatCompletion(messages, options...)
+	resp, err := c.ChatCompletionContext(ctx, messages, options...)
 	if err != nil {
 		return "", err
 	}
@@ -358,7 +423,12 @@ type StreamChunkResponse struct {
 
 // GenerateTextStream 流式生成文本，通过 callback 实时返回生成内容
 func (c *OpenAIClient) GenerateTextStream(prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
-	c.lastUsage = usage.TokenUsage{}
+	return c.GenerateTextStreamContext(context.Background(), prompt, systemPrompt, callback, options...)
+}
+
+// GenerateTextStreamContext 流式请求没有整体超时，由 ctx 控制中止
+func (c *OpenAIClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	c.lastUsage.Reset()
 	messages := []ChatMessage{}
 
 	if systemPrompt != "" {
@@ -403,7 +473,7 @@ func (c *OpenAIClient) GenerateTextStream(prompt string, systemPrompt string, ca
 	}
 
 	url := strings.TrimSuffix(c.BaseURL, "/") + c.Endpoint
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -425,11 +495,17 @@ func (c *OpenAIClient) GenerateTextStream(prompt string, systemPrompt string, ca
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		apiErr := fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+		if shouldRetryWithoutResponseFormat(apiErr, req) {
+			fmt.Printf("OpenAI: response_format not supported, retrying stream without it\n")
+			return c.GenerateTextStreamContext(ctx, prompt, systemPrompt, callback, append(options, withoutResponseFormat())...)
+		}
+		return "", apiErr
 	}
 
 	// 解析 SSE 流
 	var fullContent strings.Builder
+	var streamUsage usage.TokenUsage
 	totalChars := 0
 	lastProgressUpdate := 0
 
@@ -467,8 +543,9 @@ func (c *OpenAIClient) GenerateTextStream(prompt string, systemPrompt string, ca
 						continue // 忽略解析错误的行
 					}
 
+					// include_usage 时用量在最后一个 chunk 返回；部分兼容服务每个 chunk 都带累计用量，取最后一次
 					if chunk.Usage != nil {
-						c.lastUsage = usage.TokenUsage{
+						streamUsage = usage.TokenUsage{
 							PromptTokens:     chunk.Usage.PromptTokens,
 							CompletionTokens: chunk.Usage.CompletionTokens,
 							TotalTokens:      chunk.Usage.TotalTokens,
@@ -509,14 +586,20 @@ func (c *OpenAIClient) GenerateTextStream(prompt string, systemPrompt string, ca
 			if err == io.EOF {
 				break
 			}
+			c.lastUsage.Set(ctx, streamUsage)
 			return fullContent.String(), fmt.Errorf("error reading stream: %w", err)
 		}
 	}
 
+	c.lastUsage.Set(ctx, streamUsage)
 	return fullContent.String(), nil
 }
 
 func (c *OpenAIClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return c.GenerateImageContext(context.Background(), prompt, size, n)
+}
+
+func (c *OpenAIClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
 	// 图片生成端点通常是 /v1/images/generations
 	// 如果 c.Endpoint 是 chat 端点，我们需要将其替换
 	// 这是一个简单的处理逻辑，实际可能需要更复杂的配置
@@ -537,7 +620,7 @@ func (c *OpenAIClient) GenerateImage(prompt string, size string, n int) ([]strin
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -583,6 +666,10 @@ func (c *OpenAIClient) GenerateImage(prompt string, size string, n int) ([]strin
 }
 
 func (c *OpenAIClient) TestConnection() error {
+	return c.TestConnectionContext(context.Background())
+}
+
+func (c *OpenAIClient) TestConnectionContext(ctx context.Context) error {
 	fmt.Printf("OpenAI: TestConnection called with BaseURL=%s, Endpoint=%s, Model=%s\n", c.BaseURL, c.Endpoint, c.Model)
 
 	messages := []ChatMessage{
@@ -592,7 +679,7 @@ func (c *OpenAIClient) TestConnection() error {
 		},
 	}
 
-	_, err := c.ChatCompletion(messages, WithMaxTokens(50))
+	_, err := c.ChatCompletionContext(ctx, messages, WithMaxTokens(50))
 	if err != nil {
 		fmt.Printf("OpenAI: TestConnection failed: %v\n", err)
 	} else {
@@ -618,3 +705,13 @@ func shouldRetryWithMaxCompletionTokens(err error, req *ChatCompletionRequest) b
 	}
 	return false
 }
+
+// shouldRetryWithoutResponseFormat 部分兼容网关或模型不支持 response_format / json_schema，去掉后重试一次
+func shouldRetryWithoutResponseFormat(err error, req *ChatCompletionRequest) bool {
+	if err == nil || req == nil || req.ResponseFormat == nil {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "response_format") || strings.Contains(msg, "json_schema")
+}
@@ -0,0 +1,97 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+func TestOpenAIClient_CancelAbortsInFlightRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hits := 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		time.AfterFunc(50*time.Millisecond, cancel)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewOpenAIClient(server.URL, "secret", "gpt-test", "")
+	start := time.Now()
+	_, err := client.GenerateTextContext(ctx, "hi", "")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected request to stop on cancel, took %s", elapsed)
+	}
+	if hits != 1 {
+		t.Fatalf("expected no retry after cancel, got %d requests", hits)
+	}
+}
+
+func TestOpenAIClient_StreamUsageIsReportedPerCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			http.Error(w, "include_usage not requested", http.StatusBadRequest)
+			return
+		}
+		// 以 prompt 长度作为输入 token，便于区分各次调用
+		prompt := len(req.Messages[len(req.Messages)-1].Content)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\n")
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":%d,\"completion_tokens\":1,\"total_tokens\":%d}}\n\n", prompt, prompt+1)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL, "secret", "gpt-test", "")
+	outerCtx, outer := usage.WithMeter(context.Background())
+
+	const calls = 8
+	meters := make([]*usage.Meter, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, meter := usage.WithMeter(outerCtx)
+			meters[i] = meter
+			if _, err := client.GenerateTextStreamContext(ctx, fmt.Sprintf("%0*d", i+1, 0), "", nil); err != nil {
+				t.Errorf("call %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	want := usage.TokenUsage{}
+	for i, meter := range meters {
+		expected := usage.TokenUsage{PromptTokens: i + 1, CompletionTokens: 1, TotalTokens: i + 2}
+		if got := meter.Total(); got != expected {
+			t.Fatalf("call %d: expected %+v, got %+v", i, expected, got)
+		}
+		want = want.Add(expected)
+	}
+	if got := outer.Total(); got != want {
+		t.Fatalf("expected outer meter to sum all calls %+v, got %+v", want, got)
+	}
+}
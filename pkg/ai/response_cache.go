@@ -0,0 +1,211 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+// ResponseCache 文本响应缓存存储，Get 未命中或已过期时返回 ok=false
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (text string, ok bool, err error)
+	Set(ctx context.Context, key string, text string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// WithResponseCache 本次调用允许使用响应缓存，仅对 CachedClient 的文本生成生效
+func WithResponseCache() func(*ChatCompletionRequest) {
+	return func(req *ChatCompletionRequest) {
+		req.useCache = true
+	}
+}
+
+// ResponseCacheKey 按隔离范围、服务商、模型、系统提示词、提示词和请求选项计算缓存键
+// scope 标识可以共享缓存的调用方（如用户与 AI 配置），不同 scope 的响应互不复用
+func ResponseCacheKey(scope, provider, model, systemPrompt, prompt string, options ...func(*ChatCompletionRequest)) string {
+	req := ChatCompletionRequest{}
+	for _, option := range options {
+		option(&req)
+	}
+	payload, _ := json.Marshal(struct {
+		Scope        string                `json:"scope"`
+		Provider     string                `json:"provider"`
+		Model        string                `json:"model"`
+		SystemPrompt string                `json:"system_prompt"`
+		Prompt       string                `json:"prompt"`
+		Options      ChatCompletionRequest `json:"options"`
+	}{scope, provider, model, systemPrompt, prompt, req})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// CachedClient 为显式声明 WithResponseCache 的文本调用提供缓存，其余调用直接透传
+type CachedClient struct {
+	client   AIClient
+	cache    ResponseCache
+	scope    string
+	provider string
+	model    string
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	lastHit   bool
+	hadMisses bool
+}
+
+func NewCachedClient(client AIClient, cache ResponseCache, scope, provider, model string, ttl time.Duration) *CachedClient {
+	return &CachedClient{client: client, cache: cache, scope: scope, provider: provider, model: model, ttl: ttl}
+}
+
+// Unwrap 返回被包装的客户端
+func (c *CachedClient) Unwrap() AIClient {
+	return c.client
+}
+
+// LastCallCached 最近一次文本生成是否直接使用了缓存
+func (c *CachedClient) LastCallCached() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastHit
+}
+
+// AllCallsCached 已发生的文本生成全部命中缓存，没有实际请求过模型
+func (c *CachedClient) AllCallsCached() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastHit && !c.hadMisses
+}
+
+func (c *CachedClient) recordCall(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastHit = hit
+	if !hit {
+		c.hadMisses = true
+	}
+}
+
+func (c *CachedClient) cacheKey(prompt, systemPrompt string, options []func(*ChatCompletionRequest)) (string, bool) {
+	req := ChatCompletionRequest{}
+	for _, option := range options {
+		option(&req)
+	}
+	if !req.useCache || c.cache == nil || c.ttl <= 0 {
+		return "", false
+	}
+	return ResponseCacheKey(c.scope, c.provider, c.model, systemPrompt, prompt, options...), true
+}
+
+func (c *CachedClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextContext(context.Background(), prompt, systemPrompt, options...)
+}
+
+// GenerateTextContext 缓存读写失败只记录日志，不影响模型调用
+func (c *CachedClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	key, ok := c.cacheKey(prompt, systemPrompt, options)
+	if !ok {
+		c.recordCall(false)
+		return c.client.GenerateTextContext(ctx, prompt, systemPrompt, options...)
+	}
+
+	text, hit, err := c.cache.Get(ctx, key)
+	if err != nil {
+		fmt.Printf("ResponseCache: get failed: %v\n", err)
+	}
+	if hit {
+		c.recordCall(true)
+		return text, nil
+	}
+
+	c.recordCall(false)
+	text, err = c.client.GenerateTextContext(ctx, prompt, systemPrompt, options...)
+	if err != nil {
+		return text, err
+	}
+	if setErr := c.cache.Set(ctx, key, text, c.ttl); setErr != nil {
+		fmt.Printf("ResponseCache: set failed: %v\n", setErr)
+	}
+	return text, nil
+}
+
+// Invalidate 删除一次调用对应的缓存，用于丢弃未通过业务校验的输出
+func (c *CachedClient) Invalidate(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) {
+	key, ok := c.cacheKey(prompt, systemPrompt, options)
+	if !ok {
+		return
+	}
+	if err := c.cache.Delete(ctx, key); err != nil {
+		fmt.Printf("ResponseCache: delete failed: %v\n", err)
+	}
+}
+
+func (c *CachedClient) GenerateTextStream(prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateTextStreamContext(context.Background(), prompt, systemPrompt, callback, options...)
+}
+
+// GenerateTextStreamContext 命中缓存时一次性把完整内容交给 callback
+func (c *CachedClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	key, ok := c.cacheKey(prompt, systemPrompt, options)
+	if !ok {
+		c.recordCall(false)
+		return c.client.GenerateTextStreamContext(ctx, prompt, systemPrompt, callback, options...)
+	}
+
+	text, hit, err := c.cache.Get(ctx, key)
+	if err != nil {
+		fmt.Printf("ResponseCache: get failed: %v\n", err)
+	}
+	if hit {
+		c.recordCall(true)
+		if callback != nil {
+			callback(text, len([]rune(text)), 1)
+		}
+		return text, nil
+	}
+
+	c.recordCall(false)
+	text, err = c.client.GenerateTextStreamContext(ctx, prompt, systemPrompt, callback, options...)
+	if err != nil {
+		return text, err
+	}
+	if setErr := c.cache.Set(ctx, key, text, c.ttl); setErr != nil {
+		fmt.Printf("ResponseCache: set failed: %v\n", setErr)
+	}
+	return text, nil
+}
+
+func (c *CachedClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return c.client.GenerateImage(prompt, size, n)
+}
+
+func (c *CachedClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	return c.client.GenerateImageContext(ctx, prompt, size, n)
+}
+
+func (c *CachedClient) TestConnection() error {
+	return c.client.TestConnection()
+}
+
+func (c *CachedClient) TestConnectionContext(ctx context.Context) error {
+	return c.client.TestConnectionContext(ctx)
+}
+
+// GetLastUsage 命中缓存时没有消耗 token
+func (c *CachedClient) GetLastUsage() usage.TokenUsage {
+	if c.LastCallCached() {
+		return usage.TokenUsage{}
+	}
+	return c.client.GetLastUsage()
+}
+
+// ServedFromCache client 为 CachedClient 且目前为止的调用全部命中缓存
+func ServedFromCache(client AIClient) bool {
+	cached, ok := client.(*CachedClient)
+	return ok && cached.AllCallsCached()
+}
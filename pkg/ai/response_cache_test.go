@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type memoryResponseCache struct {
+	entries map[string]string
+}
+
+func (c *memoryResponseCache) Get(_ context.Context, key string) (string, bool, error) {
+	text, ok := c.entries[key]
+	return text, ok, nil
+}
+
+func (c *memoryResponseCache) Set(_ context.Context, key string, text string, _ time.Duration) error {
+	c.entries[key] = text
+	return nil
+}
+
+func (c *memoryResponseCache) Delete(_ context.Context, key string) error {
+	delete(c.entries, key)
+	return nil
+}
+
+func TestResponseCacheKey_DependsOnRequestOptions(t *testing.T) {
+	base := ResponseCacheKey("user:1", "openai", "gpt", "sys", "prompt")
+	if base != ResponseCacheKey("user:1", "openai", "gpt", "sys", "prompt", WithResponseCache()) {
+		t.Fatalf("expected opt-in flag not to change the key")
+	}
+	for name, other := range map[string]string{
+		"scope":       ResponseCacheKey("user:2", "openai", "gpt", "sys", "prompt"),
+		"provider":    ResponseCacheKey("user:1", "gemini", "gpt", "sys", "prompt"),
+		"model":       ResponseCacheKey("user:1", "openai", "gpt-2", "sys", "prompt"),
+		"system":      ResponseCacheKey("user:1", "openai", "gpt", "sys2", "prompt"),
+		"temperature": ResponseCacheKey("user:1", "openai", "gpt", "sys", "prompt", WithTemperature(0.2)),
+	} {
+		if other == base {
+			t.Fatalf("expected %s to change the key", name)
+		}
+	}
+}
+
+func TestGenerateStructured_DropsCachedOutputThatFailsValidation(t *testing.T) {
+	inner := &scriptedClient{responses: []string{`{"name":""}`, `{"name":"林清"}`, `{"name":"林清"}`}}
+	cache := &memoryResponseCache{entries: map[string]string{}}
+	client := NewCachedClient(inner, cache, "user:1", "openai", "gpt", time.Hour)
+
+	var out struct {
+		Name string `json:"name"`
+	}
+	req := StructuredRequest{
+		Prompt: "extract",
+		Cache:  true,
+		Validate: func() error {
+			if out.Name == "" {
+				return errors.New("name 为空")
+			}
+			return nil
+		},
+	}
+	if _, err := GenerateStructured(client, req, &out); err != nil {
+		t.Fatalf("expected repair to succeed, got %v", err)
+	}
+	if len(cache.entries) != 1 {
+		t.Fatalf("expected only the valid output to stay cached, got %d entries", len(cache.entries))
+	}
+
+	if _, err := GenerateStructured(client, req, &out); err != nil {
+		t.Fatalf("expected second run to succeed, got %v", err)
+	}
+	if len(inner.prompts) != 3 || out.Name != "林清" {
+		t.Fatalf("expected invalid output not to be reused, got %d calls and %q", len(inner.prompts), out.Name)
+	}
+
+	fresh := NewCachedClient(inner, cache, "user:1", "openai", "gpt", time.Hour)
+	if _, err := GenerateStructured(fresh, req, &out); err != nil {
+		t.Fatalf("expected cached run to succeed, got %v", err)
+	}
+	if len(inner.prompts) != 3 || !ServedFromCache(fresh) {
+		t.Fatalf("expected valid output to be served from cache, got %d calls", len(inner.prompts))
+	}
+}
@@ -0,0 +1,270 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/drama-generator/backend/pkg/usage"
+	"github.com/drama-generator/backend/pkg/utils"
+)
+
+const (
+	defaultStructuredAttempts = 3
+	// structuredRepairPreviewRunes 重新请求时回传的上一次输出长度上限，避免重试 prompt 过长
+	structuredRepairPreviewRunes = 2000
+	// structuredArrayWrapperKey 数组结果在 response_format 中包装成对象的字段名（OpenAI 要求根节点为对象）
+	structuredArrayWrapperKey = "items"
+)
+
+// ErrStructuredOutputInvalid 多次请求后模型输出仍无法解析或未通过校验
+var ErrStructuredOutputInvalid = errors.New("结构化输出未通过校验")
+
+// StructuredRequest 结构化 JSON 输出请求
+type StructuredRequest struct {
+	Prompt       string
+	SystemPrompt string
+	// SchemaName response_format 中的 schema 名称，只能包含字母、数字、下划线和连字符
+	SchemaName string
+	// MaxAttempts 包含首次请求在内的最大请求次数，默认 3
+	MaxAttempts int
+	// Stream 使用流式接口请求，适合输出较长、可能超过普通请求超时的场景
+	Stream bool
+	// Cache 允许使用 CachedClient 的响应缓存，未通过校验的缓存会被删除
+	Cache   bool
+	Options []func(*ChatCompletionRequest)
+	// Validate 在 JSON 解析成功后执行业务校验，返回的错误会带入下一次请求
+	Validate func() error
+	// OnResponse 每次成功拿到模型输出后调用（无论能否通过校验），used 为这一次请求消耗的 token，用于逐次记录用量
+	OnResponse func(attempt int, text string, used usage.TokenUsage)
+}
+
+// GenerateStructured 请求模型按目标类型的 JSON Schema 输出并解析到 v。
+// 支持 response_format 的客户端会收到 schema 约束；解析或校验失败时把错误和上一次输出回传给模型重新生成，最多 MaxAttempts 次。
+// 模型调用本身的错误直接返回，不做重试。
+func GenerateStructured(client AIClient, req StructuredRequest, v interface{}) (string, error) {
+	return GenerateStructuredContext(context.Background(), client, req, v)
+}
+
+// GenerateStructuredContext ctx 取消后不再发起修复请求
+func GenerateStructuredContext(ctx context.Context, client AIClient, req StructuredRequest, v interface{}) (string, error) {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return "", fmt.Errorf("structured output target must be a non-nil pointer")
+	}
+
+	maxAttempts := req.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultStructuredAttempts
+	}
+	name := req.SchemaName
+	if name == "" {
+		name = "result"
+	}
+
+	options := append([]func(*ChatCompletionRequest){}, req.Options...)
+	options = append(options, WithJSONSchema(name, responseSchemaOf(target.Elem().Type())))
+	if req.Cache {
+		options = append(options, WithResponseCache())
+	}
+	invalidator, _ := client.(cacheInvalidator)
+
+	prompt := req.Prompt
+	var text string
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var err error
+		attemptCtx, meter := usage.WithMeter(ctx)
+		if req.Stream {
+			text, err = client.GenerateTextStreamContext(attemptCtx, prompt, req.SystemPrompt, nil, options...)
+		} else {
+			text, err = client.GenerateTextContext(attemptCtx, prompt, req.SystemPrompt, options...)
+		}
+		if err != nil {
+			return text, err
+		}
+		if req.OnResponse != nil {
+			req.OnResponse(attempt, text, meter.Total())
+		}
+
+		// 重置目标，避免上一次部分解析的字段残留
+		target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		lastErr = ParseStructuredJSON(text, v)
+		if lastErr == nil && req.Validate != nil {
+			lastErr = req.Validate()
+		}
+		if lastErr == nil {
+			return text, nil
+		}
+
+		fmt.Printf("StructuredOutput: %s attempt %d/%d failed: %v\n", name, attempt, maxAttempts, lastErr)
+		if req.Cache && invalidator != nil {
+			invalidator.Invalidate(ctx, prompt, req.SystemPrompt, options...)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return text, ctxErr
+		}
+		prompt = buildStructuredRepairPrompt(req.Prompt, text, lastErr)
+	}
+	return text, fmt.Errorf("%w（已尝试 %d 次）: %w", ErrStructuredOutputInvalid, maxAttempts, lastErr)
+}
+
+// cacheInvalidator 由 CachedClient 实现，用于丢弃未通过校验的缓存输出
+type cacheInvalidator interface {
+	Invalidate(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest))
+}
+
+// ParseStructuredJSON 解析模型返回的 JSON。目标为切片时，同时接受 {"items": [...]} 这类只包一层数组的对象
+func ParseStructuredJSON(text string, v interface{}) error {
+	err := utils.SafeParseAIJSON(text, v)
+	if err == nil {
+		return nil
+	}
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Slice {
+		return err
+	}
+
+	var wrapper map[string]json.RawMessage
+	if utils.SafeParseAIJSON(text, &wrapper) != nil {
+		return err
+	}
+	var arrays []json.RawMessage
+	for key, raw := range wrapper {
+		if !strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+			continue
+		}
+		if key == structuredArrayWrapperKey {
+			arrays = []json.RawMessage{raw}
+			break
+		}
+		arrays = append(arrays, raw)
+	}
+	if len(arrays) != 1 {
+		return err
+	}
+	if unwrapErr := json.Unmarshal(arrays[0], v); unwrapErr != nil {
+		return fmt.Errorf("JSON解析失败: %w", unwrapErr)
+	}
+	return nil
+}
+
+func buildStructuredRepairPrompt(originalPrompt, previousOutput string, validationErr error) string {
+	preview := []rune(previousOutput)
+	if len(preview) > structuredRepairPreviewRunes {
+		preview = append(preview[:structuredRepairPreviewRunes], []rune("...（已截断）")...)
+	}
+	return fmt.Sprintf(`%s
+
+【上一次输出未通过校验】
+错误：%v
+
+上一次输出：
+%s
+
+请根据原始要求重新输出完整、合法的 JSON，修正上述错误，不要输出任何解释或 Markdown 代码块。`, originalPrompt, validationErr, string(preview))
+}
+
+// responseSchemaOf 生成 response_format 使用的 schema，数组根节点包装为 {"items": [...]}
+func responseSchemaOf(t reflect.Type) map[string]interface{} {
+	schema := JSONSchemaOf(t)
+	if schema["type"] != "array" {
+		return schema
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{structuredArrayWrapperKey: schema},
+		"required":   []string{structuredArrayWrapperKey},
+	}
+}
+
+// JSONSchemaOf 根据 Go 类型和 json tag 生成 JSON Schema，未标记 omitempty 的非指针字段视为必填
+func JSONSchemaOf(t reflect.Type) map[string]interface{} {
+	return jsonSchemaOf(t, map[reflect.Type]bool{})
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func jsonSchemaOf(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}
+		}
+		return map[string]interface{}{"type": "array", "items": jsonSchemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		// 递归类型只展开一层
+		if visiting[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := map[string]interface{}{}
+		required := []string{}
+		collectStructProperties(t, visiting, properties, &required)
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func collectStructProperties(t reflect.Type, visiting map[reflect.Type]bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// 未命名的内嵌结构体字段按 encoding/json 的规则提升到外层
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectStructProperties(embedded, visiting, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = jsonSchemaOf(field.Type, visiting)
+		if !strings.Contains(","+opts+",", ",omitempty,") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+type scriptedClient struct {
+	responses []string
+	prompts   []string
+	options   []*ChatCompletionRequest
+}
+
+func (c *scriptedClient) GenerateText(prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	req := &ChatCompletionRequest{}
+	for _, option := range options {
+		option(req)
+	}
+	c.prompts = append(c.prompts, prompt)
+	c.options = append(c.options, req)
+	if len(c.prompts) > len(c.responses) {
+		return "", fmt.Errorf("unexpected call %d", len(c.prompts))
+	}
+	return c.responses[len(c.prompts)-1], nil
+}
+
+func (c *scriptedClient) GenerateTextStream(prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateText(prompt, systemPrompt, options...)
+}
+
+func (c *scriptedClient) GenerateImage(prompt string, size string, n int) ([]string, error) {
+	return nil, nil
+}
+
+func (c *scriptedClient) TestConnection() error { return nil }
+
+func (c *scriptedClient) GenerateTextContext(ctx context.Context, prompt string, systemPrompt string, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateText(prompt, systemPrompt, options...)
+}
+
+func (c *scriptedClient) GenerateTextStreamContext(ctx context.Context, prompt string, systemPrompt string, callback StreamCallback, options ...func(*ChatCompletionRequest)) (string, error) {
+	return c.GenerateText(prompt, systemPrompt, options...)
+}
+
+func (c *scriptedClient) GenerateImageContext(ctx context.Context, prompt string, size string, n int) ([]string, error) {
+	return nil, nil
+}
+
+func (c *scriptedClient) TestConnectionContext(ctx context.Context) error { return nil }
+
+func (c *scriptedClient) GetLastUsage() usage.TokenUsage { return usage.TokenUsage{} }
+
+type structuredShot struct {
+	ShotNumber int    `json:"shot_number"`
+	Action     string `json:"action"`
+	SceneID    *uint  `json:"scene_id"`
+	Note       string `json:"note,omitempty"`
+}
+
+func TestGenerateStructured_RepairsInvalidOutputWithValidationError(t *testing.T) {
+	client := &scriptedClient{responses: []string{
+		`[{"shot_number": "one", "action": "推门"}]`,
+		`[{"shot_number": 1, "action": ""}]`,
+		"```json\n{\"items\": [{\"shot_number\": 1, \"action\": \"推门而入\"}]}\n```",
+	}}
+
+	var shots []structuredShot
+	var attempts []int
+	_, err := GenerateStructured(client, StructuredRequest{
+		Prompt:     "拆分分镜",
+		SchemaName: "storyboards",
+		Validate: func() error {
+			for _, shot := range shots {
+				if shot.Action == "" {
+					return fmt.Errorf("镜头 %d 缺少 action", shot.ShotNumber)
+				}
+			}
+			return nil
+		},
+		OnResponse: func(attempt int, text string, _ usage.TokenUsage) { attempts = append(attempts, attempt) },
+	}, &shots)
+	if err != nil {
+		t.Fatalf("expected repair loop to succeed, got %v", err)
+	}
+	if len(shots) != 1 || shots[0].Action != "推门而入" {
+		t.Fatalf("unexpected result %+v", shots)
+	}
+	if fmt.Sprint(attempts) != "[1 2 3]" {
+		t.Fatalf("expected every response to be reported, got %v", attempts)
+	}
+	if !strings.HasPrefix(client.prompts[1], "拆分分镜") || !strings.Contains(client.prompts[1], "shot_number") {
+		t.Fatalf("expected repair prompt to carry the parse error, got %q", client.prompts[1])
+	}
+	if !strings.Contains(client.prompts[2], "镜头 1 缺少 action") {
+		t.Fatalf("expected repair prompt to carry the validation error, got %q", client.prompts[2])
+	}
+
+	format := client.options[0].ResponseFormat
+	if format == nil || format.Type != "json_schema" || format.JSONSchema.Name != "storyboards" {
+		t.Fatalf("expected json_schema response format, got %+v", format)
+	}
+	if format.JSONSchema.Schema["type"] != "object" {
+		t.Fatalf("expected array schema to be wrapped in an object, got %v", format.JSONSchema.Schema)
+	}
+}
+
+func TestGenerateStructured_GivesUpAfterMaxAttempts(t *testing.T) {
+	client := &scriptedClient{responses: []string{"不是 JSON", "还是不是"}}
+
+	var result struct {
+		Prompt string `json:"prompt"`
+	}
+	_, err := GenerateStructured(client, StructuredRequest{Prompt: "生成", MaxAttempts: 2}, &result)
+	if !errors.Is(err, ErrStructuredOutputInvalid) || !strings.Contains(err.Error(), "已尝试 2 次") {
+		t.Fatalf("expected bounded attempts error, got %v", err)
+	}
+	if len(client.prompts) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(client.prompts))
+	}
+}
+
+func TestJSONSchemaOf_RequiresNonOmitemptyFields(t *testing.T) {
+	schema := JSONSchemaOf(reflect.TypeOf([]structuredShot{}))
+	items := schema["items"].(map[string]interface{})
+	properties := items["properties"].(map[string]interface{})
+
+	if properties["shot_number"].(map[string]interface{})["type"] != "integer" {
+		t.Fatalf("unexpected shot_number schema %v", properties["shot_number"])
+	}
+	if fmt.Sprint(items["required"]) != "[shot_number action]" {
+		t.Fatalf("expected pointer and omitempty fields to be optional, got %v", items["required"])
+	}
+}
+
+func TestOpenAIClient_RetriesWithoutUnsupportedResponseFormat(t *testing.T) {
+	var formats []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		formats = append(formats, req.ResponseFormat != nil)
+		if req.ResponseFormat != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"response_format is not supported by this model","type":"invalid_request_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"{}"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL, "secret", "gpt-test", "")
+	if _, err := client.GenerateText("hi", "", WithJSONObject()); err != nil {
+		t.Fatalf("expected fallback without response_format, got %v", err)
+	}
+	if fmt.Sprint(formats) != "[true false]" {
+		t.Fatalf("expected one retry without response_format, got %v", formats)
+	}
+}
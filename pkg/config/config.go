@@ -12,17 +12,22 @@ type Config struct {
 	Server   ServerConfig   `mapstructure:"server"`
 	Database DatabaseConfig `mapstructure:"database"`
 	Storage  StorageConfig  `mapstructure:"storage"`
+	Imaging  ImagingConfig  `mapstructure:"imaging"`
 	AI       AIConfig       `mapstructure:"ai"`
 	Auth     AuthConfig     `mapstructure:"auth"`
 	Billing  BillingConfig  `mapstructure:"billing"`
 	MQ       MQConfig       `mapstructure:"mq"`
+	JobQueue JobQueueConfig `mapstructure:"job_queue"`
+	JobRetry JobRetryConfig `mapstructure:"job_retry"`
 }
 
 type AppConfig struct {
-	Name     string `mapstructure:"name"`
-	Version  string `mapstructure:"version"`
-	Debug    bool   `mapstructure:"debug"`
-	Language string `mapstructure:"language"` // zh 或 en
+	Name           string `mapstructure:"name"`
+	Version        string `mapstructure:"version"`
+	Debug          bool   `mapstructure:"debug"`
+	Language       string `mapstructure:"language"`         // 系统默认语言：zh、en 或已加载语言包的语言，用户和剧可单独设置
+	PromptPacksDir string `mapstructure:"prompt_packs_dir"` // 额外语言包目录（*.json），与内置 ja、ko 语言包同语言时替换之
+	FontFile       string `mapstructure:"font_file"`        // 时间线文字轨道渲染使用的字体文件，渲染中文时需要指定
 }
 
 type ServerConfig struct {
@@ -47,15 +52,70 @@ type DatabaseConfig struct {
 }
 
 type StorageConfig struct {
-	Type      string `mapstructure:"type"`       // local, minio
-	LocalPath string `mapstructure:"local_path"` // 本地存储路径
-	BaseURL   string `mapstructure:"base_url"`   // 访问URL前缀
+	Type        string `mapstructure:"type"`         // local, minio
+	LocalPath   string `mapstructure:"local_path"`   // 本地存储路径
+	BaseURL     string `mapstructure:"base_url"`     // 访问URL前缀
+	PrivatePath string `mapstructure:"private_path"` // 不通过 /static 提供访问的文件目录（如局部重绘蒙版），默认为 local_path 同级的 private 目录
+}
+
+// ImagingConfig 图片和视频首帧落盘后的本地处理：缩略图、放大、按视频画幅裁切或补边、水印和格式转换
+type ImagingConfig struct {
+	Disabled         bool                       `mapstructure:"disabled"`
+	ThumbnailSize    int                        `mapstructure:"thumbnail_size"`    // 缩略图长边像素，默认 320
+	ThumbnailFormat  string                     `mapstructure:"thumbnail_format"`  // jpeg、png、webp，默认 jpeg
+	OutputFormat     string                     `mapstructure:"output_format"`     // 处理后图片的格式，为空时保持原格式
+	MinSide          int                        `mapstructure:"min_side"`          // 短边小于该值时放大，0 不放大
+	AspectRatio      string                     `mapstructure:"aspect_ratio"`      // 分镜图的默认目标画幅，分镜已有视频生成时使用其画幅，都为空时不处理
+	AspectMode       string                     `mapstructure:"aspect_mode"`       // crop 居中裁切或 pad 补黑边，默认 crop
+	Watermark        WatermarkConfig            `mapstructure:"watermark"`         // 默认水印
+	TenantWatermarks map[string]WatermarkConfig `mapstructure:"tenant_watermarks"` // 按用户ID覆盖默认水印
+	CaptionFontFile  string                     `mapstructure:"caption_font_file"` // 多格拼图说明文字的字体，渲染中文时需要指定
+}
+
+// WatermarkConfig 图片水印
+type WatermarkConfig struct {
+	Disabled  bool    `mapstructure:"disabled"`   // 租户配置中用于关闭默认水印
+	ImagePath string  `mapstructure:"image_path"` // PNG 水印图，为空时不加水印
+	Position  string  `mapstructure:"position"`   // top_left、top_right、bottom_left、bottom_right、center，默认 bottom_right
+	Opacity   float64 `mapstructure:"opacity"`    // 0-1，默认 0.6
+	Scale     float64 `mapstructure:"scale"`      // 水印宽度占图片宽度的比例，默认 0.2
 }
 
 type AIConfig struct {
-	DefaultTextProvider  string `mapstructure:"default_text_provider"`
-	DefaultImageProvider string `mapstructure:"default_image_provider"`
-	DefaultVideoProvider string `mapstructure:"default_video_provider"`
+	DefaultTextProvider  string              `mapstructure:"default_text_provider"`
+	DefaultImageProvider string              `mapstructure:"default_image_provider"`
+	DefaultVideoProvider string              `mapstructure:"default_video_provider"`
+	Routing              AIRoutingConfig     `mapstructure:"routing"`
+	Timeouts             AITimeoutConfig     `mapstructure:"timeouts"`
+	Cache                AICacheConfig       `mapstructure:"cache"`
+	ScriptSkillsDir      string              `mapstructure:"script_skills_dir"` // 剧本润色技能 JSON 文件目录，为空时只用内置和数据库技能
+	Consistency          AIConsistencyConfig `mapstructure:"consistency"`
+}
+
+// AIConsistencyConfig 分镜图片和视频自动附带角色、道具、场景参考图，保持人物在各镜头间一致
+type AIConsistencyConfig struct {
+	Disabled           bool `mapstructure:"disabled"`             // 关闭后只使用请求中显式传入的参考图
+	MaxReferenceImages int  `mapstructure:"max_reference_images"` // 自动参考图上限，默认 4，同时受服务商上限约束
+}
+
+// AIRoutingConfig 同一模型存在多个 AI 配置时的故障转移与负载均衡
+type AIRoutingConfig struct {
+	LoadBalance      bool `mapstructure:"load_balance"`      // 同优先级的配置按权重轮询，权重取配置 settings 中的 weight
+	FailureThreshold int  `mapstructure:"failure_threshold"` // 连续失败多少次后熔断该配置
+	CooldownSeconds  int  `mapstructure:"cooldown_seconds"`  // 熔断时长，到期后放行一次探测请求
+}
+
+// AICacheConfig 文本调用的响应缓存，仅对提取、分镜提示词等显式开启缓存的调用生效
+type AICacheConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	TTLHours int  `mapstructure:"ttl_hours"` // 缓存有效期，默认 72 小时
+}
+
+// AITimeoutConfig 单次 AI 调用的超时秒数，0 表示不限制；故障转移时每个配置单独计时
+type AITimeoutConfig struct {
+	TextSeconds  int `mapstructure:"text_seconds"`  // 文本生成（流式请求为整个输出过程）
+	ImageSeconds int `mapstructure:"image_seconds"` // 图片生成请求
+	VideoSeconds int `mapstructure:"video_seconds"` // 视频任务提交，不含异步轮询
 }
 
 type AuthConfig struct {
@@ -67,6 +127,7 @@ type AuthConfig struct {
 type BillingConfig struct {
 	FramePromptCredits     int `mapstructure:"frame_prompt_credits"`
 	ImageGenerationCredits int `mapstructure:"image_generation_credits"`
+	LowCreditThreshold     int `mapstructure:"low_credit_threshold"` // 余额低于该值时触发 credits.low 事件
 }
 
 type MQConfig struct {
@@ -78,6 +139,28 @@ type MQConfig struct {
 	PrefetchCount       int    `mapstructure:"prefetch_count"`
 }
 
+// JobQueueConfig 未启用消息队列时使用的数据库任务队列
+type JobQueueConfig struct {
+	Concurrency    int `mapstructure:"concurrency"`
+	PollIntervalMs int `mapstructure:"poll_interval_ms"`
+	LeaseSeconds   int `mapstructure:"lease_seconds"` // 任务租约时长，执行中定期续约
+}
+
+// JobRetryConfig 任务失败后的退避重试，消息队列和数据库任务队列共用；未配置的项使用内置默认
+type JobRetryConfig struct {
+	Default  JobRetryPolicyConfig   `mapstructure:"default"`   // 没有单独策略的任务类型
+	JobTypes []JobRetryPolicyConfig `mapstructure:"job_types"` // 按任务类型覆盖，job_type 如 storyboard_generation.process
+}
+
+// JobRetryPolicyConfig 单个任务类型的重试策略，字段为 0 时沿用该任务类型的内置默认
+type JobRetryPolicyConfig struct {
+	JobType               string  `mapstructure:"job_type"`
+	MaxAttempts           int     `mapstructure:"max_attempts"` // 含首次执行，1 表示不重试
+	InitialBackoffSeconds int     `mapstructure:"initial_backoff_seconds"`
+	MaxBackoffSeconds     int     `mapstructure:"max_backoff_seconds"`
+	Multiplier            float64 `mapstructure:"multiplier"`
+}
+
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
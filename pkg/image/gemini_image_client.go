@@ -2,6 +2,7 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -20,16 +21,24 @@ type GeminiImageClient struct {
 	Model      string
 	Endpoint   string
 	HTTPClient *http.Client
-	lastUsage  usage.TokenUsage
+	lastUsage  usage.Last
 }
 
 type GeminiImageRequest struct {
 	Contents []struct {
 		Parts []GeminiPart `json:"parts"`
 	} `json:"contents"`
-	GenerationConfig struct {
-		ResponseModalities []string `json:"responseModalities"`
-	} `json:"generationConfig"`
+	GenerationConfig GeminiImageGenerationConfig `json:"generationConfig"`
+}
+
+type GeminiImageGenerationConfig struct {
+	ResponseModalities []string           `json:"responseModalities"`
+	ImageConfig        *GeminiImageConfig `json:"imageConfig,omitempty"`
+}
+
+// GeminiImageConfig 输出图片比例，如 9:16
+type GeminiImageConfig struct {
+	AspectRatio string `json:"aspectRatio,omitempty"`
 }
 
 type GeminiPart struct {
@@ -57,13 +66,31 @@ type GeminiImageResponse struct {
 	UsageMetadata struct {
 		PromptTokenCount     int `json:"promptTokenCount"`
 		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
 		TotalTokenCount      int `json:"totalTokenCount"`
 	} `json:"usageMetadata"`
 }
 
+// tokenUsage 图片按输出 token 计费，thoughtsTokenCount 计入输出
+func (r *GeminiImageResponse) tokenUsage() usage.TokenUsage {
+	tokenUsage := usage.TokenUsage{
+		PromptTokens:     r.UsageMetadata.PromptTokenCount,
+		CompletionTokens: r.UsageMetadata.CandidatesTokenCount + r.UsageMetadata.ThoughtsTokenCount,
+		TotalTokens:      r.UsageMetadata.TotalTokenCount,
+	}
+	if tokenUsage.TotalTokens == 0 {
+		tokenUsage.TotalTokens = tokenUsage.PromptTokens + tokenUsage.CompletionTokens
+	}
+	return tokenUsage
+}
+
 // downloadImageToBase64 下载图片 URL 并转换为 base64
-func downloadImageToBase64(imageURL string) (string, string, error) {
-	resp, err := httpclient.Default().Get(imageURL)
+func downloadImageToBase64(ctx context.Context, imageURL string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("create download request: %w", err)
+	}
+	resp, err := httpclient.Default().Do(req)
 	if err != nil {
 		return "", "", fmt.Errorf("download image: %w", err)
 	}
@@ -110,7 +137,11 @@ func NewGeminiImageClient(baseURL, apiKey, model, endpoint string) *GeminiImageC
 }
 
 func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error) {
-	c.lastUsage = usage.TokenUsage{}
+	return c.GenerateImageContext(context.Background(), prompt, opts...)
+}
+
+func (c *GeminiImageClient) GenerateImageContext(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
+	c.lastUsage.Reset()
 	options := &ImageOptions{
 		Size:    "1920x1920",
 		Quality: "standard",
@@ -146,7 +177,7 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 			// 检查是否是 HTTP/HTTPS URL
 			if strings.HasPrefix(refImg, "http://") || strings.HasPrefix(refImg, "https://") {
 				// 下载图片并转换为 base64
-				base64Data, mimeType, err = downloadImageToBase64(refImg)
+				base64Data, mimeType, err = downloadImageToBase64(ctx, refImg)
 				if err != nil {
 					continue
 				}
@@ -202,13 +233,16 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 				Parts: parts,
 			},
 		},
-		GenerationConfig: struct {
-			ResponseModalities []string `json:"responseModalities"`
-		}{
+		GenerationConfig: GeminiImageGenerationConfig{
 			ResponseModalities: []string{"IMAGE"},
 		},
 	}
 
+	return c.generateContent(ctx, model, reqBody)
+}
+
+// generateContent 发送 generateContent 请求并取出返回的第一张图片
+func (c *GeminiImageClient) generateContent(ctx context.Context, model string, reqBody GeminiImageRequest) (*ImageResult, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -218,7 +252,7 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	endpoint = replaceModelPlaceholder(endpoint, model)
 	url := fmt.Sprintf("%s?key=%s", endpoint, c.APIKey)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -248,24 +282,27 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("parse response: %w", err)
 	}
+	// 没有返回图片时同样消耗了 token
+	c.lastUsage.Set(ctx, result.tokenUsage())
 
 	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
 		return nil, fmt.Errorf("no image generated in response")
 	}
 
-	base64Data := result.Candidates[0].Content.Parts[0].InlineData.Data
+	// 编辑时模型常先返回一段说明文字，取第一张图片
+	var base64Data string
+	for _, part := range result.Candidates[0].Content.Parts {
+		if part.InlineData.Data != "" {
+			base64Data = part.InlineData.Data
+			break
+		}
+	}
 	if base64Data == "" {
 		return nil, fmt.Errorf("no base64 image data in response")
 	}
 
 	dataURI := fmt.Sprintf("data:image/jpeg;base64,%s", base64Data)
 
-	c.lastUsage = usage.TokenUsage{
-		PromptTokens:     result.UsageMetadata.PromptTokenCount,
-		CompletionTokens: result.UsageMetadata.CandidatesTokenCount,
-		TotalTokens:      result.UsageMetadata.TotalTokenCount,
-	}
-
 	return &ImageResult{
 		Status:    "completed",
 		ImageURL:  dataURI,
@@ -276,11 +313,20 @@ func (c *GeminiImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 }
 
 func (c *GeminiImageClient) GetTaskStatus(taskID string) (*ImageResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *GeminiImageClient) GetTaskStatusContext(ctx context.Context, taskID string) (*ImageResult, error) {
 	return nil, fmt.Errorf("not supported for Gemini (synchronous generation)")
 }
 
 func (c *GeminiImageClient) GetLastUsage() usage.TokenUsage {
-	return c.lastUsage
+	return c.lastUsage.Get()
+}
+
+// ReferenceCapabilities 参考图以 inlineData 附在请求中，超过 3 张后人物一致性明显下降
+func (c *GeminiImageClient) ReferenceCapabilities() ReferenceCapabilities {
+	return ReferenceCapabilities{MaxReferenceImages: 3}
 }
 
 func replaceModelPlaceholder(endpoint, model string) string {
@@ -290,3 +336,68 @@ func replaceModelPlaceholder(endpoint, model string) string {
 	}
 	return result
 }
+
+// EditImageContext 以原图（和蒙版）作为 inlineData 发起对话式编辑，扩图通过 imageConfig 指定输出比例
+func (c *GeminiImageClient) EditImageContext(ctx context.Context, req *EditRequest, opts ...ImageOption) (*ImageResult, error) {
+	c.lastUsage.Reset()
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	model := c.Model
+	if options.Model != "" {
+		model = options.Model
+	}
+
+	parts := []GeminiPart{geminiImagePart(req.Image)}
+	instruction := editPrompt(req)
+	var imageConfig *GeminiImageConfig
+	switch req.Operation {
+	case EditInpaint:
+		if len(req.Mask) == 0 {
+			return nil, fmt.Errorf("inpaint requires a mask")
+		}
+		parts = append(parts, geminiImagePart(req.Mask))
+		instruction = "The second image is a mask for the first image. Only repaint the areas that are transparent in the mask and keep everything else unchanged. " + req.Prompt
+	case EditOutpaint:
+		if _, _, err := ParseAspectRatio(req.AspectRatio); err != nil {
+			return nil, err
+		}
+		imageConfig = &GeminiImageConfig{AspectRatio: req.AspectRatio}
+	case EditVariation:
+	default:
+		return nil, ErrEditNotSupported
+	}
+	parts = append(parts, GeminiPart{Text: instruction})
+
+	reqBody := GeminiImageRequest{
+		Contents: []struct {
+			Parts []GeminiPart `json:"parts"`
+		}{
+			{
+				Parts: parts,
+			},
+		},
+		GenerationConfig: GeminiImageGenerationConfig{
+			ResponseModalities: []string{"IMAGE"},
+			ImageConfig:        imageConfig,
+		},
+	}
+	result, err := c.generateContent(ctx, model, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	// 编辑结果的尺寸由服务商决定，不沿用默认值
+	result.Width, result.Height = 0, 0
+	return result, nil
+}
+
+func geminiImagePart(data []byte) GeminiPart {
+	return GeminiPart{
+		InlineData: &GeminiInlineData{
+			MimeType: http.DetectContentType(data),
+			Data:     base64.StdEncoding.EncodeToString(data),
+		},
+	}
+}
@@ -1,13 +1,32 @@
 package image
 
-import "github.com/drama-generator/backend/pkg/usage"
+import (
+	"context"
 
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+// ImageClient 图片生成客户端，Context 方法在 ctx 取消或超时时中止请求
 type ImageClient interface {
 	GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error)
 	GetTaskStatus(taskID string) (*ImageResult, error)
+	GenerateImageContext(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error)
+	GetTaskStatusContext(ctx context.Context, taskID string) (*ImageResult, error)
+	// GetLastUsage 并发调用时不可靠，计费应通过 usage.WithMeter 获取每次调用自己的用量
 	GetLastUsage() usage.TokenUsage
 }
 
+// ReferenceCapabilities 客户端对参考图和 seed 的支持情况，MaxReferenceImages 为 0 表示不接受参考图
+type ReferenceCapabilities struct {
+	MaxReferenceImages int
+	Seed               bool
+}
+
+// ReferenceCapable 支持参考图或 seed 的客户端实现，分镜图片据此自动注入角色参考图
+type ReferenceCapable interface {
+	ReferenceCapabilities() ReferenceCapabilities
+}
+
 type ImageResult struct {
 	TaskID    string
 	Status    string
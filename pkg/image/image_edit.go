@@ -0,0 +1,115 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/drama-generator/backend/pkg/imaging"
+)
+
+// ErrEditNotSupported 客户端不支持图片编辑
+var ErrEditNotSupported = errors.New("image edit not supported by provider")
+
+// EditOperation 图片编辑类型
+type EditOperation string
+
+const (
+	EditInpaint   EditOperation = "inpaint"   // 按蒙版局部重绘
+	EditOutpaint  EditOperation = "outpaint"  // 扩图到新的画面比例
+	EditVariation EditOperation = "variation" // 生成相似变体
+)
+
+func (op EditOperation) Valid() bool {
+	switch op {
+	case EditInpaint, EditOutpaint, EditVariation:
+		return true
+	}
+	return false
+}
+
+// EditRequest 图片编辑请求。Mask 为 PNG，透明像素是需要重绘的区域，与 OpenAI /images/edits 一致
+type EditRequest struct {
+	Operation   EditOperation
+	Image       []byte
+	Mask        []byte
+	Prompt      string
+	AspectRatio string // 扩图的目标比例，如 9:16
+}
+
+// ImageEditor 支持图片编辑的客户端实现
+type ImageEditor interface {
+	EditImageContext(ctx context.Context, req *EditRequest, opts ...ImageOption) (*ImageResult, error)
+}
+
+// ParseAspectRatio 解析 "9:16" 形式的画面比例
+func ParseAspectRatio(ratio string) (int, int, error) {
+	return imaging.ParseAspectRatio(ratio)
+}
+
+// PadToAspect 把图片居中放到目标比例的透明画布上，返回画布和对应蒙版（原图区域不透明，新增区域透明）
+func PadToAspect(data []byte, ratio string) ([]byte, []byte, error) {
+	ratioW, ratioH, err := ParseAspectRatio(ratio)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	canvas := imaging.PadToAspect(src, ratioW, ratioH, color.Transparent)
+	canvasW, canvasH := canvas.Rect.Dx(), canvas.Rect.Dy()
+	offset := stdimage.Pt((canvasW-bounds.Dx())/2, (canvasH-bounds.Dy())/2)
+	placed := stdimage.Rectangle{Min: offset, Max: offset.Add(bounds.Size())}
+
+	mask := stdimage.NewNRGBA(stdimage.Rect(0, 0, canvasW, canvasH))
+	draw.Draw(mask, placed, stdimage.NewUniform(color.NRGBA{A: 255}), stdimage.Point{}, draw.Src)
+
+	canvasPNG, err := encodePNG(canvas)
+	if err != nil {
+		return nil, nil, err
+	}
+	maskPNG, err := encodePNG(mask)
+	if err != nil {
+		return nil, nil, err
+	}
+	return canvasPNG, maskPNG, nil
+}
+
+// imageAspect 图片宽高，解析失败返回 0
+func imageAspect(data []byte) (int, int) {
+	cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+func encodePNG(img stdimage.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// editPrompt 为扩图和变体补充说明，用户没有填写提示词时也能直接调用
+func editPrompt(req *EditRequest) string {
+	switch req.Operation {
+	case EditOutpaint:
+		return strings.TrimSpace(fmt.Sprintf("Extend the image to a %s aspect ratio. Keep the original content unchanged and continue the scene naturally into the new areas. %s", req.AspectRatio, req.Prompt))
+	case EditVariation:
+		return strings.TrimSpace("Create a variation of this image that keeps the subject, composition and style, with small changes in details. " + req.Prompt)
+	}
+	return req.Prompt
+}
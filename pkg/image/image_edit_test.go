@@ -0,0 +1,82 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	stdimage "image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPadToAspect_ExtendsCanvasWithTransparentMask(t *testing.T) {
+	canvas, mask, err := PadToAspect(testPNG(t, 160, 90), "9:16")
+	if err != nil {
+		t.Fatalf("failed to pad: %v", err)
+	}
+	if width, height := imageAspect(canvas); width != 160 || height != 285 {
+		t.Fatalf("expected 160x285 canvas, got %dx%d", width, height)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(mask))
+	if err != nil {
+		t.Fatalf("failed to decode mask: %v", err)
+	}
+	if _, _, _, a := decoded.At(80, 10).RGBA(); a != 0 {
+		t.Fatalf("expected new area to be transparent in the mask")
+	}
+	if _, _, _, a := decoded.At(80, 142).RGBA(); a == 0 {
+		t.Fatalf("expected original area to be kept by the mask")
+	}
+
+	if _, _, err := PadToAspect(testPNG(t, 10, 10), "wide"); err == nil {
+		t.Fatalf("expected invalid aspect ratio to fail")
+	}
+}
+
+func TestGeminiImageClient_EditSendsImageAndAspectRatio(t *testing.T) {
+	var captured GeminiImageRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&captured); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		fmt.Fprint(w, `{"candidates":[{"content":{"parts":[{"text":"done"},{"inlineData":{"mimeType":"image/png","data":"aW1n"}}]}}]}`)
+	}))
+	defer server.Close()
+
+	client := NewGeminiImageClient(server.URL, "secret", "gemini-image", "/models/{model}:generateContent")
+	result, err := client.EditImageContext(context.Background(), &EditRequest{
+		Operation:   EditOutpaint,
+		Image:       testPNG(t, 16, 9),
+		AspectRatio: "9:16",
+	})
+	if err != nil {
+		t.Fatalf("failed to edit: %v", err)
+	}
+	if result.ImageURL != "data:image/jpeg;base64,aW1n" {
+		t.Fatalf("expected image part after the text part, got %s", result.ImageURL)
+	}
+	parts := captured.Contents[0].Parts
+	if len(parts) != 2 || parts[0].InlineData == nil || parts[0].InlineData.MimeType != "image/png" {
+		t.Fatalf("expected source image followed by instruction, got %+v", parts)
+	}
+	if captured.GenerationConfig.ImageConfig == nil || captured.GenerationConfig.ImageConfig.AspectRatio != "9:16" {
+		t.Fatalf("expected target aspect ratio, got %+v", captured.GenerationConfig)
+	}
+
+	if _, err := client.EditImageContext(context.Background(), &EditRequest{Operation: EditInpaint, Image: testPNG(t, 4, 4)}); err == nil {
+		t.Fatalf("expected inpaint without mask to fail")
+	}
+}
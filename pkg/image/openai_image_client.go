@@ -2,10 +2,14 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"strings"
 	"time"
 
 	"github.com/drama-generator/backend/pkg/usage"
@@ -17,7 +21,7 @@ type OpenAIImageClient struct {
 	Model      string
 	Endpoint   string
 	HTTPClient *http.Client
-	lastUsage  usage.TokenUsage
+	lastUsage  usage.Last
 }
 
 type DALLERequest struct {
@@ -33,8 +37,14 @@ type DALLEResponse struct {
 	Created int64 `json:"created"`
 	Data    []struct {
 		URL           string `json:"url"`
+		B64JSON       string `json:"b64_json,omitempty"`
 		RevisedPrompt string `json:"revised_prompt,omitempty"`
 	} `json:"data"`
+	Usage *struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage,omitempty"`
 }
 
 func NewOpenAIImageClient(baseURL, apiKey, model, endpoint string) *OpenAIImageClient {
@@ -53,7 +63,11 @@ func NewOpenAIImageClient(baseURL, apiKey, model, endpoint string) *OpenAIImageC
 }
 
 func (c *OpenAIImageClient) GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error) {
-	c.lastUsage = usage.TokenUsage{}
+	return c.GenerateImageContext(context.Background(), prompt, opts...)
+}
+
+func (c *OpenAIImageClient) GenerateImageContext(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
+	c.lastUsage.Reset()
 	options := &ImageOptions{
 		Size:    "1920x1920",
 		Quality: "standard",
@@ -86,7 +100,7 @@ func (c *OpenAIImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 	fmt.Printf("[OpenAI Image] Request URL: %s\n", url)
 	fmt.Printf("[OpenAI Image] Request Body: %s\n", string(jsonData))
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -128,9 +142,176 @@ func (c *OpenAIImageClient) GenerateImage(prompt string, opts ...ImageOption) (*
 }
 
 func (c *OpenAIImageClient) GetTaskStatus(taskID string) (*ImageResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *OpenAIImageClient) GetTaskStatusContext(ctx context.Context, taskID string) (*ImageResult, error) {
 	return nil, fmt.Errorf("not supported for OpenAI/DALL-E")
 }
 
 func (c *OpenAIImageClient) GetLastUsage() usage.TokenUsage {
-	return c.lastUsage
+	return c.lastUsage.Get()
+}
+
+func (c *OpenAIImageClient) ReferenceCapabilities() ReferenceCapabilities {
+	return ReferenceCapabilities{MaxReferenceImages: 4}
+}
+
+// EditImageContext 通过 /images/edits 局部重绘或扩图；dall-e-2 的变体使用 /images/variations，其它模型以编辑方式生成变体
+func (c *OpenAIImageClient) EditImageContext(ctx context.Context, req *EditRequest, opts ...ImageOption) (*ImageResult, error) {
+	c.lastUsage.Reset()
+	options := &ImageOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	model := c.Model
+	if options.Model != "" {
+		model = options.Model
+	}
+
+	imageData, maskData := req.Image, req.Mask
+	path := "edits"
+	switch req.Operation {
+	case EditInpaint:
+		if len(maskData) == 0 {
+			return nil, fmt.Errorf("inpaint requires a mask")
+		}
+	case EditOutpaint:
+		canvas, mask, err := PadToAspect(imageData, req.AspectRatio)
+		if err != nil {
+			return nil, err
+		}
+		imageData, maskData = canvas, mask
+	case EditVariation:
+		maskData = nil
+		if model == "dall-e-2" {
+			path = "variations"
+		}
+	default:
+		return nil, ErrEditNotSupported
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"model": model,
+		"n":     "1",
+		"size":  openAIEditSize(model, imageData),
+	}
+	if path == "edits" {
+		fields["prompt"] = editPrompt(req)
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, fmt.Errorf("write form field: %w", err)
+		}
+	}
+	if err := writeFormImage(writer, "image", imageData); err != nil {
+		return nil, err
+	}
+	if len(maskData) > 0 {
+		if err := writeFormImage(writer, "mask", maskData); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("close form: %w", err)
+	}
+
+	url := c.BaseURL + c.imageEndpoint(path)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, &body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+	httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var result DALLEResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if result.Usage != nil {
+		c.lastUsage.Set(ctx, usage.TokenUsage{
+			PromptTokens:     result.Usage.InputTokens,
+			CompletionTokens: result.Usage.OutputTokens,
+			TotalTokens:      result.Usage.TotalTokens,
+		})
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("no image generated")
+	}
+
+	imageURL := result.Data[0].URL
+	if imageURL == "" && result.Data[0].B64JSON != "" {
+		imageURL = "data:image/png;base64," + result.Data[0].B64JSON
+	}
+	if imageURL == "" {
+		return nil, fmt.Errorf("no image data in response")
+	}
+	width, height := imageAspect(imageData)
+	return &ImageResult{
+		Status:    "completed",
+		ImageURL:  imageURL,
+		Width:     width,
+		Height:    height,
+		Completed: true,
+	}, nil
+}
+
+// imageEndpoint 由生成接口地址推出同一前缀下的 edits、variations 地址
+func (c *OpenAIImageClient) imageEndpoint(name string) string {
+	if i := strings.LastIndex(c.Endpoint, "/generations"); i >= 0 {
+		return c.Endpoint[:i] + "/" + name + c.Endpoint[i+len("/generations"):]
+	}
+	return "/v1/images/" + name
+}
+
+// openAIEditSize 编辑接口只接受固定尺寸，按输入图片的横竖选择；dall-e-2 只支持正方形
+func openAIEditSize(model string, data []byte) string {
+	width, height := imageAspect(data)
+	switch {
+	case model == "dall-e-2" || width == height:
+		return "1024x1024"
+	case width > height:
+		return "1536x1024"
+	default:
+		return "1024x1536"
+	}
+}
+
+func writeFormImage(writer *multipart.Writer, field string, data []byte) error {
+	mimeType := http.DetectContentType(data)
+	ext := ".png"
+	switch mimeType {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/webp":
+		ext = ".webp"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s%s"`, field, field, ext))
+	header.Set("Content-Type", mimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("write form file: %w", err)
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -18,7 +19,7 @@ type VolcEngineImageClient struct {
 	Endpoint      string
 	QueryEndpoint string
 	HTTPClient    *http.Client
-	lastUsage     usage.TokenUsage
+	lastUsage     usage.Last
 }
 
 type VolcEngineImageRequest struct {
@@ -66,7 +67,11 @@ func NewVolcEngineImageClient(baseURL, apiKey, model, endpoint, queryEndpoint st
 }
 
 func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption) (*ImageResult, error) {
-	c.lastUsage = usage.TokenUsage{}
+	return c.GenerateImageContext(context.Background(), prompt, opts...)
+}
+
+func (c *VolcEngineImageClient) GenerateImageContext(ctx context.Context, prompt string, opts ...ImageOption) (*ImageResult, error) {
+	c.lastUsage.Reset()
 	options := &ImageOptions{
 		Size:    "1920x1920",
 		Quality: "standard",
@@ -113,7 +118,7 @@ func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption
 	fmt.Printf("[VolcEngine Image] Request URL: %s\n", url)
 	fmt.Printf("[VolcEngine Image] Request Body: %s\n", string(jsonData))
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -151,11 +156,11 @@ func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption
 		return nil, fmt.Errorf("no image generated")
 	}
 
-	c.lastUsage = usage.TokenUsage{
+	c.lastUsage.Set(ctx, usage.TokenUsage{
 		PromptTokens:     0,
 		CompletionTokens: result.Usage.OutputTokens,
 		TotalTokens:      result.Usage.TotalTokens,
-	}
+	})
 
 	return &ImageResult{
 		Status:    "completed",
@@ -165,11 +170,20 @@ func (c *VolcEngineImageClient) GenerateImage(prompt string, opts ...ImageOption
 }
 
 func (c *VolcEngineImageClient) GetTaskStatus(taskID string) (*ImageResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *VolcEngineImageClient) GetTaskStatusContext(ctx context.Context, taskID string) (*ImageResult, error) {
 	return nil, fmt.Errorf("not supported for VolcEngine Seedream (synchronous generation)")
 }
 
 func (c *VolcEngineImageClient) GetLastUsage() usage.TokenUsage {
-	return c.lastUsage
+	return c.lastUsage.Get()
+}
+
+// ReferenceCapabilities Seedream 多图融合最多接受 10 张参考图
+func (c *VolcEngineImageClient) ReferenceCapabilities() ReferenceCapabilities {
+	return ReferenceCapabilities{MaxReferenceImages: 10}
 }
 
 func boolPtr(v bool) *bool {
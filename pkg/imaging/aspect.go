@@ -0,0 +1,54 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// CropToAspect 居中裁切到目标比例
+func CropToAspect(img image.Image, ratioW, ratioH int) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	cropW, cropH := width, height
+	if width*ratioH > height*ratioW {
+		cropW = height * ratioW / ratioH
+	} else {
+		cropH = width * ratioH / ratioW
+	}
+	if cropW == width && cropH == height {
+		return toNRGBA(img)
+	}
+	if cropW < 1 {
+		cropW = 1
+	}
+	if cropH < 1 {
+		cropH = 1
+	}
+
+	origin := bounds.Min.Add(image.Pt((width-cropW)/2, (height-cropH)/2))
+	dst := image.NewNRGBA(image.Rect(0, 0, cropW, cropH))
+	draw.Draw(dst, dst.Bounds(), img, origin, draw.Src)
+	return dst
+}
+
+// PadToAspect 居中放到目标比例的纯色画布上，只扩展不裁剪
+func PadToAspect(img image.Image, ratioW, ratioH int, background color.Color) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	canvasW, canvasH := width, height
+	if width*ratioH > height*ratioW {
+		canvasH = (width*ratioH + ratioW - 1) / ratioW
+	} else {
+		canvasW = (height*ratioW + ratioH - 1) / ratioH
+	}
+	if canvasW == width && canvasH == height {
+		return toNRGBA(img)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, canvasW, canvasH))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	offset := image.Pt((canvasW-width)/2, (canvasH-height)/2)
+	draw.Draw(dst, image.Rectangle{Min: offset, Max: offset.Add(bounds.Size())}, img, bounds.Min, draw.Over)
+	return dst
+}
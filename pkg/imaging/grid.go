@@ -0,0 +1,91 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// ParseGridLayout 解析多格布局：horizontal_N 为一行 N 格，vertical_N 为一列 N 格，grid_CxR 为 C 列 R 行
+func ParseGridLayout(layout string) (columns, rows int, err error) {
+	name, size, ok := strings.Cut(strings.ToLower(strings.TrimSpace(layout)), "_")
+	if ok {
+		switch name {
+		case "horizontal", "vertical":
+			if n, convErr := strconv.Atoi(size); convErr == nil && n > 0 {
+				if name == "horizontal" {
+					return n, 1, nil
+				}
+				return 1, n, nil
+			}
+		case "grid":
+			c, r, found := strings.Cut(size, "x")
+			cols, colErr := strconv.Atoi(c)
+			rowCount, rowErr := strconv.Atoi(r)
+			if found && colErr == nil && rowErr == nil && cols > 0 && rowCount > 0 {
+				return cols, rowCount, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid grid layout: %q", layout)
+}
+
+// GridOptions 多格拼图参数
+type GridOptions struct {
+	Columns       int
+	Rows          int
+	Gutter        int         // 格间距和外边距，像素
+	CaptionHeight int         // 每格下方留给说明文字的高度，0 不留
+	Background    color.Color // 默认白色
+}
+
+// GridCell 一格在拼图中的位置
+type GridCell struct {
+	Panel   image.Rectangle
+	Caption image.Rectangle // 未留说明文字区域时为空
+}
+
+// ComposeGrid 按行优先顺序把各格拼成网格。格子尺寸取第一格，其余各格居中裁切到同一比例后缩放
+func ComposeGrid(panels []image.Image, opts GridOptions) (*image.NRGBA, []GridCell, error) {
+	if len(panels) == 0 {
+		return nil, nil, fmt.Errorf("no panels to compose")
+	}
+	if opts.Columns <= 0 || opts.Rows <= 0 || len(panels) > opts.Columns*opts.Rows {
+		return nil, nil, fmt.Errorf("%d panels do not fit a %dx%d grid", len(panels), opts.Columns, opts.Rows)
+	}
+	gutter := max(opts.Gutter, 0)
+	captionHeight := max(opts.CaptionHeight, 0)
+	background := opts.Background
+	if background == nil {
+		background = color.White
+	}
+
+	cellW, cellH := panels[0].Bounds().Dx(), panels[0].Bounds().Dy()
+	if cellW == 0 || cellH == 0 {
+		return nil, nil, fmt.Errorf("empty panel image")
+	}
+	width := opts.Columns*cellW + (opts.Columns+1)*gutter
+	height := opts.Rows*(cellH+captionHeight) + (opts.Rows+1)*gutter
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	cells := make([]GridCell, 0, len(panels))
+	for i, panel := range panels {
+		col, row := i%opts.Columns, i/opts.Columns
+		origin := image.Pt(gutter+col*(cellW+gutter), gutter+row*(cellH+captionHeight+gutter))
+		cell := GridCell{Panel: image.Rectangle{Min: origin, Max: origin.Add(image.Pt(cellW, cellH))}}
+		if captionHeight > 0 {
+			cell.Caption = image.Rect(cell.Panel.Min.X, cell.Panel.Max.Y, cell.Panel.Max.X, cell.Panel.Max.Y+captionHeight)
+		}
+
+		if size := panel.Bounds().Size(); size.X != cellW || size.Y != cellH {
+			panel = Resize(CropToAspect(panel, cellW, cellH), cellW, cellH)
+		}
+		draw.Draw(canvas, cell.Panel, panel, panel.Bounds().Min, draw.Over)
+		cells = append(cells, cell)
+	}
+	return canvas, cells, nil
+}
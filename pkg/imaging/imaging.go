@@ -0,0 +1,119 @@
+// Package imaging 纯 Go 实现的本地图片处理：缩放、按画幅裁切或补边、水印和格式转换
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format 输出图片格式
+type Format string
+
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+)
+
+const defaultJPEGQuality = 90
+
+// ParseFormat 解析格式名，支持 png、jpg、jpeg、webp
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), ".")) {
+	case "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "webp":
+		return FormatWebP, nil
+	}
+	return "", fmt.Errorf("unsupported image format: %q", name)
+}
+
+// Ext 文件扩展名，带点
+func (f Format) Ext() string {
+	if f == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// Decode 解码 PNG、JPEG、GIF 图片，返回的格式是重新编码时应使用的格式（GIF 转为 PNG）
+func Decode(data []byte) (image.Image, Format, error) {
+	img, name, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image: %w", err)
+	}
+	if name == "jpeg" {
+		return img, FormatJPEG, nil
+	}
+	return img, FormatPNG, nil
+}
+
+// Encode 按指定格式编码。JPEG 不支持透明，透明区域铺白底
+func Encode(w io.Writer, img image.Image, format Format) error {
+	switch format {
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatJPEG:
+		return jpeg.Encode(w, flatten(img, color.White), &jpeg.Options{Quality: defaultJPEGQuality})
+	case FormatWebP:
+		return EncodeWebP(w, img)
+	}
+	return fmt.Errorf("unsupported image format: %q", format)
+}
+
+// EncodeBytes 编码为字节
+func EncodeBytes(img image.Image, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseAspectRatio 解析 "9:16" 形式的画面比例
+func ParseAspectRatio(ratio string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(ratio), ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio: %q", ratio)
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio: %q", ratio)
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio: %q", ratio)
+	}
+	return width, height, nil
+}
+
+// toNRGBA 转为原点在 (0,0) 的 NRGBA，已是该格式时直接返回
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// flatten 把图片铺到纯色底上，去掉透明度
+func flatten(img image.Image, background color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
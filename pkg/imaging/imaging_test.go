@@ -0,0 +1,188 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func solidImage(width, height int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestResizeAndAspect(t *testing.T) {
+	src := solidImage(400, 200, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+
+	thumb := Thumbnail(src, 100)
+	if thumb.Rect.Dx() != 100 || thumb.Rect.Dy() != 50 {
+		t.Fatalf("expected 100x50 thumbnail, got %v", thumb.Rect)
+	}
+	if got := thumb.NRGBAAt(50, 25); got != (color.NRGBA{R: 200, G: 100, B: 50, A: 255}) {
+		t.Fatalf("expected solid color to survive resampling, got %v", got)
+	}
+	if up := Upscale(src, 400); up.Bounds().Dx() != 800 || up.Bounds().Dy() != 400 {
+		t.Fatalf("expected short side upscaled to 400, got %v", up.Bounds())
+	}
+
+	if cropped := CropToAspect(src, 9, 16); cropped.Rect.Dx() != 112 || cropped.Rect.Dy() != 200 {
+		t.Fatalf("expected 112x200 crop, got %v", cropped.Rect)
+	}
+	padded := PadToAspect(src, 1, 1, color.Black)
+	if padded.Rect.Dx() != 400 || padded.Rect.Dy() != 400 {
+		t.Fatalf("expected 400x400 canvas, got %v", padded.Rect)
+	}
+	if padded.NRGBAAt(200, 10).R != 0 || padded.NRGBAAt(200, 200).R != 200 {
+		t.Fatalf("expected source centered on black bars")
+	}
+}
+
+func TestApplyWatermark(t *testing.T) {
+	src := solidImage(200, 100, color.NRGBA{A: 255})
+	mark := solidImage(10, 5, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+
+	out := ApplyWatermark(src, Watermark{Mark: mark, Opacity: 1, Scale: 0.1})
+	// 20x10 的水印，右下角留 4 像素边距
+	if got := out.NRGBAAt(185, 90); got.R != 255 {
+		t.Fatalf("expected watermark in the bottom right corner, got %v", got)
+	}
+	if got := out.NRGBAAt(10, 10); got.R != 0 {
+		t.Fatalf("expected the rest of the image untouched, got %v", got)
+	}
+	if src.NRGBAAt(185, 90).R != 0 {
+		t.Fatalf("expected the source image to be left unchanged")
+	}
+
+	out = ApplyWatermark(src, Watermark{Mark: mark, Position: PositionTopLeft, Opacity: 0.5, Scale: 0.1})
+	if got := out.NRGBAAt(10, 8); got.R < 120 || got.R > 135 {
+		t.Fatalf("expected half transparent watermark at the top left, got %v", got)
+	}
+}
+
+func TestEncodeFormats(t *testing.T) {
+	src := solidImage(8, 8, color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+	for _, format := range []Format{FormatPNG, FormatJPEG} {
+		data, err := EncodeBytes(src, format)
+		if err != nil {
+			t.Fatalf("failed to encode %s: %v", format, err)
+		}
+		if _, decoded, err := Decode(data); err != nil || decoded != format {
+			t.Fatalf("expected %s round trip, got %s (%v)", format, decoded, err)
+		}
+	}
+	if format, err := ParseFormat(".JPG"); err != nil || format != FormatJPEG || format.Ext() != ".jpg" {
+		t.Fatalf("unexpected format %q (%v)", format, err)
+	}
+	if _, err := ParseFormat("bmp"); err == nil {
+		t.Fatalf("expected bmp to be rejected")
+	}
+}
+
+func TestEncodeWebP_LosslessRoundTrip(t *testing.T) {
+	cases := map[string]*image.NRGBA{
+		"solid":       solidImage(3, 2, color.NRGBA{R: 1, G: 2, B: 3, A: 255}),
+		"transparent": solidImage(5, 5, color.NRGBA{}),
+	}
+	gradient := image.NewNRGBA(image.Rect(0, 0, 37, 23))
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			gradient.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 7), G: uint8(y * 11), B: uint8(x * y), A: uint8(255 - x)})
+		}
+	}
+	cases["gradient"] = gradient
+	noise := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	seed := uint32(1)
+	for i := range noise.Pix {
+		seed = seed*1664525 + 1013904223
+		noise.Pix[i] = uint8(seed >> 24)
+	}
+	cases["noise"] = noise
+	// 少量颜色重复出现的条纹，覆盖回溯引用和颜色缓存
+	stripes := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	palette := []color.NRGBA{{R: 255, A: 255}, {G: 200, A: 255}, {B: 90, A: 128}, {R: 30, G: 60, B: 90, A: 255}}
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			stripes.SetNRGBA(x, y, palette[(x/7+y/5+x*y%3)%len(palette)])
+		}
+	}
+	cases["stripes"] = stripes
+
+	for name, src := range cases {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, src); err != nil {
+			t.Fatalf("%s: failed to encode: %v", name, err)
+		}
+		decoded, err := webp.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+		if decoded.Bounds() != src.Bounds() {
+			t.Fatalf("%s: expected bounds %v, got %v", name, src.Bounds(), decoded.Bounds())
+		}
+		for y := 0; y < src.Rect.Dy(); y++ {
+			for x := 0; x < src.Rect.Dx(); x++ {
+				if got := color.NRGBAModel.Convert(decoded.At(x, y)); got != src.NRGBAAt(x, y) {
+					t.Fatalf("%s: pixel (%d,%d) expected %v, got %v", name, x, y, src.NRGBAAt(x, y), got)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeWebP_CompressesRepeatedPixels(t *testing.T) {
+	stripes := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+	for y := 0; y < 512; y++ {
+		for x := 0; x < 512; x++ {
+			stripes.SetNRGBA(x, y, color.NRGBA{R: uint8(x / 16 * 8), G: uint8(y / 32 * 16), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, stripes); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	// 原始像素 1MB，回溯引用后应远小于逐像素霍夫曼编码的体积
+	if buf.Len() > 8*1024 {
+		t.Fatalf("expected repeated rows to compress, got %d bytes", buf.Len())
+	}
+}
+
+func TestComposeGrid(t *testing.T) {
+	for layout, want := range map[string][2]int{"horizontal_3": {3, 1}, "vertical_2": {1, 2}, "grid_3x3": {3, 3}} {
+		if cols, rows, err := ParseGridLayout(layout); err != nil || cols != want[0] || rows != want[1] {
+			t.Fatalf("%s: unexpected grid %dx%d (%v)", layout, cols, rows, err)
+		}
+	}
+	for _, layout := range []string{"", "horizontal_0", "grid_3", "diagonal_3"} {
+		if _, _, err := ParseGridLayout(layout); err == nil {
+			t.Fatalf("expected %q to be rejected", layout)
+		}
+	}
+
+	red := solidImage(40, 30, color.NRGBA{R: 255, A: 255})
+	blue := solidImage(80, 30, color.NRGBA{B: 255, A: 255})
+	canvas, cells, err := ComposeGrid([]image.Image{red, blue, red}, GridOptions{Columns: 2, Rows: 2, Gutter: 5, CaptionHeight: 10})
+	if err != nil {
+		t.Fatalf("failed to compose: %v", err)
+	}
+	if canvas.Rect.Dx() != 95 || canvas.Rect.Dy() != 95 {
+		t.Fatalf("expected 95x95 canvas, got %v", canvas.Rect)
+	}
+	if cells[1].Panel != image.Rect(50, 5, 90, 35) || cells[2].Caption != image.Rect(5, 80, 45, 90) {
+		t.Fatalf("unexpected cells: %+v", cells)
+	}
+	if got := canvas.NRGBAAt(70, 20); got.B != 255 {
+		t.Fatalf("expected the wide panel cropped into its cell, got %v", got)
+	}
+	if got := canvas.NRGBAAt(2, 2); got != (color.NRGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Fatalf("expected white gutters, got %v", got)
+	}
+	if _, _, err := ComposeGrid([]image.Image{red, red, red}, GridOptions{Columns: 2, Rows: 1}); err == nil {
+		t.Fatalf("expected too many panels to be rejected")
+	}
+}
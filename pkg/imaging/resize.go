@@ -0,0 +1,174 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+// Resize 使用 Catmull-Rom 插值缩放到指定尺寸，缩小时按比例放宽采样窗口避免锯齿
+func Resize(img image.Image, width, height int) *image.NRGBA {
+	if width <= 0 || height <= 0 {
+		return image.NewNRGBA(image.Rect(0, 0, 0, 0))
+	}
+	src := toNRGBA(img)
+	srcW, srcH := src.Rect.Dx(), src.Rect.Dy()
+	if srcW == 0 || srcH == 0 {
+		return image.NewNRGBA(image.Rect(0, 0, width, height))
+	}
+	if srcW == width && srcH == height {
+		return src
+	}
+
+	// 在预乘 alpha 空间插值，透明像素的颜色不会渗到边缘
+	pixels := make([]float64, srcW*srcH*4)
+	for y := 0; y < srcH; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x := 0; x < srcW; x++ {
+			i, o := x*4, (y*srcW+x)*4
+			a := float64(row[i+3]) / 255
+			pixels[o] = float64(row[i]) * a
+			pixels[o+1] = float64(row[i+1]) * a
+			pixels[o+2] = float64(row[i+2]) * a
+			pixels[o+3] = float64(row[i+3])
+		}
+	}
+
+	columns := resampleWeights(srcW, width)
+	horizontal := make([]float64, width*srcH*4)
+	for y := 0; y < srcH; y++ {
+		for x, c := range columns {
+			o := (y*width + x) * 4
+			for k, w := range c.weights {
+				i := (y*srcW + c.start + k) * 4
+				horizontal[o] += pixels[i] * w
+				horizontal[o+1] += pixels[i+1] * w
+				horizontal[o+2] += pixels[i+2] * w
+				horizontal[o+3] += pixels[i+3] * w
+			}
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rows := resampleWeights(srcH, height)
+	for y, c := range rows {
+		for x := 0; x < width; x++ {
+			var r, g, b, a float64
+			for k, w := range c.weights {
+				i := ((c.start+k)*width + x) * 4
+				r += horizontal[i] * w
+				g += horizontal[i+1] * w
+				b += horizontal[i+2] * w
+				a += horizontal[i+3] * w
+			}
+			o := y*dst.Stride + x*4
+			alpha := clampChannel(a)
+			dst.Pix[o+3] = alpha
+			if alpha == 0 {
+				continue
+			}
+			scale := 255 / float64(alpha)
+			dst.Pix[o] = clampChannel(r * scale)
+			dst.Pix[o+1] = clampChannel(g * scale)
+			dst.Pix[o+2] = clampChannel(b * scale)
+		}
+	}
+	return dst
+}
+
+// Fit 等比缩小到不超过 maxWidth x maxHeight，不放大
+func Fit(img image.Image, maxWidth, maxHeight int) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxWidth && height <= maxHeight {
+		return toNRGBA(img)
+	}
+	scale := math.Min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	return Resize(img, scaledSize(width, scale), scaledSize(height, scale))
+}
+
+// Thumbnail 长边不超过 size 的缩略图
+func Thumbnail(img image.Image, size int) *image.NRGBA {
+	return Fit(img, size, size)
+}
+
+// Upscale 短边小于 minSide 时等比放大到 minSide，否则原样返回
+func Upscale(img image.Image, minSide int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	short := width
+	if height < short {
+		short = height
+	}
+	if short == 0 || short >= minSide {
+		return img
+	}
+	scale := float64(minSide) / float64(short)
+	return Resize(img, scaledSize(width, scale), scaledSize(height, scale))
+}
+
+func scaledSize(size int, scale float64) int {
+	if scaled := int(math.Round(float64(size) * scale)); scaled > 0 {
+		return scaled
+	}
+	return 1
+}
+
+type resampleWeight struct {
+	start   int
+	weights []float64
+}
+
+// resampleWeights 每个输出像素对应的输入像素区间和归一化权重
+func resampleWeights(srcSize, dstSize int) []resampleWeight {
+	scale := float64(srcSize) / float64(dstSize)
+	filterScale := math.Max(scale, 1)
+	radius := 2 * filterScale
+
+	result := make([]resampleWeight, dstSize)
+	for i := range result {
+		center := (float64(i) + 0.5) * scale
+		start := int(math.Floor(center - radius))
+		end := int(math.Ceil(center + radius))
+		if start < 0 {
+			start = 0
+		}
+		if end > srcSize {
+			end = srcSize
+		}
+		weights := make([]float64, 0, end-start)
+		var sum float64
+		for j := start; j < end; j++ {
+			w := catmullRom((float64(j) + 0.5 - center) / filterScale)
+			weights = append(weights, w)
+			sum += w
+		}
+		if sum != 0 {
+			for k := range weights {
+				weights[k] /= sum
+			}
+		}
+		result[i] = resampleWeight{start: start, weights: weights}
+	}
+	return result
+}
+
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return (1.5*x-2.5)*x*x + 1
+	case x < 2:
+		return ((-0.5*x+2.5)*x-4)*x + 2
+	}
+	return 0
+}
+
+func clampChannel(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
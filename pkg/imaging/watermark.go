@@ -0,0 +1,83 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Position 水印位置
+type Position string
+
+const (
+	PositionTopLeft     Position = "top_left"
+	PositionTopRight    Position = "top_right"
+	PositionBottomLeft  Position = "bottom_left"
+	PositionBottomRight Position = "bottom_right"
+	PositionCenter      Position = "center"
+)
+
+const (
+	defaultWatermarkOpacity = 0.6
+	defaultWatermarkScale   = 0.2
+	watermarkMarginRatio    = 0.02
+)
+
+// Watermark 图片水印，Opacity 和 Scale 为 0 时使用默认值 0.6 和 0.2
+type Watermark struct {
+	Mark     image.Image
+	Position Position
+	Opacity  float64 // 0-1
+	Scale    float64 // 水印宽度占底图宽度的比例
+}
+
+// ApplyWatermark 按位置把水印叠加到图片上，返回新图片
+func ApplyWatermark(img image.Image, wm Watermark) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	if wm.Mark == nil || dst.Rect.Empty() || wm.Mark.Bounds().Empty() {
+		return dst
+	}
+
+	opacity := wm.Opacity
+	if opacity <= 0 || opacity > 1 {
+		opacity = defaultWatermarkOpacity
+	}
+	scale := wm.Scale
+	if scale <= 0 || scale > 1 {
+		scale = defaultWatermarkScale
+	}
+
+	markBounds := wm.Mark.Bounds()
+	markW := scaledSize(dst.Rect.Dx(), scale)
+	markH := scaledSize(markBounds.Dy(), float64(markW)/float64(markBounds.Dx()))
+	if markH > dst.Rect.Dy() {
+		markW = scaledSize(markW, float64(dst.Rect.Dy())/float64(markH))
+		markH = dst.Rect.Dy()
+	}
+	mark := Resize(wm.Mark, markW, markH)
+
+	margin := int(math.Round(float64(dst.Rect.Dx()) * watermarkMarginRatio))
+	right := dst.Rect.Dx() - markW - margin
+	bottom := dst.Rect.Dy() - markH - margin
+	var origin image.Point
+	switch wm.Position {
+	case PositionTopLeft:
+		origin = image.Pt(margin, margin)
+	case PositionTopRight:
+		origin = image.Pt(right, margin)
+	case PositionBottomLeft:
+		origin = image.Pt(margin, bottom)
+	case PositionCenter:
+		origin = image.Pt((dst.Rect.Dx()-markW)/2, (dst.Rect.Dy()-markH)/2)
+	default:
+		origin = image.Pt(right, bottom)
+	}
+
+	alpha := image.NewUniform(color.Alpha{A: uint8(math.Round(opacity * 255))})
+	target := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(markW, markH))}
+	draw.DrawMask(dst, target, mark, image.Point{}, alpha, image.Point{}, draw.Over)
+	return dst
+}
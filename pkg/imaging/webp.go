@@ -0,0 +1,661 @@
+package imaging
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+)
+
+// WebP 无损格式（VP8L）常量
+const (
+	vp8lSignature      = 0x2f
+	vp8lMaxSize        = 1 << 14
+	vp8lPredictor      = 0
+	vp8lSubtractGreen  = 2
+	vp8lPredictorBits  = 5 // 预测模式按 32x32 分块选择
+	vp8lMaxCodeLength  = 15
+	vp8lMaxCLCodeLen   = 7
+	vp8lLengthCodes    = 24
+	vp8lColorAlphabet  = 256
+	vp8lDistAlphabet   = 40
+	vp8lNumCodeLengths = 19
+	vp8lCacheBits      = 10
+	vp8lPlaneCodes     = 120 // 二维邻域距离码个数
+	vp8lMinLength      = 3
+	vp8lMaxLength      = 4096
+	vp8lMaxDistance    = 1<<20 - vp8lPlaneCodes
+	vp8lHashBits       = 16
+	vp8lMaxChain       = 32
+)
+
+var vp8lCodeLengthOrder = [vp8lNumCodeLengths]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lPlaneTable 距离码 1~120 对应的邻域偏移，按 yOffset<<4 | (8-xOffset) 存放
+var vp8lPlaneTable = [vp8lPlaneCodes]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// vp8lToken 一个字面量像素、颜色缓存命中或回溯引用
+type vp8lToken struct {
+	argb   uint32 // 字面量像素，减绿后的 ARGB
+	cache  int    // 颜色缓存下标，-1 表示未命中
+	length int    // 回溯长度，0 表示字面量
+	dist   int    // 距离码
+}
+
+// EncodeWebP 编码为无损 WebP：减绿和分块预测变换后用 LZ77 回溯引用和颜色缓存去重，再做逐通道霍夫曼编码
+func EncodeWebP(w io.Writer, img image.Image) error {
+	src := toNRGBA(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	if width == 0 || height == 0 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return fmt.Errorf("webp: unsupported image size %dx%d", width, height)
+	}
+
+	// 减绿变换后红、蓝通道多集中在 0 附近，霍夫曼编码更短
+	argb := make([]uint32, 0, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x := 0; x < width; x++ {
+			r, g, b, a := row[x*4], row[x*4+1], row[x*4+2], row[x*4+3]
+			argb = append(argb, uint32(a)<<24|uint32(r-g)<<16|uint32(g)<<8|uint32(b-g))
+			if a != 0xff {
+				hasAlpha = true
+			}
+		}
+	}
+	residuals, modes := vp8lPredict(argb, width, height)
+
+	bw := &bitWriter{}
+	bw.writeBits(vp8lSignature, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if hasAlpha {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(0, 3) // version
+	bw.writeBits(1, 1) // 有变换
+	bw.writeBits(vp8lSubtractGreen, 2)
+	bw.writeBits(1, 1)
+	bw.writeBits(vp8lPredictor, 2)
+	bw.writeBits(vp8lPredictorBits-2, 3)
+	modeTokens := make([]vp8lToken, len(modes))
+	for i, mode := range modes {
+		modeTokens[i] = vp8lToken{argb: 0xff000000 | uint32(mode)<<8, cache: -1}
+	}
+	bw.writeBits(0, 1) // 预测模式子图不使用颜色缓存
+	writeEntropyImage(bw, modeTokens, 0)
+	bw.writeBits(0, 1) // 没有更多变换
+
+	bw.writeBits(1, 1) // 使用颜色缓存
+	bw.writeBits(vp8lCacheBits, 4)
+	bw.writeBits(0, 1) // 不使用元前缀码
+	writeEntropyImage(bw, vp8lColorCache(residuals, vp8lBackwardRefs(residuals, width)), vp8lCacheBits)
+	data := bw.flush()
+
+	padding := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(12+len(data)+padding))
+	copy(header[8:16], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// writeEntropyImage 统计直方图，写入五组前缀码和像素流。cacheBits 为 0 表示不使用颜色缓存
+func writeEntropyImage(bw *bitWriter, tokens []vp8lToken, cacheBits int) {
+	greenAlphabet := 256 + vp8lLengthCodes
+	if cacheBits > 0 {
+		greenAlphabet += 1 << cacheBits
+	}
+	histograms := [5][]int{
+		make([]int, greenAlphabet),
+		make([]int, vp8lColorAlphabet),
+		make([]int, vp8lColorAlphabet),
+		make([]int, vp8lColorAlphabet),
+		make([]int, vp8lDistAlphabet),
+	}
+	for _, token := range tokens {
+		switch {
+		case token.length > 0:
+			lengthPrefix, _, _ := vp8lPrefix(token.length)
+			distPrefix, _, _ := vp8lPrefix(token.dist)
+			histograms[0][256+lengthPrefix]++
+			histograms[4][distPrefix]++
+		case token.cache >= 0:
+			histograms[0][256+vp8lLengthCodes+token.cache]++
+		default:
+			histograms[0][token.argb>>8&0xff]++
+			histograms[1][token.argb>>16&0xff]++
+			histograms[2][token.argb&0xff]++
+			histograms[3][token.argb>>24]++
+		}
+	}
+
+	var codes [5][]huffmanCode
+	for i, histogram := range histograms {
+		codes[i] = writeHuffmanCode(bw, histogram)
+	}
+	for _, token := range tokens {
+		switch {
+		case token.length > 0:
+			prefix, extraBits, extra := vp8lPrefix(token.length)
+			bw.writeCode(codes[0][256+prefix])
+			bw.writeBits(uint32(extra), uint(extraBits))
+			prefix, extraBits, extra = vp8lPrefix(token.dist)
+			bw.writeCode(codes[4][prefix])
+			bw.writeBits(uint32(extra), uint(extraBits))
+		case token.cache >= 0:
+			bw.writeCode(codes[0][256+vp8lLengthCodes+token.cache])
+		default:
+			bw.writeCode(codes[0][token.argb>>8&0xff])
+			bw.writeCode(codes[1][token.argb>>16&0xff])
+			bw.writeCode(codes[2][token.argb&0xff])
+			bw.writeCode(codes[3][token.argb>>24])
+		}
+	}
+}
+
+// vp8lPredict 每个分块在左、上、Select 三种预测里选残差最小的一种，返回残差和各分块的模式。
+// 首行、首列按规范固定用左、上预测，左上角用不透明黑色
+func vp8lPredict(argb []uint32, width, height int) ([]uint32, []uint8) {
+	tilesX := (width + 1<<vp8lPredictorBits - 1) >> vp8lPredictorBits
+	tilesY := (height + 1<<vp8lPredictorBits - 1) >> vp8lPredictorBits
+	modes := make([]uint8, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := uint8(vp8lPredictLeft), -1
+			for _, mode := range []uint8{vp8lPredictLeft, vp8lPredictTop, vp8lPredictSelect} {
+				cost := 0
+				for y := max(ty<<vp8lPredictorBits, 1); y < min((ty+1)<<vp8lPredictorBits, height); y++ {
+					for x := max(tx<<vp8lPredictorBits, 1); x < min((tx+1)<<vp8lPredictorBits, width); x++ {
+						cost += vp8lResidualCost(vp8lSubPixels(argb[y*width+x], vp8lPrediction(argb, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = best
+		}
+	}
+
+	residuals := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var prediction uint32
+			switch {
+			case x == 0 && y == 0:
+				prediction = 0xff000000
+			case y == 0:
+				prediction = argb[x-1]
+			case x == 0:
+				prediction = argb[(y-1)*width]
+			default:
+				prediction = vp8lPrediction(argb, width, x, y, modes[(y>>vp8lPredictorBits)*tilesX+x>>vp8lPredictorBits])
+			}
+			residuals[y*width+x] = vp8lSubPixels(argb[y*width+x], prediction)
+		}
+	}
+	return residuals, modes
+}
+
+// 使用到的预测模式
+const (
+	vp8lPredictLeft   = 1
+	vp8lPredictTop    = 2
+	vp8lPredictSelect = 11
+)
+
+func vp8lPrediction(argb []uint32, width, x, y int, mode uint8) uint32 {
+	left, top := argb[y*width+x-1], argb[(y-1)*width+x]
+	switch mode {
+	case vp8lPredictLeft:
+		return left
+	case vp8lPredictTop:
+		return top
+	}
+	// Select：左、上两个像素里离梯度估计 L+T-TL 更近的一个
+	topLeft := argb[(y-1)*width+x-1]
+	distance := 0
+	for shift := 0; shift < 32; shift += 8 {
+		l, t, tl := int(left>>shift&0xff), int(top>>shift&0xff), int(topLeft>>shift&0xff)
+		distance += abs(t-tl) - abs(l-tl)
+	}
+	if distance < 0 {
+		return left
+	}
+	return top
+}
+
+// vp8lSubPixels 逐通道相减，按 256 取模
+func vp8lSubPixels(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		out |= (a>>shift - b>>shift) & 0xff << shift
+	}
+	return out
+}
+
+// vp8lResidualCost 残差按有符号字节取绝对值求和，用于比较预测模式
+func vp8lResidualCost(residual uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += abs(int(int8(residual >> shift)))
+	}
+	return cost
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// vp8lBackwardRefs 用哈希链贪心查找重复像素串，返回字面量和回溯引用
+func vp8lBackwardRefs(argb []uint32, width int) []vp8lToken {
+	n := len(argb)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	insert := func(pos int) {
+		if pos+1 < n {
+			h := vp8lPairHash(argb[pos], argb[pos+1])
+			prev[pos], head[h] = head[h], int32(pos)
+		}
+	}
+
+	planeCodes := vp8lDistanceToPlaneCodes(width)
+	tokens := make([]vp8lToken, 0, n/2)
+	for i := 0; i < n; {
+		bestLength, bestDistance := 0, 0
+		if i+1 < n {
+			limit := min(vp8lMaxLength, n-i)
+			candidate := head[vp8lPairHash(argb[i], argb[i+1])]
+			for chain := 0; candidate >= 0 && chain < vp8lMaxChain && i-int(candidate) <= vp8lMaxDistance; chain++ {
+				length := 0
+				for length < limit && argb[int(candidate)+length] == argb[i+length] {
+					length++
+				}
+				if length > bestLength {
+					bestLength, bestDistance = length, i-int(candidate)
+					if length == limit {
+						break
+					}
+				}
+				candidate = prev[candidate]
+			}
+		}
+
+		if bestLength < vp8lMinLength {
+			tokens = append(tokens, vp8lToken{argb: argb[i], cache: -1})
+			insert(i)
+			i++
+			continue
+		}
+		dist, ok := planeCodes[bestDistance]
+		if !ok {
+			dist = bestDistance + vp8lPlaneCodes
+		}
+		tokens = append(tokens, vp8lToken{cache: -1, length: bestLength, dist: dist})
+		for end := i + bestLength; i < end; i++ {
+			insert(i)
+		}
+	}
+	return tokens
+}
+
+// vp8lColorCache 按解码器的顺序维护颜色缓存，缓存中已有的字面量改为缓存下标
+func vp8lColorCache(argb []uint32, tokens []vp8lToken) []vp8lToken {
+	var cache [1 << vp8lCacheBits]uint32
+	pos := 0
+	for i, token := range tokens {
+		if token.length > 0 {
+			for end := pos + token.length; pos < end; pos++ {
+				cache[vp8lCacheKey(argb[pos])] = argb[pos]
+			}
+			continue
+		}
+		key := vp8lCacheKey(token.argb)
+		if cache[key] == token.argb {
+			tokens[i].cache = int(key)
+		}
+		cache[key] = token.argb
+		pos++
+	}
+	return tokens
+}
+
+func vp8lCacheKey(argb uint32) uint32 {
+	return (0x1e35a7bd * argb) >> (32 - vp8lCacheBits)
+}
+
+func vp8lPairHash(a, b uint32) uint32 {
+	return ((a*0x1e35a7bd + b) * 0x9e3779b1) >> (32 - vp8lHashBits)
+}
+
+// vp8lDistanceToPlaneCodes 线性距离到邻域距离码的映射，同一距离取较小的码
+func vp8lDistanceToPlaneCodes(width int) map[int]int {
+	codes := make(map[int]int, vp8lPlaneCodes)
+	for i, v := range vp8lPlaneTable {
+		dist := int(v>>4)*width + 8 - int(v&0xf)
+		if dist < 1 {
+			dist = 1
+		}
+		if _, ok := codes[dist]; !ok {
+			codes[dist] = i + 1
+		}
+	}
+	return codes
+}
+
+// vp8lPrefix 把长度或距离码（从 1 开始）拆成前缀码、额外比特数和额外比特值
+func vp8lPrefix(v int) (prefix, extraBits, extra int) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	highest := bits.Len(uint(d)) - 1
+	extraBits = highest - 1
+	return 2*highest + (d>>extraBits)&1, extraBits, d & (1<<extraBits - 1)
+}
+
+// writeHuffmanCode 写入一个前缀码并返回各符号的码字。最多两个 8 位以内的符号时使用简单码
+func writeHuffmanCode(bw *bitWriter, histogram []int) []huffmanCode {
+	var symbols []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		symbols = []int{0}
+	}
+
+	lengths := make([]uint8, len(histogram))
+	if len(symbols) <= 2 && symbols[len(symbols)-1] < 256 {
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(symbols[0]), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			bw.writeBits(uint32(symbols[1]), 8)
+			lengths[symbols[0]], lengths[symbols[1]] = 1, 1
+		}
+		// 只有一个符号时码长为 0，写像素时不占位
+		return canonicalCodes(lengths)
+	}
+
+	if len(symbols) == 1 {
+		// 唯一符号超出简单码范围时补一个不会用到的符号，码长都为 1
+		lengths[symbols[0]] = 1
+		lengths[symbols[0]^1] = 1
+	} else {
+		lengths = huffmanLengths(histogram, vp8lMaxCodeLength)
+	}
+	tokens := codeLengthTokens(lengths)
+	clHistogram := make([]int, vp8lNumCodeLengths)
+	for _, token := range tokens {
+		clHistogram[token.code]++
+	}
+	clLengths := huffmanLengths(clHistogram, vp8lMaxCLCodeLen)
+	clSymbols, used := 0, 0
+	for code, count := range clHistogram {
+		if count > 0 {
+			clSymbols, used = clSymbols+1, code
+		}
+	}
+	if clSymbols == 1 {
+		// 码长码只有一个符号时补一个不会用到的符号保证码表完整
+		other := 0
+		if used == 0 {
+			other = 1
+		}
+		clLengths[used], clLengths[other] = 1, 1
+	}
+
+	numCodes := vp8lNumCodeLengths
+	for numCodes > 4 && clLengths[vp8lCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	bw.writeBits(0, 1)
+	bw.writeBits(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.writeBits(uint32(clLengths[vp8lCodeLengthOrder[i]]), 3)
+	}
+	bw.writeBits(0, 1) // 码长覆盖整个字母表
+	clCodes := canonicalCodes(clLengths)
+	for _, token := range tokens {
+		bw.writeCode(clCodes[token.code])
+		bw.writeBits(uint32(token.extra), uint(token.extraBits))
+	}
+	return canonicalCodes(lengths)
+}
+
+// codeLengthToken 码长序列的游程编码：0~15 为码长，16 重复上一个非零码长，17、18 为连续的 0
+type codeLengthToken struct {
+	code      int
+	extraBits int
+	extra     int
+}
+
+func codeLengthTokens(lengths []uint8) []codeLengthToken {
+	var tokens []codeLengthToken
+	for i := 0; i < len(lengths); {
+		value := int(lengths[i])
+		run := 1
+		for i+run < len(lengths) && int(lengths[i+run]) == value {
+			run++
+		}
+		i += run
+
+		if value == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					count := min(run, 138)
+					tokens = append(tokens, codeLengthToken{code: 18, extraBits: 7, extra: count - 11})
+					run -= count
+				} else {
+					count := min(run, 10)
+					tokens = append(tokens, codeLengthToken{code: 17, extraBits: 3, extra: count - 3})
+					run -= count
+				}
+			}
+		} else {
+			tokens = append(tokens, codeLengthToken{code: value})
+			run--
+			for run >= 3 {
+				count := min(run, 6)
+				tokens = append(tokens, codeLengthToken{code: 16, extraBits: 2, extra: count - 3})
+				run -= count
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, codeLengthToken{code: value})
+		}
+	}
+	return tokens
+}
+
+type huffmanCode struct {
+	bits   uint32 // 已按写入顺序反转
+	length uint8
+}
+
+// canonicalCodes 按码长和符号顺序分配范式霍夫曼码
+func canonicalCodes(lengths []uint8) []huffmanCode {
+	var counts [vp8lMaxCodeLength + 1]int
+	for _, length := range lengths {
+		if length > 0 {
+			counts[length]++
+		}
+	}
+	var next [vp8lMaxCodeLength + 1]uint32
+	code := uint32(0)
+	for bits := 1; bits <= vp8lMaxCodeLength; bits++ {
+		code = (code + uint32(counts[bits-1])) << 1
+		next[bits] = code
+	}
+
+	codes := make([]huffmanCode, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		codes[symbol] = huffmanCode{bits: reverseBits(next[length], length), length: length}
+		next[length]++
+	}
+	return codes
+}
+
+func reverseBits(v uint32, n uint8) uint32 {
+	var r uint32
+	for i := uint8(0); i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+// huffmanLengths 计算码长，超过 maxLength 时把频次减半后重建，直到满足上限
+func huffmanLengths(histogram []int, maxLength int) []uint8 {
+	counts := append([]int(nil), histogram...)
+	for {
+		lengths, longest := buildHuffmanLengths(counts)
+		if longest <= maxLength {
+			return lengths
+		}
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] = (count + 1) / 2
+			}
+		}
+	}
+}
+
+func buildHuffmanLengths(counts []int) ([]uint8, int) {
+	lengths := make([]uint8, len(counts))
+	nodes := &huffmanHeap{}
+	var parents []int
+	for _, count := range counts {
+		if count > 0 {
+			heap.Push(nodes, huffmanNode{weight: count, index: len(parents)})
+			parents = append(parents, -1)
+		}
+	}
+	if nodes.Len() < 2 {
+		return lengths, 0
+	}
+	for nodes.Len() > 1 {
+		a := heap.Pop(nodes).(huffmanNode)
+		b := heap.Pop(nodes).(huffmanNode)
+		parent := len(parents)
+		parents = append(parents, -1)
+		parents[a.index], parents[b.index] = parent, parent
+		heap.Push(nodes, huffmanNode{weight: a.weight + b.weight, index: parent})
+	}
+
+	longest := 0
+	leaf := 0
+	for symbol, count := range counts {
+		if count == 0 {
+			continue
+		}
+		depth := 0
+		for node := leaf; parents[node] >= 0; node = parents[node] {
+			depth++
+		}
+		lengths[symbol] = uint8(min(depth, 255))
+		longest = max(longest, depth)
+		leaf++
+	}
+	return lengths, longest
+}
+
+type huffmanNode struct {
+	weight int
+	index  int
+}
+
+type huffmanHeap []huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].index < h[j].index
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)   { *h = append(*h, x.(huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	node := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return node
+}
+
+// bitWriter 按 VP8L 约定从低位开始写比特
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) writeCode(code huffmanCode) {
+	if code.length > 0 {
+		w.writeBits(code.bits, uint(code.length))
+	}
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
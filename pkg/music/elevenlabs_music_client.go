@@ -0,0 +1,172 @@
+package music
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+// ElevenLabsMusicClient ElevenLabs 配乐（/v1/music）与音效（/v1/sound-generation）接口
+type ElevenLabsMusicClient struct {
+	BaseURL       string
+	APIKey        string
+	Model         string
+	MusicEndpoint string
+	SFXEndpoint   string
+	HTTPClient    *http.Client
+	lastUsage     usage.TokenUsage
+}
+
+type ElevenLabsMusicRequest struct {
+	Prompt        string `json:"prompt"`
+	MusicLengthMs int    `json:"music_length_ms,omitempty"`
+	ModelID       string `json:"model_id,omitempty"`
+}
+
+type ElevenLabsSoundRequest struct {
+	Text            string  `json:"text"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	PromptInfluence float64 `json:"prompt_influence,omitempty"`
+	ModelID         string  `json:"model_id,omitempty"`
+}
+
+const (
+	elevenLabsMinMusicSeconds = 10
+	elevenLabsMaxMusicSeconds = 300
+	elevenLabsMinSFXSeconds   = 0.5
+	elevenLabsMaxSFXSeconds   = 30
+)
+
+func NewElevenLabsMusicClient(baseURL, apiKey, model string) *ElevenLabsMusicClient {
+	if baseURL == "" {
+		baseURL = "https://api.elevenlabs.io"
+	}
+	return &ElevenLabsMusicClient{
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		APIKey:        apiKey,
+		Model:         model,
+		MusicEndpoint: "/v1/music",
+		SFXEndpoint:   "/v1/sound-generation",
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+func (c *ElevenLabsMusicClient) GenerateMusic(prompt string, opts ...MusicOption) (*MusicResult, error) {
+	return c.GenerateMusicContext(context.Background(), prompt, opts...)
+}
+
+func (c *ElevenLabsMusicClient) GenerateMusicContext(ctx context.Context, prompt string, opts ...MusicOption) (*MusicResult, error) {
+	options := c.applyOptions(opts)
+	reqBody := ElevenLabsMusicRequest{
+		Prompt:  prompt,
+		ModelID: options.Model,
+	}
+	if options.Duration > 0 {
+		reqBody.MusicLengthMs = int(clampSeconds(options.Duration, elevenLabsMinMusicSeconds, elevenLabsMaxMusicSeconds) * 1000)
+	}
+	return c.post(ctx, c.MusicEndpoint, prompt, reqBody)
+}
+
+func (c *ElevenLabsMusicClient) GenerateSoundEffect(prompt string, opts ...MusicOption) (*MusicResult, error) {
+	return c.GenerateSoundEffectContext(context.Background(), prompt, opts...)
+}
+
+func (c *ElevenLabsMusicClient) GenerateSoundEffectContext(ctx context.Context, prompt string, opts ...MusicOption) (*MusicResult, error) {
+	options := c.applyOptions(opts)
+	reqBody := ElevenLabsSoundRequest{
+		Text:            prompt,
+		PromptInfluence: 0.5,
+	}
+	// 音效接口使用独立模型，仅在显式指定时透传
+	if options.Model != "" && options.Model != c.Model {
+		reqBody.ModelID = options.Model
+	}
+	if options.Duration > 0 {
+		reqBody.DurationSeconds = clampSeconds(options.Duration, elevenLabsMinSFXSeconds, elevenLabsMaxSFXSeconds)
+	}
+	return c.post(ctx, c.SFXEndpoint, prompt, reqBody)
+}
+
+func (c *ElevenLabsMusicClient) GetLastUsage() usage.TokenUsage {
+	return c.lastUsage
+}
+
+func (c *ElevenLabsMusicClient) applyOptions(opts []MusicOption) *MusicOptions {
+	options := &MusicOptions{Model: c.Model}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+func (c *ElevenLabsMusicClient) post(ctx context.Context, endpoint, prompt string, payload interface{}) (*MusicResult, error) {
+	c.lastUsage = usage.TokenUsage{}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	url := c.BaseURL + endpoint
+	fmt.Printf("[ElevenLabs] Request URL: %s\n", url)
+	fmt.Printf("[ElevenLabs] Request Body: %s\n", string(jsonData))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "audio/mpeg")
+	req.Header.Set("xi-api-key", c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") || len(body) == 0 {
+		return nil, fmt.Errorf("no audio generated, response: %s", string(body))
+	}
+
+	// 接口不返回 token 用量，按提示词字符数记录
+	chars := utf8.RuneCountInString(prompt)
+	c.lastUsage = usage.TokenUsage{PromptTokens: chars, TotalTokens: chars}
+
+	return &MusicResult{
+		Audio:       body,
+		Format:      "mp3",
+		ContentType: contentType,
+	}, nil
+}
+
+func clampSeconds(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
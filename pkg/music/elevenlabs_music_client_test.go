@@ -0,0 +1,79 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestElevenLabsMusicClient_GenerateMusicClampsLength(t *testing.T) {
+	var got ElevenLabsMusicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/music" || r.Header.Get("xi-api-key") != "key" {
+			t.Fatalf("unexpected request: %s %s", r.URL.Path, r.Header.Get("xi-api-key"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3"))
+	}))
+	defer server.Close()
+
+	client := NewElevenLabsMusicClient(server.URL, "key", "music_v1")
+	result, err := client.GenerateMusic("紧张的弦乐", WithDuration(4))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(result.Audio) != "ID3" {
+		t.Fatalf("unexpected audio: %q", result.Audio)
+	}
+	if got.Prompt != "紧张的弦乐" || got.MusicLengthMs != 10000 || got.ModelID != "music_v1" {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+}
+
+func TestElevenLabsMusicClient_GenerateSoundEffect(t *testing.T) {
+	var got ElevenLabsSoundRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sound-generation" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3"))
+	}))
+	defer server.Close()
+
+	client := NewElevenLabsMusicClient(server.URL, "key", "music_v1")
+	if _, err := client.GenerateSoundEffect("关门声", WithDuration(45)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.Text != "关门声" || got.DurationSeconds != 30 || got.ModelID != "" {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+	if client.GetLastUsage().TotalTokens != 3 {
+		t.Fatalf("unexpected usage: %+v", client.GetLastUsage())
+	}
+}
+
+func TestElevenLabsMusicClient_ContextAbortsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := NewElevenLabsMusicClient(server.URL, "key", "music_v1")
+	if _, err := client.GenerateMusicContext(ctx, "紧张的弦乐"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected music request aborted by the context, got %v", err)
+	}
+	if _, err := client.GenerateSoundEffectContext(ctx, "雷声"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected sound effect request aborted by the context, got %v", err)
+	}
+}
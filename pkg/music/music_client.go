@@ -0,0 +1,41 @@
+package music
+
+import (
+	"context"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+// MusicClient 配乐和音效生成客户端，带 Context 后缀的方法在 ctx 取消或超时时中止请求；不带 ctx 的方法等价于传入 context.Background()
+type MusicClient interface {
+	GenerateMusic(prompt string, opts ...MusicOption) (*MusicResult, error)
+	GenerateSoundEffect(prompt string, opts ...MusicOption) (*MusicResult, error)
+	GenerateMusicContext(ctx context.Context, prompt string, opts ...MusicOption) (*MusicResult, error)
+	GenerateSoundEffectContext(ctx context.Context, prompt string, opts ...MusicOption) (*MusicResult, error)
+	GetLastUsage() usage.TokenUsage
+}
+
+type MusicResult struct {
+	Audio       []byte
+	Format      string
+	ContentType string
+}
+
+type MusicOptions struct {
+	Model    string
+	Duration float64 // 期望时长（秒），0 表示由模型决定
+}
+
+type MusicOption func(*MusicOptions)
+
+func WithModel(model string) MusicOption {
+	return func(o *MusicOptions) {
+		o.Model = model
+	}
+}
+
+func WithDuration(seconds float64) MusicOption {
+	return func(o *MusicOptions) {
+		o.Duration = seconds
+	}
+}
@@ -0,0 +1,113 @@
+package subtitle
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Cue 单条字幕
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// minCueDuration 拆分台词时单条字幕的最短显示时长
+const minCueDuration = 300 * time.Millisecond
+
+// SplitDialogue 将一段台词按行拆分为多条字幕，并按字数比例分配 [start, end) 区间
+func SplitDialogue(dialogue string, start, end time.Duration) []Cue {
+	if end <= start {
+		return nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(dialogue, "\r\n", "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	// 时间不足以逐行显示时合并为一条
+	span := end - start
+	if span < minCueDuration*time.Duration(len(lines)) {
+		return []Cue{{Start: start, End: end, Text: strings.Join(lines, "\n")}}
+	}
+
+	totalRunes := 0
+	for _, line := range lines {
+		totalRunes += utf8.RuneCountInString(line)
+	}
+
+	cues := make([]Cue, 0, len(lines))
+	cursor := start
+	consumed := 0
+	for i, line := range lines {
+		consumed += utf8.RuneCountInString(line)
+		cueEnd := start + span*time.Duration(consumed)/time.Duration(totalRunes)
+		if i == len(lines)-1 {
+			cueEnd = end
+		}
+		cues = append(cues, Cue{Start: cursor, End: cueEnd, Text: line})
+		cursor = cueEnd
+	}
+	return cues
+}
+
+// Normalize 按开始时间排序，去除空字幕，并截断与下一条重叠的部分
+func Normalize(cues []Cue) []Cue {
+	result := make([]Cue, 0, len(cues))
+	for _, cue := range cues {
+		if strings.TrimSpace(cue.Text) != "" && cue.End > cue.Start {
+			result = append(result, cue)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Start < result[j].Start })
+
+	for i := 0; i < len(result)-1; i++ {
+		if result[i].End > result[i+1].Start {
+			result[i].End = result[i+1].Start
+		}
+	}
+
+	filtered := result[:0]
+	for _, cue := range result {
+		if cue.End > cue.Start {
+			filtered = append(filtered, cue)
+		}
+	}
+	return filtered
+}
+
+// FormatSRT 输出 SubRip 格式
+func FormatSRT(cues []Cue) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(cue.Start, ","), formatTimestamp(cue.End, ","), cue.Text)
+	}
+	return b.String()
+}
+
+// FormatWebVTT 输出 WebVTT 格式
+func FormatWebVTT(cues []Cue) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(cue.Start, "."), formatTimestamp(cue.End, "."), cue.Text)
+	}
+	return b.String()
+}
+
+func formatTimestamp(d time.Duration, msSep string) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, msSep, ms%1000)
+}
@@ -0,0 +1,47 @@
+package subtitle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitDialogueDistributesByLength(t *testing.T) {
+	cues := SplitDialogue("小明：你好\n小红：好久不见啊", 2*time.Second, 6*time.Second)
+	if len(cues) != 2 {
+		t.Fatalf("expected 2 cues, got %d", len(cues))
+	}
+	if cues[0].Start != 2*time.Second || cues[1].End != 6*time.Second {
+		t.Fatalf("unexpected bounds: %+v", cues)
+	}
+	if cues[0].End != cues[1].Start {
+		t.Fatalf("expected contiguous cues, got %+v", cues)
+	}
+	if cues[0].End-cues[0].Start >= cues[1].End-cues[1].Start {
+		t.Fatalf("expected shorter line to get less time, got %+v", cues)
+	}
+}
+
+func TestNormalizeTrimsOverlaps(t *testing.T) {
+	cues := Normalize([]Cue{
+		{Start: 3 * time.Second, End: 5 * time.Second, Text: "b"},
+		{Start: 0, End: 4 * time.Second, Text: "a"},
+		{Start: 5 * time.Second, End: 6 * time.Second, Text: " "},
+	})
+	if len(cues) != 2 || cues[0].Text != "a" || cues[0].End != 3*time.Second {
+		t.Fatalf("unexpected normalized cues: %+v", cues)
+	}
+}
+
+func TestFormatSRTAndWebVTT(t *testing.T) {
+	cues := []Cue{{Start: 1500 * time.Millisecond, End: 61*time.Minute + 2*time.Second, Text: "你好"}}
+
+	srt := FormatSRT(cues)
+	if srt != "1\n00:00:01,500 --> 01:01:02,000\n你好\n\n" {
+		t.Fatalf("unexpected srt: %q", srt)
+	}
+
+	vtt := FormatWebVTT(cues)
+	if vtt != "WEBVTT\n\n1\n00:00:01.500 --> 01:01:02.000\n你好\n\n" {
+		t.Fatalf("unexpected vtt: %q", vtt)
+	}
+}
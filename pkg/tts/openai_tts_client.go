@@ -0,0 +1,179 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+type OpenAITTSClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Endpoint   string
+	HTTPClient *http.Client
+	lastUsage  usage.TokenUsage
+}
+
+type SpeechRequest struct {
+	Model          string  `json:"model"`
+	Input          string  `json:"input"`
+	Voice          string  `json:"voice"`
+	ResponseFormat string  `json:"response_format,omitempty"`
+	Speed          float64 `json:"speed,omitempty"`
+	Instructions   string  `json:"instructions,omitempty"`
+}
+
+// openAIVoices OpenAI /audio/speech 支持的内置音色
+var openAIVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer", "verse"}
+
+func NewOpenAITTSClient(baseURL, apiKey, model, endpoint string) *OpenAITTSClient {
+	if endpoint == "" {
+		endpoint = "/v1/audio/speech"
+	}
+	return &OpenAITTSClient{
+		BaseURL:  baseURL,
+		APIKey:   apiKey,
+		Model:    model,
+		Endpoint: endpoint,
+		HTTPClient: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+func (c *OpenAITTSClient) Synthesize(text string, opts ...TTSOption) (*TTSResult, error) {
+	return c.SynthesizeContext(context.Background(), text, opts...)
+}
+
+func (c *OpenAITTSClient) SynthesizeContext(ctx context.Context, text string, opts ...TTSOption) (*TTSResult, error) {
+	c.lastUsage = usage.TokenUsage{}
+	options := &TTSOptions{
+		Voice:  "alloy",
+		Format: "mp3",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	model := c.Model
+	if options.Model != "" {
+		model = options.Model
+	}
+
+	reqBody := SpeechRequest{
+		Model:          model,
+		Input:          text,
+		Voice:          options.Voice,
+		ResponseFormat: options.Format,
+		Speed:          options.Speed,
+		Instructions:   options.Instructions,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	url := c.BaseURL + c.Endpoint
+	fmt.Printf("[OpenAI TTS] Request URL: %s, voice: %s, chars: %d\n", url, options.Voice, utf8.RuneCountInString(text))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") || len(body) == 0 {
+		return nil, fmt.Errorf("no audio generated, response: %s", string(body))
+	}
+
+	// 语音接口不返回 token 用量，按输入字符数记录
+	chars := utf8.RuneCountInString(text)
+	c.lastUsage = usage.TokenUsage{PromptTokens: chars, TotalTokens: chars}
+
+	return &TTSResult{
+		Audio:       body,
+		Format:      options.Format,
+		ContentType: contentType,
+	}, nil
+}
+
+func (c *OpenAITTSClient) GetLastUsage() usage.TokenUsage {
+	return c.lastUsage
+}
+
+// ResolveOpenAIVoice 根据角色的音色描述选择 OpenAI 内置音色
+// 描述中直接写明音色名时优先使用，否则按性别、年龄关键词匹配
+func ResolveOpenAIVoice(style string) string {
+	lower := strings.ToLower(strings.TrimSpace(style))
+	if lower == "" {
+		return "alloy"
+	}
+
+	for _, voice := range openAIVoices {
+		if lower == voice || strings.Contains(lower, voice) {
+			return voice
+		}
+	}
+
+	containsAny := func(keywords ...string) bool {
+		for _, kw := range keywords {
+			if strings.Contains(lower, kw) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case containsAny("童", "孩", "child", "kid"):
+		return "shimmer"
+	case containsAny("老", "old", "elder"):
+		if containsAny("女", "female", "woman") {
+			return "sage"
+		}
+		return "fable"
+	case containsAny("女", "female", "woman", "girl"):
+		if containsAny("活泼", "甜", "少女", "bright", "cheerful") {
+			return "coral"
+		}
+		return "nova"
+	case containsAny("男", "male", "man", "boy"):
+		if containsAny("低沉", "浑厚", "deep", "low") {
+			return "onyx"
+		}
+		return "echo"
+	case containsAny("旁白", "narrat"):
+		return "fable"
+	}
+
+	return "alloy"
+}
@@ -0,0 +1,90 @@
+package tts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAITTSClient_SynthesizeSendsSpeechRequest(t *testing.T) {
+	var got SpeechRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/speech" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Fatalf("unexpected auth header: %s", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3fake"))
+	}))
+	defer server.Close()
+
+	client := NewOpenAITTSClient(server.URL, "test-key", "gpt-4o-mini-tts", "")
+	result, err := client.Synthesize("你好，世界", WithVoice("nova"), WithInstructions("温柔"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(result.Audio) != "ID3fake" || result.Format != "mp3" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if got.Model != "gpt-4o-mini-tts" || got.Voice != "nova" || got.Input != "你好，世界" || got.Instructions != "温柔" {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+	if client.GetLastUsage().TotalTokens != 5 {
+		t.Fatalf("expected usage of 5 chars, got %+v", client.GetLastUsage())
+	}
+}
+
+func TestOpenAITTSClient_RejectsJSONBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"error":"quota"}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenAITTSClient(server.URL, "k", "tts-1", "/audio/speech")
+	if _, err := client.Synthesize("hi"); err == nil {
+		t.Fatalf("expected error for json response")
+	}
+}
+
+func TestResolveOpenAIVoice(t *testing.T) {
+	cases := map[string]string{
+		"":                 "alloy",
+		"Onyx":             "onyx",
+		"温柔女声":             "nova",
+		"低沉男声":             "onyx",
+		"年轻男性":             "echo",
+		"慈祥的老奶奶，女声":        "sage",
+		"female, cheerful": "coral",
+	}
+	for style, want := range cases {
+		if got := ResolveOpenAIVoice(style); got != want {
+			t.Fatalf("ResolveOpenAIVoice(%q) = %q, want %q", style, got, want)
+		}
+	}
+}
+
+func TestOpenAITTSClient_SynthesizeContextAbortsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := NewOpenAITTSClient(server.URL, "k", "tts-1", "")
+	if _, err := client.SynthesizeContext(ctx, "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected request aborted by the context, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package tts
+
+import (
+	"context"
+
+	"github.com/drama-generator/backend/pkg/usage"
+)
+
+// TTSClient 语音合成客户端，SynthesizeContext 在 ctx 取消或超时时中止请求；Synthesize 等价于传入 context.Background()
+type TTSClient interface {
+	Synthesize(text string, opts ...TTSOption) (*TTSResult, error)
+	SynthesizeContext(ctx context.Context, text string, opts ...TTSOption) (*TTSResult, error)
+	GetLastUsage() usage.TokenUsage
+}
+
+type TTSResult struct {
+	Audio       []byte
+	Format      string // mp3, wav, opus, aac, flac, pcm
+	ContentType string
+}
+
+type TTSOptions struct {
+	Model        string
+	Voice        string
+	Format       string
+	Speed        float64
+	Instructions string // 语气/风格描述，部分模型支持
+}
+
+type TTSOption func(*TTSOptions)
+
+func WithModel(model string) TTSOption {
+	return func(o *TTSOptions) {
+		o.Model = model
+	}
+}
+
+func WithVoice(voice string) TTSOption {
+	return func(o *TTSOptions) {
+		o.Voice = voice
+	}
+}
+
+func WithFormat(format string) TTSOption {
+	return func(o *TTSOptions) {
+		o.Format = format
+	}
+}
+
+func WithSpeed(speed float64) TTSOption {
+	return func(o *TTSOptions) {
+		o.Speed = speed
+	}
+}
+
+func WithInstructions(instructions string) TTSOption {
+	return func(o *TTSOptions) {
+		o.Instructions = instructions
+	}
+}
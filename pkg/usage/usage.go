@@ -1,7 +1,99 @@
 package usage
 
+import (
+	"context"
+	"sync"
+)
+
 type TokenUsage struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
 }
+
+// Add 返回两次用量之和
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// IsZero 没有任何 token 计数
+func (u TokenUsage) IsZero() bool {
+	return u.PromptTokens <= 0 && u.CompletionTokens <= 0 && u.TotalTokens <= 0
+}
+
+// Meter 通过 ctx 传给客户端，累计这一次调用消耗的 token。
+// 每个调用使用自己的 Meter，同一个客户端被并发调用时各自的用量互不覆盖
+type Meter struct {
+	mu     sync.Mutex
+	total  TokenUsage
+	parent *Meter
+}
+
+type meterKey struct{}
+
+// WithMeter 返回挂载了新 Meter 的 ctx。ctx 中已有 Meter 时，记录的用量同时累加到外层
+func WithMeter(ctx context.Context) (context.Context, *Meter) {
+	parent, _ := ctx.Value(meterKey{}).(*Meter)
+	meter := &Meter{parent: parent}
+	return context.WithValue(ctx, meterKey{}, meter), meter
+}
+
+// Record 客户端拿到服务商返回的用量后调用，ctx 中没有 Meter 时忽略
+func Record(ctx context.Context, tokenUsage TokenUsage) {
+	if ctx == nil || tokenUsage.IsZero() {
+		return
+	}
+	if meter, ok := ctx.Value(meterKey{}).(*Meter); ok {
+		meter.add(tokenUsage)
+	}
+}
+
+func (m *Meter) add(tokenUsage TokenUsage) {
+	for ; m != nil; m = m.parent {
+		m.mu.Lock()
+		m.total = m.total.Add(tokenUsage)
+		m.mu.Unlock()
+	}
+}
+
+// Total 目前为止记录的用量
+func (m *Meter) Total() TokenUsage {
+	if m == nil {
+		return TokenUsage{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// Last 客户端最近一次调用的用量，供 GetLastUsage 兼容旧调用方。
+// Set 同时把用量记到 ctx 的 Meter 上；同一客户端并发调用时 Get 的结果不可靠，应改用 Meter
+type Last struct {
+	mu    sync.Mutex
+	usage TokenUsage
+}
+
+// Set 每次调用只应在拿到最终用量时调用一次，避免重复计入 Meter
+func (l *Last) Set(ctx context.Context, tokenUsage TokenUsage) {
+	l.mu.Lock()
+	l.usage = tokenUsage
+	l.mu.Unlock()
+	Record(ctx, tokenUsage)
+}
+
+// Reset 开始新的调用前清空
+func (l *Last) Reset() {
+	l.mu.Lock()
+	l.usage = TokenUsage{}
+	l.mu.Unlock()
+}
+
+func (l *Last) Get() TokenUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.usage
+}
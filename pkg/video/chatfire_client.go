@@ -2,6 +2,7 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -127,6 +128,10 @@ func NewChatfireClient(baseURL, apiKey, model, endpoint, queryEndpoint string) *
 }
 
 func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+	return c.GenerateVideoContext(context.Background(), imageURL, prompt, opts...)
+}
+
+func (c *ChatfireClient) GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	c.lastUsage = usage.TokenUsage{}
 	options := &VideoOptions{
 		Duration:    5,
@@ -167,6 +172,9 @@ func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpt
 		if options.Duration > 0 {
 			promptText += fmt.Sprintf("  --dur %d", options.Duration)
 		}
+		if options.Seed != 0 {
+			promptText += fmt.Sprintf("  --seed %d", options.Seed)
+		}
 
 		// 添加文本内容
 		reqBody.Content = append(reqBody.Content, struct {
@@ -303,7 +311,7 @@ func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpt
 	}
 
 	endpoint := c.BaseURL + c.Endpoint
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -367,6 +375,10 @@ func (c *ChatfireClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpt
 }
 
 func (c *ChatfireClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *ChatfireClient) GetTaskStatusContext(ctx context.Context, taskID string) (*VideoResult, error) {
 	queryPath := c.QueryEndpoint
 	if strings.Contains(queryPath, "{taskId}") {
 		queryPath = strings.ReplaceAll(queryPath, "{taskId}", taskID)
@@ -377,7 +389,7 @@ func (c *ChatfireClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 	}
 
 	endpoint := c.BaseURL + queryPath
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -451,3 +463,12 @@ func (c *ChatfireClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 func (c *ChatfireClient) GetLastUsage() usage.TokenUsage {
 	return c.lastUsage
 }
+
+// ReferenceCapabilities 只有豆包/Seedance 格式的请求会携带参考图和 seed
+func (c *ChatfireClient) ReferenceCapabilities() ReferenceCapabilities {
+	modelLower := strings.ToLower(c.Model)
+	if strings.Contains(modelLower, "doubao") || strings.Contains(modelLower, "seedance") {
+		return ReferenceCapabilities{MaxReferenceImages: 4, Seed: true}
+	}
+	return ReferenceCapabilities{}
+}
@@ -2,6 +2,7 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -117,6 +118,10 @@ func NewMinimaxClient(baseURL, apiKey, model string) *MinimaxClient {
 // GenerateVideo 生成视频（支持首尾帧和主体参考）
 // 步骤1：创建任务，返回 task_id
 func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+	return c.GenerateVideoContext(context.Background(), imageURL, prompt, opts...)
+}
+
+func (c *MinimaxClient) GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	c.lastUsage = usage.TokenUsage{}
 	options := &VideoOptions{
 		Duration:   6,
@@ -163,7 +168,7 @@ func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpti
 	// 步骤1：创建任务，POST 请求
 	// 注意：BaseURL 应该已包含 /v1，例如 https://api.minimaxi.com/v1
 	endpoint := c.BaseURL + "/video_generation"
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -208,10 +213,14 @@ func (c *MinimaxClient) GenerateVideo(imageURL, prompt string, opts ...VideoOpti
 // GetTaskStatus 查询任务状态
 // 步骤2：查询任务状态，如果成功则进入步骤3获取文件下载地址
 func (c *MinimaxClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *MinimaxClient) GetTaskStatusContext(ctx context.Context, taskID string) (*VideoResult, error) {
 	// 步骤2：查询任务状态
 	// 注意：BaseURL 应该已包含 /v1
 	endpoint := fmt.Sprintf("%s/query/video_generation?task_id=%s", c.BaseURL, taskID)
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -252,7 +261,7 @@ func (c *MinimaxClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 
 	// 如果状态是 Success 且有 file_id，则获取文件下载地址
 	if queryResult.Status == "Success" && queryResult.FileID != "" {
-		downloadURL, err := c.getFileDownloadURL(queryResult.FileID)
+		downloadURL, err := c.getFileDownloadURL(ctx, queryResult.FileID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get download URL: %w", err)
 		}
@@ -271,10 +280,10 @@ func (c *MinimaxClient) GetLastUsage() usage.TokenUsage {
 }
 
 // getFileDownloadURL 步骤3：根据 file_id 获取文件下载地址
-func (c *MinimaxClient) getFileDownloadURL(fileID string) (string, error) {
+func (c *MinimaxClient) getFileDownloadURL(ctx context.Context, fileID string) (string, error) {
 	// 注意：BaseURL 应该已包含 /v1
 	endpoint := fmt.Sprintf("%s/files/retrieve?file_id=%s", c.BaseURL, fileID)
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return "", fmt.Errorf("create request: %w", err)
 	}
@@ -2,6 +2,7 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -58,6 +59,10 @@ func NewOpenAISoraClient(baseURL, apiKey, model string) *OpenAISoraClient {
 }
 
 func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+	return c.GenerateVideoContext(context.Background(), imageURL, prompt, opts...)
+}
+
+func (c *OpenAISoraClient) GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	c.lastUsage = usage.TokenUsage{}
 	options := &VideoOptions{
 		Duration: 4,
@@ -188,7 +193,7 @@ func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoO
 	writer.Close()
 
 	endpoint := c.BaseURL + "/videos"
-	req, err := http.NewRequest("POST", endpoint, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, body)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -237,8 +242,12 @@ func (c *OpenAISoraClient) GenerateVideo(imageURL, prompt string, opts ...VideoO
 }
 
 func (c *OpenAISoraClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *OpenAISoraClient) GetTaskStatusContext(ctx context.Context, taskID string) (*VideoResult, error) {
 	endpoint := c.BaseURL + "/videos/" + taskID
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -2,6 +2,7 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,12 +12,21 @@ import (
 	"github.com/drama-generator/backend/pkg/usage"
 )
 
+// VideoClient 视频生成客户端，Context 方法在 ctx 取消或超时时中止请求
 type VideoClient interface {
 	GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error)
 	GetTaskStatus(taskID string) (*VideoResult, error)
+	GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error)
+	GetTaskStatusContext(ctx context.Context, taskID string) (*VideoResult, error)
 	GetLastUsage() usage.TokenUsage
 }
 
+// TaskCanceller 支持取消服务端任务的客户端可选实现
+type TaskCanceller interface {
+	CancelTask(taskID string) error
+	CancelTaskContext(ctx context.Context, taskID string) error
+}
+
 type VideoResult struct {
 	TaskID       string
 	Status       string
@@ -30,6 +40,17 @@ type VideoResult struct {
 	Usage        usage.TokenUsage
 }
 
+// ReferenceCapabilities 客户端对多图参考和 seed 的支持情况，MaxReferenceImages 为 0 表示不接受参考图
+type ReferenceCapabilities struct {
+	MaxReferenceImages int
+	Seed               bool
+}
+
+// ReferenceCapable 支持参考图或 seed 的客户端实现，分镜视频据此自动注入角色参考图
+type ReferenceCapable interface {
+	ReferenceCapabilities() ReferenceCapabilities
+}
+
 type VideoOptions struct {
 	Model              string
 	Duration           int
@@ -157,6 +178,10 @@ func NewRunwayClient(baseURL, apiKey, model string) *RunwayClient {
 }
 
 func (c *RunwayClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+	return c.GenerateVideoContext(context.Background(), imageURL, prompt, opts...)
+}
+
+func (c *RunwayClient) GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	c.lastUsage = usage.TokenUsage{}
 	options := &VideoOptions{
 		Duration:    5,
@@ -187,7 +212,7 @@ func (c *RunwayClient) GenerateVideo(imageURL, prompt string, opts ...VideoOptio
 	}
 
 	endpoint := c.BaseURL + "/v1/video/generate"
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -233,8 +258,12 @@ func (c *RunwayClient) GenerateVideo(imageURL, prompt string, opts ...VideoOptio
 }
 
 func (c *RunwayClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *RunwayClient) GetTaskStatusContext(ctx context.Context, taskID string) (*VideoResult, error) {
 	endpoint := c.BaseURL + "/v1/video/status/" + taskID
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -278,6 +307,10 @@ func (c *RunwayClient) GetLastUsage() usage.TokenUsage {
 	return c.lastUsage
 }
 
+func (c *RunwayClient) ReferenceCapabilities() ReferenceCapabilities {
+	return ReferenceCapabilities{Seed: true}
+}
+
 type PikaClient struct {
 	BaseURL    string
 	APIKey     string
@@ -318,6 +351,10 @@ func NewPikaClient(baseURL, apiKey, model string) *PikaClient {
 }
 
 func (c *PikaClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+	return c.GenerateVideoContext(context.Background(), imageURL, prompt, opts...)
+}
+
+func (c *PikaClient) GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	c.lastUsage = usage.TokenUsage{}
 	options := &VideoOptions{
 		Duration:    3,
@@ -351,7 +388,7 @@ func (c *PikaClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption)
 	}
 
 	endpoint := c.BaseURL + "/v1/video/generate"
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -397,8 +434,12 @@ func (c *PikaClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption)
 }
 
 func (c *PikaClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *PikaClient) GetTaskStatusContext(ctx context.Context, taskID string) (*VideoResult, error) {
 	endpoint := c.BaseURL + "/v1/video/status/" + taskID
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -441,3 +482,7 @@ func (c *PikaClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 func (c *PikaClient) GetLastUsage() usage.TokenUsage {
 	return c.lastUsage
 }
+
+func (c *PikaClient) ReferenceCapabilities() ReferenceCapabilities {
+	return ReferenceCapabilities{Seed: true}
+}
@@ -2,6 +2,7 @@ package video
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -138,7 +139,7 @@ func isRetryableNetworkError(err error) bool {
 	return false
 }
 
-func (c *VolcesArkClient) doRequestWithRetry(method, endpoint string, jsonBody []byte) (*http.Response, error) {
+func (c *VolcesArkClient) doRequestWithRetry(ctx context.Context, method, endpoint string, jsonBody []byte) (*http.Response, error) {
 	const maxAttempts = 3
 	var lastErr error
 
@@ -148,7 +149,7 @@ func (c *VolcesArkClient) doRequestWithRetry(method, endpoint string, jsonBody [
 			bodyReader = bytes.NewReader(jsonBody)
 		}
 
-		req, err := http.NewRequest(method, endpoint, bodyReader)
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bodyReader)
 		if err != nil {
 			return nil, fmt.Errorf("create request: %w", err)
 		}
@@ -163,13 +164,19 @@ func (c *VolcesArkClient) doRequestWithRetry(method, endpoint string, jsonBody [
 		}
 
 		lastErr = err
-		if attempt == maxAttempts || !isRetryableNetworkError(err) {
+		if attempt == maxAttempts || !isRetryableNetworkError(err) || ctx.Err() != nil {
 			break
 		}
 
 		backoff := time.Duration(attempt) * time.Second
 		fmt.Printf("[VolcesARK] Request failed (attempt %d/%d): %v, retrying in %s\n", attempt, maxAttempts, err, backoff)
-		time.Sleep(backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("send request: %w", ctx.Err())
+		case <-timer.C:
+		}
 	}
 
 	return nil, fmt.Errorf("send request: %w", lastErr)
@@ -177,6 +184,10 @@ func (c *VolcesArkClient) doRequestWithRetry(method, endpoint string, jsonBody [
 
 // GenerateVideo 生成视频（支持首帧、首尾帧、参考图等多种模式）
 func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
+	return c.GenerateVideoContext(context.Background(), imageURL, prompt, opts...)
+}
+
+func (c *VolcesArkClient) GenerateVideoContext(ctx context.Context, imageURL, prompt string, opts ...VideoOption) (*VideoResult, error) {
 	c.lastUsage = usage.TokenUsage{}
 	options := &VideoOptions{
 		Duration:    5,
@@ -207,6 +218,9 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 	if options.Duration > 0 {
 		promptText += fmt.Sprintf("  --dur %d", options.Duration)
 	}
+	if options.Seed != 0 {
+		promptText += fmt.Sprintf("  --seed %d", options.Seed)
+	}
 
 	content := []VolcesArkContent{
 		{
@@ -297,7 +311,7 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 	fmt.Printf("[VolcesARK] Generating video - Endpoint: %s, FullURL: %s, Model: %s\n", c.Endpoint, endpoint, model)
 	fmt.Printf("[VolcesARK] Request body: %s\n", string(jsonData))
 
-	resp, err := c.doRequestWithRetry(http.MethodPost, endpoint, jsonData)
+	resp, err := c.doRequestWithRetry(ctx, http.MethodPost, endpoint, jsonData)
 	if err != nil {
 		return nil, err
 	}
@@ -342,7 +356,7 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 			fmt.Printf("[VolcesARK] Retrying with single-image i2v fallback for seedance-1-5-pro\n")
 			fmt.Printf("[VolcesARK] Fallback request body: %s\n", string(fallbackJSON))
 
-			retryResp, rErr := c.doRequestWithRetry(http.MethodPost, endpoint, fallbackJSON)
+			retryResp, rErr := c.doRequestWithRetry(ctx, http.MethodPost, endpoint, fallbackJSON)
 			if rErr != nil {
 				return nil, fmt.Errorf("fallback request failed: %w", rErr)
 			}
@@ -399,8 +413,8 @@ func (c *VolcesArkClient) GenerateVideo(imageURL, prompt string, opts ...VideoOp
 	return videoResult, nil
 }
 
-func (c *VolcesArkClient) GetTaskStatus(taskID string) (*VideoResult, error) {
-	// 替换占位符{taskId}、{task_id}或直接拼接
+// taskEndpoint 替换占位符{taskId}、{task_id}或直接拼接
+func (c *VolcesArkClient) taskEndpoint(taskID string) string {
 	queryPath := c.QueryEndpoint
 	if strings.Contains(queryPath, "{taskId}") {
 		queryPath = strings.ReplaceAll(queryPath, "{taskId}", taskID)
@@ -409,11 +423,18 @@ func (c *VolcesArkClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 	} else {
 		queryPath = queryPath + "/" + taskID
 	}
+	return c.BaseURL + queryPath
+}
 
-	endpoint := c.BaseURL + queryPath
+func (c *VolcesArkClient) GetTaskStatus(taskID string) (*VideoResult, error) {
+	return c.GetTaskStatusContext(context.Background(), taskID)
+}
+
+func (c *VolcesArkClient) GetTaskStatusContext(ctx context.Context, taskID string) (*VideoResult, error) {
+	endpoint := c.taskEndpoint(taskID)
 	fmt.Printf("[VolcesARK] Querying task status - TaskID: %s, QueryEndpoint: %s, FullURL: %s\n", taskID, c.QueryEndpoint, endpoint)
 
-	resp, err := c.doRequestWithRetry(http.MethodGet, endpoint, nil)
+	resp, err := c.doRequestWithRetry(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -458,6 +479,30 @@ func (c *VolcesArkClient) GetTaskStatus(taskID string) (*VideoResult, error) {
 	return videoResult, nil
 }
 
+// CancelTask 取消排队中的任务，运行中的任务服务端会拒绝取消
+func (c *VolcesArkClient) CancelTask(taskID string) error {
+	return c.CancelTaskContext(context.Background(), taskID)
+}
+
+func (c *VolcesArkClient) CancelTaskContext(ctx context.Context, taskID string) error {
+	resp, err := c.doRequestWithRetry(ctx, http.MethodDelete, c.taskEndpoint(taskID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("cancel task failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 func (c *VolcesArkClient) GetLastUsage() usage.TokenUsage {
 	return c.lastUsage
 }
+
+// ReferenceCapabilities Seedance 多图参考最多 4 张，seed 通过 --seed 参数传入
+func (c *VolcesArkClient) ReferenceCapabilities() ReferenceCapabilities {
+	return ReferenceCapabilities{MaxReferenceImages: 4, Seed: true}
+}
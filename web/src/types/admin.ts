@@ -90,7 +90,7 @@ export interface AdminRechargeResponse {
 
 export type AdminAuthResponse = AuthResponse
 
-export type AdminAIServiceType = 'text' | 'image' | 'video'
+export type AdminAIServiceType = 'text' | 'image' | 'video' | 'audio' | 'music'
 
 // Backend returns masked secrets for admin AI configs:
 // - api_key is always empty string
@@ -16,7 +16,7 @@ export interface AIServiceConfig {
   updated_at: string
 }
 
-export type AIServiceType = 'text' | 'image' | 'video'
+export type AIServiceType = 'text' | 'image' | 'video' | 'audio' | 'music'
 
 export interface CreateAIConfigRequest {
   service_type: AIServiceType